@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -76,11 +77,27 @@ func main() {
 	wishlistRepo := repository.NewWishlistRepository(db)
 	eventRepo := repository.NewEventRepository(db)
 	invoiceRepo := mongo.NewInvoiceRepository(db)
+	creditNoteRepo := mongo.NewCreditNoteRepository(db)
     loyaltyRepo := mongo.NewLoyaltyRepository(db)
 	homepageRepo := mongo.NewHomepageRepository(db)
 	communityRepo := mongo.NewCommunityRepository(db)
 	aiRepo := mongo.NewAIRepository(db)
 	customOrderRepo := mongo.NewCustomOrderRepository(db)
+	stockRepo := mongo.NewStockRepository(db)
+	paymentAttemptRepo := mongo.NewPaymentAttemptRepository(db)
+	webhookEventRepo := mongo.NewWebhookEventRepository(db)
+	reconciliationReportRepo := mongo.NewReconciliationReportRepository(db)
+	returnRepo := mongo.NewReturnRepository(db)
+	warrantyRepo := mongo.NewWarrantyRepository(db)
+	certificateRepo := mongo.NewCertificateRepository(db)
+	inventoryUnitRepo := mongo.NewInventoryUnitRepository(db)
+	metalRateRepo := mongo.NewMetalRateRepository(db)
+	variantRepo := mongo.NewVariantRepository(db)
+	stockLocationRepo := mongo.NewStockLocationRepository(db)
+	backInStockRepo := mongo.NewBackInStockRepository(db)
+	stockTransferRepo := mongo.NewStockTransferRepository(db)
+	adminNotificationRepo := mongo.NewAdminNotificationRepository(db)
+	trackingRepo := mongo.NewPDFRepository(db)
     // notificationRepo := mongo.NewNotificationRepository(db)
 
 	// Initialize storefront repository early for order ID generation
@@ -95,6 +112,12 @@ func main() {
     loyaltyService := services.NewLoyaltyService(loyaltyRepo, userRepo, nil)
 	orderService := services.NewOrderService(orderRepo, productRepo, cartRepo)
 	invoiceService := services.NewInvoiceService(invoiceRepo, orderRepo, userRepo)
+	if invoiceServiceImpl, ok := invoiceService.(interface{ SetStorefrontRepo(*repository.StorefrontDataRepository) }); ok {
+		invoiceServiceImpl.SetStorefrontRepo(storefrontDataRepo)
+	}
+	if invoiceServiceImpl, ok := invoiceService.(interface{ SetCreditNoteRepository(repository.CreditNoteRepository) }); ok {
+		invoiceServiceImpl.SetCreditNoteRepository(creditNoteRepo)
+	}
 	homepageService := services.NewHomepageService(homepageRepo, productRepo)
 	communityService := services.NewCommunityService(communityRepo, userRepo)
 	aiService := services.NewAIService(aiRepo)
@@ -134,6 +157,94 @@ func main() {
 		orderServiceImpl.SetStorefrontRepo(storefrontDataRepo)
 	}
 
+	// Set homepage repo on order service so deals and flash sales are honoured at checkout
+	if orderServiceImpl, ok := orderService.(interface{ SetHomepageRepository(repository.HomepageRepository) }); ok {
+		orderServiceImpl.SetHomepageRepository(homepageRepo)
+	}
+
+	// Set coupon repo on order service so cart coupons are honoured at checkout
+	if orderServiceImpl, ok := orderService.(interface{ SetCouponRepository(repository.CouponRepository) }); ok {
+		orderServiceImpl.SetCouponRepository(couponRepo)
+	}
+
+	// Set storefront settings and promotional pricing on cart service for cart summaries
+	if cartServiceImpl, ok := cartService.(interface{ SetStorefrontRepo(*repository.StorefrontDataRepository) }); ok {
+		cartServiceImpl.SetStorefrontRepo(storefrontDataRepo)
+	}
+
+	// Initialize metal rate service; metal_rate products follow the live per-gram rates
+	metalRateService := services.NewMetalRateService(metalRateRepo, productRepo)
+	if metalRateServiceImpl, ok := metalRateService.(interface{ SetStorefrontRepo(*repository.StorefrontDataRepository) }); ok {
+		metalRateServiceImpl.SetStorefrontRepo(storefrontDataRepo)
+	}
+	if productServiceImpl, ok := productService.(interface{ SetMetalRateService(services.MetalRateService) }); ok {
+		productServiceImpl.SetMetalRateService(metalRateService)
+	}
+	aiService.SetMetalRateService(metalRateService)
+
+	// Cart and checkout share one pricing service so both see the same rates and promotions
+	pricingService := services.NewPricingService(homepageRepo)
+	if pricingServiceImpl, ok := pricingService.(interface{ SetMetalRateService(services.MetalRateService) }); ok {
+		pricingServiceImpl.SetMetalRateService(metalRateService)
+	}
+	if cartServiceImpl, ok := cartService.(interface{ SetPricingService(services.PricingService) }); ok {
+		cartServiceImpl.SetPricingService(pricingService)
+	}
+	if orderServiceImpl, ok := orderService.(interface{ SetPricingService(services.PricingService) }); ok {
+		orderServiceImpl.SetPricingService(pricingService)
+	}
+
+	// Set stock service on order service for stock reservation at checkout
+	stockService := services.NewStockService(stockRepo)
+	if orderServiceImpl, ok := orderService.(interface{ SetStockService(services.StockService) }); ok {
+		orderServiceImpl.SetStockService(stockService)
+	}
+	// Manual stock changes go through the stock ledger; low-stock alerts land in the admin inbox
+	if productServiceImpl, ok := productService.(interface{ SetStockService(services.StockService) }); ok {
+		productServiceImpl.SetStockService(stockService)
+	}
+	if stockServiceImpl, ok := stockService.(interface {
+		SetAdminNotificationRepository(repository.AdminNotificationRepository)
+	}); ok {
+		stockServiceImpl.SetAdminNotificationRepository(adminNotificationRepo)
+	}
+	// Once locations are set up, stock is held per warehouse and showroom and orders are allocated by pincode
+	if stockServiceImpl, ok := stockService.(interface {
+		SetStockLocationRepository(repository.StockLocationRepository)
+	}); ok {
+		stockServiceImpl.SetStockLocationRepository(stockLocationRepo)
+	}
+	locationService := services.NewLocationService(stockLocationRepo, stockTransferRepo, productRepo, orderRepo, userRepo, stockService)
+	// Stock can be imported by CSV, looking variants up by SKU or barcode
+	if stockServiceImpl, ok := stockService.(interface {
+		SetProductRepository(repository.ProductRepository)
+		SetVariantRepository(repository.VariantRepository)
+	}); ok {
+		stockServiceImpl.SetProductRepository(productRepo)
+		stockServiceImpl.SetVariantRepository(variantRepo)
+	}
+
+	// Back-in-stock alerts go out by push, SMS or WhatsApp when manual changes or imports restock a product
+	backInStockService := services.NewBackInStockService(backInStockRepo, productRepo, userRepo)
+	if backInStockServiceImpl, ok := backInStockService.(interface {
+		SetWishlistRepository(repository.WishlistRepository)
+		SetPushSender(services.BackInStockPushSender)
+		SetMessenger(services.BackInStockMessenger)
+		SetProductURL(string)
+	}); ok {
+		backInStockServiceImpl.SetWishlistRepository(wishlistRepo)
+		backInStockServiceImpl.SetPushSender(&services.NotificationService{})
+		backInStockServiceImpl.SetMessenger(messagingService)
+		backInStockServiceImpl.SetProductURL(strings.TrimRight(cfg.App.FrontendURL, "/") + "/products")
+	}
+	if stockServiceImpl, ok := stockService.(interface{ SetBackInStockService(services.BackInStockService) }); ok {
+		stockServiceImpl.SetBackInStockService(backInStockService)
+	}
+	if orderServiceImpl, ok := orderService.(interface{ SetBackInStockService(services.BackInStockService) }); ok {
+		orderServiceImpl.SetBackInStockService(backInStockService)
+	}
+	adminNotificationService := services.NewAdminNotificationService(adminNotificationRepo)
+
 	// Set loyalty service on order service for purchase points integration
 	if orderServiceImpl, ok := orderService.(interface{ SetLoyaltyService(*services.LoyaltyService) }); ok {
 		orderServiceImpl.SetLoyaltyService(loyaltyService)
@@ -142,15 +253,160 @@ func main() {
     // Set notification service on other services (wishlist disabled in build-only profile)
 	
     guestService := services.NewGuestSessionService(guestRepo, cartRepo)
+	if guestServiceImpl, ok := guestService.(interface {
+		SetOrderRepository(repository.OrderRepository)
+		SetHomepageRepository(repository.HomepageRepository)
+		SetUserRepository(repository.UserRepository)
+	}); ok {
+		guestServiceImpl.SetOrderRepository(orderRepo)
+		guestServiceImpl.SetHomepageRepository(homepageRepo)
+		guestServiceImpl.SetUserRepository(userRepo)
+	}
 	reviewService := services.NewReviewService(reviewRepo, productRepo, userRepo)
-	paymentService := services.NewPaymentService(orderRepo, cfg.Razorpay)
+	// Payment gateways are registered by payment method and served under /payment/:gateway
+	paymentGateways := services.NewPaymentGatewayRegistry(
+		services.NewRazorpayGateway(cfg.Razorpay),
+		services.NewCashfreeGateway(cashfreeService),
+		services.NewCODGateway(),
+	)
+	paymentService := services.NewPaymentService(orderRepo, paymentAttemptRepo, paymentGateways)
+	if paymentServiceImpl, ok := paymentService.(interface{ SetOrderService(services.OrderService) }); ok {
+		paymentServiceImpl.SetOrderService(orderService)
+	}
+	if paymentServiceImpl, ok := paymentService.(interface{ SetWebhookEventRepository(repository.WebhookEventRepository) }); ok {
+		paymentServiceImpl.SetWebhookEventRepository(webhookEventRepo)
+	}
+	if paymentServiceImpl, ok := paymentService.(interface{ SetReconciliationReportRepository(repository.ReconciliationReportRepository) }); ok {
+		paymentServiceImpl.SetReconciliationReportRepository(reconciliationReportRepo)
+	}
+	if paymentServiceImpl, ok := paymentService.(interface{ SetLoyaltyService(*services.LoyaltyService) }); ok {
+		paymentServiceImpl.SetLoyaltyService(loyaltyService)
+	}
+	if paymentServiceImpl, ok := paymentService.(interface{ SetInvoiceService(services.InvoiceService) }); ok {
+		paymentServiceImpl.SetInvoiceService(invoiceService)
+	}
+
+	// Set payment service on order service so cancellations and returns are refunded through the gateway
+	if orderServiceImpl, ok := orderService.(interface{ SetPaymentService(services.PaymentService) }); ok {
+		orderServiceImpl.SetPaymentService(paymentService)
+	}
+	// Payments that arrive for cancelled orders are refunded and flagged in the admin inbox
+	if orderServiceImpl, ok := orderService.(interface {
+		SetAdminNotificationRepository(repository.AdminNotificationRepository)
+	}); ok {
+		orderServiceImpl.SetAdminNotificationRepository(adminNotificationRepo)
+	}
+
+	// Initialize shipping service for pincode quotes and serviceability
+	shippingService := services.NewShippingService()
+	if shippingServiceImpl, ok := shippingService.(interface{ SetStorefrontRepo(*repository.StorefrontDataRepository) }); ok {
+		shippingServiceImpl.SetStorefrontRepo(storefrontDataRepo)
+	}
+
+	// Initialize return service for item-level returns (RMAs)
+	returnService := services.NewReturnService(returnRepo, orderRepo)
+	if returnServiceImpl, ok := returnService.(interface{ SetStorefrontRepo(*repository.StorefrontDataRepository) }); ok {
+		returnServiceImpl.SetStorefrontRepo(storefrontDataRepo)
+	}
+	if returnServiceImpl, ok := returnService.(interface{ SetPaymentService(services.PaymentService) }); ok {
+		returnServiceImpl.SetPaymentService(paymentService)
+	}
+	if returnServiceImpl, ok := returnService.(interface{ SetStockService(services.StockService) }); ok {
+		returnServiceImpl.SetStockService(stockService)
+	}
+	if returnServiceImpl, ok := returnService.(interface{ SetS3Service(*services.S3Service) }); ok {
+		returnServiceImpl.SetS3Service(s3Service)
+	}
+
+	// Initialize warranty service; warranties are issued when orders are delivered
+	warrantyService := services.NewWarrantyService(warrantyRepo)
+	if warrantyServiceImpl, ok := warrantyService.(interface{ SetStorefrontRepo(*repository.StorefrontDataRepository) }); ok {
+		warrantyServiceImpl.SetStorefrontRepo(storefrontDataRepo)
+	}
+	if warrantyServiceImpl, ok := warrantyService.(interface{ SetS3Service(*services.S3Service) }); ok {
+		warrantyServiceImpl.SetS3Service(s3Service)
+	}
+	if orderServiceImpl, ok := orderService.(interface{ SetWarrantyService(services.WarrantyService) }); ok {
+		orderServiceImpl.SetWarrantyService(warrantyService)
+	}
+
+	// Initialize certificate service; certificates of authenticity are issued when orders are delivered.
+	// They are signed with a key of their own and are disabled without one.
+	certificateSigningKey := cfg.Security.CertificateSigningKey
+	if certificateSigningKey == "" {
+		fmt.Printf("Warning: CERTIFICATE_SIGNING_KEY is not set, certificates of authenticity are disabled\n")
+	}
+	certificateService := services.NewCertificateService(certificateRepo, orderRepo, []byte(certificateSigningKey))
+	if certificateServiceImpl, ok := certificateService.(interface{ SetProductRepository(repository.ProductRepository) }); ok {
+		certificateServiceImpl.SetProductRepository(productRepo)
+	}
+	if certificateServiceImpl, ok := certificateService.(interface{ SetStorefrontRepo(*repository.StorefrontDataRepository) }); ok {
+		certificateServiceImpl.SetStorefrontRepo(storefrontDataRepo)
+	}
+	if certificateServiceImpl, ok := certificateService.(interface{ SetVerificationURL(string) }); ok {
+		certificateServiceImpl.SetVerificationURL(strings.TrimRight(cfg.App.URL, "/") + "/api/v1/certificates/verify")
+	}
+	if orderServiceImpl, ok := orderService.(interface{ SetCertificateService(services.CertificateService) }); ok && certificateSigningKey != "" {
+		orderServiceImpl.SetCertificateService(certificateService)
+	}
+
+	// Initialize inventory unit service; pieces are assigned to orders at packing time by serial or HUID
+	inventoryUnitService := services.NewInventoryUnitService(inventoryUnitRepo, productRepo, orderRepo)
+	if orderServiceImpl, ok := orderService.(interface{ SetInventoryUnitService(services.InventoryUnitService) }); ok {
+		orderServiceImpl.SetInventoryUnitService(inventoryUnitService)
+	}
+
+	// Initialize variant service; products split into SKUs carry their own stock and price
+	variantService := services.NewVariantService(variantRepo, productRepo)
+	if variantServiceImpl, ok := variantService.(interface{ SetStockService(services.StockService) }); ok {
+		variantServiceImpl.SetStockService(stockService)
+	}
+
+	// Initialize shipment service; carriers report tracking that moves orders along
+	if orderServiceImpl, ok := orderService.(interface{ SetTrackingRepository(repository.PDFRepository) }); ok {
+		orderServiceImpl.SetTrackingRepository(trackingRepo)
+	}
+	carriers := services.NewCarrierRegistry(
+		services.NewManualCarrier(),
+		services.NewHTTPCarrier(cfg.Carrier),
+	)
+	shipmentService := services.NewShipmentService(trackingRepo, orderRepo, orderService, carriers)
+
+	// Initialize PDF service for invoices, receipts and warranty cards
+	pdfService := services.NewPDFService(trackingRepo, invoiceRepo, orderRepo, userRepo, s3Service)
+	if pdfServiceImpl, ok := pdfService.(interface{ SetStorefrontRepo(*repository.StorefrontDataRepository) }); ok {
+		pdfServiceImpl.SetStorefrontRepo(storefrontDataRepo)
+	}
+	if pdfServiceImpl, ok := pdfService.(interface{ SetProductRepository(repository.ProductRepository) }); ok {
+		pdfServiceImpl.SetProductRepository(productRepo)
+	}
+	if pdfServiceImpl, ok := pdfService.(interface{ SetPaymentAttemptRepository(repository.PaymentAttemptRepository) }); ok {
+		pdfServiceImpl.SetPaymentAttemptRepository(paymentAttemptRepo)
+	}
+	if pdfServiceImpl, ok := pdfService.(interface{ SetCertificateRepository(repository.CertificateRepository) }); ok {
+		pdfServiceImpl.SetCertificateRepository(certificateRepo)
+	}
 
     // Initialize handlers
 	authHandler := handlers.NewAuthHandler(authService, userService)
+	authHandler.SetGuestSessionService(guestService)
 	userHandler := handlers.NewUserHandler(userService, authService)
 	productHandler := handlers.NewProductHandler(productService)
 	cartHandler := handlers.NewCartHandler(cartService, authService)
-	orderHandler := handlers.NewOrderHandler(orderService, paymentService, authService)
+	orderHandler := handlers.NewOrderHandler(orderService, authService)
+	paymentHandler := handlers.NewPaymentHandler(paymentService)
+	returnHandler := handlers.NewReturnHandler(returnService)
+	warrantyHandler := handlers.NewWarrantyHandler(warrantyService)
+	certificateHandler := handlers.NewCertificateHandler(certificateService)
+	inventoryUnitHandler := handlers.NewInventoryUnitHandler(inventoryUnitService)
+	metalRateHandler := handlers.NewMetalRateHandler(metalRateService)
+	variantHandler := handlers.NewVariantHandler(variantService)
+	stockHandler := handlers.NewStockHandler(stockService, productService)
+	locationHandler := handlers.NewLocationHandler(locationService, stockService, productService)
+	backInStockHandler := handlers.NewBackInStockHandler(backInStockService)
+	adminNotificationHandler := handlers.NewAdminNotificationHandler(adminNotificationService)
+	shippingHandler := handlers.NewShippingHandler(shippingService, cartService)
+	shipmentHandler := handlers.NewShipmentHandler(shipmentService)
 	guestHandler := handlers.NewGuestHandler(guestService)
 	reviewHandler := handlers.NewReviewHandler(reviewService, authService)
     categoryService := services.NewCategoryService(categoryRepo)
@@ -158,6 +414,7 @@ func main() {
     adminHandler := handlers.NewAdminHandler(userService, productService, orderService)
 	eventHandler := handlers.NewEventHandler(eventRepo)
 	invoiceHandler := handlers.NewInvoiceHandler(invoiceService)
+	pdfHandler := handlers.NewPDFHandler(pdfService)
 	loyaltyHandler := handlers.NewLoyaltyHandler(loyaltyService)
 	homepageHandler := handlers.NewHomepageHandler(homepageService)
 	communityHandler := handlers.NewCommunityHandler(communityService)
@@ -172,9 +429,7 @@ func main() {
 
 	// Initialize OTP handler with Mtalkz messaging service (primary) and legacy SMS service (fallback)
 	otpHandler := handlers.NewOTPHandlerWithMessaging(smsService, messagingService)
-
-	// Initialize Cashfree handler
-	cashfreeHandler := handlers.NewCashfreeHandler(cashfreeService, orderService, authService)
+	otpHandler.SetGuestSessionService(guestService)
 
     // Initialize notification handler if service is available
     // var notificationHandler *handlers.NotificationHandler
@@ -243,6 +498,7 @@ func main() {
 			users.GET("/wishlist", userHandler.GetWishlist)
 			users.POST("/wishlist", userHandler.AddToWishlist)
 			users.DELETE("/wishlist/:productId", userHandler.RemoveFromWishlist)
+			users.GET("/back-in-stock", backInStockHandler.GetMySubscriptions)
 		}
 
         // Product routes
@@ -254,6 +510,29 @@ func main() {
 			products.GET("/featured", productHandler.GetFeaturedProducts)
 			products.GET("/search", productHandler.SearchProducts)
 			products.GET("/:id/reviews", productHandler.GetProductReviews)
+			products.GET("/:id/availability", locationHandler.GetAvailability)
+			products.POST("/:id/back-in-stock", middleware.OptionalAuth(authService), backInStockHandler.Subscribe)
+		}
+
+		// Back-in-stock alerts are cancelled with the token they were subscribed with
+		api.DELETE("/back-in-stock/:token", backInStockHandler.Unsubscribe)
+
+		// Today's per-gram metal rates
+		api.GET("/metal-rates", metalRateHandler.GetCurrentRates)
+
+		// Click-and-collect locations, and the stock, orders and transfers their staff manage
+		api.GET("/locations", locationHandler.GetCollectionPoints)
+		locationStaff := api.Group("/locations/:locationId")
+		locationStaff.Use(middleware.AuthRequired(authService), middleware.LocationStaffRequired())
+		{
+			locationStaff.GET("/stock", locationHandler.GetLocationStock)
+			locationStaff.GET("/stock/movements", locationHandler.GetLocationLedger)
+			locationStaff.POST("/products/:productId/stock/adjustments", locationHandler.AdjustLocationStock)
+			locationStaff.GET("/orders", locationHandler.GetLocationOrders)
+			locationStaff.GET("/transfers", locationHandler.GetLocationTransfers)
+			locationStaff.POST("/transfers", locationHandler.CreateTransfer)
+			locationStaff.PUT("/transfers/:transferId/receive", locationHandler.ReceiveTransfer)
+			locationStaff.PUT("/transfers/:transferId/cancel", locationHandler.CancelTransfer)
 		}
 
         // Storefront routes disabled in build-only profile
@@ -271,6 +550,15 @@ func main() {
 			cart.DELETE("/clear", cartHandler.ClearCart)
 		}
 
+		// Shipping routes
+		shipping := api.Group("/shipping")
+		shipping.Use(middleware.OptionalAuth(authService))
+		{
+			shipping.GET("/quote", shippingHandler.GetQuote)
+			shipping.GET("/serviceability", shippingHandler.CheckServiceability)
+			shipping.POST("/:carrier/webhook", shipmentHandler.HandleWebhook)
+		}
+
 		// Order routes
 		orders := api.Group("/orders")
 		orders.Use(middleware.OptionalAuth(authService))
@@ -281,8 +569,42 @@ func main() {
 			orders.GET("/:id", orderHandler.GetOrder)
 			orders.DELETE("/:id", orderHandler.CancelOrder)
 			orders.POST("/:id/return", orderHandler.ReturnOrder)
-			orders.POST("/:id/refund", orderHandler.RefundOrder)
 			orders.GET("/:id/track", orderHandler.TrackOrder)
+			orders.GET("/:id/returnable", returnHandler.GetReturnEligibility)
+			orders.GET("/:id/receipt", pdfHandler.GetReceiptPDF)
+		}
+
+		// Return routes (item-level return requests)
+		returns := api.Group("/returns")
+		returns.Use(middleware.OptionalAuth(authService))
+		{
+			returns.POST("", returnHandler.CreateReturn)
+			returns.GET("", returnHandler.GetMyReturns)
+			returns.GET("/:id", returnHandler.GetMyReturn)
+			returns.POST("/:id/photos", returnHandler.AddReturnPhotos)
+			returns.POST("/:id/cancel", returnHandler.CancelReturn)
+		}
+
+		// Warranty routes (warranties are issued on delivery)
+		warranties := api.Group("/warranties")
+		warranties.Use(middleware.OptionalAuth(authService))
+		{
+			warranties.GET("", warrantyHandler.GetMyWarranties)
+			warranties.GET("/:id", warrantyHandler.GetMyWarranty)
+			warranties.GET("/:id/card", pdfHandler.GetWarrantyCardPDF)
+			warranties.GET("/:id/claims", warrantyHandler.GetWarrantyClaims)
+			warranties.POST("/:id/claims", warrantyHandler.CreateClaim)
+			warranties.POST("/:id/claims/:claimId/photos", warrantyHandler.AddClaimPhotos)
+		}
+
+		// Certificate routes; verification is public so anyone can scan a certificate's QR code
+		api.GET("/certificates/verify/:certificateNo", certificateHandler.VerifyCertificate)
+		certificates := api.Group("/certificates")
+		certificates.Use(middleware.OptionalAuth(authService))
+		{
+			certificates.GET("", certificateHandler.GetMyCertificates)
+			certificates.GET("/:id", certificateHandler.GetMyCertificate)
+			certificates.GET("/:id/pdf", pdfHandler.GetCertificatePDF)
 		}
 
 		// Invoice routes
@@ -292,6 +614,8 @@ func main() {
 			invoices.POST("/generate", invoiceHandler.GenerateInvoice)
 			invoices.GET("", invoiceHandler.GetUserInvoices)
 			invoices.GET("/:id", invoiceHandler.GetInvoice)
+			invoices.GET("/:id/pdf", pdfHandler.GetInvoicePDF)
+			invoices.GET("/:id/credit-notes", invoiceHandler.GetCreditNotes)
 			invoices.GET("/order/:orderId", invoiceHandler.GetInvoiceByOrderID)
 			invoices.POST("/:id/download", invoiceHandler.MarkInvoiceAsDownloaded)
 		}
@@ -314,25 +638,28 @@ func main() {
 			guest.DELETE("/session/:id", guestHandler.DeleteSession)
 		}
 
-		// Payment routes (Razorpay)
+		// Payment routes
 		payment := api.Group("/payment")
 		payment.Use(middleware.OptionalAuth(authService))
 		{
-			payment.POST("/create-order", orderHandler.CreatePaymentOrder)
-			payment.POST("/verify", orderHandler.VerifyPayment)
-			payment.POST("/webhook", orderHandler.HandleWebhook)
-		}
+			payment.GET("/gateways", paymentHandler.GetGateways)
+			payment.GET("/orders/:orderId/attempts", paymentHandler.GetPaymentAttempts)
 
-		// Cashfree Payment routes
-		cashfree := api.Group("/payment/cashfree")
-		cashfree.Use(middleware.OptionalAuth(authService))
-		{
-			cashfree.POST("/create-order", cashfreeHandler.CreatePaymentOrder)
-			cashfree.POST("/verify", cashfreeHandler.VerifyPayment)
-			cashfree.GET("/status/:orderId", cashfreeHandler.GetOrderStatus)
-			cashfree.POST("/webhook", cashfreeHandler.HandleWebhook)
-			cashfree.GET("/status", cashfreeHandler.GetPaymentServiceStatus)
-			cashfree.POST("/create-link", cashfreeHandler.CreatePaymentLink)
+			// Original Razorpay routes
+			payment.POST("/create-order", paymentHandler.CreatePayment)
+			payment.POST("/verify", paymentHandler.VerifyPayment)
+			payment.POST("/webhook", paymentHandler.HandleWebhook)
+
+			// Gateway routes, e.g. /payment/cashfree/create-order
+			gateway := payment.Group("/:gateway")
+			{
+				gateway.POST("/create-order", paymentHandler.CreatePayment)
+				gateway.POST("/create-link", paymentHandler.CreatePaymentLink)
+				gateway.POST("/verify", paymentHandler.VerifyPayment)
+				gateway.POST("/webhook", paymentHandler.HandleWebhook)
+				gateway.GET("/status", paymentHandler.GetGatewayStatus)
+				gateway.GET("/status/:orderId", paymentHandler.GetPaymentStatus)
+			}
 		}
 
         // Loyalty routes
@@ -401,7 +728,7 @@ func main() {
 		otp := api.Group("/otp")
 		{
 			otp.POST("/send", otpHandler.SendOTP)
-			otp.POST("/verify", otpHandler.VerifyOTP)
+			otp.POST("/verify", middleware.OptionalAuth(authService), otpHandler.VerifyOTP)
 			otp.POST("/resend", otpHandler.ResendOTP)
 			otp.GET("/status", otpHandler.GetSMSStatus)
 		}
@@ -513,8 +840,45 @@ func main() {
 			admin.PUT("/products/:id", productHandler.UpdateProduct)
 			admin.DELETE("/products/:id", productHandler.DeleteProduct)
 			admin.PUT("/products/:id/stock", productHandler.UpdateProductStock)
+			admin.POST("/products/:id/stock/adjustments", stockHandler.AdjustStock)
 			admin.POST("/products/bulk-upload", adminHandler.BulkUploadProducts)
 
+			// Variants and SKUs
+			admin.POST("/products/:id/variants", variantHandler.CreateVariant)
+			admin.POST("/products/:id/variants/generate", variantHandler.GenerateVariants)
+			admin.PUT("/products/:id/variants/:variantId", variantHandler.UpdateVariant)
+			admin.DELETE("/products/:id/variants/:variantId", variantHandler.DeleteVariant)
+			admin.GET("/skus/:code", variantHandler.LookupCode)
+
+			// Inventory units and hallmarks
+			admin.GET("/products/:id/units", inventoryUnitHandler.GetUnits)
+			admin.POST("/products/:id/units", inventoryUnitHandler.CreateUnits)
+			admin.PUT("/products/:id/units/:unitId", inventoryUnitHandler.UpdateUnit)
+			admin.POST("/orders/:id/units", inventoryUnitHandler.AssignOrderUnits)
+			admin.GET("/huid/:huid", inventoryUnitHandler.LookupHUID)
+
+			// Stock ledger and low-stock alerts
+			admin.GET("/stock/movements", stockHandler.GetLedger)
+			admin.GET("/stock/low-stock", stockHandler.GetLowStockReport)
+			admin.POST("/stock/low-stock/alerts", stockHandler.RunLowStockAlerts)
+			admin.POST("/stock/import", stockHandler.ImportStock)
+			admin.GET("/back-in-stock/subscriptions", backInStockHandler.GetSubscriptions)
+			admin.GET("/back-in-stock/stats", backInStockHandler.GetStats)
+			admin.GET("/stock/transfers", locationHandler.GetAllTransfers)
+
+			// Stock locations and their staff
+			admin.GET("/locations", locationHandler.GetLocations)
+			admin.POST("/locations", locationHandler.CreateLocation)
+			admin.PUT("/locations/:id", locationHandler.UpdateLocation)
+			admin.PUT("/users/:id/locations", locationHandler.AssignStaff)
+			admin.GET("/alerts", adminNotificationHandler.GetNotifications)
+			admin.PUT("/alerts/:id/read", adminNotificationHandler.MarkRead)
+
+			// Metal rates
+			admin.POST("/metal-rates", metalRateHandler.SetRates)
+			admin.POST("/metal-rates/import", metalRateHandler.ImportRates)
+			admin.GET("/metal-rates/history", metalRateHandler.GetHistory)
+
 			// Category management
 			admin.GET("/categories", categoryHandler.GetAllCategories)
 			admin.POST("/categories", categoryHandler.CreateCategory)
@@ -525,8 +889,31 @@ func main() {
 			admin.GET("/orders", adminHandler.GetAllOrders)
 			admin.GET("/orders/:id", adminHandler.GetOrderDetails)
 			admin.PUT("/orders/:id/status", adminHandler.UpdateOrderStatus)
+			admin.POST("/orders/:id/refund", orderHandler.RefundOrder)
 			admin.GET("/orders/analytics", adminHandler.GetOrderAnalytics)
 
+			// Shipments
+			admin.GET("/carriers", shipmentHandler.GetCarriers)
+			admin.POST("/orders/:id/shipment", shipmentHandler.CreateShipment)
+			admin.GET("/orders/:id/shipment", shipmentHandler.GetShipment)
+			admin.GET("/orders/:id/shipment/label", shipmentHandler.GetLabel)
+			admin.POST("/orders/:id/shipment/cancel", shipmentHandler.CancelShipment)
+			admin.POST("/orders/:id/shipment/refresh", shipmentHandler.RefreshTracking)
+			admin.POST("/orders/:id/shipment/events", shipmentHandler.AddTrackingEvent)
+
+			// Certificates of authenticity
+			admin.GET("/orders/:id/certificates", certificateHandler.AdminGetOrderCertificates)
+			admin.POST("/orders/:id/certificates", certificateHandler.AdminIssueOrderCertificates)
+
+			// Payment webhooks
+			admin.GET("/payments/webhooks", paymentHandler.ListWebhookEvents)
+			admin.GET("/payments/webhooks/:id", paymentHandler.GetWebhookEvent)
+			admin.POST("/payments/webhooks/:id/replay", paymentHandler.ReplayWebhookEvent)
+			admin.POST("/payments/reconciliation", paymentHandler.RunReconciliation)
+			admin.GET("/payments/reconciliation", paymentHandler.ListReconciliationReports)
+			admin.GET("/payments/reconciliation/:id", paymentHandler.GetReconciliationReport)
+			admin.GET("/payments/reconciliation/:id/download", paymentHandler.DownloadReconciliationReport)
+
 			// User management
 			admin.GET("/users", userHandler.GetAllUsers)
 			admin.GET("/users/search", userHandler.SearchUsers)
@@ -596,7 +983,11 @@ func main() {
 			// Invoice management
 			admin.GET("/invoices", invoiceHandler.ListAllInvoices)
 			admin.GET("/invoices/export/csv", invoiceHandler.ExportInvoicesCSV)
-			admin.DELETE("/invoices/:id", invoiceHandler.DeleteInvoice)
+			admin.GET("/invoices/e-invoice", invoiceHandler.GetEInvoiceBatch)
+			admin.GET("/invoices/:id/e-invoice", invoiceHandler.GetEInvoice)
+			admin.GET("/invoices/:id/pdf", pdfHandler.GetInvoicePDF)
+			admin.POST("/invoices/:id/void", invoiceHandler.VoidInvoice)
+			admin.GET("/credit-notes", invoiceHandler.ListCreditNotes)
 
 			// Loyalty management
 			admin.GET("/loyalty/config", loyaltyHandler.GetLoyaltyConfig)
@@ -663,6 +1054,28 @@ func main() {
 				adminCustomOrders.POST("/:id/cancel", customOrderHandler.AdminCancelOrder)
 			}
 
+			// Return requests management (admin)
+			adminReturns := admin.Group("/returns")
+			{
+				adminReturns.GET("", returnHandler.AdminListReturns)
+				adminReturns.GET("/:id", returnHandler.AdminGetReturn)
+				adminReturns.POST("/:id/approve", returnHandler.AdminApproveReturn)
+				adminReturns.POST("/:id/reject", returnHandler.AdminRejectReturn)
+				adminReturns.POST("/:id/pickup", returnHandler.AdminSchedulePickup)
+				adminReturns.POST("/:id/receive", returnHandler.AdminMarkReturnReceived)
+				adminReturns.POST("/:id/quality-check", returnHandler.AdminRecordQualityCheck)
+			}
+
+			// Warranty claims queue (admin)
+			adminWarrantyClaims := admin.Group("/warranty-claims")
+			{
+				adminWarrantyClaims.GET("", warrantyHandler.AdminListClaims)
+				adminWarrantyClaims.GET("/:id", warrantyHandler.AdminGetClaim)
+				adminWarrantyClaims.POST("/:id/approve", warrantyHandler.AdminApproveClaim)
+				adminWarrantyClaims.POST("/:id/reject", warrantyHandler.AdminRejectClaim)
+				adminWarrantyClaims.POST("/:id/complete", warrantyHandler.AdminCompleteClaim)
+			}
+
 			// Placeholder endpoints for future implementation
 			admin.GET("/config/business", func(c *gin.Context) {
 				c.JSON(http.StatusOK, gin.H{"message": "Business config not implemented"})
@@ -691,6 +1104,11 @@ func main() {
 	if cartService != nil {
 		go startBackgroundJobs(cartService)
 	}
+	go startStockReservationJob(orderService)
+	go startRefundRetryJob(paymentService)
+	go startPaymentReconciliationJob(paymentService)
+	go startShipmentTrackingJob(shipmentService)
+	go startLowStockAlertJob(stockService)
 
 	// Wait for interrupt signal to gracefully shutdown the server
 	quit := make(chan os.Signal, 1)
@@ -730,3 +1148,73 @@ func startBackgroundJobs(cartService services.CartService) {
 		}
 	}
 }
+
+// startStockReservationJob periodically releases stock held by unpaid orders
+func startStockReservationJob(orderService services.OrderService) {
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := orderService.ReleaseExpiredReservations(); err != nil {
+			log.Printf("Error releasing expired stock reservations: %v", err)
+		}
+	}
+}
+
+// startRefundRetryJob periodically sends failed refunds to their gateway again
+func startRefundRetryJob(paymentService services.PaymentService) {
+	ticker := time.NewTicker(15 * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := paymentService.RetryFailedRefunds(); err != nil {
+			log.Printf("Error retrying failed refunds: %v", err)
+		}
+	}
+}
+
+// startPaymentReconciliationJob settles orders whose payment webhook never arrived,
+// checking the gateways once a day
+func startPaymentReconciliationJob(paymentService services.PaymentService) {
+	ticker := time.NewTicker(24 * time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		report, err := paymentService.ReconcilePayments()
+		if err != nil {
+			log.Printf("Error reconciling payments: %v", err)
+			continue
+		}
+		log.Printf("Payment reconciliation checked %d orders: %v", report.OrdersChecked, report.Counts)
+	}
+}
+
+// startShipmentTrackingJob polls carriers for shipments whose webhooks may have been missed
+func startShipmentTrackingJob(shipmentService services.ShipmentService) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := shipmentService.PollActiveShipments(); err != nil {
+			log.Printf("Error polling shipment tracking: %v", err)
+		}
+	}
+}
+
+// startLowStockAlertJob raises admin notifications once a day for products
+// that have fallen to their reorder level
+func startLowStockAlertJob(stockService services.StockService) {
+	ticker := time.NewTicker(24 * time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		raised, err := stockService.RaiseLowStockAlerts(context.Background())
+		if err != nil {
+			log.Printf("Error raising low stock alerts: %v", err)
+			continue
+		}
+		if raised > 0 {
+			log.Printf("Raised %d low stock alerts", raised)
+		}
+	}
+}
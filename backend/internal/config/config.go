@@ -16,6 +16,7 @@ type Config struct {
 	JWT      JWTConfig
 	Razorpay RazorpayConfig
 	Cashfree CashfreeConfig
+	Carrier  CarrierConfig
 	AWS      AWSConfig
 	Email    EmailConfig
 	App      AppConfig
@@ -46,6 +47,7 @@ type RazorpayConfig struct {
 	KeyID     string
 	KeySecret string
 	WebhookSecret string
+	BaseURL   string
 }
 
 type CashfreeConfig struct {
@@ -55,6 +57,15 @@ type CashfreeConfig struct {
 	Environment   string // SANDBOX or PRODUCTION
 }
 
+// CarrierConfig configures the courier API used to book and track shipments
+type CarrierConfig struct {
+	Code          string // Carrier code used in routes, e.g. "courier"
+	Name          string
+	APIURL        string
+	APIKey        string
+	WebhookSecret string
+}
+
 type AWSConfig struct {
 	AccessKeyID     string
 	SecretAccessKey string
@@ -81,6 +92,7 @@ type SecurityConfig struct {
 	BcryptCost           int
 	RateLimitPerMinute   int
 	CORSAllowedOrigins   []string
+	CertificateSigningKey string // Signs certificates of authenticity; changing it invalidates issued certificates
 }
 
 type FileConfig struct {
@@ -143,6 +155,7 @@ func Load() *Config {
 			KeyID:        getEnv("RAZORPAY_KEY_ID", ""),
 			KeySecret:    getEnv("RAZORPAY_KEY_SECRET", ""),
 			WebhookSecret: getEnv("RAZORPAY_WEBHOOK_SECRET", ""),
+			BaseURL:       getEnv("RAZORPAY_BASE_URL", "https://api.razorpay.com/v1"),
 		},
 		Cashfree: CashfreeConfig{
 			AppID:         getEnv("CASHFREE_APP_ID", ""),
@@ -150,6 +163,13 @@ func Load() *Config {
 			WebhookSecret: getEnv("CASHFREE_WEBHOOK_SECRET", ""),
 			Environment:   getEnv("CASHFREE_ENVIRONMENT", "SANDBOX"),
 		},
+		Carrier: CarrierConfig{
+			Code:          getEnv("CARRIER_CODE", "courier"),
+			Name:          getEnv("CARRIER_NAME", "Courier"),
+			APIURL:        getEnv("CARRIER_API_URL", ""),
+			APIKey:        getEnv("CARRIER_API_KEY", ""),
+			WebhookSecret: getEnv("CARRIER_WEBHOOK_SECRET", ""),
+		},
 		AWS: AWSConfig{
 			AccessKeyID:     getEnv("AWS_ACCESS_KEY_ID", ""),
 			SecretAccessKey: getEnv("AWS_SECRET_ACCESS_KEY", ""),
@@ -173,6 +193,7 @@ func Load() *Config {
 			BcryptCost:         getEnvAsInt("BCRYPT_COST", 12),
 			RateLimitPerMinute: getEnvAsInt("RATE_LIMIT_PER_MINUTE", 10000), // Increased to 10000 requests per minute
 			CORSAllowedOrigins: strings.Split(getEnv("CORS_ALLOWED_ORIGINS", "http://localhost:3000"), ","),
+			CertificateSigningKey: getEnv("CERTIFICATE_SIGNING_KEY", ""),
 		},
 		File: FileConfig{
 			MaxFileSize:      getEnvAsInt64("MAX_FILE_SIZE", 10485760), // 10MB
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/csv"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -9,6 +10,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"thyne-jewels-backend/internal/middleware"
 	"thyne-jewels-backend/internal/models"
 	"thyne-jewels-backend/internal/services"
 )
@@ -184,8 +186,18 @@ func (h *AdminHandler) UpdateOrderStatus(c *gin.Context) {
 		return
 	}
 
-	err := h.orderService.UpdateOrderStatus(orderID, req.Status, req.TrackingNumber)
+	userID, _ := middleware.GetUserIDFromContext(c)
+	actor := models.OrderActor{Type: models.OrderActorAdmin, ID: userID}
+	err := h.orderService.UpdateOrderStatus(orderID, req.Status, req.TrackingNumber, actor, req.Reason)
 	if err != nil {
+		if errors.Is(err, models.ErrInvalidOrderStatusTransition) {
+			c.JSON(http.StatusConflict, gin.H{
+				"success": false,
+				"error":   err.Error(),
+				"code":    "INVALID_STATUS_TRANSITION",
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
 			"error":   "Failed to update order status",
@@ -409,7 +421,7 @@ func (h *AdminHandler) GetAuditLogs(c *gin.Context) {
 
 // BulkUploadProducts handles CSV bulk product upload
 // @Summary Bulk upload products via CSV
-// @Description Upload multiple products at once using CSV file (Admin only)
+// @Description Upload multiple products at once using CSV file (Admin only). Optional sku, barcode, variantMetal, variantSize, variantPrice, variantWeight and variantStock columns add a variant per row; rows with the same name become one product sold by variant.
 // @Tags Admin
 // @Accept multipart/form-data
 // @Produce json
@@ -470,9 +482,12 @@ func (h *AdminHandler) BulkUploadProducts(c *gin.Context) {
 		"category", "subcategory", "metalType", "stoneType", "weight", 
 		"size", "stockQuantity", "tags", "isAvailable", "isFeatured",
 	}
+	variantHeaders := []string{
+		"sku", "barcode", "variantMetal", "variantSize", "variantPrice", "variantWeight", "variantStock",
+	}
 	
 	headers := records[0]
-	if !h.validateCSVHeaders(headers, expectedHeaders) {
+	if !h.validateCSVHeaders(headers, expectedHeaders, variantHeaders) {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
 			"error":   fmt.Sprintf("Invalid CSV headers. Expected: %s", strings.Join(expectedHeaders, ", ")),
@@ -484,6 +499,7 @@ func (h *AdminHandler) BulkUploadProducts(c *gin.Context) {
 	// Process products
 	var products []models.CreateProductRequest
 	var errors []string
+	variantProducts := make(map[string]int) // Product name -> index of the product its variant rows belong to
 	
 	for i, record := range records[1:] {
 		product, err := h.parseProductFromCSVRecord(record, headers)
@@ -491,7 +507,24 @@ func (h *AdminHandler) BulkUploadProducts(c *gin.Context) {
 			errors = append(errors, fmt.Sprintf("Row %d: %s", i+2, err.Error()))
 			continue
 		}
-		products = append(products, *product)
+		variant, err := h.parseVariantFromCSVRecord(record, headers)
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("Row %d: %s", i+2, err.Error()))
+			continue
+		}
+		if variant == nil {
+			products = append(products, *product)
+			continue
+		}
+
+		// Later rows of a product only add variants; its details come from the first row
+		index, ok := variantProducts[strings.ToLower(product.Name)]
+		if !ok {
+			index = len(products)
+			variantProducts[strings.ToLower(product.Name)] = index
+			products = append(products, *product)
+		}
+		addCSVVariant(&products[index], variant)
 	}
 
 	// If there are validation errors, return them
@@ -531,15 +564,21 @@ func (h *AdminHandler) BulkUploadProducts(c *gin.Context) {
 	})
 }
 
-// validateCSVHeaders checks if CSV headers match expected format
-func (h *AdminHandler) validateCSVHeaders(headers []string, expected []string) bool {
-	if len(headers) != len(expected) {
-		return false
+// validateCSVHeaders checks that every expected header is present and that
+// the others are among the optional ones
+func (h *AdminHandler) validateCSVHeaders(headers []string, expected []string, optional []string) bool {
+	allowed := make(map[string]bool)
+	for _, header := range append(append([]string{}, expected...), optional...) {
+		allowed[strings.ToLower(header)] = true
 	}
 	
 	headerMap := make(map[string]bool)
 	for _, header := range headers {
-		headerMap[strings.ToLower(strings.TrimSpace(header))] = true
+		name := strings.ToLower(strings.TrimSpace(header))
+		if !allowed[name] || headerMap[name] {
+			return false
+		}
+		headerMap[name] = true
 	}
 	
 	for _, expectedHeader := range expected {
@@ -551,6 +590,81 @@ func (h *AdminHandler) validateCSVHeaders(headers []string, expected []string) b
 	return true
 }
 
+// parseVariantFromCSVRecord parses the variant columns of a CSV record. It
+// returns nil when the row has no SKU.
+func (h *AdminHandler) parseVariantFromCSVRecord(record []string, headers []string) (*models.CreateVariantRequest, error) {
+	headerIndex := make(map[string]int)
+	for i, header := range headers {
+		headerIndex[strings.ToLower(strings.TrimSpace(header))] = i
+	}
+	getField := func(fieldName string) string {
+		if idx, exists := headerIndex[strings.ToLower(fieldName)]; exists && idx < len(record) {
+			return strings.TrimSpace(record[idx])
+		}
+		return ""
+	}
+
+	sku := getField("sku")
+	if sku == "" {
+		return nil, nil
+	}
+
+	variant := &models.CreateVariantRequest{
+		SKU:     sku,
+		Barcode: getField("barcode"),
+		Metal:   getField("variantMetal"),
+		Size:    getField("variantSize"),
+	}
+	if variant.Metal == "" && variant.Size == "" {
+		return nil, fmt.Errorf("variant %s needs a variantMetal or variantSize", sku)
+	}
+
+	if priceStr := getField("variantPrice"); priceStr != "" {
+		price, err := strconv.ParseFloat(priceStr, 64)
+		if err != nil || price <= 0 {
+			return nil, fmt.Errorf("invalid variantPrice: %s", priceStr)
+		}
+		variant.Price = &price
+	}
+	if weightStr := getField("variantWeight"); weightStr != "" {
+		weight, err := strconv.ParseFloat(weightStr, 64)
+		if err != nil || weight <= 0 {
+			return nil, fmt.Errorf("invalid variantWeight: %s", weightStr)
+		}
+		variant.Weight = &weight
+	}
+	if stockStr := getField("variantStock"); stockStr != "" {
+		stock, err := strconv.Atoi(stockStr)
+		if err != nil || stock < 0 {
+			return nil, fmt.Errorf("invalid variantStock: %s", stockStr)
+		}
+		variant.StockQuantity = stock
+	}
+
+	return variant, nil
+}
+
+// addCSVVariant adds a variant row to its product, offering the variant's
+// metal and size as options of the product
+func addCSVVariant(product *models.CreateProductRequest, variant *models.CreateVariantRequest) {
+	if variant.Metal != "" && !containsString(product.AvailableMetals, variant.Metal) {
+		product.AvailableMetals = append(product.AvailableMetals, variant.Metal)
+	}
+	if variant.Size != "" && !containsString(product.AvailableSizes, variant.Size) {
+		product.AvailableSizes = append(product.AvailableSizes, variant.Size)
+	}
+	product.Variants = append(product.Variants, *variant)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
 // parseProductFromCSVRecord parses a CSV record into a CreateProductRequest
 func (h *AdminHandler) parseProductFromCSVRecord(record []string, headers []string) (*models.CreateProductRequest, error) {
 	if len(record) != len(headers) {
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"net/http"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminNotificationHandler handles the admin panel's notification inbox
+type AdminNotificationHandler struct {
+	adminNotificationService services.AdminNotificationService
+}
+
+// NewAdminNotificationHandler creates a new admin notification handler
+func NewAdminNotificationHandler(adminNotificationService services.AdminNotificationService) *AdminNotificationHandler {
+	return &AdminNotificationHandler{adminNotificationService: adminNotificationService}
+}
+
+// GetNotifications lists admin notifications
+// @Summary Get admin notifications (Admin)
+// @Description List notifications raised for admins, such as low-stock alerts, newest first
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param unread query bool false "Only unread notifications"
+// @Param page query int false "Page number"
+// @Param limit query int false "Items per page"
+// @Success 200 {object} map[string]interface{} "Notifications with the unread count"
+// @Router /admin/alerts [get]
+func (h *AdminNotificationHandler) GetNotifications(c *gin.Context) {
+	page, limit := returnPagination(c)
+	filter := models.AdminNotificationFilter{
+		UnreadOnly: c.Query("unread") == "true",
+		Page:       page,
+		Limit:      limit,
+	}
+
+	notifications, total, unread, err := h.adminNotificationService.GetNotifications(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to get notifications",
+			"code":    "FETCH_FAILED",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"notifications": notifications,
+			"unread":        unread,
+			"pagination": gin.H{
+				"page":       page,
+				"limit":      limit,
+				"total":      total,
+				"totalPages": (total + int64(limit) - 1) / int64(limit),
+			},
+		},
+	})
+}
+
+// MarkRead marks an admin notification as read
+// @Summary Mark admin notification read (Admin)
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Notification ID"
+// @Success 200 {object} map[string]interface{} "Notification marked read"
+// @Failure 404 {object} map[string]interface{} "Notification not found"
+// @Router /admin/alerts/{id}/read [put]
+func (h *AdminNotificationHandler) MarkRead(c *gin.Context) {
+	if err := h.adminNotificationService.MarkRead(c.Request.Context(), c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   err.Error(),
+			"code":    "NOT_FOUND",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Notification marked read",
+	})
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"log"
 	"net/http"
 
 	"thyne-jewels-backend/internal/models"
@@ -10,8 +11,9 @@ import (
 )
 
 type AuthHandler struct {
-	authService services.AuthService
-	userService services.UserService
+	authService  services.AuthService
+	userService  services.UserService
+	guestService services.GuestSessionService
 }
 
 func NewAuthHandler(authService services.AuthService, userService services.UserService) *AuthHandler {
@@ -21,12 +23,36 @@ func NewAuthHandler(authService services.AuthService, userService services.UserS
 	}
 }
 
+// SetGuestSessionService enables merging a guest session into the account on login and registration
+func (h *AuthHandler) SetGuestSessionService(guestService services.GuestSessionService) {
+	h.guestService = guestService
+}
+
+// mergeGuestSession folds the guest session from the request body or
+// X-Guest-Session-ID header into the user. Merge failures never fail the login.
+func (h *AuthHandler) mergeGuestSession(c *gin.Context, sessionID string, response *models.LoginResponse) {
+	if sessionID == "" {
+		sessionID = c.GetHeader("X-Guest-Session-ID")
+	}
+	if sessionID == "" || h.guestService == nil || response == nil || response.User == nil {
+		return
+	}
+
+	result, err := h.guestService.MergeIntoUser(sessionID, response.User.ID)
+	if err != nil {
+		log.Printf("Warning: failed to merge guest session %s into user %s: %v", sessionID, response.User.ID.Hex(), err)
+		return
+	}
+	response.GuestMerge = result
+}
+
 // Register handles user registration
 // @Summary Register a new user
-// @Description Register a new user with email, name, phone, and password
+// @Description Register a new user with email, name, phone, and password. An optional guestSessionId (or X-Guest-Session-ID header) merges the guest cart, recently viewed items and orders into the new account.
 // @Tags Authentication
 // @Accept json
 // @Produce json
+// @Param X-Guest-Session-ID header string false "Guest session to merge into the account"
 // @Param request body models.CreateUserRequest true "User registration data"
 // @Success 201 {object} map[string]interface{} "User registered successfully"
 // @Failure 400 {object} map[string]interface{} "Invalid request data"
@@ -74,6 +100,8 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
+	h.mergeGuestSession(c, req.GuestSessionID, response)
+
 	c.JSON(http.StatusCreated, gin.H{
 		"success": true,
 		"data":    response,
@@ -83,10 +111,11 @@ func (h *AuthHandler) Register(c *gin.Context) {
 
 // Login handles user login
 // @Summary Login user
-// @Description Login user with email and password
+// @Description Login user with email and password. An optional guestSessionId (or X-Guest-Session-ID header) merges the guest cart, recently viewed items and orders into the account.
 // @Tags Authentication
 // @Accept json
 // @Produce json
+// @Param X-Guest-Session-ID header string false "Guest session to merge into the account"
 // @Param request body models.LoginRequest true "Login credentials"
 // @Success 200 {object} map[string]interface{} "Login successful"
 // @Failure 400 {object} map[string]interface{} "Invalid request data"
@@ -124,6 +153,8 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
+	h.mergeGuestSession(c, req.GuestSessionID, response)
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"data":    response,
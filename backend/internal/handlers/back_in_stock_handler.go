@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"thyne-jewels-backend/internal/middleware"
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// BackInStockHandler handles back-in-stock subscriptions and their conversion reporting
+type BackInStockHandler struct {
+	backInStockService services.BackInStockService
+}
+
+// NewBackInStockHandler creates a new back-in-stock handler
+func NewBackInStockHandler(backInStockService services.BackInStockService) *BackInStockHandler {
+	return &BackInStockHandler{backInStockService: backInStockService}
+}
+
+// Subscribe asks to be alerted when an out-of-stock product is back
+// @Summary Subscribe to back-in-stock alerts
+// @Description Subscribe to an out-of-stock product, or to one of its variants. Signed-in users are alerted by push unless they choose sms, whatsapp or email; guests give a phone number for SMS or WhatsApp, or an email address. Subscribing again returns the existing subscription. The token in the response unsubscribes.
+// @Tags Products
+// @Accept json
+// @Produce json
+// @Param id path string true "Product ID"
+// @Param X-Guest-Session-ID header string false "Guest session"
+// @Param request body models.BackInStockRequest true "Subscription"
+// @Success 201 {object} map[string]interface{} "Subscription"
+// @Failure 400 {object} map[string]interface{} "In stock, made to order, or missing contact details"
+// @Failure 404 {object} map[string]interface{} "Product not found"
+// @Router /products/{id}/back-in-stock [post]
+func (h *BackInStockHandler) Subscribe(c *gin.Context) {
+	var req models.BackInStockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request data: " + err.Error(),
+			"code":    "INVALID_INPUT",
+		})
+		return
+	}
+	if req.GuestSessionID == "" {
+		req.GuestSessionID = c.GetHeader("X-Guest-Session-ID")
+	}
+
+	var userID *primitive.ObjectID
+	if value, ok := middleware.GetUserIDFromContext(c); ok {
+		if id, err := primitive.ObjectIDFromHex(value); err == nil {
+			userID = &id
+		}
+	}
+
+	subscription, err := h.backInStockService.Subscribe(c.Request.Context(), c.Param("id"), &req, userID)
+	if err != nil {
+		respondBackInStockError(c, err, "SUBSCRIBE_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    subscription,
+	})
+}
+
+// Unsubscribe cancels a subscription by the token it was made with
+// @Summary Unsubscribe from back-in-stock alerts
+// @Tags Products
+// @Produce json
+// @Param token path string true "Unsubscribe token"
+// @Success 200 {object} map[string]interface{} "Unsubscribed"
+// @Failure 400 {object} map[string]interface{} "Already notified or cancelled"
+// @Failure 404 {object} map[string]interface{} "Subscription not found"
+// @Router /back-in-stock/{token} [delete]
+func (h *BackInStockHandler) Unsubscribe(c *gin.Context) {
+	if err := h.backInStockService.Unsubscribe(c.Request.Context(), c.Param("token")); err != nil {
+		respondBackInStockError(c, err, "UNSUBSCRIBE_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Unsubscribed from back-in-stock alerts",
+	})
+}
+
+// GetMySubscriptions lists the signed-in user's subscriptions
+// @Summary Get my back-in-stock subscriptions
+// @Tags Users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "Subscriptions, newest first, with their unsubscribe tokens"
+// @Router /users/back-in-stock [get]
+func (h *BackInStockHandler) GetMySubscriptions(c *gin.Context) {
+	value, ok := middleware.GetUserIDFromContext(c)
+	userID, err := primitive.ObjectIDFromHex(value)
+	if !ok || err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"error":   "User not authenticated",
+			"code":    "UNAUTHORIZED",
+		})
+		return
+	}
+
+	subscriptions, err := h.backInStockService.GetUserSubscriptions(c.Request.Context(), userID)
+	if err != nil {
+		respondBackInStockError(c, err, "FETCH_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    subscriptions,
+	})
+}
+
+// GetSubscriptions lists back-in-stock subscriptions
+// @Summary Get back-in-stock subscriptions (Admin)
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param productId query string false "Product ID"
+// @Param status query string false "active, notified or cancelled"
+// @Param channel query string false "push, sms, whatsapp or email"
+// @Param page query int false "Page number"
+// @Param limit query int false "Items per page"
+// @Success 200 {object} map[string]interface{} "Subscriptions, newest first"
+// @Router /admin/back-in-stock/subscriptions [get]
+func (h *BackInStockHandler) GetSubscriptions(c *gin.Context) {
+	page, limit := returnPagination(c)
+	filter := models.BackInStockFilter{
+		Status:  models.BackInStockStatus(c.Query("status")),
+		Channel: models.BackInStockChannel(c.Query("channel")),
+		Page:    page,
+		Limit:   limit,
+	}
+	if value := c.Query("productId"); value != "" {
+		id, err := primitive.ObjectIDFromHex(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid product ID",
+				"code":    "INVALID_INPUT",
+			})
+			return
+		}
+		filter.ProductID = &id
+	}
+
+	subscriptions, total, err := h.backInStockService.GetSubscriptions(c.Request.Context(), filter)
+	if err != nil {
+		respondBackInStockError(c, err, "FETCH_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"subscriptions": subscriptions,
+			"pagination":    paginationData(page, limit, total),
+		},
+	})
+}
+
+// GetStats reports how back-in-stock alerts convert into purchases
+// @Summary Get back-in-stock conversion stats (Admin)
+// @Description Count subscriptions, alerts sent and the purchases made within 30 days of an alert, in total and per channel. The conversion rate is the percentage of alerts that led to a purchase.
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "Conversion stats"
+// @Router /admin/back-in-stock/stats [get]
+func (h *BackInStockHandler) GetStats(c *gin.Context) {
+	stats, err := h.backInStockService.GetStats(c.Request.Context())
+	if err != nil {
+		respondBackInStockError(c, err, "FETCH_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    stats,
+	})
+}
+
+func respondBackInStockError(c *gin.Context, err error, code string) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrInventoryNotFound):
+		status, code = http.StatusNotFound, "NOT_FOUND"
+	case errors.Is(err, services.ErrInvalidBackInStock):
+		status, code = http.StatusBadRequest, "INVALID_BACK_IN_STOCK"
+	}
+
+	c.JSON(status, gin.H{
+		"success": false,
+		"error":   err.Error(),
+		"code":    code,
+	})
+}
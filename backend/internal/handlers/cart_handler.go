@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"thyne-jewels-backend/internal/middleware"
+	"thyne-jewels-backend/internal/models"
 	"thyne-jewels-backend/internal/services"
 
 	"github.com/gin-gonic/gin"
@@ -53,7 +54,7 @@ func (h *CartHandler) GetCart(c *gin.Context) {
 
 // AddToCart adds an item to the cart
 // @Summary Add item to cart
-// @Description Add a product to the shopping cart
+// @Description Add a product to the shopping cart. Products sold by variant need a variantId, or a customization that picks one variant's options.
 // @Tags Cart
 // @Accept json
 // @Produce json
@@ -68,8 +69,10 @@ func (h *CartHandler) AddToCart(c *gin.Context) {
 	guestSessionID := c.GetHeader("X-Guest-Session-ID")
 
 	var req struct {
-		ProductID string `json:"productId" binding:"required"`
-		Quantity  int    `json:"quantity" binding:"required,min=1"`
+		ProductID     string                       `json:"productId" binding:"required"`
+		VariantID     string                       `json:"variantId"`
+		Quantity      int                          `json:"quantity" binding:"required,min=1"`
+		Customization *models.ProductCustomization `json:"customization"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -81,7 +84,7 @@ func (h *CartHandler) AddToCart(c *gin.Context) {
 		return
 	}
 
-	err := h.cartService.AddToCart(userID, guestSessionID, req.ProductID, req.Quantity)
+	cart, err := h.cartService.AddToCart(userID, guestSessionID, req.ProductID, req.VariantID, req.Quantity, req.Customization)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
@@ -93,13 +96,14 @@ func (h *CartHandler) AddToCart(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
+		"data":    cart,
 		"message": "Item added to cart successfully",
 	})
 }
 
 // UpdateCartItem updates cart item quantity
 // @Summary Update cart item
-// @Description Update quantity of an item in the cart
+// @Description Update quantity of a cart line by itemId (or productId for uncustomized lines); quantity 0 removes it
 // @Tags Cart
 // @Accept json
 // @Produce json
@@ -114,11 +118,12 @@ func (h *CartHandler) UpdateCartItem(c *gin.Context) {
 	guestSessionID := c.GetHeader("X-Guest-Session-ID")
 
 	var req struct {
-		ProductID string `json:"productId" binding:"required"`
-		Quantity  int    `json:"quantity" binding:"required,min=0"`
+		ItemID    string `json:"itemId"`
+		ProductID string `json:"productId"`
+		Quantity  int    `json:"quantity" binding:"min=0"`
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if err := c.ShouldBindJSON(&req); err != nil || (req.ItemID == "" && req.ProductID == "") {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
 			"error":   "Invalid request data",
@@ -127,7 +132,12 @@ func (h *CartHandler) UpdateCartItem(c *gin.Context) {
 		return
 	}
 
-	err := h.cartService.UpdateCartItem(userID, guestSessionID, req.ProductID, req.Quantity)
+	itemID := req.ItemID
+	if itemID == "" {
+		itemID = req.ProductID
+	}
+
+	cart, err := h.cartService.UpdateCartItem(userID, guestSessionID, itemID, req.Quantity)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
@@ -139,18 +149,19 @@ func (h *CartHandler) UpdateCartItem(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
+		"data":    cart,
 		"message": "Cart updated successfully",
 	})
 }
 
 // RemoveFromCart removes an item from the cart
 // @Summary Remove item from cart
-// @Description Remove a product from the shopping cart
+// @Description Remove a cart line by itemId (or productId for uncustomized lines)
 // @Tags Cart
 // @Accept json
 // @Produce json
 // @Param X-Guest-Session-ID header string false "Guest session ID for guest users"
-// @Param productId path string true "Product ID to remove"
+// @Param productId path string true "Cart item ID or product ID to remove"
 // @Success 200 {object} map[string]interface{} "Item removed from cart successfully"
 // @Failure 400 {object} map[string]interface{} "Invalid product ID"
 // @Failure 500 {object} map[string]interface{} "Internal server error"
@@ -160,7 +171,7 @@ func (h *CartHandler) RemoveFromCart(c *gin.Context) {
 	guestSessionID := c.GetHeader("X-Guest-Session-ID")
 	productID := c.Param("productId")
 
-	err := h.cartService.RemoveFromCart(userID, guestSessionID, productID)
+	cart, err := h.cartService.RemoveFromCart(userID, guestSessionID, productID)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
@@ -172,6 +183,7 @@ func (h *CartHandler) RemoveFromCart(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
+		"data":    cart,
 		"message": "Item removed from cart successfully",
 	})
 }
@@ -205,7 +217,7 @@ func (h *CartHandler) ApplyCoupon(c *gin.Context) {
 		return
 	}
 
-	err := h.cartService.ApplyCoupon(userID, guestSessionID, req.CouponCode)
+	cart, err := h.cartService.ApplyCoupon(userID, guestSessionID, req.CouponCode)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
@@ -217,6 +229,7 @@ func (h *CartHandler) ApplyCoupon(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
+		"data":    cart,
 		"message": "Coupon applied successfully",
 	})
 }
@@ -235,7 +248,7 @@ func (h *CartHandler) RemoveCoupon(c *gin.Context) {
 	userID, _ := middleware.GetUserIDFromContext(c)
 	guestSessionID := c.GetHeader("X-Guest-Session-ID")
 
-	err := h.cartService.RemoveCoupon(userID, guestSessionID)
+	cart, err := h.cartService.RemoveCoupon(userID, guestSessionID)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
@@ -247,6 +260,7 @@ func (h *CartHandler) RemoveCoupon(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
+		"data":    cart,
 		"message": "Coupon removed successfully",
 	})
 }
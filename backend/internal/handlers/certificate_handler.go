@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"thyne-jewels-backend/internal/middleware"
+	"thyne-jewels-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CertificateHandler handles certificates of authenticity and their public verification
+type CertificateHandler struct {
+	certificateService services.CertificateService
+}
+
+// NewCertificateHandler creates a new certificate handler
+func NewCertificateHandler(certificateService services.CertificateService) *CertificateHandler {
+	return &CertificateHandler{certificateService: certificateService}
+}
+
+// GetMyCertificates lists the customer's certificates of authenticity
+// @Summary Get my certificates
+// @Description List the certificates of authenticity issued on the delivered orders of the authenticated user or guest
+// @Tags Certificates
+// @Produce json
+// @Param X-Guest-Session-ID header string false "Guest session ID for guest users"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Number of items per page" default(20)
+// @Success 200 {object} map[string]interface{} "Certificates"
+// @Router /certificates [get]
+func (h *CertificateHandler) GetMyCertificates(c *gin.Context) {
+	userID, _ := middleware.GetUserIDFromContext(c)
+	guestSessionID := c.GetHeader("X-Guest-Session-ID")
+	page, limit := returnPagination(c)
+
+	certificates, total, err := h.certificateService.ListCustomerCertificates(userID, guestSessionID, page, limit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+			"code":    "FETCH_FAILED",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"certificates": certificates,
+			"pagination": gin.H{
+				"page":       page,
+				"limit":      limit,
+				"total":      total,
+				"totalPages": (total + int64(limit) - 1) / int64(limit),
+			},
+		},
+	})
+}
+
+// GetMyCertificate returns one of the customer's certificates
+// @Summary Get certificate
+// @Tags Certificates
+// @Produce json
+// @Param X-Guest-Session-ID header string false "Guest session ID for guest users"
+// @Param id path string true "Certificate ID"
+// @Success 200 {object} map[string]interface{} "Certificate"
+// @Failure 404 {object} map[string]interface{} "Certificate not found"
+// @Router /certificates/{id} [get]
+func (h *CertificateHandler) GetMyCertificate(c *gin.Context) {
+	certificate, err := h.certificateService.GetCustomerCertificate(c.Param("id"), customerActor(c))
+	if err != nil {
+		respondCertificateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    certificate,
+	})
+}
+
+// VerifyCertificate checks a certificate number and signature against the store's records
+// @Summary Verify certificate
+// @Description Public endpoint the certificate QR code links to. Checks that the certificate on record still matches its signature and, when `sig` is given, that it is the signature printed on the certificate. Only a certificate checked with `sig` is `valid`, with `status` authentic and the details on record; a bare number that was issued has `status` number_only. A forged or altered certificate has `status` invalid.
+// @Tags Certificates
+// @Produce json
+// @Param certificateNo path string true "Certificate number"
+// @Param sig query string false "Signature printed on the certificate"
+// @Success 200 {object} map[string]interface{} "Verification result"
+// @Failure 404 {object} map[string]interface{} "No certificate with this number was issued"
+// @Failure 503 {object} map[string]interface{} "Certificates are not enabled"
+// @Router /certificates/verify/{certificateNo} [get]
+func (h *CertificateHandler) VerifyCertificate(c *gin.Context) {
+	result, err := h.certificateService.VerifyCertificate(c.Request.Context(), c.Param("certificateNo"), c.Query("sig"))
+	if err != nil {
+		respondCertificateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// AdminGetOrderCertificates lists the certificates issued for an order
+// @Summary Get order certificates (Admin)
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Order ID"
+// @Success 200 {object} map[string]interface{} "Certificates"
+// @Router /admin/orders/{id}/certificates [get]
+func (h *CertificateHandler) AdminGetOrderCertificates(c *gin.Context) {
+	certificates, err := h.certificateService.GetOrderCertificates(c.Param("id"))
+	if err != nil {
+		respondCertificateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    certificates,
+	})
+}
+
+// AdminIssueOrderCertificates issues any missing certificates of a delivered order
+// @Summary Issue order certificates (Admin)
+// @Description Issue certificates for units of a delivered order that have none, such as orders delivered before certificates were introduced
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Order ID"
+// @Success 200 {object} map[string]interface{} "Certificates issued"
+// @Router /admin/orders/{id}/certificates [post]
+func (h *CertificateHandler) AdminIssueOrderCertificates(c *gin.Context) {
+	certificates, err := h.certificateService.IssueOrderCertificates(c.Param("id"))
+	if err != nil {
+		respondCertificateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    certificates,
+		"message": "Certificates issued",
+	})
+}
+
+func respondCertificateError(c *gin.Context, err error) {
+	status, code := http.StatusBadRequest, "CERTIFICATE_FAILED"
+	switch {
+	case errors.Is(err, services.ErrCertificateNotFound):
+		status, code = http.StatusNotFound, "NOT_FOUND"
+	case errors.Is(err, services.ErrCertificatesDisabled):
+		status, code = http.StatusServiceUnavailable, "CERTIFICATES_DISABLED"
+	}
+
+	c.JSON(status, gin.H{
+		"success": false,
+		"error":   err.Error(),
+		"code":    code,
+	})
+}
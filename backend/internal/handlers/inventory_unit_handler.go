@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// InventoryUnitHandler handles the physical pieces of products and their BIS hallmarks
+type InventoryUnitHandler struct {
+	inventoryUnitService services.InventoryUnitService
+}
+
+// NewInventoryUnitHandler creates a new inventory unit handler
+func NewInventoryUnitHandler(inventoryUnitService services.InventoryUnitService) *InventoryUnitHandler {
+	return &InventoryUnitHandler{inventoryUnitService: inventoryUnitService}
+}
+
+// CreateUnits adds pieces to a product's inventory
+// @Summary Add inventory units (Admin)
+// @Description Add physical pieces of a product with their serial, HUID, gross and net weight and purity. Purity defaults to that of the product's metal.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Product ID"
+// @Param request body models.CreateInventoryUnitsRequest true "Units"
+// @Success 201 {object} map[string]interface{} "Units added"
+// @Failure 400 {object} map[string]interface{} "Invalid unit, or serial or HUID already used"
+// @Router /admin/products/{id}/units [post]
+func (h *InventoryUnitHandler) CreateUnits(c *gin.Context) {
+	var req models.CreateInventoryUnitsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request data: " + err.Error(),
+			"code":    "INVALID_INPUT",
+		})
+		return
+	}
+
+	units, err := h.inventoryUnitService.CreateUnits(c.Param("id"), &req)
+	if err != nil {
+		respondInventoryUnitError(c, err, "UNIT_CREATION_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    units,
+		"message": "Inventory units added",
+	})
+}
+
+// GetUnits lists a product's pieces
+// @Summary Get inventory units (Admin)
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Product ID"
+// @Param status query string false "in_stock, sold or retired"
+// @Success 200 {object} map[string]interface{} "Units"
+// @Router /admin/products/{id}/units [get]
+func (h *InventoryUnitHandler) GetUnits(c *gin.Context) {
+	units, err := h.inventoryUnitService.ListProductUnits(c.Param("id"), models.InventoryUnitStatus(c.Query("status")))
+	if err != nil {
+		respondInventoryUnitError(c, err, "FETCH_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    units,
+	})
+}
+
+// UpdateUnit corrects a piece's details or takes it in or out of stock
+// @Summary Update inventory unit (Admin)
+// @Description Edit a piece that has not been sold, retire it, or put a sold piece back into stock once its order has been returned
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Product ID"
+// @Param unitId path string true "Unit ID"
+// @Param request body models.UpdateInventoryUnitRequest true "Changes"
+// @Success 200 {object} map[string]interface{} "Unit updated"
+// @Failure 422 {object} map[string]interface{} "Sold units cannot be edited"
+// @Router /admin/products/{id}/units/{unitId} [put]
+func (h *InventoryUnitHandler) UpdateUnit(c *gin.Context) {
+	var req models.UpdateInventoryUnitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request data: " + err.Error(),
+			"code":    "INVALID_INPUT",
+		})
+		return
+	}
+
+	unit, err := h.inventoryUnitService.UpdateUnit(c.Param("id"), c.Param("unitId"), &req)
+	if err != nil {
+		respondInventoryUnitError(c, err, "UNIT_UPDATE_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    unit,
+	})
+}
+
+// AssignOrderUnits records the pieces packed into an order
+// @Summary Assign packed units to an order (Admin)
+// @Description Record the pieces packed into each line of a confirmed or processing order, one serial or HUID per unit ordered. Gold pieces must carry a HUID. Packing a line again replaces its pieces.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Order ID"
+// @Param request body models.AssignOrderUnitsRequest true "Pieces per line"
+// @Success 200 {object} map[string]interface{} "Order with its packed units"
+// @Failure 422 {object} map[string]interface{} "Pieces cannot be packed into the order"
+// @Router /admin/orders/{id}/units [post]
+func (h *InventoryUnitHandler) AssignOrderUnits(c *gin.Context) {
+	var req models.AssignOrderUnitsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request data: " + err.Error(),
+			"code":    "INVALID_INPUT",
+		})
+		return
+	}
+
+	order, err := h.inventoryUnitService.AssignOrderUnits(c.Param("id"), &req, adminActor(c))
+	if err != nil {
+		respondInventoryUnitError(c, err, "UNIT_ASSIGNMENT_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    order,
+		"message": "Units assigned",
+	})
+}
+
+// LookupHUID finds a hallmarked piece and the orders it was sold in
+// @Summary Look up HUID (Admin)
+// @Description For after-sales service: the piece with the HUID, its product, and the orders it was packed into, newest first
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param huid path string true "6-character HUID"
+// @Success 200 {object} map[string]interface{} "Piece and orders"
+// @Failure 404 {object} map[string]interface{} "HUID not recorded"
+// @Router /admin/huid/{huid} [get]
+func (h *InventoryUnitHandler) LookupHUID(c *gin.Context) {
+	lookup, err := h.inventoryUnitService.LookupHUID(c.Param("huid"))
+	if err != nil {
+		respondInventoryUnitError(c, err, "FETCH_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    lookup,
+	})
+}
+
+func respondInventoryUnitError(c *gin.Context, err error, code string) {
+	status := http.StatusBadRequest
+	switch {
+	case errors.Is(err, services.ErrInventoryNotFound):
+		status, code = http.StatusNotFound, "NOT_FOUND"
+	case errors.Is(err, services.ErrUnitAssignmentNotAllowed):
+		status, code = http.StatusUnprocessableEntity, "UNIT_ASSIGNMENT_NOT_ALLOWED"
+	case errors.Is(err, models.ErrInvalidHUID):
+		code = "INVALID_HUID"
+	}
+
+	c.JSON(status, gin.H{
+		"success": false,
+		"error":   err.Error(),
+		"code":    code,
+	})
+}
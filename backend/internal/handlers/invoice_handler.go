@@ -1,14 +1,18 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"thyne-jewels-backend/internal/middleware"
 	"thyne-jewels-backend/internal/models"
 	"thyne-jewels-backend/internal/services"
 
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type InvoiceHandler struct {
@@ -342,41 +346,226 @@ func (h *InvoiceHandler) ExportInvoicesCSV(c *gin.Context) {
 	c.Data(http.StatusOK, "text/csv", csvData)
 }
 
-// DeleteInvoice deletes an invoice (admin only)
-// @Summary Delete invoice
-// @Description Delete an invoice (admin only)
+// VoidInvoice voids an invoice issued in error (admin only)
+// @Summary Void invoice
+// @Description Void an invoice instead of deleting it, so its number stays used. Invoices with credit notes cannot be voided.
 // @Tags Invoices
 // @Accept json
 // @Produce json
 // @Param id path string true "Invoice ID"
-// @Success 200 {object} map[string]interface{} "Invoice deleted successfully"
-// @Failure 400 {object} map[string]interface{} "Invalid invoice ID"
-// @Failure 500 {object} map[string]interface{} "Internal server error"
-// @Router /admin/invoices/{id} [delete]
+// @Param request body models.VoidInvoiceRequest true "Reason for voiding"
+// @Success 200 {object} map[string]interface{} "Invoice voided successfully"
+// @Failure 404 {object} map[string]interface{} "Invoice not found"
+// @Failure 422 {object} map[string]interface{} "Invoice cannot be voided"
+// @Router /admin/invoices/{id}/void [post]
 // @Security Bearer
-func (h *InvoiceHandler) DeleteInvoice(c *gin.Context) {
-	invoiceID := c.Param("id")
-	if invoiceID == "" {
+func (h *InvoiceHandler) VoidInvoice(c *gin.Context) {
+	var req models.VoidInvoiceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
-			"error":   "Invoice ID is required",
+			"error":   "A reason is required",
 			"code":    "INVALID_INPUT",
 		})
 		return
 	}
 
-	err := h.invoiceService.DeleteInvoice(c.Request.Context(), invoiceID)
+	invoice, err := h.invoiceService.VoidInvoice(c.Request.Context(), c.Param("id"), adminActor(c), req.Reason)
+	if err != nil {
+		respondInvoiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    invoice,
+		"message": "Invoice voided successfully",
+	})
+}
+
+// GetCreditNotes lists the credit notes against an invoice
+// @Summary Get invoice credit notes
+// @Description Get the credit notes issued against an invoice for refunds
+// @Tags Invoices
+// @Produce json
+// @Param X-Guest-Session-ID header string false "Guest session ID for guest users"
+// @Param id path string true "Invoice ID"
+// @Success 200 {object} map[string]interface{} "Credit notes retrieved successfully"
+// @Failure 404 {object} map[string]interface{} "Invoice not found"
+// @Router /invoices/{id}/credit-notes [get]
+func (h *InvoiceHandler) GetCreditNotes(c *gin.Context) {
+	creditNotes, err := h.invoiceService.GetCreditNotes(c.Request.Context(), c.Param("id"), documentActor(c))
+	if err != nil {
+		respondInvoiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    creditNotes,
+	})
+}
+
+// ListCreditNotes lists all credit notes (admin only)
+// @Summary List credit notes
+// @Description Get all credit notes, newest first (admin only)
+// @Tags Invoices
+// @Produce json
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Number of items per page" default(20)
+// @Param orderId query string false "Filter by order ID"
+// @Success 200 {object} map[string]interface{} "Credit notes retrieved successfully"
+// @Router /admin/credit-notes [get]
+// @Security Bearer
+func (h *InvoiceHandler) ListCreditNotes(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 20
+	}
+
+	filter := &models.CreditNoteFilter{
+		Page:  page,
+		Limit: limit,
+	}
+	if orderID := c.Query("orderId"); orderID != "" {
+		objID, err := primitive.ObjectIDFromHex(orderID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid order ID",
+				"code":    "INVALID_INPUT",
+			})
+			return
+		}
+		filter.OrderID = &objID
+	}
+
+	creditNotes, total, err := h.invoiceService.ListCreditNotes(c.Request.Context(), filter)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
-			"error":   err.Error(),
-			"code":    "DELETE_FAILED",
+			"error":   "Failed to fetch credit notes",
+			"code":    "FETCH_FAILED",
 		})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"message": "Invoice deleted successfully",
+		"data": gin.H{
+			"creditNotes": creditNotes,
+			"pagination": gin.H{
+				"page":       page,
+				"limit":      limit,
+				"total":      total,
+				"totalPages": (total + int64(limit) - 1) / int64(limit),
+			},
+		},
+	})
+}
+
+// GetEInvoice returns the GST e-invoice JSON of a B2B invoice (admin only)
+// @Summary Get invoice e-invoice JSON
+// @Description Build the NIC e-invoice (IRN) payload of an invoice with a buyer GSTIN and check it against the schema rules (admin only)
+// @Tags Invoices
+// @Produce json
+// @Param id path string true "Invoice ID"
+// @Success 200 {object} map[string]interface{} "E-invoice generated"
+// @Failure 404 {object} map[string]interface{} "Invoice not found"
+// @Failure 422 {object} map[string]interface{} "Invoice has no buyer GSTIN"
+// @Router /admin/invoices/{id}/e-invoice [get]
+// @Security Bearer
+func (h *InvoiceHandler) GetEInvoice(c *gin.Context) {
+	result, err := h.invoiceService.GetEInvoice(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondInvoiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// GetEInvoiceBatch returns the GST e-invoices of the B2B invoices in a date range (admin only)
+// @Summary Download e-invoice batch
+// @Description Build the NIC e-invoice (IRN) payloads of the invoices with a buyer GSTIN raised between two dates, in Indian time. With download=true only the valid payloads are returned, as a JSON file for bulk upload (admin only)
+// @Tags Invoices
+// @Produce json
+// @Param from query string true "First invoice date (YYYY-MM-DD)"
+// @Param to query string true "Last invoice date (YYYY-MM-DD)"
+// @Param download query bool false "Return the valid payloads as a file"
+// @Success 200 {object} map[string]interface{} "E-invoices generated"
+// @Failure 400 {object} map[string]interface{} "Invalid date range"
+// @Router /admin/invoices/e-invoice [get]
+// @Security Bearer
+func (h *InvoiceHandler) GetEInvoiceBatch(c *gin.Context) {
+	from, fromErr := models.ParseIndiaDate(c.Query("from"))
+	to, toErr := models.ParseIndiaDate(c.Query("to"))
+	if fromErr != nil || toErr != nil || to.Before(from) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "from and to must be dates (YYYY-MM-DD), with from not after to",
+			"code":    "INVALID_DATE_RANGE",
+		})
+		return
+	}
+
+	// The range covers the whole of the last day
+	batch, err := h.invoiceService.GetEInvoiceBatch(c.Request.Context(), from, to.AddDate(0, 0, 1).Add(-time.Nanosecond))
+	if err != nil {
+		respondInvoiceError(c, err)
+		return
+	}
+
+	if c.Query("download") == "true" {
+		payloads := make([]*models.EInvoice, 0, batch.Valid)
+		for _, result := range batch.Invoices {
+			if result.Valid {
+				payloads = append(payloads, result.Payload)
+			}
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=e-invoices-%s-to-%s.json", c.Query("from"), c.Query("to")))
+		c.JSON(http.StatusOK, payloads)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    batch,
 	})
 }
+
+func respondInvoiceError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvoiceNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   err.Error(),
+			"code":    "NOT_FOUND",
+		})
+	case errors.Is(err, services.ErrInvoiceNotVoidable):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"success": false,
+			"error":   err.Error(),
+			"code":    "INVOICE_NOT_VOIDABLE",
+		})
+	case errors.Is(err, services.ErrNotB2BInvoice):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"success": false,
+			"error":   err.Error(),
+			"code":    "NOT_B2B_INVOICE",
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   err.Error(),
+			"code":    "SERVER_ERROR",
+		})
+	}
+}
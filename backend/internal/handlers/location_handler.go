@@ -0,0 +1,554 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"thyne-jewels-backend/internal/middleware"
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// LocationHandler handles stock locations, their staff and transfers between them
+type LocationHandler struct {
+	locationService services.LocationService
+	stockService    services.StockService
+	productService  services.ProductService
+}
+
+// NewLocationHandler creates a new location handler
+func NewLocationHandler(locationService services.LocationService, stockService services.StockService, productService services.ProductService) *LocationHandler {
+	return &LocationHandler{
+		locationService: locationService,
+		stockService:    stockService,
+		productService:  productService,
+	}
+}
+
+// GetCollectionPoints lists the locations orders can be collected from
+// @Summary Get click-and-collect locations
+// @Tags Locations
+// @Produce json
+// @Success 200 {object} map[string]interface{} "Collection points"
+// @Router /locations [get]
+func (h *LocationHandler) GetCollectionPoints(c *gin.Context) {
+	points, err := h.locationService.ListCollectionPoints()
+	if err != nil {
+		respondLocationError(c, err, "FETCH_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    points,
+	})
+}
+
+// GetAvailability returns a product's stock at each collection point
+// @Summary Get product availability by location
+// @Description Get the stock of a product, or of one of its variants, at each click-and-collect location
+// @Tags Products
+// @Produce json
+// @Param id path string true "Product ID"
+// @Param variantId query string false "Variant ID"
+// @Success 200 {object} map[string]interface{} "Stock per location"
+// @Failure 404 {object} map[string]interface{} "Product or variant not found"
+// @Router /products/{id}/availability [get]
+func (h *LocationHandler) GetAvailability(c *gin.Context) {
+	availability, err := h.locationService.GetAvailability(c.Param("id"), c.Query("variantId"))
+	if err != nil {
+		respondLocationError(c, err, "FETCH_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    availability,
+	})
+}
+
+// GetLocations lists stock locations
+// @Summary Get stock locations (Admin)
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param active query boolean false "Only active locations"
+// @Success 200 {object} map[string]interface{} "Locations by priority"
+// @Router /admin/locations [get]
+func (h *LocationHandler) GetLocations(c *gin.Context) {
+	activeOnly, _ := strconv.ParseBool(c.Query("active"))
+	locations, err := h.locationService.ListLocations(activeOnly)
+	if err != nil {
+		respondLocationError(c, err, "FETCH_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    locations,
+	})
+}
+
+// CreateLocation adds a stock location
+// @Summary Create stock location (Admin)
+// @Description Add a warehouse or showroom. The first location becomes the default and the existing stock is placed there.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.CreateStockLocationRequest true "Location"
+// @Success 201 {object} map[string]interface{} "Location created"
+// @Failure 400 {object} map[string]interface{} "Invalid location or code already in use"
+// @Router /admin/locations [post]
+func (h *LocationHandler) CreateLocation(c *gin.Context) {
+	var req models.CreateStockLocationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request data: " + err.Error(),
+			"code":    "INVALID_INPUT",
+		})
+		return
+	}
+
+	location, err := h.locationService.CreateLocation(&req)
+	if err != nil {
+		respondLocationError(c, err, "LOCATION_CREATION_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    location,
+	})
+}
+
+// UpdateLocation changes a stock location
+// @Summary Update stock location (Admin)
+// @Description Change a location's details, pincodes served and priority, make it the default or deactivate it
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Location ID"
+// @Param request body models.UpdateStockLocationRequest true "Changes"
+// @Success 200 {object} map[string]interface{} "Location updated"
+// @Failure 400 {object} map[string]interface{} "The default location cannot be deactivated"
+// @Router /admin/locations/{id} [put]
+func (h *LocationHandler) UpdateLocation(c *gin.Context) {
+	var req models.UpdateStockLocationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request data: " + err.Error(),
+			"code":    "INVALID_INPUT",
+		})
+		return
+	}
+
+	location, err := h.locationService.UpdateLocation(c.Param("id"), &req)
+	if err != nil {
+		respondLocationError(c, err, "LOCATION_UPDATE_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    location,
+	})
+}
+
+// AssignStaff sets the locations a user works at
+// @Summary Assign store staff (Admin)
+// @Description Set the locations a user works at. Store staff manage stock, orders and transfers at their locations only; an empty list removes their access.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Param request body models.AssignLocationStaffRequest true "Locations"
+// @Success 200 {object} map[string]interface{} "User updated"
+// @Failure 404 {object} map[string]interface{} "User or location not found"
+// @Router /admin/users/{id}/locations [put]
+func (h *LocationHandler) AssignStaff(c *gin.Context) {
+	var req models.AssignLocationStaffRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request data: " + err.Error(),
+			"code":    "INVALID_INPUT",
+		})
+		return
+	}
+
+	user, err := h.locationService.AssignStaff(c.Param("id"), &req)
+	if err != nil {
+		respondLocationError(c, err, "USER_UPDATE_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    user,
+	})
+}
+
+// GetAllTransfers lists transfers between every location
+// @Summary Get stock transfers (Admin)
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param locationId query string false "Sent from or to the location"
+// @Param status query string false "in_transit, received or cancelled"
+// @Param page query int false "Page number"
+// @Param limit query int false "Items per page"
+// @Success 200 {object} map[string]interface{} "Transfers"
+// @Router /admin/stock/transfers [get]
+func (h *LocationHandler) GetAllTransfers(c *gin.Context) {
+	var locationID *primitive.ObjectID
+	if value := c.Query("locationId"); value != "" {
+		id, err := primitive.ObjectIDFromHex(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid location ID",
+				"code":    "INVALID_INPUT",
+			})
+			return
+		}
+		locationID = &id
+	}
+	h.listTransfers(c, locationID)
+}
+
+// GetLocationStock lists the products in stock at a location
+// @Summary Get location stock (Store staff)
+// @Tags Locations
+// @Produce json
+// @Security BearerAuth
+// @Param locationId path string true "Location ID"
+// @Param search query string false "Search term"
+// @Param category query string false "Product category"
+// @Param page query int false "Page number"
+// @Param limit query int false "Items per page"
+// @Success 200 {object} map[string]interface{} "Products with their stock per location"
+// @Failure 403 {object} map[string]interface{} "Not staff at the location"
+// @Router /locations/{locationId}/stock [get]
+func (h *LocationHandler) GetLocationStock(c *gin.Context) {
+	page, limit := returnPagination(c)
+	filter := models.ProductFilter{
+		Category: c.Query("category"),
+		Search:   c.Query("search"),
+		SortBy:   c.DefaultQuery("sortBy", "newest"),
+		Page:     page,
+		Limit:    limit,
+	}
+
+	products, total, err := h.locationService.GetLocationStock(c.Param("locationId"), filter)
+	if err != nil {
+		respondLocationError(c, err, "FETCH_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"products":   products,
+			"pagination": paginationData(page, limit, total),
+		},
+	})
+}
+
+// AdjustLocationStock records a manual stock change at a location
+// @Summary Adjust stock at a location (Store staff)
+// @Description Apply an import, write-off or adjustment to the stock held at the location and record it in the stock ledger
+// @Tags Locations
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param locationId path string true "Location ID"
+// @Param productId path string true "Product ID"
+// @Param request body models.StockAdjustmentRequest true "Adjustment; locationId is taken from the path"
+// @Success 201 {object} map[string]interface{} "Ledger entry"
+// @Failure 400 {object} map[string]interface{} "Invalid quantity, variant or not enough stock at the location"
+// @Router /locations/{locationId}/products/{productId}/stock/adjustments [post]
+func (h *LocationHandler) AdjustLocationStock(c *gin.Context) {
+	var req models.StockAdjustmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request data: " + err.Error(),
+			"code":    "INVALID_INPUT",
+		})
+		return
+	}
+	req.LocationID = c.Param("locationId")
+
+	product, err := h.productService.GetProduct(c.Param("productId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Product not found",
+			"code":    "NOT_FOUND",
+		})
+		return
+	}
+
+	movement, err := h.stockService.AdjustStock(c.Request.Context(), product, &req, locationStaffActor(c))
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidStockAdjustment) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   err.Error(),
+				"code":    "INVALID_STOCK_ADJUSTMENT",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to adjust stock",
+			"code":    "STOCK_UPDATE_FAILED",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    movement,
+	})
+}
+
+// GetLocationLedger lists the stock movements at a location
+// @Summary Get location stock ledger (Store staff)
+// @Tags Locations
+// @Produce json
+// @Security BearerAuth
+// @Param locationId path string true "Location ID"
+// @Param type query string false "Movement type"
+// @Param page query int false "Page number"
+// @Param limit query int false "Items per page"
+// @Success 200 {object} map[string]interface{} "Stock movements"
+// @Router /locations/{locationId}/stock/movements [get]
+func (h *LocationHandler) GetLocationLedger(c *gin.Context) {
+	locationID, _ := primitive.ObjectIDFromHex(c.Param("locationId"))
+	page, limit := returnPagination(c)
+	filter := models.StockLedgerFilter{
+		LocationID: &locationID,
+		Type:       models.StockMovementType(c.Query("type")),
+		Page:       page,
+		Limit:      limit,
+	}
+
+	movements, total, err := h.stockService.GetLedger(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to get stock movements",
+			"code":    "FETCH_FAILED",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"movements":  movements,
+			"pagination": paginationData(page, limit, total),
+		},
+	})
+}
+
+// GetLocationOrders lists the orders fulfilled from a location
+// @Summary Get location orders (Store staff)
+// @Tags Locations
+// @Produce json
+// @Security BearerAuth
+// @Param locationId path string true "Location ID"
+// @Param status query string false "Order status"
+// @Param page query int false "Page number"
+// @Param limit query int false "Items per page"
+// @Success 200 {object} map[string]interface{} "Orders with lines fulfilled from the location"
+// @Router /locations/{locationId}/orders [get]
+func (h *LocationHandler) GetLocationOrders(c *gin.Context) {
+	page, limit := returnPagination(c)
+	var status *models.OrderStatus
+	if value := c.Query("status"); value != "" {
+		s := models.OrderStatus(value)
+		status = &s
+	}
+
+	orders, total, err := h.locationService.GetLocationOrders(c.Param("locationId"), page, limit, status)
+	if err != nil {
+		respondLocationError(c, err, "FETCH_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"orders":     orders,
+			"pagination": paginationData(page, limit, total),
+		},
+	})
+}
+
+// GetLocationTransfers lists the transfers sent from or to a location
+// @Summary Get location transfers (Store staff)
+// @Tags Locations
+// @Produce json
+// @Security BearerAuth
+// @Param locationId path string true "Location ID"
+// @Param status query string false "in_transit, received or cancelled"
+// @Param page query int false "Page number"
+// @Param limit query int false "Items per page"
+// @Success 200 {object} map[string]interface{} "Transfers"
+// @Router /locations/{locationId}/transfers [get]
+func (h *LocationHandler) GetLocationTransfers(c *gin.Context) {
+	locationID, _ := primitive.ObjectIDFromHex(c.Param("locationId"))
+	h.listTransfers(c, &locationID)
+}
+
+// CreateTransfer sends stock to another location
+// @Summary Create stock transfer (Store staff)
+// @Description Send stock from the location to another. The units leave the location at once and are not sellable until the destination receives them.
+// @Tags Locations
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param locationId path string true "Source location ID"
+// @Param request body models.CreateStockTransferRequest true "Transfer"
+// @Success 201 {object} map[string]interface{} "Transfer in transit"
+// @Failure 400 {object} map[string]interface{} "Invalid destination or not enough stock at the location"
+// @Router /locations/{locationId}/transfers [post]
+func (h *LocationHandler) CreateTransfer(c *gin.Context) {
+	var req models.CreateStockTransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request data: " + err.Error(),
+			"code":    "INVALID_INPUT",
+		})
+		return
+	}
+
+	transfer, err := h.locationService.CreateTransfer(c.Param("locationId"), &req, locationStaffActor(c))
+	if err != nil {
+		respondLocationError(c, err, "TRANSFER_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    transfer,
+	})
+}
+
+// ReceiveTransfer puts a transfer's units into stock at the location
+// @Summary Receive stock transfer (Store staff)
+// @Tags Locations
+// @Produce json
+// @Security BearerAuth
+// @Param locationId path string true "Destination location ID"
+// @Param transferId path string true "Transfer ID"
+// @Success 200 {object} map[string]interface{} "Transfer received"
+// @Failure 400 {object} map[string]interface{} "Not sent to the location or no longer in transit"
+// @Router /locations/{locationId}/transfers/{transferId}/receive [put]
+func (h *LocationHandler) ReceiveTransfer(c *gin.Context) {
+	transfer, err := h.locationService.ReceiveTransfer(c.Param("locationId"), c.Param("transferId"), locationStaffActor(c))
+	if err != nil {
+		respondLocationError(c, err, "TRANSFER_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    transfer,
+	})
+}
+
+// CancelTransfer puts a transfer's units back into stock at the location it was sent from
+// @Summary Cancel stock transfer (Store staff)
+// @Tags Locations
+// @Produce json
+// @Security BearerAuth
+// @Param locationId path string true "Source location ID"
+// @Param transferId path string true "Transfer ID"
+// @Success 200 {object} map[string]interface{} "Transfer cancelled"
+// @Failure 400 {object} map[string]interface{} "Not sent from the location or no longer in transit"
+// @Router /locations/{locationId}/transfers/{transferId}/cancel [put]
+func (h *LocationHandler) CancelTransfer(c *gin.Context) {
+	transfer, err := h.locationService.CancelTransfer(c.Param("locationId"), c.Param("transferId"), locationStaffActor(c))
+	if err != nil {
+		respondLocationError(c, err, "TRANSFER_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    transfer,
+	})
+}
+
+func (h *LocationHandler) listTransfers(c *gin.Context, locationID *primitive.ObjectID) {
+	page, limit := returnPagination(c)
+	filter := models.StockTransferFilter{
+		LocationID: locationID,
+		Status:     models.StockTransferStatus(c.Query("status")),
+		Page:       page,
+		Limit:      limit,
+	}
+
+	transfers, total, err := h.locationService.ListTransfers(filter)
+	if err != nil {
+		respondLocationError(c, err, "FETCH_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"transfers":  transfers,
+			"pagination": paginationData(page, limit, total),
+		},
+	})
+}
+
+// locationStaffActor identifies the signed-in admin or store staff member
+func locationStaffActor(c *gin.Context) models.OrderActor {
+	actor := adminActor(c)
+	if user, ok := middleware.GetUserFromContext(c); ok && !user.IsAdmin {
+		actor.Type = models.OrderActorStaff
+	}
+	return actor
+}
+
+func paginationData(page, limit int, total int64) gin.H {
+	return gin.H{
+		"page":       page,
+		"limit":      limit,
+		"total":      total,
+		"totalPages": (total + int64(limit) - 1) / int64(limit),
+	}
+}
+
+func respondLocationError(c *gin.Context, err error, code string) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrInventoryNotFound):
+		status, code = http.StatusNotFound, "NOT_FOUND"
+	case errors.Is(err, services.ErrInvalidStockLocation):
+		status, code = http.StatusBadRequest, "INVALID_STOCK_LOCATION"
+	case errors.Is(err, services.ErrInvalidStockTransfer):
+		status, code = http.StatusBadRequest, "INVALID_STOCK_TRANSFER"
+	}
+
+	c.JSON(status, gin.H{
+		"success": false,
+		"error":   err.Error(),
+		"code":    code,
+	})
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MetalRateHandler handles the live per-gram metal rates weight-priced products follow
+type MetalRateHandler struct {
+	metalRateService services.MetalRateService
+}
+
+// NewMetalRateHandler creates a new metal rate handler
+func NewMetalRateHandler(metalRateService services.MetalRateService) *MetalRateHandler {
+	return &MetalRateHandler{metalRateService: metalRateService}
+}
+
+// GetCurrentRates returns today's rate of every metal
+// @Summary Get metal rates
+// @Description The live per-gram rate of every metal code (G22K, S925, PT950...)
+// @Tags Products
+// @Produce json
+// @Success 200 {object} map[string]interface{} "Current rates"
+// @Router /metal-rates [get]
+func (h *MetalRateHandler) GetCurrentRates(c *gin.Context) {
+	rates, err := h.metalRateService.GetCurrentRates(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to get metal rates",
+			"code":    "FETCH_FAILED",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    rates,
+	})
+}
+
+// SetRates sets the live rate of one or more metals
+// @Summary Set metal rates (Admin)
+// @Description Record new per-gram rates. Codes must be metal subtype codes from the store settings. Metal-rate products are repriced.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.SetMetalRatesRequest true "Rates"
+// @Success 201 {object} map[string]interface{} "Rates recorded"
+// @Failure 400 {object} map[string]interface{} "Unknown code or invalid rate"
+// @Router /admin/metal-rates [post]
+func (h *MetalRateHandler) SetRates(c *gin.Context) {
+	var req models.SetMetalRatesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request data: " + err.Error(),
+			"code":    "INVALID_INPUT",
+		})
+		return
+	}
+
+	rates, err := h.metalRateService.SetRates(c.Request.Context(), &req, adminActor(c))
+	if err != nil {
+		respondMetalRateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    rates,
+		"message": "Metal rates updated",
+	})
+}
+
+// ImportRates sets rates from a CSV file
+// @Summary Import metal rates (Admin)
+// @Description Upload a CSV with a header row and code and ratePerGram columns, plus an optional note column. Nothing is imported unless every row is valid.
+// @Tags Admin
+// @Accept multipart/form-data
+// @Produce json
+// @Security BearerAuth
+// @Param file formData file true "CSV file of rates"
+// @Success 201 {object} map[string]interface{} "Rates recorded"
+// @Failure 400 {object} map[string]interface{} "Invalid CSV or rates"
+// @Router /admin/metal-rates/import [post]
+func (h *MetalRateHandler) ImportRates(c *gin.Context) {
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "No file uploaded",
+			"code":    "NO_FILE",
+		})
+		return
+	}
+	defer file.Close()
+
+	if !strings.HasSuffix(strings.ToLower(header.Filename), ".csv") {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Only CSV files are allowed",
+			"code":    "INVALID_FILE_TYPE",
+		})
+		return
+	}
+
+	rates, err := h.metalRateService.ImportRatesCSV(c.Request.Context(), file, adminActor(c))
+	if err != nil {
+		respondMetalRateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    rates,
+		"message": "Metal rates imported",
+	})
+}
+
+// GetHistory lists past rate changes
+// @Summary Get metal rate history (Admin)
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param code query string false "Metal code, e.g. G22K"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page" default(20)
+// @Success 200 {object} map[string]interface{} "Rate changes, newest first"
+// @Router /admin/metal-rates/history [get]
+func (h *MetalRateHandler) GetHistory(c *gin.Context) {
+	page, limit := returnPagination(c)
+	filter := models.MetalRateHistoryFilter{Code: c.Query("code"), Page: page, Limit: limit}
+
+	rates, total, err := h.metalRateService.GetHistory(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to get metal rate history",
+			"code":    "FETCH_FAILED",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"rates": rates,
+			"pagination": gin.H{
+				"page":       page,
+				"limit":      limit,
+				"total":      total,
+				"totalPages": (total + int64(limit) - 1) / int64(limit),
+			},
+		},
+	})
+}
+
+func respondMetalRateError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrInvalidMetalRate) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+			"code":    "INVALID_METAL_RATE",
+		})
+		return
+	}
+
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"success": false,
+		"error":   "Failed to update metal rates",
+		"code":    "METAL_RATE_FAILED",
+	})
+}
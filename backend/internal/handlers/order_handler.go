@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -12,16 +13,14 @@ import (
 )
 
 type OrderHandler struct {
-	orderService   services.OrderService
-	paymentService services.PaymentService
-	authService    services.AuthService
+	orderService services.OrderService
+	authService  services.AuthService
 }
 
-func NewOrderHandler(orderService services.OrderService, paymentService services.PaymentService, authService services.AuthService) *OrderHandler {
+func NewOrderHandler(orderService services.OrderService, authService services.AuthService) *OrderHandler {
 	return &OrderHandler{
-		orderService:   orderService,
-		paymentService: paymentService,
-		authService:    authService,
+		orderService: orderService,
+		authService:  authService,
 	}
 }
 
@@ -35,6 +34,8 @@ func NewOrderHandler(orderService services.OrderService, paymentService services
 // @Param request body models.CreateOrderRequest true "Order creation data"
 // @Success 201 {object} map[string]interface{} "Order created successfully"
 // @Failure 400 {object} map[string]interface{} "Invalid request data"
+// @Failure 409 {object} map[string]interface{} "Item price has changed"
+// @Failure 422 {object} map[string]interface{} "Pincode not serviceable or COD not available"
 // @Failure 500 {object} map[string]interface{} "Internal server error"
 // @Router /orders [post]
 func (h *OrderHandler) CreateOrder(c *gin.Context) {
@@ -63,6 +64,42 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 
 	order, err := h.orderService.CreateOrder(userID, guestSessionID, &req)
 	if err != nil {
+		if errors.Is(err, services.ErrPriceChanged) {
+			c.JSON(http.StatusConflict, gin.H{
+				"success": false,
+				"error":   err.Error(),
+				"code":    "PRICE_CHANGED",
+			})
+			return
+		}
+		if errors.Is(err, services.ErrInvalidGSTIN) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   err.Error(),
+				"code":    "INVALID_GSTIN",
+			})
+			return
+		}
+		if errors.Is(err, services.ErrInvalidCoupon) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   err.Error(),
+				"code":    "INVALID_COUPON",
+			})
+			return
+		}
+		if errors.Is(err, services.ErrNotServiceable) || errors.Is(err, services.ErrCODNotAvailable) {
+			code := "NOT_SERVICEABLE"
+			if errors.Is(err, services.ErrCODNotAvailable) {
+				code = "COD_NOT_AVAILABLE"
+			}
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"success": false,
+				"error":   err.Error(),
+				"code":    code,
+			})
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
 			"error":   err.Error(),
@@ -191,7 +228,7 @@ func (h *OrderHandler) CancelOrder(c *gin.Context) {
 		req.Reason = "Order cancelled by customer"
 	}
 
-	err := h.orderService.CancelOrder(orderID, req.Reason)
+	err := h.orderService.CancelOrder(orderID, customerActor(c), req.Reason)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
@@ -209,7 +246,7 @@ func (h *OrderHandler) CancelOrder(c *gin.Context) {
 
 // TrackOrder tracks an order
 // @Summary Track order
-// @Description Get tracking information for an order
+// @Description Get an order's current status and its status timeline, with who made each change and why
 // @Tags Orders
 // @Accept json
 // @Produce json
@@ -230,7 +267,7 @@ func (h *OrderHandler) TrackOrder(c *gin.Context) {
 		return
 	}
 
-	order, err := h.orderService.TrackOrder(orderID)
+	timeline, err := h.orderService.TrackOrder(orderID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"success": false,
@@ -242,7 +279,7 @@ func (h *OrderHandler) TrackOrder(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"data":    order,
+		"data":    timeline,
 	})
 }
 
@@ -316,145 +353,6 @@ func (h *OrderHandler) SearchOrders(c *gin.Context) {
 	})
 }
 
-// CreatePaymentOrder creates a Razorpay payment order
-// @Summary Create payment order
-// @Description Create a payment order for Razorpay
-// @Tags Payment
-// @Accept json
-// @Produce json
-// @Param X-Guest-Session-ID header string false "Guest session ID for guest users"
-// @Param request body object true "Payment order creation data"
-// @Success 200 {object} map[string]interface{} "Payment order created successfully"
-// @Failure 400 {object} map[string]interface{} "Invalid request data"
-// @Failure 500 {object} map[string]interface{} "Internal server error"
-// @Router /payment/create-order [post]
-func (h *OrderHandler) CreatePaymentOrder(c *gin.Context) {
-	var req struct {
-		OrderID  string  `json:"orderId" binding:"required"`
-		Amount   float64 `json:"amount" binding:"required"`
-		Currency string  `json:"currency" binding:"required"`
-	}
-
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   "Invalid request data",
-			"code":    "INVALID_INPUT",
-		})
-		return
-	}
-
-	paymentOrder, err := h.paymentService.CreatePaymentOrder(req.OrderID, req.Amount, req.Currency)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error":   "Failed to create payment order",
-			"code":    "PAYMENT_CREATION_FAILED",
-		})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"data":    paymentOrder,
-	})
-}
-
-// VerifyPayment verifies Razorpay payment
-// @Summary Verify payment
-// @Description Verify a Razorpay payment
-// @Tags Payment
-// @Accept json
-// @Produce json
-// @Param X-Guest-Session-ID header string false "Guest session ID for guest users"
-// @Param request body object true "Payment verification data"
-// @Success 200 {object} map[string]interface{} "Payment verified successfully"
-// @Failure 400 {object} map[string]interface{} "Invalid payment data"
-// @Failure 500 {object} map[string]interface{} "Internal server error"
-// @Router /payment/verify [post]
-func (h *OrderHandler) VerifyPayment(c *gin.Context) {
-	var req struct {
-		RazorpayOrderID   string `json:"razorpayOrderId" binding:"required"`
-		RazorpayPaymentID string `json:"razorpayPaymentId" binding:"required"`
-		RazorpaySignature string `json:"razorpaySignature" binding:"required"`
-		OrderID           string `json:"orderId" binding:"required"`
-	}
-
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   "Invalid request data",
-			"code":    "INVALID_INPUT",
-		})
-		return
-	}
-
-	err := h.paymentService.VerifyPayment(req.RazorpayPaymentID, req.RazorpayOrderID, req.RazorpaySignature)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   "Payment verification failed",
-			"code":    "PAYMENT_VERIFICATION_FAILED",
-		})
-		return
-	}
-
-	// Complete the order and award loyalty points
-	if err := h.orderService.CompleteOrder(req.OrderID); err != nil {
-		// Log error but don't fail the payment verification
-		// The payment is verified, but loyalty points might not be awarded
-		c.JSON(http.StatusOK, gin.H{
-			"success": true,
-			"message": "Payment verified successfully",
-			"warning": "Order completion partially failed",
-		})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"message": "Payment verified and order completed successfully",
-	})
-}
-
-// HandleWebhook handles Razorpay webhooks
-func (h *OrderHandler) HandleWebhook(c *gin.Context) {
-	payload, err := c.GetRawData()
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   "Invalid webhook payload",
-			"code":    "INVALID_PAYLOAD",
-		})
-		return
-	}
-
-	signature := c.GetHeader("X-Razorpay-Signature")
-	if signature == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   "Missing webhook signature",
-			"code":    "MISSING_SIGNATURE",
-		})
-		return
-	}
-
-	err = h.paymentService.HandleWebhook(payload, signature)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   "Webhook processing failed",
-			"code":    "WEBHOOK_FAILED",
-		})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"message": "Webhook processed successfully",
-	})
-}
-
 // Admin endpoints
 
 // GetAllOrders gets all orders for admin (admin only)
@@ -533,7 +431,7 @@ func (h *OrderHandler) ReturnOrder(c *gin.Context) {
 		return
 	}
 
-	err := h.orderService.ReturnOrder(orderID, req.Reason)
+	err := h.orderService.ReturnOrder(orderID, customerActor(c), req.Reason)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
@@ -549,7 +447,8 @@ func (h *OrderHandler) ReturnOrder(c *gin.Context) {
 	})
 }
 
-// RefundOrder handles order refund requests
+// RefundOrder refunds a delivered or returned order through its gateway (admin only).
+// Customers ask for their money back through a return request instead.
 func (h *OrderHandler) RefundOrder(c *gin.Context) {
 	orderID := c.Param("id")
 	if orderID == "" {
@@ -562,7 +461,8 @@ func (h *OrderHandler) RefundOrder(c *gin.Context) {
 	}
 
 	var req struct {
-		Reason string `json:"reason" binding:"required"`
+		Reason string  `json:"reason" binding:"required"`
+		Amount float64 `json:"amount"` // Optional partial amount; the remaining total when omitted
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -574,7 +474,7 @@ func (h *OrderHandler) RefundOrder(c *gin.Context) {
 		return
 	}
 
-	err := h.orderService.RefundOrder(orderID, req.Reason)
+	err := h.orderService.RefundOrder(orderID, req.Amount, adminActor(c), req.Reason)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
@@ -612,7 +512,9 @@ func (h *OrderHandler) UpdateOrderStatus(c *gin.Context) {
 		return
 	}
 
-	err := h.orderService.UpdateOrderStatus(orderID, req.Status, req.TrackingNumber)
+	userID, _ := middleware.GetUserIDFromContext(c)
+	actor := models.OrderActor{Type: models.OrderActorAdmin, ID: userID}
+	err := h.orderService.UpdateOrderStatus(orderID, req.Status, req.TrackingNumber, actor, req.Reason)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
@@ -627,3 +529,14 @@ func (h *OrderHandler) UpdateOrderStatus(c *gin.Context) {
 		"message": "Order status updated successfully",
 	})
 }
+
+// customerActor identifies the signed-in user, or the guest session, changing an order
+func customerActor(c *gin.Context) models.OrderActor {
+	actor := models.OrderActor{Type: models.OrderActorCustomer}
+	if userID, ok := middleware.GetUserIDFromContext(c); ok && userID != "" {
+		actor.ID = userID
+	} else {
+		actor.ID = c.GetHeader("X-Guest-Session-ID")
+	}
+	return actor
+}
@@ -1,20 +1,24 @@
 package handlers
 
 import (
+	"log"
 	"net/http"
 	"regexp"
 	"strings"
 
+	"thyne-jewels-backend/internal/middleware"
 	"thyne-jewels-backend/internal/models"
 	"thyne-jewels-backend/internal/services"
 
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // OTPHandler handles OTP-related HTTP requests
 type OTPHandler struct {
 	smsService       *services.SMSService
 	messagingService *services.MessagingService
+	guestService     services.GuestSessionService
 }
 
 // NewOTPHandler creates a new OTP handler
@@ -41,8 +45,9 @@ type SendOTPRequest struct {
 
 // VerifyOTPRequest represents the request body for verifying OTP
 type VerifyOTPRequest struct {
-	Phone string `json:"phone" binding:"required"`
-	OTP   string `json:"otp" binding:"required"`
+	Phone          string `json:"phone" binding:"required"`
+	OTP            string `json:"otp" binding:"required"`
+	GuestSessionID string `json:"guestSessionId"` // Optional guest session to merge into the verified account
 }
 
 // SendSMSRequest represents the request body for sending SMS
@@ -51,6 +56,40 @@ type SendSMSRequest struct {
 	Message string `json:"message" binding:"required"`
 }
 
+// SetGuestSessionService enables merging a guest session into the account that owns a verified phone number
+func (h *OTPHandler) SetGuestSessionService(guestService services.GuestSessionService) {
+	h.guestService = guestService
+}
+
+// mergeGuestSession merges the guest session into the verified account. The caller is the
+// authenticated user if a token was sent, otherwise the account registered with the phone.
+func (h *OTPHandler) mergeGuestSession(c *gin.Context, req *VerifyOTPRequest) *models.GuestMergeResult {
+	sessionID := req.GuestSessionID
+	if sessionID == "" {
+		sessionID = c.GetHeader("X-Guest-Session-ID")
+	}
+	if sessionID == "" || h.guestService == nil {
+		return nil
+	}
+
+	var result *models.GuestMergeResult
+	var err error
+	if userID, ok := middleware.GetUserIDFromContext(c); ok && userID != "" {
+		var userObjID primitive.ObjectID
+		userObjID, err = primitive.ObjectIDFromHex(userID)
+		if err == nil {
+			result, err = h.guestService.MergeIntoUser(sessionID, userObjID)
+		}
+	} else {
+		result, err = h.guestService.MergeIntoUserByPhone(sessionID, req.Phone)
+	}
+	if err != nil {
+		log.Printf("Warning: failed to merge guest session %s after OTP verification: %v", sessionID, err)
+		return nil
+	}
+	return result
+}
+
 // SendOTP godoc
 // @Summary Send OTP to phone number
 // @Description Sends an OTP to the specified phone number for verification via SMS or WhatsApp
@@ -158,11 +197,11 @@ func (h *OTPHandler) SendOTP(c *gin.Context) {
 
 // VerifyOTP godoc
 // @Summary Verify OTP
-// @Description Verifies the OTP entered by the user
+// @Description Verifies the OTP entered by the user. If guestSessionId is given, the guest cart, recently viewed items and orders are merged into the signed-in account or the account registered with the phone.
 // @Tags OTP
 // @Accept json
 // @Produce json
-// @Param request body VerifyOTPRequest true "Phone number and OTP"
+// @Param request body VerifyOTPRequest true "Phone number, OTP and optional guest session ID"
 // @Success 200 {object} map[string]interface{} "OTP verified successfully"
 // @Failure 400 {object} map[string]interface{} "Invalid request or OTP"
 // @Failure 500 {object} map[string]interface{} "Failed to verify OTP"
@@ -214,11 +253,17 @@ func (h *OTPHandler) VerifyOTP(c *gin.Context) {
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{
+		result := gin.H{
 			"success":  response.Success,
 			"verified": response.Verified,
 			"message":  response.Message,
-		})
+		}
+		if response.Verified {
+			if merge := h.mergeGuestSession(c, &req); merge != nil {
+				result["guestMerge"] = merge
+			}
+		}
+		c.JSON(http.StatusOK, result)
 		return
 	}
 
@@ -251,11 +296,15 @@ func (h *OTPHandler) VerifyOTP(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	result := gin.H{
 		"success":  true,
 		"verified": true,
 		"message":  "OTP verified successfully",
-	})
+	}
+	if merge := h.mergeGuestSession(c, &req); merge != nil {
+		result["guestMerge"] = merge
+	}
+	c.JSON(http.StatusOK, result)
 }
 
 // ResendOTP godoc
@@ -0,0 +1,620 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PaymentHandler serves the payment routes of every registered gateway
+type PaymentHandler struct {
+	paymentService services.PaymentService
+}
+
+// NewPaymentHandler creates a new payment handler
+func NewPaymentHandler(paymentService services.PaymentService) *PaymentHandler {
+	return &PaymentHandler{paymentService: paymentService}
+}
+
+// GetGateways lists the payment gateways and whether they are configured
+// @Summary List payment gateways
+// @Description List the registered payment gateways and whether each is enabled
+// @Tags Payment
+// @Produce json
+// @Success 200 {object} map[string]interface{} "Payment gateways"
+// @Router /payment/gateways [get]
+func (h *PaymentHandler) GetGateways(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    h.paymentService.GetGateways(),
+	})
+}
+
+// GetGatewayStatus reports whether a payment gateway is configured
+// @Summary Get payment gateway status
+// @Description Check if a payment gateway is enabled
+// @Tags Payment
+// @Produce json
+// @Param gateway path string true "Payment gateway (razorpay, cashfree, cod)"
+// @Success 200 {object} map[string]interface{} "Gateway status"
+// @Failure 404 {object} map[string]interface{} "Unknown gateway"
+// @Router /payment/{gateway}/status [get]
+func (h *PaymentHandler) GetGatewayStatus(c *gin.Context) {
+	gateway := paymentGateway(c)
+	for _, info := range h.paymentService.GetGateways() {
+		if info.Gateway == gateway {
+			c.JSON(http.StatusOK, gin.H{
+				"success": true,
+				"data":    info,
+			})
+			return
+		}
+	}
+
+	c.JSON(http.StatusNotFound, gin.H{
+		"success": false,
+		"error":   "Unknown payment gateway",
+		"code":    "UNKNOWN_GATEWAY",
+	})
+}
+
+// CreatePayment creates a payment order at the gateway
+// @Summary Create payment order
+// @Description Create a checkout session for an order at the payment gateway. /payment/create-order uses Razorpay.
+// @Tags Payment
+// @Accept json
+// @Produce json
+// @Param X-Guest-Session-ID header string false "Guest session ID for guest users"
+// @Param gateway path string true "Payment gateway (razorpay, cashfree, cod)"
+// @Param request body models.CreatePaymentRequest true "Payment order creation data"
+// @Success 200 {object} map[string]interface{} "Payment order created successfully"
+// @Failure 400 {object} map[string]interface{} "Invalid request data"
+// @Failure 404 {object} map[string]interface{} "Order not found"
+// @Failure 409 {object} map[string]interface{} "Amount does not match the order total"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /payment/{gateway}/create-order [post]
+func (h *PaymentHandler) CreatePayment(c *gin.Context) {
+	h.startPayment(c, false)
+}
+
+// CreatePaymentLink creates a hosted payment link for an order
+// @Summary Create payment link
+// @Description Create a shareable payment link for an order at the payment gateway
+// @Tags Payment
+// @Accept json
+// @Produce json
+// @Param X-Guest-Session-ID header string false "Guest session ID for guest users"
+// @Param gateway path string true "Payment gateway (razorpay, cashfree)"
+// @Param request body models.CreatePaymentRequest true "Payment link creation data"
+// @Success 200 {object} map[string]interface{} "Payment link created"
+// @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Failure 404 {object} map[string]interface{} "Order not found"
+// @Failure 409 {object} map[string]interface{} "Amount does not match the order total"
+// @Failure 500 {object} map[string]interface{} "Failed to create link"
+// @Router /payment/{gateway}/create-link [post]
+func (h *PaymentHandler) CreatePaymentLink(c *gin.Context) {
+	h.startPayment(c, true)
+}
+
+func (h *PaymentHandler) startPayment(c *gin.Context, link bool) {
+	var req models.CreatePaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request data",
+			"code":    "INVALID_INPUT",
+		})
+		return
+	}
+
+	var session *models.PaymentSession
+	var err error
+	if link {
+		session, err = h.paymentService.CreatePaymentLink(paymentGateway(c), customerActor(c), &req)
+	} else {
+		session, err = h.paymentService.CreatePayment(paymentGateway(c), customerActor(c), &req)
+	}
+	if err != nil {
+		if errors.Is(err, services.ErrOrderNotFound) {
+			orderNotFound(c)
+			return
+		}
+		if errors.Is(err, services.ErrPaymentAmountMismatch) {
+			c.JSON(http.StatusConflict, gin.H{
+				"success": false,
+				"error":   err.Error(),
+				"code":    "AMOUNT_MISMATCH",
+			})
+			return
+		}
+		if errors.Is(err, services.ErrGatewayOperationUnsupported) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   err.Error(),
+				"code":    "UNSUPPORTED_OPERATION",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to create payment order: " + err.Error(),
+			"code":    "PAYMENT_CREATION_FAILED",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    session,
+		"message": "Payment order created successfully",
+	})
+}
+
+// VerifyPayment verifies the checkout result and confirms the order
+// @Summary Verify payment
+// @Description Verify the result returned by the gateway checkout and confirm the order. The body carries orderId plus gateway fields, e.g. razorpayOrderId, razorpayPaymentId and razorpaySignature for Razorpay.
+// @Tags Payment
+// @Accept json
+// @Produce json
+// @Param X-Guest-Session-ID header string false "Guest session ID for guest users"
+// @Param gateway path string true "Payment gateway (razorpay, cashfree, cod)"
+// @Param request body object true "Payment verification data"
+// @Success 200 {object} map[string]interface{} "Payment verified successfully"
+// @Failure 400 {object} map[string]interface{} "Invalid payment data"
+// @Failure 404 {object} map[string]interface{} "Order not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /payment/{gateway}/verify [post]
+func (h *PaymentHandler) VerifyPayment(c *gin.Context) {
+	var body map[string]interface{}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request data",
+			"code":    "INVALID_INPUT",
+		})
+		return
+	}
+
+	params := make(map[string]string, len(body))
+	for key, value := range body {
+		if s, ok := value.(string); ok {
+			params[key] = s
+		}
+	}
+	if params["orderId"] == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Order ID is required",
+			"code":    "INVALID_INPUT",
+		})
+		return
+	}
+
+	attempt, err := h.paymentService.VerifyPayment(paymentGateway(c), params["orderId"], customerActor(c), params)
+	if err != nil {
+		if errors.Is(err, services.ErrOrderNotFound) {
+			orderNotFound(c)
+			return
+		}
+		if errors.Is(err, services.ErrInvalidPaymentSignature) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Payment verification failed",
+				"code":    "PAYMENT_VERIFICATION_FAILED",
+			})
+			return
+		}
+		log.Printf("Failed to verify payment for order %s: %v", params["orderId"], err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to verify payment: " + err.Error(),
+			"code":    "VERIFICATION_FAILED",
+		})
+		return
+	}
+
+	if attempt.Status != models.PaymentAttemptPaid {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Payment not completed",
+			"code":    "PAYMENT_NOT_COMPLETED",
+			"data":    attempt,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    attempt,
+		"message": "Payment verified and order completed successfully",
+	})
+}
+
+// GetPaymentStatus refreshes an order's payment from the gateway
+// @Summary Get payment status
+// @Description Get the current status of the order's latest payment attempt from the gateway
+// @Tags Payment
+// @Produce json
+// @Param X-Guest-Session-ID header string false "Guest session ID for guest users"
+// @Param gateway path string true "Payment gateway (razorpay, cashfree, cod)"
+// @Param orderId path string true "Order ID"
+// @Success 200 {object} map[string]interface{} "Payment status retrieved"
+// @Failure 404 {object} map[string]interface{} "Order not found"
+// @Failure 500 {object} map[string]interface{} "Failed to get status"
+// @Router /payment/{gateway}/status/{orderId} [get]
+func (h *PaymentHandler) GetPaymentStatus(c *gin.Context) {
+	attempt, err := h.paymentService.GetPaymentStatus(paymentGateway(c), c.Param("orderId"), customerActor(c))
+	if err != nil {
+		if errors.Is(err, services.ErrOrderNotFound) {
+			orderNotFound(c)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to get payment status: " + err.Error(),
+			"code":    "FETCH_FAILED",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    attempt,
+	})
+}
+
+// GetPaymentAttempts lists the payment attempts made for an order
+// @Summary Get payment attempts
+// @Description List every payment attempt made for an order, newest first
+// @Tags Payment
+// @Produce json
+// @Param X-Guest-Session-ID header string false "Guest session ID for guest users"
+// @Param orderId path string true "Order ID"
+// @Success 200 {object} map[string]interface{} "Payment attempts retrieved"
+// @Failure 404 {object} map[string]interface{} "Order not found"
+// @Router /payment/orders/{orderId}/attempts [get]
+func (h *PaymentHandler) GetPaymentAttempts(c *gin.Context) {
+	attempts, err := h.paymentService.GetPaymentAttempts(c.Param("orderId"), customerActor(c))
+	if err != nil {
+		if errors.Is(err, services.ErrOrderNotFound) {
+			orderNotFound(c)
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+			"code":    "FETCH_FAILED",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    attempts,
+	})
+}
+
+// HandleWebhook handles payment gateway webhooks
+// @Summary Handle payment webhook
+// @Description Process payment status webhooks from the gateway. /payment/webhook receives Razorpay webhooks.
+// @Tags Payment
+// @Accept json
+// @Produce json
+// @Param gateway path string true "Payment gateway (razorpay, cashfree)"
+// @Success 200 {object} map[string]interface{} "Webhook processed"
+// @Failure 400 {object} map[string]interface{} "Invalid webhook"
+// @Router /payment/{gateway}/webhook [post]
+func (h *PaymentHandler) HandleWebhook(c *gin.Context) {
+	payload, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid webhook payload",
+			"code":    "INVALID_PAYLOAD",
+		})
+		return
+	}
+
+	gateway := paymentGateway(c)
+	if err := h.paymentService.HandleWebhook(gateway, payload, c.Request.Header); err != nil {
+		log.Printf("%s webhook failed: %v", gateway, err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Webhook processing failed",
+			"code":    "WEBHOOK_FAILED",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Webhook processed successfully",
+	})
+}
+
+// ListWebhookEvents lists recorded payment webhooks
+// @Summary List payment webhook events (Admin)
+// @Description List recorded payment webhook deliveries, newest first. Payloads are omitted; fetch an event to see its payload.
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param gateway query string false "Payment gateway (razorpay, cashfree)"
+// @Param status query string false "Status (received, processing, processed, failed, rejected)"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page" default(20)
+// @Success 200 {object} map[string]interface{} "Webhook events retrieved"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /admin/payments/webhooks [get]
+func (h *PaymentHandler) ListWebhookEvents(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	filter := models.WebhookEventFilter{Page: page, Limit: limit}
+	if gateway := c.Query("gateway"); gateway != "" {
+		method := models.PaymentMethod(gateway)
+		filter.Gateway = &method
+	}
+	if status := c.Query("status"); status != "" {
+		eventStatus := models.WebhookEventStatus(status)
+		filter.Status = &eventStatus
+	}
+
+	events, total, err := h.paymentService.ListWebhookEvents(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to get webhook events",
+			"code":    "FETCH_FAILED",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"events": events,
+			"pagination": gin.H{
+				"page":       page,
+				"limit":      limit,
+				"total":      total,
+				"totalPages": (total + int64(limit) - 1) / int64(limit),
+			},
+		},
+	})
+}
+
+// GetWebhookEvent returns a recorded payment webhook with its payload
+// @Summary Get payment webhook event (Admin)
+// @Description Get a recorded payment webhook delivery including its raw payload
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Webhook event ID"
+// @Success 200 {object} map[string]interface{} "Webhook event retrieved"
+// @Failure 404 {object} map[string]interface{} "Webhook event not found"
+// @Router /admin/payments/webhooks/{id} [get]
+func (h *PaymentHandler) GetWebhookEvent(c *gin.Context) {
+	event, err := h.paymentService.GetWebhookEvent(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   err.Error(),
+			"code":    "NOT_FOUND",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    event,
+	})
+}
+
+// ReplayWebhookEvent processes a failed payment webhook again
+// @Summary Replay payment webhook event (Admin)
+// @Description Verify a failed webhook's stored payload again and process it
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Webhook event ID"
+// @Success 200 {object} map[string]interface{} "Webhook event processed"
+// @Failure 409 {object} map[string]interface{} "Webhook event has not failed"
+// @Failure 422 {object} map[string]interface{} "Webhook event failed again"
+// @Router /admin/payments/webhooks/{id}/replay [post]
+func (h *PaymentHandler) ReplayWebhookEvent(c *gin.Context) {
+	event, err := h.paymentService.ReplayWebhookEvent(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, services.ErrWebhookEventNotReplayable) {
+			c.JSON(http.StatusConflict, gin.H{
+				"success": false,
+				"error":   err.Error(),
+				"code":    "NOT_REPLAYABLE",
+			})
+			return
+		}
+		if event != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"success": false,
+				"error":   err.Error(),
+				"code":    "WEBHOOK_FAILED",
+				"data":    event,
+			})
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   err.Error(),
+			"code":    "NOT_FOUND",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    event,
+		"message": "Webhook event processed",
+	})
+}
+
+// RunReconciliation reconciles unsettled orders with the gateways now
+// @Summary Run payment reconciliation (Admin)
+// @Description Check every recent order that reached a gateway but is not paid, settle or fail it, and return the report. The same job runs daily.
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "Reconciliation report"
+// @Failure 500 {object} map[string]interface{} "Reconciliation failed"
+// @Router /admin/payments/reconciliation [post]
+func (h *PaymentHandler) RunReconciliation(c *gin.Context) {
+	report, err := h.paymentService.ReconcilePayments()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to reconcile payments: " + err.Error(),
+			"code":    "RECONCILIATION_FAILED",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    report,
+	})
+}
+
+// ListReconciliationReports lists payment reconciliation reports
+// @Summary List payment reconciliation reports (Admin)
+// @Description List reconciliation reports newest first with their counts; fetch a report for its entries
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page" default(20)
+// @Success 200 {object} map[string]interface{} "Reconciliation reports"
+// @Router /admin/payments/reconciliation [get]
+func (h *PaymentHandler) ListReconciliationReports(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	reports, total, err := h.paymentService.ListReconciliationReports(page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to get reconciliation reports",
+			"code":    "FETCH_FAILED",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"reports": reports,
+			"pagination": gin.H{
+				"page":       page,
+				"limit":      limit,
+				"total":      total,
+				"totalPages": (total + int64(limit) - 1) / int64(limit),
+			},
+		},
+	})
+}
+
+// GetReconciliationReport returns a reconciliation report with its entries
+// @Summary Get payment reconciliation report (Admin)
+// @Description Get a reconciliation report with every settled, failed, mismatched, orphan and stale payment it found
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Report ID"
+// @Success 200 {object} map[string]interface{} "Reconciliation report"
+// @Failure 404 {object} map[string]interface{} "Report not found"
+// @Router /admin/payments/reconciliation/{id} [get]
+func (h *PaymentHandler) GetReconciliationReport(c *gin.Context) {
+	report, err := h.paymentService.GetReconciliationReport(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   err.Error(),
+			"code":    "NOT_FOUND",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    report,
+	})
+}
+
+// DownloadReconciliationReport downloads a reconciliation report as CSV
+// @Summary Download payment reconciliation report (Admin)
+// @Description Download a reconciliation report's entries as CSV
+// @Tags Admin
+// @Produce text/csv
+// @Security BearerAuth
+// @Param id path string true "Report ID"
+// @Success 200 {file} file "CSV file downloaded"
+// @Failure 404 {object} map[string]interface{} "Report not found"
+// @Router /admin/payments/reconciliation/{id}/download [get]
+func (h *PaymentHandler) DownloadReconciliationReport(c *gin.Context) {
+	report, err := h.paymentService.GetReconciliationReport(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   err.Error(),
+			"code":    "NOT_FOUND",
+		})
+		return
+	}
+
+	csvData, err := h.paymentService.ReconciliationReportCSV(report)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to generate CSV",
+			"code":    "CSV_GENERATION_FAILED",
+		})
+		return
+	}
+
+	filename := "payment-reconciliation-" + report.StartedAt.Format("20060102-150405") + ".csv"
+	c.Header("Content-Disposition", "attachment; filename="+filename)
+	c.Data(http.StatusOK, "text/csv", csvData)
+}
+
+// paymentGateway reads the gateway path parameter. The original unprefixed
+// payment routes predate other gateways and stay on Razorpay.
+// orderNotFound reports an order that does not exist or belongs to another customer
+func orderNotFound(c *gin.Context) {
+	c.JSON(http.StatusNotFound, gin.H{
+		"success": false,
+		"error":   "Order not found",
+		"code":    "NOT_FOUND",
+	})
+}
+
+func paymentGateway(c *gin.Context) models.PaymentMethod {
+	if gateway := c.Param("gateway"); gateway != "" {
+		return models.PaymentMethod(gateway)
+	}
+	return models.PaymentMethodRazorpay
+}
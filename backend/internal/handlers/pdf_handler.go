@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"thyne-jewels-backend/internal/middleware"
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PDFHandler struct {
+	pdfService services.PDFService
+}
+
+func NewPDFHandler(pdfService services.PDFService) *PDFHandler {
+	return &PDFHandler{pdfService: pdfService}
+}
+
+// GetInvoicePDF returns a download link for an invoice's PDF
+// @Summary Download invoice PDF
+// @Description Render the GST tax invoice and return a presigned download link. Without S3 the PDF itself is returned.
+// @Tags Invoices
+// @Produce json
+// @Produce application/pdf
+// @Param X-Guest-Session-ID header string false "Guest session ID for guest users"
+// @Param id path string true "Invoice ID"
+// @Success 200 {object} map[string]interface{} "Download link generated"
+// @Failure 404 {object} map[string]interface{} "Invoice not found"
+// @Router /invoices/{id}/pdf [get]
+func (h *PDFHandler) GetInvoicePDF(c *gin.Context) {
+	download, err := h.pdfService.GetInvoicePDF(c.Request.Context(), c.Param("id"), documentActor(c))
+	if err != nil {
+		respondPDFError(c, err)
+		return
+	}
+	respondPDF(c, download)
+}
+
+// GetReceiptPDF returns a download link for an order's payment receipt
+// @Summary Download payment receipt
+// @Description Render the payment receipt of a paid order and return a presigned download link. Without S3 the PDF itself is returned.
+// @Tags Orders
+// @Produce json
+// @Produce application/pdf
+// @Param X-Guest-Session-ID header string false "Guest session ID for guest users"
+// @Param id path string true "Order ID"
+// @Success 200 {object} map[string]interface{} "Download link generated"
+// @Failure 404 {object} map[string]interface{} "Order not found"
+// @Failure 422 {object} map[string]interface{} "Order is not paid"
+// @Router /orders/{id}/receipt [get]
+func (h *PDFHandler) GetReceiptPDF(c *gin.Context) {
+	download, err := h.pdfService.GetReceiptPDF(c.Request.Context(), c.Param("id"), documentActor(c))
+	if err != nil {
+		respondPDFError(c, err)
+		return
+	}
+	respondPDF(c, download)
+}
+
+// GetWarrantyCardPDF returns a download link for a warranty card
+// @Summary Download warranty card
+// @Description Render the warranty card of a warranty issued on delivery and return a presigned download link. Without S3 the PDF itself is returned.
+// @Tags Warranties
+// @Produce json
+// @Produce application/pdf
+// @Param X-Guest-Session-ID header string false "Guest session ID for guest users"
+// @Param id path string true "Warranty ID"
+// @Success 200 {object} map[string]interface{} "Download link generated"
+// @Failure 404 {object} map[string]interface{} "Warranty not found"
+// @Router /warranties/{id}/card [get]
+func (h *PDFHandler) GetWarrantyCardPDF(c *gin.Context) {
+	download, err := h.pdfService.GetWarrantyCardPDF(c.Request.Context(), c.Param("id"), documentActor(c))
+	if err != nil {
+		respondPDFError(c, err)
+		return
+	}
+	respondPDF(c, download)
+}
+
+// GetCertificatePDF returns a download link for a certificate of authenticity
+// @Summary Download certificate of authenticity
+// @Description Render a certificate of authenticity with a QR code linking to its verification and return a presigned download link. Without S3 the PDF itself is returned.
+// @Tags Certificates
+// @Produce json
+// @Produce application/pdf
+// @Param X-Guest-Session-ID header string false "Guest session ID for guest users"
+// @Param id path string true "Certificate ID"
+// @Success 200 {object} map[string]interface{} "Download link generated"
+// @Failure 404 {object} map[string]interface{} "Certificate not found"
+// @Router /certificates/{id}/pdf [get]
+func (h *PDFHandler) GetCertificatePDF(c *gin.Context) {
+	download, err := h.pdfService.GetCertificatePDF(c.Request.Context(), c.Param("id"), documentActor(c))
+	if err != nil {
+		respondPDFError(c, err)
+		return
+	}
+	respondPDF(c, download)
+}
+
+// documentActor lets admins fetch any document and customers their own
+func documentActor(c *gin.Context) models.OrderActor {
+	if user, ok := middleware.GetUserFromContext(c); ok && user.IsAdmin {
+		return models.OrderActor{Type: models.OrderActorAdmin, ID: user.ID.Hex()}
+	}
+	return customerActor(c)
+}
+
+// respondPDF sends the download link, or the PDF itself when it was not stored
+func respondPDF(c *gin.Context, download *models.PDFDownload) {
+	if download.Content != nil {
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", download.Filename))
+		c.Data(http.StatusOK, "application/pdf", download.Content)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    download,
+	})
+}
+
+func respondPDFError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrDocumentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   err.Error(),
+			"code":    "NOT_FOUND",
+		})
+	case errors.Is(err, services.ErrReceiptNotAvailable):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"success": false,
+			"error":   err.Error(),
+			"code":    "RECEIPT_NOT_AVAILABLE",
+		})
+	default:
+		log.Printf("Failed to generate PDF: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to generate PDF",
+			"code":    "PDF_GENERATION_FAILED",
+		})
+	}
+}
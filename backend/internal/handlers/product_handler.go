@@ -1,13 +1,16 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"thyne-jewels-backend/internal/models"
 	"thyne-jewels-backend/internal/services"
 
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type ProductHandler struct {
@@ -34,7 +37,10 @@ func NewProductHandler(productService services.ProductService) *ProductHandler {
 // @Param sortBy query string false "Sort by field" default(popularity)
 // @Param minPrice query number false "Minimum price"
 // @Param maxPrice query number false "Maximum price"
-// @Param inStock query boolean false "Filter by stock availability"
+// @Param metalType query string false "Comma-separated metals"
+// @Param size query string false "Comma-separated ring sizes"
+// @Param inStock query boolean false "Filter by stock availability; with metalType or size, a variant with them must be in stock"
+// @Param locationId query string false "Only products in stock at the stock location, for click-and-collect"
 // @Success 200 {object} map[string]interface{} "Products retrieved successfully"
 // @Failure 500 {object} map[string]interface{} "Internal server error"
 // @Router /products [get]
@@ -69,12 +75,25 @@ func (h *ProductHandler) GetProducts(c *gin.Context) {
 		}
 	}
 
+	// Parse option filters
+	if metalType := c.Query("metalType"); metalType != "" {
+		filter.MetalType = splitQueryList(metalType)
+	}
+	if size := c.Query("size"); size != "" {
+		filter.Size = splitQueryList(size)
+	}
+
 	// Parse other filters
 	if inStockStr := c.Query("inStock"); inStockStr != "" {
 		if inStock, err := strconv.ParseBool(inStockStr); err == nil {
 			filter.InStock = &inStock
 		}
 	}
+	if locationID := c.Query("locationId"); locationID != "" {
+		if id, err := primitive.ObjectIDFromHex(locationID); err == nil {
+			filter.LocationID = &id
+		}
+	}
 
 	// Get products
 	products, total, err := h.productService.GetProducts(filter)
@@ -285,6 +304,22 @@ func (h *ProductHandler) CreateProduct(c *gin.Context) {
 	}
 
 	product, err := h.productService.CreateProduct(c.Request.Context(), &req)
+	if isPricingError(err) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+			"code":    "INVALID_WEIGHT_PRICING",
+		})
+		return
+	}
+	if errors.Is(err, services.ErrInvalidVariant) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+			"code":    "INVALID_VARIANT",
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -334,6 +369,22 @@ func (h *ProductHandler) UpdateProduct(c *gin.Context) {
 	}
 
 	product, err := h.productService.UpdateProduct(c.Request.Context(), productID, &req)
+	if isPricingError(err) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+			"code":    "INVALID_WEIGHT_PRICING",
+		})
+		return
+	}
+	if errors.Is(err, services.ErrInvalidVariant) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+			"code":    "INVALID_VARIANT",
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -391,7 +442,7 @@ func (h *ProductHandler) UpdateProductStock(c *gin.Context) {
 	}
 
 	var req struct {
-		Quantity int    `json:"quantity" binding:"required"`
+		Quantity *int   `json:"quantity" binding:"required,min=0"`
 		Reason   string `json:"reason"`
 	}
 
@@ -404,7 +455,23 @@ func (h *ProductHandler) UpdateProductStock(c *gin.Context) {
 		return
 	}
 
-	err := h.productService.UpdateProductStock(c.Request.Context(), productID, req.Quantity, req.Reason)
+	err := h.productService.UpdateProductStock(c.Request.Context(), productID, *req.Quantity, req.Reason, adminActor(c))
+	if errors.Is(err, services.ErrInvalidStockAdjustment) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+			"code":    "INVALID_STOCK_ADJUSTMENT",
+		})
+		return
+	}
+	if errors.Is(err, services.ErrInvalidVariant) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+			"code":    "INVALID_VARIANT",
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -419,3 +486,19 @@ func (h *ProductHandler) UpdateProductStock(c *gin.Context) {
 		"message": "Stock updated successfully",
 	})
 }
+
+// splitQueryList splits a comma-separated query value, dropping empty entries
+func splitQueryList(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// isPricingError reports whether a product was refused for its metal rate pricing
+func isPricingError(err error) bool {
+	return errors.Is(err, models.ErrInvalidWeightPricing) || errors.Is(err, services.ErrMetalRateNotSet)
+}
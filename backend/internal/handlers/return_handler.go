@@ -0,0 +1,489 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"thyne-jewels-backend/internal/middleware"
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ReturnHandler handles item-level return requests (RMAs)
+type ReturnHandler struct {
+	returnService services.ReturnService
+}
+
+// NewReturnHandler creates a new return handler
+func NewReturnHandler(returnService services.ReturnService) *ReturnHandler {
+	return &ReturnHandler{returnService: returnService}
+}
+
+// GetReturnEligibility shows which items of an order can still be returned
+// @Summary Get return eligibility
+// @Description Get the return deadline of a delivered order and how many units of each item can still be returned
+// @Tags Returns
+// @Produce json
+// @Param X-Guest-Session-ID header string false "Guest session ID for guest users"
+// @Param id path string true "Order ID"
+// @Success 200 {object} map[string]interface{} "Return eligibility"
+// @Failure 404 {object} map[string]interface{} "Order not found"
+// @Router /orders/{id}/returnable [get]
+func (h *ReturnHandler) GetReturnEligibility(c *gin.Context) {
+	eligibility, err := h.returnService.GetReturnEligibility(c.Param("id"), customerActor(c))
+	if err != nil {
+		respondReturnError(c, err, "FETCH_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    eligibility,
+	})
+}
+
+// CreateReturn requests the return of some units of a delivered order
+// @Summary Create return request
+// @Description Request the return of units of a delivered order, each with a reason code. Photos are added afterwards.
+// @Tags Returns
+// @Accept json
+// @Produce json
+// @Param X-Guest-Session-ID header string false "Guest session ID for guest users"
+// @Param request body models.CreateReturnRequest true "Items to return"
+// @Success 201 {object} map[string]interface{} "Return request created"
+// @Failure 400 {object} map[string]interface{} "Invalid request data"
+// @Failure 422 {object} map[string]interface{} "Items cannot be returned"
+// @Router /returns [post]
+func (h *ReturnHandler) CreateReturn(c *gin.Context) {
+	var req models.CreateReturnRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request data: " + err.Error(),
+			"code":    "INVALID_INPUT",
+		})
+		return
+	}
+
+	ret, err := h.returnService.CreateReturn(customerActor(c), &req)
+	if err != nil {
+		respondReturnError(c, err, "RETURN_CREATION_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    ret,
+		"message": "Return request submitted successfully",
+	})
+}
+
+// AddReturnPhotos uploads photos of the returned items
+// @Summary Add return photos
+// @Description Upload photos of the items (multipart field "photos", up to 5 per request) while the return awaits review
+// @Tags Returns
+// @Accept multipart/form-data
+// @Produce json
+// @Param X-Guest-Session-ID header string false "Guest session ID for guest users"
+// @Param id path string true "Return request ID"
+// @Success 200 {object} map[string]interface{} "Photos added"
+// @Failure 400 {object} map[string]interface{} "No photos provided"
+// @Failure 422 {object} map[string]interface{} "Photos cannot be added"
+// @Router /returns/{id}/photos [post]
+func (h *ReturnHandler) AddReturnPhotos(c *gin.Context) {
+	form, err := c.MultipartForm()
+	if err != nil || len(form.File["photos"]) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "No photos provided",
+			"code":    "INVALID_INPUT",
+		})
+		return
+	}
+
+	ret, err := h.returnService.AddReturnPhotos(c.Param("id"), customerActor(c), form.File["photos"])
+	if err != nil {
+		respondReturnError(c, err, "UPLOAD_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    ret,
+	})
+}
+
+// GetMyReturns lists the customer's return requests
+// @Summary Get my returns
+// @Description List the return requests of the authenticated user or guest
+// @Tags Returns
+// @Produce json
+// @Param X-Guest-Session-ID header string false "Guest session ID for guest users"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Number of items per page" default(20)
+// @Success 200 {object} map[string]interface{} "Return requests"
+// @Router /returns [get]
+func (h *ReturnHandler) GetMyReturns(c *gin.Context) {
+	userID, _ := middleware.GetUserIDFromContext(c)
+	guestSessionID := c.GetHeader("X-Guest-Session-ID")
+	page, limit := returnPagination(c)
+
+	returns, total, err := h.returnService.ListCustomerReturns(userID, guestSessionID, page, limit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+			"code":    "FETCH_FAILED",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"returns": returns,
+			"pagination": gin.H{
+				"page":       page,
+				"limit":      limit,
+				"total":      total,
+				"totalPages": (total + int64(limit) - 1) / int64(limit),
+			},
+		},
+	})
+}
+
+// GetMyReturn returns one of the customer's return requests
+// @Summary Get return request
+// @Description Get a return request with its pickup, quality check, refund and status history
+// @Tags Returns
+// @Produce json
+// @Param X-Guest-Session-ID header string false "Guest session ID for guest users"
+// @Param id path string true "Return request ID"
+// @Success 200 {object} map[string]interface{} "Return request"
+// @Failure 404 {object} map[string]interface{} "Return request not found"
+// @Router /returns/{id} [get]
+func (h *ReturnHandler) GetMyReturn(c *gin.Context) {
+	ret, err := h.returnService.GetCustomerReturn(c.Param("id"), customerActor(c))
+	if err != nil {
+		respondReturnError(c, err, "FETCH_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    ret,
+	})
+}
+
+// CancelReturn withdraws a return request before the items are received
+// @Summary Cancel return request
+// @Tags Returns
+// @Produce json
+// @Param X-Guest-Session-ID header string false "Guest session ID for guest users"
+// @Param id path string true "Return request ID"
+// @Success 200 {object} map[string]interface{} "Return request cancelled"
+// @Failure 409 {object} map[string]interface{} "Return can no longer be cancelled"
+// @Router /returns/{id}/cancel [post]
+func (h *ReturnHandler) CancelReturn(c *gin.Context) {
+	ret, err := h.returnService.CancelReturn(c.Param("id"), customerActor(c))
+	if err != nil {
+		respondReturnError(c, err, "RETURN_CANCELLATION_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    ret,
+		"message": "Return request cancelled",
+	})
+}
+
+// AdminListReturns lists return requests
+// @Summary List return requests (Admin)
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param status query string false "Filter by status"
+// @Param orderId query string false "Filter by order ID"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Number of items per page" default(20)
+// @Success 200 {object} map[string]interface{} "Return requests"
+// @Router /admin/returns [get]
+func (h *ReturnHandler) AdminListReturns(c *gin.Context) {
+	page, limit := returnPagination(c)
+
+	filter := models.ReturnFilter{Page: page, Limit: limit}
+	if status := c.Query("status"); status != "" {
+		returnStatus := models.ReturnStatus(status)
+		filter.Status = &returnStatus
+	}
+	if orderID := c.Query("orderId"); orderID != "" {
+		objID, err := primitive.ObjectIDFromHex(orderID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid order ID",
+				"code":    "INVALID_INPUT",
+			})
+			return
+		}
+		filter.OrderID = &objID
+	}
+
+	returns, total, err := h.returnService.ListReturns(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to get return requests",
+			"code":    "FETCH_FAILED",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"returns": returns,
+			"pagination": gin.H{
+				"page":       page,
+				"limit":      limit,
+				"total":      total,
+				"totalPages": (total + int64(limit) - 1) / int64(limit),
+			},
+		},
+	})
+}
+
+// AdminGetReturn returns a return request
+// @Summary Get return request (Admin)
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Return request ID"
+// @Success 200 {object} map[string]interface{} "Return request"
+// @Failure 404 {object} map[string]interface{} "Return request not found"
+// @Router /admin/returns/{id} [get]
+func (h *ReturnHandler) AdminGetReturn(c *gin.Context) {
+	ret, err := h.returnService.GetReturn(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   err.Error(),
+			"code":    "NOT_FOUND",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    ret,
+	})
+}
+
+// AdminApproveReturn approves a requested return
+// @Summary Approve return request (Admin)
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Return request ID"
+// @Success 200 {object} map[string]interface{} "Return approved"
+// @Failure 409 {object} map[string]interface{} "Return is not awaiting review"
+// @Router /admin/returns/{id}/approve [post]
+func (h *ReturnHandler) AdminApproveReturn(c *gin.Context) {
+	var req struct {
+		Note string `json:"note"`
+	}
+	_ = c.ShouldBindJSON(&req)
+
+	ret, err := h.returnService.ApproveReturn(c.Param("id"), adminActor(c), req.Note)
+	if err != nil {
+		respondReturnError(c, err, "RETURN_UPDATE_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    ret,
+		"message": "Return approved",
+	})
+}
+
+// AdminRejectReturn rejects a requested return
+// @Summary Reject return request (Admin)
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Return request ID"
+// @Success 200 {object} map[string]interface{} "Return rejected"
+// @Failure 409 {object} map[string]interface{} "Return is not awaiting review"
+// @Router /admin/returns/{id}/reject [post]
+func (h *ReturnHandler) AdminRejectReturn(c *gin.Context) {
+	var req struct {
+		Reason string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "A reason is required",
+			"code":    "INVALID_INPUT",
+		})
+		return
+	}
+
+	ret, err := h.returnService.RejectReturn(c.Param("id"), adminActor(c), req.Reason)
+	if err != nil {
+		respondReturnError(c, err, "RETURN_UPDATE_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    ret,
+		"message": "Return rejected",
+	})
+}
+
+// AdminSchedulePickup books or reschedules the pickup of an approved return
+// @Summary Schedule return pickup (Admin)
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Return request ID"
+// @Param request body models.SchedulePickupRequest true "Pickup details"
+// @Success 200 {object} map[string]interface{} "Pickup scheduled"
+// @Failure 409 {object} map[string]interface{} "Return is not approved"
+// @Router /admin/returns/{id}/pickup [post]
+func (h *ReturnHandler) AdminSchedulePickup(c *gin.Context) {
+	var req models.SchedulePickupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request data: " + err.Error(),
+			"code":    "INVALID_INPUT",
+		})
+		return
+	}
+
+	ret, err := h.returnService.SchedulePickup(c.Param("id"), adminActor(c), &req)
+	if err != nil {
+		respondReturnError(c, err, "RETURN_UPDATE_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    ret,
+		"message": "Pickup scheduled",
+	})
+}
+
+// AdminMarkReturnReceived records that the returned items reached the warehouse
+// @Summary Mark return received (Admin)
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Return request ID"
+// @Success 200 {object} map[string]interface{} "Return received"
+// @Failure 409 {object} map[string]interface{} "Return is not approved"
+// @Router /admin/returns/{id}/receive [post]
+func (h *ReturnHandler) AdminMarkReturnReceived(c *gin.Context) {
+	var req struct {
+		Note string `json:"note"`
+	}
+	_ = c.ShouldBindJSON(&req)
+
+	ret, err := h.returnService.MarkReturnReceived(c.Param("id"), adminActor(c), req.Note)
+	if err != nil {
+		respondReturnError(c, err, "RETURN_UPDATE_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    ret,
+		"message": "Return received",
+	})
+}
+
+// AdminRecordQualityCheck records the inspection and refunds accepted units
+// @Summary Record return quality check (Admin)
+// @Description Record how many units of each returned item were accepted. Accepted units are restocked and refunded; if none are accepted the return is closed.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Return request ID"
+// @Param request body models.QualityCheckRequest true "Accepted quantities"
+// @Success 200 {object} map[string]interface{} "Quality check recorded"
+// @Failure 409 {object} map[string]interface{} "Return has not been received"
+// @Router /admin/returns/{id}/quality-check [post]
+func (h *ReturnHandler) AdminRecordQualityCheck(c *gin.Context) {
+	var req models.QualityCheckRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request data: " + err.Error(),
+			"code":    "INVALID_INPUT",
+		})
+		return
+	}
+
+	ret, err := h.returnService.RecordQualityCheck(c.Param("id"), adminActor(c), &req)
+	if err != nil {
+		respondReturnError(c, err, "QUALITY_CHECK_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    ret,
+		"message": "Quality check recorded",
+	})
+}
+
+// respondReturnError maps return service errors to responses; anything
+// unrecognised is reported as a bad request with the given code
+func respondReturnError(c *gin.Context, err error, code string) {
+	status := http.StatusBadRequest
+	switch {
+	case errors.Is(err, services.ErrReturnNotFound):
+		status, code = http.StatusNotFound, "NOT_FOUND"
+	case errors.Is(err, services.ErrReturnNotAllowed):
+		status, code = http.StatusUnprocessableEntity, "RETURN_NOT_ALLOWED"
+	case errors.Is(err, models.ErrInvalidReturnStatusTransition):
+		status, code = http.StatusConflict, "INVALID_STATUS_TRANSITION"
+	}
+
+	c.JSON(status, gin.H{
+		"success": false,
+		"error":   err.Error(),
+		"code":    code,
+	})
+}
+
+// returnPagination reads the page and limit query parameters
+func returnPagination(c *gin.Context) (int, int) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	return page, limit
+}
+
+// adminActor identifies the signed-in admin
+func adminActor(c *gin.Context) models.OrderActor {
+	userID, _ := middleware.GetUserIDFromContext(c)
+	return models.OrderActor{Type: models.OrderActorAdmin, ID: userID}
+}
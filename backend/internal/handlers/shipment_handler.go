@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ShipmentHandler struct {
+	shipmentService services.ShipmentService
+}
+
+func NewShipmentHandler(shipmentService services.ShipmentService) *ShipmentHandler {
+	return &ShipmentHandler{shipmentService: shipmentService}
+}
+
+// GetCarriers lists the shipping carriers
+// @Summary List carriers (Admin)
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "Carriers retrieved"
+// @Router /admin/carriers [get]
+func (h *ShipmentHandler) GetCarriers(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    h.shipmentService.ListCarriers(),
+	})
+}
+
+// CreateShipment books a shipment for an order
+// @Summary Create shipment (Admin)
+// @Description Book a shipment with a carrier. The manual carrier takes the AWB number in the request.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Order ID"
+// @Param request body models.CreateShipmentRequest true "Shipment details"
+// @Success 201 {object} map[string]interface{} "Shipment created"
+// @Failure 409 {object} map[string]interface{} "Order already has an active shipment"
+// @Failure 422 {object} map[string]interface{} "Order cannot be shipped"
+// @Router /admin/orders/{id}/shipment [post]
+func (h *ShipmentHandler) CreateShipment(c *gin.Context) {
+	var req models.CreateShipmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request data",
+			"code":    "INVALID_INPUT",
+		})
+		return
+	}
+
+	tracking, err := h.shipmentService.CreateShipment(c.Param("id"), adminActor(c), &req)
+	if err != nil {
+		respondShipmentError(c, err, "SHIPMENT_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    tracking,
+	})
+}
+
+// GetShipment returns an order's shipment with its tracking events
+// @Summary Get shipment (Admin)
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Order ID"
+// @Success 200 {object} map[string]interface{} "Shipment retrieved"
+// @Failure 404 {object} map[string]interface{} "Shipment not found"
+// @Router /admin/orders/{id}/shipment [get]
+func (h *ShipmentHandler) GetShipment(c *gin.Context) {
+	tracking, err := h.shipmentService.GetShipment(c.Param("id"))
+	if err != nil {
+		respondShipmentError(c, err, "SHIPMENT_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    tracking,
+	})
+}
+
+// GetLabel returns the shipping label URL
+// @Summary Get shipping label (Admin)
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Order ID"
+// @Success 200 {object} map[string]interface{} "Label URL"
+// @Failure 404 {object} map[string]interface{} "Shipment not found"
+// @Router /admin/orders/{id}/shipment/label [get]
+func (h *ShipmentHandler) GetLabel(c *gin.Context) {
+	label, err := h.shipmentService.GetLabel(c.Param("id"))
+	if err != nil {
+		respondShipmentError(c, err, "LABEL_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    gin.H{"labelUrl": label},
+	})
+}
+
+// CancelShipment cancels a shipment that has not been picked up
+// @Summary Cancel shipment (Admin)
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Order ID"
+// @Success 200 {object} map[string]interface{} "Shipment cancelled"
+// @Failure 422 {object} map[string]interface{} "Shipment already picked up"
+// @Router /admin/orders/{id}/shipment/cancel [post]
+func (h *ShipmentHandler) CancelShipment(c *gin.Context) {
+	tracking, err := h.shipmentService.CancelShipment(c.Param("id"), adminActor(c))
+	if err != nil {
+		respondShipmentError(c, err, "SHIPMENT_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    tracking,
+	})
+}
+
+// RefreshTracking polls the carrier for the latest tracking events
+// @Summary Refresh tracking (Admin)
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Order ID"
+// @Success 200 {object} map[string]interface{} "Shipment with the latest events"
+// @Router /admin/orders/{id}/shipment/refresh [post]
+func (h *ShipmentHandler) RefreshTracking(c *gin.Context) {
+	tracking, err := h.shipmentService.RefreshTracking(c.Param("id"))
+	if err != nil {
+		respondShipmentError(c, err, "TRACKING_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    tracking,
+	})
+}
+
+// AddTrackingEvent records a tracking update by hand
+// @Summary Add tracking event (Admin)
+// @Description Record a tracking update, e.g. for manual shipments. Milestones move the order along.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Order ID"
+// @Param request body models.AddTrackingEventRequest true "Tracking event"
+// @Success 200 {object} map[string]interface{} "Shipment with the new event"
+// @Router /admin/orders/{id}/shipment/events [post]
+func (h *ShipmentHandler) AddTrackingEvent(c *gin.Context) {
+	var req models.AddTrackingEventRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request data",
+			"code":    "INVALID_INPUT",
+		})
+		return
+	}
+
+	tracking, err := h.shipmentService.AddTrackingEvent(c.Param("id"), adminActor(c), &req)
+	if err != nil {
+		respondShipmentError(c, err, "TRACKING_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    tracking,
+	})
+}
+
+// HandleWebhook ingests tracking events pushed by a carrier
+// @Summary Carrier tracking webhook
+// @Tags Shipping
+// @Accept json
+// @Produce json
+// @Param carrier path string true "Carrier code"
+// @Success 200 {object} map[string]interface{} "Webhook processed"
+// @Failure 400 {object} map[string]interface{} "Webhook rejected"
+// @Router /shipping/{carrier}/webhook [post]
+func (h *ShipmentHandler) HandleWebhook(c *gin.Context) {
+	payload, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid webhook payload",
+			"code":    "INVALID_PAYLOAD",
+		})
+		return
+	}
+
+	carrier := c.Param("carrier")
+	if err := h.shipmentService.HandleWebhook(carrier, payload, c.Request.Header); err != nil {
+		log.Printf("%s tracking webhook failed: %v", carrier, err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Webhook processing failed",
+			"code":    "WEBHOOK_FAILED",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Webhook processed successfully",
+	})
+}
+
+// respondShipmentError maps shipment errors to HTTP responses
+func respondShipmentError(c *gin.Context, err error, code string) {
+	status := http.StatusBadRequest
+	switch {
+	case errors.Is(err, services.ErrShipmentNotFound):
+		status, code = http.StatusNotFound, "NOT_FOUND"
+	case errors.Is(err, services.ErrShipmentExists):
+		status, code = http.StatusConflict, "SHIPMENT_EXISTS"
+	case errors.Is(err, services.ErrShipmentNotAllowed):
+		status, code = http.StatusUnprocessableEntity, "SHIPMENT_NOT_ALLOWED"
+	case errors.Is(err, services.ErrCarrierOperationUnsupported):
+		status, code = http.StatusUnprocessableEntity, "UNSUPPORTED_BY_CARRIER"
+	case errors.Is(err, models.ErrInvalidOrderStatusTransition):
+		status, code = http.StatusConflict, "INVALID_STATUS_TRANSITION"
+	}
+
+	c.JSON(status, gin.H{
+		"success": false,
+		"error":   err.Error(),
+		"code":    code,
+	})
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"net/http"
+
+	"thyne-jewels-backend/internal/middleware"
+	"thyne-jewels-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ShippingHandler struct {
+	shippingService services.ShippingService
+	cartService     services.CartService
+}
+
+func NewShippingHandler(shippingService services.ShippingService, cartService services.CartService) *ShippingHandler {
+	return &ShippingHandler{
+		shippingService: shippingService,
+		cartService:     cartService,
+	}
+}
+
+// GetQuote quotes shipping for the caller's cart
+// @Summary Shipping quote
+// @Description Quote shipping, insurance and COD for the current cart to a pincode
+// @Tags Shipping
+// @Produce json
+// @Param X-Guest-Session-ID header string false "Guest session ID for guest users"
+// @Param pincode query string true "Delivery pincode"
+// @Success 200 {object} map[string]interface{} "Shipping quote with the cart summary"
+// @Failure 400 {object} map[string]interface{} "Invalid pincode"
+// @Router /shipping/quote [get]
+func (h *ShippingHandler) GetQuote(c *gin.Context) {
+	userID, _ := middleware.GetUserIDFromContext(c)
+	guestSessionID := c.GetHeader("X-Guest-Session-ID")
+
+	cart, err := h.cartService.QuoteShipping(userID, guestSessionID, c.Query("pincode"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+			"code":    "INVALID_INPUT",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"quote":   cart.Summary.ShippingQuote,
+			"summary": cart.Summary,
+		},
+	})
+}
+
+// CheckServiceability tells whether the store delivers to a pincode
+// @Summary Pincode serviceability
+// @Description Check delivery, estimated days and COD availability for a pincode
+// @Tags Shipping
+// @Produce json
+// @Param pincode query string true "Delivery pincode"
+// @Success 200 {object} map[string]interface{} "Serviceability"
+// @Failure 400 {object} map[string]interface{} "Invalid pincode"
+// @Router /shipping/serviceability [get]
+func (h *ShippingHandler) CheckServiceability(c *gin.Context) {
+	result, err := h.shippingService.CheckServiceability(c.Request.Context(), c.Query("pincode"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+			"code":    "INVALID_INPUT",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    result,
+	})
+}
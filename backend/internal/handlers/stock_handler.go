@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// StockHandler handles the stock ledger and low-stock reporting
+type StockHandler struct {
+	stockService   services.StockService
+	productService services.ProductService
+}
+
+// NewStockHandler creates a new stock handler
+func NewStockHandler(stockService services.StockService, productService services.ProductService) *StockHandler {
+	return &StockHandler{
+		stockService:   stockService,
+		productService: productService,
+	}
+}
+
+// AdjustStock records a manual adjustment, import or write-off
+// @Summary Adjust product stock (Admin)
+// @Description Apply a manual stock change and record it in the stock ledger. Imports add units received, damage writes units off and adjustments apply a signed change. Products sold by variant are adjusted per variant.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Product ID"
+// @Param request body models.StockAdjustmentRequest true "Adjustment"
+// @Success 201 {object} map[string]interface{} "Ledger entry"
+// @Failure 400 {object} map[string]interface{} "Invalid quantity, variant or not enough stock"
+// @Router /admin/products/{id}/stock/adjustments [post]
+func (h *StockHandler) AdjustStock(c *gin.Context) {
+	var req models.StockAdjustmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request data: " + err.Error(),
+			"code":    "INVALID_INPUT",
+		})
+		return
+	}
+
+	product, err := h.productService.GetProduct(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Product not found",
+			"code":    "NOT_FOUND",
+		})
+		return
+	}
+
+	movement, err := h.stockService.AdjustStock(c.Request.Context(), product, &req, adminActor(c))
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidStockAdjustment) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   err.Error(),
+				"code":    "INVALID_STOCK_ADJUSTMENT",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to adjust stock",
+			"code":    "STOCK_UPDATE_FAILED",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    movement,
+	})
+}
+
+// ImportStock records the units received in a CSV
+// @Summary Import stock from CSV (Admin)
+// @Description Upload a CSV with a header row, a sku column (variant SKU or barcode) or a productId column with an optional variantId column, and a quantity column of units received; locationId, reference and reason columns are optional. Each row is recorded in the stock ledger as an import, and products or variants brought back into stock alert their back-in-stock subscribers. Nothing is imported unless every row is valid.
+// @Tags Admin
+// @Accept multipart/form-data
+// @Produce json
+// @Security BearerAuth
+// @Param file formData file true "CSV file of stock received"
+// @Param reference formData string false "Reference for rows without one, e.g. a purchase order number"
+// @Success 201 {object} map[string]interface{} "Ledger entries"
+// @Failure 400 {object} map[string]interface{} "Invalid CSV or rows"
+// @Router /admin/stock/import [post]
+func (h *StockHandler) ImportStock(c *gin.Context) {
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "No file uploaded",
+			"code":    "NO_FILE",
+		})
+		return
+	}
+	defer file.Close()
+
+	if !strings.HasSuffix(strings.ToLower(header.Filename), ".csv") {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Only CSV files are allowed",
+			"code":    "INVALID_FILE_TYPE",
+		})
+		return
+	}
+
+	movements, err := h.stockService.ImportStockCSV(c.Request.Context(), file, c.PostForm("reference"), adminActor(c))
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidStockAdjustment) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   err.Error(),
+				"code":    "INVALID_STOCK_ADJUSTMENT",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   err.Error(),
+			"code":    "STOCK_IMPORT_FAILED",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    movements,
+		"message": "Stock imported",
+	})
+}
+
+// GetLedger lists stock movements
+// @Summary Get stock ledger (Admin)
+// @Description List stock movements newest first: sales, cancellations and returns recorded by orders, and the adjustments, imports and write-offs entered by staff
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param productId query string false "Product ID"
+// @Param locationId query string false "Stock location ID"
+// @Param type query string false "Movement type (reserve, release, sale, cancel, return, adjust, import, damage, transfer_out, transfer_in)"
+// @Param from query string false "First day (YYYY-MM-DD)"
+// @Param to query string false "Last day (YYYY-MM-DD)"
+// @Param page query int false "Page number"
+// @Param limit query int false "Items per page"
+// @Success 200 {object} map[string]interface{} "Stock movements"
+// @Failure 400 {object} map[string]interface{} "Invalid filter"
+// @Router /admin/stock/movements [get]
+func (h *StockHandler) GetLedger(c *gin.Context) {
+	page, limit := returnPagination(c)
+	filter := models.StockLedgerFilter{
+		Type:  models.StockMovementType(c.Query("type")),
+		Page:  page,
+		Limit: limit,
+	}
+
+	if productID := c.Query("productId"); productID != "" {
+		id, err := primitive.ObjectIDFromHex(productID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid product ID",
+				"code":    "INVALID_INPUT",
+			})
+			return
+		}
+		filter.ProductID = &id
+	}
+	if locationID := c.Query("locationId"); locationID != "" {
+		id, err := primitive.ObjectIDFromHex(locationID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid location ID",
+				"code":    "INVALID_INPUT",
+			})
+			return
+		}
+		filter.LocationID = &id
+	}
+
+	if value := c.Query("from"); value != "" {
+		from, err := models.ParseIndiaDate(value)
+		if err != nil {
+			respondInvalidDateRange(c)
+			return
+		}
+		filter.From = &from
+	}
+	if value := c.Query("to"); value != "" {
+		to, err := models.ParseIndiaDate(value)
+		if err != nil || (filter.From != nil && to.Before(*filter.From)) {
+			respondInvalidDateRange(c)
+			return
+		}
+		// The range covers the whole of the last day
+		to = to.Add(24 * time.Hour)
+		filter.To = &to
+	}
+
+	movements, total, err := h.stockService.GetLedger(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to get stock movements",
+			"code":    "FETCH_FAILED",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"movements": movements,
+			"pagination": gin.H{
+				"page":       page,
+				"limit":      limit,
+				"total":      total,
+				"totalPages": (total + int64(limit) - 1) / int64(limit),
+			},
+		},
+	})
+}
+
+// GetLowStockReport lists products at or below their reorder level
+// @Summary Get low stock report (Admin)
+// @Description List stocked, available products at or below their reorder level, lowest stock first, with when their alert was raised
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "Low stock products"
+// @Router /admin/stock/low-stock [get]
+func (h *StockHandler) GetLowStockReport(c *gin.Context) {
+	report, err := h.stockService.GetLowStockReport(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to get low stock report",
+			"code":    "FETCH_FAILED",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    report,
+	})
+}
+
+// RunLowStockAlerts raises low-stock alerts now rather than at the daily run
+// @Summary Raise low stock alerts (Admin)
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "Number of alerts raised"
+// @Router /admin/stock/low-stock/alerts [post]
+func (h *StockHandler) RunLowStockAlerts(c *gin.Context) {
+	raised, err := h.stockService.RaiseLowStockAlerts(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to raise low stock alerts",
+			"code":    "ALERTS_FAILED",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    gin.H{"raised": raised},
+	})
+}
+
+func respondInvalidDateRange(c *gin.Context) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"success": false,
+		"error":   "from and to must be dates (YYYY-MM-DD), with from not after to",
+		"code":    "INVALID_DATE_RANGE",
+	})
+}
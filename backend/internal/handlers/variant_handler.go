@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// VariantHandler handles the SKUs products are sold by
+type VariantHandler struct {
+	variantService services.VariantService
+}
+
+// NewVariantHandler creates a new variant handler
+func NewVariantHandler(variantService services.VariantService) *VariantHandler {
+	return &VariantHandler{variantService: variantService}
+}
+
+// GenerateVariants creates a variant for every option combination
+// @Summary Generate product variants (Admin)
+// @Description Add a variant, with a SKU built from the prefix and its options, for every combination of the product's metals, sizes and stone colors that has none yet
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Product ID"
+// @Param request body models.GenerateVariantsRequest true "SKU prefix and starting stock"
+// @Success 201 {object} map[string]interface{} "Product with its variants"
+// @Failure 400 {object} map[string]interface{} "No options to combine, or too many combinations"
+// @Router /admin/products/{id}/variants/generate [post]
+func (h *VariantHandler) GenerateVariants(c *gin.Context) {
+	var req models.GenerateVariantsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request data: " + err.Error(),
+			"code":    "INVALID_INPUT",
+		})
+		return
+	}
+
+	product, err := h.variantService.GenerateVariants(c.Param("id"), &req)
+	if err != nil {
+		respondVariantError(c, err, "VARIANT_CREATION_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    product,
+		"message": "Variants generated",
+	})
+}
+
+// CreateVariant adds one variant to a product
+// @Summary Add product variant (Admin)
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Product ID"
+// @Param request body models.CreateVariantRequest true "Variant"
+// @Success 201 {object} map[string]interface{} "Variant added"
+// @Failure 400 {object} map[string]interface{} "Unknown option, repeated options or SKU in use"
+// @Router /admin/products/{id}/variants [post]
+func (h *VariantHandler) CreateVariant(c *gin.Context) {
+	var req models.CreateVariantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request data: " + err.Error(),
+			"code":    "INVALID_INPUT",
+		})
+		return
+	}
+
+	variant, err := h.variantService.CreateVariant(c.Param("id"), &req)
+	if err != nil {
+		respondVariantError(c, err, "VARIANT_CREATION_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    variant,
+		"message": "Variant added",
+	})
+}
+
+// UpdateVariant changes a variant's codes, price, weight, stock or status
+// @Summary Update product variant (Admin)
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Product ID"
+// @Param variantId path string true "Variant ID"
+// @Param request body models.UpdateVariantRequest true "Changes"
+// @Success 200 {object} map[string]interface{} "Variant updated"
+// @Router /admin/products/{id}/variants/{variantId} [put]
+func (h *VariantHandler) UpdateVariant(c *gin.Context) {
+	var req models.UpdateVariantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request data: " + err.Error(),
+			"code":    "INVALID_INPUT",
+		})
+		return
+	}
+
+	variant, err := h.variantService.UpdateVariant(c.Param("id"), c.Param("variantId"), &req, adminActor(c))
+	if err != nil {
+		respondVariantError(c, err, "VARIANT_UPDATE_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    variant,
+	})
+}
+
+// DeleteVariant removes a variant
+// @Summary Delete product variant (Admin)
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Product ID"
+// @Param variantId path string true "Variant ID"
+// @Success 200 {object} map[string]interface{} "Variant deleted"
+// @Router /admin/products/{id}/variants/{variantId} [delete]
+func (h *VariantHandler) DeleteVariant(c *gin.Context) {
+	if err := h.variantService.DeleteVariant(c.Param("id"), c.Param("variantId")); err != nil {
+		respondVariantError(c, err, "VARIANT_DELETE_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Variant deleted",
+	})
+}
+
+// LookupCode finds a variant by SKU or barcode
+// @Summary Look up a SKU or barcode (Admin)
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param code path string true "SKU or barcode"
+// @Success 200 {object} map[string]interface{} "Product and variant"
+// @Failure 404 {object} map[string]interface{} "No variant has the code"
+// @Router /admin/skus/{code} [get]
+func (h *VariantHandler) LookupCode(c *gin.Context) {
+	lookup, err := h.variantService.LookupCode(c.Param("code"))
+	if err != nil {
+		respondVariantError(c, err, "FETCH_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    lookup,
+	})
+}
+
+func respondVariantError(c *gin.Context, err error, code string) {
+	status := http.StatusBadRequest
+	switch {
+	case errors.Is(err, services.ErrInventoryNotFound):
+		status, code = http.StatusNotFound, "NOT_FOUND"
+	case errors.Is(err, services.ErrInvalidVariant):
+		code = "INVALID_VARIANT"
+	}
+
+	c.JSON(status, gin.H{
+		"success": false,
+		"error":   err.Error(),
+		"code":    code,
+	})
+}
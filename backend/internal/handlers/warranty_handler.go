@@ -0,0 +1,377 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"thyne-jewels-backend/internal/middleware"
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// WarrantyHandler handles warranties issued on delivery and the claims made under them
+type WarrantyHandler struct {
+	warrantyService services.WarrantyService
+}
+
+// NewWarrantyHandler creates a new warranty handler
+func NewWarrantyHandler(warrantyService services.WarrantyService) *WarrantyHandler {
+	return &WarrantyHandler{warrantyService: warrantyService}
+}
+
+// GetMyWarranties lists the customer's warranties
+// @Summary Get my warranties
+// @Description List the warranties issued on the delivered orders of the authenticated user or guest
+// @Tags Warranties
+// @Produce json
+// @Param X-Guest-Session-ID header string false "Guest session ID for guest users"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Number of items per page" default(20)
+// @Success 200 {object} map[string]interface{} "Warranties"
+// @Router /warranties [get]
+func (h *WarrantyHandler) GetMyWarranties(c *gin.Context) {
+	userID, _ := middleware.GetUserIDFromContext(c)
+	guestSessionID := c.GetHeader("X-Guest-Session-ID")
+	page, limit := returnPagination(c)
+
+	warranties, total, err := h.warrantyService.ListCustomerWarranties(userID, guestSessionID, page, limit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+			"code":    "FETCH_FAILED",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"warranties": warranties,
+			"pagination": gin.H{
+				"page":       page,
+				"limit":      limit,
+				"total":      total,
+				"totalPages": (total + int64(limit) - 1) / int64(limit),
+			},
+		},
+	})
+}
+
+// GetMyWarranty returns one of the customer's warranties
+// @Summary Get warranty
+// @Description Get a warranty with its coverage and the claims used so far
+// @Tags Warranties
+// @Produce json
+// @Param X-Guest-Session-ID header string false "Guest session ID for guest users"
+// @Param id path string true "Warranty ID"
+// @Success 200 {object} map[string]interface{} "Warranty"
+// @Failure 404 {object} map[string]interface{} "Warranty not found"
+// @Router /warranties/{id} [get]
+func (h *WarrantyHandler) GetMyWarranty(c *gin.Context) {
+	warranty, err := h.warrantyService.GetCustomerWarranty(c.Param("id"), customerActor(c))
+	if err != nil {
+		respondWarrantyError(c, err, "FETCH_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    warranty,
+	})
+}
+
+// GetWarrantyClaims lists the claims made under one of the customer's warranties
+// @Summary Get warranty claims
+// @Tags Warranties
+// @Produce json
+// @Param X-Guest-Session-ID header string false "Guest session ID for guest users"
+// @Param id path string true "Warranty ID"
+// @Success 200 {object} map[string]interface{} "Warranty claims"
+// @Failure 404 {object} map[string]interface{} "Warranty not found"
+// @Router /warranties/{id}/claims [get]
+func (h *WarrantyHandler) GetWarrantyClaims(c *gin.Context) {
+	claims, err := h.warrantyService.GetWarrantyClaims(c.Param("id"), customerActor(c))
+	if err != nil {
+		respondWarrantyError(c, err, "FETCH_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    claims,
+	})
+}
+
+// CreateClaim makes a claim under one of the customer's warranties
+// @Summary Create warranty claim
+// @Description Claim under an active warranty against one of its coverage types. Photos are added afterwards.
+// @Tags Warranties
+// @Accept json
+// @Produce json
+// @Param X-Guest-Session-ID header string false "Guest session ID for guest users"
+// @Param id path string true "Warranty ID"
+// @Param request body models.CreateWarrantyClaimRequest true "Claim details"
+// @Success 201 {object} map[string]interface{} "Claim submitted"
+// @Failure 400 {object} map[string]interface{} "Invalid request data"
+// @Failure 422 {object} map[string]interface{} "Warranty does not cover the claim"
+// @Router /warranties/{id}/claims [post]
+func (h *WarrantyHandler) CreateClaim(c *gin.Context) {
+	var req models.CreateWarrantyClaimRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request data: " + err.Error(),
+			"code":    "INVALID_INPUT",
+		})
+		return
+	}
+
+	claim, err := h.warrantyService.CreateClaim(c.Param("id"), customerActor(c), &req)
+	if err != nil {
+		respondWarrantyError(c, err, "CLAIM_CREATION_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    claim,
+		"message": "Warranty claim submitted successfully",
+	})
+}
+
+// AddClaimPhotos uploads photos of the piece being claimed for
+// @Summary Add warranty claim photos
+// @Description Upload photos of the piece (multipart field "photos", up to 5 per claim) while the claim awaits review
+// @Tags Warranties
+// @Accept multipart/form-data
+// @Produce json
+// @Param X-Guest-Session-ID header string false "Guest session ID for guest users"
+// @Param id path string true "Warranty ID"
+// @Param claimId path string true "Claim ID"
+// @Success 200 {object} map[string]interface{} "Photos added"
+// @Failure 400 {object} map[string]interface{} "No photos provided"
+// @Failure 422 {object} map[string]interface{} "Photos cannot be added"
+// @Router /warranties/{id}/claims/{claimId}/photos [post]
+func (h *WarrantyHandler) AddClaimPhotos(c *gin.Context) {
+	form, err := c.MultipartForm()
+	if err != nil || len(form.File["photos"]) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "No photos provided",
+			"code":    "INVALID_INPUT",
+		})
+		return
+	}
+
+	claim, err := h.warrantyService.AddClaimPhotos(c.Param("id"), c.Param("claimId"), customerActor(c), form.File["photos"])
+	if err != nil {
+		respondWarrantyError(c, err, "UPLOAD_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    claim,
+	})
+}
+
+// AdminListClaims lists the warranty claims queue
+// @Summary List warranty claims (Admin)
+// @Description List warranty claims, oldest first
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param status query string false "Filter by status (submitted, approved, rejected, completed)"
+// @Param warrantyId query string false "Filter by warranty ID"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Number of items per page" default(20)
+// @Success 200 {object} map[string]interface{} "Warranty claims"
+// @Router /admin/warranty-claims [get]
+func (h *WarrantyHandler) AdminListClaims(c *gin.Context) {
+	page, limit := returnPagination(c)
+
+	filter := models.WarrantyClaimFilter{Status: c.Query("status"), Page: page, Limit: limit}
+	if warrantyID := c.Query("warrantyId"); warrantyID != "" {
+		objID, err := primitive.ObjectIDFromHex(warrantyID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid warranty ID",
+				"code":    "INVALID_INPUT",
+			})
+			return
+		}
+		filter.WarrantyID = &objID
+	}
+
+	claims, total, err := h.warrantyService.ListClaims(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to get warranty claims",
+			"code":    "FETCH_FAILED",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"claims": claims,
+			"pagination": gin.H{
+				"page":       page,
+				"limit":      limit,
+				"total":      total,
+				"totalPages": (total + int64(limit) - 1) / int64(limit),
+			},
+		},
+	})
+}
+
+// AdminGetClaim returns a warranty claim
+// @Summary Get warranty claim (Admin)
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Claim ID"
+// @Success 200 {object} map[string]interface{} "Warranty claim"
+// @Failure 404 {object} map[string]interface{} "Claim not found"
+// @Router /admin/warranty-claims/{id} [get]
+func (h *WarrantyHandler) AdminGetClaim(c *gin.Context) {
+	claim, err := h.warrantyService.GetClaim(c.Param("id"))
+	if err != nil {
+		respondWarrantyError(c, err, "FETCH_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    claim,
+	})
+}
+
+// AdminApproveClaim approves a submitted claim, using up one claim of its coverage
+// @Summary Approve warranty claim (Admin)
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Claim ID"
+// @Success 200 {object} map[string]interface{} "Claim approved"
+// @Failure 409 {object} map[string]interface{} "Claim is not awaiting review"
+// @Failure 422 {object} map[string]interface{} "No claims left under the coverage"
+// @Router /admin/warranty-claims/{id}/approve [post]
+func (h *WarrantyHandler) AdminApproveClaim(c *gin.Context) {
+	var req struct {
+		Note string `json:"note"`
+	}
+	_ = c.ShouldBindJSON(&req)
+
+	claim, err := h.warrantyService.ApproveClaim(c.Param("id"), adminActor(c), req.Note)
+	if err != nil {
+		respondWarrantyError(c, err, "CLAIM_UPDATE_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    claim,
+		"message": "Warranty claim approved",
+	})
+}
+
+// AdminRejectClaim rejects a submitted claim
+// @Summary Reject warranty claim (Admin)
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Claim ID"
+// @Success 200 {object} map[string]interface{} "Claim rejected"
+// @Failure 409 {object} map[string]interface{} "Claim is not awaiting review"
+// @Router /admin/warranty-claims/{id}/reject [post]
+func (h *WarrantyHandler) AdminRejectClaim(c *gin.Context) {
+	var req struct {
+		Reason string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "A reason is required",
+			"code":    "INVALID_INPUT",
+		})
+		return
+	}
+
+	claim, err := h.warrantyService.RejectClaim(c.Param("id"), adminActor(c), req.Reason)
+	if err != nil {
+		respondWarrantyError(c, err, "CLAIM_UPDATE_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    claim,
+		"message": "Warranty claim rejected",
+	})
+}
+
+// AdminCompleteClaim records how an approved claim was resolved
+// @Summary Complete warranty claim (Admin)
+// @Description Record the resolution (repair, replace or refund) and what it cost the store
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Claim ID"
+// @Param request body models.CompleteWarrantyClaimRequest true "Resolution"
+// @Success 200 {object} map[string]interface{} "Claim completed"
+// @Failure 409 {object} map[string]interface{} "Claim is not approved"
+// @Router /admin/warranty-claims/{id}/complete [post]
+func (h *WarrantyHandler) AdminCompleteClaim(c *gin.Context) {
+	var req models.CompleteWarrantyClaimRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request data: " + err.Error(),
+			"code":    "INVALID_INPUT",
+		})
+		return
+	}
+
+	claim, err := h.warrantyService.CompleteClaim(c.Param("id"), adminActor(c), &req)
+	if err != nil {
+		respondWarrantyError(c, err, "CLAIM_UPDATE_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    claim,
+		"message": "Warranty claim completed",
+	})
+}
+
+// respondWarrantyError maps warranty service errors to responses; anything
+// unrecognised is reported as a bad request with the given code
+func respondWarrantyError(c *gin.Context, err error, code string) {
+	status := http.StatusBadRequest
+	switch {
+	case errors.Is(err, services.ErrWarrantyNotFound):
+		status, code = http.StatusNotFound, "NOT_FOUND"
+	case errors.Is(err, services.ErrClaimNotAllowed):
+		status, code = http.StatusUnprocessableEntity, "CLAIM_NOT_ALLOWED"
+	case errors.Is(err, models.ErrInvalidClaimStatusTransition):
+		status, code = http.StatusConflict, "INVALID_STATUS_TRANSITION"
+	}
+
+	c.JSON(status, gin.H{
+		"success": false,
+		"error":   err.Error(),
+		"code":    code,
+	})
+}
@@ -8,6 +8,7 @@ import (
 	"thyne-jewels-backend/internal/services"
 
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // AuthRequired middleware requires authentication
@@ -190,6 +191,46 @@ func AdminRequired(authService services.AuthService) gin.HandlerFunc {
 	}
 }
 
+// LocationStaffRequired middleware requires the user to work at the location
+// in the :locationId route parameter. Admins work at every location.
+func LocationStaffRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := GetUserFromContext(c)
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"error":   "Authentication required",
+				"code":    "UNAUTHORIZED",
+			})
+			c.Abort()
+			return
+		}
+
+		locationID, err := primitive.ObjectIDFromHex(c.Param("locationId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid location ID",
+				"code":    "INVALID_INPUT",
+			})
+			c.Abort()
+			return
+		}
+
+		if !user.WorksAt(locationID) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"success": false,
+				"error":   "You do not work at this location",
+				"code":    "FORBIDDEN",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
 // GetUserFromContext extracts user from context
 func GetUserFromContext(c *gin.Context) (*models.User, bool) {
 	userInterface, exists := c.Get("user")
@@ -113,6 +113,7 @@ type LowStockProduct struct {
 	CurrentStock  int                `json:"currentStock"`
 	MinimumStock  int                `json:"minimumStock"`
 	Price         float64            `json:"price"`
+	AlertedAt     *time.Time         `json:"alertedAt,omitempty"` // When the low-stock alert was raised
 }
 
 // MonthlyRevenue represents monthly revenue data
@@ -291,6 +292,13 @@ type AdminNotification struct {
 	ReadAt      *time.Time         `json:"readAt,omitempty" bson:"readAt,omitempty"`
 }
 
+// AdminNotificationFilter pages through admin notifications, newest first
+type AdminNotificationFilter struct {
+	UnreadOnly bool `json:"unreadOnly,omitempty"`
+	Page       int  `json:"page"`
+	Limit      int  `json:"limit"`
+}
+
 // Constants for admin operations
 const (
 	// Audit actions
@@ -304,7 +304,8 @@ type PriceEstimate struct {
 // Custom build fee (fixed)
 const CustomBuildFee float64 = 2000.0
 
-// Base metal prices per gram (approximate market rates in INR)
+// Base metal prices per gram (approximate market rates in INR), used when no
+// live metal rate has been set
 var MetalPrices = map[MetalType]float64{
 	MetalTypeGold14K:   4500,
 	MetalTypeGold18K:   5800,
@@ -315,6 +316,18 @@ var MetalPrices = map[MetalType]float64{
 	MetalTypeWhiteGold: 5600,
 }
 
+// MetalRateCodes maps each metal type to the metal code whose live rate prices
+// it. Rose and white gold are priced as 18K.
+var MetalRateCodes = map[MetalType]string{
+	MetalTypeGold14K:   "G14K",
+	MetalTypeGold18K:   "G18K",
+	MetalTypeGold22K:   "G22K",
+	MetalTypeSilver:    "S925",
+	MetalTypePlatinum:  "PT950",
+	MetalTypeRoseGold:  "G18K",
+	MetalTypeWhiteGold: "G18K",
+}
+
 // Estimated weights by jewelry type (in grams)
 var EstimatedWeights = map[JewelryType]struct{ Min, Max float64 }{
 	JewelryTypeRing:     {2.0, 8.0},
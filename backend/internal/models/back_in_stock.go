@@ -0,0 +1,109 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// BackInStockChannel is how a back-in-stock alert is delivered
+type BackInStockChannel string
+
+const (
+	BackInStockChannelPush     BackInStockChannel = "push"
+	BackInStockChannelSMS      BackInStockChannel = "sms"
+	BackInStockChannelWhatsApp BackInStockChannel = "whatsapp"
+	BackInStockChannelEmail    BackInStockChannel = "email"
+)
+
+// BackInStockStatus tracks a subscription from sign-up to alert
+type BackInStockStatus string
+
+const (
+	BackInStockActive    BackInStockStatus = "active"
+	BackInStockNotified  BackInStockStatus = "notified"
+	BackInStockCancelled BackInStockStatus = "cancelled"
+)
+
+// BackInStockSource records how a subscription was made
+type BackInStockSource string
+
+const (
+	BackInStockSourceRequest  BackInStockSource = "request"  // Asked for on the product page
+	BackInStockSourceWishlist BackInStockSource = "wishlist" // Made at restock for a wishlisted product
+)
+
+// BackInStockSubscription asks to be told when an out-of-stock product, or
+// one of its variants, is back in stock. Subscriptions without a variant
+// follow the product's total stock. Once notified, a purchase of the product
+// by the same customer within the attribution window marks it converted.
+type BackInStockSubscription struct {
+	ID             primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	ProductID      primitive.ObjectID  `json:"productId" bson:"productId"`
+	VariantID      *primitive.ObjectID `json:"variantId,omitempty" bson:"variantId,omitempty"`
+	ProductName    string              `json:"productName" bson:"productName"`
+	SKU            string              `json:"sku,omitempty" bson:"sku,omitempty"`
+	UserID         *primitive.ObjectID `json:"userId,omitempty" bson:"userId,omitempty"`
+	GuestSessionID string              `json:"guestSessionId,omitempty" bson:"guestSessionId,omitempty"`
+	Phone          string              `json:"phone,omitempty" bson:"phone,omitempty"` // Normalized with the country code
+	Email          string              `json:"email,omitempty" bson:"email,omitempty"`
+	Channel        BackInStockChannel  `json:"channel" bson:"channel"`
+	ContactKey     string              `json:"-" bson:"contactKey"` // The user, phone or email alerts are rate limited by
+	Source         BackInStockSource   `json:"source" bson:"source"`
+	Status         BackInStockStatus   `json:"status" bson:"status"`
+	Token          string              `json:"-" bson:"token"` // Unsubscribes without signing in
+	NotifyError    string              `json:"notifyError,omitempty" bson:"notifyError,omitempty"`
+	NotifiedAt     *time.Time          `json:"notifiedAt,omitempty" bson:"notifiedAt,omitempty"`
+	ConvertedAt    *time.Time          `json:"convertedAt,omitempty" bson:"convertedAt,omitempty"`
+	ConvertedOrder string              `json:"convertedOrder,omitempty" bson:"convertedOrder,omitempty"` // Order number of the purchase
+	CancelledAt    *time.Time          `json:"cancelledAt,omitempty" bson:"cancelledAt,omitempty"`
+	CreatedAt      time.Time           `json:"createdAt" bson:"createdAt"`
+}
+
+// BackInStockRequest subscribes to a product. Signed-in users are alerted by
+// push unless they choose another channel; guests give a phone number for SMS
+// or WhatsApp, or an email address.
+type BackInStockRequest struct {
+	VariantID      string             `json:"variantId,omitempty"` // Required for products sold by variant
+	Channel        BackInStockChannel `json:"channel,omitempty" binding:"omitempty,oneof=push sms whatsapp email"`
+	Phone          string             `json:"phone,omitempty"`
+	Email          string             `json:"email,omitempty" binding:"omitempty,email"`
+	GuestSessionID string             `json:"guestSessionId,omitempty"` // Also read from the X-Guest-Session-ID header
+}
+
+// BackInStockSubscriptionResponse is returned when subscribing. The token
+// unsubscribes through DELETE /back-in-stock/:token. It is left out when the
+// contact was already subscribed by someone else.
+type BackInStockSubscriptionResponse struct {
+	BackInStockSubscription
+	Token string `json:"token,omitempty"`
+}
+
+// BackInStockFilter selects subscriptions, newest first
+type BackInStockFilter struct {
+	ProductID *primitive.ObjectID `json:"productId,omitempty"`
+	Status    BackInStockStatus   `json:"status,omitempty"`
+	Channel   BackInStockChannel  `json:"channel,omitempty"`
+	Page      int                 `json:"page"`
+	Limit     int                 `json:"limit"`
+}
+
+// BackInStockChannelStats counts subscriptions for one channel
+type BackInStockChannelStats struct {
+	Channel    BackInStockChannel `json:"channel" bson:"_id"`
+	Subscribed int64              `json:"subscribed" bson:"subscribed"`
+	Active     int64              `json:"active" bson:"active"`
+	Notified   int64              `json:"notified" bson:"notified"`
+	Converted  int64              `json:"converted" bson:"converted"`
+}
+
+// BackInStockStats reports how back-in-stock alerts turn into purchases.
+// ConversionRate is the percentage of notified subscriptions that converted.
+type BackInStockStats struct {
+	Subscribed     int64                     `json:"subscribed"`
+	Active         int64                     `json:"active"`
+	Notified       int64                     `json:"notified"`
+	Converted      int64                     `json:"converted"`
+	ConversionRate float64                   `json:"conversionRate"`
+	ByChannel      []BackInStockChannelStats `json:"byChannel"`
+}
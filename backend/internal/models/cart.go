@@ -17,19 +17,26 @@ type Cart struct {
 	Discount       float64           `json:"discount" bson:"discount"`
 	CreatedAt      time.Time         `json:"createdAt" bson:"createdAt"`
 	UpdatedAt      time.Time         `json:"updatedAt" bson:"updatedAt"`
+	Summary        *CartSummary      `json:"summary,omitempty" bson:"-"` // Computed on read, never stored
 }
 
-// CartItem represents an item in the cart
+// CartItem represents an item in the cart. The same product with different
+// customizations is kept as separate lines.
 type CartItem struct {
-	ProductID primitive.ObjectID `json:"productId" bson:"productId" validate:"required"`
-	Quantity  int               `json:"quantity" bson:"quantity" validate:"required,min=1"`
-	AddedAt   time.Time         `json:"addedAt" bson:"addedAt"`
+	ItemID        string                `json:"itemId" bson:"itemId"`
+	ProductID     primitive.ObjectID    `json:"productId" bson:"productId" validate:"required"`
+	VariantID     *primitive.ObjectID   `json:"variantId,omitempty" bson:"variantId,omitempty"` // Set for products sold by variant
+	Quantity      int                   `json:"quantity" bson:"quantity" validate:"required,min=1"`
+	Customization *ProductCustomization `json:"customization,omitempty" bson:"customization,omitempty"`
+	AddedAt       time.Time             `json:"addedAt" bson:"addedAt"`
 }
 
 // AddToCartRequest represents the request to add item to cart
 type AddToCartRequest struct {
-	ProductID primitive.ObjectID `json:"productId" validate:"required"`
-	Quantity  int               `json:"quantity" validate:"required,min=1,max=10"`
+	ProductID     primitive.ObjectID    `json:"productId" validate:"required"`
+	VariantID     *primitive.ObjectID   `json:"variantId,omitempty"` // Or pick the variant's options in customization
+	Quantity      int                   `json:"quantity" validate:"required,min=1,max=10"`
+	Customization *ProductCustomization `json:"customization,omitempty"`
 }
 
 // UpdateCartItemRequest represents the request to update cart item quantity
@@ -38,6 +45,9 @@ type UpdateCartItemRequest struct {
 	Quantity  int               `json:"quantity" validate:"required,min=1,max=10"`
 }
 
+// MaxCartLineQuantity is the largest quantity allowed on a single cart line
+const MaxCartLineQuantity = 10
+
 // RemoveFromCartRequest represents the request to remove item from cart
 type RemoveFromCartRequest struct {
 	ProductID primitive.ObjectID `json:"productId" validate:"required"`
@@ -90,6 +100,32 @@ type CartSummary struct {
 	Total       float64 `json:"total"`
 	ItemCount   int     `json:"itemCount"`
 	CouponCode  *string `json:"couponCode,omitempty"`
+	GSTRate      float64    `json:"gstRate"` // Effective rate across the cart's lines
+	TaxBreakdown *TaxBreakdown `json:"taxBreakdown,omitempty"`
+	CODAvailable bool       `json:"codAvailable"`
+	CODCharge    float64    `json:"codCharge"`
+	ShippingQuote *ShippingQuote `json:"shippingQuote,omitempty"`
+	Lines        []CartLine `json:"lines"`
+	Messages     []string   `json:"messages,omitempty"` // e.g. coupon no longer applies, item out of stock
+}
+
+// CartLine is a cart item priced by the server
+type CartLine struct {
+	ItemID          string                `json:"itemId"`
+	ProductID       primitive.ObjectID    `json:"productId"`
+	VariantID       *primitive.ObjectID   `json:"variantId,omitempty"`
+	SKU             string                `json:"sku,omitempty"`
+	Name            string                `json:"name"`
+	Image           string                `json:"image"`
+	Quantity        int                   `json:"quantity"`
+	UnitPrice       float64               `json:"unitPrice"`
+	OriginalPrice   float64               `json:"originalPrice"`
+	DiscountPercent int                   `json:"discountPercent"`
+	PriceSource     PriceSource           `json:"priceSource"`
+	LineTotal       float64               `json:"lineTotal"`
+	Customization   *ProductCustomization `json:"customization,omitempty"`
+	IsAvailable     bool                  `json:"isAvailable"` // False lines are excluded from totals
+	Message         string                `json:"message,omitempty"`
 }
 
 // Validate validates the cart item struct
@@ -209,27 +245,70 @@ func (c *Cart) ClearItems() {
 	c.Discount = 0
 }
 
-// AddItem adds or updates an item in the cart
-func (c *Cart) AddItem(productID primitive.ObjectID, quantity int) {
+// FindItem returns the line with the given item ID. For carts created before
+// line IDs existed, a product ID matches that product's uncustomized line.
+func (c *Cart) FindItem(id string) *CartItem {
+	for i := range c.Items {
+		if c.Items[i].ItemID == id {
+			return &c.Items[i]
+		}
+	}
+	for i := range c.Items {
+		if c.Items[i].ProductID.Hex() == id && c.Items[i].Customization.Key() == "" {
+			return &c.Items[i]
+		}
+	}
+	return nil
+}
+
+// AddItem adds quantity to the line for the product and customization,
+// creating a new line if none matches
+func (c *Cart) AddItem(productID primitive.ObjectID, customization *ProductCustomization, quantity int) *CartItem {
+	key := customization.Key()
 	for i, item := range c.Items {
-		if item.ProductID == productID {
+		if item.ProductID == productID && item.Customization.Key() == key {
 			c.Items[i].Quantity += quantity
-			return
+			return &c.Items[i]
 		}
 	}
 	c.Items = append(c.Items, CartItem{
-		ProductID: productID,
-		Quantity:  quantity,
-		AddedAt:   time.Now(),
+		ItemID:        primitive.NewObjectID().Hex(),
+		ProductID:     productID,
+		Quantity:      quantity,
+		Customization: customization,
+		AddedAt:       time.Now(),
 	})
+	return &c.Items[len(c.Items)-1]
 }
 
-// UpdateItemQuantity updates the quantity of an item in the cart
-func (c *Cart) UpdateItemQuantity(productID primitive.ObjectID, quantity int) {
-	for i, item := range c.Items {
+// ProductQuantity returns the units of a product across all of its lines
+func (c *Cart) ProductQuantity(productID primitive.ObjectID) int {
+	count := 0
+	for _, item := range c.Items {
 		if item.ProductID == productID {
+			count += item.Quantity
+		}
+	}
+	return count
+}
+
+// VariantQuantity returns the units of a variant across all of its lines
+func (c *Cart) VariantQuantity(variantID primitive.ObjectID) int {
+	count := 0
+	for _, item := range c.Items {
+		if item.VariantID != nil && *item.VariantID == variantID {
+			count += item.Quantity
+		}
+	}
+	return count
+}
+
+// UpdateItemQuantity updates the quantity of a line, removing it when quantity is zero
+func (c *Cart) UpdateItemQuantity(itemID string, quantity int) {
+	for i, item := range c.Items {
+		if item.ItemID == itemID {
 			if quantity <= 0 {
-				c.RemoveItem(productID)
+				c.RemoveItem(itemID)
 			} else {
 				c.Items[i].Quantity = quantity
 			}
@@ -238,20 +317,29 @@ func (c *Cart) UpdateItemQuantity(productID primitive.ObjectID, quantity int) {
 	}
 }
 
-// RemoveItem removes an item from the cart
-func (c *Cart) RemoveItem(productID primitive.ObjectID) {
+// RemoveItem removes a line from the cart
+func (c *Cart) RemoveItem(itemID string) {
 	for i, item := range c.Items {
-		if item.ProductID == productID {
+		if item.ItemID == itemID {
 			c.Items = append(c.Items[:i], c.Items[i+1:]...)
 			return
 		}
 	}
 }
 
-// ApplyCoupon applies a coupon to the cart
-func (c *Cart) ApplyCoupon(coupon *Coupon) {
+// EnsureItemIDs assigns line IDs to items stored before lines had IDs
+func (c *Cart) EnsureItemIDs() {
+	for i := range c.Items {
+		if c.Items[i].ItemID == "" {
+			c.Items[i].ItemID = primitive.NewObjectID().Hex()
+		}
+	}
+}
+
+// ApplyCoupon applies a coupon to the cart for the given subtotal
+func (c *Cart) ApplyCoupon(coupon *Coupon, subtotal float64) {
 	c.CouponCode = &coupon.Code
-	c.Discount = coupon.CalculateDiscount(c.GetSubtotal())
+	c.Discount = coupon.CalculateDiscount(subtotal)
 }
 
 // RemoveCoupon removes the applied coupon from the cart
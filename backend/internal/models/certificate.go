@@ -0,0 +1,135 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CertificateTypeAuthenticity is the certificate issued with every delivered piece
+const CertificateTypeAuthenticity = "authenticity"
+
+// CertificateSignatureAlgorithm is how certificate signatures are computed
+const CertificateSignatureAlgorithm = "HMAC-SHA256"
+
+// CertificateVerificationStatus is the outcome of checking a certificate
+type CertificateVerificationStatus string
+
+const (
+	// CertificateAuthentic means the number and the signature printed with it were both issued together
+	CertificateAuthentic CertificateVerificationStatus = "authentic"
+	// CertificateNumberOnly means a certificate with this number was issued, but
+	// without the signature nothing shows the piece in hand is the one it was issued for
+	CertificateNumberOnly CertificateVerificationStatus = "number_only"
+	// CertificateInvalid means the certificate or its record failed verification
+	CertificateInvalid CertificateVerificationStatus = "invalid"
+)
+
+// certificateClaims are the facts a certificate's signature covers
+type certificateClaims struct {
+	CertificateNo    string         `json:"certificateNo"`
+	CertificateType  string         `json:"certificateType"`
+	OrderNumber      string         `json:"orderNumber"`
+	LineIndex        int            `json:"lineIndex"`
+	Unit             int            `json:"unit"`
+	ProductID        string         `json:"productId"`
+	ProductName      string         `json:"productName"`
+	Serial           string         `json:"serial,omitempty"`
+	HUID             string         `json:"huid,omitempty"`
+	IssuingAuthority string         `json:"issuingAuthority"`
+	IssueDate        string         `json:"issueDate"`
+	GradingDetails   GradingDetails `json:"gradingDetails"`
+}
+
+// SigningPayload returns the bytes a certificate's signature covers. Every
+// fact printed on the certificate is included, so changing any of them breaks
+// the signature. The issue date is taken to the second because MongoDB keeps
+// only milliseconds.
+func (c *Certificate) SigningPayload() []byte {
+	payload, _ := json.Marshal(certificateClaims{
+		CertificateNo:    c.CertificateNo,
+		CertificateType:  c.CertificateType,
+		OrderNumber:      c.OrderNumber,
+		LineIndex:        c.LineIndex,
+		Unit:             c.Unit,
+		ProductID:        c.ProductID.Hex(),
+		ProductName:      c.ProductName,
+		Serial:           c.Serial,
+		HUID:             c.HUID,
+		IssuingAuthority: c.IssuingAuthority,
+		IssueDate:        c.IssueDate.UTC().Format(time.RFC3339),
+		GradingDetails:   c.GradingDetails,
+	})
+	return payload
+}
+
+// IsOwnedBy checks whether the customer actor placed the order the certificate was issued for
+func (c *Certificate) IsOwnedBy(actor OrderActor) bool {
+	if actor.Type == OrderActorAdmin {
+		return true
+	}
+	if actor.ID == "" {
+		return false
+	}
+	if !c.UserID.IsZero() {
+		return c.UserID.Hex() == actor.ID
+	}
+	return c.GuestSessionID == actor.ID
+}
+
+// CertificateVerification is the public result of checking a certificate
+// number. Checked with the signature printed on the certificate it carries
+// the facts on record so they can be compared with it, but nothing about the
+// buyer.
+type CertificateVerification struct {
+	CertificateNo    string                        `json:"certificateNo"`
+	Valid            bool                          `json:"valid"` // Only true when authentic
+	Status           CertificateVerificationStatus `json:"status"`
+	Reason           string                        `json:"reason,omitempty"` // Why the certificate is not reported valid
+	Algorithm        string                        `json:"algorithm"`
+	CertificateType  string                        `json:"certificateType,omitempty"`
+	ProductName      string                        `json:"productName,omitempty"`
+	HUID             string                        `json:"huid,omitempty"` // Compare with the hallmark laser-marked on the piece
+	IssuingAuthority string                        `json:"issuingAuthority,omitempty"`
+	IssueDate        *time.Time                    `json:"issueDate,omitempty"`
+	GradingDetails   *GradingDetails               `json:"gradingDetails,omitempty"`
+}
+
+var (
+	karatPattern    = regexp.MustCompile(`(?i)\b(\d{1,2})\s*(k|kt|karat|carat)\b`)
+	finenessPattern = regexp.MustCompile(`\b(\d{3})\b`)
+)
+
+// hallmarkFineness is the BIS hallmark fineness of the standard gold karats
+var hallmarkFineness = map[int]string{24: "999", 23: "958", 22: "916", 20: "833", 18: "750", 14: "585", 9: "375"}
+
+// MetalPurity describes the purity of a metal such as "22K Gold" or "925
+// Silver" as its karat and fineness, e.g. "22K (916)". It returns "" when the
+// purity cannot be told from the name.
+func MetalPurity(metal string) string {
+	if match := karatPattern.FindStringSubmatch(metal); match != nil {
+		karat, _ := strconv.Atoi(match[1])
+		if karat > 0 && karat <= 24 {
+			fineness, ok := hallmarkFineness[karat]
+			if !ok {
+				fineness = fmt.Sprintf("%03d", karat*1000/24)
+			}
+			return fmt.Sprintf("%dK (%s)", karat, fineness)
+		}
+	}
+	if match := finenessPattern.FindStringSubmatch(metal); match != nil {
+		return match[1]
+	}
+
+	lower := strings.ToLower(metal)
+	switch {
+	case strings.Contains(lower, "platinum"):
+		return "950"
+	case strings.Contains(lower, "sterling"):
+		return "925"
+	}
+	return ""
+}
@@ -0,0 +1,112 @@
+package models
+
+import "time"
+
+// EInvoiceSchemaVersion is the version of the NIC e-invoice schema the payloads follow
+const EInvoiceSchemaVersion = "1.1"
+
+// EInvoice is the JSON an invoice registration portal (IRP) takes to issue an
+// IRN. Field names follow the NIC e-invoice schema.
+type EInvoice struct {
+	Version    string         `json:"Version"`
+	TranDtls   EInvoiceTran   `json:"TranDtls"`
+	DocDtls    EInvoiceDoc    `json:"DocDtls"`
+	SellerDtls EInvoiceParty  `json:"SellerDtls"`
+	BuyerDtls  EInvoiceParty  `json:"BuyerDtls"`
+	ItemList   []EInvoiceItem `json:"ItemList"`
+	ValDtls    EInvoiceValues `json:"ValDtls"`
+}
+
+// EInvoiceTran describes the kind of supply
+type EInvoiceTran struct {
+	TaxSch      string `json:"TaxSch"`      // Always "GST"
+	SupTyp      string `json:"SupTyp"`      // "B2B" for registered buyers
+	RegRev      string `json:"RegRev"`      // "Y" when tax is paid under reverse charge
+	IgstOnIntra string `json:"IgstOnIntra"` // "Y" when IGST applies to an intra-state supply
+}
+
+// EInvoiceDoc identifies the invoice
+type EInvoiceDoc struct {
+	Typ string `json:"Typ"` // "INV", "CRN" or "DBN"
+	No  string `json:"No"`
+	Dt  string `json:"Dt"` // dd/mm/yyyy
+}
+
+// EInvoiceParty is the seller or the buyer
+type EInvoiceParty struct {
+	Gstin string `json:"Gstin"`
+	LglNm string `json:"LglNm"`
+	TrdNm string `json:"TrdNm,omitempty"`
+	Pos   string `json:"Pos,omitempty"` // Buyer only: state code of the place of supply
+	Addr1 string `json:"Addr1"`
+	Addr2 string `json:"Addr2,omitempty"`
+	Loc   string `json:"Loc"`
+	Pin   int    `json:"Pin"`
+	Stcd  string `json:"Stcd"`
+	Ph    string `json:"Ph,omitempty"`
+	Em    string `json:"Em,omitempty"`
+}
+
+// EInvoiceItem is one goods or service line
+type EInvoiceItem struct {
+	SlNo               string  `json:"SlNo"`
+	PrdDesc            string  `json:"PrdDesc,omitempty"`
+	IsServc            string  `json:"IsServc"` // "Y" for services (SAC codes)
+	HsnCd              string  `json:"HsnCd"`
+	Qty                float64 `json:"Qty"`
+	Unit               string  `json:"Unit,omitempty"`
+	UnitPrice          float64 `json:"UnitPrice"`
+	TotAmt             float64 `json:"TotAmt"`   // UnitPrice x Qty
+	Discount           float64 `json:"Discount"` // Line's share of the order discount
+	AssAmt             float64 `json:"AssAmt"`   // Taxable value
+	GstRt              float64 `json:"GstRt"`
+	IgstAmt            float64 `json:"IgstAmt"`
+	CgstAmt            float64 `json:"CgstAmt"`
+	SgstAmt            float64 `json:"SgstAmt"`
+	CesRt              float64 `json:"CesRt"`
+	CesAmt             float64 `json:"CesAmt"`
+	CesNonAdvlAmt      float64 `json:"CesNonAdvlAmt"`
+	StateCesRt         float64 `json:"StateCesRt"`
+	StateCesAmt        float64 `json:"StateCesAmt"`
+	StateCesNonAdvlAmt float64 `json:"StateCesNonAdvlAmt"`
+	OthChrg            float64 `json:"OthChrg"`
+	TotItemVal         float64 `json:"TotItemVal"`
+}
+
+// EInvoiceValues holds the invoice totals
+type EInvoiceValues struct {
+	AssVal    float64 `json:"AssVal"`
+	CgstVal   float64 `json:"CgstVal"`
+	SgstVal   float64 `json:"SgstVal"`
+	IgstVal   float64 `json:"IgstVal"`
+	CesVal    float64 `json:"CesVal"`
+	StCesVal  float64 `json:"StCesVal"`
+	Discount  float64 `json:"Discount"`
+	OthChrg   float64 `json:"OthChrg"` // Shipping and COD charges, which are not taxed
+	RndOffAmt float64 `json:"RndOffAmt"`
+	TotInvVal float64 `json:"TotInvVal"`
+}
+
+// EInvoiceResult is the e-invoice payload of one invoice with the schema
+// rules it breaks. Only payloads without errors should be sent to the IRP.
+type EInvoiceResult struct {
+	InvoiceID     string    `json:"invoiceId"`
+	InvoiceNumber string    `json:"invoiceNumber"`
+	Payload       *EInvoice `json:"payload"`
+	Valid         bool      `json:"valid"`
+	Errors        []string  `json:"errors,omitempty"`
+}
+
+// EInvoiceBatch holds the e-invoices of the B2B invoices raised in a date range
+type EInvoiceBatch struct {
+	From     time.Time        `json:"from"`
+	To       time.Time        `json:"to"`
+	Valid    int              `json:"valid"`
+	Invalid  int              `json:"invalid"`
+	Invoices []EInvoiceResult `json:"invoices"`
+}
+
+// EInvoiceDate formats a date the way the e-invoice schema expects, in Indian time
+func EInvoiceDate(t time.Time) string {
+	return t.In(indiaTime).Format("02/01/2006")
+}
@@ -21,6 +21,14 @@ type GuestSession struct {
 	ExpiresAt    time.Time         `json:"expiresAt" bson:"expiresAt"`
 }
 
+// GuestMergeResult summarizes what was moved from a guest session into a user account
+type GuestMergeResult struct {
+	SessionID       string `json:"sessionId"`
+	CartLinesMerged int    `json:"cartLinesMerged"`
+	RecentlyViewed  bool   `json:"recentlyViewed"`
+	OrdersAssigned  int64  `json:"ordersAssigned"`
+}
+
 // CreateGuestSessionRequest represents the request to create a guest session
 type CreateGuestSessionRequest struct {
 	Email *string `json:"email,omitempty" validate:"omitempty,email"`
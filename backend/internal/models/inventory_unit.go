@@ -0,0 +1,147 @@
+package models
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// InventoryUnitStatus tracks where a physical piece is
+type InventoryUnitStatus string
+
+const (
+	InventoryUnitInStock InventoryUnitStatus = "in_stock"
+	InventoryUnitSold    InventoryUnitStatus = "sold"    // Packed into an order
+	InventoryUnitRetired InventoryUnitStatus = "retired" // Melted, damaged or otherwise no longer for sale
+)
+
+// ErrInvalidHUID is returned for HUIDs that are not 6 letters and digits
+var ErrInvalidHUID = errors.New("HUID must be 6 letters and digits")
+
+var huidPattern = regexp.MustCompile(`^[A-Z0-9]{6}$`)
+
+// NormalizeHUID upper-cases a HUID and strips spaces, as HUIDs are read off
+// the piece or typed in by hand
+func NormalizeHUID(huid string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(huid), ""))
+}
+
+// ValidateHUID checks the shape of a BIS Hallmark Unique ID: 6 alphanumeric characters
+func ValidateHUID(huid string) error {
+	if !huidPattern.MatchString(huid) {
+		return ErrInvalidHUID
+	}
+	return nil
+}
+
+// RequiresHUID reports whether a metal must carry a HUID hallmark when sold. BIS
+// hallmarking is mandatory for gold jewellery.
+func RequiresHUID(metal string) bool {
+	return strings.Contains(strings.ToLower(metal), "gold")
+}
+
+// InventoryUnit is one physical piece of a product, identified by the store's
+// serial and, for hallmarked pieces, its HUID
+type InventoryUnit struct {
+	ID          primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	ProductID   primitive.ObjectID  `json:"productId" bson:"productId"`
+	Serial      string              `json:"serial" bson:"serial"`
+	HUID        string              `json:"huid,omitempty" bson:"huid,omitempty"`
+	GrossWeight float64             `json:"grossWeight" bson:"grossWeight"`           // Grams, including stones
+	NetWeight   float64             `json:"netWeight" bson:"netWeight"`               // Grams of metal
+	Purity      string              `json:"purity,omitempty" bson:"purity,omitempty"` // e.g. "22K (916)"
+	Status      InventoryUnitStatus `json:"status" bson:"status"`
+	OrderID     *primitive.ObjectID `json:"orderId,omitempty" bson:"orderId,omitempty"`
+	OrderNumber string              `json:"orderNumber,omitempty" bson:"orderNumber,omitempty"`
+	LineIndex   *int                `json:"lineIndex,omitempty" bson:"lineIndex,omitempty"`
+	AssignedAt  *time.Time          `json:"assignedAt,omitempty" bson:"assignedAt,omitempty"`
+	AssignedBy  *OrderActor         `json:"assignedBy,omitempty" bson:"assignedBy,omitempty"`
+	Notes       string              `json:"notes,omitempty" bson:"notes,omitempty"`
+	CreatedAt   time.Time           `json:"createdAt" bson:"createdAt"`
+	UpdatedAt   time.Time           `json:"updatedAt" bson:"updatedAt"`
+}
+
+// Assignment is the record of the unit kept on the order line it was packed into
+func (u *InventoryUnit) Assignment() AssignedUnit {
+	return AssignedUnit{
+		UnitID:      u.ID,
+		Serial:      u.Serial,
+		HUID:        u.HUID,
+		GrossWeight: u.GrossWeight,
+		NetWeight:   u.NetWeight,
+		Purity:      u.Purity,
+	}
+}
+
+// AssignedUnit is a physical piece packed into an order line. It is a copy, so
+// the order keeps the piece's details even if the unit is later restocked.
+type AssignedUnit struct {
+	UnitID      primitive.ObjectID `json:"unitId" bson:"unitId"`
+	Serial      string             `json:"serial" bson:"serial"`
+	HUID        string             `json:"huid,omitempty" bson:"huid,omitempty"`
+	GrossWeight float64            `json:"grossWeight" bson:"grossWeight"`
+	NetWeight   float64            `json:"netWeight" bson:"netWeight"`
+	Purity      string             `json:"purity,omitempty" bson:"purity,omitempty"`
+}
+
+// HUIDs lists the HUIDs of the units packed into the line
+func (item *OrderItem) HUIDs() []string {
+	var huids []string
+	for _, unit := range item.Units {
+		if unit.HUID != "" {
+			huids = append(huids, unit.HUID)
+		}
+	}
+	return huids
+}
+
+// CreateInventoryUnitRequest adds a physical piece to a product
+type CreateInventoryUnitRequest struct {
+	Serial      string  `json:"serial" binding:"required"`
+	HUID        string  `json:"huid,omitempty"`
+	GrossWeight float64 `json:"grossWeight" binding:"required,gt=0"`
+	NetWeight   float64 `json:"netWeight" binding:"required,gt=0"`
+	Purity      string  `json:"purity,omitempty"` // Defaults to the purity of the product's metal
+	Notes       string  `json:"notes,omitempty"`
+}
+
+// CreateInventoryUnitsRequest adds several pieces at once, as when a batch
+// comes back from the hallmarking centre
+type CreateInventoryUnitsRequest struct {
+	Units []CreateInventoryUnitRequest `json:"units" binding:"required,min=1,dive"`
+}
+
+// UpdateInventoryUnitRequest corrects a unit's details or takes it in or out of stock
+type UpdateInventoryUnitRequest struct {
+	Serial      *string              `json:"serial,omitempty"`
+	HUID        *string              `json:"huid,omitempty"`
+	GrossWeight *float64             `json:"grossWeight,omitempty"`
+	NetWeight   *float64             `json:"netWeight,omitempty"`
+	Purity      *string              `json:"purity,omitempty"`
+	Status      *InventoryUnitStatus `json:"status,omitempty"` // in_stock or retired
+	Notes       *string              `json:"notes,omitempty"`
+}
+
+// AssignOrderUnitsRequest records the pieces packed into an order
+type AssignOrderUnitsRequest struct {
+	Items []AssignOrderLineUnits `json:"items" binding:"required,min=1,dive"`
+}
+
+// AssignOrderLineUnits lists the pieces packed into one order line by serial
+// or HUID, one per unit ordered
+type AssignOrderLineUnits struct {
+	LineIndex int      `json:"lineIndex" binding:"min=0"`
+	Units     []string `json:"units" binding:"required,min=1"`
+}
+
+// HUIDLookup is what after-sales service sees for a HUID: the piece and the
+// orders it was sold in, newest first
+type HUIDLookup struct {
+	HUID    string         `json:"huid"`
+	Unit    *InventoryUnit `json:"unit,omitempty"`
+	Product *Product       `json:"product,omitempty"`
+	Orders  []Order        `json:"orders"`
+}
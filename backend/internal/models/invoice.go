@@ -1,6 +1,7 @@
 package models
 
 import (
+	"fmt"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -10,22 +11,32 @@ import (
 type Invoice struct {
 	ID              primitive.ObjectID `json:"id" bson:"_id,omitempty"`
 	InvoiceNumber   string            `json:"invoiceNumber" bson:"invoiceNumber" validate:"required"`
+	FinancialYear   string            `json:"financialYear,omitempty" bson:"financialYear,omitempty"` // e.g. "2025-26"; numbers run gap-free within it
+	Sequence        int64             `json:"-" bson:"sequence,omitempty"`
 	OrderID         primitive.ObjectID `json:"orderId" bson:"orderId" validate:"required"`
 	UserID          primitive.ObjectID `json:"userId" bson:"userId"`
 	GuestSessionID  string            `json:"guestSessionId,omitempty" bson:"guestSessionId,omitempty"`
+	BuyerGSTIN      string            `json:"buyerGstin,omitempty" bson:"buyerGstin,omitempty"` // Set on B2B invoices
+	BuyerLegalName  string            `json:"buyerLegalName,omitempty" bson:"buyerLegalName,omitempty"`
 	InvoiceDate     time.Time         `json:"invoiceDate" bson:"invoiceDate"`
 	DueDate         *time.Time        `json:"dueDate,omitempty" bson:"dueDate,omitempty"`
 	Status          InvoiceStatus     `json:"status" bson:"status"`
 	Subtotal        float64           `json:"subtotal" bson:"subtotal"`
 	Tax             float64           `json:"tax" bson:"tax"`
+	TaxDetails      *TaxDetails       `json:"taxDetails,omitempty" bson:"taxDetails,omitempty"`
+	TaxLines        []LineTax         `json:"taxLines,omitempty" bson:"taxLines,omitempty"`
 	Shipping        float64           `json:"shipping" bson:"shipping"`
 	Discount        float64           `json:"discount" bson:"discount"`
 	Total           float64           `json:"total" bson:"total"`
+	CreditedAmount  float64           `json:"creditedAmount,omitempty" bson:"creditedAmount,omitempty"` // Sum of the credit notes against the invoice
 	Currency        string            `json:"currency" bson:"currency"`
 	Notes           string            `json:"notes,omitempty" bson:"notes,omitempty"`
 	PDFUrl          string            `json:"pdfUrl,omitempty" bson:"pdfUrl,omitempty"`
 	IsDownloaded    bool              `json:"isDownloaded" bson:"isDownloaded"`
 	DownloadedAt    *time.Time        `json:"downloadedAt,omitempty" bson:"downloadedAt,omitempty"`
+	VoidedAt        *time.Time        `json:"voidedAt,omitempty" bson:"voidedAt,omitempty"`
+	VoidedBy        *OrderActor       `json:"voidedBy,omitempty" bson:"voidedBy,omitempty"`
+	VoidReason      string            `json:"voidReason,omitempty" bson:"voidReason,omitempty"`
 	CreatedAt       time.Time         `json:"createdAt" bson:"createdAt"`
 	UpdatedAt       time.Time         `json:"updatedAt" bson:"updatedAt"`
 }
@@ -40,8 +51,44 @@ const (
 	InvoiceStatusOverdue   InvoiceStatus = "overdue"
 	InvoiceStatusCancelled InvoiceStatus = "cancelled"
 	InvoiceStatusRefunded  InvoiceStatus = "refunded"
+	InvoiceStatusVoid      InvoiceStatus = "void" // Cancelled by the store; the number stays used
 )
 
+// Prefixes of the invoice and credit note number series
+const (
+	InvoiceSeriesPrefix    = "INV"
+	CreditNoteSeriesPrefix = "CN"
+)
+
+// indiaTime is the time zone financial years are counted in
+var indiaTime = time.FixedZone("IST", 5*60*60+30*60)
+
+// ParseIndiaDate reads a YYYY-MM-DD date as the start of that day in Indian time
+func ParseIndiaDate(value string) (time.Time, error) {
+	return time.ParseInLocation("2006-01-02", value, indiaTime)
+}
+
+// FinancialYear returns the Indian financial year (April to March) t falls in, e.g. "2025-26"
+func FinancialYear(t time.Time) string {
+	t = t.In(indiaTime)
+	start := t.Year()
+	if t.Month() < time.April {
+		start--
+	}
+	return fmt.Sprintf("%d-%02d", start, (start+1)%100)
+}
+
+// DocumentSeries names the counter of a number series in a financial year, e.g. "INV/2025-26"
+func DocumentSeries(prefix, financialYear string) string {
+	return prefix + "/" + financialYear
+}
+
+// DocumentNumber formats the number of an invoice or credit note, e.g.
+// "INV/25-26/000042". GST limits document numbers to 16 characters.
+func DocumentNumber(prefix, financialYear string, sequence int64) string {
+	return fmt.Sprintf("%s/%s/%06d", prefix, financialYear[2:], sequence)
+}
+
 // InvoiceListResponse represents the response for invoice listing
 type InvoiceListResponse struct {
 	Invoices   []Invoice `json:"invoices"`
@@ -64,6 +111,11 @@ type InvoiceFilter struct {
 	Limit          int                 `json:"limit,omitempty"`
 }
 
+// VoidInvoiceRequest is the admin's reason for voiding an invoice
+type VoidInvoiceRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
 // CreateInvoiceRequest represents the request to create an invoice
 type CreateInvoiceRequest struct {
 	OrderID string `json:"orderId" validate:"required"`
@@ -92,11 +144,27 @@ func (i *Invoice) GetDisplayStatus() string {
 		return "Cancelled"
 	case InvoiceStatusRefunded:
 		return "Refunded"
+	case InvoiceStatusVoid:
+		return "Void"
 	default:
 		return "Unknown"
 	}
 }
 
+// IsOwnedBy reports whether the invoice belongs to the customer; admins see every invoice
+func (i *Invoice) IsOwnedBy(actor OrderActor) bool {
+	if actor.Type == OrderActorAdmin {
+		return true
+	}
+	if actor.ID == "" {
+		return false
+	}
+	if !i.UserID.IsZero() {
+		return i.UserID.Hex() == actor.ID
+	}
+	return i.GuestSessionID == actor.ID
+}
+
 // MarkAsDownloaded marks the invoice as downloaded
 func (i *Invoice) MarkAsDownloaded() {
 	i.IsDownloaded = true
@@ -110,3 +178,39 @@ func (i *Invoice) UpdateStatus(status InvoiceStatus) {
 	i.Status = status
 	i.UpdatedAt = time.Now()
 }
+
+// CreditNote reduces the value of an issued invoice when money is refunded.
+// Its tax is the invoice's tax in proportion to the amount credited.
+type CreditNote struct {
+	ID               primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	CreditNoteNumber string             `json:"creditNoteNumber" bson:"creditNoteNumber,omitempty"`
+	FinancialYear    string             `json:"financialYear" bson:"financialYear"`
+	Sequence         int64              `json:"-" bson:"sequence,omitempty"`
+	InvoiceID        primitive.ObjectID `json:"invoiceId" bson:"invoiceId"`
+	InvoiceNumber    string             `json:"invoiceNumber" bson:"invoiceNumber"`
+	OrderID          primitive.ObjectID `json:"orderId" bson:"orderId"`
+	UserID           primitive.ObjectID `json:"userId" bson:"userId"`
+	GuestSessionID   string             `json:"guestSessionId,omitempty" bson:"guestSessionId,omitempty"`
+	RefundID         string             `json:"refundId" bson:"refundId"` // Refund recorded on the order
+	Reason           string             `json:"reason" bson:"reason"`
+	CreditNoteDate   time.Time          `json:"creditNoteDate" bson:"creditNoteDate"`
+	TaxableValue     float64            `json:"taxableValue" bson:"taxableValue"`
+	CGST             float64            `json:"cgst" bson:"cgst"`
+	SGST             float64            `json:"sgst" bson:"sgst"`
+	IGST             float64            `json:"igst" bson:"igst"`
+	Tax              float64            `json:"tax" bson:"tax"`
+	Total            float64            `json:"total" bson:"total"`
+	Currency         string             `json:"currency" bson:"currency"`
+	CreatedAt        time.Time          `json:"createdAt" bson:"createdAt"`
+}
+
+// CreditNoteFilter represents filters for credit note search
+type CreditNoteFilter struct {
+	InvoiceID  *primitive.ObjectID  `json:"invoiceId,omitempty"`
+	InvoiceIDs []primitive.ObjectID `json:"invoiceIds,omitempty"`
+	OrderID    *primitive.ObjectID  `json:"orderId,omitempty"`
+	DateFrom   *time.Time           `json:"dateFrom,omitempty"`
+	DateTo     *time.Time           `json:"dateTo,omitempty"`
+	Page       int                  `json:"page,omitempty"`
+	Limit      int                  `json:"limit,omitempty"`
+}
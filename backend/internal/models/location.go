@@ -0,0 +1,180 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// StockLocationType identifies what kind of premises a stock location is
+type StockLocationType string
+
+const (
+	StockLocationWarehouse StockLocationType = "warehouse"
+	StockLocationShowroom  StockLocationType = "showroom"
+)
+
+// StockLocation is a warehouse or showroom that holds stock. Orders are
+// fulfilled from a location serving the delivery pincode that has the stock,
+// then from the others in priority order. The default location holds the
+// stock entered without a location, such as product uploads.
+type StockLocation struct {
+	ID              primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Code            string             `json:"code" bson:"code"` // Short unique code, e.g. MUM-WH
+	Name            string             `json:"name" bson:"name"`
+	Type            StockLocationType  `json:"type" bson:"type"`
+	Address         string             `json:"address,omitempty" bson:"address,omitempty"`
+	City            string             `json:"city,omitempty" bson:"city,omitempty"`
+	State           string             `json:"state,omitempty" bson:"state,omitempty"`
+	Pincode         string             `json:"pincode,omitempty" bson:"pincode,omitempty"`
+	Phone           string             `json:"phone,omitempty" bson:"phone,omitempty"`
+	ServicePincodes []string           `json:"servicePincodes,omitempty" bson:"servicePincodes,omitempty"` // Pincode prefixes shipped from here first, e.g. "400" for Mumbai
+	Priority        int                `json:"priority" bson:"priority"`                                   // Lower is tried first
+	ClickAndCollect bool               `json:"clickAndCollect" bson:"clickAndCollect"`                     // Customers can collect orders here
+	IsDefault       bool               `json:"isDefault" bson:"isDefault"`
+	IsActive        bool               `json:"isActive" bson:"isActive"` // Inactive locations keep their stock but fulfil no orders
+	CreatedAt       time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt       time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
+
+// LocationStock is the stock of a product, or of one of its variants, held at a location
+type LocationStock struct {
+	LocationID primitive.ObjectID  `json:"locationId" bson:"locationId"`
+	VariantID  *primitive.ObjectID `json:"variantId,omitempty" bson:"variantId,omitempty"`
+	Quantity   int                 `json:"quantity" bson:"quantity"`
+}
+
+// CreateStockLocationRequest adds a stock location
+type CreateStockLocationRequest struct {
+	Code            string            `json:"code" binding:"required,max=20"`
+	Name            string            `json:"name" binding:"required"`
+	Type            StockLocationType `json:"type" binding:"required,oneof=warehouse showroom"`
+	Address         string            `json:"address,omitempty"`
+	City            string            `json:"city,omitempty"`
+	State           string            `json:"state,omitempty"`
+	Pincode         string            `json:"pincode,omitempty" binding:"omitempty,len=6,numeric"`
+	Phone           string            `json:"phone,omitempty"`
+	ServicePincodes []string          `json:"servicePincodes,omitempty" binding:"omitempty,dive,numeric,max=6"`
+	Priority        int               `json:"priority,omitempty"`
+	ClickAndCollect bool              `json:"clickAndCollect,omitempty"`
+	IsDefault       bool              `json:"isDefault,omitempty"` // The first location is always the default
+}
+
+// UpdateStockLocationRequest changes a stock location. Its code cannot change.
+type UpdateStockLocationRequest struct {
+	Name            *string            `json:"name,omitempty"`
+	Type            *StockLocationType `json:"type,omitempty" binding:"omitempty,oneof=warehouse showroom"`
+	Address         *string            `json:"address,omitempty"`
+	City            *string            `json:"city,omitempty"`
+	State           *string            `json:"state,omitempty"`
+	Pincode         *string            `json:"pincode,omitempty" binding:"omitempty,len=6,numeric"`
+	Phone           *string            `json:"phone,omitempty"`
+	ServicePincodes []string           `json:"servicePincodes,omitempty" binding:"omitempty,dive,numeric,max=6"` // Replaces the list when given
+	Priority        *int               `json:"priority,omitempty"`
+	ClickAndCollect *bool              `json:"clickAndCollect,omitempty"`
+	IsDefault       *bool              `json:"isDefault,omitempty"` // Only true is accepted; make another location the default instead
+	IsActive        *bool              `json:"isActive,omitempty"`
+}
+
+// AssignLocationStaffRequest sets the locations a user works at as store staff
+type AssignLocationStaffRequest struct {
+	LocationIDs []string `json:"locationIds"` // Empty removes the user's staff access
+}
+
+// LocationAvailability is the stock of a product at a click-and-collect location
+type LocationAvailability struct {
+	LocationID primitive.ObjectID `json:"locationId"`
+	Code       string             `json:"code"`
+	Name       string             `json:"name"`
+	City       string             `json:"city,omitempty"`
+	Pincode    string             `json:"pincode,omitempty"`
+	Quantity   int                `json:"quantity"`
+}
+
+// StockTransferStatus tracks stock moving between locations
+type StockTransferStatus string
+
+const (
+	StockTransferInTransit StockTransferStatus = "in_transit" // Taken out of the source location
+	StockTransferReceived  StockTransferStatus = "received"   // Put into the destination location
+	StockTransferCancelled StockTransferStatus = "cancelled"  // Put back into the source location
+)
+
+// StockTransfer moves stock from one location to another. Units leave the
+// source when the transfer is created and are not sellable until received.
+type StockTransfer struct {
+	ID             primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	TransferNumber string              `json:"transferNumber" bson:"transferNumber"`
+	FromLocationID primitive.ObjectID  `json:"fromLocationId" bson:"fromLocationId"`
+	ToLocationID   primitive.ObjectID  `json:"toLocationId" bson:"toLocationId"`
+	Items          []StockTransferItem `json:"items" bson:"items"`
+	Status         StockTransferStatus `json:"status" bson:"status"`
+	Note           string              `json:"note,omitempty" bson:"note,omitempty"`
+	CreatedBy      OrderActor          `json:"createdBy" bson:"createdBy"`
+	ClosedBy       *OrderActor         `json:"closedBy,omitempty" bson:"closedBy,omitempty"` // Who received or cancelled it
+	CreatedAt      time.Time           `json:"createdAt" bson:"createdAt"`
+	ReceivedAt     *time.Time          `json:"receivedAt,omitempty" bson:"receivedAt,omitempty"`
+	CancelledAt    *time.Time          `json:"cancelledAt,omitempty" bson:"cancelledAt,omitempty"`
+	UpdatedAt      time.Time           `json:"updatedAt" bson:"updatedAt"`
+}
+
+// StockTransferItem is the units of a product, or of one of its variants, in a transfer
+type StockTransferItem struct {
+	ProductID primitive.ObjectID  `json:"productId" bson:"productId"`
+	VariantID *primitive.ObjectID `json:"variantId,omitempty" bson:"variantId,omitempty"`
+	SKU       string              `json:"sku,omitempty" bson:"sku,omitempty"`
+	Name      string              `json:"name" bson:"name"`
+	Quantity  int                 `json:"quantity" bson:"quantity"`
+}
+
+// CreateStockTransferRequest sends stock from a location to another
+type CreateStockTransferRequest struct {
+	ToLocationID string                     `json:"toLocationId" binding:"required"`
+	Items        []StockTransferItemRequest `json:"items" binding:"required,min=1,dive"`
+	Note         string                     `json:"note,omitempty"`
+}
+
+// StockTransferItemRequest is one line of a transfer
+type StockTransferItemRequest struct {
+	ProductID string `json:"productId" binding:"required"`
+	VariantID string `json:"variantId,omitempty"` // Required for products sold by variant
+	Quantity  int    `json:"quantity" binding:"required,min=1"`
+}
+
+// StockTransferFilter selects transfers, newest first
+type StockTransferFilter struct {
+	LocationID *primitive.ObjectID `json:"locationId,omitempty"` // Sent from or to the location
+	Status     StockTransferStatus `json:"status,omitempty"`
+	Page       int                 `json:"page"`
+	Limit      int                 `json:"limit"`
+}
+
+// ServesPincode reports whether the location ships to the pincode first
+func (l *StockLocation) ServesPincode(pincode string) bool {
+	pincode = strings.TrimSpace(pincode)
+	if pincode == "" {
+		return false
+	}
+	for _, prefix := range l.ServicePincodes {
+		if prefix != "" && strings.HasPrefix(pincode, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// LocationQuantity returns the stock of the given variant held at the
+// location, or of the whole product when variantID is nil
+func (p *Product) LocationQuantity(locationID primitive.ObjectID, variantID *primitive.ObjectID) int {
+	quantity := 0
+	for _, entry := range p.LocationStock {
+		if entry.LocationID != locationID {
+			continue
+		}
+		if variantID == nil || (entry.VariantID != nil && *entry.VariantID == *variantID) {
+			quantity += entry.Quantity
+		}
+	}
+	return quantity
+}
@@ -0,0 +1,169 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MetalRateSource records how a rate was entered
+type MetalRateSource string
+
+const (
+	MetalRateSourceManual MetalRateSource = "manual"
+	MetalRateSourceCSV    MetalRateSource = "csv"
+)
+
+// MetalRate is the per-gram selling rate of a metal purity, keyed by its
+// MetalSubtype code (G22K, S925, PT950...). Rates are never edited: each change
+// adds a record, so the latest record per code is the live rate and the rest
+// are its history.
+type MetalRate struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Code        string             `json:"code" bson:"code"`
+	RatePerGram float64            `json:"ratePerGram" bson:"ratePerGram"`
+	Source      MetalRateSource    `json:"source" bson:"source"`
+	Note        string             `json:"note,omitempty" bson:"note,omitempty"`
+	SetBy       OrderActor         `json:"setBy" bson:"setBy"`
+	CreatedAt   time.Time          `json:"createdAt" bson:"createdAt"`
+}
+
+// SetMetalRateRequest sets the live rate of one metal code
+type SetMetalRateRequest struct {
+	Code        string  `json:"code" binding:"required"`
+	RatePerGram float64 `json:"ratePerGram" binding:"required,gt=0"`
+	Note        string  `json:"note,omitempty"`
+}
+
+// SetMetalRatesRequest sets several rates at once, as when the day's board rates are entered
+type SetMetalRatesRequest struct {
+	Rates []SetMetalRateRequest `json:"rates" binding:"required,min=1,dive"`
+}
+
+// MetalRateHistoryFilter pages through the rate changes of one code, or all codes
+type MetalRateHistoryFilter struct {
+	Code  string `json:"code,omitempty"`
+	Page  int    `json:"page"`
+	Limit int    `json:"limit"`
+}
+
+var metalCodePattern = regexp.MustCompile(`^[A-Z0-9]{2,10}$`)
+
+// NormalizeMetalCode upper-cases a metal code and strips spaces
+func NormalizeMetalCode(code string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(code), ""))
+}
+
+// MetalCodeFor infers the MetalSubtype code of a metal name such as "22K Gold",
+// "925 Sterling Silver" or "gold_18k". It returns "" when the purity cannot be
+// told from the name.
+func MetalCodeFor(metal string) string {
+	name := strings.ReplaceAll(metal, "_", " ")
+	lower := strings.ToLower(name)
+	switch {
+	case strings.Contains(lower, "platinum"):
+		return "PT950"
+	case strings.Contains(lower, "silver"):
+		return "S925"
+	case strings.Contains(lower, "gold"):
+		if match := karatPattern.FindStringSubmatch(name); match != nil {
+			return "G" + match[1] + "K"
+		}
+	}
+	return ""
+}
+
+// PricingMode selects how a product's price is set
+type PricingMode string
+
+const (
+	PricingModeFixed     PricingMode = "fixed"      // Price is entered by hand
+	PricingModeMetalRate PricingMode = "metal_rate" // Price follows the live metal rate
+)
+
+// MakingChargeType selects how the making charge of a weight-priced product is charged
+type MakingChargeType string
+
+const (
+	MakingChargeTypePercent MakingChargeType = "percent"  // Percent of the metal value
+	MakingChargeTypePerGram MakingChargeType = "per_gram" // Rupees per gram of metal
+)
+
+// ErrInvalidWeightPricing is returned for weight pricing that cannot produce a price
+var ErrInvalidWeightPricing = errors.New("invalid weight pricing")
+
+// WeightPricing prices a product from the live rate of its metal:
+// net weight × rate + making charge + stone value
+type WeightPricing struct {
+	MetalCode         string           `json:"metalCode" bson:"metalCode"`
+	NetWeight         float64          `json:"netWeight" bson:"netWeight"` // Grams of metal
+	MakingChargeType  MakingChargeType `json:"makingChargeType" bson:"makingChargeType"`
+	MakingChargeValue float64          `json:"makingChargeValue" bson:"makingChargeValue"` // Percent, or rupees per gram
+	StoneValue        float64          `json:"stoneValue,omitempty" bson:"stoneValue,omitempty"`
+}
+
+// Validate checks that the weight pricing can produce a price
+func (wp *WeightPricing) Validate() error {
+	if !metalCodePattern.MatchString(wp.MetalCode) {
+		return fmt.Errorf("%w: metal code %q", ErrInvalidWeightPricing, wp.MetalCode)
+	}
+	if wp.NetWeight <= 0 {
+		return fmt.Errorf("%w: net weight must be positive", ErrInvalidWeightPricing)
+	}
+	if wp.MakingChargeType != MakingChargeTypePercent && wp.MakingChargeType != MakingChargeTypePerGram {
+		return fmt.Errorf("%w: making charge type must be percent or per_gram", ErrInvalidWeightPricing)
+	}
+	if wp.MakingChargeValue < 0 || wp.StoneValue < 0 {
+		return fmt.Errorf("%w: making charge and stone value cannot be negative", ErrInvalidWeightPricing)
+	}
+	return nil
+}
+
+// Quote prices the product at a per-gram rate. Every price of a weight-priced
+// product, from the listing to the order, comes from here.
+func (wp *WeightPricing) Quote(ratePerGram float64) MetalRateQuote {
+	metalValue := roundPaise(wp.NetWeight * ratePerGram)
+
+	var making float64
+	switch wp.MakingChargeType {
+	case MakingChargeTypePerGram:
+		making = roundPaise(wp.NetWeight * wp.MakingChargeValue)
+	default:
+		making = roundPaise(metalValue * wp.MakingChargeValue / 100)
+	}
+
+	return MetalRateQuote{
+		MetalCode:    wp.MetalCode,
+		RatePerGram:  ratePerGram,
+		NetWeight:    wp.NetWeight,
+		MetalValue:   metalValue,
+		MakingCharge: making,
+		StoneValue:   wp.StoneValue,
+		Price:        roundPaise(metalValue + making + wp.StoneValue),
+	}
+}
+
+// MetalRateQuote is the breakdown of a weight-priced product's price
+type MetalRateQuote struct {
+	MetalCode    string  `json:"metalCode"`
+	RatePerGram  float64 `json:"ratePerGram"`
+	NetWeight    float64 `json:"netWeight"`
+	MetalValue   float64 `json:"metalValue"`
+	MakingCharge float64 `json:"makingCharge"`
+	StoneValue   float64 `json:"stoneValue"`
+	Price        float64 `json:"price"`
+}
+
+// IsRatePriced reports whether the product's price follows the live metal rate
+func (p *Product) IsRatePriced() bool {
+	return p.PricingMode == PricingModeMetalRate && p.WeightPricing != nil
+}
+
+func roundPaise(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
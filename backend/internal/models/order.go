@@ -1,6 +1,9 @@
 package models
 
 import (
+	"errors"
+	"fmt"
+	"math"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -21,6 +24,59 @@ const (
 	OrderStatusReturned      OrderStatus = "returned"
 )
 
+// ErrInvalidOrderStatusTransition is returned when an order cannot move to the requested status
+var ErrInvalidOrderStatusTransition = errors.New("invalid order status transition")
+
+// orderStatusTransitions lists the statuses each order status may move to.
+// Cancelled and returned orders are final.
+var orderStatusTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusPending:        {OrderStatusConfirmed, OrderStatusCancelled},
+	OrderStatusConfirmed:      {OrderStatusProcessing, OrderStatusShipped, OrderStatusCancelled},
+	OrderStatusProcessing:     {OrderStatusShipped, OrderStatusCancelled},
+	OrderStatusShipped:        {OrderStatusOutForDelivery, OrderStatusDelivered},
+	OrderStatusOutForDelivery: {OrderStatusDelivered},
+	OrderStatusDelivered:      {OrderStatusReturned},
+	OrderStatusCancelled:      {},
+	OrderStatusReturned:       {},
+}
+
+// OrderActorType identifies the kind of party that changed an order
+type OrderActorType string
+
+const (
+	OrderActorCustomer OrderActorType = "customer"
+	OrderActorAdmin    OrderActorType = "admin"
+	OrderActorSystem   OrderActorType = "system" // Payments, background jobs and carriers
+	OrderActorStaff    OrderActorType = "staff"  // Store staff at a stock location
+)
+
+// OrderActor identifies who changed an order's status
+type OrderActor struct {
+	Type OrderActorType `json:"type" bson:"type"`
+	ID   string         `json:"id,omitempty" bson:"id,omitempty"` // User ID, or guest session ID for guests
+}
+
+// OrderStatusChange is one entry of an order's append-only status history
+type OrderStatusChange struct {
+	From      OrderStatus `json:"from,omitempty" bson:"from,omitempty"`
+	To        OrderStatus `json:"to" bson:"to"`
+	Actor     OrderActor  `json:"actor" bson:"actor"`
+	Reason    string      `json:"reason,omitempty" bson:"reason,omitempty"`
+	ChangedAt time.Time   `json:"changedAt" bson:"changedAt"`
+}
+
+// OrderTimeline is the tracking view of an order: where it is and how it got there
+type OrderTimeline struct {
+	OrderID        primitive.ObjectID  `json:"orderId"`
+	OrderNumber    string              `json:"orderNumber"`
+	Status         OrderStatus         `json:"status"`
+	DisplayStatus  string              `json:"displayStatus"`
+	PaymentStatus  PaymentStatus       `json:"paymentStatus"`
+	TrackingNumber *string             `json:"trackingNumber,omitempty"`
+	Timeline       []OrderStatusChange `json:"timeline"`
+	Shipment       *OrderTracking      `json:"shipment,omitempty"` // Carrier tracking events, once shipped
+}
+
 // PaymentStatus represents the payment status
 type PaymentStatus string
 
@@ -53,15 +109,17 @@ type Order struct {
 	ShippingAddress    Address           `json:"shippingAddress" bson:"shippingAddress" validate:"required"`
 	PaymentMethod      PaymentMethod     `json:"paymentMethod" bson:"paymentMethod" validate:"required"`
 	PaymentStatus      PaymentStatus     `json:"paymentStatus" bson:"paymentStatus"`
-	RazorpayOrderID        *string           `json:"razorpayOrderId,omitempty" bson:"razorpayOrderId,omitempty"`
-	RazorpayPaymentID      *string           `json:"razorpayPaymentId,omitempty" bson:"razorpayPaymentId,omitempty"`
-	PaymentProviderOrderID *string           `json:"paymentProviderOrderId,omitempty" bson:"paymentProviderOrderId,omitempty"`
+	RazorpayOrderID        *string           `json:"razorpayOrderId,omitempty" bson:"razorpayOrderId,omitempty"`     // Legacy: orders paid before payment attempts were recorded
+	RazorpayPaymentID      *string           `json:"razorpayPaymentId,omitempty" bson:"razorpayPaymentId,omitempty"` // Legacy: orders paid before payment attempts were recorded
+	PaymentProviderOrderID *string           `json:"paymentProviderOrderId,omitempty" bson:"paymentProviderOrderId,omitempty"` // Gateway order of the latest payment attempt
 	PaymentSessionID       *string           `json:"paymentSessionId,omitempty" bson:"paymentSessionId,omitempty"`
 	Status                 OrderStatus       `json:"status" bson:"status"`
 	Subtotal           float64           `json:"subtotal" bson:"subtotal" validate:"required,min=0"`
 	Tax                float64           `json:"tax" bson:"tax" validate:"required,min=0"`
 	Shipping           float64           `json:"shipping" bson:"shipping" validate:"required,min=0"`
+	CODCharge          float64           `json:"codCharge,omitempty" bson:"codCharge,omitempty"` // Cash on delivery fee, included in the total
 	Discount           float64           `json:"discount" bson:"discount" validate:"min=0"`
+	CouponCode         *string           `json:"couponCode,omitempty" bson:"couponCode,omitempty"` // Coupon the discount was given for
 	Total              float64           `json:"total" bson:"total" validate:"required,min=0"`
 	TrackingNumber     *string           `json:"trackingNumber,omitempty" bson:"trackingNumber,omitempty"`
 	CreatedAt          time.Time         `json:"createdAt" bson:"createdAt"`
@@ -74,11 +132,21 @@ type Order struct {
 	RefundStatus       *string           `json:"refundStatus,omitempty" bson:"refundStatus,omitempty"`
 	RefundAmount       *float64          `json:"refundAmount,omitempty" bson:"refundAmount,omitempty"`
 	RefundedAt         *time.Time        `json:"refundedAt,omitempty" bson:"refundedAt,omitempty"`
+	Refunds            []PaymentRefund   `json:"refunds,omitempty" bson:"refunds,omitempty"`
+	StockStatus        StockReservationStatus `json:"stockStatus,omitempty" bson:"stockStatus,omitempty"`
+	StockReservedUntil *time.Time        `json:"stockReservedUntil,omitempty" bson:"stockReservedUntil,omitempty"`
+	FulfillmentLocationID *primitive.ObjectID `json:"fulfillmentLocationId,omitempty" bson:"fulfillmentLocationId,omitempty"` // Set when every stocked line ships from one location
+	StatusHistory      []OrderStatusChange `json:"statusHistory,omitempty" bson:"statusHistory,omitempty"`
+	TaxBreakdown       *TaxBreakdown     `json:"taxBreakdown,omitempty" bson:"taxBreakdown,omitempty"`
+	BuyerGSTIN         string            `json:"buyerGstin,omitempty" bson:"buyerGstin,omitempty"`         // Business buyers get a B2B invoice
+	BuyerLegalName     string            `json:"buyerLegalName,omitempty" bson:"buyerLegalName,omitempty"` // Registered name for the GSTIN
 }
 
 // OrderItem represents an item in an order
 type OrderItem struct {
 	ProductID       primitive.ObjectID    `json:"productId" bson:"productId" validate:"required"`
+	VariantID       *primitive.ObjectID   `json:"variantId,omitempty" bson:"variantId,omitempty"` // Variant sold, for products sold by variant
+	SKU             string                `json:"sku,omitempty" bson:"sku,omitempty"`
 	Quantity        int                   `json:"quantity" bson:"quantity" validate:"required,min=1"`
 	Price           float64               `json:"price" bson:"price" validate:"required,min=0"`
 	OriginalPrice   *float64              `json:"originalPrice,omitempty" bson:"originalPrice,omitempty"`
@@ -86,6 +154,15 @@ type OrderItem struct {
 	DiscountPercent *int                  `json:"discountPercent,omitempty" bson:"discountPercent,omitempty"`
 	Name            string                `json:"name" bson:"name" validate:"required"`
 	Image           string                `json:"image" bson:"image"`
+	Category        string                `json:"category,omitempty" bson:"category,omitempty"`         // Product category, decides the HSN code and GST rate
+	MakingCharge    float64               `json:"makingCharge,omitempty" bson:"makingCharge,omitempty"` // Part of the unit price that is making charges
+	PriceSource     PriceSource           `json:"priceSource,omitempty" bson:"priceSource,omitempty"`
+	DealID          *primitive.ObjectID   `json:"dealId,omitempty" bson:"dealId,omitempty"`
+	MetalRate       *MetalRateQuote       `json:"metalRate,omitempty" bson:"metalRate,omitempty"` // Metal rate the line was priced at, for metal_rate products
+	StockReserved   bool                  `json:"-" bson:"stockReserved,omitempty"` // Units were taken from stock for this line
+	LocationID      *primitive.ObjectID   `json:"locationId,omitempty" bson:"locationId,omitempty"` // Location the units were taken from
+	ReturnedQuantity int                  `json:"returnedQuantity,omitempty" bson:"returnedQuantity,omitempty"` // Units accepted back through return requests
+	Units           []AssignedUnit        `json:"units,omitempty" bson:"units,omitempty"` // Physical pieces packed into the line
 	// Customization details (Diamondere style)
 	Customization   *ProductCustomization `json:"customization,omitempty" bson:"customization,omitempty"`
 }
@@ -96,11 +173,14 @@ type CreateOrderRequest struct {
 	ShippingAddress Address       `json:"shippingAddress" validate:"required"`
 	PaymentMethod   PaymentMethod `json:"paymentMethod" validate:"required"`
 	CouponCode      *string       `json:"couponCode,omitempty"`
+	BuyerGSTIN      string        `json:"buyerGstin,omitempty"`
+	BuyerLegalName  string        `json:"buyerLegalName,omitempty"`
 }
 
 // UpdateOrderStatusRequest represents the request to update order status
 type UpdateOrderStatusRequest struct {
 	Status          OrderStatus   `json:"status" validate:"required"`
+	Reason          string        `json:"reason,omitempty"`
 	TrackingNumber  *string       `json:"trackingNumber,omitempty"`
 	PaymentStatus   *PaymentStatus `json:"paymentStatus,omitempty"`
 	RazorpayOrderID *string       `json:"razorpayOrderId,omitempty"`
@@ -156,15 +236,30 @@ func (r *UpdateOrderStatusRequest) Validate() error {
 
 // IsCancellable checks if the order can be cancelled
 func (o *Order) IsCancellable() bool {
-	return o.Status == OrderStatusPending || 
-		   o.Status == OrderStatusConfirmed || 
-		   o.Status == OrderStatusProcessing
+	return o.CanTransitionTo(OrderStatusCancelled)
+}
+
+// CanTransitionTo checks the transition table for a move from the current status
+func (o *Order) CanTransitionTo(status OrderStatus) bool {
+	for _, next := range orderStatusTransitions[o.Status] {
+		if next == status {
+			return true
+		}
+	}
+	return false
 }
 
-// IsRefundable checks if the order can be refunded
+// NextStatuses returns the statuses the order may move to
+func (o *Order) NextStatuses() []OrderStatus {
+	return orderStatusTransitions[o.Status]
+}
+
+// IsRefundable checks if the order can be refunded. A returned order stays
+// refundable until its whole total has been refunded.
 func (o *Order) IsRefundable() bool {
-	return o.Status == OrderStatusDelivered && 
-		   o.PaymentStatus == PaymentStatusPaid
+	return (o.Status == OrderStatusDelivered || o.Status == OrderStatusReturned) &&
+		   o.PaymentStatus == PaymentStatusPaid &&
+		   o.RefundableAmount() > 0
 }
 
 // CanBeDelivered checks if the order can be marked as delivered
@@ -238,6 +333,20 @@ func (o *Order) GetDisplayPaymentMethod() string {
 	}
 }
 
+// IsOwnedBy reports whether the order belongs to the customer; admins see every order
+func (o *Order) IsOwnedBy(actor OrderActor) bool {
+	if actor.Type == OrderActorAdmin {
+		return true
+	}
+	if actor.ID == "" {
+		return false
+	}
+	if !o.UserID.IsZero() {
+		return o.UserID.Hex() == actor.ID
+	}
+	return o.GuestSessionID == actor.ID
+}
+
 // CalculateItemTotal calculates the total for all items in the order
 func (o *Order) CalculateItemTotal() float64 {
 	total := 0.0
@@ -247,12 +356,48 @@ func (o *Order) CalculateItemTotal() float64 {
 	return total
 }
 
-// UpdateStatus updates the order status and sets appropriate timestamps
-func (o *Order) UpdateStatus(status OrderStatus) {
-	o.Status = status
-	o.UpdatedAt = time.Now()
-	
+// AppliedDealIDs returns the deal of the day ID once for every unit sold at the deal price
+func (o *Order) AppliedDealIDs() []primitive.ObjectID {
+	var ids []primitive.ObjectID
+	for _, item := range o.Items {
+		if item.DealID == nil {
+			continue
+		}
+		for i := 0; i < item.Quantity; i++ {
+			ids = append(ids, *item.DealID)
+		}
+	}
+	return ids
+}
+
+// RecordCreation starts the status history of a new order
+func (o *Order) RecordCreation(actor OrderActor) {
+	o.StatusHistory = append(o.StatusHistory, OrderStatusChange{
+		To:        o.Status,
+		Actor:     actor,
+		Reason:    "Order placed",
+		ChangedAt: o.CreatedAt,
+	})
+}
+
+// TransitionTo moves the order to a new status if the transition table allows it,
+// records the change in the status history and sets the matching timestamp
+func (o *Order) TransitionTo(status OrderStatus, actor OrderActor, reason string) error {
+	if !o.CanTransitionTo(status) {
+		return fmt.Errorf("%w: %s to %s", ErrInvalidOrderStatusTransition, o.Status, status)
+	}
+
 	now := time.Now()
+	o.StatusHistory = append(o.StatusHistory, OrderStatusChange{
+		From:      o.Status,
+		To:        status,
+		Actor:     actor,
+		Reason:    reason,
+		ChangedAt: now,
+	})
+	o.Status = status
+	o.UpdatedAt = now
+
 	switch status {
 	case OrderStatusProcessing:
 		if o.ProcessedAt == nil {
@@ -267,6 +412,60 @@ func (o *Order) UpdateStatus(status OrderStatus) {
 			o.DeliveredAt = &now
 		}
 	}
+
+	return nil
+}
+
+// Timeline returns the status history. Orders placed before the history was kept
+// get one rebuilt from their timestamps.
+func (o *Order) Timeline() []OrderStatusChange {
+	if len(o.StatusHistory) > 0 {
+		return o.StatusHistory
+	}
+
+	system := OrderActor{Type: OrderActorSystem}
+	timeline := []OrderStatusChange{{To: OrderStatusPending, Actor: system, Reason: "Order placed", ChangedAt: o.CreatedAt}}
+	add := func(status OrderStatus, at *time.Time, reason string) {
+		if at == nil {
+			return
+		}
+		timeline = append(timeline, OrderStatusChange{
+			From:      timeline[len(timeline)-1].To,
+			To:        status,
+			Actor:     system,
+			Reason:    reason,
+			ChangedAt: *at,
+		})
+	}
+	add(OrderStatusProcessing, o.ProcessedAt, "")
+	add(OrderStatusShipped, o.ShippedAt, "")
+	add(OrderStatusDelivered, o.DeliveredAt, "")
+
+	if last := timeline[len(timeline)-1].To; last != o.Status {
+		reason := ""
+		switch {
+		case o.Status == OrderStatusCancelled && o.CancellationReason != nil:
+			reason = *o.CancellationReason
+		case o.Status == OrderStatusReturned && o.ReturnReason != nil:
+			reason = *o.ReturnReason
+		}
+		add(o.Status, &o.UpdatedAt, reason)
+	}
+
+	return timeline
+}
+
+// GetTimeline returns the tracking view of the order
+func (o *Order) GetTimeline() *OrderTimeline {
+	return &OrderTimeline{
+		OrderID:        o.ID,
+		OrderNumber:    o.OrderNumber,
+		Status:         o.Status,
+		DisplayStatus:  o.GetDisplayStatus(),
+		PaymentStatus:  o.PaymentStatus,
+		TrackingNumber: o.TrackingNumber,
+		Timeline:       o.Timeline(),
+	}
 }
 
 // MarkAsPaid marks the order as paid with payment details
@@ -284,21 +483,132 @@ func (o *Order) MarkAsFailed() {
 	o.UpdatedAt = time.Now()
 }
 
-// Cancel cancels the order
-func (o *Order) Cancel(reason string) {
-	o.Status = OrderStatusCancelled
-	o.PaymentStatus = PaymentStatusCancelled
+// Cancel cancels the order. A paid order keeps its payment status until the
+// payment is refunded.
+func (o *Order) Cancel(actor OrderActor, reason string) error {
+	if err := o.TransitionTo(OrderStatusCancelled, actor, reason); err != nil {
+		return err
+	}
+	if o.PaymentStatus != PaymentStatusPaid {
+		o.PaymentStatus = PaymentStatusCancelled
+	}
 	o.CancellationReason = &reason
-	o.UpdatedAt = time.Now()
+	return nil
 }
 
-// Refund refunds the order
-func (o *Order) Refund(reason string) {
-	o.PaymentStatus = PaymentStatusRefunded
-	o.Status = OrderStatusReturned
+// Refund marks the order as returned for a refund. The money is tracked
+// separately through RecordRefund.
+func (o *Order) Refund(actor OrderActor, reason string) error {
+	if o.Status != OrderStatusReturned {
+		if err := o.TransitionTo(OrderStatusReturned, actor, reason); err != nil {
+			return err
+		}
+	}
 	o.ReturnReason = &reason
-	o.RefundAmount = &o.Total
-	now := time.Now()
-	o.RefundedAt = &now
-	o.UpdatedAt = now
+	o.UpdatedAt = time.Now()
+	return nil
+}
+
+// NextRefundID returns the refund ID for the next refund of the order
+func (o *Order) NextRefundID() string {
+	return fmt.Sprintf("%s-RF%d", o.OrderNumber, len(o.Refunds)+1)
+}
+
+// RefundableAmount returns the part of the total not yet refunded. Failed
+// refunds still count since they are retried.
+func (o *Order) RefundableAmount() float64 {
+	refunded := 0.0
+	for _, refund := range o.Refunds {
+		refunded += refund.Amount
+	}
+	return math.Max(0, math.Round((o.Total-refunded)*100)/100)
+}
+
+// ItemRefundAmount returns what quantity units of the line at index are worth
+// to the customer: their price less their share of the order discount, plus
+// their share of the tax. The tax comes from the line's GST when the order has
+// a breakdown. Shipping is not included.
+func (o *Order) ItemRefundAmount(index, quantity int) float64 {
+	if index < 0 || index >= len(o.Items) || o.Subtotal <= 0 {
+		return 0
+	}
+
+	item := o.Items[index]
+	lineValue := item.Price * float64(quantity)
+	share := lineValue / o.Subtotal
+	tax := o.Tax * share
+	if o.TaxBreakdown != nil && item.Quantity > 0 {
+		tax = o.TaxBreakdown.LineTotal(index) * float64(quantity) / float64(item.Quantity)
+	}
+	amount := lineValue - o.Discount*share + tax
+	return math.Max(0, math.Round(amount*100)/100)
+}
+
+// TaxableLines returns the order lines in the form the GST calculator takes
+func (o *Order) TaxableLines() []TaxableLine {
+	lines := make([]TaxableLine, len(o.Items))
+	for i, item := range o.Items {
+		lines[i] = TaxableLine{
+			LineIndex:    i,
+			ProductID:    item.ProductID,
+			Name:         item.Name,
+			Category:     item.Category,
+			Quantity:     item.Quantity,
+			UnitPrice:    item.Price,
+			MakingCharge: item.MakingCharge,
+		}
+	}
+	return lines
+}
+
+// GetRefund returns the refund with the given refund ID
+func (o *Order) GetRefund(refundID string) (*PaymentRefund, bool) {
+	for i := range o.Refunds {
+		if o.Refunds[i].RefundID == refundID {
+			return &o.Refunds[i], true
+		}
+	}
+	return nil, false
+}
+
+// RecordRefund adds a refund, or replaces the one with the same refund ID, and
+// updates the refund summary. The payment status becomes refunded once the
+// whole total has been refunded.
+func (o *Order) RecordRefund(refund PaymentRefund) {
+	if existing, ok := o.GetRefund(refund.RefundID); ok {
+		*existing = refund
+	} else {
+		o.Refunds = append(o.Refunds, refund)
+	}
+
+	amount := 0.0
+	processed := 0.0
+	status := RefundStatusProcessed
+	var refundedAt *time.Time
+	for _, r := range o.Refunds {
+		switch r.Status {
+		case RefundStatusFailed:
+			status = RefundStatusFailed
+			continue
+		case RefundStatusInitiated:
+			if status != RefundStatusFailed {
+				status = RefundStatusInitiated
+			}
+		case RefundStatusProcessed:
+			processed += r.Amount
+			if r.ProcessedAt != nil && (refundedAt == nil || r.ProcessedAt.After(*refundedAt)) {
+				refundedAt = r.ProcessedAt
+			}
+		}
+		amount += r.Amount
+	}
+
+	refundStatus := string(status)
+	o.RefundStatus = &refundStatus
+	o.RefundAmount = &amount
+	o.RefundedAt = refundedAt
+	if math.Round(processed*100) >= math.Round(o.Total*100) {
+		o.PaymentStatus = PaymentStatusRefunded
+	}
+	o.UpdatedAt = time.Now()
 }
@@ -0,0 +1,191 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PaymentAttemptStatus represents the state of a single attempt to pay for an order
+type PaymentAttemptStatus string
+
+const (
+	PaymentAttemptCreated PaymentAttemptStatus = "created" // Created at the gateway, customer has not paid yet
+	PaymentAttemptPending PaymentAttemptStatus = "pending" // Customer paid, gateway has not settled it yet
+	PaymentAttemptPaid    PaymentAttemptStatus = "paid"
+	PaymentAttemptFailed  PaymentAttemptStatus = "failed"
+)
+
+// PaymentAttempt records one checkout session for an order at a payment gateway.
+// Gateway-specific identifiers live here rather than on the order.
+type PaymentAttempt struct {
+	ID                primitive.ObjectID     `json:"id" bson:"_id,omitempty"`
+	OrderID           primitive.ObjectID     `json:"orderId" bson:"orderId"`
+	OrderNumber       string                 `json:"orderNumber" bson:"orderNumber"`
+	Gateway           PaymentMethod          `json:"gateway" bson:"gateway"`
+	Status            PaymentAttemptStatus   `json:"status" bson:"status"`
+	Amount            float64                `json:"amount" bson:"amount"`
+	Currency          string                 `json:"currency" bson:"currency"`
+	ProviderOrderID   string                 `json:"providerOrderId,omitempty" bson:"providerOrderId,omitempty"`
+	ProviderPaymentID string                 `json:"providerPaymentId,omitempty" bson:"providerPaymentId,omitempty"`
+	SessionID         string                 `json:"sessionId,omitempty" bson:"sessionId,omitempty"`
+	LinkURL           string                 `json:"linkUrl,omitempty" bson:"linkUrl,omitempty"`
+	Checkout          map[string]interface{} `json:"-" bson:"checkout,omitempty"` // Options handed to the client checkout, kept so the attempt can be resumed
+	FailureReason     string                 `json:"failureReason,omitempty" bson:"failureReason,omitempty"`
+	CreatedAt         time.Time              `json:"createdAt" bson:"createdAt"`
+	UpdatedAt         time.Time              `json:"updatedAt" bson:"updatedAt"`
+	PaidAt            *time.Time             `json:"paidAt,omitempty" bson:"paidAt,omitempty"`
+}
+
+// IsOpen reports whether the customer can still complete this attempt
+func (a *PaymentAttempt) IsOpen() bool {
+	return a.Status == PaymentAttemptCreated || a.Status == PaymentAttemptPending
+}
+
+// RefundStatus represents the state of a refund at the payment gateway
+type RefundStatus string
+
+const (
+	RefundStatusInitiated RefundStatus = "initiated" // Accepted by the gateway, money not returned yet
+	RefundStatusProcessed RefundStatus = "processed"
+	RefundStatusFailed    RefundStatus = "failed" // Rejected or not sent; retried with the same refund ID
+)
+
+// PaymentRefund records one refund of an order's payment. The refund ID is
+// derived from the order number so a retry is recognised by the gateway as the
+// same refund.
+type PaymentRefund struct {
+	RefundID         string             `json:"refundId" bson:"refundId"`
+	AttemptID        primitive.ObjectID `json:"attemptId,omitempty" bson:"attemptId,omitempty"` // Zero for refunds settled outside a gateway
+	Gateway          PaymentMethod      `json:"gateway" bson:"gateway"`
+	ProviderRefundID string             `json:"providerRefundId,omitempty" bson:"providerRefundId,omitempty"`
+	Amount           float64            `json:"amount" bson:"amount"`
+	Reason           string             `json:"reason" bson:"reason"`
+	Status           RefundStatus       `json:"status" bson:"status"`
+	FailureReason    string             `json:"failureReason,omitempty" bson:"failureReason,omitempty"`
+	Retries          int                `json:"retries" bson:"retries"`
+	CreditsReversed  bool               `json:"-" bson:"creditsReversed,omitempty"` // Loyalty credits earned on the order were taken back
+	CreatedAt        time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt        time.Time          `json:"updatedAt" bson:"updatedAt"`
+	ProcessedAt      *time.Time         `json:"processedAt,omitempty" bson:"processedAt,omitempty"`
+}
+
+// CreatePaymentRequest represents the request to start a payment for an order
+type CreatePaymentRequest struct {
+	OrderID       string  `json:"orderId" binding:"required"`
+	Amount        float64 `json:"amount" binding:"required"`
+	Currency      string  `json:"currency"`
+	CustomerPhone string  `json:"customerPhone"`
+	CustomerEmail string  `json:"customerEmail"`
+	CustomerName  string  `json:"customerName"`
+	ReturnURL     string  `json:"returnUrl"`
+	NotifyURL     string  `json:"notifyUrl"`
+	Purpose       string  `json:"purpose"`
+}
+
+// PaymentSession is returned to the client to open the gateway checkout
+type PaymentSession struct {
+	AttemptID       primitive.ObjectID     `json:"attemptId"`
+	Gateway         PaymentMethod          `json:"gateway"`
+	OrderID         primitive.ObjectID     `json:"orderId"`
+	OrderNumber     string                 `json:"orderNumber"`
+	Amount          float64                `json:"amount"`
+	Currency        string                 `json:"currency"`
+	ProviderOrderID string                 `json:"providerOrderId,omitempty"`
+	SessionID       string                 `json:"sessionId,omitempty"`
+	LinkURL         string                 `json:"linkUrl,omitempty"`
+	Checkout        map[string]interface{} `json:"checkout,omitempty"` // Gateway-specific checkout options
+}
+
+// PaymentGatewayInfo describes a registered payment gateway
+type PaymentGatewayInfo struct {
+	Gateway PaymentMethod `json:"gateway"`
+	Name    string        `json:"name"`
+	Enabled bool          `json:"enabled"`
+}
+
+// WebhookEventStatus represents how far an inbound payment webhook has been processed
+type WebhookEventStatus string
+
+const (
+	WebhookEventReceived   WebhookEventStatus = "received"
+	WebhookEventProcessing WebhookEventStatus = "processing"
+	WebhookEventProcessed  WebhookEventStatus = "processed"
+	WebhookEventFailed     WebhookEventStatus = "failed"
+	WebhookEventRejected   WebhookEventStatus = "rejected" // Signature did not verify; never processed
+)
+
+// WebhookEvent records an inbound payment webhook with its raw body so it can be
+// inspected and replayed. Deliveries are de-duplicated by gateway and event ID.
+type WebhookEvent struct {
+	ID             primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Gateway        PaymentMethod      `json:"gateway" bson:"gateway"`
+	EventID        string             `json:"eventId" bson:"eventId"` // Gateway event ID, or a hash of the body when the gateway sends none
+	EventType      string             `json:"eventType,omitempty" bson:"eventType,omitempty"`
+	Payload        string             `json:"payload" bson:"payload"`
+	Headers        map[string]string  `json:"headers,omitempty" bson:"headers,omitempty"` // Headers needed to verify the signature again on replay
+	SignatureValid bool               `json:"signatureValid" bson:"signatureValid"`
+	Status         WebhookEventStatus `json:"status" bson:"status"`
+	Error          string             `json:"error,omitempty" bson:"error,omitempty"`
+	Deliveries     int                `json:"deliveries" bson:"deliveries"` // Times the gateway sent this event
+	Attempts       int                `json:"attempts" bson:"attempts"`     // Times processing was attempted, including replays
+	OrderID        string             `json:"orderId,omitempty" bson:"orderId,omitempty"`
+	ReceivedAt     time.Time          `json:"receivedAt" bson:"receivedAt"`
+	UpdatedAt      time.Time          `json:"updatedAt" bson:"updatedAt"`
+	ProcessedAt    *time.Time         `json:"processedAt,omitempty" bson:"processedAt,omitempty"`
+}
+
+// WebhookEventFilter represents filters for listing webhook events
+type WebhookEventFilter struct {
+	Gateway *PaymentMethod      `json:"gateway,omitempty"`
+	Status  *WebhookEventStatus `json:"status,omitempty"`
+	Page    int                 `json:"page,omitempty"`
+	Limit   int                 `json:"limit,omitempty"`
+}
+
+// ReconciliationEntryKind classifies what reconciliation found for a payment attempt
+type ReconciliationEntryKind string
+
+const (
+	ReconciliationSettled        ReconciliationEntryKind = "settled"         // Gateway had the payment; the order is now paid
+	ReconciliationFailed         ReconciliationEntryKind = "failed"          // Gateway reported the payment failed or expired
+	ReconciliationAmountMismatch ReconciliationEntryKind = "amount_mismatch" // Gateway amount differs from the attempt or order
+	ReconciliationRefunded       ReconciliationEntryKind = "refunded"        // Gateway had the payment for a cancelled order; it was refunded
+	ReconciliationOrphanPayment  ReconciliationEntryKind = "orphan_payment"  // Money taken for an order that was already paid
+	ReconciliationStale          ReconciliationEntryKind = "stale"           // No payment after the stale window; the order was failed
+	ReconciliationError          ReconciliationEntryKind = "error"           // Gateway could not be queried
+)
+
+// ReconciliationEntry is one finding of a reconciliation run
+type ReconciliationEntry struct {
+	Kind              ReconciliationEntryKind `json:"kind" bson:"kind"`
+	OrderID           primitive.ObjectID      `json:"orderId" bson:"orderId"`
+	OrderNumber       string                  `json:"orderNumber" bson:"orderNumber"`
+	AttemptID         primitive.ObjectID      `json:"attemptId" bson:"attemptId"`
+	Gateway           PaymentMethod           `json:"gateway" bson:"gateway"`
+	ProviderOrderID   string                  `json:"providerOrderId" bson:"providerOrderId"`
+	ProviderPaymentID string                  `json:"providerPaymentId,omitempty" bson:"providerPaymentId,omitempty"`
+	ExpectedAmount    float64                 `json:"expectedAmount" bson:"expectedAmount"`
+	GatewayAmount     float64                 `json:"gatewayAmount" bson:"gatewayAmount"`
+	Detail            string                  `json:"detail,omitempty" bson:"detail,omitempty"`
+}
+
+// ReconciliationReport records a run of the payment reconciler over unsettled orders
+type ReconciliationReport struct {
+	ID              primitive.ObjectID              `json:"id" bson:"_id,omitempty"`
+	StartedAt       time.Time                       `json:"startedAt" bson:"startedAt"`
+	FinishedAt      time.Time                       `json:"finishedAt" bson:"finishedAt"`
+	OrdersChecked   int                             `json:"ordersChecked" bson:"ordersChecked"`
+	AttemptsChecked int                             `json:"attemptsChecked" bson:"attemptsChecked"`
+	Counts          map[ReconciliationEntryKind]int `json:"counts" bson:"counts"`
+	Entries         []ReconciliationEntry           `json:"entries,omitempty" bson:"entries"`
+}
+
+// Add records a finding and counts it by kind
+func (r *ReconciliationReport) Add(entry ReconciliationEntry) {
+	if r.Counts == nil {
+		r.Counts = make(map[ReconciliationEntryKind]int)
+	}
+	r.Counts[entry.Kind]++
+	r.Entries = append(r.Entries, entry)
+}
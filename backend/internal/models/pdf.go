@@ -11,8 +11,11 @@ type PDFDocument struct {
 	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
 	Type         string             `json:"type" bson:"type"` // "invoice", "receipt", "warranty"
 	OrderID      primitive.ObjectID `json:"orderId" bson:"orderId"`
+	ReferenceID  primitive.ObjectID `json:"referenceId" bson:"referenceId"` // Invoice, order or warranty the document renders
 	UserID       primitive.ObjectID `json:"userId" bson:"userId"`
 	FileURL      string             `json:"fileUrl" bson:"fileUrl"`
+	StorageKey   string             `json:"-" bson:"storageKey"`
+	Fingerprint  string             `json:"-" bson:"fingerprint"` // Hash of the rendered pages; unchanged documents are not uploaded again
 	Filename     string             `json:"filename" bson:"filename"`
 	Size         int64              `json:"size" bson:"size"`
 	GeneratedAt  time.Time          `json:"generatedAt" bson:"generatedAt"`
@@ -21,8 +24,26 @@ type PDFDocument struct {
 	IsActive     bool               `json:"isActive" bson:"isActive"`
 }
 
+// PDF document types
+const (
+	PDFTypeInvoice  = "invoice"
+	PDFTypeReceipt  = "receipt"
+	PDFTypeWarranty = "warranty"
+	PDFTypeCertificate = "certificate"
+)
+
+// PDFDownload is a generated document with a temporary download link
+type PDFDownload struct {
+	Document    *PDFDocument `json:"document,omitempty"`
+	DownloadURL string       `json:"downloadUrl,omitempty"`
+	ExpiresAt   *time.Time   `json:"expiresAt,omitempty"`
+	Filename    string       `json:"filename"`
+	Content     []byte       `json:"-"` // The rendered file when document storage is not configured
+}
+
 // InvoiceData represents data structure for invoice generation
 type InvoiceData struct {
+	Invoice         Invoice         `json:"invoice"`
 	Order           Order           `json:"order"`
 	User            User            `json:"user"`
 	Company         CompanyInfo     `json:"company"`
@@ -40,16 +61,22 @@ type InvoiceItem struct {
 	ProductID    primitive.ObjectID `json:"productId"`
 	ProductName  string             `json:"productName"`
 	SKU          string             `json:"sku"`
+	HSNCode      string             `json:"hsnCode"`
 	Quantity     int                `json:"quantity"`
 	UnitPrice    float64            `json:"unitPrice"`
 	TotalPrice   float64            `json:"totalPrice"`
+	TaxableValue float64            `json:"taxableValue"`
 	TaxRate      float64            `json:"taxRate"`
 	TaxAmount    float64            `json:"taxAmount"`
+	CGST         float64            `json:"cgst"`
+	SGST         float64            `json:"sgst"`
+	IGST         float64            `json:"igst"`
 	Description  string             `json:"description"`
 	MetalType    string             `json:"metalType,omitempty"`
 	GemstoneType string             `json:"gemstoneType,omitempty"`
 	Weight       float64            `json:"weight,omitempty"`
 	Purity       string             `json:"purity,omitempty"`
+	HUIDs        []string           `json:"huids,omitempty"` // Hallmarks of the pieces packed into the line
 }
 
 // InvoiceTotals represents totals for the invoice
@@ -57,6 +84,7 @@ type InvoiceTotals struct {
 	Subtotal     float64 `json:"subtotal"`
 	TaxAmount    float64 `json:"taxAmount"`
 	ShippingCost float64 `json:"shippingCost"`
+	CODCharge    float64 `json:"codCharge"`
 	Discount     float64 `json:"discount"`
 	VoucherValue float64 `json:"voucherValue"`
 	Total        float64 `json:"total"`
@@ -80,14 +108,14 @@ type CompanyInfo struct {
 
 // TaxDetails represents tax calculation details
 type TaxDetails struct {
-	TaxType     string  `json:"taxType"` // "GST", "VAT", "Sales Tax"
-	TaxRate     float64 `json:"taxRate"`
-	TaxID       string  `json:"taxId"`
-	TaxAddress  string  `json:"taxAddress"`
-	CGST        float64 `json:"cgst,omitempty"`
-	SGST        float64 `json:"sgst,omitempty"`
-	IGST        float64 `json:"igst,omitempty"`
-	HSNCode     string  `json:"hsnCode,omitempty"`
+	TaxType     string  `json:"taxType" bson:"taxType"` // "GST", "VAT", "Sales Tax"
+	TaxRate     float64 `json:"taxRate" bson:"taxRate"`
+	TaxID       string  `json:"taxId" bson:"taxId"`
+	TaxAddress  string  `json:"taxAddress" bson:"taxAddress"`
+	CGST        float64 `json:"cgst,omitempty" bson:"cgst,omitempty"`
+	SGST        float64 `json:"sgst,omitempty" bson:"sgst,omitempty"`
+	IGST        float64 `json:"igst,omitempty" bson:"igst,omitempty"`
+	HSNCode     string  `json:"hsnCode,omitempty" bson:"hsnCode,omitempty"`
 }
 
 // PaymentInfo represents payment information for invoice
@@ -120,11 +148,16 @@ type OrderTracking struct {
 	OrderID       primitive.ObjectID `json:"orderId" bson:"orderId"`
 	TrackingID    string             `json:"trackingId" bson:"trackingId"`
 	Carrier       string             `json:"carrier" bson:"carrier"`
+	CourierName   string             `json:"courierName,omitempty" bson:"courierName,omitempty"`
+	ShipmentID    string             `json:"shipmentId,omitempty" bson:"shipmentId,omitempty"` // Carrier's shipment reference
+	LabelURL      string             `json:"labelUrl,omitempty" bson:"labelUrl,omitempty"`
 	Service       string             `json:"service" bson:"service"`
 	Status        string             `json:"status" bson:"status"`
 	CurrentLocation string           `json:"currentLocation" bson:"currentLocation"`
 	EstimatedDelivery time.Time      `json:"estimatedDelivery" bson:"estimatedDelivery"`
 	ActualDelivery  *time.Time       `json:"actualDelivery,omitempty" bson:"actualDelivery,omitempty"`
+	CancelledAt     *time.Time       `json:"cancelledAt,omitempty" bson:"cancelledAt,omitempty"`
+	LastPolledAt    *time.Time       `json:"lastPolledAt,omitempty" bson:"lastPolledAt,omitempty"`
 	Events          []TrackingEvent  `json:"events" bson:"events"`
 	CreatedAt       time.Time        `json:"createdAt" bson:"createdAt"`
 	UpdatedAt       time.Time        `json:"updatedAt" bson:"updatedAt"`
@@ -143,12 +176,19 @@ type TrackingEvent struct {
 	Notes       string             `json:"notes,omitempty" bson:"notes,omitempty"`
 }
 
-// WarrantyInfo represents warranty information for jewelry
+// WarrantyInfo represents warranty information for jewelry. One warranty is
+// issued per order line when the order is delivered.
 type WarrantyInfo struct {
 	ID               primitive.ObjectID `json:"id" bson:"_id,omitempty"`
 	OrderID          primitive.ObjectID `json:"orderId" bson:"orderId"`
+	OrderNumber      string             `json:"orderNumber,omitempty" bson:"orderNumber,omitempty"`
+	LineIndex        int                `json:"lineIndex" bson:"lineIndex"` // Index into the order's items
 	ProductID        primitive.ObjectID `json:"productId" bson:"productId"`
+	ProductName      string             `json:"productName,omitempty" bson:"productName,omitempty"`
+	Category         string             `json:"category,omitempty" bson:"category,omitempty"` // Decides the warranty policy
+	Quantity         int                `json:"quantity,omitempty" bson:"quantity,omitempty"`
 	UserID           primitive.ObjectID `json:"userId" bson:"userId"`
+	GuestSessionID   string             `json:"guestSessionId,omitempty" bson:"guestSessionId,omitempty"`
 	WarrantyNumber   string             `json:"warrantyNumber" bson:"warrantyNumber"`
 	WarrantyType     string             `json:"warrantyType" bson:"warrantyType"` // "manufacturing", "extended", "lifetime"
 	PurchaseDate     time.Time          `json:"purchaseDate" bson:"purchaseDate"`
@@ -167,33 +207,50 @@ type WarrantyInfo struct {
 type CoverageDetail struct {
 	Type        string `json:"type" bson:"type"` // "repair", "replacement", "cleaning", "resizing"
 	Description string `json:"description" bson:"description"`
-	MaxClaims   int    `json:"maxClaims" bson:"maxClaims"`
-	UsedClaims  int    `json:"usedClaims" bson:"usedClaims"`
+	MaxClaims   int    `json:"maxClaims" bson:"maxClaims"` // 0 allows any number of claims
+	UsedClaims  int    `json:"usedClaims" bson:"usedClaims"` // Approved claims
 }
 
 // WarrantyClaim represents a warranty claim
 type WarrantyClaim struct {
 	ID             primitive.ObjectID `json:"id" bson:"_id,omitempty"`
 	WarrantyID     primitive.ObjectID `json:"warrantyId" bson:"warrantyId"`
+	WarrantyNumber string             `json:"warrantyNumber,omitempty" bson:"warrantyNumber,omitempty"`
+	OrderID        primitive.ObjectID `json:"orderId,omitempty" bson:"orderId,omitempty"`
+	ProductName    string             `json:"productName,omitempty" bson:"productName,omitempty"`
+	UserID         primitive.ObjectID `json:"userId,omitempty" bson:"userId,omitempty"`
+	GuestSessionID string             `json:"guestSessionId,omitempty" bson:"guestSessionId,omitempty"`
 	ClaimNumber    string             `json:"claimNumber" bson:"claimNumber"`
-	ClaimType      string             `json:"claimType" bson:"claimType"`
+	ClaimType      string             `json:"claimType" bson:"claimType"` // One of the warranty's coverage types
 	Description    string             `json:"description" bson:"description"`
 	Status         string             `json:"status" bson:"status"` // "submitted", "approved", "rejected", "completed"
 	SubmittedAt    time.Time          `json:"submittedAt" bson:"submittedAt"`
 	ProcessedAt    *time.Time         `json:"processedAt,omitempty" bson:"processedAt,omitempty"`
+	ProcessedBy    *OrderActor        `json:"processedBy,omitempty" bson:"processedBy,omitempty"`
 	CompletedAt    *time.Time         `json:"completedAt,omitempty" bson:"completedAt,omitempty"`
-	RepairCost     float64            `json:"repairCost" bson:"repairCost"`
+	RepairCost     float64            `json:"repairCost" bson:"repairCost"` // What the repair cost the store
 	Photos         []string           `json:"photos" bson:"photos"`
 	AdminNotes     string             `json:"adminNotes" bson:"adminNotes"`
 	UserNotes      string             `json:"userNotes" bson:"userNotes"`
 	ResolutionType string             `json:"resolutionType" bson:"resolutionType"` // "repair", "replace", "refund"
+	UpdatedAt      time.Time          `json:"updatedAt" bson:"updatedAt"`
 }
 
-// Certificate represents a jewelry certificate
+// Certificate represents a jewelry certificate. A certificate of authenticity
+// is issued for each unit of a delivered order line and signed so the
+// verification endpoint can tell a genuine certificate from a forged one.
 type Certificate struct {
 	ID              primitive.ObjectID `json:"id" bson:"_id,omitempty"`
 	OrderID         primitive.ObjectID `json:"orderId" bson:"orderId"`
+	OrderNumber     string             `json:"orderNumber,omitempty" bson:"orderNumber,omitempty"`
+	LineIndex       int                `json:"lineIndex" bson:"lineIndex"` // Index into the order's items
+	Unit            int                `json:"unit" bson:"unit"`           // Which unit of the line, from 1
 	ProductID       primitive.ObjectID `json:"productId" bson:"productId"`
+	ProductName     string             `json:"productName,omitempty" bson:"productName,omitempty"`
+	Serial          string             `json:"serial,omitempty" bson:"serial,omitempty"` // Store serial of the piece, once packed
+	HUID            string             `json:"huid,omitempty" bson:"huid,omitempty"`     // BIS hallmark of the piece
+	UserID          primitive.ObjectID `json:"userId,omitempty" bson:"userId,omitempty"`
+	GuestSessionID  string             `json:"guestSessionId,omitempty" bson:"guestSessionId,omitempty"`
 	CertificateType string             `json:"certificateType" bson:"certificateType"` // "authenticity", "appraisal", "grading"
 	CertificateNo   string             `json:"certificateNo" bson:"certificateNo"`
 	IssuingAuthority string            `json:"issuingAuthority" bson:"issuingAuthority"`
@@ -201,7 +258,8 @@ type Certificate struct {
 	ExpiryDate      *time.Time         `json:"expiryDate,omitempty" bson:"expiryDate,omitempty"`
 	GradingDetails  GradingDetails     `json:"gradingDetails" bson:"gradingDetails"`
 	CertificateURL  string             `json:"certificateUrl" bson:"certificateUrl"`
-	QRCode          string             `json:"qrCode" bson:"qrCode"`
+	QRCode          string             `json:"qrCode" bson:"qrCode"` // Verification link the QR code on the certificate encodes
+	Signature       string             `json:"signature,omitempty" bson:"signature,omitempty"` // Over SigningPayload
 	IsVerified      bool               `json:"isVerified" bson:"isVerified"`
 	CreatedAt       time.Time          `json:"createdAt" bson:"createdAt"`
 	UpdatedAt       time.Time          `json:"updatedAt" bson:"updatedAt"`
@@ -212,6 +270,7 @@ type GradingDetails struct {
 	MetalType     string             `json:"metalType" bson:"metalType"`
 	MetalPurity   string             `json:"metalPurity" bson:"metalPurity"`
 	Weight        float64            `json:"weight" bson:"weight"`
+	NetWeight     float64            `json:"netWeight,omitempty" bson:"netWeight,omitempty"` // Metal weight of the piece, once packed
 	Dimensions    string             `json:"dimensions" bson:"dimensions"`
 	Gemstones     []GemstoneGrading  `json:"gemstones" bson:"gemstones"`
 	Craftsmanship string             `json:"craftsmanship" bson:"craftsmanship"`
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PriceSource identifies which pricing rule produced a line's selling price
+type PriceSource string
+
+const (
+	PriceSourceRegular   PriceSource = "regular"
+	PriceSourceDealOfDay PriceSource = "deal_of_day"
+	PriceSourceFlashSale PriceSource = "flash_sale"
+)
+
+// LinePrice is the server-computed unit price for a product with its customization
+type LinePrice struct {
+	BasePrice          float64             `json:"basePrice"`          // Catalogue price before customization
+	CustomizationPrice float64             `json:"customizationPrice"` // Metal, plating, stone and engraving modifiers
+	OriginalPrice      float64             `json:"originalPrice"`      // Undiscounted unit price including customization
+	UnitPrice          float64             `json:"unitPrice"`          // Final selling price per unit
+	MakingCharge       float64             `json:"makingCharge"`       // Part of the unit price that is making charges
+	DiscountPercent    int                 `json:"discountPercent"`
+	Source             PriceSource         `json:"source"`
+	DealID             *primitive.ObjectID `json:"dealId,omitempty"`    // Set when a deal of the day was applied
+	MetalRate          *MetalRateQuote     `json:"metalRate,omitempty"` // Set when the base price came from the live metal rate
+}
+
+// IsDiscounted reports whether a promotion lowered the unit price
+func (lp *LinePrice) IsDiscounted() bool {
+	return lp.UnitPrice < lp.OriginalPrice
+}
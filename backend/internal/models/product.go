@@ -2,6 +2,8 @@ package models
 
 import (
     "fmt"
+    "sort"
+    "strings"
     "time"
 
     "go.mongodb.org/mongo-driver/bson/primitive"
@@ -49,6 +51,31 @@ func (pc *ProductCustomization) GetSummaryLines() []string {
 	return lines
 }
 
+// Key returns a canonical string for the customization so equal choices compare equal.
+// A nil or empty customization has an empty key.
+func (pc *ProductCustomization) Key() string {
+	if pc == nil {
+		return ""
+	}
+
+	stoneNames := make([]string, 0, len(pc.StoneColors))
+	for name := range pc.StoneColors {
+		stoneNames = append(stoneNames, name)
+	}
+	sort.Strings(stoneNames)
+
+	parts := []string{pc.Metal, pc.PlatingColor, pc.RingSize, pc.Engraving}
+	for _, name := range stoneNames {
+		parts = append(parts, name+"="+pc.StoneColors[name])
+	}
+
+	key := strings.Join(parts, "|")
+	if strings.Trim(key, "|") == "" {
+		return ""
+	}
+	return key
+}
+
 // StockType represents whether product is stocked or made-to-order
 type StockType string
 
@@ -71,9 +98,17 @@ type Product struct {
 	MetalType      string            `json:"metalType" bson:"metalType" validate:"required"`
 	StoneType      *string           `json:"stoneType,omitempty" bson:"stoneType,omitempty"`
 	Weight         *float64          `json:"weight,omitempty" bson:"weight,omitempty"`
+	MakingCharge   *float64          `json:"makingCharge,omitempty" bson:"makingCharge,omitempty"` // Part of the price that is making charges, taxed separately
+	PricingMode    PricingMode       `json:"pricingMode,omitempty" bson:"pricingMode,omitempty"`     // "fixed" (default) or "metal_rate"
+	WeightPricing  *WeightPricing    `json:"weightPricing,omitempty" bson:"weightPricing,omitempty"` // How a metal_rate product is priced
 	Size           *string           `json:"size,omitempty" bson:"size,omitempty"`
+	Gemstones      []GemstoneGrading `json:"gemstones,omitempty" bson:"gemstones,omitempty"` // Graded stones set in the piece, printed on its certificate
 	StockType      StockType         `json:"stockType" bson:"stockType"`                            // "stocked" or "made_to_order"
-	StockQuantity  int               `json:"stockQuantity" bson:"stockQuantity" validate:"min=0"`
+	StockQuantity  int               `json:"stockQuantity" bson:"stockQuantity" validate:"min=0"` // Sum of the variants' stock when the product has variants
+	Variants       []ProductVariant  `json:"variants,omitempty" bson:"variants,omitempty"`          // Option combinations with their own SKU and stock
+	ReorderLevel   *int              `json:"reorderLevel,omitempty" bson:"reorderLevel,omitempty"`            // Low-stock threshold; DefaultReorderLevel when unset
+	LowStockAlertedAt *time.Time     `json:"lowStockAlertedAt,omitempty" bson:"lowStockAlertedAt,omitempty"` // Set while an alert is raised, cleared when restocked
+	LocationStock  []LocationStock   `json:"locationStock,omitempty" bson:"locationStock,omitempty"`          // Stock per location; stockQuantity is their total once set
 	Rating         float64           `json:"rating" bson:"rating" validate:"min=0,max=5"`
 	ReviewCount    int               `json:"reviewCount" bson:"reviewCount" validate:"min=0"`
 	Tags           []string          `json:"tags" bson:"tags"`
@@ -120,7 +155,7 @@ type Review struct {
 type CreateProductRequest struct {
 	Name          string    `json:"name" validate:"required,min=2,max=200"`
 	Description   string    `json:"description" validate:"required,min=10,max=2000"`
-	Price         float64   `json:"price" validate:"required,min=0"`
+	Price         float64   `json:"price" validate:"required_unless=PricingMode metal_rate,min=0"` // Set from the metal rate for metal_rate products
 	OriginalPrice *float64  `json:"originalPrice,omitempty"`
 	Images        []string  `json:"images" validate:"required,min=1"`
 	Videos        []string  `json:"videos,omitempty"`
@@ -129,9 +164,15 @@ type CreateProductRequest struct {
 	MetalType     string    `json:"metalType" validate:"required"`
 	StoneType     *string   `json:"stoneType,omitempty"`
 	Weight        *float64  `json:"weight,omitempty"`
+	MakingCharge  *float64  `json:"makingCharge,omitempty" validate:"omitempty,min=0"`
+	PricingMode   PricingMode    `json:"pricingMode,omitempty"`
+	WeightPricing *WeightPricing `json:"weightPricing,omitempty"` // Required when pricingMode is metal_rate
 	Size          *string   `json:"size,omitempty"`
+	Gemstones     []GemstoneGrading `json:"gemstones,omitempty"`
 	StockType     StockType `json:"stockType"`                              // "stocked" or "made_to_order"
-	StockQuantity int       `json:"stockQuantity" validate:"min=0"`
+	StockQuantity int       `json:"stockQuantity" validate:"min=0"`        // Ignored when variants are given
+	Variants      []CreateVariantRequest `json:"variants,omitempty"`   // Sold by variant; stockQuantity is their total
+	ReorderLevel  *int      `json:"reorderLevel,omitempty" validate:"omitempty,min=0"`
 	Tags          []string  `json:"tags"`
 	Gender        []string  `json:"gender"`
 	IsAvailable   bool      `json:"isAvailable"`
@@ -169,9 +210,14 @@ type UpdateProductRequest struct {
 	MetalType     *string    `json:"metalType,omitempty"`
 	StoneType     *string    `json:"stoneType,omitempty"`
 	Weight        *float64   `json:"weight,omitempty"`
+	MakingCharge  *float64   `json:"makingCharge,omitempty" validate:"omitempty,min=0"`
+	PricingMode   *PricingMode   `json:"pricingMode,omitempty"`
+	WeightPricing *WeightPricing `json:"weightPricing,omitempty"`
 	Size          *string    `json:"size,omitempty"`
+	Gemstones     []GemstoneGrading `json:"gemstones,omitempty"`
 	StockType     *StockType `json:"stockType,omitempty"`                         // "stocked" or "made_to_order"
 	StockQuantity *int       `json:"stockQuantity,omitempty" validate:"omitempty,min=0"`
+	ReorderLevel  *int       `json:"reorderLevel,omitempty" validate:"omitempty,min=0"`
 	Tags          []string  `json:"tags,omitempty"`
 	Gender        []string  `json:"gender,omitempty"`
 	IsAvailable   *bool     `json:"isAvailable,omitempty"`
@@ -221,7 +267,9 @@ type ProductFilter struct {
 	MinPrice   *float64 `json:"minPrice,omitempty"`
 	MaxPrice   *float64 `json:"maxPrice,omitempty"`
 	MinRating  *float64 `json:"minRating,omitempty"`
-	InStock    *bool    `json:"inStock,omitempty"`
+	Size       []string `json:"size,omitempty"`    // Ring sizes; with inStock, only sizes that have stock
+	InStock    *bool    `json:"inStock,omitempty"` // With metalType or size, an in-stock variant must have them
+	LocationID *primitive.ObjectID `json:"locationId,omitempty"` // Only products in stock at the location, for click-and-collect
 	IsFeatured *bool    `json:"isFeatured,omitempty"`
 	Tags       []string `json:"tags,omitempty"`
 	Search     string   `json:"search,omitempty"`
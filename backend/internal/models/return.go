@@ -0,0 +1,254 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ReturnStatus represents where a return request is in the RMA workflow
+type ReturnStatus string
+
+const (
+	ReturnStatusRequested       ReturnStatus = "requested"
+	ReturnStatusApproved        ReturnStatus = "approved"
+	ReturnStatusRejected        ReturnStatus = "rejected"
+	ReturnStatusPickupScheduled ReturnStatus = "pickup_scheduled"
+	ReturnStatusReceived        ReturnStatus = "received"
+	ReturnStatusRefunding       ReturnStatus = "refunding" // Quality check accepted some units; their refund and restock are under way
+	ReturnStatusRefunded        ReturnStatus = "refunded"  // Quality check accepted some units and they were refunded
+	ReturnStatusClosed          ReturnStatus = "closed"    // Quality check accepted nothing
+	ReturnStatusCancelled       ReturnStatus = "cancelled" // Withdrawn by the customer
+)
+
+// ErrInvalidReturnStatusTransition is returned when a return request cannot move to the requested status
+var ErrInvalidReturnStatusTransition = errors.New("invalid return status transition")
+
+// returnStatusTransitions lists the statuses each return status may move to.
+// A scheduled pickup may be rescheduled; rejected, refunded, closed and cancelled are final.
+var returnStatusTransitions = map[ReturnStatus][]ReturnStatus{
+	ReturnStatusRequested:       {ReturnStatusApproved, ReturnStatusRejected, ReturnStatusCancelled},
+	ReturnStatusApproved:        {ReturnStatusPickupScheduled, ReturnStatusReceived, ReturnStatusCancelled},
+	ReturnStatusPickupScheduled: {ReturnStatusPickupScheduled, ReturnStatusReceived, ReturnStatusCancelled},
+	ReturnStatusReceived:        {ReturnStatusRefunding, ReturnStatusClosed},
+	ReturnStatusRefunding:       {ReturnStatusRefunded},
+	ReturnStatusRejected:        {},
+	ReturnStatusRefunded:        {},
+	ReturnStatusClosed:          {},
+	ReturnStatusCancelled:       {},
+}
+
+// ReturnReasonCode is the customer's reason for returning an item
+type ReturnReasonCode string
+
+const (
+	ReturnReasonDamaged        ReturnReasonCode = "damaged"
+	ReturnReasonDefective      ReturnReasonCode = "defective"
+	ReturnReasonWrongItem      ReturnReasonCode = "wrong_item"
+	ReturnReasonNotAsDescribed ReturnReasonCode = "not_as_described"
+	ReturnReasonSizeIssue      ReturnReasonCode = "size_issue"
+	ReturnReasonChangedMind    ReturnReasonCode = "changed_mind"
+	ReturnReasonOther          ReturnReasonCode = "other"
+)
+
+// IsValid checks if the reason code is known
+func (r ReturnReasonCode) IsValid() bool {
+	switch r {
+	case ReturnReasonDamaged, ReturnReasonDefective, ReturnReasonWrongItem, ReturnReasonNotAsDescribed,
+		ReturnReasonSizeIssue, ReturnReasonChangedMind, ReturnReasonOther:
+		return true
+	}
+	return false
+}
+
+// QualityCheckOutcome summarizes the inspection of returned units
+type QualityCheckOutcome string
+
+const (
+	QualityCheckPassed  QualityCheckOutcome = "passed"  // Every returned unit was accepted
+	QualityCheckPartial QualityCheckOutcome = "partial" // Some units were accepted
+	QualityCheckFailed  QualityCheckOutcome = "failed"  // No unit was accepted; items go back to the customer
+)
+
+// ReturnRequest is a customer's request to return some units of a delivered order (an RMA)
+type ReturnRequest struct {
+	ID             primitive.ObjectID   `json:"id" bson:"_id,omitempty"`
+	RMANumber      string               `json:"rmaNumber" bson:"rmaNumber"`
+	OrderID        primitive.ObjectID   `json:"orderId" bson:"orderId"`
+	OrderNumber    string               `json:"orderNumber" bson:"orderNumber"`
+	UserID         primitive.ObjectID   `json:"userId,omitempty" bson:"userId,omitempty"`
+	GuestSessionID string               `json:"guestSessionId,omitempty" bson:"guestSessionId,omitempty"`
+	Items          []ReturnItem         `json:"items" bson:"items"`
+	Photos         []string             `json:"photos,omitempty" bson:"photos,omitempty"`
+	Comment        string               `json:"comment,omitempty" bson:"comment,omitempty"`
+	Status         ReturnStatus         `json:"status" bson:"status"`
+	RejectReason   string               `json:"rejectReason,omitempty" bson:"rejectReason,omitempty"`
+	Pickup         *ReturnPickup        `json:"pickup,omitempty" bson:"pickup,omitempty"`
+	QualityCheck   *ReturnQualityCheck  `json:"qualityCheck,omitempty" bson:"qualityCheck,omitempty"`
+	RefundAmount   float64              `json:"refundAmount" bson:"refundAmount"`
+	RefundID       string               `json:"refundId,omitempty" bson:"refundId,omitempty"` // Refund recorded on the order
+	StatusHistory  []ReturnStatusChange `json:"statusHistory" bson:"statusHistory"`
+	CreatedAt      time.Time            `json:"createdAt" bson:"createdAt"`
+	UpdatedAt      time.Time            `json:"updatedAt" bson:"updatedAt"`
+	ReceivedAt     *time.Time           `json:"receivedAt,omitempty" bson:"receivedAt,omitempty"`
+	ClosedAt       *time.Time           `json:"closedAt,omitempty" bson:"closedAt,omitempty"`
+}
+
+// ReturnItem is one order line being returned
+type ReturnItem struct {
+	LineIndex        int                `json:"lineIndex" bson:"lineIndex"` // Index into the order's items
+	ProductID        primitive.ObjectID `json:"productId" bson:"productId"`
+	Name             string             `json:"name" bson:"name"`
+	Image            string             `json:"image,omitempty" bson:"image,omitempty"`
+	UnitPrice        float64            `json:"unitPrice" bson:"unitPrice"`
+	Quantity         int                `json:"quantity" bson:"quantity"`
+	Reason           ReturnReasonCode   `json:"reason" bson:"reason"`
+	Comment          string             `json:"comment,omitempty" bson:"comment,omitempty"`
+	AcceptedQuantity int                `json:"acceptedQuantity" bson:"acceptedQuantity"` // Set by the quality check
+	RefundAmount     float64            `json:"refundAmount" bson:"refundAmount"`
+}
+
+// ReturnPickup is the courier collection of the returned items
+type ReturnPickup struct {
+	Address        Address   `json:"address" bson:"address"`
+	ScheduledDate  time.Time `json:"scheduledDate" bson:"scheduledDate"`
+	Slot           string    `json:"slot,omitempty" bson:"slot,omitempty"` // e.g. "10:00-14:00"
+	Carrier        string    `json:"carrier,omitempty" bson:"carrier,omitempty"`
+	TrackingNumber string    `json:"trackingNumber,omitempty" bson:"trackingNumber,omitempty"`
+	ScheduledAt    time.Time `json:"scheduledAt" bson:"scheduledAt"`
+}
+
+// ReturnQualityCheck is the inspection result once the items are received
+type ReturnQualityCheck struct {
+	Outcome   QualityCheckOutcome `json:"outcome" bson:"outcome"`
+	Notes     string              `json:"notes,omitempty" bson:"notes,omitempty"`
+	CheckedBy OrderActor          `json:"checkedBy" bson:"checkedBy"`
+	CheckedAt time.Time           `json:"checkedAt" bson:"checkedAt"`
+}
+
+// ReturnStatusChange records one status change of a return request
+type ReturnStatusChange struct {
+	From      ReturnStatus `json:"from,omitempty" bson:"from,omitempty"`
+	To        ReturnStatus `json:"to" bson:"to"`
+	Actor     OrderActor   `json:"actor" bson:"actor"`
+	Note      string       `json:"note,omitempty" bson:"note,omitempty"`
+	ChangedAt time.Time    `json:"changedAt" bson:"changedAt"`
+}
+
+// CreateReturnRequest represents a customer's request to return order items
+type CreateReturnRequest struct {
+	OrderID string                    `json:"orderId" binding:"required"`
+	Items   []CreateReturnItemRequest `json:"items" binding:"required,min=1,dive"`
+	Comment string                    `json:"comment,omitempty"`
+}
+
+// CreateReturnItemRequest selects units of one order line to return
+type CreateReturnItemRequest struct {
+	LineIndex int              `json:"lineIndex" binding:"min=0"`
+	Quantity  int              `json:"quantity" binding:"required,min=1"`
+	Reason    ReturnReasonCode `json:"reason" binding:"required"`
+	Comment   string           `json:"comment,omitempty"`
+}
+
+// SchedulePickupRequest represents the request to schedule a return pickup
+type SchedulePickupRequest struct {
+	Address        *Address  `json:"address,omitempty"` // Defaults to the order's shipping address
+	ScheduledDate  time.Time `json:"scheduledDate" binding:"required"`
+	Slot           string    `json:"slot,omitempty"`
+	Carrier        string    `json:"carrier,omitempty"`
+	TrackingNumber string    `json:"trackingNumber,omitempty"`
+}
+
+// QualityCheckRequest records how many units of each returned line were accepted
+type QualityCheckRequest struct {
+	Items []QualityCheckItem `json:"items" binding:"required,min=1,dive"`
+	Notes string             `json:"notes,omitempty"`
+}
+
+// QualityCheckItem is the accepted quantity for one returned line
+type QualityCheckItem struct {
+	LineIndex        int `json:"lineIndex" binding:"min=0"`
+	AcceptedQuantity int `json:"acceptedQuantity" binding:"min=0"`
+}
+
+// ReturnEligibility describes what can still be returned from an order
+type ReturnEligibility struct {
+	OrderID        primitive.ObjectID    `json:"orderId"`
+	Eligible       bool                  `json:"eligible"`
+	Reason         string                `json:"reason,omitempty"` // Why the order cannot be returned
+	ReturnDeadline *time.Time            `json:"returnDeadline,omitempty"`
+	Items          []ReturnableOrderItem `json:"items"`
+}
+
+// ReturnableOrderItem is the returnable quantity of one order line
+type ReturnableOrderItem struct {
+	LineIndex          int                `json:"lineIndex"`
+	ProductID          primitive.ObjectID `json:"productId"`
+	Name               string             `json:"name"`
+	Quantity           int                `json:"quantity"`
+	ReturnableQuantity int                `json:"returnableQuantity"`
+}
+
+// ReturnFilter represents filters for listing return requests
+type ReturnFilter struct {
+	Status  *ReturnStatus       `json:"status,omitempty"`
+	OrderID *primitive.ObjectID `json:"orderId,omitempty"`
+	Page    int                 `json:"page"`
+	Limit   int                 `json:"limit"`
+}
+
+// CanTransitionTo checks the return status transition table
+func (r *ReturnRequest) CanTransitionTo(status ReturnStatus) bool {
+	for _, next := range returnStatusTransitions[r.Status] {
+		if next == status {
+			return true
+		}
+	}
+	return false
+}
+
+// TransitionTo moves the return request to status and records who did it
+func (r *ReturnRequest) TransitionTo(status ReturnStatus, actor OrderActor, note string) error {
+	if !r.CanTransitionTo(status) {
+		return fmt.Errorf("%w: %s to %s", ErrInvalidReturnStatusTransition, r.Status, status)
+	}
+
+	now := time.Now()
+	r.StatusHistory = append(r.StatusHistory, ReturnStatusChange{
+		From:      r.Status,
+		To:        status,
+		Actor:     actor,
+		Note:      note,
+		ChangedAt: now,
+	})
+	r.Status = status
+	r.UpdatedAt = now
+
+	switch status {
+	case ReturnStatusReceived:
+		r.ReceivedAt = &now
+	case ReturnStatusRejected, ReturnStatusRefunded, ReturnStatusClosed, ReturnStatusCancelled:
+		r.ClosedAt = &now
+	}
+	return nil
+}
+
+// HoldsUnits reports whether the request still claims its units, so they
+// cannot be returned again. Rejected and withdrawn requests release them; a
+// closed request keeps them since the quality check already refused them.
+func (r *ReturnRequest) HoldsUnits() bool {
+	return r.Status != ReturnStatusRejected && r.Status != ReturnStatusCancelled
+}
+
+// IsOwnedBy checks whether the customer actor placed the order being returned
+func (r *ReturnRequest) IsOwnedBy(actor OrderActor) bool {
+	if actor.ID == "" {
+		return false
+	}
+	if !r.UserID.IsZero() {
+		return r.UserID.Hex() == actor.ID
+	}
+	return r.GuestSessionID == actor.ID
+}
@@ -19,6 +19,7 @@ type SearchRequest struct {
 	Brand      string                 `json:"brand,omitempty" form:"brand"`
 	Tags       []string               `json:"tags,omitempty" form:"tags"`
 	InStock    *bool                  `json:"inStock,omitempty" form:"inStock"`
+	LocationID string                 `json:"locationId,omitempty" form:"locationId"` // In stock at the location, for click-and-collect
 	Featured   *bool                  `json:"featured,omitempty" form:"featured"`
 	OnSale     *bool                  `json:"onSale,omitempty" form:"onSale"`
 	SortBy     string                 `json:"sortBy,omitempty" form:"sortBy"` // price_asc, price_desc, name_asc, name_desc, rating_desc, newest
@@ -50,6 +51,7 @@ type SearchFacets struct {
 	PriceRanges  []PriceRange `json:"priceRanges"`
 	Purities     []FacetItem `json:"purities"`
 	Tags         []FacetItem `json:"tags"`
+	Locations    []FacetItem `json:"locations"` // Location IDs with the number of matching products in stock there
 }
 
 // FacetItem represents a facet item with count
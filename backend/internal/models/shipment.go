@@ -0,0 +1,122 @@
+package models
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Tracking statuses reported for a shipment. Carriers' own statuses are
+// normalized to these where they match; others are kept as reported.
+const (
+	TrackingStatusCreated        = "created" // Shipment booked, waiting for pickup
+	TrackingStatusPickedUp       = "picked_up"
+	TrackingStatusInTransit      = "in_transit"
+	TrackingStatusOutForDelivery = "out_for_delivery"
+	TrackingStatusDelivered      = "delivered"
+	TrackingStatusException      = "exception" // Delivery attempt failed, address issue, etc.
+	TrackingStatusCancelled      = "cancelled"
+)
+
+// trackingMilestones maps tracking statuses to the order status they move the order to
+var trackingMilestones = map[string]OrderStatus{
+	TrackingStatusPickedUp:       OrderStatusShipped,
+	TrackingStatusInTransit:      OrderStatusShipped,
+	TrackingStatusOutForDelivery: OrderStatusOutForDelivery,
+	TrackingStatusDelivered:      OrderStatusDelivered,
+}
+
+// TrackingMilestone returns the order status a tracking status advances the order to
+func TrackingMilestone(status string) (OrderStatus, bool) {
+	orderStatus, ok := trackingMilestones[status]
+	return orderStatus, ok
+}
+
+// NormalizeTrackingStatus lowercases a carrier status and joins its words with
+// underscores, e.g. "Out For Delivery" becomes "out_for_delivery"
+func NormalizeTrackingStatus(status string) string {
+	return strings.ToLower(strings.Join(strings.Fields(strings.ReplaceAll(status, "-", " ")), "_"))
+}
+
+// CarrierInfo describes a registered shipping carrier
+type CarrierInfo struct {
+	Code    string `json:"code"`
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+}
+
+// CreateShipmentRequest represents an admin booking a shipment for an order
+type CreateShipmentRequest struct {
+	Carrier        string  `json:"carrier" binding:"required"`       // Registered carrier code, e.g. "manual"
+	TrackingNumber string  `json:"trackingNumber,omitempty"`         // AWB number; required for the manual carrier
+	CourierName    string  `json:"courierName,omitempty"`            // Courier that carries a manual shipment
+	Service        string  `json:"service,omitempty"`                // e.g. "express", "surface"
+	Weight         float64 `json:"weight,omitempty" binding:"min=0"` // Grams
+}
+
+// AddTrackingEventRequest represents a tracking update entered by hand
+type AddTrackingEventRequest struct {
+	Status      string     `json:"status" binding:"required"`
+	Description string     `json:"description,omitempty"`
+	Location    string     `json:"location,omitempty"`
+	Timestamp   *time.Time `json:"timestamp,omitempty"` // Defaults to now
+	SignedBy    string     `json:"signedBy,omitempty"`
+}
+
+// IsActive reports whether the shipment is still being tracked
+func (t *OrderTracking) IsActive() bool {
+	return t.Status != TrackingStatusDelivered && t.Status != TrackingStatusCancelled
+}
+
+// AddEvents merges tracking events into the shipment, skipping ones already
+// recorded with the same status and time. Events are kept in time order and
+// the latest one sets the shipment's status and location. The new events are
+// returned, oldest first.
+func (t *OrderTracking) AddEvents(events []TrackingEvent) []TrackingEvent {
+	seen := make(map[string]bool, len(t.Events))
+	for _, event := range t.Events {
+		seen[event.Status+"|"+event.Timestamp.UTC().Format(time.RFC3339)] = true
+	}
+
+	var added []TrackingEvent
+	for _, event := range events {
+		event.Status = NormalizeTrackingStatus(event.Status)
+		if event.Status == "" {
+			continue
+		}
+		if event.Timestamp.IsZero() {
+			event.Timestamp = time.Now()
+		}
+		key := event.Status + "|" + event.Timestamp.UTC().Format(time.RFC3339)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		_, event.IsMilestone = TrackingMilestone(event.Status)
+		event.IsDelivered = event.Status == TrackingStatusDelivered
+		added = append(added, event)
+	}
+	if len(added) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(added, func(i, j int) bool { return added[i].Timestamp.Before(added[j].Timestamp) })
+	t.Events = append(t.Events, added...)
+	sort.SliceStable(t.Events, func(i, j int) bool { return t.Events[i].Timestamp.Before(t.Events[j].Timestamp) })
+
+	latest := t.Events[len(t.Events)-1]
+	if t.Status != TrackingStatusCancelled {
+		t.Status = latest.Status
+	}
+	if latest.Location != "" {
+		t.CurrentLocation = latest.Location
+	}
+	for _, event := range added {
+		if event.IsDelivered && t.ActualDelivery == nil {
+			delivered := event.Timestamp
+			t.ActualDelivery = &delivered
+		}
+	}
+	return added
+}
@@ -0,0 +1,96 @@
+package models
+
+import "strings"
+
+const (
+	// DefaultShippingSlabGrams is the weight covered by each shipping slab
+	DefaultShippingSlabGrams = 500.0
+	// DefaultInsuranceThreshold is the order value above which shipments are insured
+	DefaultInsuranceThreshold = 50000.0
+	// DefaultInsuranceRate is the insurance surcharge as a percentage of the order value
+	DefaultInsuranceRate = 0.5
+)
+
+// ShippingZone is a delivery zone made of pincode prefixes. The first weight
+// slab costs BaseRate and every further slab AdditionalSlabRate.
+type ShippingZone struct {
+	Name               string   `json:"name" bson:"name"`
+	PincodePrefixes    []string `json:"pincodePrefixes" bson:"pincodePrefixes"` // e.g. "400" for Mumbai
+	BaseRate           float64  `json:"baseRate" bson:"baseRate"`
+	AdditionalSlabRate float64  `json:"additionalSlabRate" bson:"additionalSlabRate"`
+	EstimatedDays      int      `json:"estimatedDays" bson:"estimatedDays"`
+	CODAvailable       bool     `json:"codAvailable" bson:"codAvailable"`
+}
+
+// Parcel describes what is being shipped
+type Parcel struct {
+	Weight float64 // Grams
+	Value  float64 // Order value after discount, before tax and shipping
+	Tax    float64
+}
+
+// ShippingQuote is the shipping charge and COD terms for a parcel to a pincode
+type ShippingQuote struct {
+	Pincode         string  `json:"pincode,omitempty"`
+	Serviceable     bool    `json:"serviceable"`
+	Zone            string  `json:"zone,omitempty"`
+	EstimatedDays   int     `json:"estimatedDays,omitempty"`
+	Weight          float64 `json:"weight"` // Grams
+	Slabs           int     `json:"slabs"`
+	ZoneCharge      float64 `json:"zoneCharge"` // Zero when shipping is free
+	InsuranceCharge float64 `json:"insuranceCharge"`
+	FreeShipping    bool    `json:"freeShipping"`
+	Shipping        float64 `json:"shipping"` // Zone charge plus insurance
+	CODAvailable    bool    `json:"codAvailable"`
+	CODCharge       float64 `json:"codCharge"`
+	Message         string  `json:"message,omitempty"` // Why delivery or COD is not available
+}
+
+// Serviceability tells whether the store delivers to a pincode
+type Serviceability struct {
+	Pincode       string `json:"pincode"`
+	Serviceable   bool   `json:"serviceable"`
+	Zone          string `json:"zone,omitempty"`
+	EstimatedDays int    `json:"estimatedDays,omitempty"`
+	CODAvailable  bool   `json:"codAvailable"`
+}
+
+// ShippingZoneFor returns the zone with the longest pincode prefix matching
+// pincode. Without configured zones, or without a pincode, every order ships
+// at the standard shipping cost.
+func (s *StoreSettings) ShippingZoneFor(pincode string) (*ShippingZone, bool) {
+	pincode = strings.TrimSpace(pincode)
+	if len(s.ShippingZones) == 0 || pincode == "" {
+		return &ShippingZone{Name: "Standard", BaseRate: s.ShippingCost, CODAvailable: true}, true
+	}
+
+	var match *ShippingZone
+	longest := 0
+	for i := range s.ShippingZones {
+		for _, prefix := range s.ShippingZones[i].PincodePrefixes {
+			if len(prefix) > longest && strings.HasPrefix(pincode, prefix) {
+				match = &s.ShippingZones[i]
+				longest = len(prefix)
+			}
+		}
+	}
+	return match, match != nil
+}
+
+// ShippingSlab returns the weight of one shipping slab in grams
+func (s *StoreSettings) ShippingSlab() float64 {
+	if s.ShippingSlabGrams <= 0 {
+		return DefaultShippingSlabGrams
+	}
+	return s.ShippingSlabGrams
+}
+
+// DefaultShippingZones returns the zone table used until the store configures its own
+func DefaultShippingZones() []ShippingZone {
+	return []ShippingZone{
+		{Name: "Local", PincodePrefixes: []string{"400", "401", "410", "421"}, BaseRate: 49, AdditionalSlabRate: 20, EstimatedDays: 2, CODAvailable: true},
+		{Name: "Metro", PincodePrefixes: []string{"110", "411", "500", "560", "600", "700"}, BaseRate: 79, AdditionalSlabRate: 30, EstimatedDays: 3, CODAvailable: true},
+		{Name: "Rest of India", PincodePrefixes: []string{"1", "2", "3", "4", "5", "6", "7", "8"}, BaseRate: 99, AdditionalSlabRate: 40, EstimatedDays: 5, CODAvailable: true},
+		{Name: "Remote", PincodePrefixes: []string{"18", "19", "194", "744", "78", "79"}, BaseRate: 199, AdditionalSlabRate: 60, EstimatedDays: 8, CODAvailable: false},
+	}
+}
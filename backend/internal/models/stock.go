@@ -0,0 +1,99 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// StockMovementType identifies why a product's stock changed
+type StockMovementType string
+
+const (
+	StockMovementReserve StockMovementType = "reserve" // Held for an order awaiting payment
+	StockMovementRelease StockMovementType = "release" // Reservation expired or order cancelled before payment
+	StockMovementSale    StockMovementType = "sale"    // Reservation committed once the order is paid or confirmed as COD
+	StockMovementCancel  StockMovementType = "cancel"  // Committed order cancelled and restocked
+	StockMovementReturn  StockMovementType = "return"  // Returned items put back into stock
+	StockMovementAdjust  StockMovementType = "adjust"  // Manual correction, e.g. after a stock count
+	StockMovementImport  StockMovementType = "import"  // Units received from a supplier, workshop or product upload
+	StockMovementDamage  StockMovementType = "damage"  // Units written off as damaged or lost
+
+	StockMovementTransferOut StockMovementType = "transfer_out" // Sent to another location
+	StockMovementTransferIn  StockMovementType = "transfer_in"  // Received from another location, or back from a cancelled transfer
+)
+
+// DefaultReorderLevel is the stock at or below which a product without a
+// reorder level of its own is reported as low
+const DefaultReorderLevel = 10
+
+// StockReservationStatus tracks the stock held by an order
+type StockReservationStatus string
+
+const (
+	StockReservationReserved  StockReservationStatus = "reserved"
+	StockReservationCommitted StockReservationStatus = "committed"
+	StockReservationReleased  StockReservationStatus = "released"
+	StockReservationRestocked StockReservationStatus = "restocked"
+)
+
+// StockMovement is an append-only ledger entry for a change to a product's stock
+type StockMovement struct {
+	ID           primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	ProductID    primitive.ObjectID  `json:"productId" bson:"productId"`
+	VariantID    *primitive.ObjectID `json:"variantId,omitempty" bson:"variantId,omitempty"`
+	SKU          string              `json:"sku,omitempty" bson:"sku,omitempty"`
+	LocationID   *primitive.ObjectID `json:"locationId,omitempty" bson:"locationId,omitempty"` // For stock held per location
+	Type         StockMovementType   `json:"type" bson:"type"`
+	Quantity     int                 `json:"quantity" bson:"quantity"`                             // Units affected by the movement
+	Change       int                 `json:"change" bson:"change"`                                 // Signed effect on stockQuantity
+	BalanceAfter *int                `json:"balanceAfter,omitempty" bson:"balanceAfter,omitempty"` // Of the variant, for variant movements, and at the location, for location movements
+	OrderID      *primitive.ObjectID `json:"orderId,omitempty" bson:"orderId,omitempty"`
+	OrderNumber  string              `json:"orderNumber,omitempty" bson:"orderNumber,omitempty"`
+	Reference    string              `json:"reference,omitempty" bson:"reference,omitempty"` // Purchase invoice, upload batch or damage report
+	Reason       string              `json:"reason,omitempty" bson:"reason,omitempty"`
+	Actor        OrderActor          `json:"actor" bson:"actor"` // The system for order movements
+	CreatedAt    time.Time           `json:"createdAt" bson:"createdAt"`
+}
+
+// StockAdjustmentRequest records a stock change made outside of orders.
+// Quantity is the units received for imports and written off for damage, and
+// the signed change for adjustments.
+type StockAdjustmentRequest struct {
+	VariantID  string            `json:"variantId,omitempty"`  // Required for products sold by variant
+	LocationID string            `json:"locationId,omitempty"` // Defaults to the default location once locations are set up
+	Type       StockMovementType `json:"type" binding:"required,oneof=adjust import damage"`
+	Quantity   int               `json:"quantity" binding:"required"`
+	Reference  string            `json:"reference,omitempty"`
+	Reason     string            `json:"reason,omitempty"`
+}
+
+// StockLedgerFilter selects stock movements, newest first
+type StockLedgerFilter struct {
+	ProductID  *primitive.ObjectID `json:"productId,omitempty"`
+	LocationID *primitive.ObjectID `json:"locationId,omitempty"`
+	Type       StockMovementType   `json:"type,omitempty"`
+	From       *time.Time          `json:"from,omitempty"`
+	To         *time.Time          `json:"to,omitempty"` // Exclusive
+	Page       int                 `json:"page"`
+	Limit      int                 `json:"limit"`
+}
+
+// IsManual reports whether the movement type is entered by staff rather than
+// recorded by an order
+func (t StockMovementType) IsManual() bool {
+	return t == StockMovementAdjust || t == StockMovementImport || t == StockMovementDamage
+}
+
+// ReorderThreshold returns the stock at or below which the product is low
+func (p *Product) ReorderThreshold() int {
+	if p.ReorderLevel != nil {
+		return *p.ReorderLevel
+	}
+	return DefaultReorderLevel
+}
+
+// IsLowStock reports whether a stocked, available product is at or below its reorder level
+func (p *Product) IsLowStock() bool {
+	return p.StockType != StockTypeMadeToOrder && p.IsAvailable && p.StockQuantity <= p.ReorderThreshold()
+}
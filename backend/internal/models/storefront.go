@@ -440,22 +440,36 @@ type StoneType struct {
 type StoreSettings struct {
 	ID                    primitive.ObjectID `json:"id" bson:"_id,omitempty"`
 	// Tax Settings
-	GSTRate               float64            `json:"gstRate" bson:"gstRate"`                           // GST percentage (e.g., 18 for 18%)
+	GSTRate               float64            `json:"gstRate" bson:"gstRate"`                           // GST percentage for categories without a GST rule (e.g., 3 for 3%)
 	GSTNumber             string             `json:"gstNumber" bson:"gstNumber"`                       // Store GST number
 	EnableGST             bool               `json:"enableGst" bson:"enableGst"`                       // Enable/disable GST
+	StoreState            string             `json:"storeState" bson:"storeState"`                     // State the store supplies from; decides CGST/SGST or IGST
+	GSTRules              []GSTRule          `json:"gstRules" bson:"gstRules"`                         // HSN code and rate per product category
+	MakingChargeSAC       string             `json:"makingChargeSac" bson:"makingChargeSac"`           // Service code for making charges
+	MakingChargeGSTRate   float64            `json:"makingChargeGstRate" bson:"makingChargeGstRate"`   // GST percentage on making charges
 	// Shipping Settings
 	FreeShippingThreshold float64            `json:"freeShippingThreshold" bson:"freeShippingThreshold"` // Minimum order for free shipping
 	ShippingCost          float64            `json:"shippingCost" bson:"shippingCost"`                   // Standard shipping cost
 	EnableFreeShipping    bool               `json:"enableFreeShipping" bson:"enableFreeShipping"`       // Enable free shipping above threshold
+	ShippingZones         []ShippingZone     `json:"shippingZones" bson:"shippingZones"`                 // Rates by pincode prefix; empty ships everywhere at shippingCost
+	ShippingSlabGrams     float64            `json:"shippingSlabGrams" bson:"shippingSlabGrams"`         // Weight covered by each rate slab (0 uses the default)
+	InsuranceThreshold    float64            `json:"insuranceThreshold" bson:"insuranceThreshold"`       // Order value above which shipments are insured
+	InsuranceRate         float64            `json:"insuranceRate" bson:"insuranceRate"`                 // Insurance percentage of the order value
 	// COD Settings
 	EnableCOD             bool               `json:"enableCod" bson:"enableCod"`                         // Enable Cash on Delivery
 	CODCharge             float64            `json:"codCharge" bson:"codCharge"`                         // Extra charge for COD
 	CODMaxAmount          float64            `json:"codMaxAmount" bson:"codMaxAmount"`                   // Maximum order value for COD
+	// Return Settings
+	ReturnWindowDays      int                `json:"returnWindowDays" bson:"returnWindowDays"`           // Days after delivery a return can be requested (0 uses the default)
+	// Warranty Settings
+	WarrantyPolicies      []WarrantyPolicy   `json:"warrantyPolicies" bson:"warrantyPolicies"`           // Warranty per product category, issued on delivery
 	// Store Info
 	StoreName             string             `json:"storeName" bson:"storeName"`
 	StoreEmail            string             `json:"storeEmail" bson:"storeEmail"`
 	StorePhone            string             `json:"storePhone" bson:"storePhone"`
 	StoreAddress          string             `json:"storeAddress" bson:"storeAddress"`
+	StoreCity             string             `json:"storeCity" bson:"storeCity"`                         // Seller location on e-invoices
+	StorePincode          string             `json:"storePincode" bson:"storePincode"`                   // Seller pincode on e-invoices
 	Currency              string             `json:"currency" bson:"currency"`                           // INR, USD, etc.
 	CurrencySymbol        string             `json:"currencySymbol" bson:"currencySymbol"`               // ₹, $, etc.
 	// Order ID Settings
@@ -478,16 +492,28 @@ type StoreSettingsResponse struct {
 	GSTRate               float64        `json:"gstRate"`
 	GSTNumber             string         `json:"gstNumber"`
 	EnableGST             bool           `json:"enableGst"`
+	StoreState            string         `json:"storeState"`
+	GSTRules              []GSTRule      `json:"gstRules"`
+	MakingChargeSAC       string         `json:"makingChargeSac"`
+	MakingChargeGSTRate   float64        `json:"makingChargeGstRate"`
 	FreeShippingThreshold float64        `json:"freeShippingThreshold"`
 	ShippingCost          float64        `json:"shippingCost"`
 	EnableFreeShipping    bool           `json:"enableFreeShipping"`
+	ShippingZones         []ShippingZone `json:"shippingZones"`
+	ShippingSlabGrams     float64        `json:"shippingSlabGrams"`
+	InsuranceThreshold    float64        `json:"insuranceThreshold"`
+	InsuranceRate         float64        `json:"insuranceRate"`
 	EnableCOD             bool           `json:"enableCod"`
 	CODCharge             float64        `json:"codCharge"`
 	CODMaxAmount          float64        `json:"codMaxAmount"`
+	ReturnWindowDays      int            `json:"returnWindowDays"`
+	WarrantyPolicies      []WarrantyPolicy `json:"warrantyPolicies"`
 	StoreName             string         `json:"storeName"`
 	StoreEmail            string         `json:"storeEmail"`
 	StorePhone            string         `json:"storePhone"`
 	StoreAddress          string         `json:"storeAddress"`
+	StoreCity             string         `json:"storeCity"`
+	StorePincode          string         `json:"storePincode"`
 	Currency              string         `json:"currency"`
 	CurrencySymbol        string         `json:"currencySymbol"`
 	OrderIdPrefix         string         `json:"orderIdPrefix"`
@@ -507,16 +533,28 @@ func (s *StoreSettings) ToResponse() StoreSettingsResponse {
 		GSTRate:               s.GSTRate,
 		GSTNumber:             s.GSTNumber,
 		EnableGST:             s.EnableGST,
+		StoreState:            s.SupplyState(),
+		GSTRules:              s.GSTRules,
+		MakingChargeSAC:       s.MakingChargeRule().HSNCode,
+		MakingChargeGSTRate:   s.MakingChargeRule().Rate,
 		FreeShippingThreshold: s.FreeShippingThreshold,
 		ShippingCost:          s.ShippingCost,
 		EnableFreeShipping:    s.EnableFreeShipping,
+		ShippingZones:         s.ShippingZones,
+		ShippingSlabGrams:     s.ShippingSlab(),
+		InsuranceThreshold:    s.InsuranceThreshold,
+		InsuranceRate:         s.InsuranceRate,
 		EnableCOD:             s.EnableCOD,
 		CODCharge:             s.CODCharge,
 		CODMaxAmount:          s.CODMaxAmount,
+		ReturnWindowDays:      s.ReturnWindow(),
+		WarrantyPolicies:      s.WarrantyPolicyList(),
 		StoreName:             s.StoreName,
 		StoreEmail:            s.StoreEmail,
 		StorePhone:            s.StorePhone,
 		StoreAddress:          s.StoreAddress,
+		StoreCity:             s.StoreCity,
+		StorePincode:          s.StorePincode,
 		Currency:              s.Currency,
 		CurrencySymbol:        s.CurrencySymbol,
 		OrderIdPrefix:         s.OrderIdPrefix,
@@ -530,22 +568,45 @@ func (s *StoreSettings) ToResponse() StoreSettingsResponse {
 	}
 }
 
+// DefaultReturnWindowDays is the return window used when none is configured
+const DefaultReturnWindowDays = 7
+
+// ReturnWindow returns the number of days after delivery a return can be
+// requested. Settings saved before returns were configurable use the default.
+func (s *StoreSettings) ReturnWindow() int {
+	if s.ReturnWindowDays <= 0 {
+		return DefaultReturnWindowDays
+	}
+	return s.ReturnWindowDays
+}
+
 // DefaultStoreSettings returns default store settings
 func DefaultStoreSettings() *StoreSettings {
 	return &StoreSettings{
-		GSTRate:               18.0,
+		GSTRate:               DefaultJewelleryGSTRate,
 		GSTNumber:             "",
 		EnableGST:             true,
+		StoreState:            DefaultStoreState,
+		GSTRules:              DefaultGSTRules(),
+		MakingChargeSAC:       DefaultMakingChargeSAC,
+		MakingChargeGSTRate:   DefaultMakingChargeGSTRate,
 		FreeShippingThreshold: 1000.0,
 		ShippingCost:          99.0,
 		EnableFreeShipping:    true,
+		ShippingZones:         DefaultShippingZones(),
+		ShippingSlabGrams:     DefaultShippingSlabGrams,
+		InsuranceThreshold:    DefaultInsuranceThreshold,
+		InsuranceRate:         DefaultInsuranceRate,
 		EnableCOD:             true,
 		CODCharge:             0.0,
 		CODMaxAmount:          50000.0,
+		ReturnWindowDays:      DefaultReturnWindowDays,
+		WarrantyPolicies:      DefaultWarrantyPolicies(),
 		StoreName:             "Thyne Jewels",
 		StoreEmail:            "support@thynejewels.com",
 		StorePhone:            "+91 9876543210",
 		StoreAddress:          "Mumbai, India",
+		StoreCity:             "Mumbai",
 		Currency:              "INR",
 		CurrencySymbol:        "₹",
 		OrderIdPrefix:         "TJ",
@@ -0,0 +1,248 @@
+package models
+
+import (
+	"math"
+	"regexp"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// DefaultJewelleryHSN is the HSN code for articles of jewellery of precious metal
+	DefaultJewelleryHSN = "7113"
+	// DefaultJewelleryGSTRate is the GST rate on jewellery goods
+	DefaultJewelleryGSTRate = 3.0
+	// DefaultMakingChargeSAC is the service code for jewellery job work (making charges)
+	DefaultMakingChargeSAC = "998892"
+	// DefaultMakingChargeGSTRate is the GST rate on making charges
+	DefaultMakingChargeGSTRate = 5.0
+	// DefaultStoreState is the state the store supplies from when none is configured
+	DefaultStoreState = "Maharashtra"
+)
+
+// TaxComponent identifies which part of a line's price a tax line covers
+type TaxComponent string
+
+const (
+	TaxComponentGoods  TaxComponent = "goods"  // Metal, stones and other materials
+	TaxComponentMaking TaxComponent = "making" // Making charges
+)
+
+// GSTRule maps a product category to its HSN code and GST rate
+type GSTRule struct {
+	Category string  `json:"category" bson:"category"`
+	HSNCode  string  `json:"hsnCode" bson:"hsnCode"`
+	Rate     float64 `json:"rate" bson:"rate"` // Percentage, e.g. 3 for 3%
+}
+
+// TaxableLine is one order or cart line handed to the GST calculator
+type TaxableLine struct {
+	LineIndex    int
+	ProductID    primitive.ObjectID
+	Name         string
+	Category     string
+	Quantity     int
+	UnitPrice    float64
+	MakingCharge float64 // Part of the unit price that is making charges
+}
+
+// TaxBreakdown is the GST computed for an order, line by line. Intra-state
+// supplies are split equally into CGST and SGST; inter-state supplies pay IGST.
+type TaxBreakdown struct {
+	SupplierGSTIN string    `json:"supplierGstin,omitempty" bson:"supplierGstin,omitempty"`
+	SupplierState string    `json:"supplierState" bson:"supplierState"`
+	PlaceOfSupply string    `json:"placeOfSupply" bson:"placeOfSupply"` // Shipping state
+	InterState    bool      `json:"interState" bson:"interState"`
+	TaxableValue  float64   `json:"taxableValue" bson:"taxableValue"`
+	CGST          float64   `json:"cgst" bson:"cgst"`
+	SGST          float64   `json:"sgst" bson:"sgst"`
+	IGST          float64   `json:"igst" bson:"igst"`
+	Total         float64   `json:"total" bson:"total"`
+	Lines         []LineTax `json:"lines" bson:"lines"`
+}
+
+// LineTax is the GST on the goods or making charge part of one line
+type LineTax struct {
+	LineIndex    int                `json:"lineIndex" bson:"lineIndex"`
+	ProductID    primitive.ObjectID `json:"productId" bson:"productId"`
+	Description  string             `json:"description" bson:"description"`
+	Component    TaxComponent       `json:"component" bson:"component"`
+	HSNCode      string             `json:"hsnCode" bson:"hsnCode"`
+	Quantity     int                `json:"quantity" bson:"quantity"`
+	TaxableValue float64            `json:"taxableValue" bson:"taxableValue"` // After the line's share of the order discount
+	Rate         float64            `json:"rate" bson:"rate"`
+	CGST         float64            `json:"cgst" bson:"cgst"`
+	SGST         float64            `json:"sgst" bson:"sgst"`
+	IGST         float64            `json:"igst" bson:"igst"`
+	Total        float64            `json:"total" bson:"total"`
+}
+
+// LineTotal returns the GST charged on the order line at index
+func (b *TaxBreakdown) LineTotal(index int) float64 {
+	total := 0.0
+	for _, line := range b.Lines {
+		if line.LineIndex == index {
+			total += line.Total
+		}
+	}
+	return total
+}
+
+// Details summarizes the breakdown for an invoice. The HSN code is only set
+// when every goods line shares it.
+func (b *TaxBreakdown) Details(storeAddress string) TaxDetails {
+	details := TaxDetails{
+		TaxType:    "GST",
+		TaxID:      b.SupplierGSTIN,
+		TaxAddress: storeAddress,
+		CGST:       b.CGST,
+		SGST:       b.SGST,
+		IGST:       b.IGST,
+	}
+	if b.TaxableValue > 0 {
+		details.TaxRate = math.Round(b.Total/b.TaxableValue*10000) / 100
+	}
+
+	for _, line := range b.Lines {
+		if line.Component != TaxComponentGoods {
+			continue
+		}
+		if details.HSNCode == "" {
+			details.HSNCode = line.HSNCode
+		} else if details.HSNCode != line.HSNCode {
+			details.HSNCode = ""
+			break
+		}
+	}
+
+	return details
+}
+
+// GSTRuleFor returns the HSN code and rate for a product category. Categories
+// without a rule use the jewellery HSN code and the store GST rate.
+func (s *StoreSettings) GSTRuleFor(category string) GSTRule {
+	for _, rule := range s.GSTRules {
+		if strings.EqualFold(strings.TrimSpace(rule.Category), strings.TrimSpace(category)) {
+			return rule
+		}
+	}
+	return GSTRule{Category: category, HSNCode: DefaultJewelleryHSN, Rate: s.GSTRate}
+}
+
+// MakingChargeRule returns the service code and GST rate for making charges.
+// Settings saved before making charges were configurable use the defaults.
+func (s *StoreSettings) MakingChargeRule() GSTRule {
+	rule := GSTRule{HSNCode: s.MakingChargeSAC, Rate: s.MakingChargeGSTRate}
+	if rule.HSNCode == "" {
+		rule.HSNCode = DefaultMakingChargeSAC
+	}
+	if rule.Rate <= 0 {
+		rule.Rate = DefaultMakingChargeGSTRate
+	}
+	return rule
+}
+
+// SupplyState returns the state the store ships from
+func (s *StoreSettings) SupplyState() string {
+	if strings.TrimSpace(s.StoreState) == "" {
+		return DefaultStoreState
+	}
+	return s.StoreState
+}
+
+// DefaultGSTRules returns the HSN and rate table for the store's categories
+func DefaultGSTRules() []GSTRule {
+	return []GSTRule{
+		{Category: "Rings", HSNCode: "7113", Rate: 3},
+		{Category: "Necklaces", HSNCode: "7113", Rate: 3},
+		{Category: "Earrings", HSNCode: "7113", Rate: 3},
+		{Category: "Bracelets", HSNCode: "7113", Rate: 3},
+		{Category: "Bangles", HSNCode: "7113", Rate: 3},
+		{Category: "Pendants", HSNCode: "7113", Rate: 3},
+		{Category: "Coins", HSNCode: "7118", Rate: 3},
+		{Category: "Loose Diamonds", HSNCode: "7102", Rate: 0.25},
+		{Category: "Gemstones", HSNCode: "7103", Rate: 0.25},
+		{Category: "Imitation Jewellery", HSNCode: "7117", Rate: 3},
+	}
+}
+
+// gstStateCodes maps Indian states and union territories to their GST state codes
+var gstStateCodes = map[string]string{
+	"jammu and kashmir": "01", "himachal pradesh": "02", "punjab": "03", "chandigarh": "04",
+	"uttarakhand": "05", "haryana": "06", "delhi": "07", "rajasthan": "08", "uttar pradesh": "09",
+	"bihar": "10", "sikkim": "11", "arunachal pradesh": "12", "nagaland": "13", "manipur": "14",
+	"mizoram": "15", "tripura": "16", "meghalaya": "17", "assam": "18", "west bengal": "19",
+	"jharkhand": "20", "odisha": "21", "chhattisgarh": "22", "madhya pradesh": "23", "gujarat": "24",
+	"dadra and nagar haveli and daman and diu": "26", "maharashtra": "27", "karnataka": "29",
+	"goa": "30", "lakshadweep": "31", "kerala": "32", "tamil nadu": "33", "puducherry": "34",
+	"andaman and nicobar islands": "35", "telangana": "36", "andhra pradesh": "37", "ladakh": "38",
+}
+
+// gstStateAliases maps common alternative spellings and abbreviations to state names
+var gstStateAliases = map[string]string{
+	"new delhi": "delhi", "nct of delhi": "delhi", "orissa": "odisha", "pondicherry": "puducherry",
+	"j&k": "jammu and kashmir", "jammu & kashmir": "jammu and kashmir", "uttaranchal": "uttarakhand",
+	"andaman & nicobar islands": "andaman and nicobar islands", "daman and diu": "dadra and nagar haveli and daman and diu",
+	"dadra and nagar haveli": "dadra and nagar haveli and daman and diu",
+	"mh":                     "maharashtra", "dl": "delhi", "ka": "karnataka", "tn": "tamil nadu", "gj": "gujarat",
+	"rj": "rajasthan", "up": "uttar pradesh", "wb": "west bengal", "ts": "telangana", "tg": "telangana",
+	"ap": "andhra pradesh", "kl": "kerala", "hr": "haryana", "pb": "punjab", "mp": "madhya pradesh",
+}
+
+// GSTStateCode returns the two digit GST code of a state, or "" if the state is not recognised
+func GSTStateCode(state string) string {
+	name := strings.ToLower(strings.Join(strings.Fields(state), " "))
+	if alias, ok := gstStateAliases[name]; ok {
+		name = alias
+	}
+	return gstStateCodes[name]
+}
+
+// SameGSTState reports whether two states are the same for GST. Unrecognised
+// states are compared by name.
+func SameGSTState(a, b string) bool {
+	codeA, codeB := GSTStateCode(a), GSTStateCode(b)
+	if codeA != "" && codeB != "" {
+		return codeA == codeB
+	}
+	return strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b))
+}
+
+// IsGSTStateCode reports whether code is the GST code of a state or union territory
+func IsGSTStateCode(code string) bool {
+	for _, known := range gstStateCodes {
+		if known == code {
+			return true
+		}
+	}
+	return false
+}
+
+// gstinPattern is the layout of a regular taxpayer's GSTIN: state code, PAN,
+// entity number, the letter Z and a check character
+var gstinPattern = regexp.MustCompile(`^[0-9]{2}[A-Z]{5}[0-9]{4}[A-Z][1-9A-Z]Z[0-9A-Z]$`)
+
+const gstinCharset = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// NormalizeGSTIN upper-cases a GSTIN and strips spaces
+func NormalizeGSTIN(gstin string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(gstin), ""))
+}
+
+// ValidGSTIN reports whether gstin is well formed, names a known state and
+// carries the right check character
+func ValidGSTIN(gstin string) bool {
+	if !gstinPattern.MatchString(gstin) || !IsGSTStateCode(gstin[:2]) {
+		return false
+	}
+
+	// Base 36 Luhn: odd positions count once, even positions twice, and
+	// each product is folded back into base 36
+	sum := 0
+	for i := 0; i < 14; i++ {
+		product := strings.IndexByte(gstinCharset, gstin[i]) * (i%2 + 1)
+		sum += product/36 + product%36
+	}
+	return gstin[14] == gstinCharset[(36-sum%36)%36]
+}
@@ -19,6 +19,7 @@ type User struct {
     IsActive     bool               `json:"isActive" bson:"isActive"`
     IsVerified   bool               `json:"isVerified" bson:"isVerified"`
     IsAdmin      bool               `json:"isAdmin" bson:"isAdmin"`
+    LocationIDs  []primitive.ObjectID `json:"locationIds,omitempty" bson:"locationIds,omitempty"` // Stock locations the user works at as store staff
     CreatedAt    time.Time          `json:"createdAt" bson:"createdAt"`
     UpdatedAt    time.Time          `json:"updatedAt" bson:"updatedAt"`
 }
@@ -105,12 +106,14 @@ type CreateUserRequest struct {
     Email    string `json:"email" validate:"required,email,min=5,max=100"`
     Phone    string `json:"phone" validate:"required,min=10,max=15"`
     Password string `json:"password" validate:"required,min=6"`
+    GuestSessionID string `json:"guestSessionId,omitempty"` // Guest session to merge into the new account
 }
 
 // LoginRequest represents the login request
 type LoginRequest struct {
     Email    string `json:"email" validate:"min=5,max=100"`
     Password string `json:"password"`
+    GuestSessionID string `json:"guestSessionId,omitempty"` // Guest session to merge into the account
 }
 
 // LoginResponse represents the login response
@@ -119,6 +122,7 @@ type LoginResponse struct {
 	AccessToken  string `json:"accessToken"`
 	RefreshToken string `json:"refreshToken"`
 	ExpiresIn    int64  `json:"expiresIn"`
+	GuestMerge   *GuestMergeResult `json:"guestMerge,omitempty"`
 }
 
 // UpdateProfileRequest represents the request to update user profile
@@ -226,6 +230,19 @@ func (u *User) GetDefaultAddress() *Address {
 	return nil
 }
 
+// WorksAt reports whether the user is store staff at the location. Admins work at every location.
+func (u *User) WorksAt(locationID primitive.ObjectID) bool {
+	if u.IsAdmin {
+		return true
+	}
+	for _, id := range u.LocationIDs {
+		if id == locationID {
+			return true
+		}
+	}
+	return false
+}
+
 // SetDefaultAddress sets the specified address as default and unsets others
 func (u *User) SetDefaultAddress(addressID primitive.ObjectID) {
 	for i := range u.Addresses {
@@ -0,0 +1,297 @@
+package models
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MaxProductVariants bounds the option combinations a product can be split into
+const MaxProductVariants = 200
+
+// ProductVariant is one sellable combination of a product's options, such as
+// an 18K ring in size 7, with its own SKU and stock. A product with variants
+// keeps the sum of their stock in its own StockQuantity.
+type ProductVariant struct {
+	ID            primitive.ObjectID `json:"id" bson:"id"`
+	SKU           string             `json:"sku" bson:"sku"`
+	Barcode       string             `json:"barcode,omitempty" bson:"barcode,omitempty"`
+	Metal         string             `json:"metal,omitempty" bson:"metal,omitempty"`             // One of the product's AvailableMetals
+	Size          string             `json:"size,omitempty" bson:"size,omitempty"`               // One of the product's AvailableSizes
+	StoneColors   map[string]string  `json:"stoneColors,omitempty" bson:"stoneColors,omitempty"` // Stone name -> color
+	Price         *float64           `json:"price,omitempty" bson:"price,omitempty"`             // Replaces the product price and the modifiers of the options above
+	Weight        *float64           `json:"weight,omitempty" bson:"weight,omitempty"`           // Grams; the net weight of metal_rate products
+	StockQuantity int                `json:"stockQuantity" bson:"stockQuantity"`
+	IsActive      bool               `json:"isActive" bson:"isActive"`
+	CreatedAt     time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt     time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
+
+// GenerateVariantsRequest creates a variant for every option combination the
+// product does not have one for yet
+type GenerateVariantsRequest struct {
+	SKUPrefix     string `json:"skuPrefix,omitempty"`           // Defaults to a code derived from the product ID
+	StockQuantity int    `json:"stockQuantity" binding:"min=0"` // Stock of each new variant
+}
+
+// CreateVariantRequest adds one variant to a product
+type CreateVariantRequest struct {
+	SKU           string            `json:"sku" binding:"required"`
+	Barcode       string            `json:"barcode,omitempty"`
+	Metal         string            `json:"metal,omitempty"`
+	Size          string            `json:"size,omitempty"`
+	StoneColors   map[string]string `json:"stoneColors,omitempty"`
+	Price         *float64          `json:"price,omitempty" binding:"omitempty,gt=0"`
+	Weight        *float64          `json:"weight,omitempty" binding:"omitempty,gt=0"`
+	StockQuantity int               `json:"stockQuantity" binding:"min=0"`
+	IsActive      *bool             `json:"isActive,omitempty"` // Defaults to true
+}
+
+// UpdateVariantRequest changes a variant's codes, price, weight or stock. Its
+// options cannot change; add a new variant instead.
+type UpdateVariantRequest struct {
+	SKU           *string  `json:"sku,omitempty"`
+	Barcode       *string  `json:"barcode,omitempty"`
+	Price         *float64 `json:"price,omitempty" binding:"omitempty,min=0"`  // 0 clears the override
+	Weight        *float64 `json:"weight,omitempty" binding:"omitempty,min=0"` // 0 clears the override
+	StockQuantity *int     `json:"stockQuantity,omitempty" binding:"omitempty,min=0"`
+	IsActive      *bool    `json:"isActive,omitempty"`
+}
+
+// VariantLookup is a variant found by SKU or barcode with its product
+type VariantLookup struct {
+	Product *Product        `json:"product"`
+	Variant *ProductVariant `json:"variant"`
+}
+
+// OptionsKey returns a canonical string for the variant's options so two
+// variants of the same combination compare equal
+func (v *ProductVariant) OptionsKey() string {
+	return (&ProductCustomization{Metal: v.Metal, RingSize: v.Size, StoneColors: v.StoneColors}).Key()
+}
+
+// Label describes the variant's options, e.g. "18K Gold / Size 7 / Center Stone: Red"
+func (v *ProductVariant) Label() string {
+	var parts []string
+	if v.Metal != "" {
+		parts = append(parts, v.Metal)
+	}
+	if v.Size != "" {
+		parts = append(parts, "Size "+v.Size)
+	}
+	for _, name := range sortedStoneNames(v.StoneColors) {
+		parts = append(parts, name+": "+v.StoneColors[name])
+	}
+	return strings.Join(parts, " / ")
+}
+
+// Matches reports whether the customization picks this variant's options
+func (v *ProductVariant) Matches(customization *ProductCustomization) bool {
+	var c ProductCustomization
+	if customization != nil {
+		c = *customization
+	}
+	if v.Metal != c.Metal || v.Size != c.RingSize {
+		return false
+	}
+	for name, color := range v.StoneColors {
+		if c.StoneColors[name] != color {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply returns a copy of the customization with the variant's options picked,
+// keeping choices the variant does not cover such as plating and engraving
+func (v *ProductVariant) Apply(customization *ProductCustomization) *ProductCustomization {
+	c := &ProductCustomization{}
+	if customization != nil {
+		*c = *customization
+	}
+	c.Metal = v.Metal
+	c.RingSize = v.Size
+
+	stones := make(map[string]string)
+	if customization != nil {
+		for name, color := range customization.StoneColors {
+			stones[name] = color
+		}
+	}
+	for name, color := range v.StoneColors {
+		stones[name] = color
+	}
+	c.StoneColors = nil
+	if len(stones) > 0 {
+		c.StoneColors = stones
+	}
+	return c
+}
+
+// Extras returns the choices of the customization the variant does not cover,
+// such as plating and engraving, which are priced on top of a variant price
+func (v *ProductVariant) Extras(customization *ProductCustomization) *ProductCustomization {
+	if customization == nil {
+		return nil
+	}
+	extras := *customization
+	extras.Metal = ""
+	extras.RingSize = ""
+	extras.StoneColors = nil
+	for name, color := range customization.StoneColors {
+		if _, covered := v.StoneColors[name]; !covered {
+			if extras.StoneColors == nil {
+				extras.StoneColors = make(map[string]string)
+			}
+			extras.StoneColors[name] = color
+		}
+	}
+	return &extras
+}
+
+// IsSellable reports whether the variant can be sold in the quantity
+func (v *ProductVariant) IsSellable(quantity int) bool {
+	return v.IsActive && v.StockQuantity >= quantity
+}
+
+// HasVariants reports whether the product is sold by variant
+func (p *Product) HasVariants() bool {
+	return len(p.Variants) > 0
+}
+
+// FindVariant returns the variant with the given ID
+func (p *Product) FindVariant(id primitive.ObjectID) *ProductVariant {
+	for i := range p.Variants {
+		if p.Variants[i].ID == id {
+			return &p.Variants[i]
+		}
+	}
+	return nil
+}
+
+// FindVariantByCode returns the variant with the given SKU or barcode
+func (p *Product) FindVariantByCode(code string) *ProductVariant {
+	code = strings.TrimSpace(code)
+	for i := range p.Variants {
+		if strings.EqualFold(p.Variants[i].SKU, code) || (p.Variants[i].Barcode != "" && p.Variants[i].Barcode == code) {
+			return &p.Variants[i]
+		}
+	}
+	return nil
+}
+
+// MatchVariant returns the variant whose options the customization picks
+func (p *Product) MatchVariant(customization *ProductCustomization) *ProductVariant {
+	for i := range p.Variants {
+		if p.Variants[i].Matches(customization) {
+			return &p.Variants[i]
+		}
+	}
+	return nil
+}
+
+// VariantStock returns the units held across the product's variants
+func (p *Product) VariantStock() int {
+	total := 0
+	for _, variant := range p.Variants {
+		total += variant.StockQuantity
+	}
+	return total
+}
+
+// VariantCombinations returns one variant, without SKU or stock, for every
+// combination of the product's metals, sizes and the colors of stones that
+// come in more than one color
+func (p *Product) VariantCombinations() []ProductVariant {
+	metals := p.AvailableMetals
+	if len(metals) == 0 {
+		metals = []string{""}
+	}
+	sizes := p.AvailableSizes
+	if len(sizes) == 0 {
+		sizes = []string{""}
+	}
+
+	stoneCombos := []map[string]string{nil}
+	for _, stone := range p.Stones {
+		if len(stone.AvailableColors) < 2 {
+			continue
+		}
+		var next []map[string]string
+		for _, combo := range stoneCombos {
+			for _, color := range stone.AvailableColors {
+				stones := map[string]string{stone.Name: color}
+				for name, c := range combo {
+					stones[name] = c
+				}
+				next = append(next, stones)
+			}
+		}
+		stoneCombos = next
+	}
+
+	var variants []ProductVariant
+	for _, metal := range metals {
+		for _, size := range sizes {
+			for _, stones := range stoneCombos {
+				if metal == "" && size == "" && stones == nil {
+					continue
+				}
+				variants = append(variants, ProductVariant{Metal: metal, Size: size, StoneColors: stones})
+			}
+		}
+	}
+	return variants
+}
+
+// VariantSKU builds a SKU from a prefix and the variant's options, e.g.
+// "TJ-3F2A1C-G18K-7-RE"
+func VariantSKU(prefix string, variant *ProductVariant) string {
+	parts := []string{strings.ToUpper(skuCode(prefix, true))}
+	if variant.Metal != "" {
+		code := MetalCodeFor(variant.Metal)
+		if code == "" {
+			code = skuCode(variant.Metal, false)
+		}
+		parts = append(parts, code)
+	}
+	if variant.Size != "" {
+		parts = append(parts, skuCode(variant.Size, true))
+	}
+	for _, name := range sortedStoneNames(variant.StoneColors) {
+		color := skuCode(variant.StoneColors[name], true)
+		if len(color) > 2 {
+			color = color[:2]
+		}
+		parts = append(parts, color)
+	}
+	return strings.Join(parts, "-")
+}
+
+// skuCode upper-cases the letters and digits of s. Unless whole is set, only
+// the first character of each word is kept.
+func skuCode(s string, whole bool) string {
+	var b strings.Builder
+	for _, word := range strings.Fields(s) {
+		for i, r := range strings.ToUpper(word) {
+			if !whole && i > 0 {
+				break
+			}
+			if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' {
+				b.WriteRune(r)
+			}
+		}
+	}
+	return b.String()
+}
+
+func sortedStoneNames(stones map[string]string) []string {
+	names := make([]string, 0, len(stones))
+	for name := range stones {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
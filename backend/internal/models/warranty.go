@@ -0,0 +1,184 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Warranty claim statuses
+const (
+	WarrantyClaimSubmitted = "submitted"
+	WarrantyClaimApproved  = "approved"
+	WarrantyClaimRejected  = "rejected"
+	WarrantyClaimCompleted = "completed"
+)
+
+// Warranty claim resolutions
+const (
+	ClaimResolutionRepair  = "repair"
+	ClaimResolutionReplace = "replace"
+	ClaimResolutionRefund  = "refund"
+)
+
+// ErrInvalidClaimStatusTransition is returned when a warranty claim cannot move to the requested status
+var ErrInvalidClaimStatusTransition = errors.New("invalid warranty claim status transition")
+
+// warrantyClaimTransitions lists the statuses each claim status may move to
+var warrantyClaimTransitions = map[string][]string{
+	WarrantyClaimSubmitted: {WarrantyClaimApproved, WarrantyClaimRejected},
+	WarrantyClaimApproved:  {WarrantyClaimCompleted},
+	WarrantyClaimRejected:  {},
+	WarrantyClaimCompleted: {},
+}
+
+// WarrantyPolicy is the warranty given on products of a category. A policy
+// without a category applies to categories that have none; a policy of zero
+// months gives no warranty.
+type WarrantyPolicy struct {
+	Category     string           `json:"category" bson:"category"`
+	WarrantyType string           `json:"warrantyType" bson:"warrantyType"` // "manufacturing", "extended", "lifetime"
+	Months       int              `json:"months" bson:"months"`
+	Coverage     []CoverageDetail `json:"coverage" bson:"coverage"` // UsedClaims is ignored
+	Terms        []string         `json:"terms,omitempty" bson:"terms,omitempty"`
+	Exclusions   []string         `json:"exclusions,omitempty" bson:"exclusions,omitempty"`
+}
+
+// DefaultWarrantyPolicies returns the warranty given on the store's categories
+func DefaultWarrantyPolicies() []WarrantyPolicy {
+	terms := []string{
+		"Quote the warranty or order number when making a claim",
+		"Approved claims are carried out free of charge by our workshop",
+	}
+	exclusions := []string{
+		"Loss or theft",
+		"Damage from accidents, misuse or contact with chemicals",
+		"Normal wear of plating and polish",
+		"Items altered or repaired elsewhere",
+	}
+	repair := CoverageDetail{Type: "repair", Description: "Repair of manufacturing defects such as broken clasps, links and settings", MaxClaims: 2}
+	cleaning := CoverageDetail{Type: "cleaning", Description: "Professional cleaning and polishing", MaxClaims: 2}
+	resizing := CoverageDetail{Type: "resizing", Description: "One free resize", MaxClaims: 1}
+
+	return []WarrantyPolicy{
+		{WarrantyType: "manufacturing", Months: 12, Coverage: []CoverageDetail{repair, cleaning}, Terms: terms, Exclusions: exclusions},
+		{Category: "Rings", WarrantyType: "manufacturing", Months: 12, Coverage: []CoverageDetail{repair, cleaning, resizing}, Terms: terms, Exclusions: exclusions},
+		{Category: "Bangles", WarrantyType: "manufacturing", Months: 12, Coverage: []CoverageDetail{repair, cleaning, resizing}, Terms: terms, Exclusions: exclusions},
+		{Category: "Imitation Jewellery", WarrantyType: "manufacturing", Months: 6, Coverage: []CoverageDetail{{Type: "repair", Description: repair.Description, MaxClaims: 1}}, Terms: terms, Exclusions: exclusions},
+		{Category: "Coins"},
+		{Category: "Loose Diamonds"},
+		{Category: "Gemstones"},
+	}
+}
+
+// WarrantyPolicyList returns the configured warranty policies, or the
+// defaults for settings saved before warranties were configurable
+func (s *StoreSettings) WarrantyPolicyList() []WarrantyPolicy {
+	if len(s.WarrantyPolicies) == 0 {
+		return DefaultWarrantyPolicies()
+	}
+	return s.WarrantyPolicies
+}
+
+// WarrantyPolicyFor returns the warranty policy of a product category
+func (s *StoreSettings) WarrantyPolicyFor(category string) WarrantyPolicy {
+	var fallback WarrantyPolicy
+	for _, policy := range s.WarrantyPolicyList() {
+		name := strings.TrimSpace(policy.Category)
+		if name == "" {
+			fallback = policy
+		} else if strings.EqualFold(name, strings.TrimSpace(category)) {
+			return policy
+		}
+	}
+	fallback.Category = category
+	return fallback
+}
+
+// CreateWarrantyClaimRequest represents a customer's claim under a warranty
+type CreateWarrantyClaimRequest struct {
+	ClaimType   string `json:"claimType" binding:"required"` // One of the warranty's coverage types
+	Description string `json:"description" binding:"required"`
+	UserNotes   string `json:"userNotes,omitempty"`
+}
+
+// CompleteWarrantyClaimRequest records how an approved claim was resolved
+type CompleteWarrantyClaimRequest struct {
+	ResolutionType string  `json:"resolutionType" binding:"required,oneof=repair replace refund"`
+	RepairCost     float64 `json:"repairCost" binding:"min=0"`
+	Notes          string  `json:"notes,omitempty"`
+}
+
+// WarrantyClaimFilter represents filters for the admin claims queue
+type WarrantyClaimFilter struct {
+	Status     string              `json:"status,omitempty"`
+	WarrantyID *primitive.ObjectID `json:"warrantyId,omitempty"`
+	Page       int                 `json:"page"`
+	Limit      int                 `json:"limit"`
+}
+
+// IsOwnedBy checks whether the customer actor placed the order the warranty was issued for
+func (w *WarrantyInfo) IsOwnedBy(actor OrderActor) bool {
+	if actor.Type == OrderActorAdmin {
+		return true
+	}
+	if actor.ID == "" {
+		return false
+	}
+	if !w.UserID.IsZero() {
+		return w.UserID.Hex() == actor.ID
+	}
+	return w.GuestSessionID == actor.ID
+}
+
+// IsValidAt reports whether the warranty covers claims made at t
+func (w *WarrantyInfo) IsValidAt(t time.Time) bool {
+	return w.IsActive && !t.Before(w.WarrantyStart) && !t.After(w.WarrantyEnd)
+}
+
+// Coverage returns the coverage of a claim type, or nil if the warranty does not cover it
+func (w *WarrantyInfo) Coverage(claimType string) *CoverageDetail {
+	for i := range w.CoverageDetails {
+		if strings.EqualFold(w.CoverageDetails[i].Type, claimType) {
+			return &w.CoverageDetails[i]
+		}
+	}
+	return nil
+}
+
+// HasClaimsLeft reports whether another claim can be approved under the coverage
+func (c *CoverageDetail) HasClaimsLeft() bool {
+	return c.MaxClaims == 0 || c.UsedClaims < c.MaxClaims
+}
+
+// CanTransitionTo checks the claim status transition table
+func (c *WarrantyClaim) CanTransitionTo(status string) bool {
+	for _, next := range warrantyClaimTransitions[c.Status] {
+		if next == status {
+			return true
+		}
+	}
+	return false
+}
+
+// TransitionTo moves the claim to status and records who did it
+func (c *WarrantyClaim) TransitionTo(status string, actor OrderActor) error {
+	if !c.CanTransitionTo(status) {
+		return fmt.Errorf("%w: %s to %s", ErrInvalidClaimStatusTransition, c.Status, status)
+	}
+
+	now := time.Now()
+	c.Status = status
+	c.UpdatedAt = now
+	switch status {
+	case WarrantyClaimApproved, WarrantyClaimRejected:
+		c.ProcessedAt = &now
+		c.ProcessedBy = &actor
+	case WarrantyClaimCompleted:
+		c.CompletedAt = &now
+	}
+	return nil
+}
@@ -0,0 +1,515 @@
+// Package razorpayfake runs an in-process stand-in for the Razorpay REST API so
+// the checkout, verification and webhook flow can be exercised without network access.
+package razorpayfake
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+)
+
+// Order mirrors the Razorpay order entity
+type Order struct {
+	ID         string            `json:"id"`
+	Entity     string            `json:"entity"`
+	Amount     int64             `json:"amount"`
+	AmountPaid int64             `json:"amount_paid"`
+	AmountDue  int64             `json:"amount_due"`
+	Currency   string            `json:"currency"`
+	Receipt    string            `json:"receipt"`
+	Status     string            `json:"status"`
+	Attempts   int               `json:"attempts"`
+	Notes      map[string]string `json:"notes"`
+	CreatedAt  int64             `json:"created_at"`
+}
+
+// Payment mirrors the Razorpay payment entity
+type Payment struct {
+	ID               string            `json:"id"`
+	Entity           string            `json:"entity"`
+	Amount           int64             `json:"amount"`
+	Currency         string            `json:"currency"`
+	Status           string            `json:"status"`
+	OrderID          string            `json:"order_id"`
+	Method           string            `json:"method"`
+	Captured         bool              `json:"captured"`
+	AmountRefunded   int64             `json:"amount_refunded"`
+	ErrorCode        string            `json:"error_code,omitempty"`
+	ErrorDescription string            `json:"error_description,omitempty"`
+	Notes            map[string]string `json:"notes"`
+	CreatedAt        int64             `json:"created_at"`
+}
+
+// Refund mirrors the Razorpay refund entity
+type Refund struct {
+	ID        string            `json:"id"`
+	Entity    string            `json:"entity"`
+	Amount    int64             `json:"amount"`
+	Currency  string            `json:"currency"`
+	PaymentID string            `json:"payment_id"`
+	Receipt   string            `json:"receipt"`
+	Status    string            `json:"status"`
+	Notes     map[string]string `json:"notes"`
+	CreatedAt int64             `json:"created_at"`
+}
+
+// PaymentLink mirrors the Razorpay payment link entity
+type PaymentLink struct {
+	ID          string            `json:"id"`
+	Amount      int64             `json:"amount"`
+	Currency    string            `json:"currency"`
+	ReferenceID string            `json:"reference_id"`
+	Description string            `json:"description"`
+	ShortURL    string            `json:"short_url"`
+	Status      string            `json:"status"`
+	Notes       map[string]string `json:"notes"`
+	CreatedAt   int64             `json:"created_at"`
+}
+
+// Server is a fake Razorpay API. Its handlers are served under /v1 like the real API.
+type Server struct {
+	*httptest.Server
+
+	KeyID         string
+	KeySecret     string
+	WebhookSecret string
+
+	mu          sync.Mutex
+	seq         int
+	orders      map[string]*Order
+	payments    map[string]*Payment
+	refunds     map[string]*Refund
+	links       map[string]*PaymentLink
+	refundError string
+}
+
+// NewServer starts a fake Razorpay API that accepts the given key pair
+func NewServer(keyID, keySecret, webhookSecret string) *Server {
+	s := &Server{
+		KeyID:         keyID,
+		KeySecret:     keySecret,
+		WebhookSecret: webhookSecret,
+		orders:        make(map[string]*Order),
+		payments:      make(map[string]*Payment),
+		refunds:       make(map[string]*Refund),
+		links:         make(map[string]*PaymentLink),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/orders", s.createOrder)
+	mux.HandleFunc("GET /v1/orders/{id}", s.getOrder)
+	mux.HandleFunc("GET /v1/orders/{id}/payments", s.getOrderPayments)
+	mux.HandleFunc("GET /v1/payments/{id}", s.getPayment)
+	mux.HandleFunc("POST /v1/payments/{id}/refund", s.createRefund)
+	mux.HandleFunc("POST /v1/payment_links", s.createPaymentLink)
+	mux.HandleFunc("POST /v1/payment_links/{id}/cancel", s.cancelPaymentLink)
+
+	s.Server = httptest.NewServer(s.authenticate(mux))
+	return s
+}
+
+// BaseURL returns the API root to use as RazorpayConfig.BaseURL
+func (s *Server) BaseURL() string {
+	return s.URL + "/v1"
+}
+
+// Order returns a copy of a stored order
+func (s *Server) Order(id string) (Order, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	order, ok := s.orders[id]
+	if !ok {
+		return Order{}, false
+	}
+	return *order, true
+}
+
+// PaymentLink returns a copy of a stored payment link
+func (s *Server) PaymentLink(id string) (PaymentLink, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	link, ok := s.links[id]
+	if !ok {
+		return PaymentLink{}, false
+	}
+	return *link, true
+}
+
+// Pay simulates a successful checkout of the full order amount. It returns the
+// captured payment and the signature Razorpay Checkout hands back to the client.
+func (s *Server) Pay(orderID string) (Payment, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	order, ok := s.orders[orderID]
+	if !ok {
+		return Payment{}, "", fmt.Errorf("order %s not found", orderID)
+	}
+	if order.Status == "paid" {
+		return Payment{}, "", fmt.Errorf("order %s is already paid", orderID)
+	}
+
+	payment := s.newPayment(order, "captured")
+	payment.Captured = true
+	order.Status = "paid"
+	order.AmountPaid = order.Amount
+	order.AmountDue = 0
+
+	return *payment, s.sign(s.KeySecret, []byte(order.ID+"|"+payment.ID)), nil
+}
+
+// Fail simulates a failed payment attempt against the order
+func (s *Server) Fail(orderID string) (Payment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	order, ok := s.orders[orderID]
+	if !ok {
+		return Payment{}, fmt.Errorf("order %s not found", orderID)
+	}
+
+	payment := s.newPayment(order, "failed")
+	payment.ErrorCode = "BAD_REQUEST_ERROR"
+	payment.ErrorDescription = "Payment was declined by the bank"
+	order.Status = "attempted"
+
+	return *payment, nil
+}
+
+// FailRefunds makes refund calls fail with the given description until it is
+// called again with an empty string
+func (s *Server) FailRefunds(description string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.refundError = description
+}
+
+// Refunds returns copies of the refunds made against a payment
+func (s *Server) Refunds(paymentID string) []Refund {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var refunds []Refund
+	for _, refund := range s.refunds {
+		if refund.PaymentID == paymentID {
+			refunds = append(refunds, *refund)
+		}
+	}
+	return refunds
+}
+
+// RefundWebhook builds a signed webhook body for a refund event such as
+// refund.processed or refund.failed
+func (s *Server) RefundWebhook(event, refundID string) ([]byte, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	refund, ok := s.refunds[refundID]
+	if !ok {
+		return nil, "", fmt.Errorf("refund %s not found", refundID)
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"entity":     "event",
+		"account_id": "acc_fake",
+		"event":      event,
+		"contains":   []string{"refund", "payment"},
+		"payload": map[string]interface{}{
+			"refund":  map[string]interface{}{"entity": refund},
+			"payment": map[string]interface{}{"entity": s.payments[refund.PaymentID]},
+		},
+		"created_at": time.Now().Unix(),
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return body, s.sign(s.WebhookSecret, body), nil
+}
+
+// Webhook builds a signed webhook body for a payment event such as
+// payment.captured, payment.failed or order.paid
+func (s *Server) Webhook(event, paymentID string) ([]byte, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	payment, ok := s.payments[paymentID]
+	if !ok {
+		return nil, "", fmt.Errorf("payment %s not found", paymentID)
+	}
+
+	contains := []string{"payment"}
+	payload := map[string]interface{}{
+		"payment": map[string]interface{}{"entity": payment},
+	}
+	if event == "order.paid" {
+		contains = append(contains, "order")
+		payload["order"] = map[string]interface{}{"entity": s.orders[payment.OrderID]}
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"entity":     "event",
+		"account_id": "acc_fake",
+		"event":      event,
+		"contains":   contains,
+		"payload":    payload,
+		"created_at": time.Now().Unix(),
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return body, s.sign(s.WebhookSecret, body), nil
+}
+
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keyID, keySecret, ok := r.BasicAuth()
+		if !ok || keyID != s.KeyID || keySecret != s.KeySecret {
+			writeError(w, http.StatusUnauthorized, "Authentication failed")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) createOrder(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Amount   int64             `json:"amount"`
+		Currency string            `json:"currency"`
+		Receipt  string            `json:"receipt"`
+		Notes    map[string]string `json:"notes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "The request body is invalid")
+		return
+	}
+	if req.Amount < 100 {
+		writeError(w, http.StatusBadRequest, "The amount must be atleast INR 1.00")
+		return
+	}
+	if req.Currency == "" {
+		req.Currency = "INR"
+	}
+
+	s.mu.Lock()
+	order := &Order{
+		ID:        s.nextID("order"),
+		Entity:    "order",
+		Amount:    req.Amount,
+		AmountDue: req.Amount,
+		Currency:  req.Currency,
+		Receipt:   req.Receipt,
+		Status:    "created",
+		Notes:     req.Notes,
+		CreatedAt: time.Now().Unix(),
+	}
+	s.orders[order.ID] = order
+	s.mu.Unlock()
+
+	writeJSON(w, order)
+}
+
+func (s *Server) getOrder(w http.ResponseWriter, r *http.Request) {
+	order, ok := s.Order(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusBadRequest, "The id provided does not exist")
+		return
+	}
+	writeJSON(w, order)
+}
+
+func (s *Server) getOrderPayments(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	orderID := r.PathValue("id")
+	if _, ok := s.orders[orderID]; !ok {
+		writeError(w, http.StatusBadRequest, "The id provided does not exist")
+		return
+	}
+
+	items := []*Payment{}
+	for _, payment := range s.payments {
+		if payment.OrderID == orderID {
+			items = append(items, payment)
+		}
+	}
+	writeJSON(w, map[string]interface{}{"entity": "collection", "count": len(items), "items": items})
+}
+
+func (s *Server) getPayment(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	payment, ok := s.payments[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "The id provided does not exist")
+		return
+	}
+	writeJSON(w, payment)
+}
+
+func (s *Server) createRefund(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Amount  int64             `json:"amount"`
+		Receipt string            `json:"receipt"`
+		Notes   map[string]string `json:"notes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "The request body is invalid")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	payment, ok := s.payments[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "The id provided does not exist")
+		return
+	}
+	if s.refundError != "" {
+		writeError(w, http.StatusBadRequest, s.refundError)
+		return
+	}
+	if payment.Status != "captured" && payment.Status != "refunded" {
+		writeError(w, http.StatusBadRequest, "The payment has not been captured")
+		return
+	}
+	if req.Amount == 0 {
+		req.Amount = payment.Amount - payment.AmountRefunded
+	}
+	if req.Amount <= 0 || payment.AmountRefunded+req.Amount > payment.Amount {
+		writeError(w, http.StatusBadRequest, "The refund amount provided is greater than amount captured")
+		return
+	}
+
+	refund := &Refund{
+		ID:        s.nextID("rfnd"),
+		Entity:    "refund",
+		Amount:    req.Amount,
+		Currency:  payment.Currency,
+		PaymentID: payment.ID,
+		Receipt:   req.Receipt,
+		Status:    "processed",
+		Notes:     req.Notes,
+		CreatedAt: time.Now().Unix(),
+	}
+	s.refunds[refund.ID] = refund
+	payment.AmountRefunded += req.Amount
+	if payment.AmountRefunded == payment.Amount {
+		payment.Status = "refunded"
+	}
+
+	writeJSON(w, refund)
+}
+
+func (s *Server) createPaymentLink(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Amount      int64             `json:"amount"`
+		Currency    string            `json:"currency"`
+		ReferenceID string            `json:"reference_id"`
+		Description string            `json:"description"`
+		Notes       map[string]string `json:"notes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "The request body is invalid")
+		return
+	}
+	if req.Amount < 100 {
+		writeError(w, http.StatusBadRequest, "The amount must be atleast INR 1.00")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	link := &PaymentLink{
+		ID:          s.nextID("plink"),
+		Amount:      req.Amount,
+		Currency:    req.Currency,
+		ReferenceID: req.ReferenceID,
+		Description: req.Description,
+		Status:      "created",
+		Notes:       req.Notes,
+		CreatedAt:   time.Now().Unix(),
+	}
+	link.ShortURL = s.URL + "/pay/" + link.ID
+	s.links[link.ID] = link
+
+	writeJSON(w, link)
+}
+
+func (s *Server) cancelPaymentLink(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	link, ok := s.links[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "The id provided does not exist")
+		return
+	}
+	if link.Status != "created" {
+		writeError(w, http.StatusBadRequest, "Payment link cannot be cancelled in "+link.Status+" state")
+		return
+	}
+	link.Status = "cancelled"
+
+	writeJSON(w, link)
+}
+
+// newPayment stores a payment for the order; callers hold s.mu
+func (s *Server) newPayment(order *Order, status string) *Payment {
+	order.Attempts++
+	payment := &Payment{
+		ID:        s.nextID("pay"),
+		Entity:    "payment",
+		Amount:    order.Amount,
+		Currency:  order.Currency,
+		Status:    status,
+		OrderID:   order.ID,
+		Method:    "upi",
+		Notes:     map[string]string{},
+		CreatedAt: time.Now().Unix(),
+	}
+	s.payments[payment.ID] = payment
+	return payment
+}
+
+// nextID returns a Razorpay-style identifier; callers hold s.mu
+func (s *Server) nextID(prefix string) string {
+	s.seq++
+	return fmt.Sprintf("%s_fake%010d", prefix, s.seq)
+}
+
+func (s *Server) sign(secret string, message []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write(message)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]string{
+			"code":        "BAD_REQUEST_ERROR",
+			"description": description,
+		},
+	})
+}
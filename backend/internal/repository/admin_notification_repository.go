@@ -0,0 +1,17 @@
+package repository
+
+import (
+	"context"
+
+	"thyne-jewels-backend/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AdminNotificationRepository stores the notifications raised for the admin panel
+type AdminNotificationRepository interface {
+	Create(ctx context.Context, notification *models.AdminNotification) error
+	// GetAll lists notifications newest first with the number still unread
+	GetAll(ctx context.Context, filter models.AdminNotificationFilter) ([]models.AdminNotification, int64, int64, error)
+	MarkRead(ctx context.Context, id primitive.ObjectID) error
+}
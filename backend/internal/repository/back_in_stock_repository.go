@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"thyne-jewels-backend/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// ErrBackInStockNotFound is returned for unknown subscriptions
+	ErrBackInStockNotFound = errors.New("back-in-stock subscription not found")
+	// ErrBackInStockClaimed is returned when a subscription is no longer active,
+	// or was already marked converted
+	ErrBackInStockClaimed = errors.New("back-in-stock subscription is no longer active")
+	// ErrBackInStockLimitReached is returned when a contact already had the
+	// day's allowance of alerts
+	ErrBackInStockLimitReached = errors.New("back-in-stock alert limit reached")
+)
+
+// BackInStockRepository stores back-in-stock subscriptions
+type BackInStockRepository interface {
+	Create(ctx context.Context, subscription *models.BackInStockSubscription) error
+	GetByToken(ctx context.Context, token string) (*models.BackInStockSubscription, error)
+	// GetActive finds the contact's active subscription to the product, or to
+	// the variant when variantID is set
+	GetActive(ctx context.Context, contactKey string, productID primitive.ObjectID, variantID *primitive.ObjectID) (*models.BackInStockSubscription, error)
+	// GetActiveByProduct lists the active subscriptions to the product, or to
+	// the variant when variantID is set, oldest first
+	GetActiveByProduct(ctx context.Context, productID primitive.ObjectID, variantID *primitive.ObjectID) ([]models.BackInStockSubscription, error)
+	GetByUser(ctx context.Context, userID primitive.ObjectID) ([]models.BackInStockSubscription, error)
+	GetAll(ctx context.Context, filter models.BackInStockFilter) ([]models.BackInStockSubscription, int64, error)
+
+	// Claim marks an active subscription notified before its alert is sent,
+	// failing with ErrBackInStockClaimed if another restock got to it first
+	Claim(ctx context.Context, id primitive.ObjectID, at time.Time) error
+	// Reopen makes a claimed subscription active again when its alert could not be sent
+	Reopen(ctx context.Context, id primitive.ObjectID, notifyError string) error
+	Cancel(ctx context.Context, id primitive.ObjectID) error
+	// TakeAlert atomically counts an alert against the contact's allowance for
+	// the day, failing with ErrBackInStockLimitReached once limit were taken
+	TakeAlert(ctx context.Context, contactKey, day string, limit int) error
+	// ReturnAlert gives back an alert taken for the day that was not sent
+	ReturnAlert(ctx context.Context, contactKey, day string) error
+	// GetNotifiedContacts lists the contacts alerted about the product since the time
+	GetNotifiedContacts(ctx context.Context, productID primitive.ObjectID, since time.Time) ([]string, error)
+
+	// GetConvertible lists the unconverted subscriptions to the product that
+	// were notified since the time, for any of the contacts or the guest session
+	GetConvertible(ctx context.Context, productID primitive.ObjectID, contactKeys []string, guestSessionID string, since time.Time) ([]models.BackInStockSubscription, error)
+	// MarkConverted records the purchase a notified subscription led to,
+	// failing with ErrBackInStockClaimed if it was already converted
+	MarkConverted(ctx context.Context, id primitive.ObjectID, orderNumber string, at time.Time) error
+	// GetStats counts subscriptions per channel
+	GetStats(ctx context.Context) ([]models.BackInStockChannelStats, error)
+}
@@ -12,6 +12,8 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
+// ErrCartNotFound is returned when the user or guest has no cart yet
+var ErrCartNotFound = errors.New("cart not found")
 
 type cartRepository struct {
 	collection *mongo.Collection
@@ -36,7 +38,7 @@ func (r *cartRepository) GetByUserID(ctx context.Context, userID primitive.Objec
 	err := r.collection.FindOne(ctx, bson.M{"userId": userID}).Decode(&cart)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, errors.New("cart not found")
+			return nil, ErrCartNotFound
 		}
 		return nil, err
 	}
@@ -48,7 +50,7 @@ func (r *cartRepository) GetByGuestSessionID(ctx context.Context, sessionID stri
 	err := r.collection.FindOne(ctx, bson.M{"guestSessionId": sessionID}).Decode(&cart)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, errors.New("cart not found")
+			return nil, ErrCartNotFound
 		}
 		return nil, err
 	}
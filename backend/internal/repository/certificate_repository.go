@@ -0,0 +1,18 @@
+package repository
+
+import (
+	"context"
+
+	"thyne-jewels-backend/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CertificateRepository stores the certificates of authenticity issued on delivered order lines
+type CertificateRepository interface {
+	Create(ctx context.Context, certificate *models.Certificate) error
+	GetByID(ctx context.Context, id primitive.ObjectID) (*models.Certificate, error)
+	GetByNumber(ctx context.Context, certificateNo string) (*models.Certificate, error)
+	GetByOrder(ctx context.Context, orderID primitive.ObjectID) ([]models.Certificate, error)
+	GetByCustomer(ctx context.Context, userID primitive.ObjectID, guestSessionID string, page, limit int) ([]models.Certificate, int64, error)
+}
@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"errors"
+	"time"
 
 	"thyne-jewels-backend/internal/models"
 
@@ -90,6 +91,15 @@ func (r *couponRepository) Update(ctx context.Context, coupon *models.Coupon) er
 	return err
 }
 
+// IncrementUsage counts one more use of a coupon
+func (r *couponRepository) IncrementUsage(ctx context.Context, id primitive.ObjectID) error {
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$inc": bson.M{"usedCount": 1},
+		"$set": bson.M{"updatedAt": time.Now()},
+	})
+	return err
+}
+
 func (r *couponRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
 	filter := bson.M{"_id": id}
 	_, err := r.collection.DeleteOne(ctx, filter)
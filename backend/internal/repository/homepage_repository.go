@@ -45,6 +45,7 @@ type HomepageRepository interface {
 	// Recently Viewed
 	TrackProductView(ctx context.Context, userID *primitive.ObjectID, sessionID *string, productID primitive.ObjectID) error
 	GetRecentlyViewed(ctx context.Context, userID *primitive.ObjectID, sessionID *string, limit int) ([]primitive.ObjectID, error)
+	MergeRecentlyViewed(ctx context.Context, sessionID string, userID primitive.ObjectID) (bool, error)
 
 	// 360° Showcase
 	CreateShowcase(ctx context.Context, showcase *models.Showcase360) error
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"thyne-jewels-backend/internal/models"
@@ -31,12 +32,17 @@ type ProductRepository interface {
 	Create(ctx context.Context, product *models.Product) error
 	GetByID(ctx context.Context, id primitive.ObjectID) (*models.Product, error)
 	GetAll(ctx context.Context, filter models.ProductFilter) ([]models.Product, int64, error)
+	// Update saves the product's details but not its stock, which only changes through the StockRepository
 	Update(ctx context.Context, product *models.Product) error
 	Delete(ctx context.Context, id primitive.ObjectID) error
 	GetFeatured(ctx context.Context) ([]models.Product, error)
 	GetCategories(ctx context.Context) ([]string, error)
 	Search(ctx context.Context, query string) ([]models.Product, error)
 	GetProductStatistics(ctx context.Context) (*models.ProductStatistics, error)
+	// GetByMetalCode lists the metal_rate products priced from a metal code
+	GetByMetalCode(ctx context.Context, code string) ([]models.Product, error)
+	// UpdatePrice stores a repriced product's price and making charge
+	UpdatePrice(ctx context.Context, id primitive.ObjectID, price, makingCharge float64) error
 }
 
 // OrderRepository defines basic order data access methods
@@ -50,8 +56,24 @@ type OrderRepository interface {
     GetAll(ctx context.Context, page, limit int, status *models.OrderStatus) ([]models.Order, int64, error)
 	Update(ctx context.Context, order *models.Order) error
 	UpdateStatus(ctx context.Context, id primitive.ObjectID, status models.OrderStatus) error
+	// TransitionStatus saves a status change made with Order.TransitionTo only if the
+	// stored order is still in status from with payment status fromPayment, and
+	// returns models.ErrInvalidOrderStatusTransition if it has moved on since
+	TransitionStatus(ctx context.Context, order *models.Order, from models.OrderStatus, fromPayment models.PaymentStatus) error
+	// AddRefund saves a new refund recorded on the order, its refund summary and payment status only
+	AddRefund(ctx context.Context, order *models.Order, refund models.PaymentRefund) error
+	// UpdateStock saves the order's stock reservation and its lines' locations and packed pieces only
+	UpdateStock(ctx context.Context, order *models.Order) error
 	Delete(ctx context.Context, id primitive.ObjectID) error
 	ExportOrders(ctx context.Context, format string, startDate, endDate time.Time, filters map[string]interface{}) (string, error)
+	GetExpiredReservations(ctx context.Context, before time.Time) ([]models.Order, error)
+	GetFailedRefunds(ctx context.Context) ([]models.Order, error)
+	GetUnsettledPayments(ctx context.Context, since time.Time) ([]models.Order, error)
+	AssignGuestOrders(ctx context.Context, sessionID string, userID primitive.ObjectID) (int64, error)
+	// GetByUnitHUID returns the orders a piece with the HUID was packed into, newest first
+	GetByUnitHUID(ctx context.Context, huid string) ([]models.Order, error)
+	// GetByLocation lists orders with a line taken from the stock location, newest first
+	GetByLocation(ctx context.Context, locationID primitive.ObjectID, page, limit int, status *models.OrderStatus) ([]models.Order, int64, error)
 }
 
 // ReviewRepository defines basic review data access methods
@@ -84,6 +106,7 @@ type CouponRepository interface {
 	GetByCode(ctx context.Context, code string) (*models.Coupon, error)
 	GetAll(ctx context.Context) ([]models.Coupon, error)
 	Update(ctx context.Context, coupon *models.Coupon) error
+	IncrementUsage(ctx context.Context, id primitive.ObjectID) error
 	Delete(ctx context.Context, id primitive.ObjectID) error
 }
 
@@ -103,6 +126,7 @@ type LoyaltyRepository interface {
 	UpdateProgram(ctx context.Context, program *models.LoyaltyProgram) error
 	AddTransaction(ctx context.Context, transaction *models.PointTransaction) error
 	GetTransactionHistory(ctx context.Context, userID primitive.ObjectID, limit, offset int) ([]models.PointTransaction, error)
+	GetTransactionsByOrder(ctx context.Context, userID, orderID primitive.ObjectID) ([]models.PointTransaction, error)
 	GetConfig(ctx context.Context) (*models.LoyaltyConfig, error)
 	UpdateConfig(ctx context.Context, config *models.LoyaltyConfig) error
 	GetLoyaltyStatistics(ctx context.Context) (*models.LoyaltyStatistics, error)
@@ -195,6 +219,12 @@ type VoucherRepository interface {
 	GetAnalytics(ctx context.Context, startDate, endDate time.Time) (*models.VoucherAnalytics, error)
 }
 
+// ErrOrderTrackingNotFound is returned when an order has no shipment tracking
+var ErrOrderTrackingNotFound = errors.New("order tracking not found")
+
+// ErrPDFDocumentNotFound is returned when no document has been generated yet
+var ErrPDFDocumentNotFound = errors.New("PDF document not found")
+
 // PDFRepository defines PDF and tracking data access methods
 type PDFRepository interface {
 	Create(ctx context.Context, pdf *models.PDFDocument) error
@@ -202,9 +232,14 @@ type PDFRepository interface {
 	GetByOrderID(ctx context.Context, orderID primitive.ObjectID, pdfType string) (*models.PDFDocument, error)
 	Update(ctx context.Context, pdf *models.PDFDocument) error
 	GetByUserID(ctx context.Context, userID primitive.ObjectID, pdfType string) ([]models.PDFDocument, error)
+	// GetByReference returns the latest active document of the type rendered from an invoice, order or warranty
+	GetByReference(ctx context.Context, pdfType string, referenceID primitive.ObjectID) (*models.PDFDocument, error)
 	GetOrderTracking(ctx context.Context, orderID primitive.ObjectID) (*models.OrderTracking, error)
 	CreateOrderTracking(ctx context.Context, tracking *models.OrderTracking) error
 	UpdateOrderTracking(ctx context.Context, tracking *models.OrderTracking) error
+	GetOrderTrackingByTrackingID(ctx context.Context, carrier string, trackingID string) (*models.OrderTracking, error)
+	// ListActiveOrderTracking returns shipments not yet delivered or cancelled, least recently polled first
+	ListActiveOrderTracking(ctx context.Context, limit int) ([]models.OrderTracking, error)
 	CreateWarranty(ctx context.Context, warranty *models.WarrantyInfo) error
 	GetWarrantyByID(ctx context.Context, id primitive.ObjectID) (*models.WarrantyInfo, error)
 	UpdateWarranty(ctx context.Context, warranty *models.WarrantyInfo) error
@@ -235,6 +270,8 @@ type SearchRepository interface {
 	GetPriceRangeFacets(ctx context.Context, baseMatch interface{}) ([]models.PriceRange, error)
 	GetPurityFacets(ctx context.Context, baseMatch interface{}) ([]models.FacetItem, error)
 	GetTagFacets(ctx context.Context, baseMatch interface{}) ([]models.FacetItem, error)
+	// GetLocationFacets counts the matching products in stock at each location
+	GetLocationFacets(ctx context.Context, baseMatch interface{}) ([]models.FacetItem, error)
 	CacheResults(ctx context.Context, cache *models.SearchCache) error
 	GetCachedResults(ctx context.Context, queryHash string) (*models.SearchCache, error)
 	UpdateCacheHit(ctx context.Context, queryHash string) error
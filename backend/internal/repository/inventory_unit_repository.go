@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"thyne-jewels-backend/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrInventoryUnitUnavailable is returned when a unit is not in stock to be packed
+var ErrInventoryUnitUnavailable = errors.New("inventory unit is not in stock")
+
+// InventoryUnitRepository stores the physical pieces of products
+type InventoryUnitRepository interface {
+	Create(ctx context.Context, unit *models.InventoryUnit) error
+	Update(ctx context.Context, unit *models.InventoryUnit) error
+	GetByID(ctx context.Context, id primitive.ObjectID) (*models.InventoryUnit, error)
+	// GetByCode finds a unit by its serial or, failing that, its HUID
+	GetByCode(ctx context.Context, code string) (*models.InventoryUnit, error)
+	GetByHUID(ctx context.Context, huid string) (*models.InventoryUnit, error)
+	GetByProduct(ctx context.Context, productID primitive.ObjectID, status models.InventoryUnitStatus) ([]models.InventoryUnit, error)
+	GetByOrder(ctx context.Context, orderID primitive.ObjectID) ([]models.InventoryUnit, error)
+
+	// Allocate marks an in-stock unit as sold into an order line, failing with
+	// ErrInventoryUnitUnavailable if it is no longer in stock
+	Allocate(ctx context.Context, unitID, orderID primitive.ObjectID, orderNumber string, lineIndex int, actor models.OrderActor) (*models.InventoryUnit, error)
+	// Release puts a unit sold into the order back into stock
+	Release(ctx context.Context, unitID, orderID primitive.ObjectID) error
+}
@@ -2,20 +2,53 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"thyne-jewels-backend/internal/models"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// ErrInvoiceNotFound is returned when no invoice matches
+var ErrInvoiceNotFound = errors.New("invoice not found")
+
+// ErrCreditNoteNotFound is returned when no credit note matches
+var ErrCreditNoteNotFound = errors.New("credit note not found")
+
+// ErrInvoiceExists is returned when an order already has an invoice that is not void
+var ErrInvoiceExists = errors.New("order already has an invoice")
+
+// ErrInvoiceNumbered is returned when a draft invoice was given its number by another request
+var ErrInvoiceNumbered = errors.New("invoice already has a number")
+
+// ErrCreditNoteExists is returned when a refund of an order already has a credit note
+var ErrCreditNoteExists = errors.New("refund already has a credit note")
+
+// ErrCreditNoteNumbered is returned when a draft credit note was given its number by another request
+var ErrCreditNoteNumbered = errors.New("credit note already has a number")
+
 // InvoiceRepository defines the interface for invoice data operations
 type InvoiceRepository interface {
-	Create(ctx context.Context, invoice *models.Invoice) error
+	Create(ctx context.Context, invoice *models.Invoice) error // Returns ErrInvoiceExists for a second live invoice of an order
 	GetByID(ctx context.Context, id primitive.ObjectID) (*models.Invoice, error)
-	GetByOrderID(ctx context.Context, orderID primitive.ObjectID) (*models.Invoice, error)
+	GetByOrderID(ctx context.Context, orderID primitive.ObjectID) (*models.Invoice, error) // Skips void invoices
 	GetByInvoiceNumber(ctx context.Context, invoiceNumber string) (*models.Invoice, error)
 	GetByUserID(ctx context.Context, userID primitive.ObjectID, page, limit int) ([]models.Invoice, int64, error)
 	GetByGuestSessionID(ctx context.Context, guestSessionID string, page, limit int) ([]models.Invoice, int64, error)
 	List(ctx context.Context, filter *models.InvoiceFilter) ([]models.Invoice, int64, error)
 	Update(ctx context.Context, invoice *models.Invoice) error
-	Delete(ctx context.Context, id primitive.ObjectID) error
 	MarkAsDownloaded(ctx context.Context, id primitive.ObjectID) error
+	// AssignNumber gives a draft invoice the next number of its financial year's series
+	// and saves it with its status; returns ErrInvoiceNumbered if it already has one
+	AssignNumber(ctx context.Context, invoice *models.Invoice) error
+}
+
+// CreditNoteRepository defines the interface for credit note data operations
+type CreditNoteRepository interface {
+	Create(ctx context.Context, creditNote *models.CreditNote) error // Returns ErrCreditNoteExists for a second note of a refund
+	GetByID(ctx context.Context, id primitive.ObjectID) (*models.CreditNote, error)
+	GetByInvoiceID(ctx context.Context, invoiceID primitive.ObjectID) ([]models.CreditNote, error) // Skips unnumbered drafts
+	GetByRefundID(ctx context.Context, orderID primitive.ObjectID, refundID string) (*models.CreditNote, error)
+	List(ctx context.Context, filter *models.CreditNoteFilter) ([]models.CreditNote, int64, error) // Skips unnumbered drafts
+	// AssignNumber gives a draft credit note the next number of its financial year's
+	// series; returns ErrCreditNoteNumbered if it already has one
+	AssignNumber(ctx context.Context, creditNote *models.CreditNote) error
 }
@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"thyne-jewels-backend/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// ErrStockLocationNotFound is returned for unknown locations, and by
+	// GetDefault before any location is set up
+	ErrStockLocationNotFound = errors.New("stock location not found")
+	// ErrDuplicateLocationCode is returned when another location has the code
+	ErrDuplicateLocationCode = errors.New("location code is already in use")
+	// ErrStockTransferNotFound is returned for unknown transfers
+	ErrStockTransferNotFound = errors.New("stock transfer not found")
+	// ErrStockTransferClosed is returned when a transfer is no longer in transit
+	ErrStockTransferClosed = errors.New("stock transfer is no longer in transit")
+)
+
+// StockLocationRepository stores the warehouses and showrooms stock is held at
+type StockLocationRepository interface {
+	Create(ctx context.Context, location *models.StockLocation) error
+	Update(ctx context.Context, location *models.StockLocation) error
+	GetByID(ctx context.Context, id primitive.ObjectID) (*models.StockLocation, error)
+	// GetAll lists locations by priority, then code
+	GetAll(ctx context.Context, activeOnly bool) ([]models.StockLocation, error)
+	GetDefault(ctx context.Context) (*models.StockLocation, error)
+	// SetDefault makes the location the default and clears the flag on the others
+	SetDefault(ctx context.Context, id primitive.ObjectID) error
+}
+
+// StockTransferRepository stores transfers of stock between locations
+type StockTransferRepository interface {
+	Create(ctx context.Context, transfer *models.StockTransfer) error
+	GetByID(ctx context.Context, id primitive.ObjectID) (*models.StockTransfer, error)
+	GetAll(ctx context.Context, filter models.StockTransferFilter) ([]models.StockTransfer, int64, error)
+	// Close saves the status a transfer was received or cancelled with,
+	// failing with ErrStockTransferClosed if it was already closed
+	Close(ctx context.Context, transfer *models.StockTransfer) error
+}
@@ -0,0 +1,17 @@
+package repository
+
+import (
+	"context"
+
+	"thyne-jewels-backend/internal/models"
+)
+
+// MetalRateRepository stores the history of per-gram metal rates. Records are
+// only ever added; the latest one per code is the live rate.
+type MetalRateRepository interface {
+	Create(ctx context.Context, rate *models.MetalRate) error
+	// GetCurrent returns the latest rate of every code
+	GetCurrent(ctx context.Context) ([]models.MetalRate, error)
+	// GetHistory lists rate changes newest first
+	GetHistory(ctx context.Context, filter models.MetalRateHistoryFilter) ([]models.MetalRate, int64, error)
+}
@@ -0,0 +1,98 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type adminNotificationRepository struct {
+	collection *mongo.Collection
+}
+
+// NewAdminNotificationRepository creates a new admin notification repository
+func NewAdminNotificationRepository(db *mongo.Database) repository.AdminNotificationRepository {
+	collection := db.Collection("admin_notifications")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "isRead", Value: 1}, {Key: "createdAt", Value: -1}},
+		},
+	})
+	if err != nil {
+		fmt.Printf("Warning: failed to create admin notification indexes: %v\n", err)
+	}
+
+	return &adminNotificationRepository{collection: collection}
+}
+
+func (r *adminNotificationRepository) Create(ctx context.Context, notification *models.AdminNotification) error {
+	if notification.ID.IsZero() {
+		notification.ID = primitive.NewObjectID()
+	}
+	if notification.CreatedAt.IsZero() {
+		notification.CreatedAt = time.Now()
+	}
+
+	if _, err := r.collection.InsertOne(ctx, notification); err != nil {
+		return fmt.Errorf("failed to create admin notification: %w", err)
+	}
+	return nil
+}
+
+func (r *adminNotificationRepository) GetAll(ctx context.Context, filter models.AdminNotificationFilter) ([]models.AdminNotification, int64, int64, error) {
+	query := bson.M{}
+	if filter.UnreadOnly {
+		query["isRead"] = false
+	}
+
+	total, err := r.collection.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to count admin notifications: %w", err)
+	}
+	unread, err := r.collection.CountDocuments(ctx, bson.M{"isRead": false})
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to count unread admin notifications: %w", err)
+	}
+
+	cursor, err := r.collection.Find(ctx, query, pageOptions(filter.Page, filter.Limit, bson.D{{Key: "createdAt", Value: -1}}))
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to get admin notifications: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var notifications []models.AdminNotification
+	if err := cursor.All(ctx, &notifications); err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to decode admin notifications: %w", err)
+	}
+
+	return notifications, total, unread, nil
+}
+
+func (r *adminNotificationRepository) MarkRead(ctx context.Context, id primitive.ObjectID) error {
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id, "isRead": false}, bson.M{
+		"$set": bson.M{"isRead": true, "readAt": time.Now()},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to mark admin notification read: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		count, err := r.collection.CountDocuments(ctx, bson.M{"_id": id})
+		if err != nil {
+			return fmt.Errorf("failed to get admin notification: %w", err)
+		}
+		if count == 0 {
+			return fmt.Errorf("admin notification not found")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,299 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type backInStockRepository struct {
+	collection  *mongo.Collection
+	alertCounts *mongo.Collection
+}
+
+// NewBackInStockRepository creates a new back-in-stock subscription repository.
+// Unsubscribe tokens are unique.
+func NewBackInStockRepository(db *mongo.Database) repository.BackInStockRepository {
+	collection := db.Collection("back_in_stock_subscriptions")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "token", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "productId", Value: 1}, {Key: "status", Value: 1}, {Key: "createdAt", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "contactKey", Value: 1}, {Key: "notifiedAt", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: -1}},
+		},
+	})
+	if err != nil {
+		fmt.Printf("Warning: failed to create back-in-stock subscription indexes: %v\n", err)
+	}
+
+	// Each contact's alerts of a day are counted in one document, kept for two days
+	alertCounts := db.Collection("back_in_stock_alert_counts")
+	_, err = alertCounts.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		fmt.Printf("Warning: failed to create back-in-stock alert count indexes: %v\n", err)
+	}
+
+	return &backInStockRepository{collection: collection, alertCounts: alertCounts}
+}
+
+func (r *backInStockRepository) Create(ctx context.Context, subscription *models.BackInStockSubscription) error {
+	if subscription.ID.IsZero() {
+		subscription.ID = primitive.NewObjectID()
+	}
+	subscription.CreatedAt = time.Now()
+
+	if _, err := r.collection.InsertOne(ctx, subscription); err != nil {
+		return fmt.Errorf("failed to create back-in-stock subscription: %w", err)
+	}
+	return nil
+}
+
+func (r *backInStockRepository) GetByToken(ctx context.Context, token string) (*models.BackInStockSubscription, error) {
+	var subscription models.BackInStockSubscription
+	if err := r.collection.FindOne(ctx, bson.M{"token": token}).Decode(&subscription); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, repository.ErrBackInStockNotFound
+		}
+		return nil, fmt.Errorf("failed to get back-in-stock subscription: %w", err)
+	}
+	return &subscription, nil
+}
+
+// lineFilter matches subscriptions to the product itself, or to one variant
+func lineFilter(productID primitive.ObjectID, variantID *primitive.ObjectID) bson.M {
+	filter := bson.M{"productId": productID, "variantId": nil}
+	if variantID != nil {
+		filter["variantId"] = *variantID
+	}
+	return filter
+}
+
+func (r *backInStockRepository) GetActive(ctx context.Context, contactKey string, productID primitive.ObjectID, variantID *primitive.ObjectID) (*models.BackInStockSubscription, error) {
+	filter := lineFilter(productID, variantID)
+	filter["contactKey"] = contactKey
+	filter["status"] = models.BackInStockActive
+
+	var subscription models.BackInStockSubscription
+	if err := r.collection.FindOne(ctx, filter).Decode(&subscription); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, repository.ErrBackInStockNotFound
+		}
+		return nil, fmt.Errorf("failed to get back-in-stock subscription: %w", err)
+	}
+	return &subscription, nil
+}
+
+func (r *backInStockRepository) GetActiveByProduct(ctx context.Context, productID primitive.ObjectID, variantID *primitive.ObjectID) ([]models.BackInStockSubscription, error) {
+	filter := lineFilter(productID, variantID)
+	filter["status"] = models.BackInStockActive
+
+	return r.find(ctx, filter, options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}))
+}
+
+func (r *backInStockRepository) GetByUser(ctx context.Context, userID primitive.ObjectID) ([]models.BackInStockSubscription, error) {
+	filter := bson.M{"userId": userID, "status": bson.M{"$ne": models.BackInStockCancelled}}
+	return r.find(ctx, filter, options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}))
+}
+
+func (r *backInStockRepository) GetAll(ctx context.Context, filter models.BackInStockFilter) ([]models.BackInStockSubscription, int64, error) {
+	query := bson.M{}
+	if filter.ProductID != nil {
+		query["productId"] = *filter.ProductID
+	}
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+	if filter.Channel != "" {
+		query["channel"] = filter.Channel
+	}
+
+	total, err := r.collection.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count back-in-stock subscriptions: %w", err)
+	}
+
+	subscriptions, err := r.find(ctx, query, pageOptions(filter.Page, filter.Limit, bson.D{{Key: "createdAt", Value: -1}}))
+	if err != nil {
+		return nil, 0, err
+	}
+	return subscriptions, total, nil
+}
+
+func (r *backInStockRepository) find(ctx context.Context, filter bson.M, opts *options.FindOptions) ([]models.BackInStockSubscription, error) {
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get back-in-stock subscriptions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	subscriptions := []models.BackInStockSubscription{}
+	if err := cursor.All(ctx, &subscriptions); err != nil {
+		return nil, fmt.Errorf("failed to decode back-in-stock subscriptions: %w", err)
+	}
+	return subscriptions, nil
+}
+
+func (r *backInStockRepository) Claim(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id, "status": models.BackInStockActive}, bson.M{
+		"$set":   bson.M{"status": models.BackInStockNotified, "notifiedAt": at},
+		"$unset": bson.M{"notifyError": ""},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to claim back-in-stock subscription: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return repository.ErrBackInStockClaimed
+	}
+	return nil
+}
+
+func (r *backInStockRepository) Reopen(ctx context.Context, id primitive.ObjectID, notifyError string) error {
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id, "status": models.BackInStockNotified}, bson.M{
+		"$set":   bson.M{"status": models.BackInStockActive, "notifyError": notifyError},
+		"$unset": bson.M{"notifiedAt": ""},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to reopen back-in-stock subscription: %w", err)
+	}
+	return nil
+}
+
+func (r *backInStockRepository) Cancel(ctx context.Context, id primitive.ObjectID) error {
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id, "status": models.BackInStockActive}, bson.M{
+		"$set": bson.M{"status": models.BackInStockCancelled, "cancelledAt": time.Now()},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to cancel back-in-stock subscription: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return repository.ErrBackInStockClaimed
+	}
+	return nil
+}
+
+// TakeAlert increments the contact's count for the day only while it is
+// under the limit. A contact at the limit does not match, so the upsert
+// collides with its document; the first two alerts of a day can also collide
+// on the upsert, and the loser retries against the document the winner made.
+func (r *backInStockRepository) TakeAlert(ctx context.Context, contactKey, day string, limit int) error {
+	filter := bson.M{"_id": contactKey + "/" + day, "count": bson.M{"$lt": limit}}
+	update := bson.M{
+		"$inc":         bson.M{"count": 1},
+		"$setOnInsert": bson.M{"contactKey": contactKey, "day": day, "expiresAt": time.Now().Add(48 * time.Hour)},
+	}
+	opts := options.Update().SetUpsert(true)
+
+	for attempt := 0; attempt < 2; attempt++ {
+		_, err := r.alertCounts.UpdateOne(ctx, filter, update, opts)
+		if err == nil {
+			return nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("failed to count back-in-stock alert: %w", err)
+		}
+	}
+	return repository.ErrBackInStockLimitReached
+}
+
+func (r *backInStockRepository) ReturnAlert(ctx context.Context, contactKey, day string) error {
+	filter := bson.M{"_id": contactKey + "/" + day, "count": bson.M{"$gt": 0}}
+	if _, err := r.alertCounts.UpdateOne(ctx, filter, bson.M{"$inc": bson.M{"count": -1}}); err != nil {
+		return fmt.Errorf("failed to return back-in-stock alert: %w", err)
+	}
+	return nil
+}
+
+func (r *backInStockRepository) GetNotifiedContacts(ctx context.Context, productID primitive.ObjectID, since time.Time) ([]string, error) {
+	values, err := r.collection.Distinct(ctx, "contactKey", bson.M{"productId": productID, "notifiedAt": bson.M{"$gte": since}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get alerted back-in-stock contacts: %w", err)
+	}
+
+	contacts := make([]string, 0, len(values))
+	for _, value := range values {
+		if contact, ok := value.(string); ok {
+			contacts = append(contacts, contact)
+		}
+	}
+	return contacts, nil
+}
+
+func (r *backInStockRepository) GetConvertible(ctx context.Context, productID primitive.ObjectID, contactKeys []string, guestSessionID string, since time.Time) ([]models.BackInStockSubscription, error) {
+	customer := bson.A{bson.M{"contactKey": bson.M{"$in": contactKeys}}}
+	if guestSessionID != "" {
+		customer = append(customer, bson.M{"guestSessionId": guestSessionID})
+	}
+
+	filter := bson.M{
+		"productId":   productID,
+		"status":      models.BackInStockNotified,
+		"notifiedAt":  bson.M{"$gte": since},
+		"convertedAt": nil,
+		"$or":         customer,
+	}
+	return r.find(ctx, filter, options.Find().SetSort(bson.D{{Key: "notifiedAt", Value: -1}}))
+}
+
+func (r *backInStockRepository) MarkConverted(ctx context.Context, id primitive.ObjectID, orderNumber string, at time.Time) error {
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id, "convertedAt": nil}, bson.M{
+		"$set": bson.M{"convertedAt": at, "convertedOrder": orderNumber},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to mark back-in-stock subscription converted: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return repository.ErrBackInStockClaimed
+	}
+	return nil
+}
+
+func (r *backInStockRepository) GetStats(ctx context.Context) ([]models.BackInStockChannelStats, error) {
+	count := func(condition bson.M) bson.M {
+		return bson.M{"$sum": bson.M{"$cond": bson.A{condition, 1, 0}}}
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"status": bson.M{"$ne": models.BackInStockCancelled}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":        "$channel",
+			"subscribed": bson.M{"$sum": 1},
+			"active":     count(bson.M{"$eq": bson.A{"$status", models.BackInStockActive}}),
+			"notified":   count(bson.M{"$eq": bson.A{"$status", models.BackInStockNotified}}),
+			"converted":  count(bson.M{"$gt": bson.A{"$convertedAt", nil}}),
+		}}},
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+	}
+
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get back-in-stock stats: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	stats := []models.BackInStockChannelStats{}
+	if err := cursor.All(ctx, &stats); err != nil {
+		return nil, fmt.Errorf("failed to decode back-in-stock stats: %w", err)
+	}
+	return stats, nil
+}
@@ -0,0 +1,128 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type certificateRepository struct {
+	collection *mongo.Collection
+}
+
+// NewCertificateRepository creates a new certificate repository. Certificates
+// are looked up by number when verified, and the unique index on the order
+// unit stops a delivery that is recorded twice issuing two certificates.
+func NewCertificateRepository(db *mongo.Database) repository.CertificateRepository {
+	collection := db.Collection("certificates")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "certificateNo", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "orderId", Value: 1}, {Key: "lineIndex", Value: 1}, {Key: "unit", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: -1}},
+		},
+	})
+	if err != nil {
+		fmt.Printf("Warning: failed to create certificate indexes: %v\n", err)
+	}
+
+	return &certificateRepository{collection: collection}
+}
+
+func (r *certificateRepository) Create(ctx context.Context, certificate *models.Certificate) error {
+	if certificate.ID.IsZero() {
+		certificate.ID = primitive.NewObjectID()
+	}
+	certificate.CreatedAt = time.Now()
+	certificate.UpdatedAt = certificate.CreatedAt
+
+	_, err := r.collection.InsertOne(ctx, certificate)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("certificate %s already exists", certificate.CertificateNo)
+		}
+		return fmt.Errorf("failed to create certificate: %w", err)
+	}
+
+	return nil
+}
+
+func (r *certificateRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.Certificate, error) {
+	return r.findOne(ctx, bson.M{"_id": id})
+}
+
+func (r *certificateRepository) GetByNumber(ctx context.Context, certificateNo string) (*models.Certificate, error) {
+	return r.findOne(ctx, bson.M{"certificateNo": certificateNo})
+}
+
+func (r *certificateRepository) GetByOrder(ctx context.Context, orderID primitive.ObjectID) ([]models.Certificate, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "lineIndex", Value: 1}, {Key: "unit", Value: 1}})
+
+	cursor, err := r.collection.Find(ctx, bson.M{"orderId": orderID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get certificates: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var certificates []models.Certificate
+	if err := cursor.All(ctx, &certificates); err != nil {
+		return nil, fmt.Errorf("failed to decode certificates: %w", err)
+	}
+
+	return certificates, nil
+}
+
+func (r *certificateRepository) GetByCustomer(ctx context.Context, userID primitive.ObjectID, guestSessionID string, page, limit int) ([]models.Certificate, int64, error) {
+	filter := bson.M{"guestSessionId": guestSessionID}
+	if !userID.IsZero() {
+		filter = bson.M{"userId": userID}
+	}
+
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count certificates: %w", err)
+	}
+
+	cursor, err := r.collection.Find(ctx, filter, pageOptions(page, limit, bson.D{{Key: "createdAt", Value: -1}}))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get certificates: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var certificates []models.Certificate
+	if err := cursor.All(ctx, &certificates); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode certificates: %w", err)
+	}
+
+	return certificates, total, nil
+}
+
+func (r *certificateRepository) findOne(ctx context.Context, filter bson.M) (*models.Certificate, error) {
+	var certificate models.Certificate
+	err := r.collection.FindOne(ctx, filter).Decode(&certificate)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("certificate not found")
+		}
+		return nil, fmt.Errorf("failed to get certificate: %w", err)
+	}
+
+	return &certificate, nil
+}
@@ -0,0 +1,194 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type creditNoteRepository struct {
+	collection *mongo.Collection
+}
+
+// NewCreditNoteRepository creates a new credit note repository. A refund of an
+// order can have one credit note, so two requests crediting the same refund
+// cannot both create one.
+func NewCreditNoteRepository(db *mongo.Database) repository.CreditNoteRepository {
+	creditNotes := db.Collection("credit_notes")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := creditNotes.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "orderId", Value: 1}, {Key: "refundId", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "creditNoteNumber", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"sequence": bson.M{"$gt": 0}}),
+		},
+		{
+			Keys: bson.D{{Key: "financialYear", Value: 1}, {Key: "sequence", Value: -1}},
+		},
+	})
+	if err != nil {
+		fmt.Printf("Warning: failed to create credit note indexes: %v\n", err)
+	}
+
+	return &creditNoteRepository{collection: creditNotes}
+}
+
+// Create saves a credit note
+func (r *creditNoteRepository) Create(ctx context.Context, creditNote *models.CreditNote) error {
+	creditNote.CreatedAt = time.Now()
+
+	result, err := r.collection.InsertOne(ctx, creditNote)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return repository.ErrCreditNoteExists
+		}
+		return fmt.Errorf("failed to create credit note: %w", err)
+	}
+
+	creditNote.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// GetByID retrieves a credit note by ID
+func (r *creditNoteRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.CreditNote, error) {
+	return r.findOne(ctx, bson.M{"_id": id})
+}
+
+// GetByInvoiceID retrieves the credit notes against an invoice, oldest first
+func (r *creditNoteRepository) GetByInvoiceID(ctx context.Context, invoiceID primitive.ObjectID) ([]models.CreditNote, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "creditNoteDate", Value: 1}})
+	cursor, err := r.collection.Find(ctx, bson.M{"invoiceId": invoiceID, "sequence": bson.M{"$gt": 0}}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find credit notes: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	creditNotes := []models.CreditNote{}
+	if err := cursor.All(ctx, &creditNotes); err != nil {
+		return nil, fmt.Errorf("failed to decode credit notes: %w", err)
+	}
+	return creditNotes, nil
+}
+
+// GetByRefundID retrieves the credit note issued for a refund of an order
+func (r *creditNoteRepository) GetByRefundID(ctx context.Context, orderID primitive.ObjectID, refundID string) (*models.CreditNote, error) {
+	return r.findOne(ctx, bson.M{"orderId": orderID, "refundId": refundID})
+}
+
+// List retrieves credit notes with filters, newest first
+func (r *creditNoteRepository) List(ctx context.Context, filter *models.CreditNoteFilter) ([]models.CreditNote, int64, error) {
+	mongoFilter := bson.M{"sequence": bson.M{"$gt": 0}}
+	if filter.InvoiceID != nil {
+		mongoFilter["invoiceId"] = *filter.InvoiceID
+	} else if len(filter.InvoiceIDs) > 0 {
+		mongoFilter["invoiceId"] = bson.M{"$in": filter.InvoiceIDs}
+	}
+	if filter.OrderID != nil {
+		mongoFilter["orderId"] = *filter.OrderID
+	}
+	if filter.DateFrom != nil || filter.DateTo != nil {
+		dateFilter := bson.M{}
+		if filter.DateFrom != nil {
+			dateFilter["$gte"] = *filter.DateFrom
+		}
+		if filter.DateTo != nil {
+			dateFilter["$lte"] = *filter.DateTo
+		}
+		mongoFilter["creditNoteDate"] = dateFilter
+	}
+
+	page := filter.Page
+	if page < 1 {
+		page = 1
+	}
+	limit := filter.Limit
+	if limit < 1 {
+		limit = 20
+	}
+
+	total, err := r.collection.CountDocuments(ctx, mongoFilter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count credit notes: %w", err)
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "creditNoteDate", Value: -1}}).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit))
+	cursor, err := r.collection.Find(ctx, mongoFilter, opts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to find credit notes: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	creditNotes := []models.CreditNote{}
+	if err := cursor.All(ctx, &creditNotes); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode credit notes: %w", err)
+	}
+	return creditNotes, total, nil
+}
+
+// AssignNumber gives a draft credit note the number after the highest of its
+// financial year. As with invoices, the number is only taken by saving it on
+// the draft, so a save that fails never uses a number up.
+func (r *creditNoteRepository) AssignNumber(ctx context.Context, creditNote *models.CreditNote) error {
+	opts := options.FindOne().SetSort(bson.M{"sequence": -1}).SetProjection(bson.M{"sequence": 1})
+
+	for attempt := 0; attempt < maxNumberAttempts; attempt++ {
+		var last models.CreditNote
+		err := r.collection.FindOne(ctx, bson.M{"financialYear": creditNote.FinancialYear, "sequence": bson.M{"$gt": 0}}, opts).Decode(&last)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return fmt.Errorf("failed to find the last credit note number: %w", err)
+		}
+
+		sequence := last.Sequence + 1
+		number := models.DocumentNumber(models.CreditNoteSeriesPrefix, creditNote.FinancialYear, sequence)
+		result, err := r.collection.UpdateOne(ctx,
+			bson.M{"_id": creditNote.ID, "sequence": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{
+				"creditNoteNumber": number,
+				"financialYear":    creditNote.FinancialYear,
+				"sequence":         sequence,
+			}},
+		)
+		if mongo.IsDuplicateKeyError(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to number credit note: %w", err)
+		}
+		if result.MatchedCount == 0 {
+			return repository.ErrCreditNoteNumbered
+		}
+
+		creditNote.CreditNoteNumber = number
+		creditNote.Sequence = sequence
+		return nil
+	}
+	return fmt.Errorf("failed to number credit note: series %s is busy", models.DocumentSeries(models.CreditNoteSeriesPrefix, creditNote.FinancialYear))
+}
+
+func (r *creditNoteRepository) findOne(ctx context.Context, filter bson.M) (*models.CreditNote, error) {
+	var creditNote models.CreditNote
+	if err := r.collection.FindOne(ctx, filter).Decode(&creditNote); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, repository.ErrCreditNoteNotFound
+		}
+		return nil, fmt.Errorf("failed to get credit note: %w", err)
+	}
+	return &creditNote, nil
+}
@@ -545,6 +545,53 @@ func (r *homepageRepository) GetRecentlyViewed(ctx context.Context, userID *prim
 	return recentlyViewed.ProductIDs, nil
 }
 
+// MergeRecentlyViewed moves a guest session's recently viewed products in front of the
+// user's own history and removes the guest entry. Returns false if the guest had none.
+func (r *homepageRepository) MergeRecentlyViewed(ctx context.Context, sessionID string, userID primitive.ObjectID) (bool, error) {
+	var guest models.RecentlyViewed
+	err := r.recentlyViewedCollection.FindOne(ctx, bson.M{"sessionId": sessionID}).Decode(&guest)
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get guest recently viewed: %w", err)
+	}
+
+	userHistory, err := r.GetRecentlyViewed(ctx, &userID, nil, 0)
+	if err != nil {
+		return false, err
+	}
+
+	merged := make([]primitive.ObjectID, 0, 20)
+	seen := make(map[primitive.ObjectID]bool)
+	for _, ids := range [][]primitive.ObjectID{guest.ProductIDs, userHistory} {
+		for _, id := range ids {
+			if seen[id] || len(merged) == 20 {
+				continue
+			}
+			seen[id] = true
+			merged = append(merged, id)
+		}
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"productIds": merged,
+			"updatedAt":  time.Now(),
+		},
+	}
+	opts := options.Update().SetUpsert(true)
+	if _, err := r.recentlyViewedCollection.UpdateOne(ctx, bson.M{"userId": userID}, update, opts); err != nil {
+		return false, fmt.Errorf("failed to merge recently viewed: %w", err)
+	}
+
+	if _, err := r.recentlyViewedCollection.DeleteOne(ctx, bson.M{"_id": guest.ID}); err != nil {
+		return false, fmt.Errorf("failed to remove guest recently viewed: %w", err)
+	}
+
+	return true, nil
+}
+
 // 360° Showcase
 
 func (r *homepageRepository) CreateShowcase(ctx context.Context, showcase *models.Showcase360) error {
@@ -0,0 +1,198 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type inventoryUnitRepository struct {
+	collection *mongo.Collection
+}
+
+// NewInventoryUnitRepository creates a new inventory unit repository. Serials
+// and HUIDs are unique, so a piece cannot be entered twice.
+func NewInventoryUnitRepository(db *mongo.Database) repository.InventoryUnitRepository {
+	collection := db.Collection("inventory_units")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "serial", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "huid", Value: 1}},
+			Options: options.Index().SetUnique(true).SetSparse(true),
+		},
+		{
+			Keys: bson.D{{Key: "productId", Value: 1}, {Key: "status", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "orderId", Value: 1}},
+		},
+	})
+	if err != nil {
+		fmt.Printf("Warning: failed to create inventory unit indexes: %v\n", err)
+	}
+
+	return &inventoryUnitRepository{collection: collection}
+}
+
+func (r *inventoryUnitRepository) Create(ctx context.Context, unit *models.InventoryUnit) error {
+	if unit.ID.IsZero() {
+		unit.ID = primitive.NewObjectID()
+	}
+	unit.CreatedAt = time.Now()
+	unit.UpdatedAt = unit.CreatedAt
+
+	_, err := r.collection.InsertOne(ctx, unit)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("a unit with serial %s or HUID %s already exists", unit.Serial, unit.HUID)
+		}
+		return fmt.Errorf("failed to create inventory unit: %w", err)
+	}
+
+	return nil
+}
+
+// Update saves a unit's details and status. Units are allocated to and
+// released from orders with Allocate and Release.
+func (r *inventoryUnitRepository) Update(ctx context.Context, unit *models.InventoryUnit) error {
+	unit.UpdatedAt = time.Now()
+
+	update := bson.M{
+		"$set": bson.M{
+			"serial":      unit.Serial,
+			"grossWeight": unit.GrossWeight,
+			"netWeight":   unit.NetWeight,
+			"purity":      unit.Purity,
+			"status":      unit.Status,
+			"notes":       unit.Notes,
+			"updatedAt":   unit.UpdatedAt,
+		},
+	}
+	// The HUID index is sparse, so units without one must not store an empty string
+	if unit.HUID != "" {
+		update["$set"].(bson.M)["huid"] = unit.HUID
+	} else {
+		update["$unset"] = bson.M{"huid": ""}
+	}
+
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": unit.ID}, update)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("a unit with serial %s or HUID %s already exists", unit.Serial, unit.HUID)
+		}
+		return fmt.Errorf("failed to update inventory unit: %w", err)
+	}
+
+	return nil
+}
+
+func (r *inventoryUnitRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.InventoryUnit, error) {
+	return r.findOne(ctx, bson.M{"_id": id})
+}
+
+func (r *inventoryUnitRepository) GetByCode(ctx context.Context, code string) (*models.InventoryUnit, error) {
+	unit, err := r.findOne(ctx, bson.M{"serial": code})
+	if err == nil {
+		return unit, nil
+	}
+	return r.findOne(ctx, bson.M{"huid": models.NormalizeHUID(code)})
+}
+
+func (r *inventoryUnitRepository) GetByHUID(ctx context.Context, huid string) (*models.InventoryUnit, error) {
+	return r.findOne(ctx, bson.M{"huid": huid})
+}
+
+func (r *inventoryUnitRepository) GetByProduct(ctx context.Context, productID primitive.ObjectID, status models.InventoryUnitStatus) ([]models.InventoryUnit, error) {
+	filter := bson.M{"productId": productID}
+	if status != "" {
+		filter["status"] = status
+	}
+	return r.find(ctx, filter, bson.D{{Key: "createdAt", Value: 1}})
+}
+
+func (r *inventoryUnitRepository) GetByOrder(ctx context.Context, orderID primitive.ObjectID) ([]models.InventoryUnit, error) {
+	return r.find(ctx, bson.M{"orderId": orderID}, bson.D{{Key: "lineIndex", Value: 1}, {Key: "assignedAt", Value: 1}})
+}
+
+func (r *inventoryUnitRepository) Allocate(ctx context.Context, unitID, orderID primitive.ObjectID, orderNumber string, lineIndex int, actor models.OrderActor) (*models.InventoryUnit, error) {
+	now := time.Now()
+	filter := bson.M{"_id": unitID, "status": models.InventoryUnitInStock}
+	update := bson.M{
+		"$set": bson.M{
+			"status":      models.InventoryUnitSold,
+			"orderId":     orderID,
+			"orderNumber": orderNumber,
+			"lineIndex":   lineIndex,
+			"assignedAt":  now,
+			"assignedBy":  actor,
+			"updatedAt":   now,
+		},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var unit models.InventoryUnit
+	err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&unit)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, repository.ErrInventoryUnitUnavailable
+		}
+		return nil, fmt.Errorf("failed to allocate inventory unit: %w", err)
+	}
+
+	return &unit, nil
+}
+
+func (r *inventoryUnitRepository) Release(ctx context.Context, unitID, orderID primitive.ObjectID) error {
+	filter := bson.M{"_id": unitID, "orderId": orderID, "status": models.InventoryUnitSold}
+	update := bson.M{
+		"$set":   bson.M{"status": models.InventoryUnitInStock, "updatedAt": time.Now()},
+		"$unset": bson.M{"orderId": "", "orderNumber": "", "lineIndex": "", "assignedAt": "", "assignedBy": ""},
+	}
+
+	if _, err := r.collection.UpdateOne(ctx, filter, update); err != nil {
+		return fmt.Errorf("failed to release inventory unit: %w", err)
+	}
+	return nil
+}
+
+func (r *inventoryUnitRepository) find(ctx context.Context, filter bson.M, sort bson.D) ([]models.InventoryUnit, error) {
+	cursor, err := r.collection.Find(ctx, filter, options.Find().SetSort(sort))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get inventory units: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var units []models.InventoryUnit
+	if err := cursor.All(ctx, &units); err != nil {
+		return nil, fmt.Errorf("failed to decode inventory units: %w", err)
+	}
+
+	return units, nil
+}
+
+func (r *inventoryUnitRepository) findOne(ctx context.Context, filter bson.M) (*models.InventoryUnit, error) {
+	var unit models.InventoryUnit
+	err := r.collection.FindOne(ctx, filter).Decode(&unit)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("inventory unit not found")
+		}
+		return nil, fmt.Errorf("failed to get inventory unit: %w", err)
+	}
+
+	return &unit, nil
+}
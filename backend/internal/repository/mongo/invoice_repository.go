@@ -15,15 +15,39 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// maxNumberAttempts is how many numbers a draft tries when others are saving theirs at the same time
+const maxNumberAttempts = 5
+
 type invoiceRepository struct {
 	collection *mongo.Collection
 }
 
-// NewInvoiceRepository creates a new invoice repository
+// NewInvoiceRepository creates a new invoice repository. An order can have one
+// invoice without a voidedAt, so two requests invoicing the same order cannot
+// both create one; void invoices differ by the time they were voided.
 func NewInvoiceRepository(db *mongo.Database) repository.InvoiceRepository {
-	return &invoiceRepository{
-		collection: db.Collection("invoices"),
+	invoices := db.Collection("invoices")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := invoices.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "orderId", Value: 1}, {Key: "voidedAt", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "invoiceNumber", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"sequence": bson.M{"$gt": 0}}),
+		},
+		{
+			Keys: bson.D{{Key: "financialYear", Value: 1}, {Key: "sequence", Value: -1}},
+		},
+	})
+	if err != nil {
+		fmt.Printf("Warning: failed to create invoice indexes: %v\n", err)
 	}
+
+	return &invoiceRepository{collection: invoices}
 }
 
 // Create creates a new invoice
@@ -33,6 +57,9 @@ func (r *invoiceRepository) Create(ctx context.Context, invoice *models.Invoice)
 
 	result, err := r.collection.InsertOne(ctx, invoice)
 	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return repository.ErrInvoiceExists
+		}
 		return fmt.Errorf("failed to create invoice: %w", err)
 	}
 
@@ -53,13 +80,15 @@ func (r *invoiceRepository) GetByID(ctx context.Context, id primitive.ObjectID)
 	return &invoice, nil
 }
 
-// GetByOrderID retrieves an invoice by order ID
+// GetByOrderID retrieves the order's current invoice; void invoices are skipped
 func (r *invoiceRepository) GetByOrderID(ctx context.Context, orderID primitive.ObjectID) (*models.Invoice, error) {
 	var invoice models.Invoice
-	err := r.collection.FindOne(ctx, bson.M{"orderId": orderID}).Decode(&invoice)
+	filter := bson.M{"orderId": orderID, "status": bson.M{"$ne": models.InvoiceStatusVoid}}
+	opts := options.FindOne().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	err := r.collection.FindOne(ctx, filter, opts).Decode(&invoice)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
-			return nil, fmt.Errorf("invoice not found for order")
+			return nil, repository.ErrInvoiceNotFound
 		}
 		return nil, fmt.Errorf("failed to get invoice: %w", err)
 	}
@@ -158,20 +187,6 @@ func (r *invoiceRepository) Update(ctx context.Context, invoice *models.Invoice)
 	return nil
 }
 
-// Delete deletes an invoice
-func (r *invoiceRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
-	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
-	if err != nil {
-		return fmt.Errorf("failed to delete invoice: %w", err)
-	}
-
-	if result.DeletedCount == 0 {
-		return fmt.Errorf("invoice not found")
-	}
-
-	return nil
-}
-
 // MarkAsDownloaded marks an invoice as downloaded
 func (r *invoiceRepository) MarkAsDownloaded(ctx context.Context, id primitive.ObjectID) error {
 	now := time.Now()
@@ -196,6 +211,51 @@ func (r *invoiceRepository) MarkAsDownloaded(ctx context.Context, id primitive.O
 	return nil
 }
 
+// AssignNumber gives a draft invoice the number after the highest of its
+// financial year. The number is only taken by saving it on the draft: the
+// unique invoice number index turns away one another invoice saved first, and
+// the next is tried, so a save that fails never uses a number up.
+func (r *invoiceRepository) AssignNumber(ctx context.Context, invoice *models.Invoice) error {
+	opts := options.FindOne().SetSort(bson.M{"sequence": -1}).SetProjection(bson.M{"sequence": 1})
+
+	for attempt := 0; attempt < maxNumberAttempts; attempt++ {
+		var last models.Invoice
+		err := r.collection.FindOne(ctx, bson.M{"financialYear": invoice.FinancialYear, "sequence": bson.M{"$gt": 0}}, opts).Decode(&last)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return fmt.Errorf("failed to find the last invoice number: %w", err)
+		}
+
+		sequence := last.Sequence + 1
+		number := models.DocumentNumber(models.InvoiceSeriesPrefix, invoice.FinancialYear, sequence)
+		now := time.Now()
+		result, err := r.collection.UpdateOne(ctx,
+			bson.M{"_id": invoice.ID, "sequence": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{
+				"invoiceNumber": number,
+				"financialYear": invoice.FinancialYear,
+				"sequence":      sequence,
+				"status":        invoice.Status,
+				"updatedAt":     now,
+			}},
+		)
+		if mongo.IsDuplicateKeyError(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to number invoice: %w", err)
+		}
+		if result.MatchedCount == 0 {
+			return repository.ErrInvoiceNumbered
+		}
+
+		invoice.InvoiceNumber = number
+		invoice.Sequence = sequence
+		invoice.UpdatedAt = now
+		return nil
+	}
+	return fmt.Errorf("failed to number invoice: series %s is busy", models.DocumentSeries(models.InvoiceSeriesPrefix, invoice.FinancialYear))
+}
+
 // Helper function for pagination
 func (r *invoiceRepository) findWithPagination(ctx context.Context, filter bson.M, page, limit int) ([]models.Invoice, int64, error) {
 	// Count total documents
@@ -0,0 +1,252 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type stockLocationRepository struct {
+	collection *mongo.Collection
+}
+
+// NewStockLocationRepository creates a new stock location repository.
+// Location codes are unique.
+func NewStockLocationRepository(db *mongo.Database) repository.StockLocationRepository {
+	collection := db.Collection("stock_locations")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "code", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+	})
+	if err != nil {
+		fmt.Printf("Warning: failed to create stock location indexes: %v\n", err)
+	}
+
+	return &stockLocationRepository{collection: collection}
+}
+
+func (r *stockLocationRepository) Create(ctx context.Context, location *models.StockLocation) error {
+	if location.ID.IsZero() {
+		location.ID = primitive.NewObjectID()
+	}
+	location.CreatedAt = time.Now()
+	location.UpdatedAt = location.CreatedAt
+
+	if _, err := r.collection.InsertOne(ctx, location); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return repository.ErrDuplicateLocationCode
+		}
+		return fmt.Errorf("failed to create stock location: %w", err)
+	}
+	return nil
+}
+
+// Update saves a location's details. The default is changed with SetDefault.
+func (r *stockLocationRepository) Update(ctx context.Context, location *models.StockLocation) error {
+	location.UpdatedAt = time.Now()
+
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": location.ID}, bson.M{
+		"$set": bson.M{
+			"name":            location.Name,
+			"type":            location.Type,
+			"address":         location.Address,
+			"city":            location.City,
+			"state":           location.State,
+			"pincode":         location.Pincode,
+			"phone":           location.Phone,
+			"servicePincodes": location.ServicePincodes,
+			"priority":        location.Priority,
+			"clickAndCollect": location.ClickAndCollect,
+			"isActive":        location.IsActive,
+			"updatedAt":       location.UpdatedAt,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update stock location: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return repository.ErrStockLocationNotFound
+	}
+	return nil
+}
+
+func (r *stockLocationRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.StockLocation, error) {
+	var location models.StockLocation
+	if err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&location); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, repository.ErrStockLocationNotFound
+		}
+		return nil, fmt.Errorf("failed to get stock location: %w", err)
+	}
+	return &location, nil
+}
+
+func (r *stockLocationRepository) GetAll(ctx context.Context, activeOnly bool) ([]models.StockLocation, error) {
+	filter := bson.M{}
+	if activeOnly {
+		filter["isActive"] = true
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "priority", Value: 1}, {Key: "code", Value: 1}})
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stock locations: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	locations := []models.StockLocation{}
+	if err := cursor.All(ctx, &locations); err != nil {
+		return nil, fmt.Errorf("failed to decode stock locations: %w", err)
+	}
+	return locations, nil
+}
+
+func (r *stockLocationRepository) GetDefault(ctx context.Context) (*models.StockLocation, error) {
+	var location models.StockLocation
+	if err := r.collection.FindOne(ctx, bson.M{"isDefault": true}).Decode(&location); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, repository.ErrStockLocationNotFound
+		}
+		return nil, fmt.Errorf("failed to get default stock location: %w", err)
+	}
+	return &location, nil
+}
+
+func (r *stockLocationRepository) SetDefault(ctx context.Context, id primitive.ObjectID) error {
+	now := time.Now()
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$set": bson.M{"isDefault": true, "updatedAt": now},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set default stock location: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return repository.ErrStockLocationNotFound
+	}
+
+	_, err = r.collection.UpdateMany(ctx, bson.M{"_id": bson.M{"$ne": id}, "isDefault": true}, bson.M{
+		"$set": bson.M{"isDefault": false, "updatedAt": now},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to clear default stock location: %w", err)
+	}
+	return nil
+}
+
+type stockTransferRepository struct {
+	collection *mongo.Collection
+}
+
+// NewStockTransferRepository creates a new stock transfer repository
+func NewStockTransferRepository(db *mongo.Database) repository.StockTransferRepository {
+	collection := db.Collection("stock_transfers")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "transferNumber", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "fromLocationId", Value: 1}, {Key: "createdAt", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "toLocationId", Value: 1}, {Key: "createdAt", Value: -1}},
+		},
+	})
+	if err != nil {
+		fmt.Printf("Warning: failed to create stock transfer indexes: %v\n", err)
+	}
+
+	return &stockTransferRepository{collection: collection}
+}
+
+func (r *stockTransferRepository) Create(ctx context.Context, transfer *models.StockTransfer) error {
+	if transfer.ID.IsZero() {
+		transfer.ID = primitive.NewObjectID()
+	}
+	transfer.CreatedAt = time.Now()
+	transfer.UpdatedAt = transfer.CreatedAt
+
+	if _, err := r.collection.InsertOne(ctx, transfer); err != nil {
+		return fmt.Errorf("failed to create stock transfer: %w", err)
+	}
+	return nil
+}
+
+func (r *stockTransferRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.StockTransfer, error) {
+	var transfer models.StockTransfer
+	if err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&transfer); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, repository.ErrStockTransferNotFound
+		}
+		return nil, fmt.Errorf("failed to get stock transfer: %w", err)
+	}
+	return &transfer, nil
+}
+
+func (r *stockTransferRepository) GetAll(ctx context.Context, filter models.StockTransferFilter) ([]models.StockTransfer, int64, error) {
+	query := bson.M{}
+	if filter.LocationID != nil {
+		query["$or"] = bson.A{
+			bson.M{"fromLocationId": *filter.LocationID},
+			bson.M{"toLocationId": *filter.LocationID},
+		}
+	}
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+
+	total, err := r.collection.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count stock transfers: %w", err)
+	}
+
+	cursor, err := r.collection.Find(ctx, query, pageOptions(filter.Page, filter.Limit, bson.D{{Key: "createdAt", Value: -1}}))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get stock transfers: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var transfers []models.StockTransfer
+	if err := cursor.All(ctx, &transfers); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode stock transfers: %w", err)
+	}
+
+	return transfers, total, nil
+}
+
+func (r *stockTransferRepository) Close(ctx context.Context, transfer *models.StockTransfer) error {
+	transfer.UpdatedAt = time.Now()
+
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": transfer.ID, "status": models.StockTransferInTransit}, bson.M{
+		"$set": bson.M{
+			"status":      transfer.Status,
+			"closedBy":    transfer.ClosedBy,
+			"receivedAt":  transfer.ReceivedAt,
+			"cancelledAt": transfer.CancelledAt,
+			"updatedAt":   transfer.UpdatedAt,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to close stock transfer: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return repository.ErrStockTransferClosed
+	}
+	return nil
+}
@@ -102,6 +102,21 @@ func (r *loyaltyRepository) GetTransactionHistory(ctx context.Context, userID pr
 	return transactions, nil
 }
 
+func (r *loyaltyRepository) GetTransactionsByOrder(ctx context.Context, userID, orderID primitive.ObjectID) ([]models.PointTransaction, error) {
+	cursor, err := r.transactionCollection.Find(ctx, bson.M{"userId": userID, "orderId": orderID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order transactions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var transactions []models.PointTransaction
+	if err = cursor.All(ctx, &transactions); err != nil {
+		return nil, fmt.Errorf("failed to decode transactions: %w", err)
+	}
+
+	return transactions, nil
+}
+
 func (r *loyaltyRepository) GetConfig(ctx context.Context) (*models.LoyaltyConfig, error) {
 	var config models.LoyaltyConfig
 	err := r.configCollection.FindOne(ctx, bson.M{}).Decode(&config)
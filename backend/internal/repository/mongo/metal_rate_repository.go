@@ -0,0 +1,101 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type metalRateRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMetalRateRepository creates a new metal rate repository
+func NewMetalRateRepository(db *mongo.Database) repository.MetalRateRepository {
+	collection := db.Collection("metal_rates")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "code", Value: 1}, {Key: "createdAt", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "createdAt", Value: -1}},
+		},
+	})
+	if err != nil {
+		fmt.Printf("Warning: failed to create metal rate indexes: %v\n", err)
+	}
+
+	return &metalRateRepository{collection: collection}
+}
+
+func (r *metalRateRepository) Create(ctx context.Context, rate *models.MetalRate) error {
+	if rate.ID.IsZero() {
+		rate.ID = primitive.NewObjectID()
+	}
+	if rate.CreatedAt.IsZero() {
+		rate.CreatedAt = time.Now()
+	}
+
+	if _, err := r.collection.InsertOne(ctx, rate); err != nil {
+		return fmt.Errorf("failed to create metal rate: %w", err)
+	}
+	return nil
+}
+
+func (r *metalRateRepository) GetCurrent(ctx context.Context) ([]models.MetalRate, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$sort", Value: bson.D{{Key: "code", Value: 1}, {Key: "createdAt", Value: -1}}}},
+		{{Key: "$group", Value: bson.D{{Key: "_id", Value: "$code"}, {Key: "rate", Value: bson.D{{Key: "$first", Value: "$$ROOT"}}}}}},
+		{{Key: "$replaceRoot", Value: bson.D{{Key: "newRoot", Value: "$rate"}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "code", Value: 1}}}},
+	}
+
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metal rates: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var rates []models.MetalRate
+	if err := cursor.All(ctx, &rates); err != nil {
+		return nil, fmt.Errorf("failed to decode metal rates: %w", err)
+	}
+
+	return rates, nil
+}
+
+func (r *metalRateRepository) GetHistory(ctx context.Context, filter models.MetalRateHistoryFilter) ([]models.MetalRate, int64, error) {
+	query := bson.M{}
+	if filter.Code != "" {
+		query["code"] = filter.Code
+	}
+
+	total, err := r.collection.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count metal rates: %w", err)
+	}
+
+	opts := pageOptions(filter.Page, filter.Limit, bson.D{{Key: "createdAt", Value: -1}})
+	cursor, err := r.collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get metal rate history: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var rates []models.MetalRate
+	if err := cursor.All(ctx, &rates); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode metal rates: %w", err)
+	}
+
+	return rates, total, nil
+}
@@ -76,6 +76,116 @@ func (r *orderRepository) Update(ctx context.Context, order *models.Order) error
 	return nil
 }
 
+// TransitionStatus saves a status change only while the order is still in the
+// status, and payment status, it was read with. The new history entry is pushed
+// so entries recorded concurrently are kept.
+func (r *orderRepository) TransitionStatus(ctx context.Context, order *models.Order, from models.OrderStatus, fromPayment models.PaymentStatus) error {
+	filter := bson.M{"_id": order.ID, "status": from}
+	set := bson.M{
+		"status":    order.Status,
+		"updatedAt": order.UpdatedAt,
+	}
+	if order.PaymentStatus != fromPayment {
+		filter["paymentStatus"] = fromPayment
+		set["paymentStatus"] = order.PaymentStatus
+	}
+	if order.ProcessedAt != nil {
+		set["processedAt"] = order.ProcessedAt
+	}
+	if order.ShippedAt != nil {
+		set["shippedAt"] = order.ShippedAt
+	}
+	if order.DeliveredAt != nil {
+		set["deliveredAt"] = order.DeliveredAt
+	}
+	if order.TrackingNumber != nil {
+		set["trackingNumber"] = order.TrackingNumber
+	}
+	if order.CancellationReason != nil {
+		set["cancellationReason"] = order.CancellationReason
+	}
+	if order.ReturnReason != nil {
+		set["returnReason"] = order.ReturnReason
+	}
+
+	update := bson.M{"$set": set}
+	if n := len(order.StatusHistory); n > 0 {
+		update["$push"] = bson.M{"statusHistory": order.StatusHistory[n-1]}
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("failed to update order status: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("%w: order %s changed since it was read", models.ErrInvalidOrderStatusTransition, order.OrderNumber)
+	}
+	return nil
+}
+
+// AddRefund pushes a refund recorded with Order.RecordRefund, with the refund
+// summary and payment status it left. Refunds saved concurrently are kept, and
+// a refund ID already saved is not pushed twice.
+func (r *orderRepository) AddRefund(ctx context.Context, order *models.Order, refund models.PaymentRefund) error {
+	filter := bson.M{"_id": order.ID, "refunds.refundId": bson.M{"$ne": refund.RefundID}}
+	set := bson.M{
+		"paymentStatus": order.PaymentStatus,
+		"refundStatus":  order.RefundStatus,
+		"refundAmount":  order.RefundAmount,
+		"updatedAt":     time.Now(),
+	}
+	if order.RefundedAt != nil {
+		set["refundedAt"] = order.RefundedAt
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, bson.M{"$push": bson.M{"refunds": refund}, "$set": set})
+	if err != nil {
+		return fmt.Errorf("failed to save refund: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("refund %s of order %s is already saved", refund.RefundID, order.OrderNumber)
+	}
+	return nil
+}
+
+// UpdateStock saves the order's stock reservation and, for each line, whether
+// stock was taken, the location it was taken from and the pieces packed into it
+func (r *orderRepository) UpdateStock(ctx context.Context, order *models.Order) error {
+	set := bson.M{"stockStatus": order.StockStatus, "updatedAt": time.Now()}
+	unset := bson.M{}
+	if order.StockReservedUntil != nil {
+		set["stockReservedUntil"] = order.StockReservedUntil
+	} else {
+		unset["stockReservedUntil"] = ""
+	}
+	if order.FulfillmentLocationID != nil {
+		set["fulfillmentLocationId"] = order.FulfillmentLocationID
+	} else {
+		unset["fulfillmentLocationId"] = ""
+	}
+	for i, item := range order.Items {
+		line := fmt.Sprintf("items.%d.", i)
+		set[line+"stockReserved"] = item.StockReserved
+		if item.LocationID != nil {
+			set[line+"locationId"] = item.LocationID
+		}
+		if len(item.Units) > 0 {
+			set[line+"units"] = item.Units
+		} else {
+			unset[line+"units"] = ""
+		}
+	}
+
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	if _, err := r.collection.UpdateOne(ctx, bson.M{"_id": order.ID}, update); err != nil {
+		return fmt.Errorf("failed to save order stock: %w", err)
+	}
+	return nil
+}
+
 func (r *orderRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
 	_, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
 	if err != nil {
@@ -320,6 +430,125 @@ func (r *orderRepository) ExportOrders(ctx context.Context, format string, start
 	return fmt.Sprintf("orders_export_%s.%s", time.Now().Format("20060102"), format), nil
 }
 
+func (r *orderRepository) GetExpiredReservations(ctx context.Context, before time.Time) ([]models.Order, error) {
+	filter := bson.M{
+		"stockStatus":        models.StockReservationReserved,
+		"paymentStatus":      bson.M{"$in": []models.PaymentStatus{models.PaymentStatusPending, models.PaymentStatusFailed}},
+		"stockReservedUntil": bson.M{"$lte": before},
+	}
+
+	cursor, err := r.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get expired reservations: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var orders []models.Order
+	if err := cursor.All(ctx, &orders); err != nil {
+		return nil, fmt.Errorf("failed to decode orders: %w", err)
+	}
+
+	return orders, nil
+}
+
+func (r *orderRepository) GetFailedRefunds(ctx context.Context) ([]models.Order, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{"refunds.status": models.RefundStatusFailed})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get failed refunds: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var orders []models.Order
+	if err := cursor.All(ctx, &orders); err != nil {
+		return nil, fmt.Errorf("failed to decode orders: %w", err)
+	}
+
+	return orders, nil
+}
+
+// GetUnsettledPayments returns orders created since the given time that reached a
+// payment gateway but are not marked paid
+func (r *orderRepository) GetUnsettledPayments(ctx context.Context, since time.Time) ([]models.Order, error) {
+	filter := bson.M{
+		"paymentStatus":          bson.M{"$in": []models.PaymentStatus{models.PaymentStatusPending, models.PaymentStatusFailed, models.PaymentStatusCancelled}},
+		"paymentProviderOrderId": bson.M{"$exists": true},
+		"createdAt":              bson.M{"$gte": since},
+	}
+	cursor, err := r.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get unsettled orders: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var orders []models.Order
+	if err := cursor.All(ctx, &orders); err != nil {
+		return nil, fmt.Errorf("failed to decode orders: %w", err)
+	}
+
+	return orders, nil
+}
+
+func (r *orderRepository) GetByUnitHUID(ctx context.Context, huid string) ([]models.Order, error) {
+	opts := options.Find().SetSort(bson.M{"createdAt": -1})
+	cursor, err := r.collection.Find(ctx, bson.M{"items.units.huid": huid}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get orders by HUID: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var orders []models.Order
+	if err := cursor.All(ctx, &orders); err != nil {
+		return nil, fmt.Errorf("failed to decode orders: %w", err)
+	}
+
+	return orders, nil
+}
+
+func (r *orderRepository) GetByLocation(ctx context.Context, locationID primitive.ObjectID, page, limit int, status *models.OrderStatus) ([]models.Order, int64, error) {
+	filter := bson.M{"items.locationId": locationID}
+	if status != nil {
+		filter["status"] = *status
+	}
+
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count orders: %w", err)
+	}
+
+	cursor, err := r.collection.Find(ctx, filter, pageOptions(page, limit, bson.D{{Key: "createdAt", Value: -1}}))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get orders by location: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var orders []models.Order
+	if err := cursor.All(ctx, &orders); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode orders: %w", err)
+	}
+
+	return orders, total, nil
+}
+
+func (r *orderRepository) AssignGuestOrders(ctx context.Context, sessionID string, userID primitive.ObjectID) (int64, error) {
+	filter := bson.M{
+		"guestSessionId": sessionID,
+		"userId":         bson.M{"$exists": false},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"userId":    userID,
+			"updatedAt": time.Now(),
+		},
+	}
+
+	result, err := r.collection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, fmt.Errorf("failed to assign guest orders: %w", err)
+	}
+
+	return result.ModifiedCount, nil
+}
+
 func (r *orderRepository) UpdateStatus(ctx context.Context, orderID primitive.ObjectID, status models.OrderStatus) error {
 	_, err := r.collection.UpdateOne(
 		ctx,
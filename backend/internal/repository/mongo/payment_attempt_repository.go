@@ -0,0 +1,99 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type paymentAttemptRepository struct {
+	collection *mongo.Collection
+}
+
+// NewPaymentAttemptRepository creates a new payment attempt repository
+func NewPaymentAttemptRepository(db *mongo.Database) repository.PaymentAttemptRepository {
+	return &paymentAttemptRepository{
+		collection: db.Collection("payment_attempts"),
+	}
+}
+
+func (r *paymentAttemptRepository) Create(ctx context.Context, attempt *models.PaymentAttempt) error {
+	if attempt.ID.IsZero() {
+		attempt.ID = primitive.NewObjectID()
+	}
+	attempt.CreatedAt = time.Now()
+	attempt.UpdatedAt = attempt.CreatedAt
+
+	_, err := r.collection.InsertOne(ctx, attempt)
+	if err != nil {
+		return fmt.Errorf("failed to create payment attempt: %w", err)
+	}
+
+	return nil
+}
+
+func (r *paymentAttemptRepository) Update(ctx context.Context, attempt *models.PaymentAttempt) error {
+	attempt.UpdatedAt = time.Now()
+
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": attempt.ID}, bson.M{"$set": attempt})
+	if err != nil {
+		return fmt.Errorf("failed to update payment attempt: %w", err)
+	}
+
+	return nil
+}
+
+func (r *paymentAttemptRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.PaymentAttempt, error) {
+	return r.findOne(ctx, bson.M{"_id": id}, nil)
+}
+
+func (r *paymentAttemptRepository) GetByOrder(ctx context.Context, orderID primitive.ObjectID) ([]models.PaymentAttempt, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+
+	cursor, err := r.collection.Find(ctx, bson.M{"orderId": orderID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payment attempts: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var attempts []models.PaymentAttempt
+	if err := cursor.All(ctx, &attempts); err != nil {
+		return nil, fmt.Errorf("failed to decode payment attempts: %w", err)
+	}
+
+	return attempts, nil
+}
+
+func (r *paymentAttemptRepository) GetLatestByOrder(ctx context.Context, orderID primitive.ObjectID, gateway models.PaymentMethod) (*models.PaymentAttempt, error) {
+	opts := options.FindOne().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	return r.findOne(ctx, bson.M{"orderId": orderID, "gateway": gateway}, opts)
+}
+
+func (r *paymentAttemptRepository) GetByProviderOrderID(ctx context.Context, gateway models.PaymentMethod, providerOrderID string) (*models.PaymentAttempt, error) {
+	return r.findOne(ctx, bson.M{"gateway": gateway, "providerOrderId": providerOrderID}, nil)
+}
+
+func (r *paymentAttemptRepository) findOne(ctx context.Context, filter bson.M, opts *options.FindOneOptions) (*models.PaymentAttempt, error) {
+	if opts == nil {
+		opts = options.FindOne()
+	}
+
+	var attempt models.PaymentAttempt
+	err := r.collection.FindOne(ctx, filter, opts).Decode(&attempt)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("payment attempt not found")
+		}
+		return nil, fmt.Errorf("failed to get payment attempt: %w", err)
+	}
+
+	return &attempt, nil
+}
@@ -106,18 +106,62 @@ func (r *pdfRepository) GetByUserID(ctx context.Context, userID primitive.Object
 	return pdfs, nil
 }
 
+func (r *pdfRepository) GetByReference(ctx context.Context, pdfType string, referenceID primitive.ObjectID) (*models.PDFDocument, error) {
+	filter := bson.M{"type": pdfType, "referenceId": referenceID, "isActive": true}
+	opts := options.FindOne().SetSort(bson.M{"generatedAt": -1})
+
+	var pdf models.PDFDocument
+	err := r.pdfCollection.FindOne(ctx, filter, opts).Decode(&pdf)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, repository.ErrPDFDocumentNotFound
+		}
+		return nil, fmt.Errorf("failed to get PDF document by reference: %w", err)
+	}
+	return &pdf, nil
+}
+
 func (r *pdfRepository) GetOrderTracking(ctx context.Context, orderID primitive.ObjectID) (*models.OrderTracking, error) {
 	var tracking models.OrderTracking
 	err := r.trackingCollection.FindOne(ctx, bson.M{"orderId": orderID}).Decode(&tracking)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, fmt.Errorf("order tracking not found")
+			return nil, repository.ErrOrderTrackingNotFound
+		}
+		return nil, fmt.Errorf("failed to get order tracking: %w", err)
+	}
+	return &tracking, nil
+}
+
+func (r *pdfRepository) GetOrderTrackingByTrackingID(ctx context.Context, carrier string, trackingID string) (*models.OrderTracking, error) {
+	var tracking models.OrderTracking
+	err := r.trackingCollection.FindOne(ctx, bson.M{"carrier": carrier, "trackingId": trackingID}).Decode(&tracking)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, repository.ErrOrderTrackingNotFound
 		}
 		return nil, fmt.Errorf("failed to get order tracking: %w", err)
 	}
 	return &tracking, nil
 }
 
+func (r *pdfRepository) ListActiveOrderTracking(ctx context.Context, limit int) ([]models.OrderTracking, error) {
+	filter := bson.M{"status": bson.M{"$nin": []string{models.TrackingStatusDelivered, models.TrackingStatusCancelled}}}
+	opts := options.Find().SetSort(bson.D{{Key: "lastPolledAt", Value: 1}}).SetLimit(int64(limit))
+
+	cursor, err := r.trackingCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list order tracking: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var trackings []models.OrderTracking
+	if err = cursor.All(ctx, &trackings); err != nil {
+		return nil, fmt.Errorf("failed to decode order tracking: %w", err)
+	}
+	return trackings, nil
+}
+
 func (r *pdfRepository) CreateOrderTracking(ctx context.Context, tracking *models.OrderTracking) error {
 	tracking.ID = primitive.NewObjectID()
 	tracking.CreatedAt = time.Now()
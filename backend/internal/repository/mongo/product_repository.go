@@ -61,13 +61,28 @@ func (r *productRepository) GetBySKU(ctx context.Context, sku string) (*models.P
 	return &product, nil
 }
 
+// Update saves the product's details. Its stock is left alone: stock, and the
+// variants holding it, only change through the stock and variant repositories,
+// so units reserved since the product was read are kept.
 func (r *productRepository) Update(ctx context.Context, product *models.Product) error {
 	product.UpdatedAt = time.Now()
 
-	_, err := r.collection.UpdateOne(
+	data, err := bson.Marshal(product)
+	if err != nil {
+		return fmt.Errorf("failed to encode product: %w", err)
+	}
+	var set bson.M
+	if err := bson.Unmarshal(data, &set); err != nil {
+		return fmt.Errorf("failed to encode product: %w", err)
+	}
+	for _, field := range []string{"_id", "stockQuantity", "variants", "locationStock"} {
+		delete(set, field)
+	}
+
+	_, err = r.collection.UpdateOne(
 		ctx,
 		bson.M{"_id": product.ID},
-		bson.M{"$set": product},
+		bson.M{"$set": set},
 	)
 	if err != nil {
 		return fmt.Errorf("failed to update product: %w", err)
@@ -470,6 +485,37 @@ func (r *productRepository) UpdateStock(ctx context.Context, productID primitive
 	return nil
 }
 
+func (r *productRepository) GetByMetalCode(ctx context.Context, code string) ([]models.Product, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{
+		"pricingMode":             models.PricingModeMetalRate,
+		"weightPricing.metalCode": code,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metal rate products: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var products []models.Product
+	if err := cursor.All(ctx, &products); err != nil {
+		return nil, fmt.Errorf("failed to decode products: %w", err)
+	}
+
+	return products, nil
+}
+
+func (r *productRepository) UpdatePrice(ctx context.Context, id primitive.ObjectID, price, makingCharge float64) error {
+	_, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{"price": price, "makingCharge": makingCharge, "updatedAt": time.Now()}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update product price: %w", err)
+	}
+
+	return nil
+}
+
 func (r *productRepository) GetByCategory(ctx context.Context, category string, page, limit int) ([]models.Product, int64, error) {
 	filter := bson.M{"category": category}
 
@@ -0,0 +1,84 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type reconciliationReportRepository struct {
+	collection *mongo.Collection
+}
+
+// NewReconciliationReportRepository creates a new reconciliation report repository
+func NewReconciliationReportRepository(db *mongo.Database) repository.ReconciliationReportRepository {
+	return &reconciliationReportRepository{
+		collection: db.Collection("payment_reconciliation_reports"),
+	}
+}
+
+func (r *reconciliationReportRepository) Create(ctx context.Context, report *models.ReconciliationReport) error {
+	if report.ID.IsZero() {
+		report.ID = primitive.NewObjectID()
+	}
+
+	_, err := r.collection.InsertOne(ctx, report)
+	if err != nil {
+		return fmt.Errorf("failed to create reconciliation report: %w", err)
+	}
+
+	return nil
+}
+
+func (r *reconciliationReportRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.ReconciliationReport, error) {
+	var report models.ReconciliationReport
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&report)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("reconciliation report not found")
+		}
+		return nil, fmt.Errorf("failed to get reconciliation report: %w", err)
+	}
+
+	return &report, nil
+}
+
+func (r *reconciliationReportRepository) List(ctx context.Context, page, limit int) ([]models.ReconciliationReport, int64, error) {
+	total, err := r.collection.CountDocuments(ctx, bson.M{})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count reconciliation reports: %w", err)
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 20
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "startedAt", Value: -1}}).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit)).
+		SetProjection(bson.M{"entries": 0})
+
+	cursor, err := r.collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get reconciliation reports: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var reports []models.ReconciliationReport
+	if err := cursor.All(ctx, &reports); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode reconciliation reports: %w", err)
+	}
+
+	return reports, total, nil
+}
@@ -0,0 +1,176 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type returnRepository struct {
+	collection *mongo.Collection
+}
+
+// NewReturnRepository creates a new return request repository. RMA numbers are
+// derived from the order number, so their unique index is created here to stop
+// two concurrent requests for one order taking the same number.
+func NewReturnRepository(db *mongo.Database) repository.ReturnRepository {
+	collection := db.Collection("return_requests")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "rmaNumber", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "orderId", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "createdAt", Value: -1}},
+		},
+	})
+	if err != nil {
+		fmt.Printf("Warning: failed to create return request indexes: %v\n", err)
+	}
+
+	return &returnRepository{collection: collection}
+}
+
+func (r *returnRepository) Create(ctx context.Context, ret *models.ReturnRequest) error {
+	if ret.ID.IsZero() {
+		ret.ID = primitive.NewObjectID()
+	}
+	ret.CreatedAt = time.Now()
+	ret.UpdatedAt = ret.CreatedAt
+
+	_, err := r.collection.InsertOne(ctx, ret)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("return request %s already exists", ret.RMANumber)
+		}
+		return fmt.Errorf("failed to create return request: %w", err)
+	}
+
+	return nil
+}
+
+func (r *returnRepository) Update(ctx context.Context, ret *models.ReturnRequest) error {
+	ret.UpdatedAt = time.Now()
+
+	_, err := r.collection.ReplaceOne(ctx, bson.M{"_id": ret.ID}, ret)
+	if err != nil {
+		return fmt.Errorf("failed to update return request: %w", err)
+	}
+
+	return nil
+}
+
+// TransitionStatus saves the return request only while it is still in the status
+// it was read with, so a repeated or concurrent status change fails instead of
+// acting on the return twice
+func (r *returnRepository) TransitionStatus(ctx context.Context, ret *models.ReturnRequest, from models.ReturnStatus) error {
+	ret.UpdatedAt = time.Now()
+
+	result, err := r.collection.ReplaceOne(ctx, bson.M{"_id": ret.ID, "status": from}, ret)
+	if err != nil {
+		return fmt.Errorf("failed to update return request: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("%w: return %s changed since it was read", models.ErrInvalidReturnStatusTransition, ret.RMANumber)
+	}
+
+	return nil
+}
+
+func (r *returnRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.ReturnRequest, error) {
+	var ret models.ReturnRequest
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&ret)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("return request not found")
+		}
+		return nil, fmt.Errorf("failed to get return request: %w", err)
+	}
+
+	return &ret, nil
+}
+
+func (r *returnRepository) GetByOrder(ctx context.Context, orderID primitive.ObjectID) ([]models.ReturnRequest, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}})
+
+	cursor, err := r.collection.Find(ctx, bson.M{"orderId": orderID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get return requests: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var returns []models.ReturnRequest
+	if err := cursor.All(ctx, &returns); err != nil {
+		return nil, fmt.Errorf("failed to decode return requests: %w", err)
+	}
+
+	return returns, nil
+}
+
+func (r *returnRepository) GetByCustomer(ctx context.Context, userID primitive.ObjectID, guestSessionID string, page, limit int) ([]models.ReturnRequest, int64, error) {
+	filter := bson.M{"guestSessionId": guestSessionID}
+	if !userID.IsZero() {
+		filter = bson.M{"userId": userID}
+	}
+
+	return r.find(ctx, filter, page, limit)
+}
+
+func (r *returnRepository) List(ctx context.Context, filter models.ReturnFilter) ([]models.ReturnRequest, int64, error) {
+	query := bson.M{}
+	if filter.Status != nil {
+		query["status"] = *filter.Status
+	}
+	if filter.OrderID != nil {
+		query["orderId"] = *filter.OrderID
+	}
+
+	return r.find(ctx, query, filter.Page, filter.Limit)
+}
+
+// find returns one page of return requests matching filter, newest first
+func (r *returnRepository) find(ctx context.Context, filter bson.M, page, limit int) ([]models.ReturnRequest, int64, error) {
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count return requests: %w", err)
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 20
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}}).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit))
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get return requests: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var returns []models.ReturnRequest
+	if err := cursor.All(ctx, &returns); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode return requests: %w", err)
+	}
+
+	return returns, total, nil
+}
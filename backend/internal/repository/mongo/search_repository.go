@@ -20,6 +20,7 @@ type searchRepository struct {
 	configCollection        *mongo.Collection
 	personalizationCollection *mongo.Collection
 	cacheCollection         *mongo.Collection
+	productCollection       *mongo.Collection
 }
 
 // NewSearchRepository creates a new search repository
@@ -31,6 +32,7 @@ func NewSearchRepository(db *mongo.Database) repository.SearchRepository {
 		configCollection:        db.Collection("search_config"),
 		personalizationCollection: db.Collection("search_personalization"),
 		cacheCollection:         db.Collection("search_cache"),
+		productCollection:       db.Collection("products"),
 	}
 }
 
@@ -333,6 +335,38 @@ func (r *searchRepository) GetTagFacets(ctx context.Context, baseMatch interface
 	return []models.FacetItem{}, nil
 }
 
+func (r *searchRepository) GetLocationFacets(ctx context.Context, baseMatch interface{}) ([]models.FacetItem, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: baseMatch}},
+		{{Key: "$unwind", Value: "$locationStock"}},
+		{{Key: "$match", Value: bson.M{"locationStock.quantity": bson.M{"$gt": 0}}}},
+		// A product counts once per location, however many of its variants are there
+		{{Key: "$group", Value: bson.M{"_id": bson.M{"location": "$locationStock.locationId", "product": "$_id"}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$_id.location", "count": bson.M{"$sum": 1}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}}}},
+	}
+
+	cursor, err := r.productCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get location facets: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		ID    primitive.ObjectID `bson:"_id"`
+		Count int64              `bson:"count"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, fmt.Errorf("failed to decode location facets: %w", err)
+	}
+
+	facets := make([]models.FacetItem, 0, len(results))
+	for _, result := range results {
+		facets = append(facets, models.FacetItem{Value: result.ID.Hex(), Count: result.Count})
+	}
+	return facets, nil
+}
+
 func (r *searchRepository) CacheResults(ctx context.Context, cache *models.SearchCache) error {
 	cache.ID = primitive.NewObjectID()
 	cache.CreatedAt = time.Now()
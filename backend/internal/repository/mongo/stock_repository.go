@@ -0,0 +1,611 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type stockRepository struct {
+	productCollection  *mongo.Collection
+	movementCollection *mongo.Collection
+}
+
+// NewStockRepository creates a new stock repository
+func NewStockRepository(db *mongo.Database) repository.StockRepository {
+	movementCollection := db.Collection("stock_movements")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := movementCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "productId", Value: 1}, {Key: "createdAt", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "type", Value: 1}, {Key: "createdAt", Value: -1}},
+		},
+		{
+			Keys:    bson.D{{Key: "orderId", Value: 1}},
+			Options: options.Index().SetSparse(true),
+		},
+		{
+			Keys:    bson.D{{Key: "locationId", Value: 1}, {Key: "createdAt", Value: -1}},
+			Options: options.Index().SetSparse(true),
+		},
+	})
+	if err != nil {
+		fmt.Printf("Warning: failed to create stock movement indexes: %v\n", err)
+	}
+
+	return &stockRepository{
+		productCollection:  db.Collection("products"),
+		movementCollection: movementCollection,
+	}
+}
+
+// stockBalance is the projection used to read back a product's stock after an update
+type stockBalance struct {
+	StockQuantity int `bson:"stockQuantity"`
+}
+
+func (r *stockRepository) Reserve(ctx context.Context, productID primitive.ObjectID, quantity int) (int, error) {
+	filter := bson.M{
+		"_id":           productID,
+		"stockType":     bson.M{"$ne": models.StockTypeMadeToOrder},
+		"stockQuantity": bson.M{"$gte": quantity},
+	}
+	update := bson.M{
+		"$inc": bson.M{"stockQuantity": -quantity},
+		"$set": bson.M{"updatedAt": time.Now()},
+	}
+	opts := options.FindOneAndUpdate().
+		SetReturnDocument(options.After).
+		SetProjection(bson.M{"stockQuantity": 1})
+
+	var balance stockBalance
+	err := r.productCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&balance)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return 0, fmt.Errorf("insufficient stock")
+		}
+		return 0, fmt.Errorf("failed to reserve stock: %w", err)
+	}
+
+	return balance.StockQuantity, nil
+}
+
+func (r *stockRepository) Release(ctx context.Context, productID primitive.ObjectID, quantity int) (int, error) {
+	update := bson.M{
+		"$inc": bson.M{"stockQuantity": quantity},
+		"$set": bson.M{"updatedAt": time.Now()},
+	}
+	opts := options.FindOneAndUpdate().
+		SetReturnDocument(options.After).
+		SetProjection(bson.M{"stockQuantity": 1})
+
+	var balance stockBalance
+	err := r.productCollection.FindOneAndUpdate(ctx, bson.M{"_id": productID}, update, opts).Decode(&balance)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return 0, fmt.Errorf("product not found")
+		}
+		return 0, fmt.Errorf("failed to release stock: %w", err)
+	}
+
+	return balance.StockQuantity, nil
+}
+
+// variantBalance is the projection used to read back a variant's stock after an update
+type variantBalance struct {
+	Variants []struct {
+		StockQuantity int `bson:"stockQuantity"`
+	} `bson:"variants"`
+}
+
+func (r *stockRepository) ReserveVariant(ctx context.Context, productID, variantID primitive.ObjectID, quantity int) (int, error) {
+	filter := bson.M{
+		"_id":       productID,
+		"stockType": bson.M{"$ne": models.StockTypeMadeToOrder},
+		"variants": bson.M{"$elemMatch": bson.M{
+			"id":            variantID,
+			"stockQuantity": bson.M{"$gte": quantity},
+		}},
+	}
+	update := bson.M{
+		"$inc": bson.M{"variants.$.stockQuantity": -quantity, "stockQuantity": -quantity},
+		"$set": bson.M{"updatedAt": time.Now()},
+	}
+
+	balance, err := r.updateVariantStock(ctx, filter, update, variantID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return 0, fmt.Errorf("insufficient stock")
+		}
+		return 0, fmt.Errorf("failed to reserve stock: %w", err)
+	}
+	return balance, nil
+}
+
+func (r *stockRepository) ReleaseVariant(ctx context.Context, productID, variantID primitive.ObjectID, quantity int) (int, error) {
+	filter := bson.M{"_id": productID, "variants.id": variantID}
+	update := bson.M{
+		"$inc": bson.M{"variants.$.stockQuantity": quantity, "stockQuantity": quantity},
+		"$set": bson.M{"updatedAt": time.Now()},
+	}
+
+	balance, err := r.updateVariantStock(ctx, filter, update, variantID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return 0, fmt.Errorf("variant not found")
+		}
+		return 0, fmt.Errorf("failed to release stock: %w", err)
+	}
+	return balance, nil
+}
+
+// updateVariantStock applies a positional stock update and returns the variant's new balance
+func (r *stockRepository) updateVariantStock(ctx context.Context, filter, update bson.M, variantID primitive.ObjectID) (int, error) {
+	opts := options.FindOneAndUpdate().
+		SetReturnDocument(options.After).
+		SetProjection(bson.M{"variants": bson.M{"$elemMatch": bson.M{"id": variantID}}})
+
+	var balance variantBalance
+	if err := r.productCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&balance); err != nil {
+		return 0, err
+	}
+	if len(balance.Variants) == 0 {
+		return 0, nil
+	}
+	return balance.Variants[0].StockQuantity, nil
+}
+
+func (r *stockRepository) SetStock(ctx context.Context, productID primitive.ObjectID, quantity int) (int, error) {
+	filter := bson.M{"_id": productID, "variants.0": bson.M{"$exists": false}}
+	update := bson.M{"$set": bson.M{"stockQuantity": quantity, "updatedAt": time.Now()}}
+	opts := options.FindOneAndUpdate().
+		SetReturnDocument(options.Before).
+		SetProjection(bson.M{"stockQuantity": 1})
+
+	var balance stockBalance
+	if err := r.productCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&balance); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return 0, fmt.Errorf("product not found")
+		}
+		return 0, fmt.Errorf("failed to set stock: %w", err)
+	}
+
+	return balance.StockQuantity, nil
+}
+
+func (r *stockRepository) SetVariantStock(ctx context.Context, productID, variantID primitive.ObjectID, quantity int) (int, error) {
+	now := time.Now()
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"variants": bson.M{"$map": bson.M{
+				"input": "$variants",
+				"in": bson.M{"$cond": bson.A{
+					bson.M{"$eq": bson.A{"$$this.id", variantID}},
+					bson.M{"$mergeObjects": bson.A{"$$this", bson.M{"stockQuantity": quantity, "updatedAt": now}}},
+					"$$this",
+				}},
+			}},
+			"updatedAt": now,
+		}}},
+		sumVariantStock,
+	}
+	opts := options.FindOneAndUpdate().
+		SetReturnDocument(options.Before).
+		SetProjection(bson.M{"variants": bson.M{"$elemMatch": bson.M{"id": variantID}}})
+
+	var balance variantBalance
+	err := r.productCollection.FindOneAndUpdate(ctx, bson.M{"_id": productID, "variants.id": variantID}, pipeline, opts).Decode(&balance)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return 0, repository.ErrVariantNotFound
+		}
+		return 0, fmt.Errorf("failed to set variant stock: %w", err)
+	}
+	if len(balance.Variants) == 0 {
+		return 0, nil
+	}
+	return balance.Variants[0].StockQuantity, nil
+}
+
+// locationEntry matches the stock held at a location, of the variant when given
+func locationEntry(locationID primitive.ObjectID, variantID *primitive.ObjectID) bson.M {
+	entry := bson.M{"locationId": locationID, "variantId": bson.M{"$exists": false}}
+	if variantID != nil {
+		entry["variantId"] = *variantID
+	}
+	return entry
+}
+
+// isLocationEntry is the aggregation expression for locationEntry, on $$this
+func isLocationEntry(locationID primitive.ObjectID, variantID *primitive.ObjectID) bson.M {
+	variant := bson.M{"$eq": bson.A{bson.M{"$ifNull": bson.A{"$$this.variantId", nil}}, nil}}
+	if variantID != nil {
+		variant = bson.M{"$eq": bson.A{"$$this.variantId", *variantID}}
+	}
+	return bson.M{"$and": bson.A{bson.M{"$eq": bson.A{"$$this.locationId", locationID}}, variant}}
+}
+
+// sumLocationStock is the pipeline that keeps the stock of a product, and of
+// each of its variants, equal to the total held at its locations
+var sumLocationStock = mongo.Pipeline{
+	{{Key: "$set", Value: bson.M{
+		"variants": bson.M{"$cond": bson.A{
+			bson.M{"$isArray": "$variants"},
+			bson.M{"$map": bson.M{
+				"input": "$variants",
+				"as":    "variant",
+				"in": bson.M{"$mergeObjects": bson.A{"$$variant", bson.M{
+					"stockQuantity": bson.M{"$sum": bson.M{"$map": bson.M{
+						"input": bson.M{"$filter": bson.M{
+							"input": "$locationStock",
+							"cond":  bson.M{"$eq": bson.A{"$$this.variantId", "$$variant.id"}},
+						}},
+						"in": "$$this.quantity",
+					}}},
+				}}},
+			}},
+			"$$REMOVE",
+		}},
+	}}},
+	{{Key: "$set", Value: bson.M{
+		"stockQuantity": bson.M{"$sum": "$locationStock.quantity"},
+	}}},
+}
+
+// locationBalance is the projection used to read back the stock held at a location
+type locationBalance struct {
+	LocationStock []models.LocationStock `bson:"locationStock"`
+}
+
+func (b *locationBalance) quantity() int {
+	if len(b.LocationStock) == 0 {
+		return 0
+	}
+	return b.LocationStock[0].Quantity
+}
+
+func (r *stockRepository) ReserveAt(ctx context.Context, productID primitive.ObjectID, variantID *primitive.ObjectID, locationID primitive.ObjectID, quantity int) (int, error) {
+	held := locationEntry(locationID, variantID)
+	held["quantity"] = bson.M{"$gte": quantity}
+	filter := bson.M{
+		"_id":           productID,
+		"stockType":     bson.M{"$ne": models.StockTypeMadeToOrder},
+		"locationStock": bson.M{"$elemMatch": held},
+	}
+
+	balance, err := r.incLocationStock(ctx, filter, variantID, locationID, -quantity)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return 0, fmt.Errorf("insufficient stock")
+		}
+		return 0, fmt.Errorf("failed to reserve stock: %w", err)
+	}
+	return balance, nil
+}
+
+func (r *stockRepository) ReleaseAt(ctx context.Context, productID primitive.ObjectID, variantID *primitive.ObjectID, locationID primitive.ObjectID, quantity int) (int, error) {
+	filter := bson.M{"_id": productID, "locationStock": bson.M{"$elemMatch": locationEntry(locationID, variantID)}}
+	balance, err := r.incLocationStock(ctx, filter, variantID, locationID, quantity)
+	if err == nil {
+		return balance, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return 0, fmt.Errorf("failed to release stock: %w", err)
+	}
+
+	// Nothing is held at the location yet
+	entry := models.LocationStock{LocationID: locationID, VariantID: variantID, Quantity: quantity}
+	filter = bson.M{"_id": productID, "locationStock": bson.M{"$not": bson.M{"$elemMatch": locationEntry(locationID, variantID)}}}
+	inc := bson.M{"stockQuantity": quantity}
+	opts := options.Update()
+	if variantID != nil {
+		filter["variants.id"] = *variantID
+		inc["variants.$[v].stockQuantity"] = quantity
+		opts.SetArrayFilters(options.ArrayFilters{Filters: bson.A{bson.M{"v.id": *variantID}}})
+	}
+	update := bson.M{
+		"$push": bson.M{"locationStock": entry},
+		"$inc":  inc,
+		"$set":  bson.M{"updatedAt": time.Now()},
+	}
+
+	result, err := r.productCollection.UpdateOne(ctx, filter, update, opts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to release stock: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		// Another release placed stock at the location first
+		filter = bson.M{"_id": productID, "locationStock": bson.M{"$elemMatch": locationEntry(locationID, variantID)}}
+		balance, err := r.incLocationStock(ctx, filter, variantID, locationID, quantity)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return 0, fmt.Errorf("product not found")
+			}
+			return 0, fmt.Errorf("failed to release stock: %w", err)
+		}
+		return balance, nil
+	}
+	return quantity, nil
+}
+
+// incLocationStock changes the stock held at a location, and the product's
+// and variant's totals with it, and returns the balance at the location
+func (r *stockRepository) incLocationStock(ctx context.Context, filter bson.M, variantID *primitive.ObjectID, locationID primitive.ObjectID, change int) (int, error) {
+	held := bson.M{}
+	for key, value := range locationEntry(locationID, variantID) {
+		held["l."+key] = value
+	}
+	arrayFilters := bson.A{held}
+	inc := bson.M{"locationStock.$[l].quantity": change, "stockQuantity": change}
+	if variantID != nil {
+		inc["variants.$[v].stockQuantity"] = change
+		arrayFilters = append(arrayFilters, bson.M{"v.id": *variantID})
+	}
+
+	update := bson.M{
+		"$inc": inc,
+		"$set": bson.M{"updatedAt": time.Now()},
+	}
+	opts := options.FindOneAndUpdate().
+		SetArrayFilters(options.ArrayFilters{Filters: arrayFilters}).
+		SetReturnDocument(options.After).
+		SetProjection(bson.M{"locationStock": bson.M{"$elemMatch": locationEntry(locationID, variantID)}})
+
+	var balance locationBalance
+	if err := r.productCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&balance); err != nil {
+		return 0, err
+	}
+	return balance.quantity(), nil
+}
+
+func (r *stockRepository) SetStockAt(ctx context.Context, productID primitive.ObjectID, variantID *primitive.ObjectID, locationID primitive.ObjectID, quantity int) (int, error) {
+	isEntry := isLocationEntry(locationID, variantID)
+	entry := bson.M{"locationId": locationID, "quantity": quantity}
+	filter := bson.M{"_id": productID}
+	if variantID != nil {
+		entry["variantId"] = *variantID
+		filter["variants.id"] = *variantID
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"locationStock": bson.M{"$cond": bson.A{
+				bson.M{"$anyElementTrue": bson.A{bson.M{"$map": bson.M{
+					"input": bson.M{"$ifNull": bson.A{"$locationStock", bson.A{}}},
+					"in":    isEntry,
+				}}}},
+				bson.M{"$map": bson.M{
+					"input": "$locationStock",
+					"in": bson.M{"$cond": bson.A{
+						isEntry,
+						bson.M{"$mergeObjects": bson.A{"$$this", bson.M{"quantity": quantity}}},
+						"$$this",
+					}},
+				}},
+				bson.M{"$concatArrays": bson.A{bson.M{"$ifNull": bson.A{"$locationStock", bson.A{}}}, bson.A{entry}}},
+			}},
+			"updatedAt": time.Now(),
+		}}},
+	}
+	pipeline = append(pipeline, sumLocationStock...)
+
+	opts := options.FindOneAndUpdate().
+		SetReturnDocument(options.Before).
+		SetProjection(bson.M{"locationStock": bson.M{"$elemMatch": locationEntry(locationID, variantID)}})
+
+	var balance locationBalance
+	if err := r.productCollection.FindOneAndUpdate(ctx, filter, pipeline, opts).Decode(&balance); err != nil {
+		if err == mongo.ErrNoDocuments {
+			if variantID != nil {
+				return 0, repository.ErrVariantNotFound
+			}
+			return 0, fmt.Errorf("product not found")
+		}
+		return 0, fmt.Errorf("failed to set location stock: %w", err)
+	}
+	return balance.quantity(), nil
+}
+
+func (r *stockRepository) AssignUnlocatedStock(ctx context.Context, productID *primitive.ObjectID, locationID primitive.ObjectID) (int64, error) {
+	filter := bson.M{"stockType": bson.M{"$ne": models.StockTypeMadeToOrder}}
+	if productID != nil {
+		filter["_id"] = *productID
+	}
+
+	held := bson.M{"$ifNull": bson.A{"$locationStock", bson.A{}}}
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"locationStock": bson.M{"$cond": bson.A{
+				bson.M{"$gt": bson.A{bson.M{"$size": bson.M{"$ifNull": bson.A{"$variants", bson.A{}}}}, 0}},
+				// Sold by variant: variants held nowhere are placed at the location
+				bson.M{"$concatArrays": bson.A{
+					bson.M{"$filter": bson.M{
+						"input": held,
+						"cond":  bson.M{"$ne": bson.A{bson.M{"$ifNull": bson.A{"$$this.variantId", nil}}, nil}},
+					}},
+					bson.M{"$map": bson.M{
+						"input": bson.M{"$filter": bson.M{
+							"input": "$variants",
+							"as":    "variant",
+							"cond": bson.M{"$not": bson.A{bson.M{"$in": bson.A{
+								"$$variant.id",
+								bson.M{"$ifNull": bson.A{"$locationStock.variantId", bson.A{}}},
+							}}}},
+						}},
+						"as": "variant",
+						"in": bson.M{"locationId": locationID, "variantId": "$$variant.id", "quantity": "$$variant.stockQuantity"},
+					}},
+				}},
+				bson.M{"$cond": bson.A{
+					bson.M{"$gt": bson.A{bson.M{"$size": held}, 0}},
+					"$locationStock",
+					bson.A{bson.M{"locationId": locationID, "quantity": "$stockQuantity"}},
+				}},
+			}},
+		}}},
+	}
+	pipeline = append(pipeline, sumLocationStock...)
+
+	result, err := r.productCollection.UpdateMany(ctx, filter, pipeline)
+	if err != nil {
+		return 0, fmt.Errorf("failed to assign stock to location: %w", err)
+	}
+	return result.ModifiedCount, nil
+}
+
+func (r *stockRepository) RecordMovement(ctx context.Context, movement *models.StockMovement) error {
+	movement.ID = primitive.NewObjectID()
+	movement.CreatedAt = time.Now()
+
+	_, err := r.movementCollection.InsertOne(ctx, movement)
+	if err != nil {
+		return fmt.Errorf("failed to record stock movement: %w", err)
+	}
+
+	return nil
+}
+
+func (r *stockRepository) GetMovements(ctx context.Context, filter models.StockLedgerFilter) ([]models.StockMovement, int64, error) {
+	query := bson.M{}
+	if filter.ProductID != nil {
+		query["productId"] = *filter.ProductID
+	}
+	if filter.LocationID != nil {
+		query["locationId"] = *filter.LocationID
+	}
+	if filter.Type != "" {
+		query["type"] = filter.Type
+	}
+	if filter.From != nil || filter.To != nil {
+		createdAt := bson.M{}
+		if filter.From != nil {
+			createdAt["$gte"] = *filter.From
+		}
+		if filter.To != nil {
+			createdAt["$lt"] = *filter.To
+		}
+		query["createdAt"] = createdAt
+	}
+
+	total, err := r.movementCollection.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count stock movements: %w", err)
+	}
+
+	cursor, err := r.movementCollection.Find(ctx, query, pageOptions(filter.Page, filter.Limit, bson.D{{Key: "createdAt", Value: -1}}))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get stock movements: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var movements []models.StockMovement
+	if err := cursor.All(ctx, &movements); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode stock movements: %w", err)
+	}
+
+	return movements, total, nil
+}
+
+func (r *stockRepository) GetMovementsByProduct(ctx context.Context, productID primitive.ObjectID, page, limit int) ([]models.StockMovement, int64, error) {
+	filter := bson.M{"productId": productID}
+
+	total, err := r.movementCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count stock movements: %w", err)
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}}).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit))
+
+	cursor, err := r.movementCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get stock movements: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var movements []models.StockMovement
+	if err := cursor.All(ctx, &movements); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode stock movements: %w", err)
+	}
+
+	return movements, total, nil
+}
+
+func (r *stockRepository) GetMovementsByOrder(ctx context.Context, orderID primitive.ObjectID) ([]models.StockMovement, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}})
+
+	cursor, err := r.movementCollection.Find(ctx, bson.M{"orderId": orderID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stock movements: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var movements []models.StockMovement
+	if err := cursor.All(ctx, &movements); err != nil {
+		return nil, fmt.Errorf("failed to decode stock movements: %w", err)
+	}
+
+	return movements, nil
+}
+
+// reorderLevel is the expression for a product's reorder level, defaulting when unset
+var reorderLevel = bson.M{"$ifNull": bson.A{"$reorderLevel", models.DefaultReorderLevel}}
+
+func (r *stockRepository) GetLowStock(ctx context.Context) ([]models.Product, error) {
+	filter := bson.M{
+		"stockType":   bson.M{"$ne": models.StockTypeMadeToOrder},
+		"isAvailable": true,
+		"$expr":       bson.M{"$lte": bson.A{"$stockQuantity", reorderLevel}},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "stockQuantity", Value: 1}, {Key: "name", Value: 1}})
+
+	cursor, err := r.productCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get low stock products: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var products []models.Product
+	if err := cursor.All(ctx, &products); err != nil {
+		return nil, fmt.Errorf("failed to decode low stock products: %w", err)
+	}
+
+	return products, nil
+}
+
+func (r *stockRepository) MarkLowStockAlerted(ctx context.Context, productID primitive.ObjectID, at time.Time) error {
+	_, err := r.productCollection.UpdateOne(ctx, bson.M{"_id": productID}, bson.M{
+		"$set": bson.M{"lowStockAlertedAt": at},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to mark low stock alert: %w", err)
+	}
+	return nil
+}
+
+func (r *stockRepository) ClearLowStockAlerts(ctx context.Context) (int64, error) {
+	filter := bson.M{
+		"lowStockAlertedAt": bson.M{"$exists": true},
+		"$expr":             bson.M{"$gt": bson.A{"$stockQuantity", reorderLevel}},
+	}
+
+	result, err := r.productCollection.UpdateMany(ctx, filter, bson.M{"$unset": bson.M{"lowStockAlertedAt": ""}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to clear low stock alerts: %w", err)
+	}
+	return result.ModifiedCount, nil
+}
@@ -0,0 +1,159 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type variantRepository struct {
+	collection *mongo.Collection
+}
+
+// NewVariantRepository creates a new variant repository. SKUs are unique
+// across products; barcodes are indexed for scanning at the counter.
+func NewVariantRepository(db *mongo.Database) repository.VariantRepository {
+	collection := db.Collection("products")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "variants.sku", Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"variants.sku": bson.M{"$exists": true}}),
+		},
+		{
+			Keys:    bson.D{{Key: "variants.barcode", Value: 1}},
+			Options: options.Index().SetSparse(true),
+		},
+	})
+	if err != nil {
+		fmt.Printf("Warning: failed to create variant indexes: %v\n", err)
+	}
+
+	return &variantRepository{collection: collection}
+}
+
+// sumVariantStock is the pipeline stage that keeps a product's stock equal to its variants'
+var sumVariantStock = bson.D{{Key: "$set", Value: bson.M{
+	"stockQuantity": bson.M{"$sum": "$variants.stockQuantity"},
+}}}
+
+func (r *variantRepository) AddVariants(ctx context.Context, productID primitive.ObjectID, variants []models.ProductVariant) error {
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"variants": bson.M{"$concatArrays": bson.A{
+				bson.M{"$ifNull": bson.A{"$variants", bson.A{}}},
+				bson.M{"$literal": variants},
+			}},
+			"updatedAt": time.Now(),
+		}}},
+		sumVariantStock,
+	}
+
+	return r.update(ctx, bson.M{"_id": productID}, pipeline)
+}
+
+func (r *variantRepository) UpdateVariant(ctx context.Context, productID primitive.ObjectID, variant *models.ProductVariant) error {
+	variant.UpdatedAt = time.Now()
+	return r.mergeVariant(ctx, productID, variant.ID, bson.M{
+		"sku":       variant.SKU,
+		"barcode":   variant.Barcode,
+		"price":     variant.Price,
+		"weight":    variant.Weight,
+		"isActive":  variant.IsActive,
+		"updatedAt": variant.UpdatedAt,
+	})
+}
+
+func (r *variantRepository) SetVariantStock(ctx context.Context, productID, variantID primitive.ObjectID, quantity int) error {
+	return r.mergeVariant(ctx, productID, variantID, bson.M{
+		"stockQuantity": quantity,
+		"updatedAt":     time.Now(),
+	})
+}
+
+func (r *variantRepository) DeleteVariant(ctx context.Context, productID, variantID primitive.ObjectID) error {
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"variants": bson.M{"$filter": bson.M{
+				"input": "$variants",
+				"cond":  bson.M{"$ne": bson.A{"$$this.id", variantID}},
+			}},
+			"locationStock": bson.M{"$cond": bson.A{
+				bson.M{"$isArray": "$locationStock"},
+				bson.M{"$filter": bson.M{
+					"input": "$locationStock",
+					"cond":  bson.M{"$ne": bson.A{"$$this.variantId", variantID}},
+				}},
+				"$$REMOVE",
+			}},
+			"updatedAt": time.Now(),
+		}}},
+		sumVariantStock,
+	}
+
+	return r.update(ctx, bson.M{"_id": productID, "variants.id": variantID}, pipeline)
+}
+
+func (r *variantRepository) GetByCode(ctx context.Context, code string) (*models.Product, error) {
+	code = strings.TrimSpace(code)
+	filter := bson.M{"$or": bson.A{
+		bson.M{"variants.sku": strings.ToUpper(code)},
+		bson.M{"variants.barcode": code},
+	}}
+
+	var product models.Product
+	if err := r.collection.FindOne(ctx, filter).Decode(&product); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, repository.ErrVariantNotFound
+		}
+		return nil, fmt.Errorf("failed to get variant by code: %w", err)
+	}
+	return &product, nil
+}
+
+// mergeVariant overwrites fields of one variant, leaving the others as stored
+// so concurrent stock reservations are not lost
+func (r *variantRepository) mergeVariant(ctx context.Context, productID, variantID primitive.ObjectID, fields bson.M) error {
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"variants": bson.M{"$map": bson.M{
+				"input": "$variants",
+				"in": bson.M{"$cond": bson.A{
+					bson.M{"$eq": bson.A{"$$this.id", variantID}},
+					bson.M{"$mergeObjects": bson.A{"$$this", bson.M{"$literal": fields}}},
+					"$$this",
+				}},
+			}},
+			"updatedAt": time.Now(),
+		}}},
+		sumVariantStock,
+	}
+
+	return r.update(ctx, bson.M{"_id": productID, "variants.id": variantID}, pipeline)
+}
+
+func (r *variantRepository) update(ctx context.Context, filter bson.M, pipeline mongo.Pipeline) error {
+	result, err := r.collection.UpdateOne(ctx, filter, pipeline)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return repository.ErrDuplicateSKU
+		}
+		return fmt.Errorf("failed to update variants: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return repository.ErrVariantNotFound
+	}
+	return nil
+}
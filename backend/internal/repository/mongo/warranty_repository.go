@@ -0,0 +1,252 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type warrantyRepository struct {
+	warranties *mongo.Collection
+	claims     *mongo.Collection
+}
+
+// NewWarrantyRepository creates a new warranty repository. Warranties share the
+// collection the PDF repository reads warranty cards from. The unique index on
+// the order line stops a delivery that is recorded twice issuing two warranties.
+func NewWarrantyRepository(db *mongo.Database) repository.WarrantyRepository {
+	warranties := db.Collection("warranties")
+	claims := db.Collection("warranty_claims")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := warranties.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "warrantyNumber", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "orderId", Value: 1}, {Key: "lineIndex", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: -1}},
+		},
+	})
+	if err != nil {
+		fmt.Printf("Warning: failed to create warranty indexes: %v\n", err)
+	}
+	_, err = claims.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "claimNumber", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "warrantyId", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "submittedAt", Value: 1}},
+		},
+	})
+	if err != nil {
+		fmt.Printf("Warning: failed to create warranty claim indexes: %v\n", err)
+	}
+
+	return &warrantyRepository{warranties: warranties, claims: claims}
+}
+
+func (r *warrantyRepository) Create(ctx context.Context, warranty *models.WarrantyInfo) error {
+	if warranty.ID.IsZero() {
+		warranty.ID = primitive.NewObjectID()
+	}
+	warranty.CreatedAt = time.Now()
+	warranty.UpdatedAt = warranty.CreatedAt
+
+	_, err := r.warranties.InsertOne(ctx, warranty)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("warranty %s already exists", warranty.WarrantyNumber)
+		}
+		return fmt.Errorf("failed to create warranty: %w", err)
+	}
+
+	return nil
+}
+
+func (r *warrantyRepository) Update(ctx context.Context, warranty *models.WarrantyInfo) error {
+	warranty.UpdatedAt = time.Now()
+
+	_, err := r.warranties.ReplaceOne(ctx, bson.M{"_id": warranty.ID}, warranty)
+	if err != nil {
+		return fmt.Errorf("failed to update warranty: %w", err)
+	}
+
+	return nil
+}
+
+func (r *warrantyRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.WarrantyInfo, error) {
+	var warranty models.WarrantyInfo
+	err := r.warranties.FindOne(ctx, bson.M{"_id": id}).Decode(&warranty)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("warranty not found")
+		}
+		return nil, fmt.Errorf("failed to get warranty: %w", err)
+	}
+
+	return &warranty, nil
+}
+
+func (r *warrantyRepository) GetByOrder(ctx context.Context, orderID primitive.ObjectID) ([]models.WarrantyInfo, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "lineIndex", Value: 1}})
+
+	cursor, err := r.warranties.Find(ctx, bson.M{"orderId": orderID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get warranties: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var warranties []models.WarrantyInfo
+	if err := cursor.All(ctx, &warranties); err != nil {
+		return nil, fmt.Errorf("failed to decode warranties: %w", err)
+	}
+
+	return warranties, nil
+}
+
+func (r *warrantyRepository) GetByCustomer(ctx context.Context, userID primitive.ObjectID, guestSessionID string, page, limit int) ([]models.WarrantyInfo, int64, error) {
+	filter := bson.M{"guestSessionId": guestSessionID}
+	if !userID.IsZero() {
+		filter = bson.M{"userId": userID}
+	}
+
+	total, err := r.warranties.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count warranties: %w", err)
+	}
+
+	cursor, err := r.warranties.Find(ctx, filter, pageOptions(page, limit, bson.D{{Key: "createdAt", Value: -1}}))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get warranties: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var warranties []models.WarrantyInfo
+	if err := cursor.All(ctx, &warranties); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode warranties: %w", err)
+	}
+
+	return warranties, total, nil
+}
+
+func (r *warrantyRepository) CreateClaim(ctx context.Context, claim *models.WarrantyClaim) error {
+	if claim.ID.IsZero() {
+		claim.ID = primitive.NewObjectID()
+	}
+	claim.SubmittedAt = time.Now()
+	claim.UpdatedAt = claim.SubmittedAt
+
+	_, err := r.claims.InsertOne(ctx, claim)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("warranty claim %s already exists", claim.ClaimNumber)
+		}
+		return fmt.Errorf("failed to create warranty claim: %w", err)
+	}
+
+	return nil
+}
+
+func (r *warrantyRepository) UpdateClaim(ctx context.Context, claim *models.WarrantyClaim) error {
+	claim.UpdatedAt = time.Now()
+
+	_, err := r.claims.ReplaceOne(ctx, bson.M{"_id": claim.ID}, claim)
+	if err != nil {
+		return fmt.Errorf("failed to update warranty claim: %w", err)
+	}
+
+	return nil
+}
+
+func (r *warrantyRepository) GetClaimByID(ctx context.Context, id primitive.ObjectID) (*models.WarrantyClaim, error) {
+	var claim models.WarrantyClaim
+	err := r.claims.FindOne(ctx, bson.M{"_id": id}).Decode(&claim)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("warranty claim not found")
+		}
+		return nil, fmt.Errorf("failed to get warranty claim: %w", err)
+	}
+
+	return &claim, nil
+}
+
+func (r *warrantyRepository) GetClaimsByWarranty(ctx context.Context, warrantyID primitive.ObjectID) ([]models.WarrantyClaim, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "submittedAt", Value: 1}})
+
+	cursor, err := r.claims.Find(ctx, bson.M{"warrantyId": warrantyID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get warranty claims: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var claims []models.WarrantyClaim
+	if err := cursor.All(ctx, &claims); err != nil {
+		return nil, fmt.Errorf("failed to decode warranty claims: %w", err)
+	}
+
+	return claims, nil
+}
+
+// ListClaims returns one page of the claims queue, oldest first so claims are
+// handled in the order they were made
+func (r *warrantyRepository) ListClaims(ctx context.Context, filter models.WarrantyClaimFilter) ([]models.WarrantyClaim, int64, error) {
+	query := bson.M{}
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+	if filter.WarrantyID != nil {
+		query["warrantyId"] = *filter.WarrantyID
+	}
+
+	total, err := r.claims.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count warranty claims: %w", err)
+	}
+
+	cursor, err := r.claims.Find(ctx, query, pageOptions(filter.Page, filter.Limit, bson.D{{Key: "submittedAt", Value: 1}}))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get warranty claims: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var claims []models.WarrantyClaim
+	if err := cursor.All(ctx, &claims); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode warranty claims: %w", err)
+	}
+
+	return claims, total, nil
+}
+
+// pageOptions returns find options for one page sorted by sort
+func pageOptions(page, limit int, sort bson.D) *options.FindOptions {
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 20
+	}
+
+	return options.Find().
+		SetSort(sort).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit))
+}
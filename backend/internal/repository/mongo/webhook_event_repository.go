@@ -0,0 +1,188 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type webhookEventRepository struct {
+	collection *mongo.Collection
+}
+
+// NewWebhookEventRepository creates a new webhook event repository. The unique
+// index on gateway and event ID is what keeps concurrent deliveries from both
+// being processed, so it is created here rather than left to a migration.
+func NewWebhookEventRepository(db *mongo.Database) repository.WebhookEventRepository {
+	collection := db.Collection("payment_webhook_events")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			// Rejected deliveries are kept for inspection but must not block the genuine event
+			Keys: bson.D{{Key: "gateway", Value: 1}, {Key: "eventId", Value: 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"signatureValid": true}),
+		},
+		{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "receivedAt", Value: -1}},
+		},
+	})
+	if err != nil {
+		fmt.Printf("Warning: failed to create webhook event indexes: %v\n", err)
+	}
+
+	return &webhookEventRepository{collection: collection}
+}
+
+func (r *webhookEventRepository) Create(ctx context.Context, event *models.WebhookEvent) error {
+	if event.ID.IsZero() {
+		event.ID = primitive.NewObjectID()
+	}
+	event.ReceivedAt = time.Now()
+	event.UpdatedAt = event.ReceivedAt
+
+	_, err := r.collection.InsertOne(ctx, event)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return repository.ErrDuplicateWebhookEvent
+		}
+		return fmt.Errorf("failed to create webhook event: %w", err)
+	}
+
+	return nil
+}
+
+func (r *webhookEventRepository) Update(ctx context.Context, event *models.WebhookEvent) error {
+	event.UpdatedAt = time.Now()
+
+	// Delivery and attempt counters are maintained atomically by RecordDelivery and Claim
+	update := bson.M{
+		"$set": bson.M{
+			"eventId":        event.EventID,
+			"eventType":      event.EventType,
+			"signatureValid": event.SignatureValid,
+			"status":         event.Status,
+			"error":          event.Error,
+			"orderId":        event.OrderID,
+			"updatedAt":      event.UpdatedAt,
+			"processedAt":    event.ProcessedAt,
+		},
+	}
+
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": event.ID}, update)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return repository.ErrDuplicateWebhookEvent
+		}
+		return fmt.Errorf("failed to update webhook event: %w", err)
+	}
+
+	return nil
+}
+
+func (r *webhookEventRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.WebhookEvent, error) {
+	return r.findOne(ctx, bson.M{"_id": id})
+}
+
+func (r *webhookEventRepository) GetByEventID(ctx context.Context, gateway models.PaymentMethod, eventID string) (*models.WebhookEvent, error) {
+	return r.findOne(ctx, bson.M{"gateway": gateway, "eventId": eventID})
+}
+
+func (r *webhookEventRepository) Claim(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	filter := bson.M{
+		"_id":    id,
+		"status": bson.M{"$in": []models.WebhookEventStatus{models.WebhookEventReceived, models.WebhookEventFailed}},
+	}
+	update := bson.M{
+		"$set": bson.M{"status": models.WebhookEventProcessing, "updatedAt": time.Now()},
+		"$inc": bson.M{"attempts": 1},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim webhook event: %w", err)
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+func (r *webhookEventRepository) RecordDelivery(ctx context.Context, id primitive.ObjectID) error {
+	update := bson.M{
+		"$set": bson.M{"updatedAt": time.Now()},
+		"$inc": bson.M{"deliveries": 1},
+	}
+
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return fmt.Errorf("failed to record webhook delivery: %w", err)
+	}
+
+	return nil
+}
+
+func (r *webhookEventRepository) List(ctx context.Context, filter models.WebhookEventFilter) ([]models.WebhookEvent, int64, error) {
+	query := bson.M{}
+	if filter.Gateway != nil {
+		query["gateway"] = *filter.Gateway
+	}
+	if filter.Status != nil {
+		query["status"] = *filter.Status
+	}
+
+	total, err := r.collection.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count webhook events: %w", err)
+	}
+
+	page := filter.Page
+	if page < 1 {
+		page = 1
+	}
+	limit := filter.Limit
+	if limit < 1 {
+		limit = 20
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "receivedAt", Value: -1}}).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit)).
+		SetProjection(bson.M{"payload": 0, "headers": 0})
+
+	cursor, err := r.collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get webhook events: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var events []models.WebhookEvent
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode webhook events: %w", err)
+	}
+
+	return events, total, nil
+}
+
+func (r *webhookEventRepository) findOne(ctx context.Context, filter bson.M) (*models.WebhookEvent, error) {
+	var event models.WebhookEvent
+	err := r.collection.FindOne(ctx, filter).Decode(&event)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("webhook event not found")
+		}
+		return nil, fmt.Errorf("failed to get webhook event: %w", err)
+	}
+
+	return &event, nil
+}
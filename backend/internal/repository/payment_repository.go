@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"thyne-jewels-backend/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PaymentAttemptRepository stores the payment attempts made for orders
+type PaymentAttemptRepository interface {
+	Create(ctx context.Context, attempt *models.PaymentAttempt) error
+	Update(ctx context.Context, attempt *models.PaymentAttempt) error
+	GetByID(ctx context.Context, id primitive.ObjectID) (*models.PaymentAttempt, error)
+	GetByOrder(ctx context.Context, orderID primitive.ObjectID) ([]models.PaymentAttempt, error)
+	GetLatestByOrder(ctx context.Context, orderID primitive.ObjectID, gateway models.PaymentMethod) (*models.PaymentAttempt, error)
+	GetByProviderOrderID(ctx context.Context, gateway models.PaymentMethod, providerOrderID string) (*models.PaymentAttempt, error)
+}
+
+// ErrDuplicateWebhookEvent is returned when a webhook event with the same gateway and event ID is already stored
+var ErrDuplicateWebhookEvent = errors.New("webhook event already recorded")
+
+// WebhookEventRepository stores inbound payment webhooks
+type WebhookEventRepository interface {
+	Create(ctx context.Context, event *models.WebhookEvent) error
+	// Update saves the outcome of processing an event
+	Update(ctx context.Context, event *models.WebhookEvent) error
+	GetByID(ctx context.Context, id primitive.ObjectID) (*models.WebhookEvent, error)
+	// GetByEventID finds the signature-verified event with the given gateway event ID
+	GetByEventID(ctx context.Context, gateway models.PaymentMethod, eventID string) (*models.WebhookEvent, error)
+	// Claim moves a received or failed event to processing. It returns false when
+	// another delivery already holds or finished the event.
+	Claim(ctx context.Context, id primitive.ObjectID) (bool, error)
+	// RecordDelivery counts another delivery of an event already stored
+	RecordDelivery(ctx context.Context, id primitive.ObjectID) error
+	List(ctx context.Context, filter models.WebhookEventFilter) ([]models.WebhookEvent, int64, error)
+}
+
+// ReconciliationReportRepository stores payment reconciliation reports
+type ReconciliationReportRepository interface {
+	Create(ctx context.Context, report *models.ReconciliationReport) error
+	GetByID(ctx context.Context, id primitive.ObjectID) (*models.ReconciliationReport, error)
+	// List returns reports newest first without their entries
+	List(ctx context.Context, page, limit int) ([]models.ReconciliationReport, int64, error)
+}
@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"errors"
+	"time"
 
 	"thyne-jewels-backend/internal/models"
 
@@ -51,8 +52,20 @@ func (r *productRepository) GetAll(ctx context.Context, filter models.ProductFil
 	if filter.Subcategory != "" {
 		mongoFilter["subcategory"] = filter.Subcategory
 	}
+	// Option filters match products offered in the metal or size. With inStock,
+	// a product sold by variant must have an in-stock variant with all of them.
+	var clauses []bson.M
 	if len(filter.MetalType) > 0 {
-		mongoFilter["metalType"] = bson.M{"$in": filter.MetalType}
+		clauses = append(clauses, bson.M{"$or": bson.A{
+			bson.M{"metalType": bson.M{"$in": filter.MetalType}},
+			bson.M{"availableMetals": bson.M{"$in": filter.MetalType}},
+		}})
+	}
+	if len(filter.Size) > 0 {
+		clauses = append(clauses, bson.M{"$or": bson.A{
+			bson.M{"size": bson.M{"$in": filter.Size}},
+			bson.M{"availableSizes": bson.M{"$in": filter.Size}},
+		}})
 	}
 	if len(filter.StoneType) > 0 {
 		mongoFilter["stoneType"] = bson.M{"$in": filter.StoneType}
@@ -73,6 +86,28 @@ func (r *productRepository) GetAll(ctx context.Context, filter models.ProductFil
 	if filter.InStock != nil && *filter.InStock {
 		mongoFilter["isAvailable"] = true
 		mongoFilter["stockQuantity"] = bson.M{"$gt": 0}
+
+		inStockVariant := bson.M{"isActive": true, "stockQuantity": bson.M{"$gt": 0}}
+		if len(filter.MetalType) > 0 {
+			inStockVariant["metal"] = bson.M{"$in": filter.MetalType}
+		}
+		if len(filter.Size) > 0 {
+			inStockVariant["size"] = bson.M{"$in": filter.Size}
+		}
+		clauses = append(clauses, bson.M{"$or": bson.A{
+			bson.M{"variants.0": bson.M{"$exists": false}},
+			bson.M{"variants": bson.M{"$elemMatch": inStockVariant}},
+		}})
+	}
+	if filter.LocationID != nil {
+		mongoFilter["isAvailable"] = true
+		mongoFilter["locationStock"] = bson.M{"$elemMatch": bson.M{
+			"locationId": *filter.LocationID,
+			"quantity":   bson.M{"$gt": 0},
+		}}
+	}
+	if len(clauses) > 0 {
+		mongoFilter["$and"] = clauses
 	}
 	if filter.IsFeatured != nil {
 		mongoFilter["isFeatured"] = *filter.IsFeatured
@@ -139,6 +174,8 @@ func (r *productRepository) GetAll(ctx context.Context, filter models.ProductFil
 	return products, total, nil
 }
 
+// Update saves the product's details. Its stock is left alone: stock only changes
+// through the stock repository, so units reserved since the product was read are kept.
 func (r *productRepository) Update(ctx context.Context, product *models.Product) error {
 	filter := bson.M{"_id": product.ID}
 	update := bson.M{
@@ -153,8 +190,12 @@ func (r *productRepository) Update(ctx context.Context, product *models.Product)
 			"metalType":      product.MetalType,
 			"stoneType":      product.StoneType,
 			"weight":         product.Weight,
+			"makingCharge":   product.MakingCharge,
+			"pricingMode":    product.PricingMode,
+			"weightPricing":  product.WeightPricing,
 			"size":           product.Size,
-			"stockQuantity":  product.StockQuantity,
+			"gemstones":      product.Gemstones,
+			"reorderLevel":   product.ReorderLevel,
 			"rating":         product.Rating,
 			"reviewCount":    product.ReviewCount,
 			"tags":           product.Tags,
@@ -245,3 +286,36 @@ func (r *productRepository) Search(ctx context.Context, query string) ([]models.
 
 	return products, nil
 }
+
+func (r *productRepository) GetByMetalCode(ctx context.Context, code string) ([]models.Product, error) {
+	filter := bson.M{
+		"pricingMode":             models.PricingModeMetalRate,
+		"weightPricing.metalCode": code,
+	}
+
+	cursor, err := r.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var products []models.Product
+	if err = cursor.All(ctx, &products); err != nil {
+		return nil, err
+	}
+
+	return products, nil
+}
+
+func (r *productRepository) UpdatePrice(ctx context.Context, id primitive.ObjectID, price, makingCharge float64) error {
+	update := bson.M{
+		"$set": bson.M{
+			"price":        price,
+			"makingCharge": makingCharge,
+			"updatedAt":    time.Now(),
+		},
+	}
+
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
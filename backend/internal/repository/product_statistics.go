@@ -105,9 +105,16 @@ func (r *productRepository) getCategoryDistribution(ctx context.Context) (map[st
 }
 
 func (r *productRepository) getLowStockProducts(ctx context.Context, limit int) ([]models.LowStockProduct, error) {
-	// Find products with stock quantity <= 10 (low stock threshold)
-	filter := bson.M{"stockQuantity": bson.M{"$lte": 10, "$gt": 0}}
-	opts := options.Find().SetLimit(int64(limit))
+	// Find products at or below their reorder level that are not sold out yet
+	filter := bson.M{
+		"stockQuantity": bson.M{"$gt": 0},
+		"stockType":     bson.M{"$ne": models.StockTypeMadeToOrder},
+		"$expr": bson.M{"$lte": bson.A{
+			"$stockQuantity",
+			bson.M{"$ifNull": bson.A{"$reorderLevel", models.DefaultReorderLevel}},
+		}},
+	}
+	opts := options.Find().SetLimit(int64(limit)).SetSort(bson.M{"stockQuantity": 1})
 
 	cursor, err := r.collection.Find(ctx, filter, opts)
 	if err != nil {
@@ -128,8 +135,9 @@ func (r *productRepository) getLowStockProducts(ctx context.Context, limit int)
 			SKU:          product.Name, // Use name as SKU since SKU field doesn't exist
 			Category:     product.Category,
 			CurrentStock: product.StockQuantity,
-			MinimumStock: 10, // Default minimum stock threshold
+			MinimumStock: product.ReorderThreshold(),
 			Price:        product.Price,
+			AlertedAt:    product.LowStockAlertedAt,
 		}
 		lowStockProducts = append(lowStockProducts, lowStockProduct)
 	}
@@ -0,0 +1,21 @@
+package repository
+
+import (
+	"context"
+
+	"thyne-jewels-backend/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ReturnRepository stores return requests (RMAs) for delivered orders
+type ReturnRepository interface {
+	Create(ctx context.Context, ret *models.ReturnRequest) error
+	Update(ctx context.Context, ret *models.ReturnRequest) error
+	// TransitionStatus saves the return request only while it is still in the status it was read with
+	TransitionStatus(ctx context.Context, ret *models.ReturnRequest, from models.ReturnStatus) error
+	GetByID(ctx context.Context, id primitive.ObjectID) (*models.ReturnRequest, error)
+	GetByOrder(ctx context.Context, orderID primitive.ObjectID) ([]models.ReturnRequest, error)
+	GetByCustomer(ctx context.Context, userID primitive.ObjectID, guestSessionID string, page, limit int) ([]models.ReturnRequest, int64, error)
+	List(ctx context.Context, filter models.ReturnFilter) ([]models.ReturnRequest, int64, error)
+}
@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"thyne-jewels-backend/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// StockRepository defines atomic stock updates and the stock movement ledger
+type StockRepository interface {
+	// Reserve decrements stock only if at least quantity units are available and
+	// returns the remaining balance. Made-to-order products are never reserved.
+	Reserve(ctx context.Context, productID primitive.ObjectID, quantity int) (int, error)
+	// Release puts quantity units back into stock and returns the new balance
+	Release(ctx context.Context, productID primitive.ObjectID, quantity int) (int, error)
+	// ReserveVariant decrements a variant's stock, and its product's, only if at
+	// least quantity units of the variant are available, and returns the
+	// variant's remaining balance
+	ReserveVariant(ctx context.Context, productID, variantID primitive.ObjectID, quantity int) (int, error)
+	// ReleaseVariant puts quantity units back into a variant's stock, and its
+	// product's, and returns the variant's new balance
+	ReleaseVariant(ctx context.Context, productID, variantID primitive.ObjectID, quantity int) (int, error)
+
+	// SetStock sets the stock of a product without variants and returns the
+	// balance it replaced
+	SetStock(ctx context.Context, productID primitive.ObjectID, quantity int) (int, error)
+	// SetVariantStock sets a variant's stock, keeps its product's stock the
+	// total of its variants, and returns the variant balance it replaced
+	SetVariantStock(ctx context.Context, productID, variantID primitive.ObjectID, quantity int) (int, error)
+
+	// Locations
+	// Once a product's stock is held per location, its stockQuantity, and
+	// each variant's, is the total held at its locations.
+
+	// ReserveAt decrements the stock held at a location, of the variant when
+	// given, only if at least quantity units are held there, and returns the
+	// balance left at the location
+	ReserveAt(ctx context.Context, productID primitive.ObjectID, variantID *primitive.ObjectID, locationID primitive.ObjectID, quantity int) (int, error)
+	// ReleaseAt puts quantity units into the stock held at a location and
+	// returns the balance at the location
+	ReleaseAt(ctx context.Context, productID primitive.ObjectID, variantID *primitive.ObjectID, locationID primitive.ObjectID, quantity int) (int, error)
+	// SetStockAt sets the stock held at a location and returns the balance it replaced
+	SetStockAt(ctx context.Context, productID primitive.ObjectID, variantID *primitive.ObjectID, locationID primitive.ObjectID, quantity int) (int, error)
+	// AssignUnlocatedStock places the stock of the product, or of every
+	// stocked product when productID is nil, that is not yet held at a
+	// location at the given location, and returns how many products changed
+	AssignUnlocatedStock(ctx context.Context, productID *primitive.ObjectID, locationID primitive.ObjectID) (int64, error)
+
+	// Ledger
+	RecordMovement(ctx context.Context, movement *models.StockMovement) error
+	GetMovements(ctx context.Context, filter models.StockLedgerFilter) ([]models.StockMovement, int64, error)
+	GetMovementsByProduct(ctx context.Context, productID primitive.ObjectID, page, limit int) ([]models.StockMovement, int64, error)
+	GetMovementsByOrder(ctx context.Context, orderID primitive.ObjectID) ([]models.StockMovement, error)
+
+	// Low stock
+	// GetLowStock returns stocked, available products at or below their
+	// reorder level, lowest stock first
+	GetLowStock(ctx context.Context) ([]models.Product, error)
+	MarkLowStockAlerted(ctx context.Context, productID primitive.ObjectID, at time.Time) error
+	// ClearLowStockAlerts clears the alert of products that are above their
+	// reorder level again, so the next drop raises a new one
+	ClearLowStockAlerts(ctx context.Context) (int64, error)
+}
@@ -418,16 +418,28 @@ func (r *StorefrontDataRepository) UpdateStoreSettings(ctx context.Context, sett
 			"gstRate":               settings.GSTRate,
 			"gstNumber":             settings.GSTNumber,
 			"enableGst":             settings.EnableGST,
+			"storeState":            settings.StoreState,
+			"gstRules":              settings.GSTRules,
+			"makingChargeSac":       settings.MakingChargeSAC,
+			"makingChargeGstRate":   settings.MakingChargeGSTRate,
 			"freeShippingThreshold": settings.FreeShippingThreshold,
 			"shippingCost":          settings.ShippingCost,
 			"enableFreeShipping":    settings.EnableFreeShipping,
+			"shippingZones":         settings.ShippingZones,
+			"shippingSlabGrams":     settings.ShippingSlabGrams,
+			"insuranceThreshold":    settings.InsuranceThreshold,
+			"insuranceRate":         settings.InsuranceRate,
 			"enableCod":             settings.EnableCOD,
 			"codCharge":             settings.CODCharge,
 			"codMaxAmount":          settings.CODMaxAmount,
+			"returnWindowDays":      settings.ReturnWindowDays,
+			"warrantyPolicies":      settings.WarrantyPolicies,
 			"storeName":             settings.StoreName,
 			"storeEmail":            settings.StoreEmail,
 			"storePhone":            settings.StorePhone,
 			"storeAddress":          settings.StoreAddress,
+			"storeCity":             settings.StoreCity,
+			"storePincode":          settings.StorePincode,
 			"currency":              settings.Currency,
 			"currencySymbol":        settings.CurrencySymbol,
 			"orderIdPrefix":         settings.OrderIdPrefix,
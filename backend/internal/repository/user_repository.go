@@ -97,6 +97,7 @@ func (r *userRepository) Update(ctx context.Context, user *models.User) error {
 			"isActive":     user.IsActive,
 			"isVerified":   user.IsVerified,
 			"isAdmin":      user.IsAdmin,
+			"locationIds":  user.LocationIDs,
 			"updatedAt":    user.UpdatedAt,
 		},
 	}
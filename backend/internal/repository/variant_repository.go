@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"thyne-jewels-backend/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// ErrDuplicateSKU is returned when a SKU is already used by another product's variant
+	ErrDuplicateSKU = errors.New("SKU is already in use")
+	// ErrVariantNotFound is returned when the product has no variant with the ID
+	ErrVariantNotFound = errors.New("variant not found")
+)
+
+// VariantRepository stores the variants embedded in products. Every write
+// also sets the product's stockQuantity to the total of its variants.
+type VariantRepository interface {
+	AddVariants(ctx context.Context, productID primitive.ObjectID, variants []models.ProductVariant) error
+	// UpdateVariant saves a variant's codes, price, weight and status. Its
+	// stock is only changed through SetVariantStock and the StockRepository.
+	UpdateVariant(ctx context.Context, productID primitive.ObjectID, variant *models.ProductVariant) error
+	SetVariantStock(ctx context.Context, productID, variantID primitive.ObjectID, quantity int) error
+	DeleteVariant(ctx context.Context, productID, variantID primitive.ObjectID) error
+	// GetByCode finds the product with a variant whose SKU or barcode is code
+	GetByCode(ctx context.Context, code string) (*models.Product, error)
+}
@@ -0,0 +1,24 @@
+package repository
+
+import (
+	"context"
+
+	"thyne-jewels-backend/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// WarrantyRepository stores the warranties issued on delivered order lines and the claims made under them
+type WarrantyRepository interface {
+	Create(ctx context.Context, warranty *models.WarrantyInfo) error
+	Update(ctx context.Context, warranty *models.WarrantyInfo) error
+	GetByID(ctx context.Context, id primitive.ObjectID) (*models.WarrantyInfo, error)
+	GetByOrder(ctx context.Context, orderID primitive.ObjectID) ([]models.WarrantyInfo, error)
+	GetByCustomer(ctx context.Context, userID primitive.ObjectID, guestSessionID string, page, limit int) ([]models.WarrantyInfo, int64, error)
+
+	CreateClaim(ctx context.Context, claim *models.WarrantyClaim) error
+	UpdateClaim(ctx context.Context, claim *models.WarrantyClaim) error
+	GetClaimByID(ctx context.Context, id primitive.ObjectID) (*models.WarrantyClaim, error)
+	GetClaimsByWarranty(ctx context.Context, warrantyID primitive.ObjectID) ([]models.WarrantyClaim, error)
+	ListClaims(ctx context.Context, filter models.WarrantyClaimFilter) ([]models.WarrantyClaim, int64, error)
+}
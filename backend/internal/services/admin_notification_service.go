@@ -0,0 +1,40 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AdminNotificationService reads the notifications raised for the admin panel,
+// such as low-stock alerts
+type AdminNotificationService interface {
+	GetNotifications(ctx context.Context, filter models.AdminNotificationFilter) ([]models.AdminNotification, int64, int64, error)
+	MarkRead(ctx context.Context, id string) error
+}
+
+type adminNotificationService struct {
+	adminNotificationRepo repository.AdminNotificationRepository
+}
+
+// NewAdminNotificationService creates a new admin notification service
+func NewAdminNotificationService(adminNotificationRepo repository.AdminNotificationRepository) AdminNotificationService {
+	return &adminNotificationService{adminNotificationRepo: adminNotificationRepo}
+}
+
+// GetNotifications lists notifications newest first with the number still unread
+func (s *adminNotificationService) GetNotifications(ctx context.Context, filter models.AdminNotificationFilter) ([]models.AdminNotification, int64, int64, error) {
+	return s.adminNotificationRepo.GetAll(ctx, filter)
+}
+
+func (s *adminNotificationService) MarkRead(ctx context.Context, id string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return fmt.Errorf("invalid notification ID")
+	}
+	return s.adminNotificationRepo.MarkRead(ctx, objectID)
+}
@@ -3,6 +3,7 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -15,7 +16,8 @@ import (
 )
 
 type AIService struct {
-	aiRepo repository.AIRepository
+	aiRepo           repository.AIRepository
+	metalRateService MetalRateService
 }
 
 func NewAIService(aiRepo repository.AIRepository) *AIService {
@@ -24,6 +26,11 @@ func NewAIService(aiRepo repository.AIRepository) *AIService {
 	}
 }
 
+// SetMetalRateService makes price estimates use the live metal rates
+func (s *AIService) SetMetalRateService(metalRateService MetalRateService) {
+	s.metalRateService = metalRateService
+}
+
 // ==================== Intent Filtering ====================
 
 // AnalyzeIntent uses OpenAI to intelligently classify user intent
@@ -528,6 +535,26 @@ func (s *AIService) RecordTokenUsage(ctx context.Context, userID primitive.Objec
 
 // ==================== Price Estimation ====================
 
+// metalPricePerGram returns the live rate of a metal type, falling back to the
+// approximate MetalPrices when no rate is set. Unknown metals are priced as 18K gold.
+func (s *AIService) metalPricePerGram(ctx context.Context, metalType models.MetalType) float64 {
+	if _, ok := models.MetalPrices[metalType]; !ok {
+		metalType = models.MetalTypeGold18K
+	}
+
+	if s.metalRateService != nil {
+		rate, err := s.metalRateService.GetRate(ctx, models.MetalRateCodes[metalType])
+		if err == nil {
+			return rate.RatePerGram
+		}
+		if !errors.Is(err, ErrMetalRateNotSet) {
+			fmt.Printf("Warning: failed to load metal rate for %s: %v\n", metalType, err)
+		}
+	}
+
+	return models.MetalPrices[metalType]
+}
+
 // EstimatePrice calculates the estimated price range for a custom AI design
 func (s *AIService) EstimatePrice(ctx context.Context, prompt string, jewelryType models.JewelryType, metalType models.MetalType) (*models.PriceEstimate, error) {
 	// Default to ring and 18K gold if not specified
@@ -545,10 +572,7 @@ func (s *AIService) EstimatePrice(ctx context.Context, prompt string, jewelryTyp
 	}
 
 	// Get metal price per gram
-	metalPrice, ok := models.MetalPrices[metalType]
-	if !ok {
-		metalPrice = models.MetalPrices[models.MetalTypeGold18K] // default
-	}
+	metalPrice := s.metalPricePerGram(ctx, metalType)
 
 	// Calculate min and max prices
 	minWeight := weightRange.Min
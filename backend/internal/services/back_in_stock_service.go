@@ -0,0 +1,514 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// backInStockDailyLimit caps the back-in-stock alerts one customer gets in
+	// a day; subscriptions over the cap stay active for the next restock
+	backInStockDailyLimit = 3
+	// backInStockSendInterval spaces the alerts of a restock out, keeping a
+	// large fan-out within the SMS and WhatsApp providers' rate limits
+	backInStockSendInterval = 100 * time.Millisecond
+	// backInStockWishlistInterval is how often a wishlist user may be alerted
+	// about the same product restocking
+	backInStockWishlistInterval = 7 * 24 * time.Hour
+	// backInStockAttribution is how long after an alert a purchase of the
+	// product counts as a conversion
+	backInStockAttribution = 30 * 24 * time.Hour
+)
+
+// ErrInvalidBackInStock is returned when a back-in-stock subscription cannot be made as asked
+var ErrInvalidBackInStock = errors.New("invalid back-in-stock subscription")
+
+// BackInStockPushSender sends the push alert to a signed-in customer.
+// NotificationService satisfies it.
+type BackInStockPushSender interface {
+	SendBackInStockNotification(ctx context.Context, userID primitive.ObjectID, productName, productID string) error
+}
+
+// BackInStockMessenger sends the SMS and WhatsApp alerts. MessagingService satisfies it.
+type BackInStockMessenger interface {
+	SendBackInStock(ctx context.Context, phone, productName, productURL string, channel models.OTPChannel) error
+}
+
+// BackInStockEmailSender sends the email alerts. None is built in; until one
+// is set, email subscriptions stay active.
+type BackInStockEmailSender interface {
+	SendBackInStockEmail(ctx context.Context, email, productName, productURL string) error
+}
+
+// BackInStockService lets customers subscribe to out-of-stock products and
+// variants, alerts them when stock comes back, and tracks which alerts led
+// to a purchase
+type BackInStockService interface {
+	Subscribe(ctx context.Context, productID string, req *models.BackInStockRequest, userID *primitive.ObjectID) (*models.BackInStockSubscriptionResponse, error)
+	Unsubscribe(ctx context.Context, token string) error
+	GetUserSubscriptions(ctx context.Context, userID primitive.ObjectID) ([]models.BackInStockSubscriptionResponse, error)
+	GetSubscriptions(ctx context.Context, filter models.BackInStockFilter) ([]models.BackInStockSubscription, int64, error)
+	GetStats(ctx context.Context) (*models.BackInStockStats, error)
+
+	// NotifyRestock alerts, in the background, the subscribers to a product
+	// that is back in stock, or to the variant when variantID is set.
+	// Wishlists count as subscriptions to the product.
+	NotifyRestock(product *models.Product, variantID *primitive.ObjectID)
+	// RecordPurchase marks the alerted subscriptions the order's customer had
+	// to its products converted
+	RecordPurchase(ctx context.Context, order *models.Order)
+}
+
+type backInStockService struct {
+	subscriptionRepo repository.BackInStockRepository
+	productRepo      repository.ProductRepository
+	userRepo         repository.UserRepository
+	wishlistRepo     repository.WishlistRepository
+	pushSender       BackInStockPushSender
+	messenger        BackInStockMessenger
+	emailSender      BackInStockEmailSender
+	productURL       string
+	sendInterval     time.Duration
+}
+
+// NewBackInStockService creates a new back-in-stock service
+func NewBackInStockService(subscriptionRepo repository.BackInStockRepository, productRepo repository.ProductRepository, userRepo repository.UserRepository) BackInStockService {
+	return &backInStockService{
+		subscriptionRepo: subscriptionRepo,
+		productRepo:      productRepo,
+		userRepo:         userRepo,
+		sendInterval:     backInStockSendInterval,
+	}
+}
+
+// SetWishlistRepository sets the wishlists whose users are alerted when a
+// product is back in stock
+func (s *backInStockService) SetWishlistRepository(wishlistRepo repository.WishlistRepository) {
+	s.wishlistRepo = wishlistRepo
+}
+
+// SetPushSender sets how push alerts are sent
+func (s *backInStockService) SetPushSender(pushSender BackInStockPushSender) {
+	s.pushSender = pushSender
+}
+
+// SetMessenger sets how SMS and WhatsApp alerts are sent
+func (s *backInStockService) SetMessenger(messenger BackInStockMessenger) {
+	s.messenger = messenger
+}
+
+// SetEmailSender sets how email alerts are sent
+func (s *backInStockService) SetEmailSender(emailSender BackInStockEmailSender) {
+	s.emailSender = emailSender
+}
+
+// SetProductURL sets the storefront address product pages are found under,
+// linked from SMS, WhatsApp and email alerts
+func (s *backInStockService) SetProductURL(productURL string) {
+	s.productURL = strings.TrimRight(productURL, "/")
+}
+
+// Subscribe subscribes the customer to an out-of-stock product, or to one of
+// its variants. A subscription to a product sold by variant follows its total
+// stock. Asking again returns the customer's existing subscription; its
+// unsubscribe token is only returned to the user or guest session that made
+// it, since anyone can give the same phone number or email.
+func (s *backInStockService) Subscribe(ctx context.Context, productID string, req *models.BackInStockRequest, userID *primitive.ObjectID) (*models.BackInStockSubscriptionResponse, error) {
+	id, err := primitive.ObjectIDFromHex(productID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid product ID", ErrInvalidBackInStock)
+	}
+	product, err := s.productRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("product %w", ErrInventoryNotFound)
+	}
+	if product.StockType == models.StockTypeMadeToOrder {
+		return nil, fmt.Errorf("%w: %s is made to order", ErrInvalidBackInStock, product.Name)
+	}
+
+	subscription := &models.BackInStockSubscription{
+		ProductID:   product.ID,
+		ProductName: product.Name,
+		Source:      models.BackInStockSourceRequest,
+		Status:      models.BackInStockActive,
+	}
+	stock := product.StockQuantity
+	if req.VariantID != "" {
+		line, err := stockLine(product, req.VariantID, ErrInvalidBackInStock)
+		if err != nil {
+			return nil, err
+		}
+		variant := product.FindVariant(*line.VariantID)
+		subscription.VariantID = line.VariantID
+		subscription.SKU = variant.SKU
+		if label := variant.Label(); label != "" {
+			subscription.ProductName = product.Name + " (" + label + ")"
+		}
+		stock = variant.StockQuantity
+	}
+	if stock > 0 {
+		return nil, fmt.Errorf("%w: %s is in stock", ErrInvalidBackInStock, subscription.ProductName)
+	}
+
+	if err := s.setContact(ctx, subscription, req, userID); err != nil {
+		return nil, err
+	}
+
+	existing, err := s.subscriptionRepo.GetActive(ctx, subscription.ContactKey, product.ID, subscription.VariantID)
+	if err == nil {
+		if !ownsBackInStock(existing, userID, req.GuestSessionID) {
+			subscription.ID, subscription.CreatedAt = existing.ID, existing.CreatedAt
+			return &models.BackInStockSubscriptionResponse{BackInStockSubscription: *subscription}, nil
+		}
+		return &models.BackInStockSubscriptionResponse{BackInStockSubscription: *existing, Token: existing.Token}, nil
+	}
+	if !errors.Is(err, repository.ErrBackInStockNotFound) {
+		return nil, err
+	}
+
+	if subscription.Token, err = newBackInStockToken(); err != nil {
+		return nil, err
+	}
+	if err := s.subscriptionRepo.Create(ctx, subscription); err != nil {
+		return nil, err
+	}
+	return &models.BackInStockSubscriptionResponse{BackInStockSubscription: *subscription, Token: subscription.Token}, nil
+}
+
+// setContact sets who a subscription alerts and through which channel.
+// Signed-in users default to push and are rate limited as one contact;
+// guests are alerted by SMS when they give a phone number, else by email.
+func (s *backInStockService) setContact(ctx context.Context, subscription *models.BackInStockSubscription, req *models.BackInStockRequest, userID *primitive.ObjectID) error {
+	channel := req.Channel
+	phone := req.Phone
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+
+	if userID != nil {
+		subscription.UserID = userID
+		subscription.ContactKey = "user:" + userID.Hex()
+		if channel == "" {
+			channel = models.BackInStockChannelPush
+		}
+		if channel != models.BackInStockChannelPush && phone == "" && email == "" && s.userRepo != nil {
+			// Alert the user at the contact details on their account
+			if user, err := s.userRepo.GetByID(ctx, *userID); err == nil {
+				phone, email = user.Phone, strings.ToLower(user.Email)
+			}
+		}
+	} else {
+		subscription.GuestSessionID = req.GuestSessionID
+		switch {
+		case channel != "":
+		case phone != "":
+			channel = models.BackInStockChannelSMS
+		default:
+			channel = models.BackInStockChannelEmail
+		}
+	}
+	subscription.Channel = channel
+
+	switch channel {
+	case models.BackInStockChannelPush:
+		if userID == nil {
+			return fmt.Errorf("%w: sign in for push alerts, or give a phone number or email", ErrInvalidBackInStock)
+		}
+	case models.BackInStockChannelSMS, models.BackInStockChannelWhatsApp:
+		phone = normalizePhone(phone)
+		if len(phone) < 10 {
+			return fmt.Errorf("%w: a valid phone number is required for %s alerts", ErrInvalidBackInStock, channel)
+		}
+		subscription.Phone = phone
+		if userID == nil {
+			subscription.ContactKey = "phone:" + phone
+		}
+	case models.BackInStockChannelEmail:
+		if !strings.Contains(email, "@") {
+			return fmt.Errorf("%w: an email address is required for email alerts", ErrInvalidBackInStock)
+		}
+		subscription.Email = email
+		if userID == nil {
+			subscription.ContactKey = "email:" + email
+		}
+	default:
+		return fmt.Errorf("%w: unknown channel %q", ErrInvalidBackInStock, channel)
+	}
+	return nil
+}
+
+// ownsBackInStock reports whether the subscription was made by the user, or
+// by the guest session when there is no user
+func ownsBackInStock(subscription *models.BackInStockSubscription, userID *primitive.ObjectID, guestSessionID string) bool {
+	if userID != nil {
+		return subscription.UserID != nil && *subscription.UserID == *userID
+	}
+	return guestSessionID != "" && subscription.UserID == nil && subscription.GuestSessionID == guestSessionID
+}
+
+func newBackInStockToken() (string, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return "", fmt.Errorf("failed to generate unsubscribe token: %w", err)
+	}
+	return hex.EncodeToString(token), nil
+}
+
+// Unsubscribe cancels an active subscription by its token
+func (s *backInStockService) Unsubscribe(ctx context.Context, token string) error {
+	subscription, err := s.subscriptionRepo.GetByToken(ctx, token)
+	if err != nil {
+		if errors.Is(err, repository.ErrBackInStockNotFound) {
+			return fmt.Errorf("subscription %w", ErrInventoryNotFound)
+		}
+		return err
+	}
+	if subscription.Status != models.BackInStockActive {
+		return fmt.Errorf("%w: subscription is already %s", ErrInvalidBackInStock, subscription.Status)
+	}
+
+	if err := s.subscriptionRepo.Cancel(ctx, subscription.ID); err != nil {
+		if errors.Is(err, repository.ErrBackInStockClaimed) {
+			return fmt.Errorf("%w: subscription is no longer active", ErrInvalidBackInStock)
+		}
+		return err
+	}
+	return nil
+}
+
+// GetUserSubscriptions lists a user's subscriptions that were not cancelled,
+// newest first, with the tokens that cancel them
+func (s *backInStockService) GetUserSubscriptions(ctx context.Context, userID primitive.ObjectID) ([]models.BackInStockSubscriptionResponse, error) {
+	subscriptions, err := s.subscriptionRepo.GetByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]models.BackInStockSubscriptionResponse, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		responses = append(responses, models.BackInStockSubscriptionResponse{BackInStockSubscription: subscription, Token: subscription.Token})
+	}
+	return responses, nil
+}
+
+// GetSubscriptions lists subscriptions, newest first
+func (s *backInStockService) GetSubscriptions(ctx context.Context, filter models.BackInStockFilter) ([]models.BackInStockSubscription, int64, error) {
+	return s.subscriptionRepo.GetAll(ctx, filter)
+}
+
+// GetStats reports subscriptions, alerts and conversions in total and per channel
+func (s *backInStockService) GetStats(ctx context.Context) (*models.BackInStockStats, error) {
+	channels, err := s.subscriptionRepo.GetStats(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &models.BackInStockStats{ByChannel: channels}
+	for _, channel := range channels {
+		stats.Subscribed += channel.Subscribed
+		stats.Active += channel.Active
+		stats.Notified += channel.Notified
+		stats.Converted += channel.Converted
+	}
+	if stats.Notified > 0 {
+		stats.ConversionRate = math.Round(float64(stats.Converted)/float64(stats.Notified)*10000) / 100
+	}
+	return stats, nil
+}
+
+// NotifyRestock alerts the subscribers to a restocked product or variant in
+// the background, so the stock change that restocked it is not held up
+func (s *backInStockService) NotifyRestock(product *models.Product, variantID *primitive.ObjectID) {
+	restocked := *product
+	go s.notifyRestock(context.Background(), &restocked, variantID)
+}
+
+// notifyRestock alerts subscribers oldest first, one send interval apart.
+// Each subscription is claimed before its alert is sent, so overlapping
+// restocks alert it once; alerts that fail, or that a channel cannot send
+// yet, leave it active for the next restock.
+func (s *backInStockService) notifyRestock(ctx context.Context, product *models.Product, variantID *primitive.ObjectID) int {
+	subscriptions, err := s.subscriptionRepo.GetActiveByProduct(ctx, product.ID, variantID)
+	if err != nil {
+		fmt.Printf("Warning: failed to get back-in-stock subscriptions to product %s: %v\n", product.ID.Hex(), err)
+		return 0
+	}
+	if variantID == nil {
+		subscriptions = append(subscriptions, s.wishlistSubscriptions(ctx, product, subscriptions)...)
+	}
+
+	sent := 0
+	day := time.Now().Format("2006-01-02")
+	for i := range subscriptions {
+		subscription := &subscriptions[i]
+		if !s.canSend(subscription.Channel) {
+			continue
+		}
+		// The alert is counted before it is sent, so overlapping restocks
+		// cannot both send the contact's last alert of the day
+		if err := s.subscriptionRepo.TakeAlert(ctx, subscription.ContactKey, day, backInStockDailyLimit); err != nil {
+			if !errors.Is(err, repository.ErrBackInStockLimitReached) {
+				fmt.Printf("Warning: failed to count back-in-stock alert for %s: %v\n", subscription.ContactKey, err)
+			}
+			continue
+		}
+
+		if sent > 0 && s.sendInterval > 0 {
+			time.Sleep(s.sendInterval)
+		}
+		if s.notify(ctx, product, subscription) {
+			sent++
+		} else if err := s.subscriptionRepo.ReturnAlert(ctx, subscription.ContactKey, day); err != nil {
+			fmt.Printf("Warning: failed to return back-in-stock alert for %s: %v\n", subscription.ContactKey, err)
+		}
+	}
+	return sent
+}
+
+// wishlistSubscriptions makes, unsaved, a push subscription for every user
+// with the product in their wishlist who is not already subscribed to it and
+// was not alerted about it within the wishlist interval
+func (s *backInStockService) wishlistSubscriptions(ctx context.Context, product *models.Product, subscribed []models.BackInStockSubscription) []models.BackInStockSubscription {
+	if s.wishlistRepo == nil {
+		return nil
+	}
+	items, err := s.wishlistRepo.GetWishlistItemsByProduct(ctx, product.ID)
+	if err != nil {
+		fmt.Printf("Warning: failed to get wishlists holding product %s: %v\n", product.ID.Hex(), err)
+		return nil
+	}
+
+	alerted, err := s.subscriptionRepo.GetNotifiedContacts(ctx, product.ID, time.Now().Add(-backInStockWishlistInterval))
+	if err != nil {
+		fmt.Printf("Warning: failed to get customers alerted about product %s: %v\n", product.ID.Hex(), err)
+		return nil
+	}
+
+	skip := make(map[string]bool, len(subscribed)+len(alerted))
+	for _, subscription := range subscribed {
+		skip[subscription.ContactKey] = true
+	}
+	for _, contactKey := range alerted {
+		skip[contactKey] = true
+	}
+
+	var subscriptions []models.BackInStockSubscription
+	for _, item := range items {
+		userID := item.UserID
+		contactKey := "user:" + userID.Hex()
+		if skip[contactKey] {
+			continue
+		}
+		skip[contactKey] = true
+		subscriptions = append(subscriptions, models.BackInStockSubscription{
+			ProductID:   product.ID,
+			ProductName: product.Name,
+			UserID:      &userID,
+			Channel:     models.BackInStockChannelPush,
+			ContactKey:  contactKey,
+			Source:      models.BackInStockSourceWishlist,
+			Status:      models.BackInStockActive,
+		})
+	}
+	return subscriptions
+}
+
+func (s *backInStockService) canSend(channel models.BackInStockChannel) bool {
+	switch channel {
+	case models.BackInStockChannelPush:
+		return s.pushSender != nil
+	case models.BackInStockChannelSMS, models.BackInStockChannelWhatsApp:
+		return s.messenger != nil
+	case models.BackInStockChannelEmail:
+		return s.emailSender != nil
+	}
+	return false
+}
+
+// notify claims and sends one alert, saving wishlist subscriptions first
+func (s *backInStockService) notify(ctx context.Context, product *models.Product, subscription *models.BackInStockSubscription) bool {
+	if subscription.ID.IsZero() {
+		token, err := newBackInStockToken()
+		if err != nil {
+			return false
+		}
+		subscription.Token = token
+		if err := s.subscriptionRepo.Create(ctx, subscription); err != nil {
+			fmt.Printf("Warning: failed to save wishlist back-in-stock subscription for product %s: %v\n", product.ID.Hex(), err)
+			return false
+		}
+	}
+
+	if err := s.subscriptionRepo.Claim(ctx, subscription.ID, time.Now()); err != nil {
+		return false
+	}
+
+	if err := s.send(ctx, product, subscription); err != nil {
+		fmt.Printf("Warning: failed to send back-in-stock alert %s: %v\n", subscription.ID.Hex(), err)
+		if err := s.subscriptionRepo.Reopen(ctx, subscription.ID, err.Error()); err != nil {
+			fmt.Printf("Warning: failed to reopen back-in-stock subscription %s: %v\n", subscription.ID.Hex(), err)
+		}
+		return false
+	}
+	return true
+}
+
+func (s *backInStockService) send(ctx context.Context, product *models.Product, subscription *models.BackInStockSubscription) error {
+	link := s.productURL + "/" + product.ID.Hex()
+	switch subscription.Channel {
+	case models.BackInStockChannelPush:
+		return s.pushSender.SendBackInStockNotification(ctx, *subscription.UserID, subscription.ProductName, product.ID.Hex())
+	case models.BackInStockChannelSMS:
+		return s.messenger.SendBackInStock(ctx, subscription.Phone, subscription.ProductName, link, models.OTPChannelSMS)
+	case models.BackInStockChannelWhatsApp:
+		return s.messenger.SendBackInStock(ctx, subscription.Phone, subscription.ProductName, link, models.OTPChannelWhatsApp)
+	case models.BackInStockChannelEmail:
+		return s.emailSender.SendBackInStockEmail(ctx, subscription.Email, subscription.ProductName, link)
+	}
+	return fmt.Errorf("unknown channel %q", subscription.Channel)
+}
+
+// RecordPurchase marks converted the subscriptions to the order's products
+// that alerted its customer within the attribution window. The customer is
+// matched by account, guest session or delivery phone number.
+func (s *backInStockService) RecordPurchase(ctx context.Context, order *models.Order) {
+	var contactKeys []string
+	if !order.UserID.IsZero() {
+		contactKeys = append(contactKeys, "user:"+order.UserID.Hex())
+	}
+	if phone := normalizePhone(order.ShippingAddress.RecipientPhone); phone != "" {
+		contactKeys = append(contactKeys, "phone:"+phone)
+	}
+	if len(contactKeys) == 0 && order.GuestSessionID == "" {
+		return
+	}
+
+	now := time.Now()
+	seen := make(map[primitive.ObjectID]bool, len(order.Items))
+	for _, item := range order.Items {
+		if seen[item.ProductID] {
+			continue
+		}
+		seen[item.ProductID] = true
+
+		subscriptions, err := s.subscriptionRepo.GetConvertible(ctx, item.ProductID, contactKeys, order.GuestSessionID, now.Add(-backInStockAttribution))
+		if err != nil {
+			fmt.Printf("Warning: failed to get back-in-stock subscriptions for order %s: %v\n", order.OrderNumber, err)
+			continue
+		}
+		for _, subscription := range subscriptions {
+			if err := s.subscriptionRepo.MarkConverted(ctx, subscription.ID, order.OrderNumber, now); err != nil && !errors.Is(err, repository.ErrBackInStockClaimed) {
+				fmt.Printf("Warning: failed to mark back-in-stock subscription %s converted: %v\n", subscription.ID.Hex(), err)
+			}
+		}
+	}
+}
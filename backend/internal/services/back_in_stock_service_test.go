@@ -0,0 +1,534 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memoryBackInStockRepository keeps back-in-stock subscriptions and the
+// alerts counted per contact and day in memory
+type memoryBackInStockRepository struct {
+	subscriptions []models.BackInStockSubscription
+	alerts        map[string]int
+}
+
+func (r *memoryBackInStockRepository) find(id primitive.ObjectID) *models.BackInStockSubscription {
+	for i := range r.subscriptions {
+		if r.subscriptions[i].ID == id {
+			return &r.subscriptions[i]
+		}
+	}
+	return nil
+}
+
+func sameLine(subscription *models.BackInStockSubscription, productID primitive.ObjectID, variantID *primitive.ObjectID) bool {
+	if subscription.ProductID != productID || (subscription.VariantID == nil) != (variantID == nil) {
+		return false
+	}
+	return variantID == nil || *subscription.VariantID == *variantID
+}
+
+func (r *memoryBackInStockRepository) Create(ctx context.Context, subscription *models.BackInStockSubscription) error {
+	if subscription.ID.IsZero() {
+		subscription.ID = primitive.NewObjectID()
+	}
+	subscription.CreatedAt = time.Now()
+	r.subscriptions = append(r.subscriptions, *subscription)
+	return nil
+}
+
+func (r *memoryBackInStockRepository) GetByToken(ctx context.Context, token string) (*models.BackInStockSubscription, error) {
+	for _, subscription := range r.subscriptions {
+		if subscription.Token == token {
+			return &subscription, nil
+		}
+	}
+	return nil, repository.ErrBackInStockNotFound
+}
+
+func (r *memoryBackInStockRepository) GetActive(ctx context.Context, contactKey string, productID primitive.ObjectID, variantID *primitive.ObjectID) (*models.BackInStockSubscription, error) {
+	for _, subscription := range r.subscriptions {
+		if subscription.ContactKey == contactKey && subscription.Status == models.BackInStockActive && sameLine(&subscription, productID, variantID) {
+			return &subscription, nil
+		}
+	}
+	return nil, repository.ErrBackInStockNotFound
+}
+
+func (r *memoryBackInStockRepository) GetActiveByProduct(ctx context.Context, productID primitive.ObjectID, variantID *primitive.ObjectID) ([]models.BackInStockSubscription, error) {
+	var subscriptions []models.BackInStockSubscription
+	for _, subscription := range r.subscriptions {
+		if subscription.Status == models.BackInStockActive && sameLine(&subscription, productID, variantID) {
+			subscriptions = append(subscriptions, subscription)
+		}
+	}
+	return subscriptions, nil
+}
+
+func (r *memoryBackInStockRepository) GetByUser(ctx context.Context, userID primitive.ObjectID) ([]models.BackInStockSubscription, error) {
+	var subscriptions []models.BackInStockSubscription
+	for _, subscription := range r.subscriptions {
+		if subscription.UserID != nil && *subscription.UserID == userID && subscription.Status != models.BackInStockCancelled {
+			subscriptions = append(subscriptions, subscription)
+		}
+	}
+	return subscriptions, nil
+}
+
+func (r *memoryBackInStockRepository) GetAll(ctx context.Context, filter models.BackInStockFilter) ([]models.BackInStockSubscription, int64, error) {
+	return r.subscriptions, int64(len(r.subscriptions)), nil
+}
+
+func (r *memoryBackInStockRepository) Claim(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	subscription := r.find(id)
+	if subscription == nil || subscription.Status != models.BackInStockActive {
+		return repository.ErrBackInStockClaimed
+	}
+	subscription.Status = models.BackInStockNotified
+	subscription.NotifiedAt = &at
+	return nil
+}
+
+func (r *memoryBackInStockRepository) Reopen(ctx context.Context, id primitive.ObjectID, notifyError string) error {
+	if subscription := r.find(id); subscription != nil && subscription.Status == models.BackInStockNotified {
+		subscription.Status = models.BackInStockActive
+		subscription.NotifiedAt = nil
+		subscription.NotifyError = notifyError
+	}
+	return nil
+}
+
+func (r *memoryBackInStockRepository) Cancel(ctx context.Context, id primitive.ObjectID) error {
+	subscription := r.find(id)
+	if subscription == nil || subscription.Status != models.BackInStockActive {
+		return repository.ErrBackInStockClaimed
+	}
+	subscription.Status = models.BackInStockCancelled
+	return nil
+}
+
+func (r *memoryBackInStockRepository) TakeAlert(ctx context.Context, contactKey, day string, limit int) error {
+	if r.alerts == nil {
+		r.alerts = make(map[string]int)
+	}
+	if r.alerts[contactKey+"/"+day] >= limit {
+		return repository.ErrBackInStockLimitReached
+	}
+	r.alerts[contactKey+"/"+day]++
+	return nil
+}
+
+func (r *memoryBackInStockRepository) ReturnAlert(ctx context.Context, contactKey, day string) error {
+	if r.alerts[contactKey+"/"+day] > 0 {
+		r.alerts[contactKey+"/"+day]--
+	}
+	return nil
+}
+
+func (r *memoryBackInStockRepository) GetNotifiedContacts(ctx context.Context, productID primitive.ObjectID, since time.Time) ([]string, error) {
+	var contacts []string
+	for _, subscription := range r.subscriptions {
+		if subscription.ProductID == productID && subscription.NotifiedAt != nil && !subscription.NotifiedAt.Before(since) {
+			contacts = append(contacts, subscription.ContactKey)
+		}
+	}
+	return contacts, nil
+}
+
+func (r *memoryBackInStockRepository) GetConvertible(ctx context.Context, productID primitive.ObjectID, contactKeys []string, guestSessionID string, since time.Time) ([]models.BackInStockSubscription, error) {
+	var subscriptions []models.BackInStockSubscription
+	for _, subscription := range r.subscriptions {
+		if subscription.ProductID != productID || subscription.Status != models.BackInStockNotified || subscription.ConvertedAt != nil || subscription.NotifiedAt.Before(since) {
+			continue
+		}
+		matched := guestSessionID != "" && subscription.GuestSessionID == guestSessionID
+		for _, key := range contactKeys {
+			matched = matched || subscription.ContactKey == key
+		}
+		if matched {
+			subscriptions = append(subscriptions, subscription)
+		}
+	}
+	return subscriptions, nil
+}
+
+func (r *memoryBackInStockRepository) MarkConverted(ctx context.Context, id primitive.ObjectID, orderNumber string, at time.Time) error {
+	subscription := r.find(id)
+	if subscription == nil || subscription.ConvertedAt != nil {
+		return repository.ErrBackInStockClaimed
+	}
+	subscription.ConvertedAt = &at
+	subscription.ConvertedOrder = orderNumber
+	return nil
+}
+
+func (r *memoryBackInStockRepository) GetStats(ctx context.Context) ([]models.BackInStockChannelStats, error) {
+	byChannel := map[models.BackInStockChannel]*models.BackInStockChannelStats{}
+	var stats []models.BackInStockChannelStats
+	for _, subscription := range r.subscriptions {
+		if subscription.Status == models.BackInStockCancelled {
+			continue
+		}
+		channel, ok := byChannel[subscription.Channel]
+		if !ok {
+			channel = &models.BackInStockChannelStats{Channel: subscription.Channel}
+			byChannel[subscription.Channel] = channel
+		}
+		channel.Subscribed++
+		switch subscription.Status {
+		case models.BackInStockActive:
+			channel.Active++
+		case models.BackInStockNotified:
+			channel.Notified++
+		}
+		if subscription.ConvertedAt != nil {
+			channel.Converted++
+		}
+	}
+	for _, channel := range byChannel {
+		stats = append(stats, *channel)
+	}
+	return stats, nil
+}
+
+// recordingAlertSender records the push, SMS and WhatsApp alerts it is asked
+// to send, failing those to the failing phone number
+type recordingAlertSender struct {
+	pushed  []primitive.ObjectID
+	texted  []string
+	failing string
+}
+
+func (s *recordingAlertSender) SendBackInStockNotification(ctx context.Context, userID primitive.ObjectID, productName, productID string) error {
+	s.pushed = append(s.pushed, userID)
+	return nil
+}
+
+func (s *recordingAlertSender) SendBackInStock(ctx context.Context, phone, productName, productURL string, channel models.OTPChannel) error {
+	if phone == s.failing {
+		return errors.New("provider unavailable")
+	}
+	s.texted = append(s.texted, string(channel)+":"+phone+":"+productURL)
+	return nil
+}
+
+type memoryWishlistRepository struct {
+	repository.WishlistRepository
+	items []models.WishlistItem
+}
+
+func (r *memoryWishlistRepository) GetWishlistItemsByProduct(ctx context.Context, productID primitive.ObjectID) ([]models.WishlistItem, error) {
+	var items []models.WishlistItem
+	for _, item := range r.items {
+		if item.ProductID == productID {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+// restockRecorder records the restocks the stock service announces
+type restockRecorder struct {
+	BackInStockService
+	restocks []string
+}
+
+func (r *restockRecorder) NotifyRestock(product *models.Product, variantID *primitive.ObjectID) {
+	line := product.Name
+	if variantID != nil {
+		line += "/" + product.FindVariant(*variantID).SKU
+	}
+	r.restocks = append(r.restocks, line)
+}
+
+func newTestBackInStockService(products ...models.Product) (*backInStockService, *memoryBackInStockRepository) {
+	productRepo := &memoryProductRepository{products: map[primitive.ObjectID]models.Product{}}
+	for _, product := range products {
+		productRepo.products[product.ID] = product
+	}
+	subscriptionRepo := &memoryBackInStockRepository{}
+	service := NewBackInStockService(subscriptionRepo, productRepo, nil).(*backInStockService)
+	service.sendInterval = 0
+	return service, subscriptionRepo
+}
+
+func TestBackInStockSubscriptions(t *testing.T) {
+	ctx := context.Background()
+	soldOut := models.Product{ID: primitive.NewObjectID(), Name: "Jhumka", StockType: models.StockTypeStocked}
+	inStock := models.Product{ID: primitive.NewObjectID(), Name: "Bangle", StockType: models.StockTypeStocked, StockQuantity: 4}
+	ring := models.Product{ID: primitive.NewObjectID(), Name: "Ring", StockType: models.StockTypeStocked, StockQuantity: 2,
+		Variants: []models.ProductVariant{
+			{ID: primitive.NewObjectID(), SKU: "RING-6", Size: "6", StockQuantity: 2, IsActive: true},
+			{ID: primitive.NewObjectID(), SKU: "RING-7", Size: "7", IsActive: true},
+		}}
+	service, repo := newTestBackInStockService(soldOut, inStock, ring)
+	userID := primitive.NewObjectID()
+
+	first, err := service.Subscribe(ctx, soldOut.ID.Hex(), &models.BackInStockRequest{}, &userID)
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	if first.Channel != models.BackInStockChannelPush || first.Token == "" || first.ContactKey != "user:"+userID.Hex() {
+		t.Fatalf("unexpected user subscription %+v", first)
+	}
+	again, err := service.Subscribe(ctx, soldOut.ID.Hex(), &models.BackInStockRequest{}, &userID)
+	if err != nil || again.ID != first.ID || len(repo.subscriptions) != 1 {
+		t.Fatalf("expected subscribing again to return the subscription, got %+v (%v)", again, err)
+	}
+
+	guest, err := service.Subscribe(ctx, soldOut.ID.Hex(), &models.BackInStockRequest{Phone: "98765 43210", GuestSessionID: "guest-1"}, nil)
+	if err != nil {
+		t.Fatalf("guest subscribe: %v", err)
+	}
+	if guest.Channel != models.BackInStockChannelSMS || guest.Phone != "919876543210" || guest.ContactKey != "phone:919876543210" {
+		t.Fatalf("unexpected guest subscription %+v", guest)
+	}
+
+	// Only the guest session that subscribed gets the token back
+	if again, err := service.Subscribe(ctx, soldOut.ID.Hex(), &models.BackInStockRequest{Phone: "9876543210", GuestSessionID: "guest-1"}, nil); err != nil || again.Token != guest.Token {
+		t.Fatalf("expected the guest's own subscription with its token, got %+v (%v)", again, err)
+	}
+	for _, session := range []string{"guest-2", ""} {
+		other, err := service.Subscribe(ctx, soldOut.ID.Hex(), &models.BackInStockRequest{Phone: "9876543210", GuestSessionID: session}, nil)
+		if err != nil || other.ID != guest.ID || other.Token != "" || other.GuestSessionID == "guest-1" {
+			t.Fatalf("expected someone else giving the phone number not to get the token, got %+v (%v)", other, err)
+		}
+	}
+	emailed, err := service.Subscribe(ctx, soldOut.ID.Hex(), &models.BackInStockRequest{Email: "Asha@Example.com"}, nil)
+	if err != nil || emailed.Channel != models.BackInStockChannelEmail || emailed.ContactKey != "email:asha@example.com" {
+		t.Fatalf("unexpected email subscription %+v (%v)", emailed, err)
+	}
+
+	variant, err := service.Subscribe(ctx, ring.ID.Hex(), &models.BackInStockRequest{VariantID: ring.Variants[1].ID.Hex()}, &userID)
+	if err != nil {
+		t.Fatalf("variant subscribe: %v", err)
+	}
+	if variant.SKU != "RING-7" || variant.ProductName != "Ring (Size 7)" {
+		t.Fatalf("unexpected variant subscription %+v", variant)
+	}
+
+	refused := []struct {
+		name      string
+		productID string
+		req       models.BackInStockRequest
+		userID    *primitive.ObjectID
+	}{
+		{"in stock", inStock.ID.Hex(), models.BackInStockRequest{}, &userID},
+		{"variant in stock", ring.ID.Hex(), models.BackInStockRequest{VariantID: ring.Variants[0].ID.Hex()}, &userID},
+		{"product with stock left in a variant", ring.ID.Hex(), models.BackInStockRequest{}, &userID},
+		{"guest without contact", soldOut.ID.Hex(), models.BackInStockRequest{}, nil},
+		{"guest push", soldOut.ID.Hex(), models.BackInStockRequest{Channel: models.BackInStockChannelPush, Phone: "9876543210"}, nil},
+		{"short phone", soldOut.ID.Hex(), models.BackInStockRequest{Channel: models.BackInStockChannelWhatsApp, Phone: "12345"}, nil},
+	}
+	for _, tc := range refused {
+		if _, err := service.Subscribe(ctx, tc.productID, &tc.req, tc.userID); !errors.Is(err, ErrInvalidBackInStock) {
+			t.Errorf("%s: expected ErrInvalidBackInStock, got %v", tc.name, err)
+		}
+	}
+	if _, err := service.Subscribe(ctx, primitive.NewObjectID().Hex(), &models.BackInStockRequest{}, &userID); !errors.Is(err, ErrInventoryNotFound) {
+		t.Fatalf("expected an unknown product to be not found, got %v", err)
+	}
+
+	mine, err := service.GetUserSubscriptions(ctx, userID)
+	if err != nil || len(mine) != 2 || mine[0].Token == "" {
+		t.Fatalf("expected the user's two subscriptions with tokens, got %+v (%v)", mine, err)
+	}
+
+	if err := service.Unsubscribe(ctx, guest.Token); err != nil {
+		t.Fatalf("unsubscribe: %v", err)
+	}
+	if err := service.Unsubscribe(ctx, guest.Token); !errors.Is(err, ErrInvalidBackInStock) {
+		t.Fatalf("expected unsubscribing twice to be refused, got %v", err)
+	}
+	if err := service.Unsubscribe(ctx, "unknown"); !errors.Is(err, ErrInventoryNotFound) {
+		t.Fatalf("expected an unknown token to be not found, got %v", err)
+	}
+}
+
+func TestRestockAlertsAreRateLimited(t *testing.T) {
+	ctx := context.Background()
+	product := models.Product{ID: primitive.NewObjectID(), Name: "Jhumka", StockType: models.StockTypeStocked}
+	service, repo := newTestBackInStockService(product)
+	sender := &recordingAlertSender{failing: "919000000002"}
+	service.SetPushSender(sender)
+	service.SetMessenger(sender)
+	service.SetProductURL("https://thyne.example/products/")
+
+	subscriber := primitive.NewObjectID()
+	wishlister := primitive.NewObjectID()
+	service.SetWishlistRepository(&memoryWishlistRepository{items: []models.WishlistItem{
+		{UserID: subscriber, ProductID: product.ID},
+		{UserID: wishlister, ProductID: product.ID},
+	}})
+
+	subscribe := func(req models.BackInStockRequest, userID *primitive.ObjectID) *models.BackInStockSubscriptionResponse {
+		t.Helper()
+		subscription, err := service.Subscribe(ctx, product.ID.Hex(), &req, userID)
+		if err != nil {
+			t.Fatalf("subscribe: %v", err)
+		}
+		return subscription
+	}
+	pushed := subscribe(models.BackInStockRequest{}, &subscriber)
+	texted := subscribe(models.BackInStockRequest{Channel: models.BackInStockChannelWhatsApp, Phone: "9000000001"}, nil)
+	failing := subscribe(models.BackInStockRequest{Phone: "9000000002"}, nil)
+	emailed := subscribe(models.BackInStockRequest{Email: "asha@example.com"}, nil)
+	capped := subscribe(models.BackInStockRequest{Phone: "9000000003"}, nil)
+
+	// The last guest was already alerted about other products today
+	today := time.Now().Format("2006-01-02")
+	repo.alerts = map[string]int{"phone:919000000003/" + today: backInStockDailyLimit}
+
+	if sent := service.notifyRestock(ctx, &product, nil); sent != 3 {
+		t.Fatalf("expected 3 alerts, got %d", sent)
+	}
+	if len(sender.pushed) != 2 || sender.pushed[0] != subscriber || sender.pushed[1] != wishlister {
+		t.Fatalf("expected the subscriber and the wishlist user to be pushed once each, got %v", sender.pushed)
+	}
+	if len(sender.texted) != 1 || sender.texted[0] != "whatsapp:919000000001:https://thyne.example/products/"+product.ID.Hex() {
+		t.Fatalf("unexpected texts %v", sender.texted)
+	}
+
+	status := func(id primitive.ObjectID) *models.BackInStockSubscription {
+		return repo.find(id)
+	}
+	if status(pushed.ID).Status != models.BackInStockNotified || status(texted.ID).Status != models.BackInStockNotified {
+		t.Fatalf("expected sent alerts to be marked notified")
+	}
+	if sub := status(failing.ID); sub.Status != models.BackInStockActive || sub.NotifyError == "" {
+		t.Fatalf("expected a failed alert to stay active with its error, got %+v", sub)
+	}
+	if status(emailed.ID).Status != models.BackInStockActive {
+		t.Fatalf("expected email subscriptions to wait for an email sender")
+	}
+	if status(capped.ID).Status != models.BackInStockActive {
+		t.Fatalf("expected a customer over the daily cap to stay subscribed")
+	}
+	wishlisted := 0
+	for _, subscription := range repo.subscriptions {
+		if subscription.Source == models.BackInStockSourceWishlist {
+			wishlisted++
+			if subscription.UserID == nil || *subscription.UserID != wishlister || subscription.Status != models.BackInStockNotified {
+				t.Fatalf("unexpected wishlist subscription %+v", subscription)
+			}
+		}
+	}
+	if wishlisted != 1 {
+		t.Fatalf("expected one wishlist subscription, got %d", wishlisted)
+	}
+
+	// A second restock retries the failed alert and leaves notified customers alone
+	sender.failing = ""
+	if sent := service.notifyRestock(ctx, &product, nil); sent != 1 {
+		t.Fatalf("expected only the failed alert to be retried, got %d", sent)
+	}
+	if len(sender.pushed) != 2 {
+		t.Fatalf("expected no repeated push alerts, got %v", sender.pushed)
+	}
+	if counted := repo.alerts["phone:919000000002/"+today]; counted != 1 {
+		t.Fatalf("expected the failed alert to count only once it was sent, got %d", counted)
+	}
+}
+
+func TestPurchasesConvertBackInStockAlerts(t *testing.T) {
+	ctx := context.Background()
+	product := models.Product{ID: primitive.NewObjectID(), Name: "Jhumka", StockType: models.StockTypeStocked}
+	other := models.Product{ID: primitive.NewObjectID(), Name: "Bangle", StockType: models.StockTypeStocked}
+	service, repo := newTestBackInStockService(product, other)
+	sender := &recordingAlertSender{}
+	service.SetPushSender(sender)
+	service.SetMessenger(sender)
+
+	userID := primitive.NewObjectID()
+	user, _ := service.Subscribe(ctx, product.ID.Hex(), &models.BackInStockRequest{}, &userID)
+	guest, _ := service.Subscribe(ctx, product.ID.Hex(), &models.BackInStockRequest{Phone: "9000000001"}, nil)
+	later, _ := service.Subscribe(ctx, product.ID.Hex(), &models.BackInStockRequest{Phone: "9000000002"}, nil)
+	service.notifyRestock(ctx, &product, nil)
+
+	// An alert older than the attribution window no longer counts
+	stale := time.Now().Add(-backInStockAttribution - time.Hour)
+	repo.find(later.ID).NotifiedAt = &stale
+
+	service.RecordPurchase(ctx, &models.Order{OrderNumber: "TJ1001", UserID: userID,
+		Items: []models.OrderItem{{ProductID: product.ID}, {ProductID: product.ID}, {ProductID: other.ID}}})
+	service.RecordPurchase(ctx, &models.Order{OrderNumber: "TJ1002", GuestSessionID: "guest-9",
+		ShippingAddress: models.Address{RecipientPhone: "+91 90000 00001"}, Items: []models.OrderItem{{ProductID: product.ID}}})
+	service.RecordPurchase(ctx, &models.Order{OrderNumber: "TJ1003",
+		ShippingAddress: models.Address{RecipientPhone: "9000000002"}, Items: []models.OrderItem{{ProductID: product.ID}}})
+	// A later purchase does not move the conversion to another order
+	service.RecordPurchase(ctx, &models.Order{OrderNumber: "TJ1004", UserID: userID, Items: []models.OrderItem{{ProductID: product.ID}}})
+
+	if sub := repo.find(user.ID); sub.ConvertedAt == nil || sub.ConvertedOrder != "TJ1001" {
+		t.Fatalf("expected the user's alert to convert with TJ1001, got %+v", sub)
+	}
+	if sub := repo.find(guest.ID); sub.ConvertedOrder != "TJ1002" {
+		t.Fatalf("expected the guest's alert to convert by phone, got %+v", sub)
+	}
+	if sub := repo.find(later.ID); sub.ConvertedAt != nil {
+		t.Fatalf("expected a purchase after the attribution window not to convert, got %+v", sub)
+	}
+
+	stats, err := service.GetStats(ctx)
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	if stats.Notified != 3 || stats.Converted != 2 || stats.ConversionRate != 66.67 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestManualRestocksAlertSubscribers(t *testing.T) {
+	ctx := context.Background()
+	chain := models.Product{ID: primitive.NewObjectID(), Name: "Rope Chain", StockType: models.StockTypeStocked, IsAvailable: true}
+	stocked := models.Product{ID: primitive.NewObjectID(), Name: "Bangle", StockType: models.StockTypeStocked, StockQuantity: 2, IsAvailable: true}
+	productRepo := &memoryProductRepository{products: map[primitive.ObjectID]models.Product{chain.ID: chain, stocked.ID: stocked}}
+	stock := NewStockService(&memoryLedgerRepository{products: productRepo})
+	recorder := &restockRecorder{}
+	stock.(*stockService).SetBackInStockService(recorder)
+	stock.(*stockService).SetProductRepository(productRepo)
+	admin := models.OrderActor{Type: models.OrderActorAdmin, ID: "admin-1"}
+
+	// Two rows for the sold-out chain restock it once; the bangle was never out
+	csv := "productId,quantity,reference\n" +
+		chain.ID.Hex() + ",3,\n" +
+		chain.ID.Hex() + ",2,PO-9\n" +
+		stocked.ID.Hex() + ",5,\n"
+	movements, err := stock.ImportStockCSV(ctx, strings.NewReader(csv), "PO-8", admin)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if len(movements) != 3 || movements[0].Reference != "PO-8" || movements[1].Reference != "PO-9" || *movements[1].BalanceAfter != 5 {
+		t.Fatalf("unexpected import entries %+v", movements)
+	}
+	if len(recorder.restocks) != 1 || recorder.restocks[0] != "Rope Chain" {
+		t.Fatalf("expected the chain to be announced once, got %v", recorder.restocks)
+	}
+
+	bad := "productId,quantity\n" + chain.ID.Hex() + ",0\n" + primitive.NewObjectID().Hex() + ",1\n"
+	if _, err := stock.ImportStockCSV(ctx, strings.NewReader(bad), "", admin); !errors.Is(err, ErrInvalidStockAdjustment) || !strings.Contains(err.Error(), "row 3") {
+		t.Fatalf("expected every bad row to be reported, got %v", err)
+	}
+	if productRepo.products[chain.ID].StockQuantity != 5 {
+		t.Fatalf("expected a refused import to change nothing, got %d units", productRepo.products[chain.ID].StockQuantity)
+	}
+
+	// Counting the chain down to nothing and back restocks it again
+	products := NewProductService(productRepo, nil)
+	products.(*productService).SetStockService(stock)
+	for _, quantity := range []int{0, 4, 6} {
+		if err := products.UpdateProductStock(ctx, chain.ID.Hex(), quantity, "Cycle count", admin); err != nil {
+			t.Fatalf("update stock: %v", err)
+		}
+	}
+	if len(recorder.restocks) != 2 {
+		t.Fatalf("expected the recount from zero to be announced, got %v", recorder.restocks)
+	}
+}
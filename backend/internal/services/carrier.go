@@ -0,0 +1,106 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"thyne-jewels-backend/internal/models"
+)
+
+var (
+	// ErrCarrierOperationUnsupported is returned when a carrier cannot perform an operation
+	ErrCarrierOperationUnsupported = errors.New("operation not supported by carrier")
+	// ErrInvalidCarrierSignature is returned when a carrier webhook fails signature verification
+	ErrInvalidCarrierSignature = errors.New("invalid carrier webhook signature")
+)
+
+// Carrier is implemented by each shipping provider. Carriers only talk to the
+// provider; storing shipments and moving orders along is left to ShipmentService.
+type Carrier interface {
+	Code() string
+	Name() string
+	IsEnabled() bool
+	// CreateShipment books a shipment for the order and returns its AWB number
+	CreateShipment(ctx context.Context, req *CarrierShipmentRequest) (*CarrierShipment, error)
+	// GetLabel returns the URL of the shipping label
+	GetLabel(ctx context.Context, shipment *models.OrderTracking) (string, error)
+	// Track returns every tracking event the carrier has for the shipment
+	Track(ctx context.Context, shipment *models.OrderTracking) ([]models.TrackingEvent, error)
+	// Cancel cancels a shipment that has not been picked up
+	Cancel(ctx context.Context, shipment *models.OrderTracking) error
+	// ParseWebhook verifies a tracking webhook and extracts the events it reports
+	ParseWebhook(ctx context.Context, payload []byte, headers http.Header) (*CarrierWebhookEvent, error)
+}
+
+// CarrierShipmentRequest carries what a carrier needs to book a shipment
+type CarrierShipmentRequest struct {
+	Order          *models.Order
+	Service        string
+	Weight         float64 // Grams
+	TrackingNumber string  // AWB number assigned outside the carrier, for manual shipments
+	CourierName    string
+}
+
+// CarrierShipment is the carrier's side of a booked shipment
+type CarrierShipment struct {
+	ShipmentID        string
+	TrackingID        string // AWB number
+	CourierName       string
+	LabelURL          string
+	EstimatedDelivery time.Time
+}
+
+// CarrierWebhookEvent is a verified tracking webhook for one shipment
+type CarrierWebhookEvent struct {
+	TrackingID string
+	Events     []models.TrackingEvent
+}
+
+// CarrierRegistry looks up carriers by code
+type CarrierRegistry struct {
+	carriers map[string]Carrier
+}
+
+// NewCarrierRegistry creates a registry holding the given carriers
+func NewCarrierRegistry(carriers ...Carrier) *CarrierRegistry {
+	registry := &CarrierRegistry{carriers: make(map[string]Carrier)}
+	for _, carrier := range carriers {
+		registry.Register(carrier)
+	}
+	return registry
+}
+
+// Register adds a carrier, replacing any carrier registered with the same code
+func (r *CarrierRegistry) Register(carrier Carrier) {
+	r.carriers[carrier.Code()] = carrier
+}
+
+// Get returns the enabled carrier with the given code
+func (r *CarrierRegistry) Get(code string) (Carrier, error) {
+	carrier, ok := r.carriers[code]
+	if !ok {
+		return nil, fmt.Errorf("unknown carrier: %s", code)
+	}
+	if !carrier.IsEnabled() {
+		return nil, fmt.Errorf("%s is not configured", carrier.Name())
+	}
+	return carrier, nil
+}
+
+// List describes every registered carrier, sorted by code
+func (r *CarrierRegistry) List() []models.CarrierInfo {
+	infos := make([]models.CarrierInfo, 0, len(r.carriers))
+	for code, carrier := range r.carriers {
+		infos = append(infos, models.CarrierInfo{
+			Code:    code,
+			Name:    carrier.Name(),
+			Enabled: carrier.IsEnabled(),
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Code < infos[j].Code })
+	return infos
+}
@@ -3,6 +3,8 @@ package services
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -10,13 +12,17 @@ import (
 	"thyne-jewels-backend/internal/repository"
 )
 
+// ErrInvalidCoupon is returned for a coupon code that is unknown, expired or does not apply to the order
+var ErrInvalidCoupon = errors.New("coupon does not apply")
+
 type CartService interface {
 	GetCart(userID string, guestSessionID string) (*models.Cart, error)
-	AddToCart(userID string, guestSessionID string, productID string, quantity int) error
-	UpdateCartItem(userID string, guestSessionID string, productID string, quantity int) error
-	RemoveFromCart(userID string, guestSessionID string, productID string) error
-	ApplyCoupon(userID string, guestSessionID string, couponCode string) error
-	RemoveCoupon(userID string, guestSessionID string) error
+	AddToCart(userID string, guestSessionID string, productID string, variantID string, quantity int, customization *models.ProductCustomization) (*models.Cart, error)
+	UpdateCartItem(userID string, guestSessionID string, itemID string, quantity int) (*models.Cart, error)
+	RemoveFromCart(userID string, guestSessionID string, itemID string) (*models.Cart, error)
+	QuoteShipping(userID string, guestSessionID string, pincode string) (*models.Cart, error)
+	ApplyCoupon(userID string, guestSessionID string, couponCode string) (*models.Cart, error)
+	RemoveCoupon(userID string, guestSessionID string) (*models.Cart, error)
 	ClearCart(userID string, guestSessionID string) error
 	ProcessAbandonedCarts() error
 }
@@ -25,14 +31,17 @@ type cartService struct {
 	cartRepo           repository.CartRepository
 	productRepo        repository.ProductRepository
 	couponRepo         repository.CouponRepository
+	storefrontRepo     *repository.StorefrontDataRepository
+	pricingService     PricingService
 	notificationService *NotificationService
 }
 
 func NewCartService(cartRepo repository.CartRepository, productRepo repository.ProductRepository, couponRepo repository.CouponRepository) CartService {
 	return &cartService{
-		cartRepo:    cartRepo,
-		productRepo: productRepo,
-		couponRepo:  couponRepo,
+		cartRepo:       cartRepo,
+		productRepo:    productRepo,
+		couponRepo:     couponRepo,
+		pricingService: NewPricingService(nil),
 	}
 }
 
@@ -40,45 +49,218 @@ func (s *cartService) SetNotificationService(notificationService *NotificationSe
 	s.notificationService = notificationService
 }
 
+// SetStorefrontRepo enables GST, shipping and COD settings in cart summaries
+func (s *cartService) SetStorefrontRepo(storefrontRepo *repository.StorefrontDataRepository) {
+	s.storefrontRepo = storefrontRepo
+}
+
+// SetPricingService sets the pricing service used to price cart lines
+func (s *cartService) SetPricingService(pricingService PricingService) {
+	s.pricingService = pricingService
+}
+
+// QuoteShipping returns the cart with its summary priced for delivery to pincode
+func (s *cartService) QuoteShipping(userID string, guestSessionID string, pincode string) (*models.Cart, error) {
+	ctx := context.Background()
+
+	if !validPincode(pincode) {
+		return nil, errors.New("pincode must be 6 digits")
+	}
+
+	cart, err := s.loadCart(ctx, userID, guestSessionID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.summarize(ctx, cart, pincode); err != nil {
+		return nil, err
+	}
+	return cart, nil
+}
+
+// GetCart returns the cart with a computed summary. A missing cart is returned empty.
 func (s *cartService) GetCart(userID string, guestSessionID string) (*models.Cart, error) {
 	ctx := context.Background()
-	
-	if userID != "" {
-		userObjID, err := primitive.ObjectIDFromHex(userID)
+
+	cart, err := s.loadCart(ctx, userID, guestSessionID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.summarize(ctx, cart, ""); err != nil {
+		return nil, err
+	}
+	return cart, nil
+}
+
+// AddToCart adds units of a product to the cart. Products sold by variant
+// need a variantId, or a customization that picks one variant's options.
+func (s *cartService) AddToCart(userID string, guestSessionID string, productID string, variantID string, quantity int, customization *models.ProductCustomization) (*models.Cart, error) {
+	ctx := context.Background()
+
+	if quantity < 1 {
+		return nil, errors.New("quantity must be at least 1")
+	}
+
+	productObjID, err := primitive.ObjectIDFromHex(productID)
+	if err != nil {
+		return nil, errors.New("invalid product ID")
+	}
+
+	product, err := s.productRepo.GetByID(ctx, productObjID)
+	if err != nil {
+		return nil, errors.New("product not found")
+	}
+	if !product.IsAvailable {
+		return nil, fmt.Errorf("%s is not available", product.Name)
+	}
+
+	var variantObjID *primitive.ObjectID
+	if variantID != "" {
+		objID, err := primitive.ObjectIDFromHex(variantID)
 		if err != nil {
-			return nil, errors.New("invalid user ID")
+			return nil, errors.New("invalid variant ID")
 		}
-		return s.cartRepo.GetByUserID(ctx, userObjID)
-	} else if guestSessionID != "" {
-		return s.cartRepo.GetByGuestSessionID(ctx, guestSessionID)
+		variantObjID = &objID
+	}
+	variant, customization, err := resolveVariant(product, variantObjID, customization)
+	if err != nil {
+		return nil, err
+	}
+	if err := product.ValidateCustomization(customization); err != nil {
+		return nil, err
 	}
-	
-	return nil, errors.New("either user ID or guest session ID is required")
-}
 
-func (s *cartService) AddToCart(userID string, guestSessionID string, productID string, quantity int) error {
-	// Placeholder implementation
-	return nil
+	cart, err := s.loadCart(ctx, userID, guestSessionID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if variant != nil {
+		err = checkVariantStock(product, variant, cart.VariantQuantity(variant.ID)+quantity)
+	} else {
+		err = checkStock(product, cart.ProductQuantity(productObjID)+quantity)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	item := cart.AddItem(productObjID, customization, quantity)
+	if item.Quantity > models.MaxCartLineQuantity {
+		return nil, fmt.Errorf("a maximum of %d units can be added per item", models.MaxCartLineQuantity)
+	}
+	if variant != nil {
+		id := variant.ID
+		item.VariantID = &id
+	}
+
+	return s.saveCart(ctx, cart)
 }
 
-func (s *cartService) UpdateCartItem(userID string, guestSessionID string, productID string, quantity int) error {
-	// Placeholder implementation
-	return nil
+func (s *cartService) UpdateCartItem(userID string, guestSessionID string, itemID string, quantity int) (*models.Cart, error) {
+	ctx := context.Background()
+
+	if quantity > models.MaxCartLineQuantity {
+		return nil, fmt.Errorf("a maximum of %d units can be added per item", models.MaxCartLineQuantity)
+	}
+
+	cart, err := s.loadCart(ctx, userID, guestSessionID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	item := cart.FindItem(itemID)
+	if item == nil {
+		return nil, errors.New("item not found in cart")
+	}
+
+	if quantity > 0 {
+		product, err := s.productRepo.GetByID(ctx, item.ProductID)
+		if err != nil {
+			return nil, errors.New("product not found")
+		}
+		if !product.IsAvailable {
+			return nil, fmt.Errorf("%s is not available", product.Name)
+		}
+		if item.VariantID != nil {
+			variant := product.FindVariant(*item.VariantID)
+			if variant == nil {
+				return nil, errors.New("this option is no longer available")
+			}
+			err = checkVariantStock(product, variant, cart.VariantQuantity(variant.ID)-item.Quantity+quantity)
+		} else {
+			err = checkStock(product, cart.ProductQuantity(item.ProductID)-item.Quantity+quantity)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cart.UpdateItemQuantity(item.ItemID, quantity)
+	return s.saveCart(ctx, cart)
 }
 
-func (s *cartService) RemoveFromCart(userID string, guestSessionID string, productID string) error {
-	// Placeholder implementation
-	return nil
+func (s *cartService) RemoveFromCart(userID string, guestSessionID string, itemID string) (*models.Cart, error) {
+	ctx := context.Background()
+
+	cart, err := s.loadCart(ctx, userID, guestSessionID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	item := cart.FindItem(itemID)
+	if item == nil {
+		return nil, errors.New("item not found in cart")
+	}
+
+	cart.RemoveItem(item.ItemID)
+	return s.saveCart(ctx, cart)
 }
 
-func (s *cartService) ApplyCoupon(userID string, guestSessionID string, couponCode string) error {
-	// Placeholder implementation
-	return nil
+func (s *cartService) ApplyCoupon(userID string, guestSessionID string, couponCode string) (*models.Cart, error) {
+	ctx := context.Background()
+
+	coupon, err := s.couponRepo.GetByCode(ctx, strings.TrimSpace(couponCode))
+	if err != nil {
+		return nil, errors.New("invalid coupon code")
+	}
+	if !coupon.IsValid() {
+		return nil, errors.New("coupon has expired or is no longer valid")
+	}
+
+	cart, err := s.loadCart(ctx, userID, guestSessionID, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(cart.Items) == 0 {
+		return nil, errors.New("cart is empty")
+	}
+
+	subtotal, err := s.priceLines(ctx, cart)
+	if err != nil {
+		return nil, err
+	}
+	if !coupon.CanApply(subtotal.total) {
+		if coupon.MinAmount != nil && subtotal.total < *coupon.MinAmount {
+			return nil, fmt.Errorf("coupon requires a minimum order of %.2f", *coupon.MinAmount)
+		}
+		return nil, errors.New("coupon cannot be applied to this cart")
+	}
+
+	cart.ApplyCoupon(coupon, subtotal.total)
+	return s.saveCart(ctx, cart)
 }
 
-func (s *cartService) RemoveCoupon(userID string, guestSessionID string) error {
-	// Placeholder implementation
-	return nil
+func (s *cartService) RemoveCoupon(userID string, guestSessionID string) (*models.Cart, error) {
+	ctx := context.Background()
+
+	cart, err := s.loadCart(ctx, userID, guestSessionID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	cart.RemoveCoupon()
+	return s.saveCart(ctx, cart)
 }
 
 func (s *cartService) ClearCart(userID string, guestSessionID string) error {
@@ -113,7 +295,10 @@ func (s *cartService) ProcessAbandonedCarts() error {
 		for _, cart := range abandonedCarts {
             if !cart.UserID.IsZero() {
                 itemCount := cart.GetItemCount()
-                totalAmount := cart.GetSubtotal()
+                totalAmount := 0.0
+                if err := s.summarize(ctx, &cart, ""); err == nil {
+                    totalAmount = cart.Summary.Total
+                }
                 
                 if itemCount > 0 && totalAmount > 0 {
                     userID := cart.UserID
@@ -129,3 +314,266 @@ func (s *cartService) ProcessAbandonedCarts() error {
 	
 	return nil
 }
+
+// loadCart finds the cart for the user or guest. When create is true a missing
+// cart is created; otherwise an unsaved empty cart is returned.
+func (s *cartService) loadCart(ctx context.Context, userID string, guestSessionID string, create bool) (*models.Cart, error) {
+	var cart *models.Cart
+	var err error
+	var userObjID primitive.ObjectID
+
+	if userID != "" {
+		userObjID, err = primitive.ObjectIDFromHex(userID)
+		if err != nil {
+			return nil, errors.New("invalid user ID")
+		}
+		cart, err = s.cartRepo.GetByUserID(ctx, userObjID)
+	} else if guestSessionID != "" {
+		cart, err = s.cartRepo.GetByGuestSessionID(ctx, guestSessionID)
+	} else {
+		return nil, errors.New("either user ID or guest session ID is required")
+	}
+
+	if err == nil {
+		cart.EnsureItemIDs()
+		return cart, nil
+	}
+	if !errors.Is(err, repository.ErrCartNotFound) {
+		return nil, err
+	}
+
+	cart = &models.Cart{
+		Items: []models.CartItem{},
+	}
+	if userID != "" {
+		cart.UserID = userObjID
+	} else {
+		cart.GuestSessionID = guestSessionID
+	}
+
+	if create {
+		cart.ID = primitive.NewObjectID()
+		if err := s.cartRepo.Create(ctx, cart); err != nil {
+			return nil, fmt.Errorf("failed to create cart: %w", err)
+		}
+	}
+
+	return cart, nil
+}
+
+// saveCart persists the cart and returns it with a fresh summary
+func (s *cartService) saveCart(ctx context.Context, cart *models.Cart) (*models.Cart, error) {
+	if err := s.summarize(ctx, cart, ""); err != nil {
+		return nil, err
+	}
+	cart.Discount = cart.Summary.Discount
+
+	if cart.ID.IsZero() {
+		cart.ID = primitive.NewObjectID()
+		if err := s.cartRepo.Create(ctx, cart); err != nil {
+			return nil, fmt.Errorf("failed to create cart: %w", err)
+		}
+		return cart, nil
+	}
+
+	if err := s.cartRepo.Update(ctx, cart); err != nil {
+		return nil, fmt.Errorf("failed to update cart: %w", err)
+	}
+	return cart, nil
+}
+
+// pricedLines holds the priced lines of a cart and the subtotal of the available ones
+type pricedLines struct {
+	lines   []models.CartLine
+	taxable []models.TaxableLine // Available lines, for GST
+	total   float64
+	count   int
+	weight  float64 // Grams, of the available lines
+}
+
+// priceLines prices every cart line from the catalogue. Lines whose product is
+// unavailable or short of stock are flagged and left out of the subtotal.
+func (s *cartService) priceLines(ctx context.Context, cart *models.Cart) (*pricedLines, error) {
+	result := &pricedLines{lines: []models.CartLine{}}
+
+	for _, item := range cart.Items {
+		line := models.CartLine{
+			ItemID:        item.ItemID,
+			ProductID:     item.ProductID,
+			VariantID:     item.VariantID,
+			Quantity:      item.Quantity,
+			Customization: item.Customization,
+		}
+
+		product, err := s.productRepo.GetByID(ctx, item.ProductID)
+		if err != nil {
+			line.Message = "This product is no longer available"
+			result.lines = append(result.lines, line)
+			continue
+		}
+
+		line.Name = product.Name
+		if len(product.Images) > 0 {
+			line.Image = product.Images[0]
+		}
+
+		var variant *models.ProductVariant
+		if item.VariantID != nil {
+			if variant = product.FindVariant(*item.VariantID); variant == nil {
+				line.Message = "This option is no longer available"
+				result.lines = append(result.lines, line)
+				continue
+			}
+			line.SKU = variant.SKU
+		}
+
+		price, err := s.pricingService.PriceProduct(ctx, product, item.Customization)
+		if err != nil {
+			line.Message = err.Error()
+			result.lines = append(result.lines, line)
+			continue
+		}
+
+		line.UnitPrice = price.UnitPrice
+		line.OriginalPrice = price.OriginalPrice
+		line.DiscountPercent = price.DiscountPercent
+		line.PriceSource = price.Source
+		line.LineTotal = roundPrice(price.UnitPrice * float64(item.Quantity))
+
+		var stockErr error
+		if variant != nil {
+			stockErr = checkVariantStock(product, variant, cart.VariantQuantity(variant.ID))
+		} else {
+			stockErr = checkStock(product, cart.ProductQuantity(item.ProductID))
+		}
+
+		if !product.IsAvailable {
+			line.Message = "This product is no longer available"
+		} else if stockErr != nil {
+			line.Message = stockErr.Error()
+		} else {
+			line.IsAvailable = true
+			result.total += line.LineTotal
+			result.weight += parcelWeight(product, item.Quantity)
+			result.taxable = append(result.taxable, models.TaxableLine{
+				LineIndex:    len(result.lines),
+				ProductID:    product.ID,
+				Name:         product.Name,
+				Category:     product.Category,
+				Quantity:     item.Quantity,
+				UnitPrice:    price.UnitPrice,
+				MakingCharge: price.MakingCharge,
+			})
+			result.count += item.Quantity
+		}
+
+		result.lines = append(result.lines, line)
+	}
+
+	result.total = roundPrice(result.total)
+	return result, nil
+}
+
+// summarize computes the cart summary from server prices, the applied coupon and store settings.
+// Shipping is quoted to pincode, or at the standard rate when it is empty.
+func (s *cartService) summarize(ctx context.Context, cart *models.Cart, pincode string) error {
+	priced, err := s.priceLines(ctx, cart)
+	if err != nil {
+		return err
+	}
+
+	summary := &models.CartSummary{
+		Subtotal:   priced.total,
+		ItemCount:  priced.count,
+		CouponCode: cart.CouponCode,
+		Lines:      priced.lines,
+	}
+	for _, line := range priced.lines {
+		if !line.IsAvailable && line.Message != "" {
+			summary.Messages = append(summary.Messages, line.Name+": "+line.Message)
+		}
+	}
+
+	if cart.CouponCode != nil {
+		_, discount, err := couponDiscount(ctx, s.couponRepo, *cart.CouponCode, summary.Subtotal)
+		if err != nil {
+			summary.Messages = append(summary.Messages, "Coupon "+*cart.CouponCode+" no longer applies to this cart")
+			summary.CouponCode = nil
+		} else {
+			summary.Discount = discount
+		}
+	}
+
+	settings := models.DefaultStoreSettings()
+	if s.storefrontRepo != nil {
+		stored, err := s.storefrontRepo.GetStoreSettings(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to load store settings: %w", err)
+		}
+		settings = stored
+	}
+	applyStoreCharges(settings, summary, priced, pincode)
+
+	cart.Summary = summary
+	return nil
+}
+
+// couponDiscount looks up a coupon and returns the discount it gives on subtotal.
+// Carts and orders both price coupons through it so their totals agree.
+func couponDiscount(ctx context.Context, couponRepo repository.CouponRepository, code string, subtotal float64) (*models.Coupon, float64, error) {
+	if couponRepo == nil {
+		return nil, 0, fmt.Errorf("%w: %s", ErrInvalidCoupon, code)
+	}
+	coupon, err := couponRepo.GetByCode(ctx, code)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %s", ErrInvalidCoupon, code)
+	}
+	if !coupon.CanApply(subtotal) {
+		return nil, 0, fmt.Errorf("%w: %s cannot be applied to this order", ErrInvalidCoupon, code)
+	}
+	return coupon, roundPrice(coupon.CalculateDiscount(subtotal)), nil
+}
+
+// applyStoreCharges fills GST, shipping and COD figures on a summary from store settings.
+// The shipping state is not known yet, so GST is estimated as an intra-state supply.
+func applyStoreCharges(settings *models.StoreSettings, summary *models.CartSummary, priced *pricedLines, pincode string) {
+	taxable := summary.Subtotal - summary.Discount
+	if taxable < 0 {
+		taxable = 0
+	}
+
+	if settings.EnableGST {
+		summary.TaxBreakdown = calculateGST(settings, priced.taxable, summary.Discount, "")
+		summary.Tax = summary.TaxBreakdown.Total
+		if summary.TaxBreakdown.TaxableValue > 0 {
+			summary.GSTRate = roundPrice(summary.Tax / summary.TaxBreakdown.TaxableValue * 100)
+		}
+	}
+
+	if summary.ItemCount > 0 {
+		quote := quoteShipping(settings, pincode, models.Parcel{Weight: priced.weight, Value: taxable, Tax: summary.Tax})
+		summary.ShippingQuote = quote
+		summary.Shipping = quote.Shipping
+		summary.CODAvailable = quote.CODAvailable
+		summary.CODCharge = quote.CODCharge
+		if !quote.Serviceable {
+			summary.Messages = append(summary.Messages, quote.Message)
+		}
+	}
+
+	summary.Total = roundPrice(taxable + summary.Tax + summary.Shipping)
+}
+
+// checkStock returns an error if a stocked product cannot supply the requested units
+func checkStock(product *models.Product, quantity int) error {
+	if product.StockType == models.StockTypeMadeToOrder {
+		return nil
+	}
+	if product.StockQuantity <= 0 {
+		return fmt.Errorf("%s is out of stock", product.Name)
+	}
+	if quantity > product.StockQuantity {
+		return fmt.Errorf("only %d of %s left in stock", product.StockQuantity, product.Name)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"thyne-jewels-backend/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCartLinesStockAndSummary(t *testing.T) {
+	now := time.Now()
+	minAmount := 20000.0
+	maxDiscount := 2500.0
+	coupons := &memoryCouponRepository{coupons: map[string]*models.Coupon{
+		"SPARKLE10": {ID: primitive.NewObjectID(), Code: "SPARKLE10", Type: "percentage", Value: 10, MinAmount: &minAmount, MaxDiscount: &maxDiscount,
+			IsActive: true, ValidFrom: now.Add(-time.Hour), ValidUntil: now.Add(time.Hour)},
+	}}
+	ring := models.Product{
+		ID:                  primitive.NewObjectID(),
+		Name:                "Solitaire Ring",
+		Category:            "Rings",
+		Price:               10000,
+		IsAvailable:         true,
+		StockQuantity:       3,
+		AvailableMetals:     []string{"14K Gold", "18K Gold"},
+		MetalPriceModifiers: map[string]float64{"18K Gold": 4000},
+	}
+	products := &memoryProductRepository{products: map[primitive.ObjectID]models.Product{ring.ID: ring}}
+	cartRepo := &memoryCartRepository{carts: map[string]models.Cart{}}
+	carts := NewCartService(cartRepo, products, coupons)
+
+	// The same ring in another metal is a line of its own; the same metal adds to its line
+	for _, metal := range []string{"14K Gold", "18K Gold", "14K Gold"} {
+		if _, err := carts.AddToCart("", "guest-1", ring.ID.Hex(), "", 1, &models.ProductCustomization{Metal: metal}); err != nil {
+			t.Fatalf("add %s: %v", metal, err)
+		}
+	}
+	cart, err := carts.GetCart("", "guest-1")
+	if err != nil {
+		t.Fatalf("get cart: %v", err)
+	}
+	if len(cart.Items) != 2 || cart.Items[0].Quantity != 2 || cart.Items[1].Quantity != 1 {
+		t.Fatalf("expected a line per metal, got %+v", cart.Items)
+	}
+	if lines := cart.Summary.Lines; lines[0].UnitPrice != 10000 || lines[1].UnitPrice != 14000 || lines[0].LineTotal != 20000 {
+		t.Fatalf("unexpected line prices %+v", lines)
+	}
+	gold14, gold18 := cart.Items[0].ItemID, cart.Items[1].ItemID
+
+	// Quantities are limited to the stock of the product across its lines
+	if _, err := carts.AddToCart("", "guest-1", ring.ID.Hex(), "", 1, &models.ProductCustomization{Metal: "18K Gold"}); err == nil || !strings.Contains(err.Error(), "only 3 of Solitaire Ring left") {
+		t.Fatalf("expected units beyond stock to be refused, got %v", err)
+	}
+	if _, err := carts.UpdateCartItem("", "guest-1", gold18, 2); err == nil {
+		t.Fatal("expected an update beyond stock to be refused")
+	}
+	if stored := cartRepo.carts["guest-1"]; stored.ProductQuantity(ring.ID) != 3 {
+		t.Fatalf("expected a refused change to leave the cart alone, got %d units", stored.ProductQuantity(ring.ID))
+	}
+
+	// The coupon is taken off the subtotal, capped at its maximum discount
+	cart, err = carts.ApplyCoupon("", "guest-1", "SPARKLE10")
+	if err != nil {
+		t.Fatalf("apply coupon: %v", err)
+	}
+	summary := cart.Summary
+	if summary.Subtotal != 34000 || summary.Discount != 2500 || summary.ItemCount != 3 || cart.Discount != 2500 {
+		t.Fatalf("unexpected summary %+v", summary)
+	}
+	if summary.Tax <= 0 || summary.Total != roundPrice(summary.Subtotal-summary.Discount+summary.Tax+summary.Shipping) {
+		t.Fatalf("expected the total to add up, got %+v", summary)
+	}
+
+	// When stock drops below the cart's units, its lines are flagged and left out
+	ring.StockQuantity = 2
+	products.products[ring.ID] = ring
+	cart, err = carts.GetCart("", "guest-1")
+	if err != nil {
+		t.Fatalf("get cart: %v", err)
+	}
+	if summary := cart.Summary; summary.Subtotal != 0 || summary.ItemCount != 0 || summary.Lines[0].IsAvailable || summary.CouponCode != nil || len(summary.Messages) != 3 {
+		t.Fatalf("expected the lines short of stock to be left out with the coupon, got %+v", summary)
+	}
+
+	// Removing a line brings the rest back within stock, and the coupon applies again
+	cart, err = carts.RemoveFromCart("", "guest-1", gold18)
+	if err != nil {
+		t.Fatalf("remove from cart: %v", err)
+	}
+	if summary := cart.Summary; len(cart.Items) != 1 || cart.Items[0].ItemID != gold14 || summary.Subtotal != 20000 || summary.Discount != 2000 {
+		t.Fatalf("unexpected summary after removing a line %+v", summary)
+	}
+
+	// A coupon the cart falls below is refused, and removing it clears the discount
+	if _, err := carts.UpdateCartItem("", "guest-1", gold14, 1); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if _, err := carts.ApplyCoupon("", "guest-1", "SPARKLE10"); err == nil || !strings.Contains(err.Error(), "minimum order") {
+		t.Fatalf("expected a coupon below its minimum order to be refused, got %v", err)
+	}
+	cart, err = carts.RemoveCoupon("", "guest-1")
+	if err != nil || cart.CouponCode != nil || cart.Summary.Discount != 0 || cart.Summary.Subtotal != 10000 {
+		t.Fatalf("expected the coupon to be removed, got %+v (%v)", cart.Summary, err)
+	}
+}
@@ -0,0 +1,236 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"thyne-jewels-backend/internal/models"
+)
+
+// CashfreeGateway adapts CashfreeService to the PaymentGateway interface. Each
+// attempt is created as its own Cashfree order, keyed by the attempt reference.
+type CashfreeGateway struct {
+	service *CashfreeService
+}
+
+// NewCashfreeGateway creates a new Cashfree gateway
+func NewCashfreeGateway(service *CashfreeService) *CashfreeGateway {
+	return &CashfreeGateway{service: service}
+}
+
+func (g *CashfreeGateway) Method() models.PaymentMethod {
+	return models.PaymentMethodCashfree
+}
+
+func (g *CashfreeGateway) Name() string {
+	return "Cashfree"
+}
+
+func (g *CashfreeGateway) IsEnabled() bool {
+	return g.service != nil && g.service.IsEnabled()
+}
+
+// CreatePayment creates a Cashfree order and returns its payment session
+func (g *CashfreeGateway) CreatePayment(ctx context.Context, req *GatewayPaymentRequest) (*GatewayPayment, error) {
+	customer, err := g.customerDetails(req)
+	if err != nil {
+		return nil, err
+	}
+
+	cashfreeReq := &CashfreeOrderRequest{
+		OrderID:         req.Reference,
+		OrderAmount:     req.Amount,
+		OrderCurrency:   req.Currency,
+		CustomerDetails: customer,
+		OrderNote:       req.Order.OrderNumber,
+		OrderTags:       map[string]string{"order_id": req.Order.ID.Hex()},
+	}
+	if req.ReturnURL != "" || req.NotifyURL != "" {
+		cashfreeReq.OrderMeta = &CashfreeOrderMeta{
+			ReturnURL: req.ReturnURL,
+			NotifyURL: req.NotifyURL,
+		}
+	}
+
+	orderResp, err := g.service.CreateOrder(ctx, cashfreeReq)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GatewayPayment{
+		ProviderOrderID: orderResp.OrderID,
+		SessionID:       orderResp.PaymentSessionID,
+		Checkout: map[string]interface{}{
+			"cfOrderId":        orderResp.CFOrderID,
+			"orderId":          orderResp.OrderID,
+			"orderStatus":      orderResp.OrderStatus,
+			"paymentSessionId": orderResp.PaymentSessionID,
+			"environment":      g.service.GetEnvironment(),
+		},
+	}, nil
+}
+
+// CreatePaymentLink creates a Cashfree payment link keyed by the attempt reference
+func (g *CashfreeGateway) CreatePaymentLink(ctx context.Context, req *GatewayPaymentRequest) (*GatewayPayment, error) {
+	customer, err := g.customerDetails(req)
+	if err != nil {
+		return nil, err
+	}
+
+	linkURL, err := g.service.CreatePaymentLink(ctx, req.Reference, req.Amount, customer.CustomerPhone, customer.CustomerEmail, customer.CustomerName, req.Purpose, req.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GatewayPayment{ProviderOrderID: req.Reference, LinkURL: linkURL}, nil
+}
+
+// VerifyPayment has no client-side proof with Cashfree, so it asks Cashfree for the order status
+func (g *CashfreeGateway) VerifyPayment(ctx context.Context, attempt *models.PaymentAttempt, params map[string]string) (*GatewayPaymentStatus, error) {
+	return g.GetPaymentStatus(ctx, attempt)
+}
+
+// GetPaymentStatus reads the Cashfree order and its payments
+func (g *CashfreeGateway) GetPaymentStatus(ctx context.Context, attempt *models.PaymentAttempt) (*GatewayPaymentStatus, error) {
+	orderResp, err := g.service.GetOrder(ctx, attempt.ProviderOrderID)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &GatewayPaymentStatus{
+		ProviderOrderID: orderResp.OrderID,
+		Amount:          orderResp.OrderAmount,
+	}
+	switch strings.ToUpper(orderResp.OrderStatus) {
+	case "PAID":
+		status.Status = models.PaymentAttemptPaid
+	case "EXPIRED", "TERMINATED":
+		status.Status = models.PaymentAttemptFailed
+		status.FailureReason = "Cashfree order " + strings.ToLower(orderResp.OrderStatus)
+		return status, nil
+	default:
+		status.Status = models.PaymentAttemptCreated
+	}
+
+	payments, err := g.service.GetPaymentsForOrder(ctx, attempt.ProviderOrderID)
+	if err != nil {
+		fmt.Printf("Warning: failed to get Cashfree payments for %s: %v\n", attempt.ProviderOrderID, err)
+		return status, nil
+	}
+	for _, payment := range payments {
+		if g.service.IsPaymentSuccessful(payment.PaymentStatus) {
+			status.ProviderPaymentID = fmt.Sprintf("%v", payment.CFPaymentID)
+			status.Amount = payment.PaymentAmount
+			break
+		}
+	}
+
+	return status, nil
+}
+
+// ParseWebhook verifies the x-webhook-signature header and maps payment events
+func (g *CashfreeGateway) ParseWebhook(ctx context.Context, payload []byte, headers http.Header) (*GatewayWebhookEvent, error) {
+	if !g.service.VerifyWebhookSignature(payload, headers.Get("x-webhook-timestamp"), headers.Get("x-webhook-signature")) {
+		return nil, ErrInvalidPaymentSignature
+	}
+
+	webhookData, err := g.service.ParseWebhookPayload(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &GatewayWebhookEvent{
+		EventID: headers.Get("x-idempotency-key"),
+		Type:    webhookData.Type,
+		OrderID: webhookData.Data.Order.OrderTags["order_id"],
+	}
+	if refund := webhookData.Data.Refund; refund != nil {
+		result.Refund = &GatewayRefund{
+			RefundID:         refund.RefundID,
+			ProviderRefundID: fmt.Sprintf("%v", refund.CFRefundID),
+			ProviderOrderID:  refund.OrderID,
+			Amount:           refund.RefundAmount,
+		}
+		switch strings.ToUpper(refund.RefundStatus) {
+		case "SUCCESS":
+			result.Refund.Status = models.RefundStatusProcessed
+		case "CANCELLED":
+			result.Refund.Status = models.RefundStatusFailed
+			result.Refund.FailureReason = refund.StatusDescription
+		default:
+			result.Refund.Status = models.RefundStatusInitiated
+		}
+		return result, nil
+	}
+
+	status := &GatewayPaymentStatus{
+		ProviderOrderID:   webhookData.Data.Order.OrderID,
+		ProviderPaymentID: fmt.Sprintf("%v", webhookData.Data.Payment.CFPaymentID),
+		Amount:            webhookData.Data.Payment.PaymentAmount,
+	}
+	switch webhookData.Type {
+	case "PAYMENT_SUCCESS_WEBHOOK":
+		status.Status = models.PaymentAttemptPaid
+	case "PAYMENT_FAILED_WEBHOOK":
+		status.Status = models.PaymentAttemptFailed
+		status.FailureReason = "Payment failed"
+	case "PAYMENT_USER_DROPPED_WEBHOOK":
+		status.Status = models.PaymentAttemptFailed
+		status.FailureReason = "Payment cancelled by user"
+	default:
+		return result, nil
+	}
+
+	result.Payment = status
+	return result, nil
+}
+
+// Refund refunds the Cashfree order of the attempt. Cashfree processes refunds
+// asynchronously, so the refund is reported as initiated until its webhook arrives.
+func (g *CashfreeGateway) Refund(ctx context.Context, attempt *models.PaymentAttempt, req *GatewayRefundRequest) (*GatewayRefund, error) {
+	if err := g.service.RefundPayment(ctx, attempt.ProviderOrderID, req.RefundID, req.Amount, req.Reason); err != nil {
+		return nil, err
+	}
+
+	return &GatewayRefund{
+		RefundID:        req.RefundID,
+		ProviderOrderID: attempt.ProviderOrderID,
+		Status:          models.RefundStatusInitiated,
+		Amount:          req.Amount,
+	}, nil
+}
+
+// CancelPayment terminates the attempt's Cashfree order, or cancels its payment link
+func (g *CashfreeGateway) CancelPayment(ctx context.Context, attempt *models.PaymentAttempt) error {
+	if attempt.LinkURL != "" {
+		return g.service.CancelPaymentLink(ctx, attempt.ProviderOrderID)
+	}
+	return g.service.TerminateOrder(ctx, attempt.ProviderOrderID)
+}
+
+// customerDetails fills in Cashfree's required customer fields, falling back to the shipping address
+func (g *CashfreeGateway) customerDetails(req *GatewayPaymentRequest) (CashfreeCustomerDetails, error) {
+	customer := CashfreeCustomerDetails{
+		CustomerID:    req.CustomerID,
+		CustomerPhone: req.CustomerPhone,
+		CustomerEmail: req.CustomerEmail,
+		CustomerName:  req.CustomerName,
+	}
+	if customer.CustomerID == "" {
+		customer.CustomerID = "guest_" + req.Order.ID.Hex()
+	}
+	if customer.CustomerPhone == "" {
+		customer.CustomerPhone = req.Order.ShippingAddress.RecipientPhone
+	}
+	if customer.CustomerName == "" {
+		customer.CustomerName = req.Order.ShippingAddress.RecipientName
+	}
+	if customer.CustomerPhone == "" {
+		return customer, errors.New("customer phone is required for Cashfree payments")
+	}
+
+	return customer, nil
+}
@@ -66,6 +66,7 @@ type CashfreeOrderResponse struct {
 	PaymentSessionID string      `json:"payment_session_id"`
 	OrderExpiryTime  string      `json:"order_expiry_time,omitempty"`
 	OrderNote        string      `json:"order_note,omitempty"`
+	OrderTags        map[string]string `json:"order_tags,omitempty"`
 	CreatedAt        string      `json:"created_at,omitempty"`
 }
 
@@ -93,6 +94,17 @@ type CashfreeWebhookPayload struct {
 type CashfreeWebhookData struct {
 	Order   CashfreeOrderResponse   `json:"order"`
 	Payment CashfreePaymentResponse `json:"payment"`
+	Refund  *CashfreeRefundResponse `json:"refund,omitempty"`
+}
+
+// CashfreeRefundResponse represents refund details
+type CashfreeRefundResponse struct {
+	CFRefundID        interface{} `json:"cf_refund_id"` // Can be string or int64 depending on environment
+	RefundID          string      `json:"refund_id"`
+	OrderID           string      `json:"order_id"`
+	RefundAmount      float64     `json:"refund_amount"`
+	RefundStatus      string      `json:"refund_status"` // SUCCESS, PENDING, CANCELLED or ONHOLD
+	StatusDescription string      `json:"status_description,omitempty"`
 }
 
 // CashfreeError represents an API error
@@ -436,3 +448,49 @@ func (s *CashfreeService) RefundPayment(ctx context.Context, orderID string, ref
 
 	return nil
 }
+
+// TerminateOrder closes an unpaid order so it can no longer be paid
+func (s *CashfreeService) TerminateOrder(ctx context.Context, orderID string) error {
+	return s.send(ctx, "PATCH", "/orders/"+orderID, map[string]interface{}{"order_status": "TERMINATED"})
+}
+
+// CancelPaymentLink cancels an unpaid payment link
+func (s *CashfreeService) CancelPaymentLink(ctx context.Context, linkID string) error {
+	return s.send(ctx, "POST", "/links/"+linkID+"/cancel", nil)
+}
+
+// send makes an API call whose response body is not needed
+func (s *CashfreeService) send(ctx context.Context, method, path string, payload interface{}) error {
+	if !s.IsEnabled() {
+		return errors.New("Cashfree service is not configured")
+	}
+
+	var reqBody io.Reader
+	if payload != nil {
+		jsonData, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		reqBody = bytes.NewBuffer(jsonData)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, method, s.baseURL+path, reqBody)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	s.setHeaders(httpReq)
+
+	resp, err := s.httpClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("Cashfree API error: status %d, body: %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
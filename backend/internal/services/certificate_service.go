@@ -0,0 +1,324 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrCertificateNotFound is returned when a certificate does not exist or belongs to someone else
+var ErrCertificateNotFound = errors.New("certificate not found")
+
+// ErrCertificatesDisabled is returned when no certificate signing key is configured
+var ErrCertificatesDisabled = errors.New("certificates are not enabled")
+
+// CertificateService issues a certificate of authenticity for each unit of a
+// delivered order, recording the metal, its purity, the weight and the graded
+// stones of the piece. Certificates are signed with HMAC-SHA256 under a key
+// only the store holds, and anyone can check a certificate number against the
+// signature on record. Certificate numbers are random, so only the holder of a
+// printed certificate can look up the details on record.
+type CertificateService interface {
+	IssueCertificates(ctx context.Context, order *models.Order) ([]models.Certificate, error)
+	ListCustomerCertificates(userID, guestSessionID string, page, limit int) ([]models.Certificate, int64, error)
+	GetCustomerCertificate(certificateID string, actor models.OrderActor) (*models.Certificate, error)
+	VerifyCertificate(ctx context.Context, certificateNo, signature string) (*models.CertificateVerification, error)
+
+	// Admin
+	GetOrderCertificates(orderID string) ([]models.Certificate, error)
+	IssueOrderCertificates(orderID string) ([]models.Certificate, error)
+}
+
+type certificateService struct {
+	certificateRepo repository.CertificateRepository
+	orderRepo       repository.OrderRepository
+	productRepo     repository.ProductRepository
+	storefrontRepo  *repository.StorefrontDataRepository
+	signingKey      []byte
+	verifyURL       string
+}
+
+// NewCertificateService creates a new certificate service that signs
+// certificates with signingKey. Changing the key invalidates every
+// certificate already issued. Without a key no certificates are issued or
+// verified.
+func NewCertificateService(certificateRepo repository.CertificateRepository, orderRepo repository.OrderRepository, signingKey []byte) CertificateService {
+	return &certificateService{
+		certificateRepo: certificateRepo,
+		orderRepo:       orderRepo,
+		signingKey:      signingKey,
+		verifyURL:       "/api/v1/certificates/verify",
+	}
+}
+
+// SetProductRepository enables metal, weight and stone grading on certificates
+func (s *certificateService) SetProductRepository(productRepo repository.ProductRepository) {
+	s.productRepo = productRepo
+}
+
+// SetStorefrontRepo names the store as the issuing authority
+func (s *certificateService) SetStorefrontRepo(storefrontRepo *repository.StorefrontDataRepository) {
+	s.storefrontRepo = storefrontRepo
+}
+
+// SetVerificationURL sets the public address of the verification endpoint
+// that certificate QR codes link to. Without it the link is relative.
+func (s *certificateService) SetVerificationURL(verifyURL string) {
+	s.verifyURL = strings.TrimRight(verifyURL, "/")
+}
+
+// IssueCertificates issues a signed certificate for each unit of a delivered
+// order. Units that already have one are skipped, so a delivery recorded
+// twice issues nothing new.
+func (s *certificateService) IssueCertificates(ctx context.Context, order *models.Order) ([]models.Certificate, error) {
+	if order.Status != models.OrderStatusDelivered || order.DeliveredAt == nil {
+		return nil, fmt.Errorf("order %s has not been delivered", order.OrderNumber)
+	}
+	if len(s.signingKey) == 0 {
+		return nil, ErrCertificatesDisabled
+	}
+
+	existing, err := s.certificateRepo.GetByOrder(ctx, order.ID)
+	if err != nil {
+		return nil, err
+	}
+	issued := make(map[[2]int]bool)
+	for _, certificate := range existing {
+		issued[[2]int{certificate.LineIndex, certificate.Unit}] = true
+	}
+
+	authority := s.issuingAuthority(ctx)
+	var certificates []models.Certificate
+	for i, item := range order.Items {
+		grading := s.gradingDetails(ctx, item)
+		for unit := 1; unit <= item.Quantity; unit++ {
+			if issued[[2]int{i, unit}] {
+				continue
+			}
+			certificateNo, err := newCertificateNumber()
+			if err != nil {
+				return certificates, err
+			}
+
+			certificate := models.Certificate{
+				OrderID:          order.ID,
+				OrderNumber:      order.OrderNumber,
+				LineIndex:        i,
+				Unit:             unit,
+				ProductID:        item.ProductID,
+				ProductName:      item.Name,
+				UserID:           order.UserID,
+				GuestSessionID:   order.GuestSessionID,
+				CertificateType:  models.CertificateTypeAuthenticity,
+				CertificateNo:    certificateNo,
+				IssuingAuthority: authority,
+				IssueDate:        *order.DeliveredAt,
+				GradingDetails:   grading,
+			}
+			if unit <= len(item.Units) {
+				applyAssignedUnit(&certificate, item.Units[unit-1])
+			}
+			certificate.Signature = s.sign(&certificate)
+			certificate.QRCode = s.verificationLink(&certificate)
+			certificate.IsVerified = true
+
+			if err := s.certificateRepo.Create(ctx, &certificate); err != nil {
+				return certificates, err
+			}
+			certificates = append(certificates, certificate)
+		}
+	}
+
+	return certificates, nil
+}
+
+func (s *certificateService) ListCustomerCertificates(userID, guestSessionID string, page, limit int) ([]models.Certificate, int64, error) {
+	var userObjID primitive.ObjectID
+	if userID != "" {
+		objID, err := primitive.ObjectIDFromHex(userID)
+		if err != nil {
+			return nil, 0, errors.New("invalid user ID")
+		}
+		userObjID = objID
+	} else if guestSessionID == "" {
+		return nil, 0, errors.New("user ID or guest session ID is required")
+	}
+
+	return s.certificateRepo.GetByCustomer(context.Background(), userObjID, guestSessionID, page, limit)
+}
+
+func (s *certificateService) GetCustomerCertificate(certificateID string, actor models.OrderActor) (*models.Certificate, error) {
+	objID, err := primitive.ObjectIDFromHex(certificateID)
+	if err != nil {
+		return nil, errors.New("invalid certificate ID")
+	}
+
+	certificate, err := s.certificateRepo.GetByID(context.Background(), objID)
+	if err != nil || !certificate.IsOwnedBy(actor) {
+		return nil, ErrCertificateNotFound
+	}
+
+	return certificate, nil
+}
+
+// VerifyCertificate checks a certificate number. The record itself must
+// still match its signature, and a signature read from a printed
+// certificate's QR code must be the one on record. Only then is the
+// certificate reported valid, with the details on record; a bare number that
+// was issued is reported as number-only, as anyone can copy a number.
+func (s *certificateService) VerifyCertificate(ctx context.Context, certificateNo, signature string) (*models.CertificateVerification, error) {
+	if len(s.signingKey) == 0 {
+		return nil, ErrCertificatesDisabled
+	}
+
+	certificate, err := s.certificateRepo.GetByNumber(ctx, strings.TrimSpace(certificateNo))
+	if err != nil {
+		return nil, ErrCertificateNotFound
+	}
+
+	result := &models.CertificateVerification{
+		CertificateNo: certificate.CertificateNo,
+		Status:        models.CertificateInvalid,
+		Algorithm:     models.CertificateSignatureAlgorithm,
+	}
+
+	switch {
+	case !hmac.Equal([]byte(certificate.Signature), []byte(s.sign(certificate))):
+		result.Reason = "The certificate record does not match its signature"
+	case signature == "":
+		result.Status = models.CertificateNumberOnly
+		result.Reason = "Only the certificate number was checked; scan the QR code on the certificate to authenticate it"
+	case !hmac.Equal([]byte(signature), []byte(certificate.Signature)):
+		result.Reason = "The signature on this certificate does not match the one issued"
+	default:
+		result.Valid = true
+		result.Status = models.CertificateAuthentic
+		result.CertificateType = certificate.CertificateType
+		result.ProductName = certificate.ProductName
+		result.HUID = certificate.HUID
+		result.IssuingAuthority = certificate.IssuingAuthority
+		result.IssueDate = &certificate.IssueDate
+		result.GradingDetails = &certificate.GradingDetails
+	}
+
+	return result, nil
+}
+
+func (s *certificateService) GetOrderCertificates(orderID string) ([]models.Certificate, error) {
+	objID, err := primitive.ObjectIDFromHex(orderID)
+	if err != nil {
+		return nil, errors.New("invalid order ID")
+	}
+
+	return s.certificateRepo.GetByOrder(context.Background(), objID)
+}
+
+// IssueOrderCertificates issues any missing certificates of a delivered
+// order, such as for orders delivered before certificates were issued
+func (s *certificateService) IssueOrderCertificates(orderID string) ([]models.Certificate, error) {
+	objID, err := primitive.ObjectIDFromHex(orderID)
+	if err != nil {
+		return nil, errors.New("invalid order ID")
+	}
+
+	ctx := context.Background()
+	order, err := s.orderRepo.GetByID(ctx, objID)
+	if err != nil {
+		return nil, ErrCertificateNotFound
+	}
+
+	return s.IssueCertificates(ctx, order)
+}
+
+// newCertificateNumber returns a random certificate number such as
+// CERT-7KQ2MX4WJ9ABCDEF that cannot be guessed from the order
+func newCertificateNumber() (string, error) {
+	random := make([]byte, 10)
+	if _, err := rand.Read(random); err != nil {
+		return "", fmt.Errorf("failed to generate certificate number: %w", err)
+	}
+	return "CERT-" + base32.StdEncoding.EncodeToString(random), nil
+}
+
+// sign returns the base64url HMAC-SHA256 of the certificate's signing payload
+func (s *certificateService) sign(certificate *models.Certificate) string {
+	mac := hmac.New(sha256.New, s.signingKey)
+	mac.Write(certificate.SigningPayload())
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verificationLink is the address the certificate's QR code encodes
+func (s *certificateService) verificationLink(certificate *models.Certificate) string {
+	return fmt.Sprintf("%s/%s?sig=%s", s.verifyURL, url.PathEscape(certificate.CertificateNo), certificate.Signature)
+}
+
+// gradingDetails records the metal, weight and stones of an order line. The
+// metal chosen at checkout wins over the product's.
+func (s *certificateService) gradingDetails(ctx context.Context, item models.OrderItem) models.GradingDetails {
+	grading := models.GradingDetails{Condition: "New"}
+
+	var product *models.Product
+	if s.productRepo != nil {
+		if found, err := s.productRepo.GetByID(ctx, item.ProductID); err == nil {
+			product = found
+		} else {
+			fmt.Printf("Warning: failed to load product %s for its certificate: %v\n", item.ProductID.Hex(), err)
+		}
+	}
+
+	if product != nil {
+		grading.MetalType = product.MetalType
+		if product.Weight != nil {
+			grading.Weight = *product.Weight
+		}
+		grading.Gemstones = product.Gemstones
+	}
+	if item.Customization != nil {
+		if item.Customization.Metal != "" {
+			grading.MetalType = item.Customization.Metal
+		}
+		if item.Customization.RingSize != "" {
+			grading.Dimensions = "Ring size " + item.Customization.RingSize
+		}
+	}
+	grading.MetalPurity = models.MetalPurity(grading.MetalType)
+
+	return grading
+}
+
+// applyAssignedUnit records the piece packed for a unit: its serial and
+// hallmark, and its own weights and purity in place of the product's
+func applyAssignedUnit(certificate *models.Certificate, unit models.AssignedUnit) {
+	certificate.Serial = unit.Serial
+	certificate.HUID = unit.HUID
+	certificate.GradingDetails.Weight = unit.GrossWeight
+	certificate.GradingDetails.NetWeight = unit.NetWeight
+	if unit.Purity != "" {
+		certificate.GradingDetails.MetalPurity = unit.Purity
+	}
+}
+
+// issuingAuthority is the store's name from its settings
+func (s *certificateService) issuingAuthority(ctx context.Context) string {
+	name := models.DefaultStoreSettings().StoreName
+	if s.storefrontRepo != nil {
+		if settings, err := s.storefrontRepo.GetStoreSettings(ctx); err == nil && settings.StoreName != "" {
+			name = settings.StoreName
+		} else if err != nil {
+			fmt.Printf("Warning: failed to load store settings for certificates: %v\n", err)
+		}
+	}
+	return name
+}
@@ -0,0 +1,224 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memoryCertificateRepository keeps certificates in memory
+type memoryCertificateRepository struct {
+	repository.CertificateRepository
+	certificates []models.Certificate
+}
+
+func (r *memoryCertificateRepository) Create(ctx context.Context, certificate *models.Certificate) error {
+	certificate.ID = primitive.NewObjectID()
+	certificate.CreatedAt = time.Now()
+	r.certificates = append(r.certificates, *certificate)
+	return nil
+}
+
+func (r *memoryCertificateRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.Certificate, error) {
+	for _, certificate := range r.certificates {
+		if certificate.ID == id {
+			return &certificate, nil
+		}
+	}
+	return nil, errors.New("certificate not found")
+}
+
+func (r *memoryCertificateRepository) GetByNumber(ctx context.Context, certificateNo string) (*models.Certificate, error) {
+	for _, certificate := range r.certificates {
+		if certificate.CertificateNo == certificateNo {
+			return &certificate, nil
+		}
+	}
+	return nil, errors.New("certificate not found")
+}
+
+func (r *memoryCertificateRepository) GetByOrder(ctx context.Context, orderID primitive.ObjectID) ([]models.Certificate, error) {
+	var certificates []models.Certificate
+	for _, certificate := range r.certificates {
+		if certificate.OrderID == orderID {
+			certificates = append(certificates, certificate)
+		}
+	}
+	return certificates, nil
+}
+
+// memoryProductRepository serves products by ID
+type memoryProductRepository struct {
+	repository.ProductRepository
+	products map[primitive.ObjectID]models.Product
+}
+
+func (r *memoryProductRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.Product, error) {
+	product, ok := r.products[id]
+	if !ok {
+		return nil, errors.New("product not found")
+	}
+	return &product, nil
+}
+
+func TestMetalPurity(t *testing.T) {
+	for metal, want := range map[string]string{
+		"22K Gold":        "22K (916)",
+		"18kt White Gold": "18K (750)",
+		"14K Rose Gold":   "14K (585)",
+		"925 Silver":      "925",
+		"Platinum":        "950",
+		"Brass":           "",
+	} {
+		if got := models.MetalPurity(metal); got != want {
+			t.Errorf("MetalPurity(%q) = %q, want %q", metal, got, want)
+		}
+	}
+}
+
+func TestCertificatesIssuedAndVerified(t *testing.T) {
+	weight := 4.25
+	solitaire := models.Product{
+		ID:        primitive.NewObjectID(),
+		Name:      "Solitaire Ring",
+		MetalType: "18K White Gold",
+		Weight:    &weight,
+		Gemstones: []models.GemstoneGrading{
+			{Type: "Diamond", Shape: "Round", Carat: 0.5, Color: "F", Clarity: "VS1", Cut: "Excellent", Origin: "Natural"},
+		},
+	}
+	delivered := time.Date(2025, 8, 1, 10, 30, 15, 123456789, time.UTC)
+	order := models.Order{
+		ID:          primitive.NewObjectID(),
+		OrderNumber: "TJ-5001",
+		UserID:      primitive.NewObjectID(),
+		Items: []models.OrderItem{
+			{ProductID: solitaire.ID, Name: "Solitaire Ring", Quantity: 2, Price: 85000,
+				Customization: &models.ProductCustomization{Metal: "18K Rose Gold", RingSize: "12"}},
+		},
+		Status:      models.OrderStatusDelivered,
+		DeliveredAt: &delivered,
+	}
+	certificateRepo := &memoryCertificateRepository{}
+	orderRepo := &memoryOrderRepository{orders: map[primitive.ObjectID]models.Order{order.ID: order}}
+	svc := NewCertificateService(certificateRepo, orderRepo, []byte("test-signing-key")).(*certificateService)
+	svc.SetProductRepository(&memoryProductRepository{products: map[primitive.ObjectID]models.Product{solitaire.ID: solitaire}})
+	svc.SetVerificationURL("https://shop.example/api/v1/certificates/verify/")
+
+	issued, err := svc.IssueCertificates(context.Background(), &order)
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	if len(issued) != 2 || issued[0].Unit != 1 || issued[1].Unit != 2 {
+		t.Fatalf("expected one certificate per unit, got %+v", issued)
+	}
+	first, second := issued[0].CertificateNo, issued[1].CertificateNo
+	if !strings.HasPrefix(first, "CERT-") || len(first) != 21 || first == second || strings.Contains(first, order.OrderNumber) {
+		t.Fatalf("expected random certificate numbers, got %s and %s", first, second)
+	}
+	grading := issued[0].GradingDetails
+	if grading.MetalType != "18K Rose Gold" || grading.MetalPurity != "18K (750)" || grading.Weight != 4.25 || grading.Dimensions != "Ring size 12" {
+		t.Errorf("unexpected grading %+v", grading)
+	}
+	if len(grading.Gemstones) != 1 || grading.Gemstones[0].Clarity != "VS1" {
+		t.Errorf("expected the diamond's grading, got %+v", grading.Gemstones)
+	}
+	if issued[0].Signature == "" || issued[0].Signature == issued[1].Signature {
+		t.Errorf("expected each certificate to have its own signature")
+	}
+	if !strings.HasPrefix(issued[0].QRCode, "https://shop.example/api/v1/certificates/verify/"+first+"?sig=") {
+		t.Errorf("unexpected verification link %s", issued[0].QRCode)
+	}
+
+	// Issuing again for the same delivery adds nothing
+	if again, err := svc.IssueCertificates(context.Background(), &order); err != nil || len(again) != 0 {
+		t.Fatalf("expected no new certificates, got %d (%v)", len(again), err)
+	}
+
+	// The issue date is signed to the second, as stored by MongoDB
+	certificateRepo.certificates[0].IssueDate = delivered.Truncate(time.Millisecond)
+	result, err := svc.VerifyCertificate(context.Background(), first, issued[0].Signature)
+	if err != nil || !result.Valid || result.Status != models.CertificateAuthentic || result.ProductName != "Solitaire Ring" || result.GradingDetails.MetalPurity != "18K (750)" {
+		t.Fatalf("expected a valid certificate, got %+v (%v)", result, err)
+	}
+
+	// A bare number, which anyone can copy, is not reported as authentic
+	result, err = svc.VerifyCertificate(context.Background(), first, "")
+	if err != nil || result.Valid || result.Status != models.CertificateNumberOnly || result.ProductName != "" || result.GradingDetails != nil {
+		t.Fatalf("expected a number-only result without the signature, got %+v (%v)", result, err)
+	}
+
+	if _, err := svc.VerifyCertificate(context.Background(), "CERT-TJ-9999-1-1", ""); !errors.Is(err, ErrCertificateNotFound) {
+		t.Fatalf("expected an unknown number not to be found, got %v", err)
+	}
+
+	// A printed certificate whose signature was copied from another piece
+	result, _ = svc.VerifyCertificate(context.Background(), first, issued[1].Signature)
+	if result.Valid || result.Reason == "" || result.GradingDetails != nil {
+		t.Fatalf("expected a mismatched signature to fail, got %+v", result)
+	}
+
+	// A record altered after issue, e.g. to upgrade the stone
+	certificateRepo.certificates[1].GradingDetails.Gemstones = []models.GemstoneGrading{{Type: "Diamond", Carat: 1.5, Clarity: "IF"}}
+	result, _ = svc.VerifyCertificate(context.Background(), second, "")
+	if result.Valid || result.Status != models.CertificateInvalid {
+		t.Fatalf("expected an altered certificate to fail, got %+v", result)
+	}
+
+	// A certificate signed under another key is a forgery
+	forger := NewCertificateService(certificateRepo, orderRepo, []byte("guessed-key")).(*certificateService)
+	result, _ = forger.VerifyCertificate(context.Background(), first, "")
+	if result.Valid {
+		t.Fatalf("expected a different key not to verify, got %+v", result)
+	}
+
+	// Without a signing key nothing is issued or verified
+	unsigned := NewCertificateService(certificateRepo, orderRepo, nil)
+	if _, err := unsigned.IssueOrderCertificates(order.ID.Hex()); !errors.Is(err, ErrCertificatesDisabled) {
+		t.Fatalf("expected certificates to be disabled without a key, got %v", err)
+	}
+	if _, err := unsigned.VerifyCertificate(context.Background(), first, ""); !errors.Is(err, ErrCertificatesDisabled) {
+		t.Fatalf("expected verification to be disabled without a key, got %v", err)
+	}
+
+	customer := models.OrderActor{Type: models.OrderActorCustomer, ID: order.UserID.Hex()}
+	if _, err := svc.GetCustomerCertificate(issued[0].ID.Hex(), customer); err != nil {
+		t.Fatalf("expected the buyer to see their certificate, got %v", err)
+	}
+	if _, err := svc.GetCustomerCertificate(issued[0].ID.Hex(), models.OrderActor{Type: models.OrderActorCustomer, ID: "guest-1"}); !errors.Is(err, ErrCertificateNotFound) {
+		t.Fatalf("expected another customer's certificate to be hidden, got %v", err)
+	}
+}
+
+func TestRenderCertificate(t *testing.T) {
+	doc, err := renderCertificate(&certificateData{
+		Certificate: models.Certificate{
+			CertificateNo:    "CERT-TJ-5001-1-1",
+			OrderNumber:      "TJ-5001",
+			ProductName:      "Solitaire Ring",
+			IssuingAuthority: "Thyne Jewels",
+			IssueDate:        time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC),
+			GradingDetails: models.GradingDetails{
+				MetalType: "18K White Gold", MetalPurity: "18K (750)", Weight: 4.25, Condition: "New",
+				Gemstones: []models.GemstoneGrading{{Type: "Diamond", Shape: "Round", Carat: 0.5, Color: "F", Clarity: "VS1"}},
+			},
+			Signature: "dGVzdC1zaWduYXR1cmU",
+			QRCode:    "https://shop.example/api/v1/certificates/verify/CERT-TJ-5001-1-1?sig=dGVzdC1zaWduYXR1cmU",
+		},
+		Company: models.CompanyInfo{Name: "Thyne Jewels"},
+	})
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	content, err := doc.Bytes()
+	if err != nil || !strings.HasPrefix(string(content), "%PDF-") {
+		t.Fatalf("expected a PDF, got %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"context"
+	"net/http"
+
+	"thyne-jewels-backend/internal/models"
+)
+
+// CODGateway represents cash on delivery. Nothing is collected online: the order
+// is confirmed at checkout and cash is collected by the courier.
+type CODGateway struct{}
+
+// NewCODGateway creates a new cash on delivery gateway
+func NewCODGateway() *CODGateway {
+	return &CODGateway{}
+}
+
+func (g *CODGateway) Method() models.PaymentMethod {
+	return models.PaymentMethodCOD
+}
+
+func (g *CODGateway) Name() string {
+	return "Cash on Delivery"
+}
+
+func (g *CODGateway) IsEnabled() bool {
+	return true
+}
+
+// CreatePayment records that the order will be paid in cash on delivery
+func (g *CODGateway) CreatePayment(ctx context.Context, req *GatewayPaymentRequest) (*GatewayPayment, error) {
+	return &GatewayPayment{
+		Checkout: map[string]interface{}{"collectOnDelivery": true},
+	}, nil
+}
+
+func (g *CODGateway) CreatePaymentLink(ctx context.Context, req *GatewayPaymentRequest) (*GatewayPayment, error) {
+	return nil, ErrGatewayOperationUnsupported
+}
+
+// VerifyPayment reports the attempt as awaiting collection
+func (g *CODGateway) VerifyPayment(ctx context.Context, attempt *models.PaymentAttempt, params map[string]string) (*GatewayPaymentStatus, error) {
+	return g.GetPaymentStatus(ctx, attempt)
+}
+
+// GetPaymentStatus reports the attempt as awaiting collection; cash collection is
+// recorded through the order status rather than the gateway
+func (g *CODGateway) GetPaymentStatus(ctx context.Context, attempt *models.PaymentAttempt) (*GatewayPaymentStatus, error) {
+	return &GatewayPaymentStatus{
+		Status: models.PaymentAttemptCreated,
+		Amount: attempt.Amount,
+	}, nil
+}
+
+func (g *CODGateway) ParseWebhook(ctx context.Context, payload []byte, headers http.Header) (*GatewayWebhookEvent, error) {
+	return nil, ErrGatewayOperationUnsupported
+}
+
+func (g *CODGateway) Refund(ctx context.Context, attempt *models.PaymentAttempt, req *GatewayRefundRequest) (*GatewayRefund, error) {
+	return nil, ErrGatewayOperationUnsupported
+}
+
+func (g *CODGateway) CancelPayment(ctx context.Context, attempt *models.PaymentAttempt) error {
+	return ErrGatewayOperationUnsupported
+}
@@ -0,0 +1,450 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"thyne-jewels-backend/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// ErrInvalidGSTIN is returned for a buyer GSTIN that is malformed or fails its check character
+	ErrInvalidGSTIN = errors.New("invalid GSTIN")
+	// ErrNotB2BInvoice is returned when an e-invoice is asked for an invoice without a buyer GSTIN
+	ErrNotB2BInvoice = errors.New("e-invoices are only raised for invoices with a buyer GSTIN")
+)
+
+// maxEInvoiceBatch caps the invoices loaded for one e-invoice download
+const maxEInvoiceBatch = 10000
+
+// eInvoiceTolerance is how far amounts may drift from their computed value through rounding
+const eInvoiceTolerance = 1.0
+
+// eInvoiceMaxRoundOff is the largest round-off the schema accepts
+const eInvoiceMaxRoundOff = 99.99
+
+// eInvoiceGSTRates are the GST rates the schema accepts
+var eInvoiceGSTRates = []float64{0, 0.1, 0.25, 1, 1.5, 3, 5, 6, 7.5, 12, 18, 28, 40}
+
+var (
+	// eInvoiceDocNumber is 1-16 letters, digits, "/" or "-", not starting with 0, "/" or "-"
+	eInvoiceDocNumber = regexp.MustCompile(`^[A-Za-z1-9][A-Za-z0-9/-]{0,15}$`)
+	// eInvoiceHSN is a 4, 6 or 8 digit HSN or SAC code
+	eInvoiceHSN = regexp.MustCompile(`^[0-9]{4}([0-9]{2}){0,2}$`)
+)
+
+// GetEInvoice builds the e-invoice JSON of a B2B invoice and checks it against the schema rules
+func (s *invoiceService) GetEInvoice(ctx context.Context, invoiceID string) (*models.EInvoiceResult, error) {
+	objID, err := primitive.ObjectIDFromHex(invoiceID)
+	if err != nil {
+		return nil, ErrInvoiceNotFound
+	}
+	invoice, err := s.invoiceRepo.GetByID(ctx, objID)
+	if err != nil {
+		return nil, ErrInvoiceNotFound
+	}
+	if invoice.BuyerGSTIN == "" {
+		return nil, ErrNotB2BInvoice
+	}
+
+	settings, err := s.eInvoiceSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.eInvoiceFor(ctx, invoice, settings, time.Now())
+}
+
+// GetEInvoiceBatch builds the e-invoices of the B2B invoices dated between from
+// and to, oldest first. Void invoices and invoices to unregistered buyers are
+// left out; invoices that break a schema rule are listed with their errors.
+func (s *invoiceService) GetEInvoiceBatch(ctx context.Context, from, to time.Time) (*models.EInvoiceBatch, error) {
+	invoices, _, err := s.invoiceRepo.List(ctx, &models.InvoiceFilter{
+		DateFrom: &from,
+		DateTo:   &to,
+		Page:     1,
+		Limit:    maxEInvoiceBatch,
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(invoices, func(i, j int) bool {
+		return invoices[i].InvoiceDate.Before(invoices[j].InvoiceDate)
+	})
+
+	settings, err := s.eInvoiceSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	batch := &models.EInvoiceBatch{From: from, To: to, Invoices: []models.EInvoiceResult{}}
+	for i := range invoices {
+		invoice := &invoices[i]
+		if invoice.BuyerGSTIN == "" || invoice.Status == models.InvoiceStatusVoid {
+			continue
+		}
+		result, err := s.eInvoiceFor(ctx, invoice, settings, now)
+		if err != nil {
+			return nil, err
+		}
+		if result.Valid {
+			batch.Valid++
+		} else {
+			batch.Invalid++
+		}
+		batch.Invoices = append(batch.Invoices, *result)
+	}
+	return batch, nil
+}
+
+// eInvoiceSettings loads the store settings that supply the seller details
+func (s *invoiceService) eInvoiceSettings(ctx context.Context) (*models.StoreSettings, error) {
+	if s.storefrontRepo == nil {
+		return models.DefaultStoreSettings(), nil
+	}
+	settings, err := s.storefrontRepo.GetStoreSettings(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load store settings: %w", err)
+	}
+	return settings, nil
+}
+
+// eInvoiceFor builds and validates the e-invoice of one invoice
+func (s *invoiceService) eInvoiceFor(ctx context.Context, invoice *models.Invoice, settings *models.StoreSettings, now time.Time) (*models.EInvoiceResult, error) {
+	order, err := s.orderRepo.GetByID(ctx, invoice.OrderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order of invoice %s: %w", invoice.InvoiceNumber, err)
+	}
+
+	payload := buildEInvoice(invoice, order, settings)
+	errs := validateEInvoice(payload, now)
+	return &models.EInvoiceResult{
+		InvoiceID:     invoice.ID.Hex(),
+		InvoiceNumber: invoice.InvoiceNumber,
+		Payload:       payload,
+		Valid:         len(errs) == 0,
+		Errors:        errs,
+	}, nil
+}
+
+// buildEInvoice maps an invoice onto the e-invoice schema. Each GST line of
+// the invoice becomes an item: the goods and the making charges of an order
+// line are separate items, as they carry different HSN codes and rates.
+// Shipping and COD charges are not taxed and are reported as other charges.
+func buildEInvoice(invoice *models.Invoice, order *models.Order, settings *models.StoreSettings) *models.EInvoice {
+	supplierGSTIN := settings.GSTNumber
+	supplyState := settings.SupplyState()
+	placeOfSupply := order.ShippingAddress.State
+	if breakdown := order.TaxBreakdown; breakdown != nil {
+		if breakdown.SupplierGSTIN != "" {
+			supplierGSTIN = breakdown.SupplierGSTIN
+		}
+		supplyState = breakdown.SupplierState
+		placeOfSupply = breakdown.PlaceOfSupply
+	}
+
+	einvoice := &models.EInvoice{
+		Version: models.EInvoiceSchemaVersion,
+		TranDtls: models.EInvoiceTran{
+			TaxSch:      "GST",
+			SupTyp:      "B2B",
+			RegRev:      "N",
+			IgstOnIntra: "N",
+		},
+		DocDtls: models.EInvoiceDoc{
+			Typ: "INV",
+			No:  invoice.InvoiceNumber,
+			Dt:  models.EInvoiceDate(invoice.InvoiceDate),
+		},
+		SellerDtls: models.EInvoiceParty{
+			Gstin: models.NormalizeGSTIN(supplierGSTIN),
+			LglNm: strings.TrimSpace(settings.StoreName),
+			Addr1: strings.TrimSpace(settings.StoreAddress),
+			Loc:   strings.TrimSpace(settings.StoreCity),
+			Pin:   eInvoicePin(settings.StorePincode),
+			Stcd:  models.GSTStateCode(supplyState),
+			Ph:    eInvoicePhone(settings.StorePhone),
+			Em:    strings.TrimSpace(settings.StoreEmail),
+		},
+		ItemList: []models.EInvoiceItem{},
+	}
+
+	// The buyer is registered in the state of its GSTIN; goods go to the shipping address
+	address := order.ShippingAddress
+	buyerName := invoice.BuyerLegalName
+	if buyerName == "" {
+		buyerName = address.RecipientName
+	}
+	addr1 := strings.Trim(strings.TrimSpace(address.HouseNoFloor)+", "+strings.TrimSpace(address.BuildingBlock), ", ")
+	if addr1 == "" {
+		addr1 = strings.TrimSpace(address.Street)
+	}
+	pincode := address.Pincode
+	if pincode == "" {
+		pincode = address.ZipCode
+	}
+	buyerState := models.GSTStateCode(address.State)
+	if models.ValidGSTIN(invoice.BuyerGSTIN) {
+		buyerState = invoice.BuyerGSTIN[:2]
+	}
+	einvoice.BuyerDtls = models.EInvoiceParty{
+		Gstin: invoice.BuyerGSTIN,
+		LglNm: strings.TrimSpace(buyerName),
+		Pos:   models.GSTStateCode(placeOfSupply),
+		Addr1: addr1,
+		Addr2: strings.TrimSpace(address.LandmarkArea),
+		Loc:   strings.TrimSpace(address.City),
+		Pin:   eInvoicePin(pincode),
+		Stcd:  buyerState,
+		Ph:    eInvoicePhone(address.RecipientPhone),
+	}
+
+	values := &einvoice.ValDtls
+	for i, line := range invoice.TaxLines {
+		quantity := line.Quantity
+		if quantity < 1 {
+			quantity = 1
+		}
+
+		// The discount was taken off the taxable value; recover the price before it
+		gross := line.TaxableValue
+		if line.LineIndex >= 0 && line.LineIndex < len(order.Items) {
+			item := order.Items[line.LineIndex]
+			making := math.Min(math.Max(item.MakingCharge, 0), item.Price)
+			unitPrice := item.Price - making
+			if line.Component == models.TaxComponentMaking {
+				unitPrice = making
+			}
+			if full := roundPrice(unitPrice * float64(quantity)); full >= line.TaxableValue {
+				gross = full
+			}
+		}
+
+		item := models.EInvoiceItem{
+			SlNo:       strconv.Itoa(i + 1),
+			PrdDesc:    line.Description,
+			IsServc:    "N",
+			HsnCd:      line.HSNCode,
+			Qty:        float64(quantity),
+			Unit:       "NOS",
+			UnitPrice:  math.Round(gross/float64(quantity)*1000) / 1000,
+			TotAmt:     gross,
+			Discount:   roundPrice(gross - line.TaxableValue),
+			AssAmt:     line.TaxableValue,
+			GstRt:      line.Rate,
+			IgstAmt:    line.IGST,
+			CgstAmt:    line.CGST,
+			SgstAmt:    line.SGST,
+			TotItemVal: roundPrice(line.TaxableValue + line.Total),
+		}
+		if strings.HasPrefix(line.HSNCode, "99") {
+			item.IsServc = "Y"
+			item.Unit = ""
+		}
+		einvoice.ItemList = append(einvoice.ItemList, item)
+
+		values.AssVal = roundPrice(values.AssVal + item.AssAmt)
+		values.CgstVal = roundPrice(values.CgstVal + item.CgstAmt)
+		values.SgstVal = roundPrice(values.SgstVal + item.SgstAmt)
+		values.IgstVal = roundPrice(values.IgstVal + item.IgstAmt)
+	}
+
+	values.OthChrg = roundPrice(invoice.Shipping + order.CODCharge)
+	values.TotInvVal = roundPrice(invoice.Total)
+	values.RndOffAmt = roundPrice(values.TotInvVal - (values.AssVal + values.CgstVal + values.SgstVal + values.IgstVal + values.OthChrg))
+	return einvoice
+}
+
+// validateEInvoice checks an e-invoice against the schema and the IRP's
+// business rules, returning one message per broken rule
+func validateEInvoice(e *models.EInvoice, now time.Time) []string {
+	var errs []string
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Sprintf(format, args...))
+	}
+
+	// Document
+	if !eInvoiceDocNumber.MatchString(e.DocDtls.No) {
+		fail("DocDtls.No %q must be 1 to 16 letters, digits, / or - and must not start with 0, / or -", e.DocDtls.No)
+	}
+	date, err := time.Parse("02/01/2006", e.DocDtls.Dt)
+	today, _ := time.Parse("02/01/2006", models.EInvoiceDate(now))
+	if err != nil {
+		fail("DocDtls.Dt %q must be a dd/mm/yyyy date", e.DocDtls.Dt)
+	} else if date.After(today) {
+		fail("DocDtls.Dt %s is in the future", e.DocDtls.Dt)
+	}
+
+	// Parties
+	validateEInvoiceParty(fail, "SellerDtls", e.SellerDtls)
+	validateEInvoiceParty(fail, "BuyerDtls", e.BuyerDtls)
+	if e.SellerDtls.Gstin != "" && e.SellerDtls.Gstin == e.BuyerDtls.Gstin {
+		fail("BuyerDtls.Gstin must differ from the seller's GSTIN")
+	}
+	if models.ValidGSTIN(e.SellerDtls.Gstin) && e.SellerDtls.Gstin[:2] != e.SellerDtls.Stcd {
+		fail("SellerDtls.Stcd %q must be the state of the seller's GSTIN", e.SellerDtls.Stcd)
+	}
+	if !models.IsGSTStateCode(e.BuyerDtls.Pos) {
+		fail("BuyerDtls.Pos %q must be a GST state code", e.BuyerDtls.Pos)
+	}
+
+	// Items
+	if len(e.ItemList) == 0 {
+		fail("ItemList must have at least one item; the invoice has no GST lines")
+	}
+	intraState := e.SellerDtls.Stcd == e.BuyerDtls.Pos
+	var assVal, cgstVal, sgstVal, igstVal float64
+	for i, item := range e.ItemList {
+		path := fmt.Sprintf("ItemList[%d]", i)
+		if !eInvoiceHSN.MatchString(item.HsnCd) {
+			fail("%s.HsnCd %q must be 4, 6 or 8 digits", path, item.HsnCd)
+		}
+		if !eInvoiceGSTRate(item.GstRt) {
+			fail("%s.GstRt %v is not a GST rate", path, item.GstRt)
+		}
+		if item.Qty <= 0 {
+			fail("%s.Qty must be positive", path)
+		}
+		if !withinTolerance(item.TotAmt, item.UnitPrice*item.Qty) {
+			fail("%s.TotAmt %.2f must be UnitPrice x Qty", path, item.TotAmt)
+		}
+		if item.Discount < 0 || !withinTolerance(item.AssAmt, item.TotAmt-item.Discount) {
+			fail("%s.AssAmt %.2f must be TotAmt less Discount", path, item.AssAmt)
+		}
+
+		tax := item.AssAmt * item.GstRt / 100
+		if intraState {
+			if item.IgstAmt != 0 {
+				fail("%s.IgstAmt must be 0 for a supply within the state", path)
+			}
+			if math.Abs(item.CgstAmt-item.SgstAmt) > 0.01 {
+				fail("%s.CgstAmt and SgstAmt must be equal", path)
+			}
+			if !withinTolerance(item.CgstAmt+item.SgstAmt, tax) {
+				fail("%s.CgstAmt and SgstAmt must add up to %.2f", path, roundPrice(tax))
+			}
+		} else {
+			if item.CgstAmt != 0 || item.SgstAmt != 0 {
+				fail("%s.CgstAmt and SgstAmt must be 0 for a supply to another state", path)
+			}
+			if !withinTolerance(item.IgstAmt, tax) {
+				fail("%s.IgstAmt must be %.2f", path, roundPrice(tax))
+			}
+		}
+		itemValue := item.AssAmt + item.IgstAmt + item.CgstAmt + item.SgstAmt + item.CesAmt + item.CesNonAdvlAmt +
+			item.StateCesAmt + item.StateCesNonAdvlAmt + item.OthChrg
+		if !withinTolerance(item.TotItemVal, itemValue) {
+			fail("%s.TotItemVal %.2f must be the assessable value plus taxes and charges", path, item.TotItemVal)
+		}
+
+		assVal += item.AssAmt
+		cgstVal += item.CgstAmt
+		sgstVal += item.SgstAmt
+		igstVal += item.IgstAmt
+	}
+
+	// Totals
+	v := e.ValDtls
+	totals := []struct {
+		name     string
+		got, sum float64
+	}{
+		{"AssVal", v.AssVal, assVal},
+		{"CgstVal", v.CgstVal, cgstVal},
+		{"SgstVal", v.SgstVal, sgstVal},
+		{"IgstVal", v.IgstVal, igstVal},
+	}
+	for _, total := range totals {
+		if !withinTolerance(total.got, total.sum) {
+			fail("ValDtls.%s %.2f must be the sum of the items (%.2f)", total.name, total.got, roundPrice(total.sum))
+		}
+	}
+	if math.Abs(v.RndOffAmt) > eInvoiceMaxRoundOff {
+		fail("ValDtls.RndOffAmt %.2f must be between -%.2f and %.2f", v.RndOffAmt, eInvoiceMaxRoundOff, eInvoiceMaxRoundOff)
+	}
+	invoiceValue := v.AssVal + v.CgstVal + v.SgstVal + v.IgstVal + v.CesVal + v.StCesVal + v.OthChrg - v.Discount + v.RndOffAmt
+	if v.TotInvVal <= 0 || !withinTolerance(v.TotInvVal, invoiceValue) {
+		fail("ValDtls.TotInvVal %.2f must be the assessable value plus taxes and charges, less the discount", v.TotInvVal)
+	}
+
+	return errs
+}
+
+// validateEInvoiceParty checks the seller or buyer details
+func validateEInvoiceParty(fail func(string, ...interface{}), path string, party models.EInvoiceParty) {
+	if !models.ValidGSTIN(party.Gstin) {
+		fail("%s.Gstin %q is not a valid GSTIN", path, party.Gstin)
+	}
+	if n := utf8.RuneCountInString(party.LglNm); n < 3 || n > 100 {
+		fail("%s.LglNm must be 3 to 100 characters", path)
+	}
+	if n := utf8.RuneCountInString(party.Addr1); n < 1 || n > 100 {
+		fail("%s.Addr1 must be 1 to 100 characters", path)
+	}
+	if n := utf8.RuneCountInString(party.Addr2); n > 100 {
+		fail("%s.Addr2 must be at most 100 characters", path)
+	}
+	if n := utf8.RuneCountInString(party.Loc); n < 3 || n > 50 {
+		fail("%s.Loc must be 3 to 50 characters", path)
+	}
+	if party.Pin < 100000 || party.Pin > 999999 {
+		fail("%s.Pin must be a 6 digit pincode", path)
+	}
+	if !models.IsGSTStateCode(party.Stcd) {
+		fail("%s.Stcd %q must be a GST state code", path, party.Stcd)
+	}
+	if n := len(party.Ph); n > 0 && (n < 6 || n > 12) {
+		fail("%s.Ph must be 6 to 12 digits", path)
+	}
+	if n := len(party.Em); n > 0 && (n < 6 || n > 100 || !strings.Contains(party.Em, "@")) {
+		fail("%s.Em %q is not an email address", path, party.Em)
+	}
+}
+
+// eInvoicePin reads a pincode, returning 0 when it is not a number
+func eInvoicePin(pincode string) int {
+	pin, err := strconv.Atoi(strings.ReplaceAll(pincode, " ", ""))
+	if err != nil {
+		return 0
+	}
+	return pin
+}
+
+// eInvoicePhone keeps the digits of a phone number, dropping the country code
+// of an Indian number that would be too long otherwise
+func eInvoicePhone(phone string) string {
+	var digits strings.Builder
+	for _, r := range phone {
+		if r >= '0' && r <= '9' {
+			digits.WriteRune(r)
+		}
+	}
+	number := digits.String()
+	if len(number) > 12 {
+		number = number[len(number)-10:]
+	}
+	return number
+}
+
+func eInvoiceGSTRate(rate float64) bool {
+	for _, allowed := range eInvoiceGSTRates {
+		if math.Abs(rate-allowed) < 1e-9 {
+			return true
+		}
+	}
+	return false
+}
+
+func withinTolerance(got, want float64) bool {
+	return math.Abs(got-want) <= eInvoiceTolerance
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"thyne-jewels-backend/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestValidGSTIN(t *testing.T) {
+	for _, gstin := range []string{"27AAPFU0939F1ZV", "29AAGCB7383J1Z4", "33AAACH7409R1Z8"} {
+		if !models.ValidGSTIN(gstin) {
+			t.Errorf("expected %s to be valid", gstin)
+		}
+	}
+	for _, gstin := range []string{"", "29ABCDE1234F1Z5", "27AAPFU0939F1ZW", "99AAPFU0939F1ZV", "27AAPFU0939F1Z"} {
+		if models.ValidGSTIN(gstin) {
+			t.Errorf("expected %q to be invalid", gstin)
+		}
+	}
+	if got := models.NormalizeGSTIN(" 27aapfu 0939f1zv "); got != "27AAPFU0939F1ZV" {
+		t.Errorf("unexpected normalized GSTIN %q", got)
+	}
+}
+
+// eInvoiceFixture is a Karnataka store selling to a Maharashtra company that
+// takes delivery in Bengaluru, so the supply is within the state
+func eInvoiceFixture() (*models.Invoice, *models.Order, *models.StoreSettings) {
+	settings := models.DefaultStoreSettings()
+	settings.GSTNumber = "29AAGCB7383J1Z4"
+	settings.StoreState = "Karnataka"
+	settings.StoreName = "Thyne Jewels Pvt Ltd"
+	settings.StoreAddress = "14 Commercial Street"
+	settings.StoreCity = "Bengaluru"
+	settings.StorePincode = "560001"
+
+	order := &models.Order{
+		ID:          primitive.NewObjectID(),
+		OrderNumber: "TJ-7001",
+		Items: []models.OrderItem{
+			{ProductID: primitive.NewObjectID(), Name: "Gold Chain (22K)", Price: 10200, MakingCharge: 1200, Quantity: 2},
+		},
+		ShippingAddress: models.Address{
+			HouseNoFloor:   "3rd Floor",
+			BuildingBlock:  "Prestige Tower",
+			LandmarkArea:   "Residency Road",
+			City:           "Bengaluru",
+			State:          "Karnataka",
+			Pincode:        "560025",
+			RecipientName:  "Asha Rao",
+			RecipientPhone: "+91 98450 12345",
+		},
+		Subtotal:       20400,
+		Discount:       400,
+		Shipping:       99,
+		BuyerGSTIN:     "27AAPFU0939F1ZV",
+		BuyerLegalName: "Acme Traders LLP",
+	}
+	order.TaxBreakdown = calculateGST(settings, order.TaxableLines(), order.Discount, order.ShippingAddress.State)
+	order.Tax = order.TaxBreakdown.Total
+	order.Total = roundPrice(order.Subtotal - order.Discount + order.Tax + order.Shipping)
+
+	invoice := &models.Invoice{
+		ID:             primitive.NewObjectID(),
+		InvoiceNumber:  "INV/25-26/000042",
+		OrderID:        order.ID,
+		BuyerGSTIN:     order.BuyerGSTIN,
+		BuyerLegalName: order.BuyerLegalName,
+		InvoiceDate:    time.Date(2025, 7, 14, 20, 0, 0, 0, time.UTC),
+		Status:         models.InvoiceStatusPaid,
+		Subtotal:       order.Subtotal,
+		Tax:            order.Tax,
+		TaxLines:       order.TaxBreakdown.Lines,
+		Shipping:       order.Shipping,
+		Discount:       order.Discount,
+		Total:          order.Total,
+	}
+	return invoice, order, settings
+}
+
+func TestBuildEInvoice(t *testing.T) {
+	invoice, order, settings := eInvoiceFixture()
+	now := time.Date(2025, 7, 20, 0, 0, 0, 0, time.UTC)
+
+	e := buildEInvoice(invoice, order, settings)
+	if errs := validateEInvoice(e, now); len(errs) != 0 {
+		t.Fatalf("expected a valid e-invoice, got %v", errs)
+	}
+
+	// 20:00 UTC is the next day in India
+	if e.DocDtls.No != "INV/25-26/000042" || e.DocDtls.Dt != "15/07/2025" {
+		t.Errorf("unexpected document details %+v", e.DocDtls)
+	}
+	if e.SellerDtls.Stcd != "29" || e.SellerDtls.Pin != 560001 || e.SellerDtls.Ph != "919876543210" {
+		t.Errorf("unexpected seller details %+v", e.SellerDtls)
+	}
+	buyer := e.BuyerDtls
+	if buyer.LglNm != "Acme Traders LLP" || buyer.Stcd != "27" || buyer.Pos != "29" || buyer.Addr1 != "3rd Floor, Prestige Tower" || buyer.Ph != "919845012345" {
+		t.Errorf("unexpected buyer details %+v", buyer)
+	}
+
+	// Goods and making charges are separate items with the discount shown per item
+	if len(e.ItemList) != 2 {
+		t.Fatalf("expected goods and making charge items, got %d", len(e.ItemList))
+	}
+	goods, making := e.ItemList[0], e.ItemList[1]
+	if goods.HsnCd != "7113" || goods.IsServc != "N" || goods.Unit != "NOS" || goods.UnitPrice != 9000 || goods.TotAmt != 18000 {
+		t.Errorf("unexpected goods item %+v", goods)
+	}
+	if making.HsnCd != "998892" || making.IsServc != "Y" || making.Unit != "" || making.TotAmt != 2400 {
+		t.Errorf("unexpected making charge item %+v", making)
+	}
+	if goods.Discount+making.Discount != 400 || goods.IgstAmt != 0 || goods.CgstAmt != goods.SgstAmt {
+		t.Errorf("expected the order discount and an intra-state split, got %+v and %+v", goods, making)
+	}
+
+	v := e.ValDtls
+	if v.AssVal != 20000 || v.OthChrg != 99 || v.TotInvVal != invoice.Total || v.RndOffAmt != 0 {
+		t.Errorf("unexpected totals %+v", v)
+	}
+}
+
+func TestValidateEInvoice(t *testing.T) {
+	invoice, order, settings := eInvoiceFixture()
+	now := time.Date(2025, 7, 20, 0, 0, 0, 0, time.UTC)
+
+	broken := buildEInvoice(invoice, order, settings)
+	broken.BuyerDtls.Gstin = "27AAPFU0939F1ZW"
+	broken.SellerDtls.Pin = 0
+	broken.ItemList[0].HsnCd = "711"
+	broken.ItemList[0].GstRt = 4
+	broken.ItemList[1].IgstAmt = broken.ItemList[1].CgstAmt * 2
+	broken.ValDtls.AssVal += 50
+	broken.DocDtls.Dt = "21/07/2025"
+
+	errs := strings.Join(validateEInvoice(broken, now), "\n")
+	for _, want := range []string{
+		"BuyerDtls.Gstin", "SellerDtls.Pin", "ItemList[0].HsnCd", "ItemList[0].GstRt",
+		"ItemList[1].IgstAmt must be 0", "ValDtls.AssVal", "in the future",
+	} {
+		if !strings.Contains(errs, want) {
+			t.Errorf("expected an error about %q, got:\n%s", want, errs)
+		}
+	}
+
+	// Supplies to another state pay IGST only
+	order.ShippingAddress.State = "Maharashtra"
+	order.TaxBreakdown = calculateGST(settings, order.TaxableLines(), order.Discount, order.ShippingAddress.State)
+	invoice.TaxLines = order.TaxBreakdown.Lines
+	interState := buildEInvoice(invoice, order, settings)
+	if errs := validateEInvoice(interState, now); len(errs) != 0 {
+		t.Fatalf("expected a valid inter-state e-invoice, got %v", errs)
+	}
+	if interState.BuyerDtls.Pos != "27" || interState.ValDtls.IgstVal == 0 || interState.ValDtls.CgstVal != 0 {
+		t.Errorf("expected IGST for a Maharashtra delivery, got %+v", interState.ValDtls)
+	}
+}
+
+func TestEInvoiceBatch(t *testing.T) {
+	invoice, order, _ := eInvoiceFixture()
+	retail := models.Invoice{ID: primitive.NewObjectID(), InvoiceNumber: "INV/25-26/000043", OrderID: order.ID, InvoiceDate: invoice.InvoiceDate}
+	void := *invoice
+	void.ID = primitive.NewObjectID()
+	void.Status = models.InvoiceStatusVoid
+	invoiceRepo := &memoryInvoiceRepository{invoices: map[primitive.ObjectID]models.Invoice{
+		invoice.ID: *invoice,
+		retail.ID:  retail,
+		void.ID:    void,
+	}}
+	orderRepo := &memoryOrderRepository{orders: map[primitive.ObjectID]models.Order{order.ID: *order}}
+	svc := NewInvoiceService(invoiceRepo, orderRepo, nil)
+
+	if _, err := svc.GetEInvoice(context.Background(), retail.ID.Hex()); !errors.Is(err, ErrNotB2BInvoice) {
+		t.Fatalf("expected retail invoices to have no e-invoice, got %v", err)
+	}
+
+	from := time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)
+	batch, err := svc.GetEInvoiceBatch(context.Background(), from, from.AddDate(0, 1, 0))
+	if err != nil {
+		t.Fatalf("batch: %v", err)
+	}
+	// Only the B2B invoice is included; without a store pincode configured it cannot be sent
+	if len(batch.Invoices) != 1 || batch.Invoices[0].InvoiceID != invoice.ID.Hex() || batch.Invalid != 1 {
+		t.Fatalf("expected the one B2B invoice, got %+v", batch)
+	}
+	if !strings.Contains(strings.Join(batch.Invoices[0].Errors, "\n"), "SellerDtls.Pin") {
+		t.Errorf("expected the missing store pincode to be reported, got %v", batch.Invoices[0].Errors)
+	}
+}
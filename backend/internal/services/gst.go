@@ -0,0 +1,95 @@
+package services
+
+import (
+	"math"
+
+	"thyne-jewels-backend/internal/models"
+)
+
+// calculateGST computes the GST on a set of lines. The discount is shared
+// across lines by value; each line is then split into goods, taxed at its
+// category's rate, and making charges, taxed at the making charge rate.
+// Supplies within the store's state pay CGST and SGST, others pay IGST. An
+// unknown shipping state is treated as within the store's state.
+func calculateGST(settings *models.StoreSettings, lines []models.TaxableLine, discount float64, shipToState string) *models.TaxBreakdown {
+	breakdown := &models.TaxBreakdown{
+		SupplierGSTIN: settings.GSTNumber,
+		SupplierState: settings.SupplyState(),
+		PlaceOfSupply: shipToState,
+		Lines:         []models.LineTax{},
+	}
+	if shipToState == "" {
+		breakdown.PlaceOfSupply = breakdown.SupplierState
+	}
+	breakdown.InterState = !models.SameGSTState(breakdown.SupplierState, breakdown.PlaceOfSupply)
+
+	if !settings.EnableGST {
+		return breakdown
+	}
+
+	gross := 0.0
+	for _, line := range lines {
+		gross += line.UnitPrice * float64(line.Quantity)
+	}
+	discountShare := 0.0
+	if gross > 0 && discount > 0 {
+		discountShare = math.Min(discount, gross) / gross
+	}
+
+	makingRule := settings.MakingChargeRule()
+	for _, line := range lines {
+		quantity := float64(line.Quantity)
+		making := math.Min(math.Max(line.MakingCharge, 0), line.UnitPrice) * quantity
+		goods := line.UnitPrice*quantity - making
+
+		goodsRule := settings.GSTRuleFor(line.Category)
+		addLineTax(breakdown, line, models.TaxComponentGoods, goodsRule, goods*(1-discountShare))
+		if making > 0 {
+			addLineTax(breakdown, line, models.TaxComponentMaking, makingRule, making*(1-discountShare))
+		}
+	}
+
+	return breakdown
+}
+
+// addLineTax appends the tax on one component of a line and adds it to the totals
+func addLineTax(b *models.TaxBreakdown, line models.TaxableLine, component models.TaxComponent, rule models.GSTRule, value float64) {
+	value = roundPrice(value)
+	tax := models.LineTax{
+		LineIndex:    line.LineIndex,
+		ProductID:    line.ProductID,
+		Description:  line.Name,
+		Component:    component,
+		HSNCode:      rule.HSNCode,
+		Quantity:     line.Quantity,
+		TaxableValue: value,
+		Rate:         rule.Rate,
+	}
+	if component == models.TaxComponentMaking {
+		tax.Description = line.Name + " - making charges"
+	}
+
+	amount := value * rule.Rate / 100
+	if b.InterState {
+		tax.IGST = roundPrice(amount)
+	} else {
+		tax.CGST = roundPrice(amount / 2)
+		tax.SGST = roundPrice(amount / 2)
+	}
+	tax.Total = roundPrice(tax.CGST + tax.SGST + tax.IGST)
+
+	b.Lines = append(b.Lines, tax)
+	b.TaxableValue = roundPrice(b.TaxableValue + tax.TaxableValue)
+	b.CGST = roundPrice(b.CGST + tax.CGST)
+	b.SGST = roundPrice(b.SGST + tax.SGST)
+	b.IGST = roundPrice(b.IGST + tax.IGST)
+	b.Total = roundPrice(b.Total + tax.Total)
+}
+
+// makingChargeFor returns the part of a unit price that is making charges
+func makingChargeFor(product *models.Product, unitPrice float64) float64 {
+	if product.MakingCharge == nil || *product.MakingCharge <= 0 {
+		return 0
+	}
+	return math.Min(*product.MakingCharge, unitPrice)
+}
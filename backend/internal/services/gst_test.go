@@ -0,0 +1,100 @@
+package services
+
+import (
+	"testing"
+
+	"thyne-jewels-backend/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func gstTestLines() []models.TaxableLine {
+	return []models.TaxableLine{
+		{LineIndex: 0, ProductID: primitive.NewObjectID(), Name: "Ring", Category: "Rings", Quantity: 1, UnitPrice: 10000, MakingCharge: 2000},
+		{LineIndex: 1, ProductID: primitive.NewObjectID(), Name: "Solitaire", Category: "loose diamonds", Quantity: 1, UnitPrice: 50000},
+		{LineIndex: 2, ProductID: primitive.NewObjectID(), Name: "Gift box", Category: "Accessories", Quantity: 2, UnitPrice: 500},
+	}
+}
+
+func TestGSTSplitsIntraStateSupplies(t *testing.T) {
+	settings := models.DefaultStoreSettings()
+	breakdown := calculateGST(settings, gstTestLines(), 0, "MH")
+
+	if breakdown.InterState || breakdown.SupplierState != models.DefaultStoreState {
+		t.Fatalf("expected an intra-state supply from %s, got %+v", models.DefaultStoreState, breakdown)
+	}
+	if len(breakdown.Lines) != 4 {
+		t.Fatalf("expected goods and making lines for the ring plus one line each for the rest, got %+v", breakdown.Lines)
+	}
+
+	// Ring goods 8000 at 3%, making 2000 at 5%, diamond 50000 at 0.25%, accessories 1000 at the store rate
+	want := []struct {
+		component models.TaxComponent
+		hsn       string
+		rate      float64
+		total     float64
+	}{
+		{models.TaxComponentGoods, "7113", 3, 240},
+		{models.TaxComponentMaking, models.DefaultMakingChargeSAC, 5, 100},
+		{models.TaxComponentGoods, "7102", 0.25, 125},
+		{models.TaxComponentGoods, models.DefaultJewelleryHSN, models.DefaultJewelleryGSTRate, 30},
+	}
+	for i, w := range want {
+		line := breakdown.Lines[i]
+		if line.Component != w.component || line.HSNCode != w.hsn || line.Rate != w.rate || line.Total != w.total {
+			t.Fatalf("line %d: expected %+v, got %+v", i, w, line)
+		}
+		if line.IGST != 0 || line.CGST != line.SGST || line.CGST+line.SGST != line.Total {
+			t.Fatalf("line %d: expected an even CGST/SGST split, got %+v", i, line)
+		}
+	}
+	if breakdown.Total != 495 || breakdown.CGST != 247.5 || breakdown.SGST != 247.5 || breakdown.TaxableValue != 61000 {
+		t.Fatalf("unexpected totals %+v", breakdown)
+	}
+	if breakdown.LineTotal(0) != 340 {
+		t.Fatalf("expected the ring to carry 340 of GST, got %.2f", breakdown.LineTotal(0))
+	}
+
+	details := breakdown.Details(settings.StoreAddress)
+	if details.TaxType != "GST" || details.HSNCode != "" || details.CGST != 247.5 {
+		t.Fatalf("unexpected invoice tax details %+v", details)
+	}
+}
+
+func TestGSTChargesIGSTAcrossStatesAfterDiscount(t *testing.T) {
+	settings := models.DefaultStoreSettings()
+	breakdown := calculateGST(settings, gstTestLines(), 6100, "Karnataka")
+
+	if !breakdown.InterState || breakdown.PlaceOfSupply != "Karnataka" {
+		t.Fatalf("expected an inter-state supply to Karnataka, got %+v", breakdown)
+	}
+	// Every line loses 10% to the discount before tax
+	if breakdown.TaxableValue != 54900 || breakdown.IGST != 445.5 || breakdown.CGST != 0 || breakdown.Total != 445.5 {
+		t.Fatalf("unexpected totals %+v", breakdown)
+	}
+
+	settings.EnableGST = false
+	if off := calculateGST(settings, gstTestLines(), 0, "Karnataka"); off.Total != 0 || len(off.Lines) != 0 {
+		t.Fatalf("expected no tax with GST disabled, got %+v", off)
+	}
+}
+
+func TestOrderRefundUsesLineGST(t *testing.T) {
+	lines := gstTestLines()
+	order := models.Order{Subtotal: 61000}
+	for _, line := range lines {
+		order.Items = append(order.Items, models.OrderItem{
+			ProductID: line.ProductID, Name: line.Name, Category: line.Category,
+			Price: line.UnitPrice, Quantity: line.Quantity, MakingCharge: line.MakingCharge,
+		})
+	}
+	order.TaxBreakdown = calculateGST(models.DefaultStoreSettings(), order.TaxableLines(), 0, "Maharashtra")
+	order.Tax = order.TaxBreakdown.Total
+
+	if amount := order.ItemRefundAmount(0, 1); amount != 10340 {
+		t.Fatalf("expected the ring to refund 10340, got %.2f", amount)
+	}
+	if amount := order.ItemRefundAmount(2, 1); amount != 515 {
+		t.Fatalf("expected one accessory to refund 515, got %.2f", amount)
+	}
+}
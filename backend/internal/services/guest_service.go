@@ -1,7 +1,9 @@
 package services
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"time"
 
 	"thyne-jewels-backend/internal/models"
@@ -20,11 +22,16 @@ type GuestSessionService interface {
 	UpdateCartItem(sessionID string, productID primitive.ObjectID, quantity int) error
 	RemoveFromCart(sessionID string, productID primitive.ObjectID) error
 	ClearCart(sessionID string) error
+	MergeIntoUser(sessionID string, userID primitive.ObjectID) (*models.GuestMergeResult, error)
+	MergeIntoUserByPhone(sessionID string, phone string) (*models.GuestMergeResult, error)
 }
 
 type guestSessionService struct {
-	guestRepo repository.GuestSessionRepository
-	cartRepo  repository.CartRepository
+	guestRepo    repository.GuestSessionRepository
+	cartRepo     repository.CartRepository
+	orderRepo    repository.OrderRepository
+	homepageRepo repository.HomepageRepository
+	userRepo     repository.UserRepository
 }
 
 func NewGuestSessionService(guestRepo repository.GuestSessionRepository, cartRepo repository.CartRepository) GuestSessionService {
@@ -34,6 +41,21 @@ func NewGuestSessionService(guestRepo repository.GuestSessionRepository, cartRep
 	}
 }
 
+// SetOrderRepository enables moving guest orders to the user on merge
+func (s *guestSessionService) SetOrderRepository(orderRepo repository.OrderRepository) {
+	s.orderRepo = orderRepo
+}
+
+// SetHomepageRepository enables moving recently viewed products to the user on merge
+func (s *guestSessionService) SetHomepageRepository(homepageRepo repository.HomepageRepository) {
+	s.homepageRepo = homepageRepo
+}
+
+// SetUserRepository enables merging by verified phone number
+func (s *guestSessionService) SetUserRepository(userRepo repository.UserRepository) {
+	s.userRepo = userRepo
+}
+
 func (s *guestSessionService) CreateSession() (*models.GuestSession, error) {
 	session := models.NewGuestSession()
 	
@@ -150,3 +172,122 @@ func (s *guestSessionService) ClearCart(sessionID string) error {
 
 	return s.guestRepo.Update(nil, session)
 }
+
+// MergeIntoUser folds a guest session's cart, recently viewed products and orders
+// into a user account, then retires the guest session
+func (s *guestSessionService) MergeIntoUser(sessionID string, userID primitive.ObjectID) (*models.GuestMergeResult, error) {
+	ctx := context.Background()
+
+	if sessionID == "" {
+		return nil, errors.New("guest session ID is required")
+	}
+
+	result := &models.GuestMergeResult{SessionID: sessionID}
+
+	// Collect guest lines from the cart collection and the legacy session cart
+	var guestItems []models.CartItem
+	guestCart, err := s.cartRepo.GetByGuestSessionID(ctx, sessionID)
+	if err == nil {
+		guestItems = append(guestItems, guestCart.Items...)
+	}
+	session, sessionErr := s.guestRepo.GetBySessionID(ctx, sessionID)
+	if sessionErr == nil {
+		guestItems = append(guestItems, session.CartItems...)
+	}
+
+	if len(guestItems) > 0 {
+		merged, err := s.mergeCartItems(ctx, userID, guestItems)
+		if err != nil {
+			return nil, err
+		}
+		result.CartLinesMerged = merged
+	}
+	if guestCart != nil {
+		if err := s.cartRepo.Delete(ctx, guestCart.ID); err != nil {
+			fmt.Printf("Warning: failed to delete guest cart for session %s: %v\n", sessionID, err)
+		}
+	}
+
+	if s.homepageRepo != nil {
+		merged, err := s.homepageRepo.MergeRecentlyViewed(ctx, sessionID, userID)
+		if err != nil {
+			fmt.Printf("Warning: failed to merge recently viewed for session %s: %v\n", sessionID, err)
+		}
+		result.RecentlyViewed = merged
+	}
+
+	if s.orderRepo != nil {
+		assigned, err := s.orderRepo.AssignGuestOrders(ctx, sessionID, userID)
+		if err != nil {
+			fmt.Printf("Warning: failed to assign guest orders for session %s: %v\n", sessionID, err)
+		}
+		result.OrdersAssigned = assigned
+	}
+
+	// Retire the guest session so it cannot be merged again
+	if sessionErr == nil {
+		if err := s.guestRepo.DeleteBySessionID(ctx, sessionID); err != nil {
+			fmt.Printf("Warning: failed to retire guest session %s: %v\n", sessionID, err)
+		}
+	}
+
+	return result, nil
+}
+
+// MergeIntoUserByPhone merges a guest session into the account registered with the phone number
+func (s *guestSessionService) MergeIntoUserByPhone(sessionID string, phone string) (*models.GuestMergeResult, error) {
+	if s.userRepo == nil {
+		return nil, errors.New("user lookup is not configured")
+	}
+
+	user, err := s.userRepo.GetByPhone(context.Background(), phone)
+	if err != nil || user == nil {
+		return nil, errors.New("no account found for phone number")
+	}
+
+	return s.MergeIntoUser(sessionID, user.ID)
+}
+
+// mergeCartItems adds guest lines to the user's cart. Lines for the same product and
+// customization are combined, capped at the per-line maximum. Returns the number of guest lines merged.
+func (s *guestSessionService) mergeCartItems(ctx context.Context, userID primitive.ObjectID, items []models.CartItem) (int, error) {
+	userCart, err := s.cartRepo.GetByUserID(ctx, userID)
+	isNew := false
+	if err != nil {
+		if !errors.Is(err, repository.ErrCartNotFound) {
+			return 0, err
+		}
+		userCart = &models.Cart{
+			ID:     primitive.NewObjectID(),
+			UserID: userID,
+			Items:  []models.CartItem{},
+		}
+		isNew = true
+	}
+	userCart.EnsureItemIDs()
+
+	merged := 0
+	for _, item := range items {
+		if item.Quantity <= 0 {
+			continue
+		}
+		line := userCart.AddItem(item.ProductID, item.Customization, item.Quantity)
+		if item.VariantID != nil {
+			line.VariantID = item.VariantID
+		}
+		if line.Quantity > models.MaxCartLineQuantity {
+			line.Quantity = models.MaxCartLineQuantity
+		}
+		merged++
+	}
+
+	if isNew {
+		if err := s.cartRepo.Create(ctx, userCart); err != nil {
+			return 0, fmt.Errorf("failed to create user cart: %w", err)
+		}
+	} else if err := s.cartRepo.Update(ctx, userCart); err != nil {
+		return 0, fmt.Errorf("failed to update user cart: %w", err)
+	}
+
+	return merged, nil
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memoryGuestSessionRepository keeps guest sessions in memory
+type memoryGuestSessionRepository struct {
+	repository.GuestSessionRepository
+	sessions map[string]models.GuestSession
+}
+
+func (r *memoryGuestSessionRepository) GetBySessionID(ctx context.Context, sessionID string) (*models.GuestSession, error) {
+	session, ok := r.sessions[sessionID]
+	if !ok {
+		return nil, errors.New("guest session not found")
+	}
+	return &session, nil
+}
+
+func (r *memoryGuestSessionRepository) DeleteBySessionID(ctx context.Context, sessionID string) error {
+	delete(r.sessions, sessionID)
+	return nil
+}
+
+// memoryUserRepository finds users by phone number
+type memoryUserRepository struct {
+	repository.UserRepository
+	users []models.User
+}
+
+func (r *memoryUserRepository) GetByPhone(ctx context.Context, phone string) (*models.User, error) {
+	for _, user := range r.users {
+		if user.Phone == phone {
+			return &user, nil
+		}
+	}
+	return nil, errors.New("user not found")
+}
+
+func TestMergeGuestCartIntoUser(t *testing.T) {
+	ring, chain := primitive.NewObjectID(), primitive.NewObjectID()
+	variantID := primitive.NewObjectID()
+	size6 := &models.ProductCustomization{Metal: "18K Gold", RingSize: "6"}
+	userID := primitive.NewObjectID()
+
+	carts := &memoryCartRepository{carts: map[string]models.Cart{
+		userID.Hex(): {ID: primitive.NewObjectID(), UserID: userID, Items: []models.CartItem{
+			{ItemID: "u1", ProductID: ring, Quantity: 2, Customization: &models.ProductCustomization{RingSize: "6", Metal: "18K Gold"}, VariantID: &variantID},
+			{ItemID: "u2", ProductID: ring, Quantity: 1, Customization: &models.ProductCustomization{Metal: "18K Gold", RingSize: "7"}},
+		}},
+		"guest-1": {ID: primitive.NewObjectID(), GuestSessionID: "guest-1", Items: []models.CartItem{
+			{ItemID: "g1", ProductID: ring, Quantity: 3, Customization: size6, VariantID: &variantID},
+			{ItemID: "g2", ProductID: chain, Quantity: 9},
+		}},
+	}}
+	guests := &memoryGuestSessionRepository{sessions: map[string]models.GuestSession{
+		"guest-1": {SessionID: "guest-1", CartItems: []models.CartItem{{ProductID: chain, Quantity: 4}}},
+	}}
+	svc := NewGuestSessionService(guests, carts)
+
+	result, err := svc.MergeIntoUser("guest-1", userID)
+	if err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	if result.CartLinesMerged != 3 {
+		t.Fatalf("expected 3 guest lines merged, got %+v", result)
+	}
+
+	cart := carts.carts[userID.Hex()]
+	if len(cart.Items) != 3 {
+		t.Fatalf("expected lines with the same customization to be combined, got %+v", cart.Items)
+	}
+	sized := cart.Items[0]
+	if sized.ItemID != "u1" || sized.Quantity != 5 || sized.VariantID == nil || *sized.VariantID != variantID {
+		t.Fatalf("expected the size 6 ring lines to add up to 5, got %+v", sized)
+	}
+	if cart.Items[1].Quantity != 1 {
+		t.Fatalf("expected a different ring size to stay on its own line, got %+v", cart.Items[1])
+	}
+	if chainLine := cart.Items[2]; chainLine.ProductID != chain || chainLine.Quantity != models.MaxCartLineQuantity {
+		t.Fatalf("expected the chain lines to be combined and capped at %d, got %+v", models.MaxCartLineQuantity, chainLine)
+	}
+	if _, ok := carts.carts["guest-1"]; ok {
+		t.Fatal("expected the guest cart to be deleted")
+	}
+	if _, ok := guests.sessions["guest-1"]; ok {
+		t.Fatal("expected the guest session to be retired")
+	}
+}
+
+func TestMergeGuestCartIntoUserByPhone(t *testing.T) {
+	product := primitive.NewObjectID()
+	user := models.User{ID: primitive.NewObjectID(), Name: "Asha", Phone: "9000000001"}
+	carts := &memoryCartRepository{carts: map[string]models.Cart{
+		"guest-2": {ID: primitive.NewObjectID(), GuestSessionID: "guest-2", Items: []models.CartItem{{ItemID: "g1", ProductID: product, Quantity: 2}}},
+	}}
+	guests := &memoryGuestSessionRepository{sessions: map[string]models.GuestSession{}}
+	svc := NewGuestSessionService(guests, carts).(*guestSessionService)
+
+	if _, err := svc.MergeIntoUserByPhone("guest-2", user.Phone); err == nil {
+		t.Fatal("expected merging by phone to need a user lookup")
+	}
+	svc.SetUserRepository(&memoryUserRepository{users: []models.User{user}})
+	if _, err := svc.MergeIntoUserByPhone("guest-2", "9000000009"); err == nil {
+		t.Fatal("expected an unknown phone number to be refused")
+	}
+	if _, ok := carts.carts["guest-2"]; !ok {
+		t.Fatal("expected a refused merge to keep the guest cart")
+	}
+
+	// The user has no cart yet, so one is created for them
+	result, err := svc.MergeIntoUserByPhone("guest-2", user.Phone)
+	if err != nil {
+		t.Fatalf("merge by phone: %v", err)
+	}
+	cart, ok := carts.carts[user.ID.Hex()]
+	if !ok || result.CartLinesMerged != 1 || len(cart.Items) != 1 || cart.Items[0].Quantity != 2 {
+		t.Fatalf("expected the guest line in a new cart for the user, got %+v (%+v)", cart, result)
+	}
+	if _, ok := carts.carts["guest-2"]; ok {
+		t.Fatal("expected the guest cart to be deleted")
+	}
+}
@@ -0,0 +1,262 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"thyne-jewels-backend/internal/config"
+	"thyne-jewels-backend/internal/models"
+)
+
+// HTTPCarrier books and tracks shipments through a courier aggregator's JSON
+// API. Requests carry the API key as a bearer token; webhooks are signed with
+// an HMAC-SHA256 of the body in the X-Carrier-Signature header.
+type HTTPCarrier struct {
+	code          string
+	name          string
+	baseURL       string
+	apiKey        string
+	webhookSecret string
+	httpClient    *http.Client
+}
+
+// NewHTTPCarrier creates a carrier for the configured courier API
+func NewHTTPCarrier(cfg config.CarrierConfig) *HTTPCarrier {
+	return &HTTPCarrier{
+		code:          cfg.Code,
+		name:          cfg.Name,
+		baseURL:       strings.TrimRight(cfg.APIURL, "/"),
+		apiKey:        cfg.APIKey,
+		webhookSecret: cfg.WebhookSecret,
+		httpClient:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (c *HTTPCarrier) Code() string {
+	return c.code
+}
+
+func (c *HTTPCarrier) Name() string {
+	return c.name
+}
+
+func (c *HTTPCarrier) IsEnabled() bool {
+	return c.baseURL != "" && c.apiKey != ""
+}
+
+// httpCarrierAddress is the delivery address sent to the courier API
+type httpCarrierAddress struct {
+	Name    string `json:"name"`
+	Phone   string `json:"phone"`
+	Line1   string `json:"line1"`
+	Line2   string `json:"line2,omitempty"`
+	City    string `json:"city"`
+	State   string `json:"state"`
+	Pincode string `json:"pincode"`
+}
+
+// httpCarrierShipmentRequest is the body of a shipment booking
+type httpCarrierShipmentRequest struct {
+	Reference     string             `json:"reference"`
+	Service       string             `json:"service,omitempty"`
+	Weight        float64            `json:"weight"`
+	DeclaredValue float64            `json:"declaredValue"`
+	CODAmount     float64            `json:"codAmount"`
+	Deliver       httpCarrierAddress `json:"deliver"`
+	Items         []httpCarrierItem  `json:"items"`
+}
+
+type httpCarrierItem struct {
+	Name     string `json:"name"`
+	Quantity int    `json:"quantity"`
+}
+
+// httpCarrierShipment is the courier API's view of a shipment
+type httpCarrierShipment struct {
+	ShipmentID        string    `json:"shipmentId"`
+	AWB               string    `json:"awb"`
+	Courier           string    `json:"courier"`
+	LabelURL          string    `json:"labelUrl"`
+	EstimatedDelivery time.Time `json:"estimatedDelivery"`
+}
+
+// httpCarrierEvent is one tracking scan
+type httpCarrierEvent struct {
+	Status      string    `json:"status"`
+	Description string    `json:"description"`
+	Location    string    `json:"location"`
+	Timestamp   time.Time `json:"timestamp"`
+	SignedBy    string    `json:"signedBy,omitempty"`
+}
+
+// CreateShipment books a shipment for the order
+func (c *HTTPCarrier) CreateShipment(ctx context.Context, req *CarrierShipmentRequest) (*CarrierShipment, error) {
+	order := req.Order
+	address := order.ShippingAddress
+	body := httpCarrierShipmentRequest{
+		Reference:     order.OrderNumber,
+		Service:       req.Service,
+		Weight:        req.Weight,
+		DeclaredValue: order.Total,
+		Deliver: httpCarrierAddress{
+			Name:    address.RecipientName,
+			Phone:   address.RecipientPhone,
+			Line1:   strings.TrimSpace(address.HouseNoFloor + ", " + address.BuildingBlock),
+			Line2:   address.LandmarkArea,
+			City:    address.City,
+			State:   address.State,
+			Pincode: address.Pincode,
+		},
+	}
+	if order.PaymentMethod == models.PaymentMethodCOD && order.PaymentStatus != models.PaymentStatusPaid {
+		body.CODAmount = order.Total
+	}
+	for _, item := range order.Items {
+		body.Items = append(body.Items, httpCarrierItem{Name: item.Name, Quantity: item.Quantity})
+	}
+
+	var shipment httpCarrierShipment
+	if err := c.do(ctx, http.MethodPost, "/shipments", body, &shipment); err != nil {
+		return nil, err
+	}
+	if shipment.AWB == "" {
+		return nil, errors.New("courier API did not return an AWB number")
+	}
+
+	return &CarrierShipment{
+		ShipmentID:        shipment.ShipmentID,
+		TrackingID:        shipment.AWB,
+		CourierName:       shipment.Courier,
+		LabelURL:          shipment.LabelURL,
+		EstimatedDelivery: shipment.EstimatedDelivery,
+	}, nil
+}
+
+// GetLabel fetches the label URL; labels can be regenerated after booking
+func (c *HTTPCarrier) GetLabel(ctx context.Context, shipment *models.OrderTracking) (string, error) {
+	var resp struct {
+		LabelURL string `json:"labelUrl"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/shipments/"+url.PathEscape(shipment.ShipmentID)+"/label", nil, &resp); err != nil {
+		return "", err
+	}
+	return resp.LabelURL, nil
+}
+
+// Track fetches every scan of the shipment
+func (c *HTTPCarrier) Track(ctx context.Context, shipment *models.OrderTracking) ([]models.TrackingEvent, error) {
+	var resp struct {
+		Events []httpCarrierEvent `json:"events"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/shipments/"+url.PathEscape(shipment.ShipmentID)+"/tracking", nil, &resp); err != nil {
+		return nil, err
+	}
+	return trackingEvents(resp.Events), nil
+}
+
+// Cancel cancels the shipment with the courier
+func (c *HTTPCarrier) Cancel(ctx context.Context, shipment *models.OrderTracking) error {
+	return c.do(ctx, http.MethodPost, "/shipments/"+url.PathEscape(shipment.ShipmentID)+"/cancel", nil, nil)
+}
+
+// ParseWebhook verifies the signature of a tracking webhook and reads its scans
+func (c *HTTPCarrier) ParseWebhook(ctx context.Context, payload []byte, headers http.Header) (*CarrierWebhookEvent, error) {
+	if c.webhookSecret == "" {
+		return nil, errors.New("carrier webhook secret is not configured")
+	}
+	mac := hmac.New(sha256.New, []byte(c.webhookSecret))
+	mac.Write(payload)
+	expected := hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(headers.Get("X-Carrier-Signature"))) {
+		return nil, ErrInvalidCarrierSignature
+	}
+
+	var body struct {
+		AWB    string             `json:"awb"`
+		Events []httpCarrierEvent `json:"events"`
+	}
+	if err := json.Unmarshal(payload, &body); err != nil {
+		return nil, fmt.Errorf("failed to parse webhook payload: %w", err)
+	}
+	if body.AWB == "" {
+		return nil, errors.New("webhook payload has no AWB number")
+	}
+
+	return &CarrierWebhookEvent{TrackingID: body.AWB, Events: trackingEvents(body.Events)}, nil
+}
+
+// do sends a request to the courier API and decodes the JSON response into out
+func (c *HTTPCarrier) do(ctx context.Context, method, path string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		jsonData, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		reader = bytes.NewReader(jsonData)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal(respBody, &apiErr); err == nil && apiErr.Error != "" {
+			return fmt.Errorf("%s API error: %s", c.name, apiErr.Error)
+		}
+		return fmt.Errorf("%s API error: status %d", c.name, resp.StatusCode)
+	}
+
+	if out == nil || len(respBody) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
+
+// trackingEvents converts courier scans to tracking events
+func trackingEvents(scans []httpCarrierEvent) []models.TrackingEvent {
+	events := make([]models.TrackingEvent, 0, len(scans))
+	for _, scan := range scans {
+		events = append(events, models.TrackingEvent{
+			Status:      scan.Status,
+			Description: scan.Description,
+			Location:    scan.Location,
+			Timestamp:   scan.Timestamp,
+			SignedBy:    scan.SignedBy,
+		})
+	}
+	return events
+}
@@ -0,0 +1,388 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// ErrInventoryNotFound is returned for unknown products, orders, units, HUIDs,
+	// users, stock locations and transfers
+	ErrInventoryNotFound = errors.New("not found")
+	// ErrUnitAssignmentNotAllowed is returned when pieces cannot be packed into an order as asked
+	ErrUnitAssignmentNotAllowed = errors.New("unit assignment not allowed")
+)
+
+// InventoryUnitService tracks the physical pieces of each product by serial
+// and BIS hallmark HUID, records which pieces were packed into which order
+// line, and finds the order a hallmarked piece was sold in.
+type InventoryUnitService interface {
+	CreateUnits(productID string, req *models.CreateInventoryUnitsRequest) ([]models.InventoryUnit, error)
+	ListProductUnits(productID string, status models.InventoryUnitStatus) ([]models.InventoryUnit, error)
+	UpdateUnit(productID, unitID string, req *models.UpdateInventoryUnitRequest) (*models.InventoryUnit, error)
+	AssignOrderUnits(orderID string, req *models.AssignOrderUnitsRequest, actor models.OrderActor) (*models.Order, error)
+	// ReleaseOrderUnits puts the pieces of a cancelled order back into stock.
+	// The order's lines are updated in place; callers persist the order.
+	ReleaseOrderUnits(ctx context.Context, order *models.Order) error
+	LookupHUID(huid string) (*models.HUIDLookup, error)
+}
+
+type inventoryUnitService struct {
+	unitRepo    repository.InventoryUnitRepository
+	productRepo repository.ProductRepository
+	orderRepo   repository.OrderRepository
+}
+
+// NewInventoryUnitService creates a new inventory unit service
+func NewInventoryUnitService(unitRepo repository.InventoryUnitRepository, productRepo repository.ProductRepository, orderRepo repository.OrderRepository) InventoryUnitService {
+	return &inventoryUnitService{
+		unitRepo:    unitRepo,
+		productRepo: productRepo,
+		orderRepo:   orderRepo,
+	}
+}
+
+// CreateUnits adds pieces to a product's inventory. A unit without a purity
+// takes the purity of the product's metal.
+func (s *inventoryUnitService) CreateUnits(productID string, req *models.CreateInventoryUnitsRequest) ([]models.InventoryUnit, error) {
+	ctx := context.Background()
+	product, err := s.product(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	units := make([]models.InventoryUnit, 0, len(req.Units))
+	for _, entry := range req.Units {
+		unit := models.InventoryUnit{
+			ProductID:   product.ID,
+			Serial:      strings.TrimSpace(entry.Serial),
+			HUID:        models.NormalizeHUID(entry.HUID),
+			GrossWeight: entry.GrossWeight,
+			NetWeight:   entry.NetWeight,
+			Purity:      strings.TrimSpace(entry.Purity),
+			Status:      models.InventoryUnitInStock,
+			Notes:       entry.Notes,
+		}
+		if unit.Purity == "" {
+			unit.Purity = models.MetalPurity(product.MetalType)
+		}
+		if err := validateUnit(&unit); err != nil {
+			return nil, err
+		}
+		units = append(units, unit)
+	}
+
+	// Serials and HUIDs are unique, so a failure part way leaves the units
+	// before it in place and the batch can be sent again without them
+	for i := range units {
+		if err := s.unitRepo.Create(ctx, &units[i]); err != nil {
+			return units[:i], err
+		}
+	}
+
+	return units, nil
+}
+
+func (s *inventoryUnitService) ListProductUnits(productID string, status models.InventoryUnitStatus) ([]models.InventoryUnit, error) {
+	ctx := context.Background()
+	product, err := s.product(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.unitRepo.GetByProduct(ctx, product.ID, status)
+}
+
+// UpdateUnit corrects the details of a piece that has not been sold, or takes
+// it in or out of stock. A sold piece can only be put back into stock once its
+// order has been returned.
+func (s *inventoryUnitService) UpdateUnit(productID, unitID string, req *models.UpdateInventoryUnitRequest) (*models.InventoryUnit, error) {
+	ctx := context.Background()
+	unit, err := s.unit(ctx, productID, unitID)
+	if err != nil {
+		return nil, err
+	}
+
+	if unit.Status == models.InventoryUnitSold {
+		return s.restockSoldUnit(ctx, unit, req)
+	}
+
+	if req.Serial != nil {
+		unit.Serial = strings.TrimSpace(*req.Serial)
+	}
+	if req.HUID != nil {
+		unit.HUID = models.NormalizeHUID(*req.HUID)
+	}
+	if req.GrossWeight != nil {
+		unit.GrossWeight = *req.GrossWeight
+	}
+	if req.NetWeight != nil {
+		unit.NetWeight = *req.NetWeight
+	}
+	if req.Purity != nil {
+		unit.Purity = strings.TrimSpace(*req.Purity)
+	}
+	if req.Notes != nil {
+		unit.Notes = *req.Notes
+	}
+	if req.Status != nil {
+		switch *req.Status {
+		case models.InventoryUnitInStock, models.InventoryUnitRetired:
+			unit.Status = *req.Status
+		default:
+			return nil, fmt.Errorf("%w: units are sold by packing them into an order", ErrUnitAssignmentNotAllowed)
+		}
+	}
+	if err := validateUnit(unit); err != nil {
+		return nil, err
+	}
+
+	if err := s.unitRepo.Update(ctx, unit); err != nil {
+		return nil, err
+	}
+	return unit, nil
+}
+
+// restockSoldUnit puts a sold piece back into stock when it came back from the
+// customer. The order keeps its copy of the piece, so the HUID still leads to it.
+func (s *inventoryUnitService) restockSoldUnit(ctx context.Context, unit *models.InventoryUnit, req *models.UpdateInventoryUnitRequest) (*models.InventoryUnit, error) {
+	if req.Status == nil || *req.Status != models.InventoryUnitInStock || unit.OrderID == nil {
+		return nil, fmt.Errorf("%w: %s was sold in order %s and cannot be edited", ErrUnitAssignmentNotAllowed, unit.Serial, unit.OrderNumber)
+	}
+
+	order, err := s.orderRepo.GetByID(ctx, *unit.OrderID)
+	if err != nil {
+		return nil, fmt.Errorf("order %w", ErrInventoryNotFound)
+	}
+	returned := order.Status == models.OrderStatusReturned
+	if unit.LineIndex != nil && *unit.LineIndex < len(order.Items) && order.Items[*unit.LineIndex].ReturnedQuantity > 0 {
+		returned = true
+	}
+	if !returned {
+		return nil, fmt.Errorf("%w: order %s has not been returned", ErrUnitAssignmentNotAllowed, order.OrderNumber)
+	}
+
+	if err := s.unitRepo.Release(ctx, unit.ID, order.ID); err != nil {
+		return nil, err
+	}
+	return s.unitRepo.GetByID(ctx, unit.ID)
+}
+
+// AssignOrderUnits records the pieces packed into the lines of a confirmed or
+// processing order, one piece per unit ordered. Pieces are given by serial or
+// HUID, and gold pieces must carry a HUID. Packing a line again replaces its
+// pieces and puts the old ones back into stock.
+func (s *inventoryUnitService) AssignOrderUnits(orderID string, req *models.AssignOrderUnitsRequest, actor models.OrderActor) (*models.Order, error) {
+	ctx := context.Background()
+	objID, err := primitive.ObjectIDFromHex(orderID)
+	if err != nil {
+		return nil, errors.New("invalid order ID")
+	}
+	order, err := s.orderRepo.GetByID(ctx, objID)
+	if err != nil {
+		return nil, fmt.Errorf("order %w", ErrInventoryNotFound)
+	}
+	if order.Status != models.OrderStatusConfirmed && order.Status != models.OrderStatusProcessing {
+		return nil, fmt.Errorf("%w: %s orders cannot be packed", ErrUnitAssignmentNotAllowed, order.Status)
+	}
+
+	// Check every line before taking any piece out of stock
+	packed := make(map[int][]*models.InventoryUnit)
+	seen := make(map[primitive.ObjectID]bool)
+	for _, line := range req.Items {
+		if line.LineIndex < 0 || line.LineIndex >= len(order.Items) {
+			return nil, fmt.Errorf("%w: order %s has no line %d", ErrUnitAssignmentNotAllowed, order.OrderNumber, line.LineIndex)
+		}
+		if _, ok := packed[line.LineIndex]; ok {
+			return nil, fmt.Errorf("%w: line %d is listed twice", ErrUnitAssignmentNotAllowed, line.LineIndex)
+		}
+		item := order.Items[line.LineIndex]
+		if len(line.Units) != item.Quantity {
+			return nil, fmt.Errorf("%w: %s needs %d pieces, got %d", ErrUnitAssignmentNotAllowed, item.Name, item.Quantity, len(line.Units))
+		}
+
+		metal := ""
+		if product, err := s.productRepo.GetByID(ctx, item.ProductID); err == nil {
+			metal = product.MetalType
+		}
+		if item.Customization != nil && item.Customization.Metal != "" {
+			metal = item.Customization.Metal
+		}
+
+		units := make([]*models.InventoryUnit, 0, len(line.Units))
+		for _, code := range line.Units {
+			unit, err := s.unitRepo.GetByCode(ctx, strings.TrimSpace(code))
+			if err != nil {
+				return nil, fmt.Errorf("%w: no piece %s", ErrUnitAssignmentNotAllowed, code)
+			}
+			if unit.ProductID != item.ProductID {
+				return nil, fmt.Errorf("%w: %s is not a piece of %s", ErrUnitAssignmentNotAllowed, unit.Serial, item.Name)
+			}
+			if seen[unit.ID] {
+				return nil, fmt.Errorf("%w: %s is listed twice", ErrUnitAssignmentNotAllowed, unit.Serial)
+			}
+			if unit.Status != models.InventoryUnitInStock && !unitOnLine(unit, order.ID, line.LineIndex) {
+				return nil, fmt.Errorf("%w: %s is %s", ErrUnitAssignmentNotAllowed, unit.Serial, unit.Status)
+			}
+			if unit.HUID == "" && models.RequiresHUID(metal) {
+				return nil, fmt.Errorf("%w: %s has no HUID; gold jewellery must be hallmarked", ErrUnitAssignmentNotAllowed, unit.Serial)
+			}
+			seen[unit.ID] = true
+			units = append(units, unit)
+		}
+		packed[line.LineIndex] = units
+	}
+
+	// Take the pieces out of stock, undoing this request's allocations if one
+	// was packed elsewhere in the meantime
+	var allocated []primitive.ObjectID
+	for lineIndex, units := range packed {
+		for i, unit := range units {
+			if unitOnLine(unit, order.ID, lineIndex) {
+				continue
+			}
+			taken, err := s.unitRepo.Allocate(ctx, unit.ID, order.ID, order.OrderNumber, lineIndex, actor)
+			if err != nil {
+				for _, unitID := range allocated {
+					if relErr := s.unitRepo.Release(ctx, unitID, order.ID); relErr != nil {
+						fmt.Printf("Warning: failed to release inventory unit %s: %v\n", unitID.Hex(), relErr)
+					}
+				}
+				if errors.Is(err, repository.ErrInventoryUnitUnavailable) {
+					return nil, fmt.Errorf("%w: %s was just packed into another order", ErrUnitAssignmentNotAllowed, unit.Serial)
+				}
+				return nil, err
+			}
+			allocated = append(allocated, taken.ID)
+			units[i] = taken
+		}
+	}
+
+	for lineIndex, units := range packed {
+		item := &order.Items[lineIndex]
+		kept := make(map[primitive.ObjectID]bool)
+		assignments := make([]models.AssignedUnit, 0, len(units))
+		for _, unit := range units {
+			kept[unit.ID] = true
+			assignments = append(assignments, unit.Assignment())
+		}
+		for _, previous := range item.Units {
+			if !kept[previous.UnitID] {
+				if err := s.unitRepo.Release(ctx, previous.UnitID, order.ID); err != nil {
+					fmt.Printf("Warning: failed to release inventory unit %s of order %s: %v\n", previous.Serial, order.OrderNumber, err)
+				}
+			}
+		}
+		item.Units = assignments
+	}
+
+	if err := s.orderRepo.Update(ctx, order); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+func (s *inventoryUnitService) ReleaseOrderUnits(ctx context.Context, order *models.Order) error {
+	var failed error
+	for i := range order.Items {
+		item := &order.Items[i]
+		for _, unit := range item.Units {
+			if err := s.unitRepo.Release(ctx, unit.UnitID, order.ID); err != nil {
+				failed = err
+			}
+		}
+		item.Units = nil
+	}
+	return failed
+}
+
+// LookupHUID finds a hallmarked piece and the orders it was sold in, for
+// after-sales service
+func (s *inventoryUnitService) LookupHUID(huid string) (*models.HUIDLookup, error) {
+	ctx := context.Background()
+	huid = models.NormalizeHUID(huid)
+	if err := models.ValidateHUID(huid); err != nil {
+		return nil, err
+	}
+
+	lookup := &models.HUIDLookup{HUID: huid, Orders: []models.Order{}}
+	if unit, err := s.unitRepo.GetByHUID(ctx, huid); err == nil {
+		lookup.Unit = unit
+		if product, err := s.productRepo.GetByID(ctx, unit.ProductID); err == nil {
+			lookup.Product = product
+		}
+	}
+
+	orders, err := s.orderRepo.GetByUnitHUID(ctx, huid)
+	if err != nil {
+		return nil, err
+	}
+	if orders != nil {
+		lookup.Orders = orders
+	}
+
+	if lookup.Unit == nil && len(lookup.Orders) == 0 {
+		return nil, fmt.Errorf("HUID %s %w", huid, ErrInventoryNotFound)
+	}
+	return lookup, nil
+}
+
+func (s *inventoryUnitService) product(ctx context.Context, productID string) (*models.Product, error) {
+	objID, err := primitive.ObjectIDFromHex(productID)
+	if err != nil {
+		return nil, errors.New("invalid product ID")
+	}
+	product, err := s.productRepo.GetByID(ctx, objID)
+	if err != nil {
+		return nil, fmt.Errorf("product %w", ErrInventoryNotFound)
+	}
+	return product, nil
+}
+
+func (s *inventoryUnitService) unit(ctx context.Context, productID, unitID string) (*models.InventoryUnit, error) {
+	productObjID, err := primitive.ObjectIDFromHex(productID)
+	if err != nil {
+		return nil, errors.New("invalid product ID")
+	}
+	unitObjID, err := primitive.ObjectIDFromHex(unitID)
+	if err != nil {
+		return nil, errors.New("invalid unit ID")
+	}
+
+	unit, err := s.unitRepo.GetByID(ctx, unitObjID)
+	if err != nil || unit.ProductID != productObjID {
+		return nil, fmt.Errorf("inventory unit %w", ErrInventoryNotFound)
+	}
+	return unit, nil
+}
+
+// unitOnLine reports whether the unit is already packed into the order line
+func unitOnLine(unit *models.InventoryUnit, orderID primitive.ObjectID, lineIndex int) bool {
+	return unit.Status == models.InventoryUnitSold && unit.OrderID != nil && *unit.OrderID == orderID &&
+		unit.LineIndex != nil && *unit.LineIndex == lineIndex
+}
+
+func validateUnit(unit *models.InventoryUnit) error {
+	if unit.Serial == "" {
+		return errors.New("serial is required")
+	}
+	if unit.HUID != "" {
+		if err := models.ValidateHUID(unit.HUID); err != nil {
+			return err
+		}
+	}
+	if unit.GrossWeight <= 0 || unit.NetWeight <= 0 {
+		return errors.New("gross and net weight must be positive")
+	}
+	if unit.NetWeight > unit.GrossWeight {
+		return errors.New("net weight cannot exceed gross weight")
+	}
+	return nil
+}
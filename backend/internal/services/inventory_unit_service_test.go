@@ -0,0 +1,234 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memoryInventoryUnitRepository keeps inventory units in memory
+type memoryInventoryUnitRepository struct {
+	repository.InventoryUnitRepository
+	units []models.InventoryUnit
+}
+
+func (r *memoryInventoryUnitRepository) Create(ctx context.Context, unit *models.InventoryUnit) error {
+	for _, existing := range r.units {
+		if existing.Serial == unit.Serial || (unit.HUID != "" && existing.HUID == unit.HUID) {
+			return errors.New("duplicate serial or HUID")
+		}
+	}
+	unit.ID = primitive.NewObjectID()
+	unit.CreatedAt = time.Now()
+	r.units = append(r.units, *unit)
+	return nil
+}
+
+func (r *memoryInventoryUnitRepository) Update(ctx context.Context, unit *models.InventoryUnit) error {
+	for i := range r.units {
+		if r.units[i].ID == unit.ID {
+			r.units[i] = *unit
+			return nil
+		}
+	}
+	return errors.New("inventory unit not found")
+}
+
+func (r *memoryInventoryUnitRepository) find(match func(models.InventoryUnit) bool) (*models.InventoryUnit, error) {
+	for _, unit := range r.units {
+		if match(unit) {
+			return &unit, nil
+		}
+	}
+	return nil, errors.New("inventory unit not found")
+}
+
+func (r *memoryInventoryUnitRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.InventoryUnit, error) {
+	return r.find(func(unit models.InventoryUnit) bool { return unit.ID == id })
+}
+
+func (r *memoryInventoryUnitRepository) GetByCode(ctx context.Context, code string) (*models.InventoryUnit, error) {
+	if unit, err := r.find(func(unit models.InventoryUnit) bool { return unit.Serial == code }); err == nil {
+		return unit, nil
+	}
+	return r.GetByHUID(ctx, models.NormalizeHUID(code))
+}
+
+func (r *memoryInventoryUnitRepository) GetByHUID(ctx context.Context, huid string) (*models.InventoryUnit, error) {
+	return r.find(func(unit models.InventoryUnit) bool { return unit.HUID != "" && unit.HUID == huid })
+}
+
+func (r *memoryInventoryUnitRepository) Allocate(ctx context.Context, unitID, orderID primitive.ObjectID, orderNumber string, lineIndex int, actor models.OrderActor) (*models.InventoryUnit, error) {
+	for i := range r.units {
+		unit := &r.units[i]
+		if unit.ID != unitID {
+			continue
+		}
+		if unit.Status != models.InventoryUnitInStock {
+			return nil, repository.ErrInventoryUnitUnavailable
+		}
+		now := time.Now()
+		unit.Status = models.InventoryUnitSold
+		unit.OrderID = &orderID
+		unit.OrderNumber = orderNumber
+		unit.LineIndex = &lineIndex
+		unit.AssignedAt = &now
+		unit.AssignedBy = &actor
+		allocated := *unit
+		return &allocated, nil
+	}
+	return nil, repository.ErrInventoryUnitUnavailable
+}
+
+func (r *memoryInventoryUnitRepository) Release(ctx context.Context, unitID, orderID primitive.ObjectID) error {
+	for i := range r.units {
+		unit := &r.units[i]
+		if unit.ID == unitID && unit.OrderID != nil && *unit.OrderID == orderID && unit.Status == models.InventoryUnitSold {
+			unit.Status = models.InventoryUnitInStock
+			unit.OrderID, unit.OrderNumber, unit.LineIndex, unit.AssignedAt, unit.AssignedBy = nil, "", nil, nil, nil
+		}
+	}
+	return nil
+}
+
+func (r *memoryOrderRepository) GetByUnitHUID(ctx context.Context, huid string) ([]models.Order, error) {
+	var orders []models.Order
+	for _, order := range r.orders {
+		for _, item := range order.Items {
+			for _, unit := range item.Units {
+				if unit.HUID == huid {
+					orders = append(orders, order)
+				}
+			}
+		}
+	}
+	return orders, nil
+}
+
+func TestHallmarkedUnitsPackedIntoOrders(t *testing.T) {
+	ring := models.Product{ID: primitive.NewObjectID(), Name: "Temple Ring", MetalType: "22K Gold", IsAvailable: true}
+	order := models.Order{
+		ID:          primitive.NewObjectID(),
+		OrderNumber: "TJ-6001",
+		UserID:      primitive.NewObjectID(),
+		Items: []models.OrderItem{
+			{ProductID: ring.ID, Name: "Temple Ring", Quantity: 2, Price: 42000},
+		},
+		PaymentMethod: models.PaymentMethodCOD,
+		PaymentStatus: models.PaymentStatusPending,
+		Status:        models.OrderStatusConfirmed,
+	}
+	other := models.Order{
+		ID:          primitive.NewObjectID(),
+		OrderNumber: "TJ-6002",
+		Items:       []models.OrderItem{{ProductID: ring.ID, Name: "Temple Ring", Quantity: 1, Price: 42000}},
+		Status:      models.OrderStatusProcessing,
+	}
+	unitRepo := &memoryInventoryUnitRepository{}
+	orderRepo := &memoryOrderRepository{orders: map[primitive.ObjectID]models.Order{order.ID: order, other.ID: other}}
+	productRepo := &memoryProductRepository{products: map[primitive.ObjectID]models.Product{ring.ID: ring}}
+	svc := NewInventoryUnitService(unitRepo, productRepo, orderRepo)
+	admin := models.OrderActor{Type: models.OrderActorAdmin, ID: "admin-1"}
+
+	if _, err := svc.CreateUnits(ring.ID.Hex(), &models.CreateInventoryUnitsRequest{Units: []models.CreateInventoryUnitRequest{
+		{Serial: "TR-001", HUID: "AB12", GrossWeight: 6.2, NetWeight: 6.0},
+	}}); !errors.Is(err, models.ErrInvalidHUID) {
+		t.Fatalf("expected a short HUID to be refused, got %v", err)
+	}
+	units, err := svc.CreateUnits(ring.ID.Hex(), &models.CreateInventoryUnitsRequest{Units: []models.CreateInventoryUnitRequest{
+		{Serial: "TR-001", HUID: "ab12cd", GrossWeight: 6.21, NetWeight: 6.05},
+		{Serial: "TR-002", HUID: "EF34GH", GrossWeight: 6.18, NetWeight: 6.02},
+		{Serial: "TR-003", GrossWeight: 6.30, NetWeight: 6.10},
+		{Serial: "TR-004", HUID: "JK56LM", GrossWeight: 6.25, NetWeight: 6.08},
+	}})
+	if err != nil {
+		t.Fatalf("create units: %v", err)
+	}
+	if units[0].HUID != "AB12CD" || units[0].Purity != "22K (916)" || units[0].Status != models.InventoryUnitInStock {
+		t.Fatalf("unexpected unit %+v", units[0])
+	}
+
+	pack := func(orderID primitive.ObjectID, codes ...string) (*models.Order, error) {
+		return svc.AssignOrderUnits(orderID.Hex(), &models.AssignOrderUnitsRequest{Items: []models.AssignOrderLineUnits{{LineIndex: 0, Units: codes}}}, admin)
+	}
+	if _, err := pack(order.ID, "TR-001"); !errors.Is(err, ErrUnitAssignmentNotAllowed) {
+		t.Fatalf("expected one piece per unit ordered, got %v", err)
+	}
+	if _, err := pack(order.ID, "TR-001", "TR-003"); !errors.Is(err, ErrUnitAssignmentNotAllowed) {
+		t.Fatalf("expected gold without a HUID to be refused, got %v", err)
+	}
+
+	// Pieces can be scanned by serial or HUID
+	packed, err := pack(order.ID, "TR-001", "ef34gh")
+	if err != nil {
+		t.Fatalf("pack: %v", err)
+	}
+	if huids := packed.Items[0].HUIDs(); len(huids) != 2 || huids[0] != "AB12CD" || huids[1] != "EF34GH" {
+		t.Fatalf("expected both hallmarks on the line, got %+v", packed.Items[0].Units)
+	}
+	if _, err := pack(other.ID, "TR-002"); !errors.Is(err, ErrUnitAssignmentNotAllowed) {
+		t.Fatalf("expected a sold piece not to be packed again, got %v", err)
+	}
+
+	// Repacking swaps TR-002 for TR-004 and puts TR-002 back into stock
+	if _, err := pack(order.ID, "TR-001", "TR-004"); err != nil {
+		t.Fatalf("repack: %v", err)
+	}
+	if swapped, _ := unitRepo.GetByCode(context.Background(), "TR-002"); swapped.Status != models.InventoryUnitInStock {
+		t.Fatalf("expected the swapped piece back in stock, got %s", swapped.Status)
+	}
+	if _, err := pack(other.ID, "TR-002"); err != nil {
+		t.Fatalf("expected the swapped piece to be packed elsewhere, got %v", err)
+	}
+
+	// Sold pieces cannot be edited until they come back
+	inStock := models.InventoryUnitInStock
+	if _, err := svc.UpdateUnit(ring.ID.Hex(), units[0].ID.Hex(), &models.UpdateInventoryUnitRequest{Status: &inStock}); !errors.Is(err, ErrUnitAssignmentNotAllowed) {
+		t.Fatalf("expected a sold piece to stay sold, got %v", err)
+	}
+
+	// The certificate of each unit carries its own piece
+	delivered := time.Now()
+	shipped := orderRepo.orders[order.ID]
+	shipped.Status = models.OrderStatusDelivered
+	shipped.DeliveredAt = &delivered
+	certificates, err := NewCertificateService(&memoryCertificateRepository{}, orderRepo, []byte("key")).IssueCertificates(context.Background(), &shipped)
+	if err != nil || len(certificates) != 2 {
+		t.Fatalf("issue certificates: %v", err)
+	}
+	if second := certificates[1]; second.HUID != "JK56LM" || second.Serial != "TR-004" || second.GradingDetails.Weight != 6.25 || second.GradingDetails.NetWeight != 6.08 {
+		t.Errorf("expected the certificate to record TR-004, got %+v", second)
+	}
+
+	lookup, err := svc.LookupHUID("ab 12 cd")
+	if err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+	if lookup.Unit == nil || lookup.Unit.Serial != "TR-001" || lookup.Product.Name != "Temple Ring" || len(lookup.Orders) != 1 || lookup.Orders[0].OrderNumber != "TJ-6001" {
+		t.Fatalf("unexpected lookup %+v", lookup)
+	}
+	if _, err := svc.LookupHUID("ZZ99ZZ"); !errors.Is(err, ErrInventoryNotFound) {
+		t.Fatalf("expected an unknown HUID not to be found, got %v", err)
+	}
+
+	// Cancelling a packed order puts its pieces back into stock
+	orderSvc := NewOrderService(orderRepo, nil, nil).(*orderService)
+	orderSvc.SetInventoryUnitService(svc)
+	if err := orderSvc.CancelOrder(order.ID.Hex(), admin, "Customer changed their mind"); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	for _, serial := range []string{"TR-001", "TR-004"} {
+		if unit, _ := unitRepo.GetByCode(context.Background(), serial); unit.Status != models.InventoryUnitInStock || unit.OrderID != nil {
+			t.Errorf("expected %s back in stock, got %+v", serial, unit)
+		}
+	}
+	if cancelled := orderRepo.orders[order.ID]; len(cancelled.Items[0].Units) != 0 {
+		t.Errorf("expected the cancelled order to release its pieces, got %+v", cancelled.Items[0].Units)
+	}
+}
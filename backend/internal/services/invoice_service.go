@@ -3,6 +3,7 @@ package services
 import (
 	"context"
 	"encoding/csv"
+	"errors"
 	"fmt"
 	"time"
 
@@ -22,13 +23,30 @@ type InvoiceService interface {
 	ListInvoices(ctx context.Context, filter *models.InvoiceFilter) ([]models.Invoice, int64, error)
 	MarkAsDownloaded(ctx context.Context, invoiceID string) error
 	GenerateCSVData(ctx context.Context, invoices []models.Invoice) ([]byte, error)
-	DeleteInvoice(ctx context.Context, invoiceID string) error
+	VoidInvoice(ctx context.Context, invoiceID string, actor models.OrderActor, reason string) (*models.Invoice, error)
+	IssueCreditNote(ctx context.Context, order *models.Order, refund *models.PaymentRefund) (*models.CreditNote, error)
+	GetCreditNotes(ctx context.Context, invoiceID string, actor models.OrderActor) ([]models.CreditNote, error)
+	ListCreditNotes(ctx context.Context, filter *models.CreditNoteFilter) ([]models.CreditNote, int64, error)
+	GetEInvoice(ctx context.Context, invoiceID string) (*models.EInvoiceResult, error)
+	GetEInvoiceBatch(ctx context.Context, from, to time.Time) (*models.EInvoiceBatch, error)
 }
 
+var (
+	// ErrInvoiceNotFound is returned for unknown invoices and invoices of other customers
+	ErrInvoiceNotFound = errors.New("invoice not found")
+	// ErrInvoiceNotVoidable is returned for void invoices and invoices with credit notes
+	ErrInvoiceNotVoidable = errors.New("invoice cannot be voided")
+)
+
+// maxCSVCreditNotes caps the credit notes loaded for one CSV export
+const maxCSVCreditNotes = 10000
+
 type invoiceService struct {
-	invoiceRepo repository.InvoiceRepository
-	orderRepo   repository.OrderRepository
-	userRepo    repository.UserRepository
+	invoiceRepo    repository.InvoiceRepository
+	orderRepo      repository.OrderRepository
+	userRepo       repository.UserRepository
+	storefrontRepo *repository.StorefrontDataRepository
+	creditNoteRepo repository.CreditNoteRepository
 }
 
 // NewInvoiceService creates a new invoice service
@@ -40,6 +58,16 @@ func NewInvoiceService(invoiceRepo repository.InvoiceRepository, orderRepo repos
 	}
 }
 
+// SetStorefrontRepo enables the store's GST number and address on invoices
+func (s *invoiceService) SetStorefrontRepo(storefrontRepo *repository.StorefrontDataRepository) {
+	s.storefrontRepo = storefrontRepo
+}
+
+// SetCreditNoteRepository enables credit notes for refunds
+func (s *invoiceService) SetCreditNoteRepository(creditNoteRepo repository.CreditNoteRepository) {
+	s.creditNoteRepo = creditNoteRepo
+}
+
 // GenerateInvoice generates an invoice for an order
 func (s *invoiceService) GenerateInvoice(ctx context.Context, orderID string) (*models.Invoice, error) {
 	// Convert order ID to ObjectID
@@ -50,7 +78,7 @@ func (s *invoiceService) GenerateInvoice(ctx context.Context, orderID string) (*
 
 	// Check if invoice already exists for this order
 	existingInvoice, err := s.invoiceRepo.GetByOrderID(ctx, orderObjID)
-	if err == nil && existingInvoice != nil {
+	if err == nil && existingInvoice != nil && existingInvoice.Sequence > 0 {
 		return existingInvoice, nil
 	}
 
@@ -60,17 +88,21 @@ func (s *invoiceService) GenerateInvoice(ctx context.Context, orderID string) (*
 		return nil, fmt.Errorf("failed to get order: %w", err)
 	}
 
-	// Generate invoice number
-	invoiceNumber := s.generateInvoiceNumber(order)
+	// A draft left by a request that could not number it is numbered now
+	if existingInvoice != nil {
+		return s.numberInvoice(ctx, existingInvoice, order)
+	}
 
-	// Create invoice
+	// Create the invoice as an unnumbered draft first
+	invoiceDate := time.Now()
 	invoice := &models.Invoice{
-		InvoiceNumber:  invoiceNumber,
 		OrderID:        orderObjID,
 		UserID:         order.UserID,
 		GuestSessionID: order.GuestSessionID,
-		InvoiceDate:    time.Now(),
-		Status:         s.getInvoiceStatusFromOrder(order),
+		BuyerGSTIN:     order.BuyerGSTIN,
+		BuyerLegalName: order.BuyerLegalName,
+		InvoiceDate:    invoiceDate,
+		Status:         models.InvoiceStatusDraft,
 		Subtotal:       order.Subtotal,
 		Tax:            order.Tax,
 		Shipping:       order.Shipping,
@@ -80,12 +112,54 @@ func (s *invoiceService) GenerateInvoice(ctx context.Context, orderID string) (*
 		IsDownloaded:   false,
 	}
 
-	// Save invoice to database
+	// Copy the order's GST breakdown; orders placed before it was recorded only have a tax total
+	if order.TaxBreakdown != nil {
+		storeAddress := ""
+		if s.storefrontRepo != nil {
+			if settings, err := s.storefrontRepo.GetStoreSettings(ctx); err == nil {
+				storeAddress = settings.StoreAddress
+			} else {
+				fmt.Printf("Warning: failed to load store settings for the invoice of order %s: %v\n", order.OrderNumber, err)
+			}
+		}
+		details := order.TaxBreakdown.Details(storeAddress)
+		invoice.TaxDetails = &details
+		invoice.TaxLines = order.TaxBreakdown.Lines
+	}
+
+	// Only one live invoice per order can be created, so a concurrent request
+	// for the same order gets the other invoice instead of making a second
 	err = s.invoiceRepo.Create(ctx, invoice)
-	if err != nil {
+	if errors.Is(err, repository.ErrInvoiceExists) {
+		if invoice, err = s.invoiceRepo.GetByOrderID(ctx, orderObjID); err != nil {
+			return nil, err
+		}
+		if invoice.Sequence > 0 {
+			return invoice, nil
+		}
+	} else if err != nil {
 		return nil, fmt.Errorf("failed to create invoice: %w", err)
 	}
 
+	return s.numberInvoice(ctx, invoice, order)
+}
+
+// numberInvoice gives a draft invoice the next number of its financial year's
+// series. The number is taken as it is saved, so a failed save leaves no gap and
+// the draft is numbered by the next request; a draft another request numbered
+// first is returned as that request saved it.
+func (s *invoiceService) numberInvoice(ctx context.Context, invoice *models.Invoice, order *models.Order) (*models.Invoice, error) {
+	invoice.FinancialYear = models.FinancialYear(invoice.InvoiceDate)
+	invoice.Status = s.getInvoiceStatusFromOrder(order)
+
+	err := s.invoiceRepo.AssignNumber(ctx, invoice)
+	if errors.Is(err, repository.ErrInvoiceNumbered) {
+		return s.invoiceRepo.GetByID(ctx, invoice.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
 	return invoice, nil
 }
 
@@ -139,18 +213,40 @@ func (s *invoiceService) MarkAsDownloaded(ctx context.Context, invoiceID string)
 	return s.invoiceRepo.MarkAsDownloaded(ctx, objID)
 }
 
-// GenerateCSVData generates CSV data for invoices
+// GenerateCSVData generates CSV data for invoices. Each invoice is followed by
+// its credit notes, whose amounts are negative so the columns sum to the net.
 func (s *invoiceService) GenerateCSVData(ctx context.Context, invoices []models.Invoice) ([]byte, error) {
 	var buffer [][]string
 
+	creditNotes := make(map[primitive.ObjectID][]models.CreditNote)
+	if s.creditNoteRepo != nil && len(invoices) > 0 {
+		invoiceIDs := make([]primitive.ObjectID, len(invoices))
+		for i, invoice := range invoices {
+			invoiceIDs[i] = invoice.ID
+		}
+		notes, _, err := s.creditNoteRepo.List(ctx, &models.CreditNoteFilter{InvoiceIDs: invoiceIDs, Limit: maxCSVCreditNotes})
+		if err != nil {
+			return nil, fmt.Errorf("failed to load credit notes: %w", err)
+		}
+		// Listed newest first; each invoice shows its notes in issue order
+		for i := len(notes) - 1; i >= 0; i-- {
+			creditNotes[notes[i].InvoiceID] = append(creditNotes[notes[i].InvoiceID], notes[i])
+		}
+	}
+
 	// Header
 	header := []string{
+		"Document Type",
 		"Invoice Number",
+		"Credit Note Number",
 		"Order ID",
 		"Invoice Date",
 		"Status",
 		"Subtotal",
 		"Tax",
+		"CGST",
+		"SGST",
+		"IGST",
 		"Shipping",
 		"Discount",
 		"Total",
@@ -161,13 +257,22 @@ func (s *invoiceService) GenerateCSVData(ctx context.Context, invoices []models.
 
 	// Data rows
 	for _, invoice := range invoices {
+		var cgst, sgst, igst float64
+		if invoice.TaxDetails != nil {
+			cgst, sgst, igst = invoice.TaxDetails.CGST, invoice.TaxDetails.SGST, invoice.TaxDetails.IGST
+		}
 		row := []string{
+			"Invoice",
 			invoice.InvoiceNumber,
+			"",
 			invoice.OrderID.Hex(),
 			invoice.InvoiceDate.Format("2006-01-02 15:04:05"),
 			string(invoice.Status),
 			fmt.Sprintf("%.2f", invoice.Subtotal),
 			fmt.Sprintf("%.2f", invoice.Tax),
+			fmt.Sprintf("%.2f", cgst),
+			fmt.Sprintf("%.2f", sgst),
+			fmt.Sprintf("%.2f", igst),
 			fmt.Sprintf("%.2f", invoice.Shipping),
 			fmt.Sprintf("%.2f", invoice.Discount),
 			fmt.Sprintf("%.2f", invoice.Total),
@@ -175,6 +280,27 @@ func (s *invoiceService) GenerateCSVData(ctx context.Context, invoices []models.
 			fmt.Sprintf("%t", invoice.IsDownloaded),
 		}
 		buffer = append(buffer, row)
+
+		for _, note := range creditNotes[invoice.ID] {
+			buffer = append(buffer, []string{
+				"Credit Note",
+				note.InvoiceNumber,
+				note.CreditNoteNumber,
+				note.OrderID.Hex(),
+				note.CreditNoteDate.Format("2006-01-02 15:04:05"),
+				"credited",
+				fmt.Sprintf("%.2f", -note.TaxableValue),
+				fmt.Sprintf("%.2f", -note.Tax),
+				fmt.Sprintf("%.2f", -note.CGST),
+				fmt.Sprintf("%.2f", -note.SGST),
+				fmt.Sprintf("%.2f", -note.IGST),
+				"0.00",
+				"0.00",
+				fmt.Sprintf("%.2f", -note.Total),
+				note.Currency,
+				"",
+			})
+		}
 	}
 
 	// Convert to CSV bytes
@@ -195,25 +321,162 @@ func (s *invoiceService) GenerateCSVData(ctx context.Context, invoices []models.
 	return csvData, nil
 }
 
-// DeleteInvoice deletes an invoice
-func (s *invoiceService) DeleteInvoice(ctx context.Context, invoiceID string) error {
+// VoidInvoice cancels an invoice issued in error. Invoices are never deleted,
+// so the number stays used and the series has no gaps; the order can then be
+// invoiced again. Refunds are documented with credit notes instead, so an
+// invoice with credit notes cannot be voided.
+func (s *invoiceService) VoidInvoice(ctx context.Context, invoiceID string, actor models.OrderActor, reason string) (*models.Invoice, error) {
 	objID, err := primitive.ObjectIDFromHex(invoiceID)
 	if err != nil {
-		return fmt.Errorf("invalid invoice ID: %w", err)
+		return nil, ErrInvoiceNotFound
+	}
+	invoice, err := s.invoiceRepo.GetByID(ctx, objID)
+	if err != nil {
+		return nil, ErrInvoiceNotFound
 	}
 
-	return s.invoiceRepo.Delete(ctx, objID)
+	if invoice.Status == models.InvoiceStatusVoid {
+		return nil, fmt.Errorf("%w: it is already void", ErrInvoiceNotVoidable)
+	}
+	if invoice.CreditedAmount > 0 {
+		return nil, fmt.Errorf("%w: refunds against it are recorded in credit notes", ErrInvoiceNotVoidable)
+	}
+
+	now := time.Now()
+	invoice.UpdateStatus(models.InvoiceStatusVoid)
+	invoice.VoidedAt = &now
+	invoice.VoidedBy = &actor
+	invoice.VoidReason = reason
+	if err := s.invoiceRepo.Update(ctx, invoice); err != nil {
+		return nil, err
+	}
+	return invoice, nil
 }
 
-// Helper functions
+// IssueCreditNote documents a refund against the order's invoice. The tax of
+// the credit note is the invoice's tax in proportion to the amount refunded.
+// Orders without an invoice need no credit note, and a refund gets at most one.
+func (s *invoiceService) IssueCreditNote(ctx context.Context, order *models.Order, refund *models.PaymentRefund) (*models.CreditNote, error) {
+	if s.creditNoteRepo == nil {
+		return nil, errors.New("credit notes are not configured")
+	}
+
+	invoice, err := s.invoiceRepo.GetByOrderID(ctx, order.ID)
+	if errors.Is(err, repository.ErrInvoiceNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
 
-// generateInvoiceNumber generates a unique invoice number
-func (s *invoiceService) generateInvoiceNumber(order *models.Order) string {
-	// Format: INV-YYYYMMDD-ORDERNUM
-	date := time.Now().Format("20060102")
-	return fmt.Sprintf("INV-%s-%s", date, order.OrderNumber)
+	existing, err := s.creditNoteRepo.GetByRefundID(ctx, order.ID, refund.RefundID)
+	if err == nil {
+		if existing.Sequence > 0 {
+			return existing, nil
+		}
+		// A draft left by a request that could not number it is numbered now
+		return s.numberCreditNote(ctx, existing, invoice)
+	}
+	if !errors.Is(err, repository.ErrCreditNoteNotFound) {
+		return nil, err
+	}
+
+	amount := fromPaise(min(toPaise(refund.Amount), toPaise(invoice.Total)-toPaise(invoice.CreditedAmount)))
+	if amount <= 0 {
+		return nil, nil
+	}
+
+	ratio := amount / invoice.Total
+	note := &models.CreditNote{
+		InvoiceID:      invoice.ID,
+		InvoiceNumber:  invoice.InvoiceNumber,
+		OrderID:        order.ID,
+		UserID:         invoice.UserID,
+		GuestSessionID: invoice.GuestSessionID,
+		RefundID:       refund.RefundID,
+		Reason:         refund.Reason,
+		Total:          amount,
+		Currency:       invoice.Currency,
+	}
+	if invoice.TaxDetails != nil {
+		note.CGST = fromPaise(toPaise(invoice.TaxDetails.CGST * ratio))
+		note.SGST = fromPaise(toPaise(invoice.TaxDetails.SGST * ratio))
+		note.IGST = fromPaise(toPaise(invoice.TaxDetails.IGST * ratio))
+		note.Tax = fromPaise(toPaise(note.CGST + note.SGST + note.IGST))
+	} else {
+		note.Tax = fromPaise(toPaise(invoice.Tax * ratio))
+	}
+	note.TaxableValue = fromPaise(toPaise(amount - note.Tax))
+
+	// Create the credit note as an unnumbered draft first. A refund can only
+	// have one, so a concurrent request for the same refund numbers that one.
+	note.CreditNoteDate = time.Now()
+	note.FinancialYear = models.FinancialYear(note.CreditNoteDate)
+	err = s.creditNoteRepo.Create(ctx, note)
+	if errors.Is(err, repository.ErrCreditNoteExists) {
+		if note, err = s.creditNoteRepo.GetByRefundID(ctx, order.ID, refund.RefundID); err != nil {
+			return nil, err
+		}
+		if note.Sequence > 0 {
+			return note, nil
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	return s.numberCreditNote(ctx, note, invoice)
 }
 
+// numberCreditNote gives a draft credit note the next number of its financial
+// year's series and credits its amount to the invoice. Only the request that
+// numbers the draft credits the invoice; a draft another request numbered
+// first is returned as that request saved it.
+func (s *invoiceService) numberCreditNote(ctx context.Context, note *models.CreditNote, invoice *models.Invoice) (*models.CreditNote, error) {
+	err := s.creditNoteRepo.AssignNumber(ctx, note)
+	if errors.Is(err, repository.ErrCreditNoteNumbered) {
+		return s.creditNoteRepo.GetByID(ctx, note.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	amount := note.Total
+	invoice.CreditedAmount = fromPaise(toPaise(invoice.CreditedAmount + amount))
+	if toPaise(invoice.CreditedAmount) >= toPaise(invoice.Total) {
+		invoice.Status = models.InvoiceStatusRefunded
+	}
+	if err := s.invoiceRepo.Update(ctx, invoice); err != nil {
+		fmt.Printf("Warning: failed to record credit note %s on invoice %s: %v\n", note.CreditNoteNumber, invoice.InvoiceNumber, err)
+	}
+	return note, nil
+}
+
+// GetCreditNotes lists the credit notes against an invoice
+func (s *invoiceService) GetCreditNotes(ctx context.Context, invoiceID string, actor models.OrderActor) ([]models.CreditNote, error) {
+	objID, err := primitive.ObjectIDFromHex(invoiceID)
+	if err != nil {
+		return nil, ErrInvoiceNotFound
+	}
+	invoice, err := s.invoiceRepo.GetByID(ctx, objID)
+	if err != nil || !invoice.IsOwnedBy(actor) {
+		return nil, ErrInvoiceNotFound
+	}
+	if s.creditNoteRepo == nil {
+		return []models.CreditNote{}, nil
+	}
+	return s.creditNoteRepo.GetByInvoiceID(ctx, invoice.ID)
+}
+
+// ListCreditNotes retrieves credit notes with filters
+func (s *invoiceService) ListCreditNotes(ctx context.Context, filter *models.CreditNoteFilter) ([]models.CreditNote, int64, error) {
+	if s.creditNoteRepo == nil {
+		return []models.CreditNote{}, 0, nil
+	}
+	return s.creditNoteRepo.List(ctx, filter)
+}
+
+// Helper functions
+
 // getInvoiceStatusFromOrder determines invoice status from order
 func (s *invoiceService) getInvoiceStatusFromOrder(order *models.Order) models.InvoiceStatus {
 	switch order.PaymentStatus {
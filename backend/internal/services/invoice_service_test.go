@@ -0,0 +1,448 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memoryInvoiceRepository keeps invoices in memory
+type memoryInvoiceRepository struct {
+	repository.InvoiceRepository
+	invoices map[primitive.ObjectID]models.Invoice
+}
+
+func (r *memoryInvoiceRepository) Create(ctx context.Context, invoice *models.Invoice) error {
+	for _, existing := range r.invoices {
+		if existing.OrderID == invoice.OrderID && existing.VoidedAt == nil {
+			return repository.ErrInvoiceExists
+		}
+	}
+	invoice.ID = primitive.NewObjectID()
+	invoice.CreatedAt = time.Now()
+	r.invoices[invoice.ID] = *invoice
+	return nil
+}
+
+func (r *memoryInvoiceRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.Invoice, error) {
+	invoice, ok := r.invoices[id]
+	if !ok {
+		return nil, repository.ErrInvoiceNotFound
+	}
+	return &invoice, nil
+}
+
+func (r *memoryInvoiceRepository) GetByOrderID(ctx context.Context, orderID primitive.ObjectID) (*models.Invoice, error) {
+	for _, invoice := range r.invoices {
+		if invoice.OrderID == orderID && invoice.Status != models.InvoiceStatusVoid {
+			return &invoice, nil
+		}
+	}
+	return nil, repository.ErrInvoiceNotFound
+}
+
+func (r *memoryInvoiceRepository) Update(ctx context.Context, invoice *models.Invoice) error {
+	r.invoices[invoice.ID] = *invoice
+	return nil
+}
+
+func (r *memoryInvoiceRepository) AssignNumber(ctx context.Context, invoice *models.Invoice) error {
+	stored, ok := r.invoices[invoice.ID]
+	if !ok {
+		return repository.ErrInvoiceNotFound
+	}
+	if stored.Sequence > 0 {
+		return repository.ErrInvoiceNumbered
+	}
+
+	var last int64
+	for _, other := range r.invoices {
+		if other.FinancialYear == invoice.FinancialYear && other.Sequence > last {
+			last = other.Sequence
+		}
+	}
+	invoice.Sequence = last + 1
+	invoice.InvoiceNumber = models.DocumentNumber(models.InvoiceSeriesPrefix, invoice.FinancialYear, invoice.Sequence)
+	r.invoices[invoice.ID] = *invoice
+	return nil
+}
+
+func (r *memoryInvoiceRepository) List(ctx context.Context, filter *models.InvoiceFilter) ([]models.Invoice, int64, error) {
+	var invoices []models.Invoice
+	for _, invoice := range r.invoices {
+		if filter.DateFrom != nil && invoice.InvoiceDate.Before(*filter.DateFrom) {
+			continue
+		}
+		if filter.DateTo != nil && invoice.InvoiceDate.After(*filter.DateTo) {
+			continue
+		}
+		invoices = append(invoices, invoice)
+	}
+	return invoices, int64(len(invoices)), nil
+}
+
+// racingInvoiceRepository misses the order's invoice on the first lookup, the
+// way a request does that checks just before another one creates the invoice
+type racingInvoiceRepository struct {
+	*memoryInvoiceRepository
+	misses int
+}
+
+func (r *racingInvoiceRepository) GetByOrderID(ctx context.Context, orderID primitive.ObjectID) (*models.Invoice, error) {
+	if r.misses > 0 {
+		r.misses--
+		return nil, repository.ErrInvoiceNotFound
+	}
+	return r.memoryInvoiceRepository.GetByOrderID(ctx, orderID)
+}
+
+// failingNumberRepository fails to save the number of the next draft, the way
+// a request does that loses its database connection
+type failingNumberRepository struct {
+	*memoryInvoiceRepository
+	failures int
+}
+
+func (r *failingNumberRepository) AssignNumber(ctx context.Context, invoice *models.Invoice) error {
+	if r.failures > 0 {
+		r.failures--
+		return errors.New("connection reset")
+	}
+	return r.memoryInvoiceRepository.AssignNumber(ctx, invoice)
+}
+
+// memoryCreditNoteRepository keeps credit notes in memory
+type memoryCreditNoteRepository struct {
+	repository.CreditNoteRepository
+	notes []models.CreditNote
+}
+
+func (r *memoryCreditNoteRepository) Create(ctx context.Context, creditNote *models.CreditNote) error {
+	for _, existing := range r.notes {
+		if existing.OrderID == creditNote.OrderID && existing.RefundID == creditNote.RefundID {
+			return repository.ErrCreditNoteExists
+		}
+	}
+	creditNote.ID = primitive.NewObjectID()
+	r.notes = append(r.notes, *creditNote)
+	return nil
+}
+
+func (r *memoryCreditNoteRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.CreditNote, error) {
+	for _, note := range r.notes {
+		if note.ID == id {
+			return &note, nil
+		}
+	}
+	return nil, repository.ErrCreditNoteNotFound
+}
+
+func (r *memoryCreditNoteRepository) AssignNumber(ctx context.Context, creditNote *models.CreditNote) error {
+	var last int64
+	for _, other := range r.notes {
+		if other.ID == creditNote.ID && other.Sequence > 0 {
+			return repository.ErrCreditNoteNumbered
+		}
+		if other.FinancialYear == creditNote.FinancialYear && other.Sequence > last {
+			last = other.Sequence
+		}
+	}
+	for i := range r.notes {
+		if r.notes[i].ID == creditNote.ID {
+			creditNote.Sequence = last + 1
+			creditNote.CreditNoteNumber = models.DocumentNumber(models.CreditNoteSeriesPrefix, creditNote.FinancialYear, creditNote.Sequence)
+			r.notes[i] = *creditNote
+			return nil
+		}
+	}
+	return repository.ErrCreditNoteNotFound
+}
+
+func (r *memoryCreditNoteRepository) GetByInvoiceID(ctx context.Context, invoiceID primitive.ObjectID) ([]models.CreditNote, error) {
+	notes := []models.CreditNote{}
+	for _, note := range r.notes {
+		if note.InvoiceID == invoiceID && note.Sequence > 0 {
+			notes = append(notes, note)
+		}
+	}
+	return notes, nil
+}
+
+func (r *memoryCreditNoteRepository) GetByRefundID(ctx context.Context, orderID primitive.ObjectID, refundID string) (*models.CreditNote, error) {
+	for _, note := range r.notes {
+		if note.OrderID == orderID && note.RefundID == refundID {
+			return &note, nil
+		}
+	}
+	return nil, repository.ErrCreditNoteNotFound
+}
+
+func (r *memoryCreditNoteRepository) List(ctx context.Context, filter *models.CreditNoteFilter) ([]models.CreditNote, int64, error) {
+	var notes []models.CreditNote
+	for i := len(r.notes) - 1; i >= 0; i-- {
+		for _, invoiceID := range filter.InvoiceIDs {
+			if r.notes[i].InvoiceID == invoiceID && r.notes[i].Sequence > 0 {
+				notes = append(notes, r.notes[i])
+			}
+		}
+	}
+	return notes, int64(len(notes)), nil
+}
+
+// flakyCreditNoteRepository misses the refund's credit note on the first
+// lookups and fails to save the number of the next draft
+type flakyCreditNoteRepository struct {
+	*memoryCreditNoteRepository
+	misses   int
+	failures int
+}
+
+func (r *flakyCreditNoteRepository) GetByRefundID(ctx context.Context, orderID primitive.ObjectID, refundID string) (*models.CreditNote, error) {
+	if r.misses > 0 {
+		r.misses--
+		return nil, repository.ErrCreditNoteNotFound
+	}
+	return r.memoryCreditNoteRepository.GetByRefundID(ctx, orderID, refundID)
+}
+
+func (r *flakyCreditNoteRepository) AssignNumber(ctx context.Context, creditNote *models.CreditNote) error {
+	if r.failures > 0 {
+		r.failures--
+		return errors.New("connection reset")
+	}
+	return r.memoryCreditNoteRepository.AssignNumber(ctx, creditNote)
+}
+
+func TestFinancialYear(t *testing.T) {
+	ist := time.FixedZone("IST", 5*60*60+30*60)
+	cases := map[time.Time]string{
+		time.Date(2025, 4, 1, 0, 0, 0, 0, ist):        "2025-26",
+		time.Date(2026, 3, 31, 23, 59, 0, 0, ist):     "2025-26",
+		time.Date(2026, 3, 31, 19, 0, 0, 0, time.UTC): "2026-27", // 00:30 on 1 April in India
+		time.Date(2099, 12, 1, 0, 0, 0, 0, ist):       "2099-00",
+	}
+	for at, want := range cases {
+		if got := models.FinancialYear(at); got != want {
+			t.Errorf("FinancialYear(%s) = %s, want %s", at, got, want)
+		}
+	}
+	if got := models.DocumentNumber(models.InvoiceSeriesPrefix, "2025-26", 42); got != "INV/25-26/000042" || len(got) > 16 {
+		t.Errorf("unexpected invoice number %q", got)
+	}
+}
+
+func TestInvoiceSeriesAndCreditNotes(t *testing.T) {
+	ctx := context.Background()
+	newOrder := func(number string) models.Order {
+		return models.Order{
+			ID:             primitive.NewObjectID(),
+			OrderNumber:    number,
+			GuestSessionID: "guest-1",
+			PaymentStatus:  models.PaymentStatusPaid,
+			Subtotal:       10000,
+			Tax:            300,
+			Total:          10300,
+			TaxBreakdown:   &models.TaxBreakdown{TaxableValue: 10000, CGST: 150, SGST: 150, Total: 300},
+		}
+	}
+	first, second := newOrder("TJ-6001"), newOrder("TJ-6002")
+	orderRepo := &memoryOrderRepository{orders: map[primitive.ObjectID]models.Order{first.ID: first, second.ID: second}}
+	invoiceRepo := &memoryInvoiceRepository{invoices: make(map[primitive.ObjectID]models.Invoice)}
+	creditNoteRepo := &memoryCreditNoteRepository{}
+	svc := NewInvoiceService(invoiceRepo, orderRepo, nil)
+	svc.(interface {
+		SetCreditNoteRepository(repository.CreditNoteRepository)
+	}).SetCreditNoteRepository(creditNoteRepo)
+	admin := models.OrderActor{Type: models.OrderActorAdmin, ID: "admin-1"}
+	fy := models.FinancialYear(time.Now())
+	prefix := "INV/" + fy[2:] + "/"
+
+	firstInvoice, err := svc.GenerateInvoice(ctx, first.ID.Hex())
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	secondInvoice, err := svc.GenerateInvoice(ctx, second.ID.Hex())
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if firstInvoice.InvoiceNumber != prefix+"000001" || secondInvoice.InvoiceNumber != prefix+"000002" || firstInvoice.FinancialYear != fy {
+		t.Fatalf("expected consecutive numbers, got %s and %s", firstInvoice.InvoiceNumber, secondInvoice.InvoiceNumber)
+	}
+	if again, _ := svc.GenerateInvoice(ctx, first.ID.Hex()); again.ID != firstInvoice.ID {
+		t.Fatal("expected an order to keep its invoice")
+	}
+
+	// A partial refund is credited with its share of the tax, once
+	refund := &models.PaymentRefund{RefundID: "TJ-6001-R1", Amount: 2060, Reason: "Return RMA-1"}
+	note, err := svc.IssueCreditNote(ctx, &first, refund)
+	if err != nil {
+		t.Fatalf("credit note: %v", err)
+	}
+	if note.CreditNoteNumber != "CN/"+fy[2:]+"/000001" || note.Total != 2060 || note.CGST != 30 || note.SGST != 30 || note.TaxableValue != 2000 {
+		t.Fatalf("unexpected credit note %+v", note)
+	}
+	if repeat, _ := svc.IssueCreditNote(ctx, &first, refund); repeat.ID != note.ID || len(creditNoteRepo.notes) != 1 {
+		t.Fatal("expected one credit note per refund")
+	}
+
+	// Refunds beyond the invoice total are capped, and a fully credited invoice is refunded
+	if _, err := svc.IssueCreditNote(ctx, &first, &models.PaymentRefund{RefundID: "TJ-6001-R2", Amount: 9000}); err != nil {
+		t.Fatalf("credit note: %v", err)
+	}
+	stored := invoiceRepo.invoices[firstInvoice.ID]
+	if stored.CreditedAmount != 10300 || stored.Status != models.InvoiceStatusRefunded {
+		t.Fatalf("expected the invoice to be fully credited, got %.2f %s", stored.CreditedAmount, stored.Status)
+	}
+
+	// Credited invoices cannot be voided; others are voided and the order invoiced again
+	if _, err := svc.VoidInvoice(ctx, firstInvoice.ID.Hex(), admin, "Wrong address"); !errors.Is(err, ErrInvoiceNotVoidable) {
+		t.Fatalf("expected a credited invoice not to be voidable, got %v", err)
+	}
+	voided, err := svc.VoidInvoice(ctx, secondInvoice.ID.Hex(), admin, "Wrong address")
+	if err != nil || voided.Status != models.InvoiceStatusVoid || voided.VoidedBy == nil {
+		t.Fatalf("void: %+v, %v", voided, err)
+	}
+	reissued, err := svc.GenerateInvoice(ctx, second.ID.Hex())
+	if err != nil || reissued.ID == secondInvoice.ID || reissued.InvoiceNumber != prefix+"000003" {
+		t.Fatalf("expected a new invoice after voiding, got %+v, %v", reissued, err)
+	}
+	if len(invoiceRepo.invoices) != 3 {
+		t.Fatalf("expected the void invoice to be kept, got %d invoices", len(invoiceRepo.invoices))
+	}
+
+	// Orders without an invoice need no credit note
+	if note, err := svc.IssueCreditNote(ctx, &models.Order{ID: primitive.NewObjectID()}, refund); note != nil || err != nil {
+		t.Fatalf("expected no credit note without an invoice, got %+v, %v", note, err)
+	}
+
+	csv, err := svc.GenerateCSVData(ctx, []models.Invoice{invoiceRepo.invoices[firstInvoice.ID]})
+	if err != nil {
+		t.Fatalf("csv: %v", err)
+	}
+	rows := strings.Split(strings.TrimSpace(string(csv)), "\n")
+	if len(rows) != 4 || !strings.HasPrefix(rows[2], "Credit Note,"+firstInvoice.InvoiceNumber+","+note.CreditNoteNumber) || !strings.Contains(rows[2], ",-2060.00,") {
+		t.Fatalf("expected the invoice followed by its credit notes, got\n%s", csv)
+	}
+}
+
+func TestConcurrentInvoiceKeepsNumbersGapFree(t *testing.T) {
+	ctx := context.Background()
+	first := models.Order{ID: primitive.NewObjectID(), OrderNumber: "TJ-6101", PaymentStatus: models.PaymentStatusPaid, Total: 500}
+	second := models.Order{ID: primitive.NewObjectID(), OrderNumber: "TJ-6102", PaymentStatus: models.PaymentStatusPaid, Total: 700}
+	orderRepo := &memoryOrderRepository{orders: map[primitive.ObjectID]models.Order{first.ID: first, second.ID: second}}
+	invoiceRepo := &racingInvoiceRepository{memoryInvoiceRepository: &memoryInvoiceRepository{invoices: make(map[primitive.ObjectID]models.Invoice)}}
+	svc := NewInvoiceService(invoiceRepo, orderRepo, nil)
+	prefix := "INV/" + models.FinancialYear(time.Now())[2:] + "/"
+
+	invoice, err := svc.GenerateInvoice(ctx, first.ID.Hex())
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+
+	// The second request misses the invoice on its check and loses on create
+	invoiceRepo.misses = 1
+	again, err := svc.GenerateInvoice(ctx, first.ID.Hex())
+	if err != nil || again.ID != invoice.ID {
+		t.Fatalf("expected the order's invoice, got %+v, %v", again, err)
+	}
+	if len(invoiceRepo.invoices) != 1 {
+		t.Fatalf("expected one invoice for the order, got %d", len(invoiceRepo.invoices))
+	}
+
+	next, err := svc.GenerateInvoice(ctx, second.ID.Hex())
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if invoice.InvoiceNumber != prefix+"000001" || next.InvoiceNumber != prefix+"000002" {
+		t.Fatalf("expected no number to be used up, got %s and %s", invoice.InvoiceNumber, next.InvoiceNumber)
+	}
+}
+
+func TestDraftLeftByFailedNumberingIsNumberedLater(t *testing.T) {
+	ctx := context.Background()
+	first := models.Order{ID: primitive.NewObjectID(), OrderNumber: "TJ-6201", PaymentStatus: models.PaymentStatusPaid, Total: 500}
+	second := models.Order{ID: primitive.NewObjectID(), OrderNumber: "TJ-6202", PaymentStatus: models.PaymentStatusPaid, Total: 700}
+	orderRepo := &memoryOrderRepository{orders: map[primitive.ObjectID]models.Order{first.ID: first, second.ID: second}}
+	invoiceRepo := &failingNumberRepository{memoryInvoiceRepository: &memoryInvoiceRepository{invoices: make(map[primitive.ObjectID]models.Invoice)}, failures: 1}
+	svc := NewInvoiceService(invoiceRepo, orderRepo, nil)
+	prefix := "INV/" + models.FinancialYear(time.Now())[2:] + "/"
+
+	if _, err := svc.GenerateInvoice(ctx, first.ID.Hex()); err == nil {
+		t.Fatal("expected numbering to fail")
+	}
+	draft, err := invoiceRepo.GetByOrderID(ctx, first.ID)
+	if err != nil || draft.Sequence != 0 || draft.Status != models.InvoiceStatusDraft {
+		t.Fatalf("expected an unnumbered draft to be left, got %+v, %v", draft, err)
+	}
+
+	invoice, err := svc.GenerateInvoice(ctx, first.ID.Hex())
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if invoice.ID != draft.ID || invoice.InvoiceNumber != prefix+"000001" || invoice.Status != models.InvoiceStatusPaid {
+		t.Fatalf("expected the draft to be numbered, got %+v", invoice)
+	}
+
+	next, err := svc.GenerateInvoice(ctx, second.ID.Hex())
+	if err != nil || next.InvoiceNumber != prefix+"000002" {
+		t.Fatalf("expected the next number without a gap, got %+v, %v", next, err)
+	}
+}
+
+func TestCreditNoteDraftsAreNumberedOnce(t *testing.T) {
+	ctx := context.Background()
+	order := models.Order{ID: primitive.NewObjectID(), OrderNumber: "TJ-6301", PaymentStatus: models.PaymentStatusPaid, Total: 1000}
+	orderRepo := &memoryOrderRepository{orders: map[primitive.ObjectID]models.Order{order.ID: order}}
+	invoiceRepo := &memoryInvoiceRepository{invoices: make(map[primitive.ObjectID]models.Invoice)}
+	creditNoteRepo := &flakyCreditNoteRepository{memoryCreditNoteRepository: &memoryCreditNoteRepository{}, failures: 1}
+	svc := NewInvoiceService(invoiceRepo, orderRepo, nil)
+	svc.(interface {
+		SetCreditNoteRepository(repository.CreditNoteRepository)
+	}).SetCreditNoteRepository(creditNoteRepo)
+	prefix := "CN/" + models.FinancialYear(time.Now())[2:] + "/"
+
+	invoice, err := svc.GenerateInvoice(ctx, order.ID.Hex())
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+
+	// A failed numbering leaves an unnumbered draft that is not listed
+	refund := &models.PaymentRefund{RefundID: "TJ-6301-R1", Amount: 400}
+	if _, err := svc.IssueCreditNote(ctx, &order, refund); err == nil {
+		t.Fatal("expected numbering to fail")
+	}
+	if notes, _ := svc.GetCreditNotes(ctx, invoice.ID.Hex(), models.OrderActor{Type: models.OrderActorAdmin}); len(notes) != 0 {
+		t.Fatalf("expected the draft not to be listed, got %+v", notes)
+	}
+	if stored := invoiceRepo.invoices[invoice.ID]; stored.CreditedAmount != 0 {
+		t.Fatalf("expected nothing to be credited yet, got %.2f", stored.CreditedAmount)
+	}
+
+	// A retry that misses the draft on its check loses on create and numbers it
+	creditNoteRepo.misses = 1
+	note, err := svc.IssueCreditNote(ctx, &order, refund)
+	if err != nil || note.CreditNoteNumber != prefix+"000001" || len(creditNoteRepo.notes) != 1 {
+		t.Fatalf("expected the draft to be numbered, got %+v, %v", note, err)
+	}
+
+	// Later requests for the refund return it without crediting the invoice again
+	creditNoteRepo.misses = 1
+	if again, err := svc.IssueCreditNote(ctx, &order, refund); err != nil || again.ID != note.ID {
+		t.Fatalf("expected the refund's credit note, got %+v, %v", again, err)
+	}
+	if stored := invoiceRepo.invoices[invoice.ID]; stored.CreditedAmount != 400 {
+		t.Fatalf("expected the refund to be credited once, got %.2f", stored.CreditedAmount)
+	}
+
+	next, err := svc.IssueCreditNote(ctx, &order, &models.PaymentRefund{RefundID: "TJ-6301-R2", Amount: 100})
+	if err != nil || next.CreditNoteNumber != prefix+"000002" {
+		t.Fatalf("expected the next number without a gap, got %+v, %v", next, err)
+	}
+}
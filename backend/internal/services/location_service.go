@@ -0,0 +1,503 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrInvalidStockLocation is returned when a stock location cannot be saved as asked
+var ErrInvalidStockLocation = errors.New("invalid stock location")
+
+// LocationService manages the warehouses and showrooms stock is held at, the
+// store staff who work at them and the transfers of stock between them. The
+// stock itself is moved through the StockService, so every transfer is
+// recorded in the stock ledger.
+type LocationService interface {
+	CreateLocation(req *models.CreateStockLocationRequest) (*models.StockLocation, error)
+	UpdateLocation(locationID string, req *models.UpdateStockLocationRequest) (*models.StockLocation, error)
+	GetLocation(locationID string) (*models.StockLocation, error)
+	ListLocations(activeOnly bool) ([]models.StockLocation, error)
+	AssignStaff(userID string, req *models.AssignLocationStaffRequest) (*models.User, error)
+
+	// Customers
+	ListCollectionPoints() ([]models.StockLocation, error)
+	GetAvailability(productID, variantID string) ([]models.LocationAvailability, error)
+
+	// Store staff
+	GetLocationStock(locationID string, filter models.ProductFilter) ([]models.Product, int64, error)
+	GetLocationOrders(locationID string, page, limit int, status *models.OrderStatus) ([]models.Order, int64, error)
+	CreateTransfer(fromLocationID string, req *models.CreateStockTransferRequest, actor models.OrderActor) (*models.StockTransfer, error)
+	ReceiveTransfer(locationID, transferID string, actor models.OrderActor) (*models.StockTransfer, error)
+	CancelTransfer(locationID, transferID string, actor models.OrderActor) (*models.StockTransfer, error)
+	ListTransfers(filter models.StockTransferFilter) ([]models.StockTransfer, int64, error)
+}
+
+type locationService struct {
+	locationRepo repository.StockLocationRepository
+	transferRepo repository.StockTransferRepository
+	productRepo  repository.ProductRepository
+	orderRepo    repository.OrderRepository
+	userRepo     repository.UserRepository
+	stockService StockService
+}
+
+// NewLocationService creates a new location service
+func NewLocationService(
+	locationRepo repository.StockLocationRepository,
+	transferRepo repository.StockTransferRepository,
+	productRepo repository.ProductRepository,
+	orderRepo repository.OrderRepository,
+	userRepo repository.UserRepository,
+	stockService StockService,
+) LocationService {
+	return &locationService{
+		locationRepo: locationRepo,
+		transferRepo: transferRepo,
+		productRepo:  productRepo,
+		orderRepo:    orderRepo,
+		userRepo:     userRepo,
+		stockService: stockService,
+	}
+}
+
+// CreateLocation adds a location. The first location added becomes the
+// default, and the stock held before locations were set up is placed there.
+func (s *locationService) CreateLocation(req *models.CreateStockLocationRequest) (*models.StockLocation, error) {
+	ctx := context.Background()
+
+	location := &models.StockLocation{
+		Code:            strings.ToUpper(strings.TrimSpace(req.Code)),
+		Name:            strings.TrimSpace(req.Name),
+		Type:            req.Type,
+		Address:         req.Address,
+		City:            req.City,
+		State:           req.State,
+		Pincode:         req.Pincode,
+		Phone:           req.Phone,
+		ServicePincodes: servicePincodes(req.ServicePincodes),
+		Priority:        req.Priority,
+		ClickAndCollect: req.ClickAndCollect,
+		IsActive:        true,
+	}
+	if location.Code == "" || location.Name == "" {
+		return nil, fmt.Errorf("%w: code and name are required", ErrInvalidStockLocation)
+	}
+
+	makeDefault := req.IsDefault
+	if _, err := s.locationRepo.GetDefault(ctx); errors.Is(err, repository.ErrStockLocationNotFound) {
+		makeDefault = true
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := s.locationRepo.Create(ctx, location); err != nil {
+		if errors.Is(err, repository.ErrDuplicateLocationCode) {
+			return nil, fmt.Errorf("%w: code %s is already in use", ErrInvalidStockLocation, location.Code)
+		}
+		return nil, err
+	}
+
+	if makeDefault {
+		if err := s.makeDefault(ctx, location); err != nil {
+			return nil, err
+		}
+	}
+	return location, nil
+}
+
+// UpdateLocation changes a location's details. The default location cannot be
+// deactivated; make another location the default first.
+func (s *locationService) UpdateLocation(locationID string, req *models.UpdateStockLocationRequest) (*models.StockLocation, error) {
+	ctx := context.Background()
+	location, err := s.location(ctx, locationID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != nil {
+		location.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Type != nil {
+		location.Type = *req.Type
+	}
+	if req.Address != nil {
+		location.Address = *req.Address
+	}
+	if req.City != nil {
+		location.City = *req.City
+	}
+	if req.State != nil {
+		location.State = *req.State
+	}
+	if req.Pincode != nil {
+		location.Pincode = *req.Pincode
+	}
+	if req.Phone != nil {
+		location.Phone = *req.Phone
+	}
+	if req.ServicePincodes != nil {
+		location.ServicePincodes = servicePincodes(req.ServicePincodes)
+	}
+	if req.Priority != nil {
+		location.Priority = *req.Priority
+	}
+	if req.ClickAndCollect != nil {
+		location.ClickAndCollect = *req.ClickAndCollect
+	}
+	if req.IsActive != nil {
+		location.IsActive = *req.IsActive
+	}
+
+	makeDefault := req.IsDefault != nil && *req.IsDefault && !location.IsDefault
+	switch {
+	case location.Name == "":
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidStockLocation)
+	case req.IsDefault != nil && !*req.IsDefault && location.IsDefault:
+		return nil, fmt.Errorf("%w: make another location the default instead", ErrInvalidStockLocation)
+	case !location.IsActive && (location.IsDefault || makeDefault):
+		return nil, fmt.Errorf("%w: the default location must be active", ErrInvalidStockLocation)
+	}
+
+	if err := s.locationRepo.Update(ctx, location); err != nil {
+		return nil, err
+	}
+	if makeDefault {
+		if err := s.makeDefault(ctx, location); err != nil {
+			return nil, err
+		}
+	}
+	return location, nil
+}
+
+func (s *locationService) GetLocation(locationID string) (*models.StockLocation, error) {
+	return s.location(context.Background(), locationID)
+}
+
+func (s *locationService) ListLocations(activeOnly bool) ([]models.StockLocation, error) {
+	return s.locationRepo.GetAll(context.Background(), activeOnly)
+}
+
+// AssignStaff sets the locations a user works at as store staff, replacing
+// the ones they had
+func (s *locationService) AssignStaff(userID string, req *models.AssignLocationStaffRequest) (*models.User, error) {
+	ctx := context.Background()
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("user %w", ErrInventoryNotFound)
+	}
+	user, err := s.userRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("user %w", ErrInventoryNotFound)
+	}
+
+	locationIDs := make([]primitive.ObjectID, 0, len(req.LocationIDs))
+	seen := make(map[primitive.ObjectID]bool)
+	for _, locationID := range req.LocationIDs {
+		location, err := s.location(ctx, locationID)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[location.ID] {
+			seen[location.ID] = true
+			locationIDs = append(locationIDs, location.ID)
+		}
+	}
+
+	user.LocationIDs = locationIDs
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// ListCollectionPoints lists the active locations customers can collect orders from
+func (s *locationService) ListCollectionPoints() ([]models.StockLocation, error) {
+	locations, err := s.locationRepo.GetAll(context.Background(), true)
+	if err != nil {
+		return nil, err
+	}
+
+	points := make([]models.StockLocation, 0, len(locations))
+	for _, location := range locations {
+		if location.ClickAndCollect {
+			points = append(points, location)
+		}
+	}
+	return points, nil
+}
+
+// GetAvailability returns the stock of a product, or of one of its variants,
+// at each collection point
+func (s *locationService) GetAvailability(productID, variantID string) ([]models.LocationAvailability, error) {
+	ctx := context.Background()
+	product, err := s.product(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	var variant *primitive.ObjectID
+	if variantID != "" {
+		id, err := primitive.ObjectIDFromHex(variantID)
+		if err != nil || product.FindVariant(id) == nil {
+			return nil, fmt.Errorf("variant %w", ErrInventoryNotFound)
+		}
+		variant = &id
+	}
+
+	points, err := s.ListCollectionPoints()
+	if err != nil {
+		return nil, err
+	}
+	availability := make([]models.LocationAvailability, 0, len(points))
+	if len(points) == 0 {
+		return availability, nil
+	}
+
+	// Stock not yet held per location is at the default location
+	stock := &stockAllocation{}
+	if defaultLocation, err := s.locationRepo.GetDefault(ctx); err == nil {
+		stock.defaultID = defaultLocation.ID
+	} else if !errors.Is(err, repository.ErrStockLocationNotFound) {
+		return nil, err
+	}
+
+	for _, point := range points {
+		quantity := 0
+		if product.StockType != models.StockTypeMadeToOrder {
+			quantity = stock.held(product, variant, point.ID)
+		}
+		availability = append(availability, models.LocationAvailability{
+			LocationID: point.ID,
+			Code:       point.Code,
+			Name:       point.Name,
+			City:       point.City,
+			Pincode:    point.Pincode,
+			Quantity:   quantity,
+		})
+	}
+	return availability, nil
+}
+
+// GetLocationStock lists the available products in stock at a location
+func (s *locationService) GetLocationStock(locationID string, filter models.ProductFilter) ([]models.Product, int64, error) {
+	ctx := context.Background()
+	location, err := s.location(ctx, locationID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	filter.LocationID = &location.ID
+	return s.productRepo.GetAll(ctx, filter)
+}
+
+// GetLocationOrders lists the orders with lines fulfilled from a location
+func (s *locationService) GetLocationOrders(locationID string, page, limit int, status *models.OrderStatus) ([]models.Order, int64, error) {
+	ctx := context.Background()
+	location, err := s.location(ctx, locationID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return s.orderRepo.GetByLocation(ctx, location.ID, page, limit, status)
+}
+
+// CreateTransfer sends stock from a location to another. The units leave the
+// source at once and are not sellable until the destination receives them.
+func (s *locationService) CreateTransfer(fromLocationID string, req *models.CreateStockTransferRequest, actor models.OrderActor) (*models.StockTransfer, error) {
+	ctx := context.Background()
+	from, err := s.location(ctx, fromLocationID)
+	if err != nil {
+		return nil, err
+	}
+	to, err := s.location(ctx, req.ToLocationID)
+	if err != nil {
+		if errors.Is(err, ErrInventoryNotFound) {
+			return nil, fmt.Errorf("%w: destination location not found", ErrInvalidStockTransfer)
+		}
+		return nil, err
+	}
+	if from.ID == to.ID {
+		return nil, fmt.Errorf("%w: stock must be sent to another location", ErrInvalidStockTransfer)
+	}
+	if !to.IsActive {
+		return nil, fmt.Errorf("%w: %s is not active", ErrInvalidStockTransfer, to.Name)
+	}
+
+	transfer := &models.StockTransfer{
+		TransferNumber: fmt.Sprintf("TRF%d%03d", time.Now().Unix(), rand.Intn(1000)),
+		FromLocationID: from.ID,
+		ToLocationID:   to.ID,
+		Items:          make([]models.StockTransferItem, 0, len(req.Items)),
+		Status:         models.StockTransferInTransit,
+		Note:           req.Note,
+		CreatedBy:      actor,
+	}
+	for _, line := range req.Items {
+		product, err := s.product(ctx, line.ProductID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: product %s not found", ErrInvalidStockTransfer, line.ProductID)
+		}
+		if product.StockType == models.StockTypeMadeToOrder {
+			return nil, fmt.Errorf("%w: %s is made to order", ErrInvalidStockTransfer, product.Name)
+		}
+		item, err := stockLine(product, line.VariantID, ErrInvalidStockTransfer)
+		if err != nil {
+			return nil, err
+		}
+		transfer.Items = append(transfer.Items, models.StockTransferItem{
+			ProductID: product.ID,
+			VariantID: item.VariantID,
+			SKU:       item.SKU,
+			Name:      item.Name,
+			Quantity:  line.Quantity,
+		})
+	}
+
+	if err := s.stockService.DispatchTransfer(ctx, transfer, actor); err != nil {
+		return nil, err
+	}
+	if err := s.transferRepo.Create(ctx, transfer); err != nil {
+		// Without a saved transfer nobody can receive the units, so they go back
+		s.stockService.ReturnTransfer(ctx, transfer, actor)
+		return nil, err
+	}
+	return transfer, nil
+}
+
+// ReceiveTransfer puts a transfer's units into stock at its destination
+func (s *locationService) ReceiveTransfer(locationID, transferID string, actor models.OrderActor) (*models.StockTransfer, error) {
+	ctx := context.Background()
+	transfer, err := s.transfer(ctx, transferID)
+	if err != nil {
+		return nil, err
+	}
+	if transfer.ToLocationID.Hex() != locationID {
+		return nil, fmt.Errorf("%w: only the destination location can receive a transfer", ErrInvalidStockTransfer)
+	}
+
+	now := time.Now()
+	transfer.Status = models.StockTransferReceived
+	transfer.ReceivedAt = &now
+	if err := s.close(ctx, transfer, actor); err != nil {
+		return nil, err
+	}
+
+	s.stockService.ReceiveTransfer(ctx, transfer, actor)
+	return transfer, nil
+}
+
+// CancelTransfer puts the units of a transfer that has not been received back
+// into stock at its source
+func (s *locationService) CancelTransfer(locationID, transferID string, actor models.OrderActor) (*models.StockTransfer, error) {
+	ctx := context.Background()
+	transfer, err := s.transfer(ctx, transferID)
+	if err != nil {
+		return nil, err
+	}
+	if transfer.FromLocationID.Hex() != locationID {
+		return nil, fmt.Errorf("%w: only the source location can cancel a transfer", ErrInvalidStockTransfer)
+	}
+
+	now := time.Now()
+	transfer.Status = models.StockTransferCancelled
+	transfer.CancelledAt = &now
+	if err := s.close(ctx, transfer, actor); err != nil {
+		return nil, err
+	}
+
+	s.stockService.ReturnTransfer(ctx, transfer, actor)
+	return transfer, nil
+}
+
+func (s *locationService) ListTransfers(filter models.StockTransferFilter) ([]models.StockTransfer, int64, error) {
+	return s.transferRepo.GetAll(context.Background(), filter)
+}
+
+// makeDefault makes the location the default and places the stock not yet
+// held at a location there
+func (s *locationService) makeDefault(ctx context.Context, location *models.StockLocation) error {
+	if err := s.locationRepo.SetDefault(ctx, location.ID); err != nil {
+		return err
+	}
+	location.IsDefault = true
+
+	if _, err := s.stockService.AssignUnlocatedStock(ctx, location); err != nil {
+		return fmt.Errorf("failed to place stock at %s: %w", location.Name, err)
+	}
+	return nil
+}
+
+// close saves a received or cancelled transfer. Only one close can succeed,
+// so the units are never put into stock twice.
+func (s *locationService) close(ctx context.Context, transfer *models.StockTransfer, actor models.OrderActor) error {
+	transfer.ClosedBy = &actor
+	if err := s.transferRepo.Close(ctx, transfer); err != nil {
+		if errors.Is(err, repository.ErrStockTransferClosed) {
+			return fmt.Errorf("%w: transfer %s is no longer in transit", ErrInvalidStockTransfer, transfer.TransferNumber)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *locationService) location(ctx context.Context, locationID string) (*models.StockLocation, error) {
+	id, err := primitive.ObjectIDFromHex(locationID)
+	if err != nil {
+		return nil, fmt.Errorf("location %w", ErrInventoryNotFound)
+	}
+	location, err := s.locationRepo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrStockLocationNotFound) {
+			return nil, fmt.Errorf("location %w", ErrInventoryNotFound)
+		}
+		return nil, err
+	}
+	return location, nil
+}
+
+func (s *locationService) transfer(ctx context.Context, transferID string) (*models.StockTransfer, error) {
+	id, err := primitive.ObjectIDFromHex(transferID)
+	if err != nil {
+		return nil, fmt.Errorf("transfer %w", ErrInventoryNotFound)
+	}
+	transfer, err := s.transferRepo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrStockTransferNotFound) {
+			return nil, fmt.Errorf("transfer %w", ErrInventoryNotFound)
+		}
+		return nil, err
+	}
+	return transfer, nil
+}
+
+func (s *locationService) product(ctx context.Context, productID string) (*models.Product, error) {
+	id, err := primitive.ObjectIDFromHex(productID)
+	if err != nil {
+		return nil, fmt.Errorf("product %w", ErrInventoryNotFound)
+	}
+	product, err := s.productRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("product %w", ErrInventoryNotFound)
+	}
+	return product, nil
+}
+
+// servicePincodes trims the pincode prefixes a location serves and drops blanks
+func servicePincodes(prefixes []string) []string {
+	cleaned := make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		if prefix = strings.TrimSpace(prefix); prefix != "" {
+			cleaned = append(cleaned, prefix)
+		}
+	}
+	return cleaned
+}
@@ -0,0 +1,417 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memoryLocationRepository keeps stock locations in memory
+type memoryLocationRepository struct {
+	repository.StockLocationRepository
+	locations []models.StockLocation
+}
+
+func (r *memoryLocationRepository) Create(ctx context.Context, location *models.StockLocation) error {
+	for _, existing := range r.locations {
+		if existing.Code == location.Code {
+			return repository.ErrDuplicateLocationCode
+		}
+	}
+	location.ID = primitive.NewObjectID()
+	r.locations = append(r.locations, *location)
+	return nil
+}
+
+func (r *memoryLocationRepository) Update(ctx context.Context, location *models.StockLocation) error {
+	for i := range r.locations {
+		if r.locations[i].ID == location.ID {
+			location.IsDefault = r.locations[i].IsDefault
+			r.locations[i] = *location
+			return nil
+		}
+	}
+	return repository.ErrStockLocationNotFound
+}
+
+func (r *memoryLocationRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.StockLocation, error) {
+	for _, location := range r.locations {
+		if location.ID == id {
+			return &location, nil
+		}
+	}
+	return nil, repository.ErrStockLocationNotFound
+}
+
+func (r *memoryLocationRepository) GetAll(ctx context.Context, activeOnly bool) ([]models.StockLocation, error) {
+	var locations []models.StockLocation
+	for _, location := range r.locations {
+		if location.IsActive || !activeOnly {
+			locations = append(locations, location)
+		}
+	}
+	sort.SliceStable(locations, func(i, j int) bool { return locations[i].Priority < locations[j].Priority })
+	return locations, nil
+}
+
+func (r *memoryLocationRepository) GetDefault(ctx context.Context) (*models.StockLocation, error) {
+	for _, location := range r.locations {
+		if location.IsDefault {
+			return &location, nil
+		}
+	}
+	return nil, repository.ErrStockLocationNotFound
+}
+
+func (r *memoryLocationRepository) SetDefault(ctx context.Context, id primitive.ObjectID) error {
+	for i := range r.locations {
+		r.locations[i].IsDefault = r.locations[i].ID == id
+	}
+	return nil
+}
+
+// memoryTransferRepository keeps stock transfers in memory
+type memoryTransferRepository struct {
+	repository.StockTransferRepository
+	transfers map[primitive.ObjectID]models.StockTransfer
+}
+
+func (r *memoryTransferRepository) Create(ctx context.Context, transfer *models.StockTransfer) error {
+	transfer.ID = primitive.NewObjectID()
+	r.transfers[transfer.ID] = *transfer
+	return nil
+}
+
+func (r *memoryTransferRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.StockTransfer, error) {
+	transfer, ok := r.transfers[id]
+	if !ok {
+		return nil, repository.ErrStockTransferNotFound
+	}
+	return &transfer, nil
+}
+
+func (r *memoryTransferRepository) Close(ctx context.Context, transfer *models.StockTransfer) error {
+	if r.transfers[transfer.ID].Status != models.StockTransferInTransit {
+		return repository.ErrStockTransferClosed
+	}
+	r.transfers[transfer.ID] = *transfer
+	return nil
+}
+
+// locationFixture sets up a Mumbai warehouse and showrooms in Delhi and
+// Bengaluru around products that were stocked before locations existed
+type locationFixture struct {
+	products  *memoryProductRepository
+	ledger    *memoryLedgerRepository
+	stock     StockService
+	locations LocationService
+	mumbai    *models.StockLocation
+	delhi     *models.StockLocation
+	bengaluru *models.StockLocation
+}
+
+func newLocationFixture(t *testing.T, products ...models.Product) *locationFixture {
+	t.Helper()
+	f := &locationFixture{products: &memoryProductRepository{products: map[primitive.ObjectID]models.Product{}}}
+	for _, product := range products {
+		f.products.products[product.ID] = product
+	}
+	f.ledger = &memoryLedgerRepository{products: f.products}
+	f.stock = NewStockService(f.ledger)
+	locationRepo := &memoryLocationRepository{}
+	f.stock.(*stockService).SetStockLocationRepository(locationRepo)
+	f.locations = NewLocationService(locationRepo, &memoryTransferRepository{transfers: map[primitive.ObjectID]models.StockTransfer{}}, f.products, nil, nil, f.stock)
+
+	create := func(req models.CreateStockLocationRequest) *models.StockLocation {
+		location, err := f.locations.CreateLocation(&req)
+		if err != nil {
+			t.Fatalf("create %s: %v", req.Code, err)
+		}
+		return location
+	}
+	f.mumbai = create(models.CreateStockLocationRequest{Code: "mum-wh", Name: "Mumbai Warehouse", Type: models.StockLocationWarehouse, ServicePincodes: []string{"400", " 401 "}})
+	f.delhi = create(models.CreateStockLocationRequest{Code: "DEL-SR", Name: "Delhi Showroom", Type: models.StockLocationShowroom, ServicePincodes: []string{"110"}, Priority: 1, ClickAndCollect: true})
+	f.bengaluru = create(models.CreateStockLocationRequest{Code: "BLR-SR", Name: "Bengaluru Showroom", Type: models.StockLocationShowroom, ServicePincodes: []string{"560"}, Priority: 2, ClickAndCollect: true})
+	return f
+}
+
+func (f *locationFixture) held(productID primitive.ObjectID, location *models.StockLocation) int {
+	product := f.products.products[productID]
+	return product.LocationQuantity(location.ID, nil)
+}
+
+func (f *locationFixture) snapshot() map[primitive.ObjectID]*models.Product {
+	products := make(map[primitive.ObjectID]*models.Product)
+	for id, product := range f.products.products {
+		p := product
+		products[id] = &p
+	}
+	return products
+}
+
+func (f *locationFixture) send(t *testing.T, from, to *models.StockLocation, productID primitive.ObjectID, quantity int) *models.StockTransfer {
+	t.Helper()
+	transfer, err := f.locations.CreateTransfer(from.ID.Hex(), &models.CreateStockTransferRequest{
+		ToLocationID: to.ID.Hex(),
+		Items:        []models.StockTransferItemRequest{{ProductID: productID.Hex(), Quantity: quantity}},
+	}, models.OrderActor{Type: models.OrderActorStaff, ID: "staff-1"})
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	return transfer
+}
+
+func TestFirstLocationHoldsExistingStock(t *testing.T) {
+	chain := models.Product{ID: primitive.NewObjectID(), Name: "Rope Chain", StockType: models.StockTypeStocked, StockQuantity: 10, IsAvailable: true}
+	f := newLocationFixture(t, chain)
+
+	if !f.mumbai.IsDefault || f.delhi.IsDefault || f.mumbai.Code != "MUM-WH" || len(f.mumbai.ServicePincodes) != 2 || f.mumbai.ServicePincodes[1] != "401" {
+		t.Fatalf("unexpected locations %+v, %+v", f.mumbai, f.delhi)
+	}
+	if f.held(chain.ID, f.mumbai) != 10 || f.products.products[chain.ID].StockQuantity != 10 {
+		t.Fatalf("expected the chains to be placed at the warehouse, got %+v", f.products.products[chain.ID].LocationStock)
+	}
+
+	if _, err := f.locations.CreateLocation(&models.CreateStockLocationRequest{Code: "DEL-SR", Name: "Copy", Type: models.StockLocationShowroom}); !errors.Is(err, ErrInvalidStockLocation) {
+		t.Fatalf("expected a duplicate code to be refused, got %v", err)
+	}
+	inactive := false
+	if _, err := f.locations.UpdateLocation(f.mumbai.ID.Hex(), &models.UpdateStockLocationRequest{IsActive: &inactive}); !errors.Is(err, ErrInvalidStockLocation) {
+		t.Fatalf("expected the default location to stay active, got %v", err)
+	}
+
+	availability, err := f.locations.GetAvailability(chain.ID.Hex(), "")
+	if err != nil || len(availability) != 2 || availability[0].Code != "DEL-SR" || availability[0].Quantity != 0 {
+		t.Fatalf("expected both showrooms without stock, got %+v (%v)", availability, err)
+	}
+}
+
+func TestTransfersMoveStockBetweenLocations(t *testing.T) {
+	chain := models.Product{ID: primitive.NewObjectID(), Name: "Rope Chain", StockType: models.StockTypeStocked, StockQuantity: 10, IsAvailable: true}
+	pendant := models.Product{ID: primitive.NewObjectID(), Name: "Pendant", StockType: models.StockTypeStocked, StockQuantity: 1, IsAvailable: true}
+	f := newLocationFixture(t, chain, pendant)
+	staff := models.OrderActor{Type: models.OrderActorStaff, ID: "staff-2"}
+
+	transfer := f.send(t, f.mumbai, f.delhi, chain.ID, 4)
+	if transfer.Status != models.StockTransferInTransit || f.held(chain.ID, f.mumbai) != 6 || f.products.products[chain.ID].StockQuantity != 6 {
+		t.Fatalf("expected the chains to leave the warehouse, got %+v", f.products.products[chain.ID])
+	}
+
+	if _, err := f.locations.ReceiveTransfer(f.bengaluru.ID.Hex(), transfer.ID.Hex(), staff); !errors.Is(err, ErrInvalidStockTransfer) {
+		t.Fatalf("expected another showroom not to receive the transfer, got %v", err)
+	}
+	if _, err := f.locations.ReceiveTransfer(f.delhi.ID.Hex(), transfer.ID.Hex(), staff); err != nil {
+		t.Fatalf("receive: %v", err)
+	}
+	if _, err := f.locations.ReceiveTransfer(f.delhi.ID.Hex(), transfer.ID.Hex(), staff); !errors.Is(err, ErrInvalidStockTransfer) {
+		t.Fatalf("expected a transfer to be received once, got %v", err)
+	}
+	if f.held(chain.ID, f.delhi) != 4 || f.products.products[chain.ID].StockQuantity != 10 {
+		t.Fatalf("expected the chains at the showroom, got %+v", f.products.products[chain.ID].LocationStock)
+	}
+
+	// A transfer with a line the source does not hold takes nothing
+	_, err := f.locations.CreateTransfer(f.mumbai.ID.Hex(), &models.CreateStockTransferRequest{
+		ToLocationID: f.bengaluru.ID.Hex(),
+		Items: []models.StockTransferItemRequest{
+			{ProductID: chain.ID.Hex(), Quantity: 2},
+			{ProductID: pendant.ID.Hex(), Quantity: 2},
+		},
+	}, staff)
+	if !errors.Is(err, ErrInvalidStockTransfer) || f.held(chain.ID, f.mumbai) != 6 {
+		t.Fatalf("expected the short transfer to be refused and rolled back, got %v with %d at the warehouse", err, f.held(chain.ID, f.mumbai))
+	}
+
+	cancelled := f.send(t, f.delhi, f.bengaluru, chain.ID, 3)
+	if _, err := f.locations.CancelTransfer(f.bengaluru.ID.Hex(), cancelled.ID.Hex(), staff); !errors.Is(err, ErrInvalidStockTransfer) {
+		t.Fatalf("expected only the source to cancel, got %v", err)
+	}
+	if _, err := f.locations.CancelTransfer(f.delhi.ID.Hex(), cancelled.ID.Hex(), staff); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	if f.held(chain.ID, f.delhi) != 4 || f.held(chain.ID, f.bengaluru) != 0 {
+		t.Fatalf("expected the cancelled chains back at the showroom, got %+v", f.products.products[chain.ID].LocationStock)
+	}
+
+	var types []models.StockMovementType
+	for _, movement := range f.ledger.movements {
+		types = append(types, movement.Type)
+	}
+	want := []models.StockMovementType{
+		models.StockMovementTransferOut, models.StockMovementTransferIn, // received
+		models.StockMovementTransferOut, models.StockMovementTransferIn, // rolled back
+		models.StockMovementTransferOut, models.StockMovementTransferIn, // cancelled
+	}
+	if len(types) != len(want) {
+		t.Fatalf("expected %v, got %v", want, types)
+	}
+	for i := range want {
+		if types[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, types)
+		}
+	}
+	received := f.ledger.movements[1]
+	if received.Reference != transfer.TransferNumber || *received.LocationID != f.delhi.ID || received.Change != 4 || *received.BalanceAfter != 4 || received.Actor != staff {
+		t.Fatalf("unexpected receipt entry %+v", received)
+	}
+	if last := f.ledger.movements[5]; last.Reason != "Transfer cancelled" || *last.LocationID != f.delhi.ID {
+		t.Fatalf("unexpected cancellation entry %+v", last)
+	}
+}
+
+func TestOrdersAreAllocatedToLocations(t *testing.T) {
+	ctx := context.Background()
+	chain := models.Product{ID: primitive.NewObjectID(), Name: "Rope Chain", StockType: models.StockTypeStocked, StockQuantity: 10, IsAvailable: true}
+	pendant := models.Product{ID: primitive.NewObjectID(), Name: "Pendant", StockType: models.StockTypeStocked, StockQuantity: 2, IsAvailable: true}
+	bangle := models.Product{ID: primitive.NewObjectID(), Name: "Bangle", StockType: models.StockTypeStocked, StockQuantity: 1, IsAvailable: true}
+	f := newLocationFixture(t, chain, pendant, bangle)
+	staff := models.OrderActor{Type: models.OrderActorStaff, ID: "staff-1"}
+	f.locations.ReceiveTransfer(f.delhi.ID.Hex(), f.send(t, f.mumbai, f.delhi, chain.ID, 3).ID.Hex(), staff)
+	f.locations.ReceiveTransfer(f.delhi.ID.Hex(), f.send(t, f.mumbai, f.delhi, bangle.ID, 1).ID.Hex(), staff)
+
+	order := func(pincode string, lines map[primitive.ObjectID]int) *models.Order {
+		t.Helper()
+		o := &models.Order{OrderNumber: "TJ" + pincode, ShippingAddress: models.Address{Pincode: pincode}}
+		for _, id := range []primitive.ObjectID{chain.ID, pendant.ID, bangle.ID} {
+			if quantity, ok := lines[id]; ok {
+				o.Items = append(o.Items, models.OrderItem{ProductID: id, Name: f.products.products[id].Name, Quantity: quantity})
+			}
+		}
+		if err := f.stock.ReserveOrderStock(ctx, o, f.snapshot()); err != nil {
+			t.Fatalf("reserve for %s: %v", pincode, err)
+		}
+		return o
+	}
+
+	// Delhi pincodes are served by the showroom while it has the stock
+	delhi := order("110001", map[primitive.ObjectID]int{chain.ID: 2})
+	if delhi.FulfillmentLocationID == nil || *delhi.FulfillmentLocationID != f.delhi.ID || f.held(chain.ID, f.delhi) != 1 {
+		t.Fatalf("expected the Delhi order to be fulfilled by the showroom, got %+v", delhi.Items)
+	}
+
+	// The showroom cannot fulfil the whole order, so the warehouse does
+	whole := order("110017", map[primitive.ObjectID]int{chain.ID: 2, pendant.ID: 1})
+	if whole.FulfillmentLocationID == nil || *whole.FulfillmentLocationID != f.mumbai.ID {
+		t.Fatalf("expected the warehouse to fulfil the whole order, got %+v", whole.Items)
+	}
+
+	// Nowhere holds both lines, so they are split
+	split := order("560001", map[primitive.ObjectID]int{pendant.ID: 1, bangle.ID: 1})
+	if split.FulfillmentLocationID != nil || *split.Items[0].LocationID != f.mumbai.ID || *split.Items[1].LocationID != f.delhi.ID {
+		t.Fatalf("expected the lines to be split, got %+v", split.Items)
+	}
+
+	// Cancelling returns each line to where it was taken from
+	if err := f.stock.ReleaseOrderStock(ctx, split, "Cancelled"); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if f.held(bangle.ID, f.delhi) != 1 || f.held(pendant.ID, f.mumbai) != 1 {
+		t.Fatalf("expected the split lines back at their locations")
+	}
+	if movement := f.ledger.movements[len(f.ledger.movements)-1]; movement.Type != models.StockMovementRelease || *movement.LocationID != f.delhi.ID {
+		t.Fatalf("unexpected release entry %+v", movement)
+	}
+
+	availability, err := f.locations.GetAvailability(bangle.ID.Hex(), "")
+	if err != nil || availability[0].LocationID != f.delhi.ID || availability[0].Quantity != 1 {
+		t.Fatalf("expected the bangle to be available in Delhi, got %+v (%v)", availability, err)
+	}
+}
+
+func TestLatePaymentsAreReservedAtTheOrdersLocation(t *testing.T) {
+	ctx := context.Background()
+	chain := models.Product{ID: primitive.NewObjectID(), Name: "Rope Chain", StockType: models.StockTypeStocked, StockQuantity: 10, IsAvailable: true}
+	pendant := models.Product{ID: primitive.NewObjectID(), Name: "Pendant", StockType: models.StockTypeStocked, StockQuantity: 2, IsAvailable: true}
+	f := newLocationFixture(t, chain, pendant)
+	f.stock.(*stockService).SetProductRepository(f.products)
+	staff := models.OrderActor{Type: models.OrderActorStaff, ID: "staff-1"}
+	f.locations.ReceiveTransfer(f.delhi.ID.Hex(), f.send(t, f.mumbai, f.delhi, chain.ID, 3).ID.Hex(), staff)
+
+	lapsed := func(number string, lines map[primitive.ObjectID]int) *models.Order {
+		t.Helper()
+		o := &models.Order{OrderNumber: number, ShippingAddress: models.Address{Pincode: "110001"}}
+		for _, id := range []primitive.ObjectID{chain.ID, pendant.ID} {
+			if quantity, ok := lines[id]; ok {
+				o.Items = append(o.Items, models.OrderItem{ProductID: id, Name: f.products.products[id].Name, Quantity: quantity})
+			}
+		}
+		if err := f.stock.ReserveOrderStock(ctx, o, f.snapshot()); err != nil {
+			t.Fatalf("reserve %s: %v", number, err)
+		}
+		if err := f.stock.ReleaseOrderStock(ctx, o, "Reservation expired"); err != nil {
+			t.Fatalf("release %s: %v", number, err)
+		}
+		return o
+	}
+
+	// The showroom has no pendant, so the warehouse fulfils the order. Once the
+	// showroom has one too, a late payment still takes the order from the warehouse.
+	whole := lapsed("TJ-8001", map[primitive.ObjectID]int{chain.ID: 1, pendant.ID: 1})
+	if *whole.FulfillmentLocationID != f.mumbai.ID {
+		t.Fatalf("expected the warehouse to fulfil the order, got %+v", whole.Items)
+	}
+	f.locations.ReceiveTransfer(f.delhi.ID.Hex(), f.send(t, f.mumbai, f.delhi, pendant.ID, 1).ID.Hex(), staff)
+	if err := f.stock.CommitOrderStock(ctx, whole); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	if *whole.FulfillmentLocationID != f.mumbai.ID || f.held(chain.ID, f.mumbai) != 6 || f.held(pendant.ID, f.mumbai) != 0 || f.held(pendant.ID, f.delhi) != 1 {
+		t.Fatalf("expected the order to be taken again from the warehouse, got %+v", whole.Items)
+	}
+
+	// The showroom sold its chains meanwhile, so the late payment is allocated
+	// as at checkout rather than refused
+	delhi := lapsed("TJ-8002", map[primitive.ObjectID]int{chain.ID: 2})
+	if *delhi.FulfillmentLocationID != f.delhi.ID {
+		t.Fatalf("expected the showroom to fulfil the order, got %+v", delhi.Items)
+	}
+	if err := f.stock.ReserveOrderStock(ctx, &models.Order{OrderNumber: "TJ-8003", ShippingAddress: models.Address{Pincode: "110001"},
+		Items: []models.OrderItem{{ProductID: chain.ID, Name: chain.Name, Quantity: 3}}}, f.snapshot()); err != nil {
+		t.Fatalf("reserve: %v", err)
+	}
+	if err := f.stock.CommitOrderStock(ctx, delhi); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	if delhi.StockStatus != models.StockReservationCommitted || *delhi.FulfillmentLocationID != f.mumbai.ID || f.held(chain.ID, f.mumbai) != 4 {
+		t.Fatalf("expected the warehouse to take over the order, got %+v", delhi.Items)
+	}
+	if movement := f.ledger.movements[len(f.ledger.movements)-2]; movement.Type != models.StockMovementReserve || *movement.LocationID != f.mumbai.ID {
+		t.Fatalf("unexpected re-reservation entry %+v", movement)
+	}
+}
+
+func TestManualStockChangesAtLocations(t *testing.T) {
+	ctx := context.Background()
+	chain := models.Product{ID: primitive.NewObjectID(), Name: "Rope Chain", StockType: models.StockTypeStocked, StockQuantity: 10, IsAvailable: true}
+	f := newLocationFixture(t, chain)
+	staff := models.OrderActor{Type: models.OrderActorStaff, ID: "staff-1"}
+	f.locations.ReceiveTransfer(f.delhi.ID.Hex(), f.send(t, f.mumbai, f.delhi, chain.ID, 3).ID.Hex(), staff)
+
+	product := f.products.products[chain.ID]
+	damaged, err := f.stock.AdjustStock(ctx, &product, &models.StockAdjustmentRequest{Type: models.StockMovementDamage, Quantity: 1, LocationID: f.delhi.ID.Hex()}, staff)
+	if err != nil || *damaged.LocationID != f.delhi.ID || *damaged.BalanceAfter != 2 || f.products.products[chain.ID].StockQuantity != 9 {
+		t.Fatalf("unexpected write-off %+v (%v)", damaged, err)
+	}
+	if _, err := f.stock.AdjustStock(ctx, &product, &models.StockAdjustmentRequest{Type: models.StockMovementDamage, Quantity: 3, LocationID: f.delhi.ID.Hex()}, staff); !errors.Is(err, ErrInvalidStockAdjustment) {
+		t.Fatalf("expected writing off more than the showroom holds to be refused, got %v", err)
+	}
+
+	// A total count keeps the units at other locations and changes the default location's
+	product = f.products.products[chain.ID]
+	counted, err := f.stock.SetStock(ctx, &product, nil, 12, "Cycle count", staff)
+	if err != nil || *counted.LocationID != f.mumbai.ID || counted.Change != 3 || *counted.BalanceAfter != 10 {
+		t.Fatalf("unexpected count %+v (%v)", counted, err)
+	}
+	if f.held(chain.ID, f.mumbai) != 10 || f.held(chain.ID, f.delhi) != 2 || f.products.products[chain.ID].StockQuantity != 12 {
+		t.Fatalf("unexpected stock %+v", f.products.products[chain.ID])
+	}
+	product = f.products.products[chain.ID]
+	if _, err := f.stock.SetStock(ctx, &product, nil, 1, "Cycle count", staff); !errors.Is(err, ErrInvalidStockAdjustment) {
+		t.Fatalf("expected a count below the stock held elsewhere to be refused, got %v", err)
+	}
+}
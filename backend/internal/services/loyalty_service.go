@@ -3,6 +3,7 @@ package services
 import (
 	"context"
 	"fmt"
+	"math"
 	"time"
 
 	"thyne-jewels-backend/internal/models"
@@ -231,6 +232,67 @@ func (s *LoyaltyService) AddCreditsFromPurchase(ctx context.Context, userID prim
 	return nil
 }
 
+// ReversePurchaseCredits takes back the purchase credits earned on an order in
+// proportion to the amount refunded. Credits already spent are not recovered
+// below a zero balance.
+func (s *LoyaltyService) ReversePurchaseCredits(ctx context.Context, userID primitive.ObjectID, orderID primitive.ObjectID, refundAmount, orderTotal float64) error {
+	if orderTotal <= 0 {
+		return nil
+	}
+
+	transactions, err := s.loyaltyRepo.GetTransactionsByOrder(ctx, userID, orderID)
+	if err != nil {
+		return fmt.Errorf("failed to get order transactions: %w", err)
+	}
+
+	earned, reversed := 0, 0
+	for _, transaction := range transactions {
+		switch transaction.Type {
+		case models.TransactionEarned:
+			earned += transaction.Credits
+		case models.TransactionRefund:
+			reversed -= transaction.Credits
+		}
+	}
+
+	credits := int(math.Round(float64(earned) * refundAmount / orderTotal))
+	if credits > earned-reversed {
+		credits = earned - reversed
+	}
+	if credits <= 0 {
+		return nil
+	}
+
+	program, err := s.loyaltyRepo.GetProgramByUserID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get loyalty program: %w", err)
+	}
+
+	transaction := &models.PointTransaction{
+		UserID:      userID,
+		Type:        models.TransactionRefund,
+		Credits:     -credits,
+		Description: fmt.Sprintf("Purchase reward reversed for refunded order #%s", orderID.Hex()[:8]),
+		OrderID:     &orderID,
+	}
+	if err := s.loyaltyRepo.AddTransaction(ctx, transaction); err != nil {
+		return fmt.Errorf("failed to add refund transaction: %w", err)
+	}
+
+	program.TotalCredits -= credits
+	program.AvailableCredits -= credits
+	if program.AvailableCredits < 0 {
+		program.AvailableCredits = 0
+	}
+	program.UpdatedAt = time.Now()
+
+	if err := s.loyaltyRepo.UpdateProgram(ctx, program); err != nil {
+		return fmt.Errorf("failed to update loyalty program: %w", err)
+	}
+
+	return nil
+}
+
 // RedeemCredits redeems credits for a discount or voucher
 func (s *LoyaltyService) RedeemCredits(ctx context.Context, userID primitive.ObjectID, redemptionID string) (string, error) {
 	program, err := s.loyaltyRepo.GetProgramByUserID(ctx, userID)
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"thyne-jewels-backend/internal/models"
+)
+
+// ManualCarrier covers shipments booked outside the system, e.g. at a courier's
+// counter. The admin enters the AWB number and adds tracking updates by hand.
+type ManualCarrier struct{}
+
+// NewManualCarrier creates a new manual carrier
+func NewManualCarrier() *ManualCarrier {
+	return &ManualCarrier{}
+}
+
+func (c *ManualCarrier) Code() string {
+	return "manual"
+}
+
+func (c *ManualCarrier) Name() string {
+	return "Manual"
+}
+
+func (c *ManualCarrier) IsEnabled() bool {
+	return true
+}
+
+// CreateShipment records the AWB number entered by the admin
+func (c *ManualCarrier) CreateShipment(ctx context.Context, req *CarrierShipmentRequest) (*CarrierShipment, error) {
+	trackingNumber := strings.TrimSpace(req.TrackingNumber)
+	if trackingNumber == "" {
+		return nil, errors.New("tracking number is required for manual shipments")
+	}
+	return &CarrierShipment{
+		TrackingID:  trackingNumber,
+		CourierName: req.CourierName,
+	}, nil
+}
+
+func (c *ManualCarrier) GetLabel(ctx context.Context, shipment *models.OrderTracking) (string, error) {
+	return "", ErrCarrierOperationUnsupported
+}
+
+// Track returns no events; manual shipments are updated by hand
+func (c *ManualCarrier) Track(ctx context.Context, shipment *models.OrderTracking) ([]models.TrackingEvent, error) {
+	return nil, nil
+}
+
+// Cancel has nothing to tell a courier; the shipment is only marked cancelled
+func (c *ManualCarrier) Cancel(ctx context.Context, shipment *models.OrderTracking) error {
+	return nil
+}
+
+func (c *ManualCarrier) ParseWebhook(ctx context.Context, payload []byte, headers http.Header) (*CarrierWebhookEvent, error) {
+	return nil, ErrCarrierOperationUnsupported
+}
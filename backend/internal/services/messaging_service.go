@@ -34,11 +34,13 @@ type MessagingService struct {
 	orderConfirmTemplateID   string
 	paymentSuccessTemplateID string
 	shippingUpdateTemplateID string
+	backInStockTemplateID    string
 
 	// WhatsApp template names
 	whatsappOTPTemplate     string
 	whatsappOrderTemplate   string
 	whatsappShippingTemplate string
+	whatsappBackInStockTemplate string
 }
 
 // NewMessagingService creates a new messaging service
@@ -55,11 +57,13 @@ func NewMessagingService(db *mongo.Database) *MessagingService {
 		orderConfirmTemplateID:   getEnvOrDefault("MTALKZ_ORDER_CONFIRM_TEMPLATE_ID", ""),
 		paymentSuccessTemplateID: getEnvOrDefault("MTALKZ_PAYMENT_SUCCESS_TEMPLATE_ID", ""),
 		shippingUpdateTemplateID: getEnvOrDefault("MTALKZ_SHIPPING_UPDATE_TEMPLATE_ID", ""),
+		backInStockTemplateID:    getEnvOrDefault("MTALKZ_BACK_IN_STOCK_TEMPLATE_ID", ""),
 
 		// WhatsApp Template Names
 		whatsappOTPTemplate:      getEnvOrDefault("MTALKZ_WHATSAPP_OTP_TEMPLATE", "otp_verification"),
 		whatsappOrderTemplate:    getEnvOrDefault("MTALKZ_WHATSAPP_ORDER_TEMPLATE", "order_status_update"),
 		whatsappShippingTemplate: getEnvOrDefault("MTALKZ_WHATSAPP_SHIPPING_TEMPLATE", "shipping_update"),
+		whatsappBackInStockTemplate: getEnvOrDefault("MTALKZ_WHATSAPP_BACK_IN_STOCK_TEMPLATE", "back_in_stock"),
 	}
 }
 
@@ -532,6 +536,32 @@ func (s *MessagingService) SendShippingUpdate(ctx context.Context, phone, orderI
 	}
 }
 
+// SendBackInStock tells a customer a product they asked about is available again
+func (s *MessagingService) SendBackInStock(ctx context.Context, phone, productName, productURL string, channel models.OTPChannel) error {
+	switch channel {
+	case models.OTPChannelWhatsApp:
+		template := &models.MtalkzWhatsAppTemplate{
+			Name:     s.whatsappBackInStockTemplate,
+			Language: models.MtalkzTemplateLanguage{Code: "en"},
+			Components: []models.MtalkzTemplateComponent{
+				{
+					Type: "body",
+					Parameters: []models.MtalkzTemplateParameter{
+						{Type: "text", Text: productName},
+						{Type: "text", Text: productURL},
+					},
+				},
+			},
+		}
+		_, err := s.sendWhatsAppTemplate(ctx, phone, template)
+		return err
+	default:
+		message := fmt.Sprintf("Good news! %s is back in stock. Shop now: %s - Thyne Jewels", productName, productURL)
+		_, err := s.sendSMS(ctx, phone, message, "TRANS", s.backInStockTemplateID)
+		return err
+	}
+}
+
 // ==================== Helper Methods ====================
 
 // getLatestOTP gets the latest OTP record for a phone
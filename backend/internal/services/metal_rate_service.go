@@ -0,0 +1,283 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/repository"
+)
+
+var (
+	// ErrInvalidMetalRate is returned for rates with an unknown code or a non-positive rate
+	ErrInvalidMetalRate = errors.New("invalid metal rate")
+	// ErrMetalRateNotSet is returned when a metal code has never been given a rate
+	ErrMetalRateNotSet = errors.New("metal rate not set")
+)
+
+// metalRateCacheTTL bounds how long a server prices from rates that another
+// server may since have changed
+const metalRateCacheTTL = time.Minute
+
+// MetalRateService manages the live per-gram metal rates that metal_rate
+// products are priced from
+type MetalRateService interface {
+	GetCurrentRates(ctx context.Context) ([]models.MetalRate, error)
+	GetRate(ctx context.Context, code string) (*models.MetalRate, error)
+	GetHistory(ctx context.Context, filter models.MetalRateHistoryFilter) ([]models.MetalRate, int64, error)
+	SetRates(ctx context.Context, req *models.SetMetalRatesRequest, actor models.OrderActor) ([]models.MetalRate, error)
+	ImportRatesCSV(ctx context.Context, file io.Reader, actor models.OrderActor) ([]models.MetalRate, error)
+}
+
+type metalRateService struct {
+	metalRateRepo  repository.MetalRateRepository
+	productRepo    repository.ProductRepository
+	storefrontRepo *repository.StorefrontDataRepository
+
+	mu       sync.Mutex
+	current  map[string]models.MetalRate
+	loadedAt time.Time
+}
+
+// NewMetalRateService creates a new metal rate service. productRepo may be nil,
+// in which case stored product prices are not refreshed when a rate changes.
+func NewMetalRateService(metalRateRepo repository.MetalRateRepository, productRepo repository.ProductRepository) MetalRateService {
+	return &metalRateService{
+		metalRateRepo: metalRateRepo,
+		productRepo:   productRepo,
+	}
+}
+
+// SetStorefrontRepo sets the store settings the metal codes are read from
+func (s *metalRateService) SetStorefrontRepo(storefrontRepo *repository.StorefrontDataRepository) {
+	s.storefrontRepo = storefrontRepo
+}
+
+func (s *metalRateService) GetCurrentRates(ctx context.Context) ([]models.MetalRate, error) {
+	current, err := s.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rates := make([]models.MetalRate, 0, len(current))
+	for _, rate := range current {
+		rates = append(rates, rate)
+	}
+	sort.Slice(rates, func(i, j int) bool { return rates[i].Code < rates[j].Code })
+	return rates, nil
+}
+
+func (s *metalRateService) GetRate(ctx context.Context, code string) (*models.MetalRate, error) {
+	current, err := s.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rate, ok := current[models.NormalizeMetalCode(code)]
+	if !ok {
+		return nil, fmt.Errorf("%w for %s", ErrMetalRateNotSet, code)
+	}
+	return &rate, nil
+}
+
+func (s *metalRateService) GetHistory(ctx context.Context, filter models.MetalRateHistoryFilter) ([]models.MetalRate, int64, error) {
+	filter.Code = models.NormalizeMetalCode(filter.Code)
+	return s.metalRateRepo.GetHistory(ctx, filter)
+}
+
+func (s *metalRateService) SetRates(ctx context.Context, req *models.SetMetalRatesRequest, actor models.OrderActor) ([]models.MetalRate, error) {
+	return s.setRates(ctx, req.Rates, models.MetalRateSourceManual, actor)
+}
+
+// ImportRatesCSV sets rates from a CSV with a header row naming a code column
+// and a ratePerGram (or rate) column, and optionally a note column. Nothing is
+// imported unless every row is valid.
+func (s *metalRateService) ImportRatesCSV(ctx context.Context, file io.Reader, actor models.OrderActor) ([]models.MetalRate, error) {
+	reader := csv.NewReader(file)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to parse CSV: %v", ErrInvalidMetalRate, err)
+	}
+	if len(records) < 2 {
+		return nil, fmt.Errorf("%w: CSV must have a header row and at least one rate", ErrInvalidMetalRate)
+	}
+
+	codeCol, rateCol, noteCol := -1, -1, -1
+	for i, header := range records[0] {
+		switch strings.ToLower(strings.TrimSpace(header)) {
+		case "code":
+			codeCol = i
+		case "ratepergram", "rate":
+			rateCol = i
+		case "note":
+			noteCol = i
+		}
+	}
+	if codeCol < 0 || rateCol < 0 {
+		return nil, fmt.Errorf("%w: CSV header must have code and ratePerGram columns", ErrInvalidMetalRate)
+	}
+
+	var rates []models.SetMetalRateRequest
+	var problems []string
+	for i, record := range records[1:] {
+		row := i + 2
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+		if codeCol >= len(record) || rateCol >= len(record) {
+			problems = append(problems, fmt.Sprintf("row %d: missing columns", row))
+			continue
+		}
+		ratePerGram, err := strconv.ParseFloat(strings.TrimSpace(record[rateCol]), 64)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("row %d: rate %q is not a number", row, record[rateCol]))
+			continue
+		}
+		rate := models.SetMetalRateRequest{Code: record[codeCol], RatePerGram: ratePerGram}
+		if noteCol >= 0 && noteCol < len(record) {
+			rate.Note = strings.TrimSpace(record[noteCol])
+		}
+		rates = append(rates, rate)
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidMetalRate, strings.Join(problems, "; "))
+	}
+	if len(rates) == 0 {
+		return nil, fmt.Errorf("%w: CSV has no rates", ErrInvalidMetalRate)
+	}
+
+	return s.setRates(ctx, rates, models.MetalRateSourceCSV, actor)
+}
+
+// setRates validates every rate before recording any, then reprices the
+// products that follow the changed codes
+func (s *metalRateService) setRates(ctx context.Context, reqs []models.SetMetalRateRequest, source models.MetalRateSource, actor models.OrderActor) ([]models.MetalRate, error) {
+	codes, err := s.metalCodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	rates := make([]models.MetalRate, 0, len(reqs))
+	for _, req := range reqs {
+		code := models.NormalizeMetalCode(req.Code)
+		switch {
+		case !codes[code]:
+			return nil, fmt.Errorf("%w: unknown metal code %q", ErrInvalidMetalRate, req.Code)
+		case seen[code]:
+			return nil, fmt.Errorf("%w: %s is listed more than once", ErrInvalidMetalRate, code)
+		case req.RatePerGram <= 0:
+			return nil, fmt.Errorf("%w: rate for %s must be positive", ErrInvalidMetalRate, code)
+		}
+		seen[code] = true
+		rates = append(rates, models.MetalRate{
+			Code:        code,
+			RatePerGram: roundPrice(req.RatePerGram),
+			Source:      source,
+			Note:        strings.TrimSpace(req.Note),
+			SetBy:       actor,
+		})
+	}
+
+	now := time.Now()
+	for i := range rates {
+		rates[i].CreatedAt = now
+		if err := s.metalRateRepo.Create(ctx, &rates[i]); err != nil {
+			s.invalidate()
+			return nil, err
+		}
+	}
+	s.invalidate()
+
+	for _, rate := range rates {
+		s.repriceProducts(ctx, rate)
+	}
+
+	return rates, nil
+}
+
+// repriceProducts stores the new price of every product that follows the
+// rate's code, so listings, price filters and sorting see it. Carts and orders
+// price from the live rate regardless, so failures are only logged.
+func (s *metalRateService) repriceProducts(ctx context.Context, rate models.MetalRate) {
+	if s.productRepo == nil {
+		return
+	}
+
+	products, err := s.productRepo.GetByMetalCode(ctx, rate.Code)
+	if err != nil {
+		fmt.Printf("Warning: failed to load products priced from %s: %v\n", rate.Code, err)
+		return
+	}
+
+	for _, product := range products {
+		if !product.IsRatePriced() {
+			continue
+		}
+		quote := product.WeightPricing.Quote(rate.RatePerGram)
+		if err := s.productRepo.UpdatePrice(ctx, product.ID, quote.Price, quote.MakingCharge); err != nil {
+			fmt.Printf("Warning: failed to reprice product %s: %v\n", product.ID.Hex(), err)
+		}
+	}
+}
+
+// metalCodes lists the MetalSubtype codes of the store's metal options
+func (s *metalRateService) metalCodes(ctx context.Context) (map[string]bool, error) {
+	settings := models.DefaultStoreSettings()
+	if s.storefrontRepo != nil {
+		stored, err := s.storefrontRepo.GetStoreSettings(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load store settings: %w", err)
+		}
+		settings = stored
+	}
+
+	codes := make(map[string]bool)
+	for _, option := range settings.MetalOptions {
+		for _, subtype := range option.Subtypes {
+			if subtype.Code != "" {
+				codes[models.NormalizeMetalCode(subtype.Code)] = true
+			}
+		}
+	}
+	return codes, nil
+}
+
+// load returns the live rate of every code, reading them again once the cache is stale
+func (s *metalRateService) load(ctx context.Context) (map[string]models.MetalRate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.current != nil && time.Since(s.loadedAt) < metalRateCacheTTL {
+		return s.current, nil
+	}
+
+	rates, err := s.metalRateRepo.GetCurrent(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	current := make(map[string]models.MetalRate, len(rates))
+	for _, rate := range rates {
+		current[rate.Code] = rate
+	}
+	s.current = current
+	s.loadedAt = time.Now()
+	return current, nil
+}
+
+func (s *metalRateService) invalidate() {
+	s.mu.Lock()
+	s.current = nil
+	s.mu.Unlock()
+}
@@ -0,0 +1,256 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memoryMetalRateRepository keeps the rate history in memory
+type memoryMetalRateRepository struct {
+	repository.MetalRateRepository
+	rates []models.MetalRate
+}
+
+func (r *memoryMetalRateRepository) Create(ctx context.Context, rate *models.MetalRate) error {
+	rate.ID = primitive.NewObjectID()
+	r.rates = append(r.rates, *rate)
+	return nil
+}
+
+func (r *memoryMetalRateRepository) GetCurrent(ctx context.Context) ([]models.MetalRate, error) {
+	latest := make(map[string]models.MetalRate)
+	for _, rate := range r.rates {
+		latest[rate.Code] = rate
+	}
+	var rates []models.MetalRate
+	for _, rate := range latest {
+		rates = append(rates, rate)
+	}
+	return rates, nil
+}
+
+func (r *memoryMetalRateRepository) GetHistory(ctx context.Context, filter models.MetalRateHistoryFilter) ([]models.MetalRate, int64, error) {
+	var rates []models.MetalRate
+	for i := len(r.rates) - 1; i >= 0; i-- {
+		if filter.Code == "" || r.rates[i].Code == filter.Code {
+			rates = append(rates, r.rates[i])
+		}
+	}
+	return rates, int64(len(rates)), nil
+}
+
+func (r *memoryProductRepository) Create(ctx context.Context, product *models.Product) error {
+	r.products[product.ID] = *product
+	return nil
+}
+
+func (r *memoryProductRepository) GetByMetalCode(ctx context.Context, code string) ([]models.Product, error) {
+	var products []models.Product
+	for _, product := range r.products {
+		if product.IsRatePriced() && product.WeightPricing.MetalCode == code {
+			products = append(products, product)
+		}
+	}
+	return products, nil
+}
+
+func (r *memoryProductRepository) UpdatePrice(ctx context.Context, id primitive.ObjectID, price, makingCharge float64) error {
+	product := r.products[id]
+	product.Price = price
+	product.MakingCharge = &makingCharge
+	r.products[id] = product
+	return nil
+}
+
+func TestMetalCodeFor(t *testing.T) {
+	for metal, want := range map[string]string{
+		"22K Gold":            "G22K",
+		"18kt White Gold":     "G18K",
+		"gold_14k":            "G14K",
+		"925 Sterling Silver": "S925",
+		"950 Platinum":        "PT950",
+		"Rose Gold":           "",
+		"Brass":               "",
+	} {
+		if got := models.MetalCodeFor(metal); got != want {
+			t.Errorf("MetalCodeFor(%q) = %q, want %q", metal, got, want)
+		}
+	}
+}
+
+func TestWeightPricingQuote(t *testing.T) {
+	percent := models.WeightPricing{MetalCode: "G22K", NetWeight: 10, MakingChargeType: models.MakingChargeTypePercent, MakingChargeValue: 12, StoneValue: 5000}
+	if quote := percent.Quote(6500); quote.MetalValue != 65000 || quote.MakingCharge != 7800 || quote.Price != 77800 {
+		t.Errorf("unexpected percent quote %+v", quote)
+	}
+
+	perGram := models.WeightPricing{MetalCode: "S925", NetWeight: 12.5, MakingChargeType: models.MakingChargeTypePerGram, MakingChargeValue: 40}
+	if quote := perGram.Quote(92.4); quote.MetalValue != 1155 || quote.MakingCharge != 500 || quote.Price != 1655 {
+		t.Errorf("unexpected per-gram quote %+v", quote)
+	}
+
+	invalid := models.WeightPricing{MetalCode: "G22K", NetWeight: 0, MakingChargeType: models.MakingChargeTypePercent}
+	if err := invalid.Validate(); !errors.Is(err, models.ErrInvalidWeightPricing) {
+		t.Errorf("expected a weightless product to be refused, got %v", err)
+	}
+}
+
+func TestMetalRatesPriceProducts(t *testing.T) {
+	ctx := context.Background()
+	admin := models.OrderActor{Type: models.OrderActorAdmin, ID: "admin-1"}
+	rateRepo := &memoryMetalRateRepository{}
+	productRepo := &memoryProductRepository{products: map[primitive.ObjectID]models.Product{}}
+	rates := NewMetalRateService(rateRepo, productRepo)
+
+	setRate := func(code string, rate float64) error {
+		_, err := rates.SetRates(ctx, &models.SetMetalRatesRequest{Rates: []models.SetMetalRateRequest{{Code: code, RatePerGram: rate}}}, admin)
+		return err
+	}
+	if err := setRate("G24K", 7200); !errors.Is(err, ErrInvalidMetalRate) {
+		t.Fatalf("expected a code missing from the store's metal options to be refused, got %v", err)
+	}
+	if _, err := rates.SetRates(ctx, &models.SetMetalRatesRequest{Rates: []models.SetMetalRateRequest{
+		{Code: "G22K", RatePerGram: 6500},
+		{Code: "g22k", RatePerGram: 6600},
+	}}, admin); !errors.Is(err, ErrInvalidMetalRate) || len(rateRepo.rates) != 0 {
+		t.Fatalf("expected a code listed twice to be refused with nothing recorded, got %v", err)
+	}
+
+	// Products cannot follow a metal that has no rate yet
+	products := NewProductService(productRepo, nil).(*productService)
+	products.SetMetalRateService(rates)
+	bangle := &models.CreateProductRequest{
+		Name:        "Temple Bangle",
+		Description: "Hand-finished temple bangle",
+		Images:      []string{"bangle.jpg"},
+		MetalType:   "22K Gold",
+		Category:    "Bangles",
+		Subcategory: "Temple",
+		PricingMode: models.PricingModeMetalRate,
+		WeightPricing: &models.WeightPricing{
+			MetalCode:         "g22k",
+			NetWeight:         10,
+			MakingChargeType:  models.MakingChargeTypePercent,
+			MakingChargeValue: 12,
+			StoneValue:        5000,
+		},
+		IsAvailable: true,
+	}
+	if err := bangle.Validate(); err != nil {
+		t.Fatalf("expected a metal_rate product without a price to validate, got %v", err)
+	}
+	if _, err := products.CreateProduct(ctx, bangle); !errors.Is(err, ErrMetalRateNotSet) {
+		t.Fatalf("expected a product on an unset rate to be refused, got %v", err)
+	}
+
+	if err := setRate("G22K", 6500); err != nil {
+		t.Fatalf("set rate: %v", err)
+	}
+	created, err := products.CreateProduct(ctx, bangle)
+	if err != nil {
+		t.Fatalf("create product: %v", err)
+	}
+	if created.Price != 77800 || *created.MakingCharge != 7800 || created.WeightPricing.MetalCode != "G22K" {
+		t.Fatalf("expected the listing price from the rate, got %.2f", created.Price)
+	}
+
+	// A new rate reprices the stored product
+	if err := setRate("G22K", 7000); err != nil {
+		t.Fatalf("set rate: %v", err)
+	}
+	if stored := productRepo.products[created.ID]; stored.Price != 83400 || *stored.MakingCharge != 8400 {
+		t.Fatalf("expected the stored price to follow the rate, got %.2f", stored.Price)
+	}
+
+	// The cart and checkout price from the live rate, and a picked metal uses its own rate
+	pricing := NewPricingService(nil).(*pricingService)
+	pricing.SetMetalRateService(rates)
+	if err := setRate("G18K", 5700); err != nil {
+		t.Fatalf("set rate: %v", err)
+	}
+	product := productRepo.products[created.ID]
+	product.AvailableMetals = []string{"22K Gold", "18K Gold"}
+	product.MetalPriceModifiers = map[string]float64{"18K Gold": -12000}
+	product.EngravingEnabled = true
+	product.EngravingPrice = 500
+	product.MaxEngravingChars = 10
+	productRepo.products[created.ID] = product
+
+	price, err := pricing.PriceProduct(ctx, &product, nil)
+	if err != nil {
+		t.Fatalf("price: %v", err)
+	}
+	if price.UnitPrice != 83400 || price.MakingCharge != 8400 || price.MetalRate == nil || price.MetalRate.RatePerGram != 7000 {
+		t.Fatalf("unexpected live price %+v", price)
+	}
+	price, err = pricing.PriceProduct(ctx, &product, &models.ProductCustomization{Metal: "18K Gold", Engraving: "AR"})
+	if err != nil {
+		t.Fatalf("price: %v", err)
+	}
+	// 10g × 5700 + 12% making + 5000 stones + 500 engraving, without the fixed 18K modifier
+	if price.UnitPrice != 69340 || price.CustomizationPrice != 500 || price.MetalRate.MetalCode != "G18K" {
+		t.Fatalf("unexpected 18K price %+v", price)
+	}
+
+	orders := NewOrderService(nil, productRepo, nil).(*orderService)
+	orders.SetPricingService(pricing)
+	items := []models.OrderItem{{ProductID: created.ID, Quantity: 1, Price: 77800}}
+	if _, err := orders.priceOrderItems(ctx, items); !errors.Is(err, ErrPriceChanged) {
+		t.Fatalf("expected checkout at the old rate to be refused, got %v", err)
+	}
+	items[0].Price = 83400
+	if _, err := orders.priceOrderItems(ctx, items); err != nil {
+		t.Fatalf("price order: %v", err)
+	}
+	if items[0].MetalRate == nil || items[0].MetalRate.RatePerGram != 7000 || items[0].MakingCharge != 8400 {
+		t.Fatalf("expected the order line to record its rate, got %+v", items[0])
+	}
+
+	// A CSV import is all or nothing
+	if _, err := rates.ImportRatesCSV(ctx, strings.NewReader("code,ratePerGram\nG22K,7100\nS925,abc\n"), admin); !errors.Is(err, ErrInvalidMetalRate) {
+		t.Fatalf("expected a bad row to fail the import, got %v", err)
+	}
+	if rate, _ := rates.GetRate(ctx, "G22K"); rate.RatePerGram != 7000 {
+		t.Fatalf("expected nothing imported, got %.2f", rate.RatePerGram)
+	}
+	imported, err := rates.ImportRatesCSV(ctx, strings.NewReader("Code, Rate, Note\nG22K, 7100, IBJA morning\nS925, 92.5,\n\nPT950, 3150,\n"), admin)
+	if err != nil || len(imported) != 3 {
+		t.Fatalf("import: %v", err)
+	}
+	if imported[0].Source != models.MetalRateSourceCSV || imported[0].Note != "IBJA morning" {
+		t.Errorf("unexpected imported rate %+v", imported[0])
+	}
+	if stored := productRepo.products[created.ID]; stored.Price != 84520 {
+		t.Errorf("expected the import to reprice the product, got %.2f", stored.Price)
+	}
+
+	current, err := rates.GetCurrentRates(ctx)
+	if err != nil || len(current) != 4 {
+		t.Fatalf("expected four current rates, got %d (%v)", len(current), err)
+	}
+	if !sort.SliceIsSorted(current, func(i, j int) bool { return current[i].Code < current[j].Code }) {
+		t.Errorf("expected current rates sorted by code")
+	}
+	history, total, err := rates.GetHistory(ctx, models.MetalRateHistoryFilter{Code: "g22k"})
+	if err != nil || total != 3 || history[0].RatePerGram != 7100 || history[2].RatePerGram != 6500 {
+		t.Fatalf("unexpected G22K history %+v (%v)", history, err)
+	}
+
+	// Price estimates read the same live rates
+	estimate, err := (&AIService{metalRateService: rates}).EstimatePrice(ctx, "a simple band", models.JewelryTypeRing, models.MetalTypeGold22K)
+	if err != nil || estimate.MetalPrice != 7100 {
+		t.Fatalf("expected the estimate to use the live 22K rate, got %+v (%v)", estimate, err)
+	}
+	estimate, _ = (&AIService{metalRateService: rates}).EstimatePrice(ctx, "a simple band", models.JewelryTypeRing, models.MetalTypeGold14K)
+	if estimate.MetalPrice != models.MetalPrices[models.MetalTypeGold14K] {
+		t.Errorf("expected metals without a rate to fall back, got %.2f", estimate.MetalPrice)
+	}
+}
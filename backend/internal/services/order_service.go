@@ -4,7 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"math/rand"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -19,29 +21,42 @@ type OrderService interface {
     GetAllOrders(page, limit int, status *models.OrderStatus) ([]models.Order, int64, error)
 	GetOrder(orderID string) (*models.Order, error)
 	GetOrderByNumber(orderNumber string) (*models.Order, error)
-	CancelOrder(orderID string, reason string) error
-	TrackOrder(orderID string) (*models.Order, error)
-	ReturnOrder(orderID string, reason string) error
-	RefundOrder(orderID string, reason string) error
-	UpdateOrderStatus(orderID string, status models.OrderStatus, trackingNumber *string) error
+	CancelOrder(orderID string, actor models.OrderActor, reason string) error
+	TrackOrder(orderID string) (*models.OrderTimeline, error)
+	ReturnOrder(orderID string, actor models.OrderActor, reason string) error
+	RefundOrder(orderID string, amount float64, actor models.OrderActor, reason string) error
+	UpdateOrderStatus(orderID string, status models.OrderStatus, trackingNumber *string, actor models.OrderActor, reason string) error
 	CompleteOrder(orderID string) error
 	UpdatePaymentDetails(orderID string, paymentProviderOrderID string, paymentSessionID string) error
+	ReleaseExpiredReservations() error
 }
 
 type orderService struct {
 	orderRepo         repository.OrderRepository
 	productRepo       repository.ProductRepository
 	cartRepo          repository.CartRepository
+	couponRepo        repository.CouponRepository
 	storefrontRepo    *repository.StorefrontDataRepository
+	homepageRepo      repository.HomepageRepository
+	pricingService    PricingService
+	stockService      StockService
 	loyaltyService    *LoyaltyService
 	notificationService *NotificationService
+	paymentService    PaymentService
+	trackingRepo      repository.PDFRepository
+	warrantyService   WarrantyService
+	certificateService CertificateService
+	inventoryUnitService InventoryUnitService
+	backInStockService   BackInStockService
+	adminNotificationRepo repository.AdminNotificationRepository
 }
 
 func NewOrderService(orderRepo repository.OrderRepository, productRepo repository.ProductRepository, cartRepo repository.CartRepository) OrderService {
 	return &orderService{
-		orderRepo:   orderRepo,
-		productRepo: productRepo,
-		cartRepo:    cartRepo,
+		orderRepo:      orderRepo,
+		productRepo:    productRepo,
+		cartRepo:       cartRepo,
+		pricingService: NewPricingService(nil),
 	}
 }
 
@@ -49,10 +64,113 @@ func (s *orderService) SetStorefrontRepo(storefrontRepo *repository.StorefrontDa
 	s.storefrontRepo = storefrontRepo
 }
 
+// SetCouponRepository lets orders take the coupon applied to the cart or quoted at checkout
+func (s *orderService) SetCouponRepository(couponRepo repository.CouponRepository) {
+	s.couponRepo = couponRepo
+}
+
+// SetHomepageRepository enables deal of the day and flash sale pricing on orders
+func (s *orderService) SetHomepageRepository(homepageRepo repository.HomepageRepository) {
+	s.homepageRepo = homepageRepo
+	s.pricingService = NewPricingService(homepageRepo)
+}
+
+// SetPricingService sets the pricing service used to price order lines
+func (s *orderService) SetPricingService(pricingService PricingService) {
+	s.pricingService = pricingService
+}
+
+// SetStockService enables stock reservation for stocked products
+func (s *orderService) SetStockService(stockService StockService) {
+	s.stockService = stockService
+}
+
 func (s *orderService) SetLoyaltyService(loyaltyService *LoyaltyService) {
 	s.loyaltyService = loyaltyService
 }
 
+// SetPaymentService enables gateway refunds for cancelled and returned orders
+func (s *orderService) SetPaymentService(paymentService PaymentService) {
+	s.paymentService = paymentService
+}
+
+// SetTrackingRepository adds carrier tracking events to order timelines
+func (s *orderService) SetTrackingRepository(trackingRepo repository.PDFRepository) {
+	s.trackingRepo = trackingRepo
+}
+
+// SetWarrantyService issues warranties on the lines of delivered orders
+func (s *orderService) SetWarrantyService(warrantyService WarrantyService) {
+	s.warrantyService = warrantyService
+}
+
+// SetCertificateService issues certificates of authenticity for delivered orders
+func (s *orderService) SetCertificateService(certificateService CertificateService) {
+	s.certificateService = certificateService
+}
+
+// SetInventoryUnitService puts the pieces packed into cancelled orders back into stock
+func (s *orderService) SetInventoryUnitService(inventoryUnitService InventoryUnitService) {
+	s.inventoryUnitService = inventoryUnitService
+}
+
+// SetBackInStockService credits back-in-stock alerts with the purchases they lead to
+func (s *orderService) SetBackInStockService(backInStockService BackInStockService) {
+	s.backInStockService = backInStockService
+}
+
+// SetAdminNotificationRepository sets where admins are alerted to payments
+// received for cancelled orders
+func (s *orderService) SetAdminNotificationRepository(adminNotificationRepo repository.AdminNotificationRepository) {
+	s.adminNotificationRepo = adminNotificationRepo
+}
+
+// applyCoupon discounts the order the way the cart summary does. A code sent
+// with the order must apply; otherwise the coupon applied to the cart is used
+// when it still applies, and dropped as the cart summary drops it when not.
+func (s *orderService) applyCoupon(ctx context.Context, order *models.Order, req *models.CreateOrderRequest) (*models.Coupon, error) {
+	code := ""
+	if req.CouponCode != nil {
+		code = strings.TrimSpace(*req.CouponCode)
+	}
+	explicit := code != ""
+	if !explicit {
+		code = s.cartCouponCode(ctx, order)
+	}
+	if code == "" {
+		return nil, nil
+	}
+
+	coupon, discount, err := couponDiscount(ctx, s.couponRepo, code, order.Subtotal)
+	if err != nil {
+		if explicit {
+			return nil, err
+		}
+		return nil, nil
+	}
+	order.Discount = discount
+	order.CouponCode = &coupon.Code
+	return coupon, nil
+}
+
+// cartCouponCode returns the coupon applied to the customer's cart, if any
+func (s *orderService) cartCouponCode(ctx context.Context, order *models.Order) string {
+	if s.cartRepo == nil {
+		return ""
+	}
+	var cart *models.Cart
+	var err error
+	if !order.UserID.IsZero() {
+		cart, err = s.cartRepo.GetByUserID(ctx, order.UserID)
+	} else {
+		cart, err = s.cartRepo.GetByGuestSessionID(ctx, order.GuestSessionID)
+	}
+	if err != nil || cart.CouponCode == nil {
+		return ""
+	}
+	return *cart.CouponCode
+}
+
 func (s *orderService) SetNotificationService(notificationService *NotificationService) {
 	s.notificationService = notificationService
 }
@@ -60,6 +178,12 @@ func (s *orderService) SetNotificationService(notificationService *NotificationS
 func (s *orderService) CreateOrder(userID string, guestSessionID string, req *models.CreateOrderRequest) (*models.Order, error) {
 	ctx := context.Background()
 
+	// Business buyers may quote a GSTIN to get a B2B invoice
+	buyerGSTIN := models.NormalizeGSTIN(req.BuyerGSTIN)
+	if buyerGSTIN != "" && !models.ValidGSTIN(buyerGSTIN) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidGSTIN, req.BuyerGSTIN)
+	}
+
 	// Generate unique order number using store settings
 	var orderNumber string
 	var err error
@@ -86,9 +210,13 @@ func (s *orderService) CreateOrder(userID string, guestSessionID string, req *mo
 		Shipping:        0,
 		Discount:        0,
 		Total:           0,
+		BuyerGSTIN:      buyerGSTIN,
 		CreatedAt:       time.Now(),
 		UpdatedAt:       time.Now(),
 	}
+	if buyerGSTIN != "" {
+		order.BuyerLegalName = strings.TrimSpace(req.BuyerLegalName)
+	}
 
 	// Set user ID or guest session ID
 	if userID != "" {
@@ -102,24 +230,107 @@ func (s *orderService) CreateOrder(userID string, guestSessionID string, req *mo
 	} else {
 		return nil, errors.New("either user ID or guest session ID is required")
 	}
+	customer := models.OrderActor{Type: models.OrderActorCustomer, ID: userID}
+	if userID == "" {
+		customer.ID = guestSessionID
+	}
+	order.RecordCreation(customer)
+
+	// Re-price every line from the catalogue; client prices are only checked, never trusted
+	products, err := s.priceOrderItems(ctx, order.Items)
+	if err != nil {
+		return nil, err
+	}
 
 	// Calculate totals
 	total := 0.0
-	for _, item := range req.Items {
+	for _, item := range order.Items {
 		total += item.Price * float64(item.Quantity)
 	}
 
-	order.Subtotal = total
-	order.Tax = total * 0.18 // 18% GST
-	order.Shipping = 0 // Free shipping for now
-	order.Total = order.Subtotal + order.Tax + order.Shipping
+	settings := models.DefaultStoreSettings()
+	if s.storefrontRepo != nil {
+		stored, err := s.storefrontRepo.GetStoreSettings(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load store settings: %w", err)
+		}
+		settings = stored
+	}
+
+	order.Subtotal = roundPrice(total)
+	coupon, err := s.applyCoupon(ctx, order, req)
+	if err != nil {
+		return nil, err
+	}
+	order.TaxBreakdown = calculateGST(settings, order.TaxableLines(), order.Discount, order.ShippingAddress.State)
+	order.Tax = order.TaxBreakdown.Total
+
+	// Ship by pincode zone, weight and value; COD must be allowed for the zone and the total
+	weight := 0.0
+	for _, item := range order.Items {
+		weight += parcelWeight(products[item.ProductID], item.Quantity)
+	}
+	quote := quoteShipping(settings, order.ShippingAddress.Pincode, models.Parcel{
+		Weight: weight,
+		Value:  order.Subtotal - order.Discount,
+		Tax:    order.Tax,
+	})
+	if !quote.Serviceable {
+		return nil, fmt.Errorf("%w: %s", ErrNotServiceable, order.ShippingAddress.Pincode)
+	}
+	if order.PaymentMethod == models.PaymentMethodCOD {
+		if !quote.CODAvailable {
+			return nil, fmt.Errorf("%w: %s", ErrCODNotAvailable, quote.Message)
+		}
+		order.CODCharge = quote.CODCharge
+	}
+	order.Shipping = quote.Shipping
+	order.Total = roundPrice(order.Subtotal - order.Discount + order.Tax + order.Shipping + order.CODCharge)
+
+	// Hold stock for stocked products; COD orders are committed straight away
+	order.ID = primitive.NewObjectID()
+	if s.stockService != nil {
+		if err := s.stockService.ReserveOrderStock(ctx, order, products); err != nil {
+			return nil, err
+		}
+		if order.PaymentMethod == models.PaymentMethodCOD {
+			if err := s.stockService.CommitOrderStock(ctx, order); err != nil {
+				fmt.Printf("Warning: failed to commit stock for order %s: %v\n", order.OrderNumber, err)
+			}
+		}
+	}
 
 	// Save to database
 	err = s.orderRepo.Create(ctx, order)
 	if err != nil {
+		if s.stockService != nil {
+			if relErr := s.stockService.ReleaseOrderStock(ctx, order, "Order could not be saved"); relErr != nil {
+				fmt.Printf("Warning: failed to release stock for order %s: %v\n", order.OrderNumber, relErr)
+			}
+		}
 		return nil, fmt.Errorf("failed to create order: %w", err)
 	}
 
+	if coupon != nil {
+		if err := s.couponRepo.IncrementUsage(ctx, coupon.ID); err != nil {
+			fmt.Printf("Warning: failed to count use of coupon %s: %v\n", coupon.Code, err)
+		}
+	}
+
+	// Count deal of the day units sold
+	if s.homepageRepo != nil {
+		for _, dealID := range order.AppliedDealIDs() {
+			if err := s.homepageRepo.IncrementDealSold(ctx, dealID); err != nil {
+				fmt.Printf("Warning: failed to update deal sold count for order %s: %v\n", order.OrderNumber, err)
+			}
+		}
+	}
+
+	// COD orders are purchases once placed; paid orders count when payment is received
+	if order.PaymentMethod == models.PaymentMethodCOD && s.backInStockService != nil {
+		s.backInStockService.RecordPurchase(ctx, order)
+	}
+
 	// Send order placed notification if user is authenticated and notification service is available
 	if !order.UserID.IsZero() && s.notificationService != nil {
 		go func() {
@@ -132,6 +343,81 @@ func (s *orderService) CreateOrder(userID string, guestSessionID string, req *mo
 	return order, nil
 }
 
+// priceOrderItems replaces client-supplied prices and product details with server values.
+// Lines of products sold by variant are tied to the variant they buy. Every line must carry the unit price
+// the customer was shown; a missing price, or one that differs from the server price, is rejected with ErrPriceChanged.
+// The loaded products are returned keyed by ID.
+func (s *orderService) priceOrderItems(ctx context.Context, items []models.OrderItem) (map[primitive.ObjectID]*models.Product, error) {
+	products := make(map[primitive.ObjectID]*models.Product)
+	for i := range items {
+		item := &items[i]
+		if item.Quantity <= 0 {
+			return nil, errors.New("item quantity must be at least 1")
+		}
+
+		product, err := s.productRepo.GetByID(ctx, item.ProductID)
+		if err != nil {
+			return nil, fmt.Errorf("product %s not found", item.ProductID.Hex())
+		}
+		if !product.IsAvailable {
+			return nil, fmt.Errorf("%s is no longer available", product.Name)
+		}
+
+		variant, customization, err := resolveVariant(product, item.VariantID, item.Customization)
+		if err != nil {
+			return nil, err
+		}
+		item.Customization = customization
+		item.VariantID = nil
+		item.SKU = ""
+		if variant != nil {
+			variantID := variant.ID
+			item.VariantID = &variantID
+			item.SKU = variant.SKU
+		}
+
+		price, err := s.pricingService.PriceProduct(ctx, product, item.Customization)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", product.Name, err)
+		}
+
+		if math.Abs(item.Price-price.UnitPrice) > priceTolerance {
+			return nil, fmt.Errorf("%w: %s is now %.2f", ErrPriceChanged, product.Name, price.UnitPrice)
+		}
+
+		item.Price = price.UnitPrice
+		item.Name = product.Name
+		item.Category = product.Category
+		item.MakingCharge = price.MakingCharge
+		if len(product.Images) > 0 {
+			item.Image = product.Images[0]
+		}
+		products[product.ID] = product
+		item.StockReserved = false
+		item.Units = nil
+		item.PriceSource = price.Source
+		item.DealID = price.DealID
+		item.MetalRate = price.MetalRate
+		item.OriginalPrice = nil
+		item.SalePrice = nil
+		item.DiscountPercent = nil
+		if price.IsDiscounted() {
+			originalPrice := price.OriginalPrice
+			salePrice := price.UnitPrice
+			discountPercent := price.DiscountPercent
+			item.OriginalPrice = &originalPrice
+			item.SalePrice = &salePrice
+			item.DiscountPercent = &discountPercent
+		}
+		if item.Customization != nil {
+			item.Customization.PriceModifier = price.CustomizationPrice
+			item.Customization.SummaryLines = item.Customization.GetSummaryLines()
+		}
+	}
+
+	return products, nil
+}
+
 func (s *orderService) GetOrders(userID string, guestSessionID string, page, limit int) ([]models.Order, int64, error) {
 	ctx := context.Background()
 
@@ -171,7 +457,7 @@ func (s *orderService) GetOrderByNumber(orderNumber string) (*models.Order, erro
 	return s.orderRepo.GetByOrderNumber(ctx, orderNumber)
 }
 
-func (s *orderService) CancelOrder(orderID string, reason string) error {
+func (s *orderService) CancelOrder(orderID string, actor models.OrderActor, reason string) error {
 	ctx := context.Background()
 	
 	objID, err := primitive.ObjectIDFromHex(orderID)
@@ -185,15 +471,45 @@ func (s *orderService) CancelOrder(orderID string, reason string) error {
 	}
 
 	if !order.IsCancellable() {
-		return errors.New("order cannot be cancelled")
+		return fmt.Errorf("%w: %s orders cannot be cancelled", models.ErrInvalidOrderStatusTransition, order.Status)
 	}
 
-	order.Cancel(reason)
-    err = s.orderRepo.Update(ctx, order)
-	if err != nil {
+	from, fromPayment := order.Status, order.PaymentStatus
+	unpaid := order.PaymentStatus != models.PaymentStatusPaid
+	if err := order.Cancel(actor, reason); err != nil {
+		return err
+	}
+	// Claim the cancellation before releasing stock or refunding, so an order
+	// changed concurrently, e.g. paid or shipped, is not cancelled behind its back
+	if err := s.orderRepo.TransitionStatus(ctx, order, from, fromPayment); err != nil {
+		return err
+	}
+	if s.stockService != nil {
+		if err := s.stockService.ReleaseOrderStock(ctx, order, reason); err != nil {
+			fmt.Printf("Warning: failed to restock cancelled order %s: %v\n", order.OrderNumber, err)
+		}
+	}
+	if s.inventoryUnitService != nil {
+		if err := s.inventoryUnitService.ReleaseOrderUnits(ctx, order); err != nil {
+			fmt.Printf("Warning: failed to release the pieces packed into cancelled order %s: %v\n", order.OrderNumber, err)
+		}
+	}
+	// Only the stock fields are saved, so payment and refund updates made
+	// since the order was read are kept
+	if err := s.orderRepo.UpdateStock(ctx, order); err != nil {
 		return err
 	}
 
+	// Paid orders are refunded in full; a failed refund is retried in the background
+	if order.PaymentStatus == models.PaymentStatusPaid {
+		if _, err := s.refundPayment(ctx, order, 0, reason); err != nil {
+			fmt.Printf("Warning: failed to refund cancelled order %s: %v\n", order.OrderNumber, err)
+		}
+	}
+	if unpaid {
+		s.closePayments(order, reason)
+	}
+
 	// Send order cancelled notification if user is authenticated and notification service is available
 	if !order.UserID.IsZero() && s.notificationService != nil {
 		go func() {
@@ -206,11 +522,26 @@ func (s *orderService) CancelOrder(orderID string, reason string) error {
 	return nil
 }
 
-func (s *orderService) TrackOrder(orderID string) (*models.Order, error) {
-	return s.GetOrder(orderID)
+// TrackOrder returns the order's status timeline
+func (s *orderService) TrackOrder(orderID string) (*models.OrderTimeline, error) {
+	order, err := s.GetOrder(orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	timeline := order.GetTimeline()
+	if s.trackingRepo != nil {
+		tracking, err := s.trackingRepo.GetOrderTracking(context.Background(), order.ID)
+		if err == nil {
+			timeline.Shipment = tracking
+		} else if !errors.Is(err, repository.ErrOrderTrackingNotFound) {
+			fmt.Printf("Warning: failed to load tracking for order %s: %v\n", order.OrderNumber, err)
+		}
+	}
+	return timeline, nil
 }
 
-func (s *orderService) ReturnOrder(orderID string, reason string) error {
+func (s *orderService) ReturnOrder(orderID string, actor models.OrderActor, reason string) error {
 	ctx := context.Background()
 	
 	objID, err := primitive.ObjectIDFromHex(orderID)
@@ -227,14 +558,27 @@ func (s *orderService) ReturnOrder(orderID string, reason string) error {
 		return errors.New("only delivered orders can be returned")
 	}
 
-	order.Status = models.OrderStatusReturned
+	if err := order.TransitionTo(models.OrderStatusReturned, actor, reason); err != nil {
+		return err
+	}
 	order.ReturnReason = &reason
-	order.UpdatedAt = time.Now()
-	
-	return s.orderRepo.Update(ctx, order)
+	if err := s.orderRepo.TransitionStatus(ctx, order, models.OrderStatusDelivered, order.PaymentStatus); err != nil {
+		return err
+	}
+	if s.stockService != nil {
+		if err := s.stockService.RestockReturnedOrder(ctx, order, reason); err != nil {
+			fmt.Printf("Warning: failed to restock returned order %s: %v\n", order.OrderNumber, err)
+		}
+	}
+
+	return s.orderRepo.UpdateStock(ctx, order)
 }
 
-func (s *orderService) RefundOrder(orderID string, reason string) error {
+// RefundOrder refunds a delivered or returned order through its payment gateway.
+// An amount of zero refunds whatever has not been refunded yet. A partial refund
+// is only recorded; once the whole total is refunded the order is returned and
+// its units restocked.
+func (s *orderService) RefundOrder(orderID string, amount float64, actor models.OrderActor, reason string) error {
 	ctx := context.Background()
 	
 	objID, err := primitive.ObjectIDFromHex(orderID)
@@ -251,11 +595,61 @@ func (s *orderService) RefundOrder(orderID string, reason string) error {
 		return errors.New("order is not refundable")
 	}
 
-	order.Refund(reason)
-	return s.orderRepo.Update(ctx, order)
+	from := order.Status
+	if _, err := s.refundPayment(ctx, order, amount, reason); err != nil {
+		return err
+	}
+	if order.RefundableAmount() > 0 {
+		return nil
+	}
+
+	if err := order.Refund(actor, reason); err != nil {
+		return err
+	}
+	if order.Status != from {
+		if err := s.orderRepo.TransitionStatus(ctx, order, from, order.PaymentStatus); err != nil {
+			return err
+		}
+	}
+	if s.stockService != nil {
+		if err := s.stockService.RestockReturnedOrder(ctx, order, reason); err != nil {
+			fmt.Printf("Warning: failed to restock refunded order %s: %v\n", order.OrderNumber, err)
+		}
+	}
+	return s.orderRepo.UpdateStock(ctx, order)
 }
 
-func (s *orderService) UpdateOrderStatus(orderID string, status models.OrderStatus, trackingNumber *string) error {
+// refundPayment refunds the order's payment and saves the refund on the order.
+// Only the refund, the refund summary and the payment status are saved.
+func (s *orderService) refundPayment(ctx context.Context, order *models.Order, amount float64, reason string) (*models.PaymentRefund, error) {
+	if s.paymentService == nil {
+		return nil, errors.New("payment service is not configured")
+	}
+
+	refund, err := s.paymentService.RefundPayment(order, amount, reason)
+	if err != nil {
+		return nil, err
+	}
+	if refund.Status == models.RefundStatusFailed {
+		fmt.Printf("Warning: refund %s for order %s failed and will be retried: %s\n", refund.RefundID, order.OrderNumber, refund.FailureReason)
+	}
+	if err := s.orderRepo.AddRefund(ctx, order, *refund); err != nil {
+		return refund, err
+	}
+
+	return refund, nil
+}
+
+// UpdateOrderStatus moves an order along the transition table. Cancellations and
+// returns go through CancelOrder and ReturnOrder so stock and payments follow.
+func (s *orderService) UpdateOrderStatus(orderID string, status models.OrderStatus, trackingNumber *string, actor models.OrderActor, reason string) error {
+	switch status {
+	case models.OrderStatusCancelled:
+		return s.CancelOrder(orderID, actor, reason)
+	case models.OrderStatusReturned:
+		return s.ReturnOrder(orderID, actor, reason)
+	}
+
 	ctx := context.Background()
 	
 	objID, err := primitive.ObjectIDFromHex(orderID)
@@ -268,16 +662,32 @@ func (s *orderService) UpdateOrderStatus(orderID string, status models.OrderStat
 		return err
 	}
 
-	order.UpdateStatus(status)
+	from := order.Status
+	if err := order.TransitionTo(status, actor, reason); err != nil {
+		return err
+	}
 	if trackingNumber != nil {
 		order.TrackingNumber = trackingNumber
 	}
 
-    err = s.orderRepo.Update(ctx, order)
-	if err != nil {
+	// Saved only if no one else moved the order on since it was read
+	if err := s.orderRepo.TransitionStatus(ctx, order, from, order.PaymentStatus); err != nil {
 		return err
 	}
 
+	// The delivery stands even if the warranties or certificates cannot be
+	// issued; issuing skips what already exists, so it can be retried
+	if status == models.OrderStatusDelivered && s.warrantyService != nil {
+		if _, err := s.warrantyService.IssueWarranties(ctx, order); err != nil {
+			fmt.Printf("Warning: failed to issue warranties for order %s: %v\n", order.OrderNumber, err)
+		}
+	}
+	if status == models.OrderStatusDelivered && s.certificateService != nil {
+		if _, err := s.certificateService.IssueCertificates(ctx, order); err != nil {
+			fmt.Printf("Warning: failed to issue certificates for order %s: %v\n", order.OrderNumber, err)
+		}
+	}
+
 	// Send appropriate notification based on status change if user is authenticated and notification service is available
 	if !order.UserID.IsZero() && s.notificationService != nil {
 		go func() {
@@ -315,14 +725,47 @@ func (s *orderService) CompleteOrder(orderID string) error {
 		return err
 	}
 
-	// Update order status to completed/paid
-	order.UpdateStatus(models.OrderStatusConfirmed)
+	// Gateways report a payment more than once (e.g. payment.captured and order.paid),
+	// so stock and loyalty credits are only handled the first time
+	if order.PaymentStatus == models.PaymentStatusPaid {
+		return nil
+	}
+
+	// Update order status to completed/paid. An order an admin already moved on keeps its status.
+	switch order.Status {
+	case models.OrderStatusPending:
+		fromPayment := order.PaymentStatus
+		if err := order.TransitionTo(models.OrderStatusConfirmed, models.OrderActor{Type: models.OrderActorSystem}, "Payment received"); err != nil {
+			return err
+		}
+		order.PaymentStatus = models.PaymentStatusPaid
+		// Lost to a concurrent cancellation or a repeated report of the payment;
+		// start again from the order as it is now
+		if err := s.orderRepo.TransitionStatus(ctx, order, models.OrderStatusPending, fromPayment); err != nil {
+			if errors.Is(err, models.ErrInvalidOrderStatusTransition) {
+				return s.CompleteOrder(orderID)
+			}
+			return err
+		}
+	case models.OrderStatusCancelled:
+		return s.refundLatePayment(ctx, order)
+	}
 	order.PaymentStatus = models.PaymentStatusPaid
+	if s.stockService != nil {
+		if err := s.stockService.CommitOrderStock(ctx, order); err != nil {
+			// Payment is already captured, so keep the order and flag the shortfall
+			fmt.Printf("Warning: paid order %s could not commit stock: %v\n", order.OrderNumber, err)
+		}
+	}
 	
 	if err := s.orderRepo.Update(ctx, order); err != nil {
 		return err
 	}
 
+	if s.backInStockService != nil {
+		s.backInStockService.RecordPurchase(ctx, order)
+	}
+
 	// Award loyalty credits if user is authenticated and loyalty service is available
 	if !order.UserID.IsZero() && s.loyaltyService != nil {
 		err := s.loyaltyService.AddCreditsFromPurchase(ctx, order.UserID, order.Total, order.ID)
@@ -335,6 +778,54 @@ func (s *orderService) CompleteOrder(orderID string) error {
 	return nil
 }
 
+// refundLatePayment handles a payment captured after the order was cancelled, such as
+// when its reservation lapsed while the customer was still paying. The stock is gone,
+// so the payment is refunded in full and admins are alerted to follow up with the
+// customer. A failed refund is retried by the refund job like any other.
+func (s *orderService) refundLatePayment(ctx context.Context, order *models.Order) error {
+	// Reported again after the refund went through
+	if order.PaymentStatus == models.PaymentStatusRefunded {
+		return nil
+	}
+
+	order.PaymentStatus = models.PaymentStatusPaid
+	order.UpdatedAt = time.Now()
+	refund, err := s.refundPayment(ctx, order, 0, "Paid after the order was cancelled")
+	if err != nil {
+		return fmt.Errorf("order %s was paid after it was cancelled and could not be refunded: %w", order.OrderNumber, err)
+	}
+
+	if s.adminNotificationRepo != nil {
+		notification := &models.AdminNotification{
+			Title:     "Payment received for cancelled order " + order.OrderNumber,
+			Message:   fmt.Sprintf("Order %s was paid after it was cancelled. Refund %s of %.2f is %s.", order.OrderNumber, refund.RefundID, refund.Amount, refund.Status),
+			Type:      models.NotificationTypeWarning,
+			Priority:  models.PriorityHigh,
+			ActionURL: "/admin/orders/" + order.ID.Hex(),
+			Metadata: map[string]interface{}{
+				"orderId":      order.ID.Hex(),
+				"refundId":     refund.RefundID,
+				"refundStatus": refund.Status,
+			},
+		}
+		if err := s.adminNotificationRepo.Create(ctx, notification); err != nil {
+			fmt.Printf("Warning: failed to alert admins to the late payment for order %s: %v\n", order.OrderNumber, err)
+		}
+	}
+
+	return nil
+}
+
+// closePayments closes the checkouts still open for an order that can no longer be paid
+func (s *orderService) closePayments(order *models.Order, reason string) {
+	if s.paymentService == nil {
+		return
+	}
+	if err := s.paymentService.CloseOpenAttempts(order, reason); err != nil {
+		fmt.Printf("Warning: failed to close payments for order %s: %v\n", order.OrderNumber, err)
+	}
+}
+
 func (s *orderService) UpdatePaymentDetails(orderID string, paymentProviderOrderID string, paymentSessionID string) error {
 	ctx := context.Background()
 
@@ -355,6 +846,50 @@ func (s *orderService) UpdatePaymentDetails(orderID string, paymentProviderOrder
 	return s.orderRepo.Update(ctx, order)
 }
 
+// ReleaseExpiredReservations cancels unpaid orders whose stock reservation has lapsed
+// and returns their stock
+func (s *orderService) ReleaseExpiredReservations() error {
+	if s.stockService == nil {
+		return nil
+	}
+
+	ctx := context.Background()
+
+	orders, err := s.orderRepo.GetExpiredReservations(ctx, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to load expired reservations: %w", err)
+	}
+
+	for i := range orders {
+		order := &orders[i]
+		reason := "Payment not completed within the reservation window"
+		if !order.IsCancellable() {
+			continue
+		}
+		from, fromPayment := order.Status, order.PaymentStatus
+		if err := order.Cancel(models.OrderActor{Type: models.OrderActorSystem}, reason); err != nil {
+			fmt.Printf("Warning: failed to cancel expired order %s: %v\n", order.OrderNumber, err)
+			continue
+		}
+		// A payment that lands first keeps the order
+		if err := s.orderRepo.TransitionStatus(ctx, order, from, fromPayment); err != nil {
+			if !errors.Is(err, models.ErrInvalidOrderStatusTransition) {
+				fmt.Printf("Warning: failed to cancel expired order %s: %v\n", order.OrderNumber, err)
+			}
+			continue
+		}
+		if err := s.stockService.ReleaseOrderStock(ctx, order, reason); err != nil {
+			fmt.Printf("Warning: failed to release stock for order %s: %v\n", order.OrderNumber, err)
+		}
+		if err := s.orderRepo.UpdateStock(ctx, order); err != nil {
+			fmt.Printf("Warning: failed to save released stock of expired order %s: %v\n", order.OrderNumber, err)
+		}
+		s.closePayments(order, reason)
+	}
+
+	return nil
+}
+
 func generateOrderNumber() string {
 	// Generate order number: TJ + timestamp + random
 	timestamp := time.Now().Unix()
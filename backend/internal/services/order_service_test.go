@@ -0,0 +1,430 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestOrderStatusTransitionsAndTimeline(t *testing.T) {
+	order := models.Order{
+		ID:            primitive.NewObjectID(),
+		OrderNumber:   "TJ-2001",
+		PaymentMethod: models.PaymentMethodCOD,
+		PaymentStatus: models.PaymentStatusPending,
+		Status:        models.OrderStatusPending,
+		Total:         5400,
+		CreatedAt:     time.Now(),
+	}
+	order.RecordCreation(models.OrderActor{Type: models.OrderActorCustomer, ID: "guest-1"})
+	repo := &memoryOrderRepository{orders: map[primitive.ObjectID]models.Order{order.ID: order}}
+	svc := NewOrderService(repo, nil, nil)
+	admin := models.OrderActor{Type: models.OrderActorAdmin, ID: "admin-1"}
+	orderID := order.ID.Hex()
+
+	if err := svc.UpdateOrderStatus(orderID, models.OrderStatusDelivered, nil, admin, ""); !errors.Is(err, models.ErrInvalidOrderStatusTransition) {
+		t.Fatalf("expected pending to delivered to be rejected, got %v", err)
+	}
+
+	tracking := "AWB123"
+	steps := []models.OrderStatus{models.OrderStatusConfirmed, models.OrderStatusShipped, models.OrderStatusDelivered}
+	for _, status := range steps {
+		if err := svc.UpdateOrderStatus(orderID, status, &tracking, admin, "Moved to "+string(status)); err != nil {
+			t.Fatalf("update to %s: %v", status, err)
+		}
+	}
+
+	if err := svc.UpdateOrderStatus(orderID, models.OrderStatusPending, nil, admin, ""); !errors.Is(err, models.ErrInvalidOrderStatusTransition) {
+		t.Fatalf("expected delivered to pending to be rejected, got %v", err)
+	}
+	if err := svc.CancelOrder(orderID, admin, "Too late"); !errors.Is(err, models.ErrInvalidOrderStatusTransition) {
+		t.Fatalf("expected delivered order not to be cancellable, got %v", err)
+	}
+
+	timeline, err := svc.TrackOrder(orderID)
+	if err != nil {
+		t.Fatalf("track: %v", err)
+	}
+	if timeline.Status != models.OrderStatusDelivered || timeline.TrackingNumber == nil || *timeline.TrackingNumber != tracking {
+		t.Fatalf("unexpected timeline header %+v", timeline)
+	}
+	if len(timeline.Timeline) != 4 {
+		t.Fatalf("expected creation plus three changes, got %+v", timeline.Timeline)
+	}
+	first, last := timeline.Timeline[0], timeline.Timeline[3]
+	if first.To != models.OrderStatusPending || first.Actor.Type != models.OrderActorCustomer {
+		t.Fatalf("expected the timeline to start with the customer placing the order, got %+v", first)
+	}
+	if last.From != models.OrderStatusShipped || last.To != models.OrderStatusDelivered || last.Actor != admin || last.Reason != "Moved to delivered" {
+		t.Fatalf("unexpected last change %+v", last)
+	}
+	if stored := repo.orders[order.ID]; stored.ShippedAt == nil || stored.DeliveredAt == nil {
+		t.Fatalf("expected shipped and delivered timestamps, got %+v", stored)
+	}
+}
+
+// staleOrderRepository serves a copy of an order read before it last changed
+type staleOrderRepository struct {
+	*memoryOrderRepository
+	stale models.Order
+}
+
+func (r *staleOrderRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.Order, error) {
+	order := r.stale
+	order.StatusHistory = append([]models.OrderStatusChange(nil), r.stale.StatusHistory...)
+	return &order, nil
+}
+
+func TestStatusChangeFromStaleReadIsRejected(t *testing.T) {
+	order := models.Order{
+		ID:            primitive.NewObjectID(),
+		OrderNumber:   "TJ-2002",
+		PaymentMethod: models.PaymentMethodCOD,
+		PaymentStatus: models.PaymentStatusPending,
+		Status:        models.OrderStatusPending,
+		CreatedAt:     time.Now(),
+	}
+	order.RecordCreation(models.OrderActor{Type: models.OrderActorCustomer, ID: "guest-1"})
+	repo := &memoryOrderRepository{orders: map[primitive.ObjectID]models.Order{order.ID: order}}
+	admin := models.OrderActor{Type: models.OrderActorAdmin, ID: "admin-1"}
+	orderID := order.ID.Hex()
+
+	// Another admin confirms the order after this one read it
+	stale := NewOrderService(&staleOrderRepository{memoryOrderRepository: repo, stale: order}, nil, nil)
+	if err := NewOrderService(repo, nil, nil).UpdateOrderStatus(orderID, models.OrderStatusConfirmed, nil, admin, "Confirmed by phone"); err != nil {
+		t.Fatalf("confirm: %v", err)
+	}
+
+	if err := stale.UpdateOrderStatus(orderID, models.OrderStatusConfirmed, nil, admin, "Confirmed again"); !errors.Is(err, models.ErrInvalidOrderStatusTransition) {
+		t.Fatalf("expected a transition from a stale status to be rejected, got %v", err)
+	}
+	if err := stale.CancelOrder(orderID, admin, "Customer called"); !errors.Is(err, models.ErrInvalidOrderStatusTransition) {
+		t.Fatalf("expected a cancellation from a stale status to be rejected, got %v", err)
+	}
+
+	stored := repo.orders[order.ID]
+	if stored.Status != models.OrderStatusConfirmed || stored.PaymentStatus != models.PaymentStatusPending || len(stored.StatusHistory) != 2 {
+		t.Fatalf("expected only the first confirmation to be saved, got %+v", stored)
+	}
+	if last := stored.StatusHistory[1]; last.Reason != "Confirmed by phone" {
+		t.Fatalf("unexpected history entry %+v", last)
+	}
+}
+
+func TestCancellationKeepsFieldsSavedSinceRead(t *testing.T) {
+	order := models.Order{
+		ID:            primitive.NewObjectID(),
+		OrderNumber:   "TJ-2003",
+		PaymentMethod: models.PaymentMethodRazorpay,
+		PaymentStatus: models.PaymentStatusPending,
+		Status:        models.OrderStatusPending,
+		CreatedAt:     time.Now(),
+	}
+	order.RecordCreation(models.OrderActor{Type: models.OrderActorCustomer, ID: "guest-1"})
+	repo := &memoryOrderRepository{orders: map[primitive.ObjectID]models.Order{order.ID: order}}
+	stale := NewOrderService(&staleOrderRepository{memoryOrderRepository: repo, stale: order}, nil, nil)
+
+	// A checkout is opened after the order was read for cancelling
+	updated := repo.orders[order.ID]
+	session := "session-1"
+	updated.PaymentSessionID = &session
+	repo.orders[order.ID] = updated
+
+	if err := stale.CancelOrder(order.ID.Hex(), models.OrderActor{Type: models.OrderActorAdmin, ID: "admin-1"}, "Customer called"); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	stored := repo.orders[order.ID]
+	if stored.Status != models.OrderStatusCancelled || stored.PaymentSessionID == nil || *stored.PaymentSessionID != session {
+		t.Fatalf("expected the cancellation to keep the checkout saved since, got %+v", stored)
+	}
+}
+
+func TestLegacyOrderTimeline(t *testing.T) {
+	created := time.Now().Add(-72 * time.Hour)
+	shipped := created.Add(24 * time.Hour)
+	reason := "Changed my mind"
+	order := models.Order{
+		Status:       models.OrderStatusReturned,
+		CreatedAt:    created,
+		ShippedAt:    &shipped,
+		DeliveredAt:  &shipped,
+		ReturnReason: &reason,
+		UpdatedAt:    shipped.Add(time.Hour),
+	}
+
+	timeline := order.Timeline()
+	var statuses []models.OrderStatus
+	for _, change := range timeline {
+		statuses = append(statuses, change.To)
+	}
+	expected := []models.OrderStatus{models.OrderStatusPending, models.OrderStatusShipped, models.OrderStatusDelivered, models.OrderStatusReturned}
+	if len(statuses) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, statuses)
+	}
+	for i := range expected {
+		if statuses[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, statuses)
+		}
+	}
+	if timeline[3].Reason != reason || timeline[3].From != models.OrderStatusDelivered {
+		t.Fatalf("unexpected return entry %+v", timeline[3])
+	}
+}
+
+func (r *memoryOrderRepository) Create(ctx context.Context, order *models.Order) error {
+	if order.ID.IsZero() {
+		order.ID = primitive.NewObjectID()
+	}
+	r.orders[order.ID] = *order
+	return nil
+}
+
+func (r *memoryOrderRepository) TransitionStatus(ctx context.Context, order *models.Order, from models.OrderStatus, fromPayment models.PaymentStatus) error {
+	stored, ok := r.orders[order.ID]
+	if !ok || stored.Status != from || (order.PaymentStatus != fromPayment && stored.PaymentStatus != fromPayment) {
+		return models.ErrInvalidOrderStatusTransition
+	}
+	stored.Status = order.Status
+	stored.PaymentStatus = order.PaymentStatus
+	stored.StatusHistory = append(stored.StatusHistory, order.StatusHistory[len(order.StatusHistory)-1])
+	stored.ProcessedAt, stored.ShippedAt, stored.DeliveredAt = order.ProcessedAt, order.ShippedAt, order.DeliveredAt
+	stored.TrackingNumber, stored.CancellationReason, stored.ReturnReason = order.TrackingNumber, order.CancellationReason, order.ReturnReason
+	stored.UpdatedAt = order.UpdatedAt
+	r.orders[order.ID] = stored
+	return nil
+}
+
+func (r *memoryOrderRepository) AddRefund(ctx context.Context, order *models.Order, refund models.PaymentRefund) error {
+	stored := r.orders[order.ID]
+	for _, saved := range stored.Refunds {
+		if saved.RefundID == refund.RefundID {
+			return fmt.Errorf("refund %s is already saved", refund.RefundID)
+		}
+	}
+	stored.Refunds = append(stored.Refunds, refund)
+	stored.PaymentStatus, stored.RefundStatus, stored.RefundAmount, stored.RefundedAt = order.PaymentStatus, order.RefundStatus, order.RefundAmount, order.RefundedAt
+	r.orders[order.ID] = stored
+	return nil
+}
+
+func (r *memoryOrderRepository) UpdateStock(ctx context.Context, order *models.Order) error {
+	stored := r.orders[order.ID]
+	stored.StockStatus, stored.StockReservedUntil, stored.FulfillmentLocationID = order.StockStatus, order.StockReservedUntil, order.FulfillmentLocationID
+	stored.Items = append([]models.OrderItem(nil), stored.Items...)
+	for i := range stored.Items {
+		if i < len(order.Items) {
+			stored.Items[i].StockReserved, stored.Items[i].LocationID, stored.Items[i].Units = order.Items[i].StockReserved, order.Items[i].LocationID, order.Items[i].Units
+		}
+	}
+	r.orders[order.ID] = stored
+	return nil
+}
+
+// memoryHomepageRepository serves one deal of the day and the live flash sales
+type memoryHomepageRepository struct {
+	repository.HomepageRepository
+	deal       *models.DealOfDay
+	flashSales []models.FlashSale
+}
+
+func (r *memoryHomepageRepository) GetActiveDealOfDay(ctx context.Context) (*models.DealOfDay, error) {
+	return r.deal, nil
+}
+
+func (r *memoryHomepageRepository) GetActiveFlashSales(ctx context.Context) ([]models.FlashSale, error) {
+	return r.flashSales, nil
+}
+
+func (r *memoryHomepageRepository) IncrementDealSold(ctx context.Context, dealID primitive.ObjectID) error {
+	if r.deal != nil && r.deal.ID == dealID {
+		r.deal.SoldCount++
+	}
+	return nil
+}
+
+func TestCreateOrderRepricesLines(t *testing.T) {
+	now := time.Now()
+	ring := models.Product{ID: primitive.NewObjectID(), Name: "Solitaire Ring", Category: "Rings", Price: 10000, IsAvailable: true}
+	pendant := models.Product{ID: primitive.NewObjectID(), Name: "Pearl Pendant", Category: "Pendants", Price: 5000, IsAvailable: true}
+	chain := models.Product{ID: primitive.NewObjectID(), Name: "Rope Chain", Category: "Chains", Price: 3000, IsAvailable: true}
+	homepage := &memoryHomepageRepository{
+		deal: &models.DealOfDay{
+			ID: primitive.NewObjectID(), ProductID: ring.ID, DealPrice: 8000,
+			StartTime: now.Add(-time.Hour), EndTime: now.Add(time.Hour), Stock: 5, IsActive: true,
+		},
+		flashSales: []models.FlashSale{{
+			ID: primitive.NewObjectID(), ProductIDs: []primitive.ObjectID{pendant.ID}, Discount: 10,
+			StartTime: now.Add(-time.Hour), EndTime: now.Add(time.Hour), IsActive: true,
+		}},
+	}
+	orders := &memoryOrderRepository{orders: map[primitive.ObjectID]models.Order{}}
+	products := &memoryProductRepository{products: map[primitive.ObjectID]models.Product{ring.ID: ring, pendant.ID: pendant, chain.ID: chain}}
+	svc := NewOrderService(orders, products, nil).(*orderService)
+	svc.SetHomepageRepository(homepage)
+
+	request := func(items ...models.OrderItem) *models.CreateOrderRequest {
+		return &models.CreateOrderRequest{
+			Items:           items,
+			ShippingAddress: models.Address{City: "Mumbai", State: "Maharashtra", Pincode: "400001"},
+			PaymentMethod:   models.PaymentMethodRazorpay,
+		}
+	}
+
+	// The ring's regular price is stale while its deal is live
+	if _, err := svc.CreateOrder("", "guest-1", request(models.OrderItem{ProductID: ring.ID, Quantity: 1, Price: 10000})); !errors.Is(err, ErrPriceChanged) {
+		t.Fatalf("expected a stale price to be rejected, got %v", err)
+	}
+	// A tampered client cannot skip the check by leaving the price out or sending zero
+	if _, err := svc.CreateOrder("", "guest-1", request(models.OrderItem{ProductID: chain.ID, Quantity: 1})); !errors.Is(err, ErrPriceChanged) {
+		t.Fatalf("expected a line without a price to be rejected, got %v", err)
+	}
+	if _, err := svc.CreateOrder("", "guest-1", request(models.OrderItem{ProductID: chain.ID, Quantity: 1, Price: 1})); !errors.Is(err, ErrPriceChanged) {
+		t.Fatalf("expected a tampered price to be rejected, got %v", err)
+	}
+	if len(orders.orders) != 0 {
+		t.Fatalf("expected rejected orders not to be saved, got %d", len(orders.orders))
+	}
+
+	order, err := svc.CreateOrder("", "guest-1", request(
+		models.OrderItem{ProductID: ring.ID, Quantity: 1, Price: 8000, Name: "Anything"},
+		models.OrderItem{ProductID: pendant.ID, Quantity: 2, Price: 4500.2},
+		models.OrderItem{ProductID: chain.ID, Quantity: 1, Price: 3000},
+	))
+	if err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+
+	ringLine, pendantLine, chainLine := order.Items[0], order.Items[1], order.Items[2]
+	if ringLine.Price != 8000 || ringLine.Name != ring.Name || ringLine.PriceSource != models.PriceSourceDealOfDay || ringLine.DealID == nil || *ringLine.DealID != homepage.deal.ID {
+		t.Fatalf("expected the ring at its deal price, got %+v", ringLine)
+	}
+	if ringLine.OriginalPrice == nil || *ringLine.OriginalPrice != 10000 || ringLine.DiscountPercent == nil || *ringLine.DiscountPercent != 20 {
+		t.Fatalf("expected the ring's regular price and discount to be recorded, got %+v", ringLine)
+	}
+	if pendantLine.Price != 4500 || pendantLine.PriceSource != models.PriceSourceFlashSale || pendantLine.DealID != nil {
+		t.Fatalf("expected the pendant at the server's flash sale price, got %+v", pendantLine)
+	}
+	if chainLine.Price != 3000 || chainLine.PriceSource != models.PriceSourceRegular || chainLine.OriginalPrice != nil {
+		t.Fatalf("expected the chain at its regular price, got %+v", chainLine)
+	}
+	if order.Subtotal != 20000 {
+		t.Fatalf("expected a subtotal of 20000, got %.2f", order.Subtotal)
+	}
+	if order.Total != roundPrice(order.Subtotal+order.Tax+order.Shipping) {
+		t.Fatalf("expected the total to add up from the server prices, got %+v", order)
+	}
+	if homepage.deal.SoldCount != 1 {
+		t.Fatalf("expected the deal to count the unit sold, got %d", homepage.deal.SoldCount)
+	}
+	if _, ok := orders.orders[order.ID]; !ok {
+		t.Fatal("expected the order to be saved")
+	}
+}
+
+// memoryCouponRepository serves coupons by code and counts their use
+type memoryCouponRepository struct {
+	repository.CouponRepository
+	coupons map[string]*models.Coupon
+}
+
+func (r *memoryCouponRepository) GetByCode(ctx context.Context, code string) (*models.Coupon, error) {
+	coupon, ok := r.coupons[code]
+	if !ok {
+		return nil, errors.New("coupon not found")
+	}
+	copied := *coupon
+	return &copied, nil
+}
+
+func (r *memoryCouponRepository) IncrementUsage(ctx context.Context, id primitive.ObjectID) error {
+	for _, coupon := range r.coupons {
+		if coupon.ID == id {
+			coupon.UsedCount++
+		}
+	}
+	return nil
+}
+
+func TestCreateOrderAppliesCartCoupon(t *testing.T) {
+	now := time.Now()
+	minAmount := 5000.0
+	maxDiscount := 1500.0
+	coupons := &memoryCouponRepository{coupons: map[string]*models.Coupon{
+		"FIRST10": {ID: primitive.NewObjectID(), Code: "FIRST10", Type: "percentage", Value: 10, MaxDiscount: &maxDiscount,
+			IsActive: true, ValidFrom: now.Add(-time.Hour), ValidUntil: now.Add(time.Hour)},
+		"BIG": {ID: primitive.NewObjectID(), Code: "BIG", Type: "fixed", Value: 500, MinAmount: &minAmount,
+			IsActive: true, ValidFrom: now.Add(-time.Hour), ValidUntil: now.Add(time.Hour)},
+	}}
+	bangle := models.Product{ID: primitive.NewObjectID(), Name: "Gold Bangle", Category: "Bangles", Price: 12000, IsAvailable: true, StockQuantity: 5}
+	earrings := models.Product{ID: primitive.NewObjectID(), Name: "Stud Earrings", Category: "Earrings", Price: 2000, IsAvailable: true, StockQuantity: 5}
+	products := &memoryProductRepository{products: map[primitive.ObjectID]models.Product{bangle.ID: bangle, earrings.ID: earrings}}
+	cartRepo := &memoryCartRepository{carts: map[string]models.Cart{}}
+	carts := NewCartService(cartRepo, products, coupons)
+	orders := &memoryOrderRepository{orders: map[primitive.ObjectID]models.Order{}}
+	svc := NewOrderService(orders, products, cartRepo).(*orderService)
+	svc.SetCouponRepository(coupons)
+
+	if _, err := carts.AddToCart("", "guest-1", bangle.ID.Hex(), "", 1, nil); err != nil {
+		t.Fatalf("add to cart: %v", err)
+	}
+	if _, err := carts.ApplyCoupon("", "guest-1", "FIRST10"); err != nil {
+		t.Fatalf("apply coupon: %v", err)
+	}
+	cart, err := carts.QuoteShipping("", "guest-1", "400001")
+	if err != nil {
+		t.Fatalf("quote shipping: %v", err)
+	}
+	if cart.Summary.Discount != 1200 {
+		t.Fatalf("expected the cart to take 10%% off, got %+v", cart.Summary)
+	}
+
+	request := &models.CreateOrderRequest{
+		Items:           []models.OrderItem{{ProductID: bangle.ID, Quantity: 1, Price: 12000}},
+		ShippingAddress: models.Address{City: "Mumbai", State: "Maharashtra", Pincode: "400001"},
+		PaymentMethod:   models.PaymentMethodRazorpay,
+	}
+	order, err := svc.CreateOrder("", "guest-1", request)
+	if err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	if order.Discount != cart.Summary.Discount || order.Tax != cart.Summary.Tax || order.Total != cart.Summary.Total {
+		t.Fatalf("expected the order to total what the cart showed (%.2f), got discount %.2f, tax %.2f, total %.2f",
+			cart.Summary.Total, order.Discount, order.Tax, order.Total)
+	}
+	if order.CouponCode == nil || *order.CouponCode != "FIRST10" || coupons.coupons["FIRST10"].UsedCount != 1 {
+		t.Fatalf("expected the order to record and count the coupon, got %v", order.CouponCode)
+	}
+
+	// A code sent with the order must apply; the cart's own coupon is dropped quietly, as the summary drops it
+	code := "BIG"
+	small := &models.CreateOrderRequest{
+		Items:           []models.OrderItem{{ProductID: earrings.ID, Quantity: 1, Price: 2000}},
+		ShippingAddress: request.ShippingAddress,
+		PaymentMethod:   models.PaymentMethodRazorpay,
+		CouponCode:      &code,
+	}
+	if _, err := svc.CreateOrder("", "guest-1", small); !errors.Is(err, ErrInvalidCoupon) {
+		t.Fatalf("expected a coupon below its minimum order to be refused, got %v", err)
+	}
+	unknown := "NOPE"
+	small.CouponCode = &unknown
+	if _, err := svc.CreateOrder("", "guest-1", small); !errors.Is(err, ErrInvalidCoupon) {
+		t.Fatalf("expected an unknown coupon to be refused, got %v", err)
+	}
+	cartRepo.carts["guest-1"] = models.Cart{GuestSessionID: "guest-1", CouponCode: &code}
+	small.CouponCode = nil
+	order, err = svc.CreateOrder("", "guest-1", small)
+	if err != nil || order.Discount != 0 || order.CouponCode != nil {
+		t.Fatalf("expected the cart's inapplicable coupon to be dropped, got %+v (%v)", order, err)
+	}
+	if coupons.coupons["BIG"].UsedCount != 0 {
+		t.Fatal("expected a dropped coupon not to be counted")
+	}
+}
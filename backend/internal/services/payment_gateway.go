@@ -0,0 +1,143 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"thyne-jewels-backend/internal/models"
+)
+
+// ErrGatewayOperationUnsupported is returned when a gateway cannot perform an operation
+var ErrGatewayOperationUnsupported = errors.New("operation not supported by payment gateway")
+
+// PaymentGateway is implemented by each payment provider. Gateways only talk to the
+// provider; recording attempts and settling orders is left to PaymentService.
+type PaymentGateway interface {
+	Method() models.PaymentMethod
+	Name() string
+	IsEnabled() bool
+	// CreatePayment opens a checkout session for the order
+	CreatePayment(ctx context.Context, req *GatewayPaymentRequest) (*GatewayPayment, error)
+	// CreatePaymentLink creates a hosted payment link for the order
+	CreatePaymentLink(ctx context.Context, req *GatewayPaymentRequest) (*GatewayPayment, error)
+	// VerifyPayment checks the parameters the client received at the end of checkout
+	VerifyPayment(ctx context.Context, attempt *models.PaymentAttempt, params map[string]string) (*GatewayPaymentStatus, error)
+	// GetPaymentStatus asks the provider for the current state of an attempt
+	GetPaymentStatus(ctx context.Context, attempt *models.PaymentAttempt) (*GatewayPaymentStatus, error)
+	// ParseWebhook verifies a webhook delivery and extracts the payment it reports
+	ParseWebhook(ctx context.Context, payload []byte, headers http.Header) (*GatewayWebhookEvent, error)
+	// Refund returns money for a paid attempt
+	Refund(ctx context.Context, attempt *models.PaymentAttempt, req *GatewayRefundRequest) (*GatewayRefund, error)
+	// CancelPayment closes an unpaid attempt so it can no longer be paid. Gateways
+	// that cannot close a checkout return ErrGatewayOperationUnsupported.
+	CancelPayment(ctx context.Context, attempt *models.PaymentAttempt) error
+}
+
+// GatewayPaymentRequest carries what a gateway needs to open a checkout or payment link
+type GatewayPaymentRequest struct {
+	Order         *models.Order
+	Reference     string // Unique per attempt; sent to the provider as its order or link ID where allowed
+	Amount        float64
+	Currency      string
+	CustomerID    string
+	CustomerName  string
+	CustomerPhone string
+	CustomerEmail string
+	ReturnURL     string
+	NotifyURL     string
+	Purpose       string
+	ExpiresAt     *time.Time
+}
+
+// GatewayPayment is the provider's side of a new checkout session or payment link
+type GatewayPayment struct {
+	ProviderOrderID string
+	SessionID       string
+	LinkURL         string
+	Checkout        map[string]interface{}
+}
+
+// GatewayPaymentStatus is the provider's view of an attempt
+type GatewayPaymentStatus struct {
+	ProviderOrderID   string
+	ProviderPaymentID string
+	Status            models.PaymentAttemptStatus
+	Amount            float64
+	FailureReason     string
+}
+
+// GatewayWebhookEvent is a verified webhook delivery. Payment and Refund are nil
+// for events that do not change the state of a payment or refund.
+type GatewayWebhookEvent struct {
+	EventID string
+	Type    string
+	OrderID string // Our order ID when the provider echoes it back
+	Payment *GatewayPaymentStatus
+	Refund  *GatewayRefund
+}
+
+// GatewayRefundRequest describes a refund to issue against a paid attempt
+type GatewayRefundRequest struct {
+	RefundID string
+	Amount   float64
+	Reason   string
+}
+
+// GatewayRefund is the provider's view of a refund
+type GatewayRefund struct {
+	RefundID         string
+	ProviderRefundID string
+	ProviderOrderID  string
+	Status           models.RefundStatus
+	Amount           float64
+	FailureReason    string
+}
+
+// PaymentGatewayRegistry looks up payment gateways by payment method
+type PaymentGatewayRegistry struct {
+	gateways map[models.PaymentMethod]PaymentGateway
+}
+
+// NewPaymentGatewayRegistry creates a registry holding the given gateways
+func NewPaymentGatewayRegistry(gateways ...PaymentGateway) *PaymentGatewayRegistry {
+	registry := &PaymentGatewayRegistry{gateways: make(map[models.PaymentMethod]PaymentGateway)}
+	for _, gateway := range gateways {
+		registry.Register(gateway)
+	}
+	return registry
+}
+
+// Register adds a gateway, replacing any gateway registered for the same method
+func (r *PaymentGatewayRegistry) Register(gateway PaymentGateway) {
+	r.gateways[gateway.Method()] = gateway
+}
+
+// Get returns the enabled gateway for a payment method
+func (r *PaymentGatewayRegistry) Get(method models.PaymentMethod) (PaymentGateway, error) {
+	gateway, ok := r.gateways[method]
+	if !ok {
+		return nil, fmt.Errorf("unknown payment gateway: %s", method)
+	}
+	if !gateway.IsEnabled() {
+		return nil, fmt.Errorf("%s is not configured", gateway.Name())
+	}
+	return gateway, nil
+}
+
+// List describes every registered gateway, sorted by method
+func (r *PaymentGatewayRegistry) List() []models.PaymentGatewayInfo {
+	infos := make([]models.PaymentGatewayInfo, 0, len(r.gateways))
+	for method, gateway := range r.gateways {
+		infos = append(infos, models.PaymentGatewayInfo{
+			Gateway: method,
+			Name:    gateway.Name(),
+			Enabled: gateway.IsEnabled(),
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Gateway < infos[j].Gateway })
+	return infos
+}
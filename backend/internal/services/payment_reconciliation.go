@@ -0,0 +1,265 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// reconciliationLookback is how far back the reconciler looks for unsettled orders
+	reconciliationLookback = 7 * 24 * time.Hour
+	// stalePaymentAfter is how long an attempt may stay unpaid before its order is failed
+	stalePaymentAfter = 24 * time.Hour
+)
+
+// SetReconciliationReportRepository sets the store for reconciliation reports.
+// Without it reports are returned but not kept.
+func (s *paymentService) SetReconciliationReportRepository(reportRepo repository.ReconciliationReportRepository) {
+	s.reportRepo = reportRepo
+}
+
+// ReconcilePayments asks the gateways about every recent order that reached a gateway
+// but is not marked paid, e.g. because the app stopped after checkout and the webhook
+// was lost. Orders are settled or failed to match the gateway, payments for cancelled
+// orders are refunded, and anything that needs a person - amounts that differ, money
+// taken for already paid orders, gateways that could not be queried - is listed in the report.
+func (s *paymentService) ReconcilePayments() (*models.ReconciliationReport, error) {
+	ctx := context.Background()
+	report := &models.ReconciliationReport{
+		StartedAt: time.Now(),
+		Counts:    make(map[models.ReconciliationEntryKind]int),
+	}
+
+	orders, err := s.orderRepo.GetUnsettledPayments(ctx, report.StartedAt.Add(-reconciliationLookback))
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range orders {
+		report.OrdersChecked++
+		if err := s.reconcileOrder(ctx, report, &orders[i]); err != nil {
+			fmt.Printf("Warning: failed to reconcile order %s: %v\n", orders[i].OrderNumber, err)
+		}
+	}
+
+	report.FinishedAt = time.Now()
+	if s.reportRepo != nil {
+		if err := s.reportRepo.Create(ctx, report); err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+func (s *paymentService) ListReconciliationReports(page, limit int) ([]models.ReconciliationReport, int64, error) {
+	if s.reportRepo == nil {
+		return nil, 0, errors.New("reconciliation report store is not configured")
+	}
+	return s.reportRepo.List(context.Background(), page, limit)
+}
+
+func (s *paymentService) GetReconciliationReport(id string) (*models.ReconciliationReport, error) {
+	if s.reportRepo == nil {
+		return nil, errors.New("reconciliation report store is not configured")
+	}
+
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.New("invalid report ID")
+	}
+
+	return s.reportRepo.GetByID(context.Background(), objID)
+}
+
+// ReconciliationReportCSV renders a report's entries as CSV, one row per finding
+func (s *paymentService) ReconciliationReportCSV(report *models.ReconciliationReport) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+
+	rows := [][]string{{
+		"Kind", "Order Number", "Order ID", "Gateway", "Attempt ID", "Provider Order ID",
+		"Provider Payment ID", "Expected Amount", "Gateway Amount", "Detail",
+	}}
+	for _, entry := range report.Entries {
+		rows = append(rows, []string{
+			string(entry.Kind),
+			entry.OrderNumber,
+			entry.OrderID.Hex(),
+			string(entry.Gateway),
+			entry.AttemptID.Hex(),
+			entry.ProviderOrderID,
+			entry.ProviderPaymentID,
+			strconv.FormatFloat(entry.ExpectedAmount, 'f', 2, 64),
+			strconv.FormatFloat(entry.GatewayAmount, 'f', 2, 64),
+			entry.Detail,
+		})
+	}
+
+	if err := writer.WriteAll(rows); err != nil {
+		return nil, fmt.Errorf("failed to write CSV: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// reconcileOrder checks each gateway attempt of an order. The order is only failed for
+// staleness once none of its attempts can still be paid.
+func (s *paymentService) reconcileOrder(ctx context.Context, report *models.ReconciliationReport, order *models.Order) error {
+	attempts, err := s.attemptRepo.GetByOrder(ctx, order.ID)
+	if err != nil {
+		return err
+	}
+
+	stillOpen, stale := false, false
+	for i := range attempts {
+		attempt := &attempts[i]
+		if attempt.ProviderOrderID == "" {
+			// Nothing to ask the gateway about, e.g. cash on delivery
+			stillOpen = stillOpen || attempt.IsOpen()
+			continue
+		}
+
+		entry := models.ReconciliationEntry{
+			OrderID:         order.ID,
+			OrderNumber:     order.OrderNumber,
+			AttemptID:       attempt.ID,
+			Gateway:         attempt.Gateway,
+			ProviderOrderID: attempt.ProviderOrderID,
+			ExpectedAmount:  attempt.Amount,
+		}
+
+		gw, err := s.gateways.Get(attempt.Gateway)
+		if err != nil {
+			entry.Kind = models.ReconciliationError
+			entry.Detail = err.Error()
+			report.Add(entry)
+			stillOpen = stillOpen || attempt.IsOpen()
+			continue
+		}
+
+		report.AttemptsChecked++
+		status, err := gw.GetPaymentStatus(ctx, attempt)
+		if err != nil {
+			entry.Kind = models.ReconciliationError
+			entry.Detail = err.Error()
+			report.Add(entry)
+			stillOpen = stillOpen || attempt.IsOpen()
+			continue
+		}
+		entry.ProviderPaymentID = status.ProviderPaymentID
+		entry.GatewayAmount = status.Amount
+
+		switch status.Status {
+		case models.PaymentAttemptPaid:
+			s.reconcilePaid(ctx, report, order, attempt, status, entry)
+			if latest, err := s.orderRepo.GetByID(ctx, order.ID); err == nil {
+				*order = *latest
+			}
+
+		case models.PaymentAttemptFailed:
+			if attempt.Status == models.PaymentAttemptFailed {
+				continue
+			}
+			if err := s.settle(ctx, order, attempt, status); err != nil {
+				entry.Kind = models.ReconciliationError
+				entry.Detail = err.Error()
+			} else {
+				entry.Kind = models.ReconciliationFailed
+				entry.Detail = status.FailureReason
+			}
+			report.Add(entry)
+
+		default:
+			if status.Status == models.PaymentAttemptPending && attempt.Status == models.PaymentAttemptCreated {
+				if err := s.settle(ctx, order, attempt, status); err != nil {
+					return err
+				}
+			}
+			if !attempt.IsOpen() {
+				continue
+			}
+			if time.Since(attempt.CreatedAt) < stalePaymentAfter {
+				stillOpen = true
+				continue
+			}
+
+			entry.Kind = models.ReconciliationStale
+			if status.Status == models.PaymentAttemptPending {
+				// The customer has paid but the gateway has not captured it; leave it for a person
+				entry.Detail = fmt.Sprintf("Payment authorized but not captured after %.0f hours", stalePaymentAfter.Hours())
+				report.Add(entry)
+				stillOpen = true
+				continue
+			}
+
+			attempt.Status = models.PaymentAttemptFailed
+			attempt.FailureReason = fmt.Sprintf("No payment received within %.0f hours", stalePaymentAfter.Hours())
+			if err := s.attemptRepo.Update(ctx, attempt); err != nil {
+				return err
+			}
+			entry.Detail = attempt.FailureReason
+			report.Add(entry)
+			stale = true
+		}
+	}
+
+	if stale && !stillOpen && order.PaymentStatus == models.PaymentStatusPending {
+		order.MarkAsFailed()
+		return s.orderRepo.Update(ctx, order)
+	}
+
+	return nil
+}
+
+// reconcilePaid settles an attempt the gateway reports as paid. A cancelled order is
+// settled too, which refunds the payment and alerts admins; once refunded it is no
+// longer unsettled, so it is only reported once. Money taken for an order paid through
+// another attempt is reported as an orphan payment to be refunded by hand.
+func (s *paymentService) reconcilePaid(ctx context.Context, report *models.ReconciliationReport, order *models.Order, attempt *models.PaymentAttempt, status *GatewayPaymentStatus, entry models.ReconciliationEntry) {
+	if order.PaymentStatus == models.PaymentStatusPaid {
+		if attempt.Status != models.PaymentAttemptPaid {
+			now := time.Now()
+			attempt.Status = models.PaymentAttemptPaid
+			attempt.ProviderPaymentID = status.ProviderPaymentID
+			attempt.FailureReason = ""
+			attempt.PaidAt = &now
+			if err := s.attemptRepo.Update(ctx, attempt); err != nil {
+				fmt.Printf("Warning: failed to record orphan payment %s: %v\n", status.ProviderPaymentID, err)
+			}
+		}
+		entry.Kind = models.ReconciliationOrphanPayment
+		entry.Detail = "Order was already paid through another attempt"
+		report.Add(entry)
+		return
+	}
+
+	cancelled := order.Status == models.OrderStatusCancelled
+
+	err := s.settle(ctx, order, attempt, status)
+	switch {
+	case errors.Is(err, ErrPaymentAmountMismatch):
+		entry.Kind = models.ReconciliationAmountMismatch
+		entry.ExpectedAmount = order.Total
+		entry.Detail = err.Error()
+	case err != nil:
+		entry.Kind = models.ReconciliationError
+		entry.Detail = err.Error()
+	case cancelled:
+		entry.Kind = models.ReconciliationRefunded
+		entry.Detail = "Order is cancelled"
+	default:
+		entry.Kind = models.ReconciliationSettled
+	}
+	report.Add(entry)
+}
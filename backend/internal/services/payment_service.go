@@ -1,49 +1,912 @@
 package services
 
 import (
-	"thyne-jewels-backend/internal/config"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"thyne-jewels-backend/internal/models"
 	"thyne-jewels-backend/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-type PaymentService interface {
-	CreatePaymentOrder(orderID string, amount float64, currency string) (*PaymentOrderResponse, error)
-	VerifyPayment(paymentID string, orderID string, signature string) error
-	HandleWebhook(payload []byte, signature string) error
-}
+// ErrPaymentAmountMismatch is returned when a payment amount does not match the order total
+var ErrPaymentAmountMismatch = errors.New("payment amount does not match order total")
+
+// ErrOrderNotFound is returned when an order does not exist or belongs to another customer
+var ErrOrderNotFound = errors.New("order not found")
+
+// ErrRefundAmountInvalid is returned when a refund is not positive or exceeds what is left to refund
+var ErrRefundAmountInvalid = errors.New("invalid refund amount")
+
+// ErrRefundNeedsManualHandling is returned for an order paid online whose payment cannot be found to refund it
+var ErrRefundNeedsManualHandling = errors.New("no gateway payment to refund; refund the order manually")
+
+// ErrWebhookEventNotReplayable is returned when replaying a webhook event that has not failed
+var ErrWebhookEventNotReplayable = errors.New("only failed webhook events can be replayed")
 
-type PaymentOrderResponse struct {
-	ID       string  `json:"id"`
-	Amount   float64 `json:"amount"`
-	Currency string  `json:"currency"`
+// maxRefundRetries bounds how often a failed refund is sent to the gateway again
+const maxRefundRetries = 5
+
+// PaymentService takes payments for orders through the registered payment gateways.
+// Every checkout session is recorded as a payment attempt on the order.
+type PaymentService interface {
+	GetGateways() []models.PaymentGatewayInfo
+	CreatePayment(gateway models.PaymentMethod, actor models.OrderActor, req *models.CreatePaymentRequest) (*models.PaymentSession, error)
+	CreatePaymentLink(gateway models.PaymentMethod, actor models.OrderActor, req *models.CreatePaymentRequest) (*models.PaymentSession, error)
+	VerifyPayment(gateway models.PaymentMethod, orderID string, actor models.OrderActor, params map[string]string) (*models.PaymentAttempt, error)
+	GetPaymentStatus(gateway models.PaymentMethod, orderID string, actor models.OrderActor) (*models.PaymentAttempt, error)
+	HandleWebhook(gateway models.PaymentMethod, payload []byte, headers http.Header) error
+	GetPaymentAttempts(orderID string, actor models.OrderActor) ([]models.PaymentAttempt, error)
+	CloseOpenAttempts(order *models.Order, reason string) error
+	RefundPayment(order *models.Order, amount float64, reason string) (*models.PaymentRefund, error)
+	RetryFailedRefunds() error
+	ListWebhookEvents(filter models.WebhookEventFilter) ([]models.WebhookEvent, int64, error)
+	GetWebhookEvent(id string) (*models.WebhookEvent, error)
+	ReplayWebhookEvent(id string) (*models.WebhookEvent, error)
+	ReconcilePayments() (*models.ReconciliationReport, error)
+	ListReconciliationReports(page, limit int) ([]models.ReconciliationReport, int64, error)
+	GetReconciliationReport(id string) (*models.ReconciliationReport, error)
+	ReconciliationReportCSV(report *models.ReconciliationReport) ([]byte, error)
 }
 
 type paymentService struct {
-	orderRepo repository.OrderRepository
-	config    config.RazorpayConfig
+	orderRepo      repository.OrderRepository
+	attemptRepo    repository.PaymentAttemptRepository
+	gateways       *PaymentGatewayRegistry
+	webhookRepo    repository.WebhookEventRepository
+	reportRepo     repository.ReconciliationReportRepository
+	orderService   OrderService
+	loyaltyService *LoyaltyService
+	invoiceService InvoiceService
 }
 
-func NewPaymentService(orderRepo repository.OrderRepository, config config.RazorpayConfig) PaymentService {
+func NewPaymentService(orderRepo repository.OrderRepository, attemptRepo repository.PaymentAttemptRepository, gateways *PaymentGatewayRegistry) PaymentService {
 	return &paymentService{
-		orderRepo: orderRepo,
-		config:    config,
+		orderRepo:   orderRepo,
+		attemptRepo: attemptRepo,
+		gateways:    gateways,
+	}
+}
+
+// SetOrderService sets the order service used to confirm orders once payment is captured
+func (s *paymentService) SetOrderService(orderService OrderService) {
+	s.orderService = orderService
+}
+
+// SetWebhookEventRepository sets the store that records every webhook delivery.
+// Without it webhooks are processed as they arrive with no de-duplication.
+func (s *paymentService) SetWebhookEventRepository(webhookRepo repository.WebhookEventRepository) {
+	s.webhookRepo = webhookRepo
+}
+
+// SetLoyaltyService sets the loyalty service used to reverse purchase credits on refunds
+func (s *paymentService) SetLoyaltyService(loyaltyService *LoyaltyService) {
+	s.loyaltyService = loyaltyService
+}
+
+// SetInvoiceService sets the invoice service that issues credit notes for refunds
+func (s *paymentService) SetInvoiceService(invoiceService InvoiceService) {
+	s.invoiceService = invoiceService
+}
+
+func (s *paymentService) GetGateways() []models.PaymentGatewayInfo {
+	return s.gateways.List()
+}
+
+// CreatePayment opens a checkout session at the gateway for the order total. The
+// amount sent by the client must match the server total. An open attempt at the
+// same gateway is resumed instead of creating a new one.
+func (s *paymentService) CreatePayment(gateway models.PaymentMethod, actor models.OrderActor, req *models.CreatePaymentRequest) (*models.PaymentSession, error) {
+	return s.startAttempt(gateway, actor, req, false)
+}
+
+// CreatePaymentLink creates a hosted payment link for the order total
+func (s *paymentService) CreatePaymentLink(gateway models.PaymentMethod, actor models.OrderActor, req *models.CreatePaymentRequest) (*models.PaymentSession, error) {
+	return s.startAttempt(gateway, actor, req, true)
+}
+
+// VerifyPayment verifies the result the client received from the gateway checkout
+// against the order's latest attempt and settles the order
+func (s *paymentService) VerifyPayment(gateway models.PaymentMethod, orderID string, actor models.OrderActor, params map[string]string) (*models.PaymentAttempt, error) {
+	gw, err := s.gateways.Get(gateway)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	order, err := s.getOwnedOrder(ctx, orderID, actor)
+	if err != nil {
+		return nil, err
+	}
+
+	attempt, err := s.attemptRepo.GetLatestByOrder(ctx, order.ID, gateway)
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := gw.VerifyPayment(ctx, attempt, params)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.settle(ctx, order, attempt, status); err != nil {
+		return nil, err
+	}
+
+	return attempt, nil
+}
+
+// GetPaymentStatus refreshes the order's latest attempt from the gateway and settles the order
+func (s *paymentService) GetPaymentStatus(gateway models.PaymentMethod, orderID string, actor models.OrderActor) (*models.PaymentAttempt, error) {
+	gw, err := s.gateways.Get(gateway)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	order, err := s.getOwnedOrder(ctx, orderID, actor)
+	if err != nil {
+		return nil, err
+	}
+
+	attempt, err := s.attemptRepo.GetLatestByOrder(ctx, order.ID, gateway)
+	if err != nil {
+		return nil, err
+	}
+	if !attempt.IsOpen() {
+		return attempt, nil
+	}
+
+	status, err := gw.GetPaymentStatus(ctx, attempt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.settle(ctx, order, attempt, status); err != nil {
+		return nil, err
+	}
+
+	return attempt, nil
+}
+
+// HandleWebhook verifies a webhook delivery with the gateway and settles the
+// attempt it reports on. Every delivery is recorded first; a gateway event that
+// was already processed is acknowledged without being processed again.
+func (s *paymentService) HandleWebhook(gateway models.PaymentMethod, payload []byte, headers http.Header) error {
+	gw, err := s.gateways.Get(gateway)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	event, parseErr := gw.ParseWebhook(ctx, payload, headers)
+	if s.webhookRepo == nil {
+		if parseErr != nil {
+			return parseErr
+		}
+		return s.processWebhookEvent(ctx, gateway, event)
+	}
+
+	record := &models.WebhookEvent{
+		Gateway:    gateway,
+		Payload:    string(payload),
+		Headers:    storedWebhookHeaders(headers),
+		Status:     models.WebhookEventReceived,
+		Deliveries: 1,
+	}
+	if parseErr != nil {
+		// Unverified deliveries are kept for inspection. Only those that failed for
+		// another reason, e.g. a missing webhook secret, can be replayed later.
+		record.EventID = payloadHash(payload)
+		record.Status = models.WebhookEventFailed
+		if errors.Is(parseErr, ErrInvalidPaymentSignature) {
+			record.Status = models.WebhookEventRejected
+		}
+		record.Error = parseErr.Error()
+		if err := s.webhookRepo.Create(ctx, record); err != nil {
+			fmt.Printf("Warning: failed to record %s webhook: %v\n", gateway, err)
+		}
+		return parseErr
+	}
+
+	describeWebhookEvent(record, event, payload)
+	if err := s.webhookRepo.Create(ctx, record); err != nil {
+		if !errors.Is(err, repository.ErrDuplicateWebhookEvent) {
+			return err
+		}
+		record, err = s.webhookRepo.GetByEventID(ctx, gateway, record.EventID)
+		if err != nil {
+			return err
+		}
+		if err := s.webhookRepo.RecordDelivery(ctx, record.ID); err != nil {
+			return err
+		}
+		record.Deliveries++
+	}
+
+	return s.runWebhookEvent(ctx, record, event)
+}
+
+// ListWebhookEvents lists recorded webhook deliveries, newest first, without their payloads
+func (s *paymentService) ListWebhookEvents(filter models.WebhookEventFilter) ([]models.WebhookEvent, int64, error) {
+	if s.webhookRepo == nil {
+		return nil, 0, errors.New("webhook event store is not configured")
+	}
+	return s.webhookRepo.List(context.Background(), filter)
+}
+
+func (s *paymentService) GetWebhookEvent(id string) (*models.WebhookEvent, error) {
+	if s.webhookRepo == nil {
+		return nil, errors.New("webhook event store is not configured")
+	}
+
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.New("invalid webhook event ID")
+	}
+
+	return s.webhookRepo.GetByID(context.Background(), objID)
+}
+
+// ReplayWebhookEvent verifies a failed event's stored payload again and processes it
+func (s *paymentService) ReplayWebhookEvent(id string) (*models.WebhookEvent, error) {
+	record, err := s.GetWebhookEvent(id)
+	if err != nil {
+		return nil, err
+	}
+	if record.Status != models.WebhookEventFailed {
+		return nil, ErrWebhookEventNotReplayable
+	}
+
+	gw, err := s.gateways.Get(record.Gateway)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	headers := make(http.Header, len(record.Headers))
+	for key, value := range record.Headers {
+		headers.Set(key, value)
+	}
+	payload := []byte(record.Payload)
+
+	event, err := gw.ParseWebhook(ctx, payload, headers)
+	if err != nil {
+		record.Error = err.Error()
+		if errors.Is(err, ErrInvalidPaymentSignature) {
+			record.Status = models.WebhookEventRejected
+		}
+		if updateErr := s.webhookRepo.Update(ctx, record); updateErr != nil {
+			return nil, updateErr
+		}
+		return record, err
+	}
+
+	if !record.SignatureValid {
+		describeWebhookEvent(record, event, payload)
+		if err := s.webhookRepo.Update(ctx, record); err != nil {
+			if errors.Is(err, repository.ErrDuplicateWebhookEvent) {
+				return nil, fmt.Errorf("%w: event %s was delivered again since", ErrWebhookEventNotReplayable, record.EventID)
+			}
+			return nil, err
+		}
+	}
+
+	err = s.runWebhookEvent(ctx, record, event)
+	return record, err
+}
+
+// runWebhookEvent claims a recorded event and processes it, saving the outcome.
+// An event that is being processed or was processed already is left alone.
+func (s *paymentService) runWebhookEvent(ctx context.Context, record *models.WebhookEvent, event *GatewayWebhookEvent) error {
+	claimed, err := s.webhookRepo.Claim(ctx, record.ID)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return nil
+	}
+	record.Attempts++
+
+	processErr := s.processWebhookEvent(ctx, record.Gateway, event)
+	if processErr != nil {
+		record.Status = models.WebhookEventFailed
+		record.Error = processErr.Error()
+	} else {
+		now := time.Now()
+		record.Status = models.WebhookEventProcessed
+		record.Error = ""
+		record.ProcessedAt = &now
+	}
+
+	if err := s.webhookRepo.Update(ctx, record); err != nil {
+		fmt.Printf("Warning: failed to save %s webhook event %s: %v\n", record.Gateway, record.EventID, err)
+	}
+
+	return processErr
+}
+
+// processWebhookEvent settles the attempt or refund a verified event reports on.
+// Events that do not concern a payment are ignored.
+func (s *paymentService) processWebhookEvent(ctx context.Context, gateway models.PaymentMethod, event *GatewayWebhookEvent) error {
+	if event.Refund != nil {
+		return s.settleRefundEvent(ctx, gateway, event)
+	}
+	if event.Payment == nil {
+		return nil
+	}
+
+	attempt, err := s.findAttempt(ctx, gateway, event)
+	if err != nil {
+		return err
+	}
+
+	order, err := s.orderRepo.GetByID(ctx, attempt.OrderID)
+	if err != nil {
+		return err
+	}
+
+	return s.settle(ctx, order, attempt, event.Payment)
+}
+
+// describeWebhookEvent copies what the gateway reported onto the stored event. Gateways
+// that send no event ID are de-duplicated by the payload, which they resend unchanged.
+func describeWebhookEvent(record *models.WebhookEvent, event *GatewayWebhookEvent, payload []byte) {
+	record.SignatureValid = true
+	record.EventID = event.EventID
+	if record.EventID == "" {
+		record.EventID = payloadHash(payload)
+	}
+	record.EventType = event.Type
+	record.OrderID = event.OrderID
+	record.Error = ""
+}
+
+// storedWebhookHeaders keeps the headers a gateway may need to verify the payload on replay
+func storedWebhookHeaders(headers http.Header) map[string]string {
+	kept := make(map[string]string, len(headers))
+	for key := range headers {
+		switch http.CanonicalHeaderKey(key) {
+		case "Authorization", "Cookie":
+			continue
+		}
+		kept[http.CanonicalHeaderKey(key)] = headers.Get(key)
+	}
+	return kept
+}
+
+func payloadHash(payload []byte) string {
+	sum := sha256.Sum256(payload)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func (s *paymentService) GetPaymentAttempts(orderID string, actor models.OrderActor) ([]models.PaymentAttempt, error) {
+	ctx := context.Background()
+	order, err := s.getOwnedOrder(ctx, orderID, actor)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.attemptRepo.GetByOrder(ctx, order.ID)
+}
+
+// CloseOpenAttempts closes the order's unpaid attempts at their gateways once the
+// order can no longer be paid, and records them as failed. An attempt the gateway
+// cannot close stays payable there; a payment that still arrives for the order is
+// refunded when it is reported.
+func (s *paymentService) CloseOpenAttempts(order *models.Order, reason string) error {
+	ctx := context.Background()
+
+	attempts, err := s.attemptRepo.GetByOrder(ctx, order.ID)
+	if err != nil {
+		return err
+	}
+
+	for i := range attempts {
+		attempt := &attempts[i]
+		// A pending attempt has been paid and is waiting on the gateway
+		if attempt.Status != models.PaymentAttemptCreated {
+			continue
+		}
+
+		gw, err := s.gateways.Get(attempt.Gateway)
+		if err == nil {
+			err = gw.CancelPayment(ctx, attempt)
+		}
+		if err != nil && !errors.Is(err, ErrGatewayOperationUnsupported) {
+			fmt.Printf("Warning: failed to close %s attempt %s for order %s: %v\n", attempt.Gateway, attempt.ID.Hex(), order.OrderNumber, err)
+			continue
+		}
+
+		attempt.Status = models.PaymentAttemptFailed
+		attempt.FailureReason = reason
+		if err := s.attemptRepo.Update(ctx, attempt); err != nil {
+			fmt.Printf("Warning: failed to close attempt %s for order %s: %v\n", attempt.ID.Hex(), order.OrderNumber, err)
+		}
+	}
+
+	return nil
+}
+
+// RefundPayment refunds part or all of an order's payment through the gateway
+// that took it and records the refund on the order; the caller saves the order.
+// An amount of zero refunds whatever is left. A refund the gateway rejects is
+// recorded as failed and retried by RetryFailedRefunds. Orders paid before
+// payment attempts were recorded are refunded through the provider IDs saved on
+// the order. Only cash on delivery orders are recorded as refunded offline; any
+// other order with no payment to refund fails with ErrRefundNeedsManualHandling.
+// The credit note is issued once the refund is processed.
+func (s *paymentService) RefundPayment(order *models.Order, amount float64, reason string) (*models.PaymentRefund, error) {
+	refundable := order.RefundableAmount()
+	if amount == 0 {
+		amount = refundable
 	}
+	if amount <= 0 || toPaise(amount) > toPaise(refundable) {
+		return nil, fmt.Errorf("%w: %.2f of %.2f can be refunded", ErrRefundAmountInvalid, refundable, order.Total)
+	}
+
+	ctx := context.Background()
+	now := time.Now()
+	refund := models.PaymentRefund{
+		RefundID:  order.NextRefundID(),
+		Gateway:   order.PaymentMethod,
+		Amount:    amount,
+		Reason:    reason,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	attempt, err := s.paidAttempt(ctx, order.ID)
+	if err != nil {
+		return nil, err
+	}
+	if attempt == nil {
+		attempt = legacyAttempt(order)
+	}
+	if attempt == nil {
+		if order.PaymentMethod != models.PaymentMethodCOD {
+			return nil, fmt.Errorf("%w: order %s was paid by %s", ErrRefundNeedsManualHandling, order.OrderNumber, order.PaymentMethod)
+		}
+		refund.Status = models.RefundStatusProcessed
+		refund.ProcessedAt = &now
+		s.reverseCredits(ctx, order, &refund)
+		order.RecordRefund(refund)
+		s.issueCreditNote(ctx, order, &refund)
+		return &refund, nil
+	}
+
+	refund.AttemptID = attempt.ID
+	refund.Gateway = attempt.Gateway
+	s.sendRefund(ctx, order, attempt, &refund)
+	order.RecordRefund(refund)
+
+	return &refund, nil
 }
 
-func (s *paymentService) CreatePaymentOrder(orderID string, amount float64, currency string) (*PaymentOrderResponse, error) {
-	// Placeholder implementation
-	return &PaymentOrderResponse{
-		ID:       "order_" + orderID,
-		Amount:   amount,
-		Currency: currency,
-	}, nil
+// issueCreditNote documents a processed refund against the order's invoice
+func (s *paymentService) issueCreditNote(ctx context.Context, order *models.Order, refund *models.PaymentRefund) {
+	if s.invoiceService == nil {
+		return
+	}
+	if _, err := s.invoiceService.IssueCreditNote(ctx, order, refund); err != nil {
+		fmt.Printf("Warning: failed to issue credit note for refund %s of order %s: %v\n", refund.RefundID, order.OrderNumber, err)
+	}
 }
 
-func (s *paymentService) VerifyPayment(paymentID string, orderID string, signature string) error {
-	// Placeholder implementation
+// RetryFailedRefunds sends failed refunds to their gateway again under the same
+// refund ID. Refunds that keep failing are left for manual follow-up.
+func (s *paymentService) RetryFailedRefunds() error {
+	ctx := context.Background()
+
+	orders, err := s.orderRepo.GetFailedRefunds(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load failed refunds: %w", err)
+	}
+
+	for i := range orders {
+		order := &orders[i]
+		retried := false
+		for _, refund := range order.Refunds {
+			if refund.Status != models.RefundStatusFailed || refund.Retries >= maxRefundRetries {
+				continue
+			}
+
+			attempt := legacyAttempt(order)
+			if !refund.AttemptID.IsZero() {
+				var err error
+				if attempt, err = s.attemptRepo.GetByID(ctx, refund.AttemptID); err != nil {
+					fmt.Printf("Warning: failed to load payment attempt for refund %s: %v\n", refund.RefundID, err)
+					continue
+				}
+			}
+			if attempt == nil {
+				continue
+			}
+
+			refund.Retries++
+			s.sendRefund(ctx, order, attempt, &refund)
+			order.RecordRefund(refund)
+			retried = true
+		}
+
+		if retried {
+			if err := s.orderRepo.Update(ctx, order); err != nil {
+				fmt.Printf("Warning: failed to save refunds for order %s: %v\n", order.OrderNumber, err)
+			}
+		}
+	}
+
 	return nil
 }
 
-func (s *paymentService) HandleWebhook(payload []byte, signature string) error {
-	// Placeholder implementation
+// sendRefund asks the gateway to refund the attempt and applies its answer to the refund
+func (s *paymentService) sendRefund(ctx context.Context, order *models.Order, attempt *models.PaymentAttempt, refund *models.PaymentRefund) {
+	refund.UpdatedAt = time.Now()
+
+	gw, err := s.gateways.Get(attempt.Gateway)
+	if err == nil {
+		var result *GatewayRefund
+		result, err = gw.Refund(ctx, attempt, &GatewayRefundRequest{
+			RefundID: refund.RefundID,
+			Amount:   refund.Amount,
+			Reason:   refund.Reason,
+		})
+		if err == nil {
+			s.applyRefund(ctx, order, refund, result)
+			return
+		}
+	}
+
+	fmt.Printf("Warning: refund %s for order %s failed: %v\n", refund.RefundID, order.OrderNumber, err)
+	refund.Status = models.RefundStatusFailed
+	refund.FailureReason = err.Error()
+}
+
+// applyRefund copies the gateway's view of a refund onto the recorded refund.
+// A processed refund is final; it reverses the loyalty credits earned on the
+// order and gets its credit note.
+func (s *paymentService) applyRefund(ctx context.Context, order *models.Order, refund *models.PaymentRefund, result *GatewayRefund) {
+	if refund.Status == models.RefundStatusProcessed {
+		return
+	}
+
+	if result.ProviderRefundID != "" {
+		refund.ProviderRefundID = result.ProviderRefundID
+	}
+	refund.Status = result.Status
+	refund.FailureReason = result.FailureReason
+	refund.UpdatedAt = time.Now()
+	if refund.Status == models.RefundStatusProcessed {
+		processedAt := refund.UpdatedAt
+		refund.ProcessedAt = &processedAt
+		s.reverseCredits(ctx, order, refund)
+		s.issueCreditNote(ctx, order, refund)
+	}
+}
+
+// settleRefundEvent applies a refund webhook to the refund recorded on the order
+func (s *paymentService) settleRefundEvent(ctx context.Context, gateway models.PaymentMethod, event *GatewayWebhookEvent) error {
+	var orderID primitive.ObjectID
+	attempt, err := s.attemptRepo.GetByProviderOrderID(ctx, gateway, event.Refund.ProviderOrderID)
+	if err == nil {
+		orderID = attempt.OrderID
+	} else if orderID, err = primitive.ObjectIDFromHex(event.OrderID); err != nil {
+		return fmt.Errorf("no payment attempt for %s order %s", gateway, event.Refund.ProviderOrderID)
+	}
+
+	order, err := s.orderRepo.GetByID(ctx, orderID)
+	if err != nil {
+		return err
+	}
+
+	recorded, ok := order.GetRefund(event.Refund.RefundID)
+	if !ok {
+		return fmt.Errorf("no refund %s on order %s", event.Refund.RefundID, order.OrderNumber)
+	}
+	refund := *recorded
+	if refund.Status == models.RefundStatusProcessed || refund.Status == event.Refund.Status {
+		return nil
+	}
+
+	s.applyRefund(ctx, order, &refund, event.Refund)
+	order.RecordRefund(refund)
+	return s.orderRepo.Update(ctx, order)
+}
+
+// reverseCredits takes back the loyalty credits earned on the refunded part of the order
+func (s *paymentService) reverseCredits(ctx context.Context, order *models.Order, refund *models.PaymentRefund) {
+	if refund.CreditsReversed || order.UserID.IsZero() || s.loyaltyService == nil {
+		return
+	}
+
+	if err := s.loyaltyService.ReversePurchaseCredits(ctx, order.UserID, order.ID, refund.Amount, order.Total); err != nil {
+		fmt.Printf("Warning: failed to reverse loyalty credits for refund %s: %v\n", refund.RefundID, err)
+		return
+	}
+	refund.CreditsReversed = true
+}
+
+// paidAttempt returns the paid online attempt of an order, or nil if it was not paid online
+func (s *paymentService) paidAttempt(ctx context.Context, orderID primitive.ObjectID) (*models.PaymentAttempt, error) {
+	attempts, err := s.attemptRepo.GetByOrder(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range attempts {
+		if attempts[i].Status == models.PaymentAttemptPaid && attempts[i].Gateway != models.PaymentMethodCOD {
+			return &attempts[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// legacyAttempt rebuilds the paid attempt of an order paid online before payment
+// attempts were recorded, from the provider IDs saved on the order. It returns
+// nil when the order holds no payment a gateway can refund.
+func legacyAttempt(order *models.Order) *models.PaymentAttempt {
+	attempt := &models.PaymentAttempt{
+		OrderID:     order.ID,
+		OrderNumber: order.OrderNumber,
+		Status:      models.PaymentAttemptPaid,
+		Amount:      order.Total,
+	}
+
+	switch {
+	case order.RazorpayPaymentID != nil && *order.RazorpayPaymentID != "":
+		attempt.Gateway = models.PaymentMethodRazorpay
+		attempt.ProviderPaymentID = *order.RazorpayPaymentID
+		if order.RazorpayOrderID != nil {
+			attempt.ProviderOrderID = *order.RazorpayOrderID
+		}
+	case order.PaymentMethod == models.PaymentMethodCashfree && order.PaymentProviderOrderID != nil && *order.PaymentProviderOrderID != "":
+		attempt.Gateway = models.PaymentMethodCashfree
+		attempt.ProviderOrderID = *order.PaymentProviderOrderID
+	default:
+		return nil
+	}
+	return attempt
+}
+
+// startAttempt checks the order can be paid and opens a checkout or payment link at the gateway
+func (s *paymentService) startAttempt(gateway models.PaymentMethod, actor models.OrderActor, req *models.CreatePaymentRequest, link bool) (*models.PaymentSession, error) {
+	gw, err := s.gateways.Get(gateway)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	order, err := s.getOwnedOrder(ctx, req.OrderID, actor)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkPayable(order, gateway, req.Amount); err != nil {
+		return nil, err
+	}
+
+	currency := req.Currency
+	if currency == "" {
+		currency = "INR"
+	}
+
+	if !link {
+		latest, err := s.attemptRepo.GetLatestByOrder(ctx, order.ID, gateway)
+		if err == nil && latest.IsOpen() && latest.LinkURL == "" &&
+			toPaise(latest.Amount) == toPaise(order.Total) && latest.Currency == currency &&
+			time.Since(latest.CreatedAt) < stockReservationTTL {
+			return s.session(latest), nil
+		}
+	}
+
+	attempt := &models.PaymentAttempt{
+		ID:          primitive.NewObjectID(),
+		OrderID:     order.ID,
+		OrderNumber: order.OrderNumber,
+		Gateway:     gateway,
+		Status:      models.PaymentAttemptCreated,
+		Amount:      order.Total,
+		Currency:    currency,
+	}
+
+	gatewayReq := &GatewayPaymentRequest{
+		Order:         order,
+		Reference:     attempt.ID.Hex(),
+		Amount:        order.Total,
+		Currency:      currency,
+		CustomerID:    customerID(order),
+		CustomerName:  req.CustomerName,
+		CustomerPhone: req.CustomerPhone,
+		CustomerEmail: req.CustomerEmail,
+		ReturnURL:     req.ReturnURL,
+		NotifyURL:     req.NotifyURL,
+		Purpose:       req.Purpose,
+	}
+	if gatewayReq.Purpose == "" {
+		gatewayReq.Purpose = "Payment for Thyne Jewels order " + order.OrderNumber
+	}
+
+	var payment *GatewayPayment
+	if link {
+		expiresAt := time.Now().Add(24 * time.Hour)
+		gatewayReq.ExpiresAt = &expiresAt
+		payment, err = gw.CreatePaymentLink(ctx, gatewayReq)
+	} else {
+		payment, err = gw.CreatePayment(ctx, gatewayReq)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	attempt.ProviderOrderID = payment.ProviderOrderID
+	attempt.SessionID = payment.SessionID
+	attempt.LinkURL = payment.LinkURL
+	attempt.Checkout = payment.Checkout
+	if err := s.attemptRepo.Create(ctx, attempt); err != nil {
+		return nil, err
+	}
+
+	if attempt.ProviderOrderID != "" {
+		order.PaymentProviderOrderID = &attempt.ProviderOrderID
+	}
+	if attempt.SessionID != "" {
+		order.PaymentSessionID = &attempt.SessionID
+	}
+	order.UpdatedAt = time.Now()
+	if err := s.orderRepo.Update(ctx, order); err != nil {
+		fmt.Printf("Warning: failed to save payment reference on order %s: %v\n", order.OrderNumber, err)
+	}
+
+	return s.session(attempt), nil
+}
+
+// checkPayable rejects payments for orders that are settled, cancelled or priced differently
+func (s *paymentService) checkPayable(order *models.Order, gateway models.PaymentMethod, amount float64) error {
+	if order.PaymentStatus == models.PaymentStatusPaid {
+		return errors.New("order is already paid")
+	}
+	if order.Status == models.OrderStatusCancelled {
+		return errors.New("order is cancelled")
+	}
+	if (order.PaymentMethod == models.PaymentMethodCOD) != (gateway == models.PaymentMethodCOD) {
+		return errors.New("cash on delivery can only be chosen at checkout")
+	}
+	if math.Abs(amount-order.Total) > priceTolerance {
+		return fmt.Errorf("%w: order total is %.2f", ErrPaymentAmountMismatch, order.Total)
+	}
 	return nil
 }
+
+// settle applies the gateway's view of an attempt to the attempt and its order.
+// A paid attempt completes the order once; a failed attempt leaves the order open for retry.
+func (s *paymentService) settle(ctx context.Context, order *models.Order, attempt *models.PaymentAttempt, status *GatewayPaymentStatus) error {
+	switch status.Status {
+	case models.PaymentAttemptPaid:
+		if toPaise(status.Amount) != toPaise(attempt.Amount) {
+			return fmt.Errorf("%w: %s payment %s is %.2f", ErrPaymentAmountMismatch, attempt.Gateway, status.ProviderPaymentID, status.Amount)
+		}
+
+		if attempt.Status != models.PaymentAttemptPaid {
+			now := time.Now()
+			attempt.Status = models.PaymentAttemptPaid
+			attempt.ProviderPaymentID = status.ProviderPaymentID
+			attempt.FailureReason = ""
+			attempt.PaidAt = &now
+			if err := s.attemptRepo.Update(ctx, attempt); err != nil {
+				return err
+			}
+		}
+
+		if order.PaymentStatus == models.PaymentStatusPaid {
+			if order.PaymentProviderOrderID == nil || *order.PaymentProviderOrderID != attempt.ProviderOrderID {
+				fmt.Printf("Warning: order %s was paid again through %s attempt %s\n", order.OrderNumber, attempt.Gateway, attempt.ID.Hex())
+			}
+			return nil
+		}
+		if toPaise(attempt.Amount) != toPaise(order.Total) {
+			return fmt.Errorf("%w: attempt %s is %.2f, order total is %.2f", ErrPaymentAmountMismatch, attempt.ID.Hex(), attempt.Amount, order.Total)
+		}
+
+		order.PaymentMethod = attempt.Gateway
+		order.PaymentProviderOrderID = &attempt.ProviderOrderID
+		order.UpdatedAt = time.Now()
+		if err := s.orderRepo.Update(ctx, order); err != nil {
+			return fmt.Errorf("failed to record payment: %w", err)
+		}
+
+		if s.orderService == nil {
+			return errors.New("order service is not configured")
+		}
+		return s.orderService.CompleteOrder(order.ID.Hex())
+
+	case models.PaymentAttemptFailed:
+		if attempt.Status == models.PaymentAttemptPaid {
+			return nil
+		}
+		attempt.Status = models.PaymentAttemptFailed
+		attempt.FailureReason = status.FailureReason
+		if err := s.attemptRepo.Update(ctx, attempt); err != nil {
+			return err
+		}
+
+		if order.PaymentStatus != models.PaymentStatusPending {
+			return nil
+		}
+		order.MarkAsFailed()
+		return s.orderRepo.Update(ctx, order)
+
+	case models.PaymentAttemptPending:
+		if attempt.Status != models.PaymentAttemptCreated {
+			return nil
+		}
+		attempt.Status = models.PaymentAttemptPending
+		return s.attemptRepo.Update(ctx, attempt)
+	}
+
+	return nil
+}
+
+// findAttempt matches a webhook to an attempt by the provider's order ID, falling
+// back to the latest attempt for the order the provider echoed back
+func (s *paymentService) findAttempt(ctx context.Context, gateway models.PaymentMethod, event *GatewayWebhookEvent) (*models.PaymentAttempt, error) {
+	attempt, err := s.attemptRepo.GetByProviderOrderID(ctx, gateway, event.Payment.ProviderOrderID)
+	if err == nil {
+		return attempt, nil
+	}
+	if event.OrderID == "" {
+		return nil, fmt.Errorf("no payment attempt for %s order %s", gateway, event.Payment.ProviderOrderID)
+	}
+
+	orderID, err := primitive.ObjectIDFromHex(event.OrderID)
+	if err != nil {
+		return nil, errors.New("invalid order ID")
+	}
+	return s.attemptRepo.GetLatestByOrder(ctx, orderID, gateway)
+}
+
+func (s *paymentService) getOrder(ctx context.Context, orderID string) (*models.Order, error) {
+	objID, err := primitive.ObjectIDFromHex(orderID)
+	if err != nil {
+		return nil, errors.New("invalid order ID")
+	}
+	return s.orderRepo.GetByID(ctx, objID)
+}
+
+// getOwnedOrder loads an order for the customer paying it. Orders of other
+// customers are reported as not found.
+func (s *paymentService) getOwnedOrder(ctx context.Context, orderID string, actor models.OrderActor) (*models.Order, error) {
+	order, err := s.getOrder(ctx, orderID)
+	if err != nil || !order.IsOwnedBy(actor) {
+		return nil, ErrOrderNotFound
+	}
+	return order, nil
+}
+
+// customerID identifies a signed-in customer to the gateway; guests have none
+func customerID(order *models.Order) string {
+	if order.UserID.IsZero() {
+		return ""
+	}
+	return order.UserID.Hex()
+}
+
+func (s *paymentService) session(attempt *models.PaymentAttempt) *models.PaymentSession {
+	return &models.PaymentSession{
+		AttemptID:       attempt.ID,
+		Gateway:         attempt.Gateway,
+		OrderID:         attempt.OrderID,
+		OrderNumber:     attempt.OrderNumber,
+		Amount:          attempt.Amount,
+		Currency:        attempt.Currency,
+		ProviderOrderID: attempt.ProviderOrderID,
+		SessionID:       attempt.SessionID,
+		LinkURL:         attempt.LinkURL,
+		Checkout:        attempt.Checkout,
+	}
+}
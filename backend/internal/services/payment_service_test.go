@@ -0,0 +1,1093 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"thyne-jewels-backend/internal/config"
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/razorpayfake"
+	"thyne-jewels-backend/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memoryOrderRepository keeps orders in memory. Methods the payment flow does not use panic.
+type memoryOrderRepository struct {
+	repository.OrderRepository
+	orders map[primitive.ObjectID]models.Order
+}
+
+func (r *memoryOrderRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.Order, error) {
+	order, ok := r.orders[id]
+	if !ok {
+		return nil, errors.New("order not found")
+	}
+	return &order, nil
+}
+
+func (r *memoryOrderRepository) Update(ctx context.Context, order *models.Order) error {
+	r.orders[order.ID] = *order
+	return nil
+}
+
+func (r *memoryOrderRepository) GetFailedRefunds(ctx context.Context) ([]models.Order, error) {
+	var orders []models.Order
+	for _, order := range r.orders {
+		for _, refund := range order.Refunds {
+			if refund.Status == models.RefundStatusFailed {
+				orders = append(orders, order)
+				break
+			}
+		}
+	}
+	return orders, nil
+}
+
+func (r *memoryOrderRepository) GetUnsettledPayments(ctx context.Context, since time.Time) ([]models.Order, error) {
+	var orders []models.Order
+	for _, order := range r.orders {
+		if order.PaymentStatus != models.PaymentStatusPaid && order.PaymentStatus != models.PaymentStatusRefunded &&
+			order.PaymentProviderOrderID != nil && !order.CreatedAt.Before(since) {
+			orders = append(orders, order)
+		}
+	}
+	return orders, nil
+}
+
+func (r *memoryOrderRepository) GetExpiredReservations(ctx context.Context, before time.Time) ([]models.Order, error) {
+	var orders []models.Order
+	for _, order := range r.orders {
+		if order.StockStatus == models.StockReservationReserved && order.PaymentStatus == models.PaymentStatusPending &&
+			order.StockReservedUntil != nil && !order.StockReservedUntil.After(before) {
+			orders = append(orders, order)
+		}
+	}
+	return orders, nil
+}
+
+// memoryPaymentAttemptRepository keeps payment attempts in memory
+type memoryPaymentAttemptRepository struct {
+	attempts []models.PaymentAttempt
+}
+
+func (r *memoryPaymentAttemptRepository) Create(ctx context.Context, attempt *models.PaymentAttempt) error {
+	attempt.CreatedAt = time.Now()
+	attempt.UpdatedAt = attempt.CreatedAt
+	r.attempts = append(r.attempts, *attempt)
+	return nil
+}
+
+func (r *memoryPaymentAttemptRepository) Update(ctx context.Context, attempt *models.PaymentAttempt) error {
+	for i := range r.attempts {
+		if r.attempts[i].ID == attempt.ID {
+			r.attempts[i] = *attempt
+			return nil
+		}
+	}
+	return errors.New("payment attempt not found")
+}
+
+func (r *memoryPaymentAttemptRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.PaymentAttempt, error) {
+	return r.find(func(a *models.PaymentAttempt) bool { return a.ID == id })
+}
+
+func (r *memoryPaymentAttemptRepository) GetByOrder(ctx context.Context, orderID primitive.ObjectID) ([]models.PaymentAttempt, error) {
+	var attempts []models.PaymentAttempt
+	for i := len(r.attempts) - 1; i >= 0; i-- {
+		if r.attempts[i].OrderID == orderID {
+			attempts = append(attempts, r.attempts[i])
+		}
+	}
+	return attempts, nil
+}
+
+func (r *memoryPaymentAttemptRepository) GetLatestByOrder(ctx context.Context, orderID primitive.ObjectID, gateway models.PaymentMethod) (*models.PaymentAttempt, error) {
+	return r.find(func(a *models.PaymentAttempt) bool { return a.OrderID == orderID && a.Gateway == gateway })
+}
+
+func (r *memoryPaymentAttemptRepository) GetByProviderOrderID(ctx context.Context, gateway models.PaymentMethod, providerOrderID string) (*models.PaymentAttempt, error) {
+	return r.find(func(a *models.PaymentAttempt) bool {
+		return a.Gateway == gateway && a.ProviderOrderID == providerOrderID
+	})
+}
+
+// find returns the newest attempt matching the predicate
+func (r *memoryPaymentAttemptRepository) find(match func(*models.PaymentAttempt) bool) (*models.PaymentAttempt, error) {
+	for i := len(r.attempts) - 1; i >= 0; i-- {
+		if match(&r.attempts[i]) {
+			attempt := r.attempts[i]
+			return &attempt, nil
+		}
+	}
+	return nil, errors.New("payment attempt not found")
+}
+
+// memoryLoyaltyRepository keeps one loyalty program and its transactions in memory
+type memoryLoyaltyRepository struct {
+	repository.LoyaltyRepository
+	program      models.LoyaltyProgram
+	transactions []models.PointTransaction
+}
+
+func (r *memoryLoyaltyRepository) GetProgramByUserID(ctx context.Context, userID primitive.ObjectID) (*models.LoyaltyProgram, error) {
+	program := r.program
+	return &program, nil
+}
+
+func (r *memoryLoyaltyRepository) UpdateProgram(ctx context.Context, program *models.LoyaltyProgram) error {
+	r.program = *program
+	return nil
+}
+
+func (r *memoryLoyaltyRepository) AddTransaction(ctx context.Context, transaction *models.PointTransaction) error {
+	r.transactions = append(r.transactions, *transaction)
+	return nil
+}
+
+func (r *memoryLoyaltyRepository) GetTransactionsByOrder(ctx context.Context, userID, orderID primitive.ObjectID) ([]models.PointTransaction, error) {
+	var transactions []models.PointTransaction
+	for _, transaction := range r.transactions {
+		if transaction.UserID == userID && transaction.OrderID != nil && *transaction.OrderID == orderID {
+			transactions = append(transactions, transaction)
+		}
+	}
+	return transactions, nil
+}
+
+// memoryWebhookEventRepository keeps webhook events in memory
+type memoryWebhookEventRepository struct {
+	events []models.WebhookEvent
+}
+
+func (r *memoryWebhookEventRepository) Create(ctx context.Context, event *models.WebhookEvent) error {
+	if event.SignatureValid {
+		if _, err := r.GetByEventID(ctx, event.Gateway, event.EventID); err == nil {
+			return repository.ErrDuplicateWebhookEvent
+		}
+	}
+	event.ID = primitive.NewObjectID()
+	event.ReceivedAt = time.Now()
+	r.events = append(r.events, *event)
+	return nil
+}
+
+func (r *memoryWebhookEventRepository) Update(ctx context.Context, event *models.WebhookEvent) error {
+	stored, err := r.get(event.ID)
+	if err != nil {
+		return err
+	}
+	deliveries, attempts := stored.Deliveries, stored.Attempts
+	*stored = *event
+	stored.Deliveries, stored.Attempts = deliveries, attempts
+	return nil
+}
+
+func (r *memoryWebhookEventRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.WebhookEvent, error) {
+	stored, err := r.get(id)
+	if err != nil {
+		return nil, err
+	}
+	event := *stored
+	return &event, nil
+}
+
+func (r *memoryWebhookEventRepository) GetByEventID(ctx context.Context, gateway models.PaymentMethod, eventID string) (*models.WebhookEvent, error) {
+	for _, event := range r.events {
+		if event.SignatureValid && event.Gateway == gateway && event.EventID == eventID {
+			return &event, nil
+		}
+	}
+	return nil, errors.New("webhook event not found")
+}
+
+func (r *memoryWebhookEventRepository) Claim(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	stored, err := r.get(id)
+	if err != nil {
+		return false, err
+	}
+	if stored.Status != models.WebhookEventReceived && stored.Status != models.WebhookEventFailed {
+		return false, nil
+	}
+	stored.Status = models.WebhookEventProcessing
+	stored.Attempts++
+	return true, nil
+}
+
+func (r *memoryWebhookEventRepository) RecordDelivery(ctx context.Context, id primitive.ObjectID) error {
+	stored, err := r.get(id)
+	if err != nil {
+		return err
+	}
+	stored.Deliveries++
+	return nil
+}
+
+func (r *memoryWebhookEventRepository) List(ctx context.Context, filter models.WebhookEventFilter) ([]models.WebhookEvent, int64, error) {
+	var events []models.WebhookEvent
+	for _, event := range r.events {
+		if filter.Status == nil || event.Status == *filter.Status {
+			events = append(events, event)
+		}
+	}
+	return events, int64(len(events)), nil
+}
+
+func (r *memoryWebhookEventRepository) get(id primitive.ObjectID) (*models.WebhookEvent, error) {
+	for i := range r.events {
+		if r.events[i].ID == id {
+			return &r.events[i], nil
+		}
+	}
+	return nil, errors.New("webhook event not found")
+}
+
+// memoryReconciliationReportRepository keeps reconciliation reports in memory
+type memoryReconciliationReportRepository struct {
+	repository.ReconciliationReportRepository
+	reports []models.ReconciliationReport
+}
+
+func (r *memoryReconciliationReportRepository) Create(ctx context.Context, report *models.ReconciliationReport) error {
+	report.ID = primitive.NewObjectID()
+	r.reports = append(r.reports, *report)
+	return nil
+}
+
+// completingOrderService records CompleteOrder calls and marks the order paid
+type completingOrderService struct {
+	OrderService
+	repo      *memoryOrderRepository
+	completed int
+}
+
+func (s *completingOrderService) CompleteOrder(orderID string) error {
+	order, err := s.repo.getHex(orderID)
+	if err != nil {
+		return err
+	}
+	s.completed++
+	order.PaymentStatus = models.PaymentStatusPaid
+	order.Status = models.OrderStatusConfirmed
+	return s.repo.Update(context.Background(), order)
+}
+
+func (r *memoryOrderRepository) getHex(orderID string) (*models.Order, error) {
+	id, err := primitive.ObjectIDFromHex(orderID)
+	if err != nil {
+		return nil, err
+	}
+	return r.GetByID(context.Background(), id)
+}
+
+// buyer is the guest who placed the test order
+var buyer = models.OrderActor{Type: models.OrderActorCustomer, ID: "guest-1"}
+
+func newTestPaymentService(t *testing.T) (*paymentService, *razorpayfake.Server, *memoryOrderRepository, *completingOrderService, *models.Order) {
+	t.Helper()
+
+	fake := razorpayfake.NewServer("rzp_test_key", "test_secret", "webhook_secret")
+	t.Cleanup(fake.Close)
+
+	order := models.Order{
+		ID:             primitive.NewObjectID(),
+		OrderNumber:    "TJ-1001",
+		GuestSessionID: buyer.ID,
+		PaymentMethod:  models.PaymentMethodRazorpay,
+		PaymentStatus:  models.PaymentStatusPending,
+		Status:         models.OrderStatusPending,
+		Total:          12499.50,
+		CreatedAt:      time.Now(),
+	}
+	repo := &memoryOrderRepository{orders: map[primitive.ObjectID]models.Order{order.ID: order}}
+	orders := &completingOrderService{repo: repo}
+
+	gateways := NewPaymentGatewayRegistry(NewRazorpayGateway(config.RazorpayConfig{
+		KeyID:         fake.KeyID,
+		KeySecret:     fake.KeySecret,
+		WebhookSecret: fake.WebhookSecret,
+		BaseURL:       fake.BaseURL(),
+	}))
+	svc := NewPaymentService(repo, &memoryPaymentAttemptRepository{}, gateways).(*paymentService)
+	svc.SetOrderService(orders)
+
+	return svc, fake, repo, orders, &order
+}
+
+func createRequest(order *models.Order, amount float64) *models.CreatePaymentRequest {
+	return &models.CreatePaymentRequest{OrderID: order.ID.Hex(), Amount: amount, Currency: "INR"}
+}
+
+// tamper changes the first character of a hex signature
+func tamper(signature string) string {
+	if signature[0] == '0' {
+		return "1" + signature[1:]
+	}
+	return "0" + signature[1:]
+}
+
+func webhookHeaders(signature string) http.Header {
+	headers := http.Header{}
+	headers.Set("X-Razorpay-Signature", signature)
+	return headers
+}
+
+func TestPaymentFlowVerifyThenWebhook(t *testing.T) {
+	svc, fake, repo, orders, order := newTestPaymentService(t)
+	razorpay := models.PaymentMethodRazorpay
+
+	if _, err := svc.CreatePayment(razorpay, buyer, createRequest(order, 100)); !errors.Is(err, ErrPaymentAmountMismatch) {
+		t.Fatalf("expected amount mismatch, got %v", err)
+	}
+	// Another customer cannot pay for, verify or look into the order
+	stranger := models.OrderActor{Type: models.OrderActorCustomer, ID: "guest-2"}
+	if _, err := svc.CreatePayment(razorpay, stranger, createRequest(order, order.Total)); !errors.Is(err, ErrOrderNotFound) {
+		t.Fatalf("expected another customer's payment to be refused, got %v", err)
+	}
+	if _, err := svc.CreatePaymentLink(razorpay, models.OrderActor{Type: models.OrderActorCustomer}, createRequest(order, order.Total)); !errors.Is(err, ErrOrderNotFound) {
+		t.Fatalf("expected an anonymous payment link to be refused, got %v", err)
+	}
+
+	session, err := svc.CreatePayment(razorpay, buyer, createRequest(order, order.Total))
+	if err != nil {
+		t.Fatalf("create payment: %v", err)
+	}
+	rzpOrder, ok := fake.Order(session.ProviderOrderID)
+	if !ok || rzpOrder.Amount != 1249950 || rzpOrder.Receipt != order.OrderNumber {
+		t.Fatalf("unexpected razorpay order %+v", rzpOrder)
+	}
+	if session.Checkout["keyId"] != fake.KeyID {
+		t.Fatalf("expected checkout options to carry the key ID, got %v", session.Checkout)
+	}
+
+	again, err := svc.CreatePayment(razorpay, buyer, createRequest(order, order.Total))
+	if err != nil || again.AttemptID != session.AttemptID {
+		t.Fatalf("expected open attempt to be resumed, got %v (%v)", again, err)
+	}
+
+	payment, signature, err := fake.Pay(session.ProviderOrderID)
+	if err != nil {
+		t.Fatalf("pay: %v", err)
+	}
+
+	params := map[string]string{
+		"razorpayOrderId":   session.ProviderOrderID,
+		"razorpayPaymentId": payment.ID,
+		"razorpaySignature": tamper(signature),
+	}
+	if _, err := svc.VerifyPayment(razorpay, order.ID.Hex(), buyer, params); !errors.Is(err, ErrInvalidPaymentSignature) {
+		t.Fatalf("expected invalid signature, got %v", err)
+	}
+	params["razorpaySignature"] = signature
+	if _, err := svc.VerifyPayment(razorpay, order.ID.Hex(), stranger, params); !errors.Is(err, ErrOrderNotFound) {
+		t.Fatalf("expected another customer's verification to be refused, got %v", err)
+	}
+	if _, err := svc.GetPaymentAttempts(order.ID.Hex(), stranger); !errors.Is(err, ErrOrderNotFound) {
+		t.Fatalf("expected another customer's attempts to be hidden, got %v", err)
+	}
+	if _, err := svc.GetPaymentStatus(razorpay, order.ID.Hex(), stranger); !errors.Is(err, ErrOrderNotFound) {
+		t.Fatalf("expected another customer's payment status to be hidden, got %v", err)
+	}
+	attempt, err := svc.VerifyPayment(razorpay, order.ID.Hex(), buyer, params)
+	if err != nil {
+		t.Fatalf("verify payment: %v", err)
+	}
+	if attempt.Status != models.PaymentAttemptPaid || attempt.ProviderPaymentID != payment.ID {
+		t.Fatalf("attempt not marked paid: %+v", attempt)
+	}
+
+	body, webhookSignature, err := fake.Webhook("payment.captured", payment.ID)
+	if err != nil {
+		t.Fatalf("webhook: %v", err)
+	}
+	if err := svc.HandleWebhook(razorpay, body, webhookHeaders(webhookSignature)); err != nil {
+		t.Fatalf("handle webhook: %v", err)
+	}
+
+	stored := repo.orders[order.ID]
+	if stored.PaymentStatus != models.PaymentStatusPaid || stored.PaymentProviderOrderID == nil || *stored.PaymentProviderOrderID != session.ProviderOrderID {
+		t.Fatalf("order not marked paid: %+v", stored)
+	}
+	if orders.completed != 1 {
+		t.Fatalf("expected order to be completed once, got %d", orders.completed)
+	}
+}
+
+func TestPaymentFlowWebhookOnly(t *testing.T) {
+	svc, fake, repo, orders, order := newTestPaymentService(t)
+	razorpay := models.PaymentMethodRazorpay
+
+	session, err := svc.CreatePayment(razorpay, buyer, createRequest(order, order.Total))
+	if err != nil {
+		t.Fatalf("create payment: %v", err)
+	}
+
+	failed, err := fake.Fail(session.ProviderOrderID)
+	if err != nil {
+		t.Fatalf("fail: %v", err)
+	}
+	body, signature, _ := fake.Webhook("payment.failed", failed.ID)
+	if err := svc.HandleWebhook(razorpay, body, webhookHeaders(signature)); err != nil {
+		t.Fatalf("handle failed webhook: %v", err)
+	}
+	if status := repo.orders[order.ID].PaymentStatus; status != models.PaymentStatusFailed {
+		t.Fatalf("expected failed payment status, got %s", status)
+	}
+
+	payment, _, err := fake.Pay(session.ProviderOrderID)
+	if err != nil {
+		t.Fatalf("pay: %v", err)
+	}
+
+	body, signature, _ = fake.Webhook("order.paid", payment.ID)
+	if err := svc.HandleWebhook(razorpay, body, webhookHeaders(tamper(signature))); !errors.Is(err, ErrInvalidPaymentSignature) {
+		t.Fatalf("expected tampered webhook to be rejected, got %v", err)
+	}
+	if err := svc.HandleWebhook(razorpay, body, webhookHeaders(signature)); err != nil {
+		t.Fatalf("handle paid webhook: %v", err)
+	}
+
+	if orders.completed != 1 {
+		t.Fatalf("expected order to be completed once, got %d", orders.completed)
+	}
+	if status := repo.orders[order.ID].PaymentStatus; status != models.PaymentStatusPaid {
+		t.Fatalf("expected paid payment status, got %s", status)
+	}
+
+	attempts, _ := svc.GetPaymentAttempts(order.ID.Hex(), buyer)
+	if len(attempts) != 1 || attempts[0].Status != models.PaymentAttemptPaid {
+		t.Fatalf("expected a single paid attempt, got %+v", attempts)
+	}
+}
+
+func TestPaymentStatusFromGateway(t *testing.T) {
+	svc, fake, repo, orders, order := newTestPaymentService(t)
+	razorpay := models.PaymentMethodRazorpay
+
+	session, err := svc.CreatePayment(razorpay, buyer, createRequest(order, order.Total))
+	if err != nil {
+		t.Fatalf("create payment: %v", err)
+	}
+
+	attempt, err := svc.GetPaymentStatus(razorpay, order.ID.Hex(), buyer)
+	if err != nil || attempt.Status != models.PaymentAttemptCreated {
+		t.Fatalf("expected unpaid attempt, got %+v (%v)", attempt, err)
+	}
+
+	if _, _, err := fake.Pay(session.ProviderOrderID); err != nil {
+		t.Fatalf("pay: %v", err)
+	}
+
+	attempt, err = svc.GetPaymentStatus(razorpay, order.ID.Hex(), buyer)
+	if err != nil || attempt.Status != models.PaymentAttemptPaid {
+		t.Fatalf("expected paid attempt, got %+v (%v)", attempt, err)
+	}
+	if orders.completed != 1 || repo.orders[order.ID].PaymentStatus != models.PaymentStatusPaid {
+		t.Fatalf("expected order to be completed from the gateway status")
+	}
+}
+
+// payTestOrder pays the test order through the fake and returns the captured payment
+func payTestOrder(t *testing.T, svc *paymentService, fake *razorpayfake.Server, order *models.Order) razorpayfake.Payment {
+	t.Helper()
+
+	// The customer who paid may have signed in since
+	customer := buyer
+	if !order.UserID.IsZero() {
+		customer.ID = order.UserID.Hex()
+	}
+	session, err := svc.CreatePayment(models.PaymentMethodRazorpay, customer, createRequest(order, order.Total))
+	if err != nil {
+		t.Fatalf("create payment: %v", err)
+	}
+	payment, signature, err := fake.Pay(session.ProviderOrderID)
+	if err != nil {
+		t.Fatalf("pay: %v", err)
+	}
+	params := map[string]string{
+		"razorpayOrderId":   session.ProviderOrderID,
+		"razorpayPaymentId": payment.ID,
+		"razorpaySignature": signature,
+	}
+	if _, err := svc.VerifyPayment(models.PaymentMethodRazorpay, order.ID.Hex(), customer, params); err != nil {
+		t.Fatalf("verify payment: %v", err)
+	}
+	return payment
+}
+
+// withLoyalty gives the test order a customer who earned 1000 credits on it
+func withLoyalty(svc *paymentService, repo *memoryOrderRepository, order *models.Order) *memoryLoyaltyRepository {
+	userID := primitive.NewObjectID()
+	stored := repo.orders[order.ID]
+	stored.UserID = userID
+	repo.orders[order.ID] = stored
+	order.UserID = userID
+
+	loyaltyRepo := &memoryLoyaltyRepository{
+		program: models.LoyaltyProgram{UserID: userID, TotalCredits: 1000, AvailableCredits: 1000},
+		transactions: []models.PointTransaction{
+			{UserID: userID, Type: models.TransactionEarned, Credits: 1000, OrderID: &order.ID},
+		},
+	}
+	svc.SetLoyaltyService(NewLoyaltyService(loyaltyRepo, nil, nil))
+	return loyaltyRepo
+}
+
+func TestRefundPaymentPartialThenFull(t *testing.T) {
+	svc, fake, repo, _, order := newTestPaymentService(t)
+	loyalty := withLoyalty(svc, repo, order)
+	payment := payTestOrder(t, svc, fake, order)
+
+	stored := repo.orders[order.ID]
+	first, err := svc.RefundPayment(&stored, 2499.90, "Damaged clasp")
+	if err != nil {
+		t.Fatalf("partial refund: %v", err)
+	}
+	if first.RefundID != "TJ-1001-RF1" || first.Status != models.RefundStatusProcessed {
+		t.Fatalf("unexpected partial refund: %+v", first)
+	}
+	if stored.PaymentStatus != models.PaymentStatusPaid || *stored.RefundAmount != 2499.90 {
+		t.Fatalf("expected order to stay paid after a partial refund: %+v", stored)
+	}
+	if loyalty.program.AvailableCredits != 800 {
+		t.Fatalf("expected 200 credits reversed, have %d", loyalty.program.AvailableCredits)
+	}
+
+	if _, err := svc.RefundPayment(&stored, stored.Total, "Too much"); !errors.Is(err, ErrRefundAmountInvalid) {
+		t.Fatalf("expected refund beyond the total to be rejected, got %v", err)
+	}
+
+	second, err := svc.RefundPayment(&stored, 0, "Returned")
+	if err != nil {
+		t.Fatalf("full refund: %v", err)
+	}
+	if second.RefundID != "TJ-1001-RF2" || second.Amount != 9999.60 {
+		t.Fatalf("expected the remainder to be refunded, got %+v", second)
+	}
+	if stored.PaymentStatus != models.PaymentStatusRefunded || *stored.RefundStatus != string(models.RefundStatusProcessed) {
+		t.Fatalf("expected order to be refunded: %+v", stored)
+	}
+	if loyalty.program.AvailableCredits != 0 || len(loyalty.transactions) != 3 {
+		t.Fatalf("expected all credits reversed, have %d", loyalty.program.AvailableCredits)
+	}
+	if refunds := fake.Refunds(payment.ID); len(refunds) != 2 || refunds[0].Receipt == refunds[1].Receipt {
+		t.Fatalf("expected two refunds at Razorpay, got %+v", refunds)
+	}
+}
+
+func TestRefundPaymentOfLegacyOrders(t *testing.T) {
+	svc, fake, repo, _, order := newTestPaymentService(t)
+	payment := payTestOrder(t, svc, fake, order)
+
+	// Orders paid before attempts were recorded only kept the Razorpay IDs
+	svc.attemptRepo = &memoryPaymentAttemptRepository{}
+	stored := repo.orders[order.ID]
+	stored.RazorpayPaymentID = &payment.ID
+	refund, err := svc.RefundPayment(&stored, 0, "Returned")
+	if err != nil {
+		t.Fatalf("refund legacy order: %v", err)
+	}
+	if refund.Gateway != models.PaymentMethodRazorpay || refund.Status != models.RefundStatusProcessed {
+		t.Fatalf("expected the legacy payment to be refunded at Razorpay, got %+v", refund)
+	}
+	if refunds := fake.Refunds(payment.ID); len(refunds) != 1 {
+		t.Fatalf("expected one refund at Razorpay, got %+v", refunds)
+	}
+
+	unknown := models.Order{
+		ID:            primitive.NewObjectID(),
+		OrderNumber:   "TJ-1002",
+		PaymentMethod: models.PaymentMethodCashfree,
+		PaymentStatus: models.PaymentStatusPaid,
+		Total:         5000,
+	}
+	if _, err := svc.RefundPayment(&unknown, 0, "Returned"); !errors.Is(err, ErrRefundNeedsManualHandling) {
+		t.Fatalf("expected an online order with no payment to need manual handling, got %v", err)
+	}
+	if len(unknown.Refunds) != 0 {
+		t.Fatalf("expected no refund recorded, got %+v", unknown.Refunds)
+	}
+
+	cod := unknown
+	cod.OrderNumber = "TJ-1003"
+	cod.PaymentMethod = models.PaymentMethodCOD
+	refund, err = svc.RefundPayment(&cod, 0, "Returned")
+	if err != nil || refund.Status != models.RefundStatusProcessed {
+		t.Fatalf("expected cash on delivery refund to be recorded offline, got %+v, %v", refund, err)
+	}
+}
+
+func TestRefundOrderReturnsOnlyWhenFullyRefunded(t *testing.T) {
+	svc, fake, repo, _, order := newTestPaymentService(t)
+	payTestOrder(t, svc, fake, order)
+
+	productID := primitive.NewObjectID()
+	delivered := time.Now()
+	stored := repo.orders[order.ID]
+	stored.Status = models.OrderStatusDelivered
+	stored.DeliveredAt = &delivered
+	stored.Items = []models.OrderItem{{ProductID: productID, Name: "Solitaire Ring", Quantity: 1, Price: order.Total, StockReserved: true}}
+	stored.StockStatus = models.StockReservationCommitted
+	repo.orders[order.ID] = stored
+
+	stock := &memoryStockRepository{released: map[primitive.ObjectID]int{}}
+	orders := NewOrderService(repo, nil, nil).(*orderService)
+	orders.SetStockService(NewStockService(stock))
+	orders.SetPaymentService(svc)
+	admin := models.OrderActor{Type: models.OrderActorAdmin, ID: "admin-1"}
+
+	if err := orders.RefundOrder(order.ID.Hex(), 2000, admin, "Scratched clasp"); err != nil {
+		t.Fatalf("partial refund: %v", err)
+	}
+	partial := repo.orders[order.ID]
+	if partial.Status != models.OrderStatusDelivered || partial.StockStatus != models.StockReservationCommitted || stock.released[productID] != 0 {
+		t.Fatalf("expected a partial refund to leave the order delivered and its stock sold, got %s/%s", partial.Status, partial.StockStatus)
+	}
+	if len(partial.Refunds) != 1 || partial.Refunds[0].Amount != 2000 {
+		t.Fatalf("expected the partial refund to be recorded, got %+v", partial.Refunds)
+	}
+
+	if err := orders.RefundOrder(order.ID.Hex(), 0, admin, "Returned"); err != nil {
+		t.Fatalf("full refund: %v", err)
+	}
+	refunded := repo.orders[order.ID]
+	if refunded.Status != models.OrderStatusReturned || refunded.PaymentStatus != models.PaymentStatusRefunded || stock.released[productID] != 1 {
+		t.Fatalf("expected the fully refunded order to be returned and restocked, got %s/%s with %d released", refunded.Status, refunded.PaymentStatus, stock.released[productID])
+	}
+}
+
+// recordingInvoiceService records the refunds credit notes are issued for
+type recordingInvoiceService struct {
+	InvoiceService
+	credited []string
+}
+
+func (s *recordingInvoiceService) IssueCreditNote(ctx context.Context, order *models.Order, refund *models.PaymentRefund) (*models.CreditNote, error) {
+	s.credited = append(s.credited, refund.RefundID)
+	return &models.CreditNote{RefundID: refund.RefundID}, nil
+}
+
+func TestRefundRetryAndWebhook(t *testing.T) {
+	svc, fake, repo, _, order := newTestPaymentService(t)
+	loyalty := withLoyalty(svc, repo, order)
+	payment := payTestOrder(t, svc, fake, order)
+	invoices := &recordingInvoiceService{}
+	svc.SetInvoiceService(invoices)
+
+	fake.FailRefunds("Insufficient balance in merchant account")
+	stored := repo.orders[order.ID]
+	refund, err := svc.RefundPayment(&stored, 0, "Cancelled by customer")
+	if err != nil {
+		t.Fatalf("refund: %v", err)
+	}
+	if refund.Status != models.RefundStatusFailed || stored.RefundableAmount() != 0 {
+		t.Fatalf("expected a failed refund holding the total, got %+v", refund)
+	}
+	repo.Update(context.Background(), &stored)
+
+	if err := svc.RetryFailedRefunds(); err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	stored = repo.orders[order.ID]
+	if retried, _ := stored.GetRefund(refund.RefundID); retried.Status != models.RefundStatusFailed || retried.Retries != 1 {
+		t.Fatalf("expected refund to fail again, got %+v", retried)
+	}
+	if len(invoices.credited) != 0 {
+		t.Fatalf("expected no credit note while the refund fails, got %v", invoices.credited)
+	}
+
+	fake.FailRefunds("")
+	if err := svc.RetryFailedRefunds(); err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	stored = repo.orders[order.ID]
+	retried, _ := stored.GetRefund(refund.RefundID)
+	if retried.Status != models.RefundStatusProcessed || stored.PaymentStatus != models.PaymentStatusRefunded {
+		t.Fatalf("expected retried refund to be processed, got %+v", retried)
+	}
+	if loyalty.program.AvailableCredits != 0 {
+		t.Fatalf("expected credits reversed once, have %d", loyalty.program.AvailableCredits)
+	}
+	if len(invoices.credited) != 1 || invoices.credited[0] != refund.RefundID {
+		t.Fatalf("expected a credit note once the refund went through, got %v", invoices.credited)
+	}
+
+	refunds := fake.Refunds(payment.ID)
+	if len(refunds) != 1 || refunds[0].Receipt != refund.RefundID {
+		t.Fatalf("expected one refund under %s, got %+v", refund.RefundID, refunds)
+	}
+
+	// A late failure for a processed refund is ignored
+	body, signature, err := fake.RefundWebhook("refund.failed", refunds[0].ID)
+	if err != nil {
+		t.Fatalf("refund webhook: %v", err)
+	}
+	if err := svc.HandleWebhook(models.PaymentMethodRazorpay, body, webhookHeaders(signature)); err != nil {
+		t.Fatalf("handle refund webhook: %v", err)
+	}
+	stored = repo.orders[order.ID]
+	if retried, _ := stored.GetRefund(refund.RefundID); retried.Status != models.RefundStatusProcessed {
+		t.Fatalf("expected refund to stay processed, got %+v", retried)
+	}
+	if len(invoices.credited) != 1 {
+		t.Fatalf("expected a single credit note, got %v", invoices.credited)
+	}
+}
+
+func TestRefundWebhookProcessesInitiatedRefund(t *testing.T) {
+	svc, fake, repo, _, order := newTestPaymentService(t)
+	loyalty := withLoyalty(svc, repo, order)
+	payment := payTestOrder(t, svc, fake, order)
+
+	stored := repo.orders[order.ID]
+	refund, err := svc.RefundPayment(&stored, 5000, "Returned one item")
+	if err != nil {
+		t.Fatalf("refund: %v", err)
+	}
+
+	// Record the refund as the gateway reported it before processing
+	pending := *refund
+	pending.Status = models.RefundStatusInitiated
+	pending.ProcessedAt = nil
+	pending.CreditsReversed = false
+	stored.RecordRefund(pending)
+	repo.Update(context.Background(), &stored)
+	loyalty.program.AvailableCredits = 1000
+	loyalty.transactions = loyalty.transactions[:1]
+	invoices := &recordingInvoiceService{}
+	svc.SetInvoiceService(invoices)
+
+	body, signature, err := fake.RefundWebhook("refund.processed", fake.Refunds(payment.ID)[0].ID)
+	if err != nil {
+		t.Fatalf("refund webhook: %v", err)
+	}
+	if err := svc.HandleWebhook(models.PaymentMethodRazorpay, body, webhookHeaders(tamper(signature))); !errors.Is(err, ErrInvalidPaymentSignature) {
+		t.Fatalf("expected tampered refund webhook to be rejected, got %v", err)
+	}
+	if len(invoices.credited) != 0 {
+		t.Fatalf("expected no credit note for an initiated refund, got %v", invoices.credited)
+	}
+	if err := svc.HandleWebhook(models.PaymentMethodRazorpay, body, webhookHeaders(signature)); err != nil {
+		t.Fatalf("handle refund webhook: %v", err)
+	}
+	if len(invoices.credited) != 1 || invoices.credited[0] != refund.RefundID {
+		t.Fatalf("expected the processed refund to get its credit note, got %v", invoices.credited)
+	}
+
+	stored = repo.orders[order.ID]
+	processed, _ := stored.GetRefund(refund.RefundID)
+	if processed.Status != models.RefundStatusProcessed || processed.ProcessedAt == nil {
+		t.Fatalf("expected refund to be processed, got %+v", processed)
+	}
+	if stored.PaymentStatus != models.PaymentStatusPaid || *stored.RefundStatus != string(models.RefundStatusProcessed) {
+		t.Fatalf("unexpected order refund state: %+v", stored)
+	}
+	if loyalty.program.AvailableCredits != 600 {
+		t.Fatalf("expected 400 credits reversed, have %d", loyalty.program.AvailableCredits)
+	}
+}
+
+func TestWebhookDeliveredTwiceIsProcessedOnce(t *testing.T) {
+	svc, fake, repo, orders, order := newTestPaymentService(t)
+	razorpay := models.PaymentMethodRazorpay
+	events := &memoryWebhookEventRepository{}
+	svc.SetWebhookEventRepository(events)
+
+	session, err := svc.CreatePayment(razorpay, buyer, createRequest(order, order.Total))
+	if err != nil {
+		t.Fatalf("create payment: %v", err)
+	}
+	payment, _, err := fake.Pay(session.ProviderOrderID)
+	if err != nil {
+		t.Fatalf("pay: %v", err)
+	}
+	body, signature, _ := fake.Webhook("payment.captured", payment.ID)
+
+	forged := webhookHeaders(tamper(signature))
+	forged.Set("X-Razorpay-Event-Id", "evt_1")
+	if err := svc.HandleWebhook(razorpay, body, forged); !errors.Is(err, ErrInvalidPaymentSignature) {
+		t.Fatalf("expected forged webhook to be rejected, got %v", err)
+	}
+
+	headers := webhookHeaders(signature)
+	headers.Set("X-Razorpay-Event-Id", "evt_1")
+	for i := 0; i < 2; i++ {
+		if err := svc.HandleWebhook(razorpay, body, headers); err != nil {
+			t.Fatalf("delivery %d: %v", i+1, err)
+		}
+	}
+
+	if orders.completed != 1 || repo.orders[order.ID].PaymentStatus != models.PaymentStatusPaid {
+		t.Fatalf("expected order to be completed once, got %d", orders.completed)
+	}
+	if len(events.events) != 2 {
+		t.Fatalf("expected the rejected and the genuine event, got %+v", events.events)
+	}
+	rejected, genuine := events.events[0], events.events[1]
+	if rejected.Status != models.WebhookEventRejected || rejected.SignatureValid {
+		t.Fatalf("expected forged delivery to be recorded as rejected, got %+v", rejected)
+	}
+	if genuine.Status != models.WebhookEventProcessed || genuine.EventID != "evt_1" || genuine.EventType != "payment.captured" {
+		t.Fatalf("expected genuine event to be processed, got %+v", genuine)
+	}
+	if genuine.Deliveries != 2 || genuine.Attempts != 1 || genuine.Headers["X-Razorpay-Signature"] != signature {
+		t.Fatalf("expected two deliveries and one attempt, got %+v", genuine)
+	}
+}
+
+func TestReplayFailedWebhook(t *testing.T) {
+	svc, fake, repo, orders, order := newTestPaymentService(t)
+	razorpay := models.PaymentMethodRazorpay
+	events := &memoryWebhookEventRepository{}
+	svc.SetWebhookEventRepository(events)
+
+	session, err := svc.CreatePayment(razorpay, buyer, createRequest(order, order.Total))
+	if err != nil {
+		t.Fatalf("create payment: %v", err)
+	}
+	payment, _, err := fake.Pay(session.ProviderOrderID)
+	if err != nil {
+		t.Fatalf("pay: %v", err)
+	}
+
+	// Without an order service the payment cannot be completed, so processing fails
+	svc.orderService = nil
+	body, signature, _ := fake.Webhook("payment.captured", payment.ID)
+	if err := svc.HandleWebhook(razorpay, body, webhookHeaders(signature)); err == nil {
+		t.Fatal("expected webhook processing to fail")
+	}
+
+	failed := models.WebhookEventFailed
+	list, total, _ := svc.ListWebhookEvents(models.WebhookEventFilter{Status: &failed})
+	if total != 1 || list[0].Error == "" || list[0].EventID == "" {
+		t.Fatalf("expected one failed event with its error, got %+v", list)
+	}
+
+	svc.SetOrderService(orders)
+	replayed, err := svc.ReplayWebhookEvent(list[0].ID.Hex())
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if replayed.Status != models.WebhookEventProcessed || replayed.ProcessedAt == nil {
+		t.Fatalf("expected replayed event to be processed, got %+v", replayed)
+	}
+	if orders.completed != 1 || repo.orders[order.ID].PaymentStatus != models.PaymentStatusPaid {
+		t.Fatalf("expected order to be completed by the replay, got %d", orders.completed)
+	}
+
+	stored, _ := svc.GetWebhookEvent(list[0].ID.Hex())
+	if stored.Attempts != 2 || stored.Error != "" {
+		t.Fatalf("expected two attempts and no error, got %+v", stored)
+	}
+	if _, err := svc.ReplayWebhookEvent(list[0].ID.Hex()); !errors.Is(err, ErrWebhookEventNotReplayable) {
+		t.Fatalf("expected processed event not to be replayable, got %v", err)
+	}
+}
+
+func TestReconcilePayments(t *testing.T) {
+	svc, fake, repo, _, paidOrder := newTestPaymentService(t)
+	razorpay := models.PaymentMethodRazorpay
+	attempts := svc.attemptRepo.(*memoryPaymentAttemptRepository)
+
+	inbox := &memoryAdminNotificationRepository{}
+	orders := NewOrderService(repo, nil, nil).(*orderService)
+	orders.SetPaymentService(svc)
+	orders.SetAdminNotificationRepository(inbox)
+	svc.SetOrderService(orders)
+
+	addOrder := func(number string) *models.Order {
+		order := *paidOrder
+		order.ID = primitive.NewObjectID()
+		order.OrderNumber = number
+		repo.orders[order.ID] = order
+		return &order
+	}
+	staleOrder := addOrder("TJ-1002")
+	cancelledOrder := addOrder("TJ-1003")
+	mismatchOrder := addOrder("TJ-1004")
+	freshOrder := addOrder("TJ-1005")
+
+	sessions := make(map[primitive.ObjectID]*models.PaymentSession)
+	for _, order := range []*models.Order{paidOrder, staleOrder, cancelledOrder, mismatchOrder, freshOrder} {
+		session, err := svc.CreatePayment(razorpay, buyer, createRequest(order, order.Total))
+		if err != nil {
+			t.Fatalf("create payment for %s: %v", order.OrderNumber, err)
+		}
+		sessions[order.ID] = session
+	}
+
+	// Paid at the gateway, but the webhook never arrived
+	payments := make(map[primitive.ObjectID]string)
+	for _, order := range []*models.Order{paidOrder, cancelledOrder, mismatchOrder} {
+		payment, _, err := fake.Pay(sessions[order.ID].ProviderOrderID)
+		if err != nil {
+			t.Fatalf("pay %s: %v", order.OrderNumber, err)
+		}
+		payments[order.ID] = payment.ID
+	}
+	cancelled := repo.orders[cancelledOrder.ID]
+	cancelled.Cancel(models.OrderActor{Type: models.OrderActorCustomer}, "Customer request")
+	repo.orders[cancelledOrder.ID] = cancelled
+	for i := range attempts.attempts {
+		switch attempts.attempts[i].OrderID {
+		case staleOrder.ID:
+			attempts.attempts[i].CreatedAt = time.Now().Add(-2 * stalePaymentAfter)
+		case mismatchOrder.ID:
+			attempts.attempts[i].Amount = 999
+		}
+	}
+
+	reports := &memoryReconciliationReportRepository{}
+	svc.SetReconciliationReportRepository(reports)
+	report, err := svc.ReconcilePayments()
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+
+	if report.OrdersChecked != 5 || len(reports.reports) != 1 {
+		t.Fatalf("expected five orders checked and the report saved, got %+v", report)
+	}
+	kinds := make(map[string]models.ReconciliationEntryKind)
+	for _, entry := range report.Entries {
+		kinds[entry.OrderNumber] = entry.Kind
+	}
+	expected := map[string]models.ReconciliationEntryKind{
+		"TJ-1001": models.ReconciliationSettled,
+		"TJ-1002": models.ReconciliationStale,
+		"TJ-1003": models.ReconciliationRefunded,
+		"TJ-1004": models.ReconciliationAmountMismatch,
+	}
+	if len(kinds) != len(expected) {
+		t.Fatalf("expected %d entries, got %+v", len(expected), report.Entries)
+	}
+	for number, kind := range expected {
+		if kinds[number] != kind {
+			t.Fatalf("expected %s to be %s, got %s", number, kind, kinds[number])
+		}
+	}
+
+	if settled := repo.orders[paidOrder.ID]; settled.PaymentStatus != models.PaymentStatusPaid || settled.Status != models.OrderStatusConfirmed {
+		t.Fatalf("expected settled order to be confirmed, got %s/%s", settled.Status, settled.PaymentStatus)
+	}
+	if refunded := repo.orders[cancelledOrder.ID]; refunded.Status != models.OrderStatusCancelled || refunded.PaymentStatus != models.PaymentStatusRefunded {
+		t.Fatalf("expected the cancelled order's payment to be refunded, got %s/%s", refunded.Status, refunded.PaymentStatus)
+	}
+	if refunds := fake.Refunds(payments[cancelledOrder.ID]); len(refunds) != 1 || len(inbox.notifications) != 1 {
+		t.Fatalf("expected one refund at Razorpay and one admin alert, got %+v and %d alerts", refunds, len(inbox.notifications))
+	}
+	if status := repo.orders[staleOrder.ID].PaymentStatus; status != models.PaymentStatusFailed {
+		t.Fatalf("expected stale order to be failed, got %s", status)
+	}
+	if status := repo.orders[freshOrder.ID].PaymentStatus; status != models.PaymentStatusPending {
+		t.Fatalf("expected fresh order to stay pending, got %s", status)
+	}
+	if status := repo.orders[mismatchOrder.ID].PaymentStatus; status != models.PaymentStatusPending {
+		t.Fatalf("expected mismatched order to stay pending, got %s", status)
+	}
+
+	csvData, err := svc.ReconciliationReportCSV(report)
+	if err != nil {
+		t.Fatalf("csv: %v", err)
+	}
+	if lines := strings.Count(string(csvData), "\n"); lines != len(report.Entries)+1 {
+		t.Fatalf("expected a header and one row per entry, got %d lines", lines)
+	}
+
+	// Settled and refunded orders drop out of the next run
+	again, _ := svc.ReconcilePayments()
+	if again.Counts[models.ReconciliationSettled] != 0 || again.Counts[models.ReconciliationRefunded] != 0 {
+		t.Fatalf("expected settled and refunded orders not to be reported again, got %v", again.Counts)
+	}
+	if refunds := fake.Refunds(payments[cancelledOrder.ID]); len(refunds) != 1 || len(inbox.notifications) != 1 {
+		t.Fatalf("expected the cancelled order to be refunded and reported once, got %d refunds and %d alerts", len(refunds), len(inbox.notifications))
+	}
+}
+
+func TestPaymentAfterReservationExpiryIsRefunded(t *testing.T) {
+	svc, fake, repo, _, order := newTestPaymentService(t)
+	razorpay := models.PaymentMethodRazorpay
+
+	productID := primitive.NewObjectID()
+	expired := time.Now().Add(-time.Minute)
+	stored := repo.orders[order.ID]
+	stored.Items = []models.OrderItem{{ProductID: productID, Name: "Solitaire Ring", Quantity: 1, Price: order.Total, StockReserved: true}}
+	stored.StockStatus = models.StockReservationReserved
+	stored.StockReservedUntil = &expired
+	repo.orders[order.ID] = stored
+
+	stock := &memoryStockRepository{released: map[primitive.ObjectID]int{}}
+	inbox := &memoryAdminNotificationRepository{}
+	orders := NewOrderService(repo, nil, nil).(*orderService)
+	orders.SetStockService(NewStockService(stock))
+	orders.SetPaymentService(svc)
+	orders.SetAdminNotificationRepository(inbox)
+	svc.SetOrderService(orders)
+
+	checkout, err := svc.CreatePayment(razorpay, buyer, createRequest(order, order.Total))
+	if err != nil {
+		t.Fatalf("create payment: %v", err)
+	}
+	link, err := svc.CreatePaymentLink(razorpay, buyer, createRequest(order, order.Total))
+	if err != nil {
+		t.Fatalf("create payment link: %v", err)
+	}
+
+	if err := orders.ReleaseExpiredReservations(); err != nil {
+		t.Fatalf("release expired reservations: %v", err)
+	}
+	if cancelled := repo.orders[order.ID]; cancelled.Status != models.OrderStatusCancelled || stock.released[productID] != 1 {
+		t.Fatalf("expected the lapsed order to be cancelled and restocked, got %s with %d released", cancelled.Status, stock.released[productID])
+	}
+	if rzpLink, _ := fake.PaymentLink(link.ProviderOrderID); rzpLink.Status != "cancelled" {
+		t.Fatalf("expected the payment link to be cancelled at Razorpay, got %s", rzpLink.Status)
+	}
+	attempts, _ := svc.GetPaymentAttempts(order.ID.Hex(), buyer)
+	for _, attempt := range attempts {
+		if attempt.Status != models.PaymentAttemptFailed || attempt.FailureReason == "" {
+			t.Fatalf("expected every open attempt to be closed, got %+v", attempt)
+		}
+	}
+	if _, err := svc.CreatePayment(razorpay, buyer, createRequest(order, order.Total)); err == nil {
+		t.Fatal("expected a cancelled order to refuse new payments")
+	}
+
+	// A Razorpay order cannot be closed, so the customer can still finish its checkout
+	payment, _, err := fake.Pay(checkout.ProviderOrderID)
+	if err != nil {
+		t.Fatalf("pay: %v", err)
+	}
+	body, signature, _ := fake.Webhook("payment.captured", payment.ID)
+	if err := svc.HandleWebhook(razorpay, body, webhookHeaders(signature)); err != nil {
+		t.Fatalf("expected the late payment to be handled, got %v", err)
+	}
+
+	refunded := repo.orders[order.ID]
+	if refunded.Status != models.OrderStatusCancelled || refunded.PaymentStatus != models.PaymentStatusRefunded {
+		t.Fatalf("expected the order to stay cancelled with its payment refunded, got %s/%s", refunded.Status, refunded.PaymentStatus)
+	}
+	if len(refunded.Refunds) != 1 || refunded.Refunds[0].Amount != order.Total || refunded.Refunds[0].Status != models.RefundStatusProcessed {
+		t.Fatalf("expected a full refund, got %+v", refunded.Refunds)
+	}
+	if refunds := fake.Refunds(payment.ID); len(refunds) != 1 || refunds[0].Amount != toPaise(order.Total) {
+		t.Fatalf("expected the payment to be refunded at Razorpay, got %+v", refunds)
+	}
+	if stock.released[productID] != 1 || refunded.StockStatus != models.StockReservationReleased {
+		t.Fatalf("expected the released stock not to be taken again, got %s", refunded.StockStatus)
+	}
+	if len(inbox.notifications) != 1 || inbox.notifications[0].Priority != models.PriorityHigh {
+		t.Fatalf("expected admins to be alerted once, got %+v", inbox.notifications)
+	}
+
+	// Razorpay reports the same payment again
+	body, signature, _ = fake.Webhook("order.paid", payment.ID)
+	if err := svc.HandleWebhook(razorpay, body, webhookHeaders(signature)); err != nil {
+		t.Fatalf("handle repeated webhook: %v", err)
+	}
+	if refunds := fake.Refunds(payment.ID); len(refunds) != 1 || len(inbox.notifications) != 1 {
+		t.Fatalf("expected the payment to be refunded once, got %d refunds and %d alerts", len(refunds), len(inbox.notifications))
+	}
+}
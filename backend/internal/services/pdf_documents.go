@@ -0,0 +1,682 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"thyne-jewels-backend/internal/models"
+)
+
+// Page layout shared by all documents, in points
+const (
+	docLeft   = 40.0
+	docRight  = pdfPageWidth - 40
+	docBottom = 760.0 // Content below this moves to a new page
+)
+
+// invoiceColumn is one column of the invoice line table
+type invoiceColumn struct {
+	title string
+	width float64
+	right bool // Right-aligned, for amounts
+}
+
+var invoiceColumns = []invoiceColumn{
+	{"#", 18, false},
+	{"Description", 130, false},
+	{"HSN/SAC", 42, false},
+	{"Qty", 24, true},
+	{"Taxable", 62, true},
+	{"GST %", 30, true},
+	{"CGST", 45, true},
+	{"SGST", 45, true},
+	{"IGST", 45, true},
+	{"Amount", 74, true},
+}
+
+// renderInvoice lays out a GST tax invoice
+func renderInvoice(data *models.InvoiceData) (*pdfWriter, error) {
+	w := newPDFWriter("Tax Invoice " + data.Invoice.InvoiceNumber)
+
+	details := [][2]string{
+		{"Invoice No", data.Invoice.InvoiceNumber},
+		{"Invoice Date", data.Invoice.InvoiceDate.Format("02 Jan 2006")},
+		{"Order No", data.Order.OrderNumber},
+		{"Order Date", data.Order.CreatedAt.Format("02 Jan 2006")},
+	}
+	if breakdown := data.Order.TaxBreakdown; breakdown != nil && breakdown.PlaceOfSupply != "" {
+		details = append(details, [2]string{"Place of Supply", placeOfSupply(breakdown.PlaceOfSupply)})
+	}
+	y := drawDocumentHeader(w, data.Company, "TAX INVOICE", details)
+	if data.Invoice.Status == models.InvoiceStatusVoid {
+		w.Text(docLeft, y, 12, true, "VOID")
+		y = w.Paragraph(docLeft+40, y, docRight-docLeft-40, 9, false, "This invoice was cancelled: "+data.Invoice.VoidReason) + 8
+	}
+
+	// Billing and shipping parties
+	billTo := []string{customerName(data)}
+	if data.Invoice.BuyerLegalName != "" {
+		billTo[0] = data.Invoice.BuyerLegalName
+	}
+	billTo = append(billTo, addressLines(data.Order.ShippingAddress)...)
+	if data.Invoice.BuyerGSTIN != "" {
+		billTo = append(billTo, "GSTIN: "+data.Invoice.BuyerGSTIN)
+	}
+	if data.User.Email != "" {
+		billTo = append(billTo, data.User.Email)
+	}
+	if phone := customerPhone(data); phone != "" {
+		billTo = append(billTo, "Phone: "+phone)
+	}
+	shipTo := []string{recipientName(data)}
+	shipTo = append(shipTo, addressLines(data.Order.ShippingAddress)...)
+	if data.ShippingDetails.TrackingID != "" {
+		shipTo = append(shipTo, "AWB: "+strings.TrimSpace(data.ShippingDetails.Carrier+" "+data.ShippingDetails.TrackingID))
+	}
+	y = drawParties(w, y, "Billed To", billTo, "Shipped To", shipTo)
+
+	// Line items
+	y = drawInvoiceTableHeader(w, y)
+	for i, item := range data.Items {
+		description := item.Description
+		if description == "" {
+			description = item.ProductName
+		}
+		rowHeight := 14.0
+		if item.MetalType != "" || item.Weight > 0 || len(item.HUIDs) > 0 {
+			rowHeight = 22
+		}
+		if y+rowHeight > docBottom {
+			w.AddPage()
+			y = drawInvoiceTableHeader(w, 50)
+		}
+
+		cells := []string{
+			fmt.Sprintf("%d", i+1),
+			description,
+			item.HSNCode,
+			fmt.Sprintf("%d", item.Quantity),
+			fmt.Sprintf("%.2f", item.TaxableValue),
+			taxRateCell(item.TaxRate, item.TaxAmount),
+			amountCell(item.CGST),
+			amountCell(item.SGST),
+			amountCell(item.IGST),
+			fmt.Sprintf("%.2f", item.TotalPrice),
+		}
+		drawTableRow(w, y+10, cells, false)
+		if rowHeight > 14 {
+			w.Text(docLeft+invoiceColumns[0].width+3, y+19, 6.5, false, pdfTruncate(itemSpecification(item), invoiceColumns[1].width+invoiceColumns[2].width, 6.5, false))
+		}
+		y += rowHeight
+		w.Line(docLeft, y, docRight, y, 0.3)
+	}
+
+	// Totals on the right, amount in words and payment on the left
+	if y > docBottom-190 {
+		w.AddPage()
+		y = 50
+	}
+	y += 14
+	totalsTop := y
+	totals := [][2]string{{"Subtotal", formatRupees(data.Totals.Subtotal)}}
+	if data.Totals.Discount > 0 {
+		totals = append(totals, [2]string{"Discount", "- " + formatRupees(data.Totals.Discount)})
+	}
+	if breakdown := data.Order.TaxBreakdown; breakdown != nil {
+		totals = append(totals, [2]string{"Taxable Value", formatRupees(breakdown.TaxableValue)})
+	}
+	if data.TaxDetails.CGST > 0 || data.TaxDetails.SGST > 0 {
+		totals = append(totals, [2]string{"CGST", formatRupees(data.TaxDetails.CGST)}, [2]string{"SGST", formatRupees(data.TaxDetails.SGST)})
+	}
+	if data.TaxDetails.IGST > 0 {
+		totals = append(totals, [2]string{"IGST", formatRupees(data.TaxDetails.IGST)})
+	}
+	if data.TaxDetails.CGST == 0 && data.TaxDetails.SGST == 0 && data.TaxDetails.IGST == 0 {
+		totals = append(totals, [2]string{"GST", formatRupees(data.Totals.TaxAmount)})
+	}
+	totals = append(totals, [2]string{"Shipping", formatRupees(data.Totals.ShippingCost)})
+	if data.Totals.CODCharge > 0 {
+		totals = append(totals, [2]string{"COD Charge", formatRupees(data.Totals.CODCharge)})
+	}
+	for _, total := range totals {
+		w.Text(370, y, 9, false, total[0])
+		w.TextRight(docRight, y, 9, false, total[1])
+		y += 14
+	}
+	w.Line(370, y-8, docRight, y-8, 0.6)
+	y += 4
+	w.Text(370, y, 11, true, "Grand Total")
+	w.TextRight(docRight, y, 11, true, formatRupees(data.Totals.Total))
+	totalsBottom := y + 14
+
+	left := totalsTop
+	w.Text(docLeft, left, 8.5, true, "Amount in words")
+	left = w.Paragraph(docLeft, left+12, 300, 8.5, false, amountInWords(data.Totals.Total))
+	left += 8
+	left = drawPaymentDetails(w, left, data.PaymentDetails)
+
+	y = math.Max(left, totalsBottom) + 10
+	if data.Notes != "" {
+		w.Text(docLeft, y, 8.5, true, "Notes")
+		y = w.Paragraph(docLeft, y+12, 400, 8.5, false, data.Notes) + 6
+	}
+
+	if err := drawVerificationQR(w, y, data.QRCode); err != nil {
+		return nil, err
+	}
+	drawFooter(w, data.Company, "This is a computer-generated invoice and does not require a signature.")
+	return w, nil
+}
+
+// renderReceipt lays out a payment receipt for an order
+func renderReceipt(data *models.InvoiceData) (*pdfWriter, error) {
+	w := newPDFWriter("Payment Receipt " + data.Order.OrderNumber)
+
+	y := drawDocumentHeader(w, data.Company, "PAYMENT RECEIPT", [][2]string{
+		{"Receipt No", "RCPT-" + data.Order.OrderNumber},
+		{"Payment Date", data.PaymentDetails.PaymentDate.Format("02 Jan 2006")},
+		{"Order No", data.Order.OrderNumber},
+	})
+
+	y += 6
+	statement := fmt.Sprintf("Received with thanks from %s the sum of %s (%s) by %s against order %s.",
+		customerName(data), formatRupees(data.Totals.Total), amountInWords(data.Totals.Total),
+		data.PaymentDetails.Method, data.Order.OrderNumber)
+	y = w.Paragraph(docLeft, y, docRight-docLeft, 10, false, statement) + 12
+
+	// Order summary
+	w.Rect(docLeft, y, docRight-docLeft, 16, 0.92)
+	w.Text(docLeft+4, y+11, 8.5, true, "Item")
+	w.TextRight(380, y+11, 8.5, true, "Qty")
+	w.TextRight(docRight-4, y+11, 8.5, true, "Amount")
+	y += 16
+	for _, item := range data.Order.Items {
+		if y+14 > docBottom {
+			w.AddPage()
+			y = 50
+		}
+		w.Text(docLeft+4, y+10, 8.5, false, pdfTruncate(item.Name, 300, 8.5, false))
+		w.TextRight(380, y+10, 8.5, false, fmt.Sprintf("%d", item.Quantity))
+		w.TextRight(docRight-4, y+10, 8.5, false, formatRupees(item.Price*float64(item.Quantity)))
+		y += 14
+		w.Line(docLeft, y, docRight, y, 0.3)
+	}
+
+	y += 14
+	totals := [][2]string{{"Subtotal", formatRupees(data.Totals.Subtotal)}}
+	if data.Totals.Discount > 0 {
+		totals = append(totals, [2]string{"Discount", "- " + formatRupees(data.Totals.Discount)})
+	}
+	totals = append(totals,
+		[2]string{"GST", formatRupees(data.Totals.TaxAmount)},
+		[2]string{"Shipping", formatRupees(data.Totals.ShippingCost)})
+	if data.Totals.CODCharge > 0 {
+		totals = append(totals, [2]string{"COD Charge", formatRupees(data.Totals.CODCharge)})
+	}
+	totals = append(totals, [2]string{"Amount Received", formatRupees(data.Totals.Total)})
+	for i, total := range totals {
+		bold := i == len(totals)-1
+		w.Text(370, y, 9, bold, total[0])
+		w.TextRight(docRight, y, 9, bold, total[1])
+		y += 14
+	}
+
+	y = drawPaymentDetails(w, y+6, data.PaymentDetails)
+	if err := drawVerificationQR(w, y+10, data.QRCode); err != nil {
+		return nil, err
+	}
+	drawFooter(w, data.Company, "This receipt confirms payment only. The tax invoice is issued separately.")
+	return w, nil
+}
+
+// renderWarrantyCard lays out the warranty card of one piece
+func renderWarrantyCard(data *warrantyCardData) (*pdfWriter, error) {
+	warranty := data.Warranty
+	w := newPDFWriter("Warranty Card " + warranty.WarrantyNumber)
+
+	y := drawDocumentHeader(w, data.Company, "WARRANTY CARD", [][2]string{
+		{"Warranty No", warranty.WarrantyNumber},
+		{"Order No", data.Order.OrderNumber},
+		{"Purchase Date", warranty.PurchaseDate.Format("02 Jan 2006")},
+	})
+
+	// The card itself
+	cardTop := y + 4
+	y = cardTop + 22
+	w.TextCentre(pdfPageWidth/2, y, 14, true, data.ProductName)
+	y += 24
+
+	facts := [][2]string{
+		{"Warranty Type", strings.Title(warranty.WarrantyType)},
+		{"Valid From", warranty.WarrantyStart.Format("02 Jan 2006")},
+		{"Valid Until", warranty.WarrantyEnd.Format("02 Jan 2006")},
+	}
+	if data.MetalType != "" {
+		facts = append(facts, [2]string{"Metal", data.MetalType})
+	}
+	if data.Weight > 0 {
+		facts = append(facts, [2]string{"Weight", fmt.Sprintf("%.2f g", data.Weight)})
+	}
+	if !warranty.IsActive {
+		facts = append(facts, [2]string{"Status", "Void"})
+	}
+	for _, fact := range facts {
+		w.Text(docLeft+20, y, 10, true, fact[0])
+		w.Text(docLeft+140, y, 10, false, fact[1])
+		y += 16
+	}
+	y += 6
+	w.Line(docLeft, cardTop, docRight, cardTop, 1)
+	w.Line(docLeft, y, docRight, y, 1)
+	w.Line(docLeft, cardTop, docLeft, y, 1)
+	w.Line(docRight, cardTop, docRight, y, 1)
+	y += 22
+
+	if len(warranty.CoverageDetails) > 0 {
+		w.Text(docLeft, y, 10, true, "Coverage")
+		y += 14
+		for _, coverage := range warranty.CoverageDetails {
+			claims := "Unlimited claims"
+			if coverage.MaxClaims > 0 {
+				claims = fmt.Sprintf("%d of %d claims used", coverage.UsedClaims, coverage.MaxClaims)
+			}
+			line := fmt.Sprintf("%s: %s (%s)", strings.Title(coverage.Type), coverage.Description, claims)
+			y = w.Paragraph(docLeft+10, y, docRight-docLeft-10, 9, false, "- "+line)
+		}
+		y += 8
+	}
+	for _, section := range []struct {
+		title string
+		lines []string
+	}{{"Terms", warranty.Terms}, {"Exclusions", warranty.Exclusions}} {
+		if len(section.lines) == 0 {
+			continue
+		}
+		if y > docBottom-60 {
+			w.AddPage()
+			y = 50
+		}
+		w.Text(docLeft, y, 10, true, section.title)
+		y += 14
+		for _, line := range section.lines {
+			y = w.Paragraph(docLeft+10, y, docRight-docLeft-10, 9, false, "- "+line)
+		}
+		y += 8
+	}
+
+	payload := strings.Join([]string{
+		"Warranty: " + warranty.WarrantyNumber,
+		"Product: " + data.ProductName,
+		"Order: " + data.Order.OrderNumber,
+		"Valid until: " + warranty.WarrantyEnd.Format("2006-01-02"),
+	}, "\n")
+	if err := drawVerificationQR(w, y, payload); err != nil {
+		return nil, err
+	}
+	drawFooter(w, data.Company, "Present this card with the piece when making a warranty claim.")
+	return w, nil
+}
+
+// gemstoneColumns are the columns of the stone grading table on a certificate
+var gemstoneColumns = []struct {
+	title string
+	x     float64
+}{
+	{"Stone", docLeft + 4}, {"Shape", docLeft + 90}, {"Carat", docLeft + 160}, {"Colour", docLeft + 210},
+	{"Clarity", docLeft + 260}, {"Cut", docLeft + 310}, {"Origin", docLeft + 370}, {"Treatment", docLeft + 440},
+}
+
+// renderCertificate lays out the certificate of authenticity of one piece
+func renderCertificate(data *certificateData) (*pdfWriter, error) {
+	certificate := data.Certificate
+	grading := certificate.GradingDetails
+	w := newPDFWriter("Certificate of Authenticity " + certificate.CertificateNo)
+
+	y := drawDocumentHeader(w, data.Company, "CERTIFICATE OF AUTHENTICITY", [][2]string{
+		{"Certificate No", certificate.CertificateNo},
+		{"Order No", certificate.OrderNumber},
+		{"Issue Date", certificate.IssueDate.Format("02 Jan 2006")},
+	})
+
+	y += 18
+	w.TextCentre(pdfPageWidth/2, y, 14, true, certificate.ProductName)
+	y += 16
+	y = w.Paragraph(docLeft, y, docRight-docLeft, 9, false,
+		"This certifies that the piece described below is genuine and was supplied by "+certificate.IssuingAuthority+
+			" with the metal, weight and stones recorded here.")
+	y += 10
+
+	facts := [][2]string{}
+	if certificate.Serial != "" {
+		facts = append(facts, [2]string{"Serial No", certificate.Serial})
+	}
+	if certificate.HUID != "" {
+		facts = append(facts, [2]string{"HUID", certificate.HUID})
+	}
+	if grading.MetalType != "" {
+		facts = append(facts, [2]string{"Metal", grading.MetalType})
+	}
+	if grading.MetalPurity != "" {
+		facts = append(facts, [2]string{"Purity", grading.MetalPurity})
+	}
+	if grading.Weight > 0 {
+		facts = append(facts, [2]string{"Gross Weight", fmt.Sprintf("%.3f g", grading.Weight)})
+	}
+	if grading.NetWeight > 0 {
+		facts = append(facts, [2]string{"Net Weight", fmt.Sprintf("%.3f g", grading.NetWeight)})
+	}
+	if grading.Dimensions != "" {
+		facts = append(facts, [2]string{"Dimensions", grading.Dimensions})
+	}
+	if grading.Condition != "" {
+		facts = append(facts, [2]string{"Condition", grading.Condition})
+	}
+	for _, fact := range facts {
+		w.Text(docLeft+20, y, 10, true, fact[0])
+		w.Text(docLeft+140, y, 10, false, fact[1])
+		y += 16
+	}
+	y += 10
+
+	if len(grading.Gemstones) > 0 {
+		w.Text(docLeft, y, 10, true, "Stone Grading")
+		y += 8
+		w.Rect(docLeft, y, docRight-docLeft, 16, 0.92)
+		for _, column := range gemstoneColumns {
+			w.Text(column.x, y+11, 7.5, true, column.title)
+		}
+		y += 16
+		for _, stone := range grading.Gemstones {
+			carat := ""
+			if stone.Carat > 0 {
+				carat = fmt.Sprintf("%.2f ct", stone.Carat)
+			}
+			cells := []string{stone.Type, stone.Shape, carat, stone.Color, stone.Clarity, stone.Cut, stone.Origin, stone.Treatment}
+			for i, column := range gemstoneColumns {
+				width := docRight - column.x - 4
+				if i+1 < len(gemstoneColumns) {
+					width = gemstoneColumns[i+1].x - column.x - 4
+				}
+				w.Text(column.x, y+11, 7.5, false, pdfTruncate(cells[i], width, 7.5, false))
+			}
+			y += 16
+			w.Line(docLeft, y, docRight, y, 0.3)
+		}
+		y += 14
+	}
+
+	w.Text(docLeft, y, 8, true, "Signature ("+models.CertificateSignatureAlgorithm+")")
+	y += 11
+	y = w.Paragraph(docLeft, y, docRight-docLeft-120, 7.5, false, certificate.Signature)
+	y += 10
+
+	if err := drawVerificationQR(w, y, certificate.QRCode); err != nil {
+		return nil, err
+	}
+	drawFooter(w, data.Company, "Scan the QR code to check this certificate against our records.")
+	return w, nil
+}
+
+// drawDocumentHeader draws the store details on the left and the document
+// title and details on the right, and returns the y below them
+func drawDocumentHeader(w *pdfWriter, company models.CompanyInfo, title string, details [][2]string) float64 {
+	w.Text(docLeft, 56, 18, true, company.Name)
+	left := 72.0
+	if company.Address != "" {
+		left = w.Paragraph(docLeft, left, 250, 8.5, false, company.Address)
+	}
+	if company.State != "" {
+		w.Text(docLeft, left, 8.5, false, "State: "+placeOfSupply(company.State))
+		left += 11.5
+	}
+	if company.TaxID != "" {
+		w.Text(docLeft, left, 8.5, true, "GSTIN: "+company.TaxID)
+		left += 11.5
+	}
+	contact := strings.Trim(company.Phone+" | "+company.Email, " |")
+	if contact != "" {
+		w.Text(docLeft, left, 8.5, false, contact)
+		left += 11.5
+	}
+
+	w.TextRight(docRight, 56, 15, true, title)
+	right := 74.0
+	for _, detail := range details {
+		w.Text(390, right, 8.5, false, detail[0])
+		w.TextRight(docRight, right, 8.5, true, detail[1])
+		right += 12
+	}
+
+	y := math.Max(left, right) + 4
+	w.Line(docLeft, y, docRight, y, 1)
+	return y + 16
+}
+
+// drawParties draws two labelled address blocks side by side
+func drawParties(w *pdfWriter, y float64, leftTitle string, leftLines []string, rightTitle string, rightLines []string) float64 {
+	w.Text(docLeft, y, 9, true, leftTitle)
+	w.Text(310, y, 9, true, rightTitle)
+	left, right := y+13, y+13
+	for i, line := range leftLines {
+		left = w.Paragraph(docLeft, left, 250, 8.5, i == 0, line)
+	}
+	for i, line := range rightLines {
+		right = w.Paragraph(310, right, 245, 8.5, i == 0, line)
+	}
+	return math.Max(left, right) + 8
+}
+
+// drawInvoiceTableHeader draws the column titles of the invoice line table
+func drawInvoiceTableHeader(w *pdfWriter, y float64) float64 {
+	titles := make([]string, len(invoiceColumns))
+	for i, column := range invoiceColumns {
+		titles[i] = column.title
+	}
+	w.Rect(docLeft, y, docRight-docLeft, 16, 0.92)
+	drawTableRow(w, y+11, titles, true)
+	return y + 16
+}
+
+// drawTableRow draws one row of cells along a baseline
+func drawTableRow(w *pdfWriter, baseline float64, cells []string, bold bool) {
+	x := docLeft
+	for i, column := range invoiceColumns {
+		text := pdfTruncate(cells[i], column.width-6, 7.5, bold)
+		if column.right {
+			w.TextRight(x+column.width-3, baseline, 7.5, bold, text)
+		} else {
+			w.Text(x+3, baseline, 7.5, bold, text)
+		}
+		x += column.width
+	}
+}
+
+// drawPaymentDetails draws how the order was paid and returns the y below
+func drawPaymentDetails(w *pdfWriter, y float64, payment models.PaymentInfo) float64 {
+	w.Text(docLeft, y, 8.5, true, "Payment")
+	y += 12
+	rows := [][2]string{{"Method", payment.Method}, {"Status", payment.PaymentStatus}}
+	if payment.TransactionID != "" {
+		rows = append(rows, [2]string{"Transaction ID", payment.TransactionID})
+	}
+	for _, row := range rows {
+		w.Text(docLeft, y, 8.5, false, row[0])
+		w.Text(docLeft+80, y, 8.5, false, row[1])
+		y += 11.5
+	}
+	return y
+}
+
+// drawVerificationQR draws the QR code on the right with a caption
+func drawVerificationQR(w *pdfWriter, y float64, payload string) error {
+	const size = 96.0
+	if y+size+12 > docBottom {
+		w.AddPage()
+		y = 50
+	}
+	if err := w.QRCode(docRight-size, y, size, payload); err != nil {
+		return err
+	}
+	w.TextCentre(docRight-size/2, y+size+6, 7, false, "Scan to verify")
+	return nil
+}
+
+// drawFooter closes the last page with a note and the store's contact details
+func drawFooter(w *pdfWriter, company models.CompanyInfo, note string) {
+	w.Line(docLeft, 790, docRight, 790, 0.5)
+	w.TextCentre(pdfPageWidth/2, 803, 7.5, false, note)
+	w.TextCentre(pdfPageWidth/2, 814, 7.5, false, "Thank you for shopping with "+company.Name+".")
+}
+
+// customerName is the buyer's name, falling back to the recipient
+func customerName(data *models.InvoiceData) string {
+	if data.User.Name != "" {
+		return data.User.Name
+	}
+	return recipientName(data)
+}
+
+func recipientName(data *models.InvoiceData) string {
+	if name := data.Order.ShippingAddress.RecipientName; name != "" {
+		return name
+	}
+	if data.User.Name != "" {
+		return data.User.Name
+	}
+	return "Customer"
+}
+
+func customerPhone(data *models.InvoiceData) string {
+	if data.User.Phone != "" {
+		return data.User.Phone
+	}
+	return data.Order.ShippingAddress.RecipientPhone
+}
+
+// addressLines formats an address over a few short lines
+func addressLines(address models.Address) []string {
+	var lines []string
+	if street := strings.Trim(strings.TrimSpace(address.HouseNoFloor)+", "+strings.TrimSpace(address.BuildingBlock), ", "); street != "" {
+		lines = append(lines, street)
+	} else if address.Street != "" {
+		lines = append(lines, address.Street)
+	}
+	if address.LandmarkArea != "" {
+		lines = append(lines, address.LandmarkArea)
+	}
+	city := strings.Trim(address.City+", "+address.State, ", ")
+	if address.Pincode != "" {
+		city = strings.TrimSpace(city + " - " + address.Pincode)
+	}
+	if city != "" {
+		lines = append(lines, city)
+	}
+	return lines
+}
+
+// placeOfSupply names a state with its GST state code
+func placeOfSupply(state string) string {
+	if code := models.GSTStateCode(state); code != "" {
+		return fmt.Sprintf("%s (%s)", state, code)
+	}
+	return state
+}
+
+// itemSpecification summarises the metal, stone, weight and hallmarks of an item
+func itemSpecification(item models.InvoiceItem) string {
+	var parts []string
+	if item.MetalType != "" {
+		parts = append(parts, item.MetalType)
+	}
+	if item.GemstoneType != "" {
+		parts = append(parts, item.GemstoneType)
+	}
+	if item.Weight > 0 {
+		parts = append(parts, fmt.Sprintf("%.2f g", item.Weight))
+	}
+	if len(item.HUIDs) > 0 {
+		parts = append(parts, "HUID "+strings.Join(item.HUIDs, ", "))
+	}
+	return strings.Join(parts, " | ")
+}
+
+func amountCell(amount float64) string {
+	if amount == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f", amount)
+}
+
+func taxRateCell(rate, amount float64) string {
+	if rate == 0 && amount == 0 {
+		return "-"
+	}
+	return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.2f", rate), "0"), ".")
+}
+
+// formatRupees formats an amount with Indian digit grouping, e.g. Rs. 1,23,456.50
+func formatRupees(amount float64) string {
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	paise := int64(math.Round(amount * 100))
+	rupees := fmt.Sprintf("%d", paise/100)
+
+	// The last three digits form one group, the rest are grouped in twos
+	if len(rupees) > 3 {
+		head, tail := rupees[:len(rupees)-3], rupees[len(rupees)-3:]
+		var groups []string
+		for len(head) > 2 {
+			groups = append([]string{head[len(head)-2:]}, groups...)
+			head = head[:len(head)-2]
+		}
+		groups = append([]string{head}, groups...)
+		rupees = strings.Join(groups, ",") + "," + tail
+	}
+	return fmt.Sprintf("%sRs. %s.%02d", sign, rupees, paise%100)
+}
+
+var (
+	numberWordsOnes = []string{"", "One", "Two", "Three", "Four", "Five", "Six", "Seven", "Eight", "Nine", "Ten",
+		"Eleven", "Twelve", "Thirteen", "Fourteen", "Fifteen", "Sixteen", "Seventeen", "Eighteen", "Nineteen"}
+	numberWordsTens = []string{"", "", "Twenty", "Thirty", "Forty", "Fifty", "Sixty", "Seventy", "Eighty", "Ninety"}
+)
+
+// amountInWords spells out an amount in the Indian numbering system, e.g.
+// "Rupees One Lakh Twenty Thousand and Fifty Paise Only"
+func amountInWords(amount float64) string {
+	paise := int64(math.Round(math.Abs(amount) * 100))
+	rupees, remainder := paise/100, paise%100
+
+	words := "Zero"
+	if rupees > 0 {
+		words = numberInWords(rupees)
+	}
+	result := "Rupees " + words
+	if remainder > 0 {
+		result += " and " + numberInWords(remainder) + " Paise"
+	}
+	return result + " Only"
+}
+
+func numberInWords(n int64) string {
+	var parts []string
+	for _, unit := range []struct {
+		value int64
+		name  string
+	}{{10000000, "Crore"}, {100000, "Lakh"}, {1000, "Thousand"}, {100, "Hundred"}} {
+		if n >= unit.value {
+			parts = append(parts, numberInWords(n/unit.value)+" "+unit.name)
+			n %= unit.value
+		}
+	}
+	if n >= 20 {
+		parts = append(parts, strings.TrimSpace(numberWordsTens[n/10]+" "+numberWordsOnes[n%10]))
+	} else if n > 0 {
+		parts = append(parts, numberWordsOnes[n])
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,519 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PDFService renders GST tax invoices, payment receipts, warranty cards and
+// certificates of authenticity, stores them in S3 and hands out short-lived
+// download links
+type PDFService interface {
+	GetInvoicePDF(ctx context.Context, invoiceID string, actor models.OrderActor) (*models.PDFDownload, error)
+	GetReceiptPDF(ctx context.Context, orderID string, actor models.OrderActor) (*models.PDFDownload, error)
+	GetWarrantyCardPDF(ctx context.Context, warrantyID string, actor models.OrderActor) (*models.PDFDownload, error)
+	GetCertificatePDF(ctx context.Context, certificateID string, actor models.OrderActor) (*models.PDFDownload, error)
+}
+
+var (
+	// ErrDocumentNotFound is returned for unknown documents and documents of other customers
+	ErrDocumentNotFound = errors.New("document not found")
+	// ErrReceiptNotAvailable is returned for orders that have not been paid
+	ErrReceiptNotAvailable = errors.New("a receipt is only available once the order is paid")
+)
+
+// pdfLinkExpiry is how long a download link stays valid
+const pdfLinkExpiry = 15 * time.Minute
+
+type pdfService struct {
+	pdfRepo            repository.PDFRepository
+	invoiceRepo        repository.InvoiceRepository
+	orderRepo          repository.OrderRepository
+	userRepo           repository.UserRepository
+	s3Service          *S3Service
+	productRepo        repository.ProductRepository
+	paymentAttemptRepo repository.PaymentAttemptRepository
+	storefrontRepo     *repository.StorefrontDataRepository
+	certificateRepo    repository.CertificateRepository
+}
+
+// NewPDFService creates a new PDF service. Without S3 the documents are
+// rendered on every request and returned inline.
+func NewPDFService(pdfRepo repository.PDFRepository, invoiceRepo repository.InvoiceRepository, orderRepo repository.OrderRepository, userRepo repository.UserRepository, s3Service *S3Service) PDFService {
+	return &pdfService{
+		pdfRepo:     pdfRepo,
+		invoiceRepo: invoiceRepo,
+		orderRepo:   orderRepo,
+		userRepo:    userRepo,
+		s3Service:   s3Service,
+	}
+}
+
+// SetStorefrontRepo enables the store's name, address and GSTIN on documents
+func (s *pdfService) SetStorefrontRepo(storefrontRepo *repository.StorefrontDataRepository) {
+	s.storefrontRepo = storefrontRepo
+}
+
+// SetProductRepository enables metal and weight details on documents
+func (s *pdfService) SetProductRepository(productRepo repository.ProductRepository) {
+	s.productRepo = productRepo
+}
+
+// SetPaymentAttemptRepository enables gateway transaction IDs on documents
+func (s *pdfService) SetPaymentAttemptRepository(paymentAttemptRepo repository.PaymentAttemptRepository) {
+	s.paymentAttemptRepo = paymentAttemptRepo
+}
+
+// SetCertificateRepository enables certificate of authenticity PDFs
+func (s *pdfService) SetCertificateRepository(certificateRepo repository.CertificateRepository) {
+	s.certificateRepo = certificateRepo
+}
+
+// GetInvoicePDF renders the GST tax invoice
+func (s *pdfService) GetInvoicePDF(ctx context.Context, invoiceID string, actor models.OrderActor) (*models.PDFDownload, error) {
+	objID, err := primitive.ObjectIDFromHex(invoiceID)
+	if err != nil {
+		return nil, ErrDocumentNotFound
+	}
+	invoice, err := s.invoiceRepo.GetByID(ctx, objID)
+	if err != nil || !invoice.IsOwnedBy(actor) {
+		return nil, ErrDocumentNotFound
+	}
+	order, err := s.orderRepo.GetByID(ctx, invoice.OrderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order: %w", err)
+	}
+
+	data, err := s.invoiceData(ctx, invoice, order)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := renderInvoice(data)
+	if err != nil {
+		return nil, err
+	}
+
+	download, err := s.store(ctx, doc, &models.PDFDocument{
+		Type:        models.PDFTypeInvoice,
+		OrderID:     order.ID,
+		ReferenceID: invoice.ID,
+		UserID:      order.UserID,
+		Filename:    fmt.Sprintf("invoice-%s.pdf", strings.ReplaceAll(invoice.InvoiceNumber, "/", "-")), // Numbers look like INV/25-26/000001
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if download.Document != nil && invoice.PDFUrl != download.Document.FileURL {
+		invoice.PDFUrl = download.Document.FileURL
+		if err := s.invoiceRepo.Update(ctx, invoice); err != nil {
+			fmt.Printf("Warning: failed to record PDF of invoice %s: %v\n", invoice.InvoiceNumber, err)
+		}
+	}
+	return download, nil
+}
+
+// GetReceiptPDF renders the payment receipt of a paid order
+func (s *pdfService) GetReceiptPDF(ctx context.Context, orderID string, actor models.OrderActor) (*models.PDFDownload, error) {
+	objID, err := primitive.ObjectIDFromHex(orderID)
+	if err != nil {
+		return nil, ErrDocumentNotFound
+	}
+	order, err := s.orderRepo.GetByID(ctx, objID)
+	if err != nil || !order.IsOwnedBy(actor) {
+		return nil, ErrDocumentNotFound
+	}
+	if order.PaymentStatus != models.PaymentStatusPaid && order.PaymentStatus != models.PaymentStatusRefunded {
+		return nil, ErrReceiptNotAvailable
+	}
+
+	data, err := s.invoiceData(ctx, &models.Invoice{}, order)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := renderReceipt(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.store(ctx, doc, &models.PDFDocument{
+		Type:        models.PDFTypeReceipt,
+		OrderID:     order.ID,
+		ReferenceID: order.ID,
+		UserID:      order.UserID,
+		Filename:    fmt.Sprintf("receipt-%s.pdf", order.OrderNumber),
+	})
+}
+
+// GetWarrantyCardPDF renders the warranty card of a warranty
+func (s *pdfService) GetWarrantyCardPDF(ctx context.Context, warrantyID string, actor models.OrderActor) (*models.PDFDownload, error) {
+	objID, err := primitive.ObjectIDFromHex(warrantyID)
+	if err != nil {
+		return nil, ErrDocumentNotFound
+	}
+	warranty, err := s.pdfRepo.GetWarrantyByID(ctx, objID)
+	if err != nil {
+		return nil, ErrDocumentNotFound
+	}
+	order, err := s.orderRepo.GetByID(ctx, warranty.OrderID)
+	if err != nil || !order.IsOwnedBy(actor) {
+		return nil, ErrDocumentNotFound
+	}
+
+	data := &warrantyCardData{
+		Warranty: *warranty,
+		Order:    *order,
+		Company:  s.companyInfo(ctx),
+	}
+	for _, item := range order.Items {
+		if item.ProductID == warranty.ProductID {
+			data.ProductName = item.Name
+			break
+		}
+	}
+	if product := s.product(ctx, warranty.ProductID); product != nil {
+		data.ProductName = product.Name
+		data.MetalType = product.MetalType
+		if product.Weight != nil {
+			data.Weight = *product.Weight
+		}
+	}
+	// Warranties issued on delivery keep the name the piece was sold under
+	if warranty.ProductName != "" {
+		data.ProductName = warranty.ProductName
+	}
+
+	doc, err := renderWarrantyCard(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.store(ctx, doc, &models.PDFDocument{
+		Type:        models.PDFTypeWarranty,
+		OrderID:     order.ID,
+		ReferenceID: warranty.ID,
+		UserID:      warranty.UserID,
+		Filename:    fmt.Sprintf("warranty-%s.pdf", warranty.WarrantyNumber),
+	})
+}
+
+// GetCertificatePDF renders a certificate of authenticity with a QR code
+// linking to its verification
+func (s *pdfService) GetCertificatePDF(ctx context.Context, certificateID string, actor models.OrderActor) (*models.PDFDownload, error) {
+	if s.certificateRepo == nil {
+		return nil, ErrDocumentNotFound
+	}
+	objID, err := primitive.ObjectIDFromHex(certificateID)
+	if err != nil {
+		return nil, ErrDocumentNotFound
+	}
+	certificate, err := s.certificateRepo.GetByID(ctx, objID)
+	if err != nil || !certificate.IsOwnedBy(actor) {
+		return nil, ErrDocumentNotFound
+	}
+
+	doc, err := renderCertificate(&certificateData{
+		Certificate: *certificate,
+		Company:     s.companyInfo(ctx),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.store(ctx, doc, &models.PDFDocument{
+		Type:        models.PDFTypeCertificate,
+		OrderID:     certificate.OrderID,
+		ReferenceID: certificate.ID,
+		UserID:      certificate.UserID,
+		Filename:    fmt.Sprintf("certificate-%s.pdf", certificate.CertificateNo),
+	})
+}
+
+// store uploads a rendered document unless an identical one is stored
+// already, and returns a presigned link to it. Without S3 the document is
+// returned inline.
+func (s *pdfService) store(ctx context.Context, doc *pdfWriter, record *models.PDFDocument) (*models.PDFDownload, error) {
+	content, err := doc.Bytes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to render PDF: %w", err)
+	}
+	if s.s3Service == nil || !s.s3Service.IsEnabled() {
+		return &models.PDFDownload{Filename: record.Filename, Content: content}, nil
+	}
+
+	fingerprint := doc.Fingerprint()
+	existing, err := s.pdfRepo.GetByReference(ctx, record.Type, record.ReferenceID)
+	if err != nil && !errors.Is(err, repository.ErrPDFDocumentNotFound) {
+		return nil, err
+	}
+
+	stored := existing
+	if existing == nil || existing.Fingerprint != fingerprint {
+		fileURL, err := s.s3Service.UploadBytes(ctx, content, record.Filename, "documents/"+record.Type)
+		if err != nil {
+			return nil, fmt.Errorf("failed to upload PDF: %w", err)
+		}
+		key, err := s.s3Service.KeyFromURL(fileURL)
+		if err != nil {
+			return nil, err
+		}
+
+		record.FileURL = fileURL
+		record.StorageKey = key
+		record.Fingerprint = fingerprint
+		record.Size = int64(len(content))
+		record.IsActive = true
+		if err := s.pdfRepo.Create(ctx, record); err != nil {
+			return nil, fmt.Errorf("failed to save PDF document: %w", err)
+		}
+
+		// The previous version no longer matches the invoice, order or warranty
+		if existing != nil {
+			existing.IsActive = false
+			if err := s.pdfRepo.Update(ctx, existing); err != nil {
+				fmt.Printf("Warning: failed to retire PDF document %s: %v\n", existing.ID.Hex(), err)
+			}
+		}
+		stored = record
+	}
+
+	link, err := s.s3Service.GeneratePresignedURL(ctx, stored.StorageKey, pdfLinkExpiry)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(pdfLinkExpiry)
+	stored.DownloadedAt = &now
+	if err := s.pdfRepo.Update(ctx, stored); err != nil {
+		fmt.Printf("Warning: failed to record download of PDF document %s: %v\n", stored.ID.Hex(), err)
+	}
+
+	return &models.PDFDownload{
+		Document:    stored,
+		DownloadURL: link,
+		ExpiresAt:   &expiresAt,
+		Filename:    stored.Filename,
+	}, nil
+}
+
+// invoiceData gathers what an invoice or receipt shows. Orders with a GST
+// breakdown get one line per goods and making charge component; older orders
+// only have a tax total.
+func (s *pdfService) invoiceData(ctx context.Context, invoice *models.Invoice, order *models.Order) (*models.InvoiceData, error) {
+	data := &models.InvoiceData{
+		Invoice: *invoice,
+		Order:   *order,
+		Company: s.companyInfo(ctx),
+		Notes:   invoice.Notes,
+		Totals: models.InvoiceTotals{
+			Subtotal:     order.Subtotal,
+			TaxAmount:    order.Tax,
+			ShippingCost: order.Shipping,
+			CODCharge:    order.CODCharge,
+			Discount:     order.Discount,
+			Total:        order.Total,
+		},
+	}
+
+	if !order.UserID.IsZero() {
+		if user, err := s.userRepo.GetByID(ctx, order.UserID); err == nil {
+			data.User = *user
+		}
+	}
+
+	if invoice.TaxDetails != nil {
+		data.TaxDetails = *invoice.TaxDetails
+	} else if order.TaxBreakdown != nil {
+		data.TaxDetails = order.TaxBreakdown.Details(data.Company.Address)
+	} else {
+		data.TaxDetails = models.TaxDetails{TaxType: "GST", TaxID: data.Company.TaxID, TaxAddress: data.Company.Address}
+	}
+
+	taxLines := invoice.TaxLines
+	if len(taxLines) == 0 && order.TaxBreakdown != nil {
+		taxLines = order.TaxBreakdown.Lines
+	}
+	for index, item := range order.Items {
+		base := models.InvoiceItem{
+			ProductID:   item.ProductID,
+			ProductName: item.Name,
+			Quantity:    item.Quantity,
+			UnitPrice:   item.Price,
+			HUIDs:       item.HUIDs(),
+		}
+		if product := s.product(ctx, item.ProductID); product != nil {
+			base.MetalType = product.MetalType
+			if product.StoneType != nil {
+				base.GemstoneType = *product.StoneType
+			}
+			if product.Weight != nil {
+				base.Weight = *product.Weight
+			}
+		}
+
+		lines := 0
+		for _, line := range taxLines {
+			if line.LineIndex != index {
+				continue
+			}
+			lines++
+			invoiceItem := base
+			invoiceItem.Description = line.Description
+			invoiceItem.HSNCode = line.HSNCode
+			invoiceItem.TaxableValue = line.TaxableValue
+			invoiceItem.TaxRate = line.Rate
+			invoiceItem.TaxAmount = line.Total
+			invoiceItem.CGST = line.CGST
+			invoiceItem.SGST = line.SGST
+			invoiceItem.IGST = line.IGST
+			invoiceItem.TotalPrice = line.TaxableValue + line.Total
+			data.Items = append(data.Items, invoiceItem)
+		}
+		if lines == 0 {
+			base.Description = item.Name
+			base.TotalPrice = item.Price * float64(item.Quantity)
+			base.TaxableValue = base.TotalPrice
+			data.Items = append(data.Items, base)
+		}
+	}
+
+	data.PaymentDetails = s.paymentInfo(ctx, order)
+
+	data.ShippingDetails = models.ShippingInfo{
+		Method:       "Standard",
+		ShippingCost: order.Shipping,
+		Address:      order.ShippingAddress,
+	}
+	if order.TrackingNumber != nil {
+		data.ShippingDetails.TrackingID = *order.TrackingNumber
+	}
+	if tracking, err := s.pdfRepo.GetOrderTracking(ctx, order.ID); err == nil && tracking.Status != models.TrackingStatusCancelled {
+		data.ShippingDetails.TrackingID = tracking.TrackingID
+		data.ShippingDetails.Carrier = tracking.CourierName
+		if data.ShippingDetails.Carrier == "" {
+			data.ShippingDetails.Carrier = tracking.Carrier
+		}
+		data.ShippingDetails.EstimatedDate = tracking.EstimatedDelivery
+		data.ShippingDetails.ActualDate = tracking.ActualDelivery
+	}
+
+	data.QRCode = invoiceQRPayload(data)
+	return data, nil
+}
+
+// paymentInfo describes how the order was paid, preferring the paid gateway attempt
+func (s *pdfService) paymentInfo(ctx context.Context, order *models.Order) models.PaymentInfo {
+	info := models.PaymentInfo{
+		Method:        order.GetDisplayPaymentMethod(),
+		PaymentStatus: order.GetDisplayPaymentStatus(),
+		Gateway:       string(order.PaymentMethod),
+		CurrencyCode:  "INR",
+		PaymentDate:   order.CreatedAt,
+	}
+	if order.RazorpayPaymentID != nil {
+		info.TransactionID = *order.RazorpayPaymentID
+	}
+
+	if s.paymentAttemptRepo != nil {
+		attempts, err := s.paymentAttemptRepo.GetByOrder(ctx, order.ID)
+		if err != nil {
+			fmt.Printf("Warning: failed to load payment attempts of order %s: %v\n", order.OrderNumber, err)
+		}
+		for _, attempt := range attempts {
+			if attempt.Status != models.PaymentAttemptPaid {
+				continue
+			}
+			info.Gateway = string(attempt.Gateway)
+			info.TransactionID = attempt.ProviderPaymentID
+			if attempt.PaidAt != nil {
+				info.PaymentDate = *attempt.PaidAt
+			}
+			break
+		}
+	}
+	return info
+}
+
+// companyInfo describes the store from its settings
+func (s *pdfService) companyInfo(ctx context.Context) models.CompanyInfo {
+	settings := models.DefaultStoreSettings()
+	if s.storefrontRepo != nil {
+		if loaded, err := s.storefrontRepo.GetStoreSettings(ctx); err == nil {
+			settings = loaded
+		} else {
+			fmt.Printf("Warning: failed to load store settings for documents: %v\n", err)
+		}
+	}
+
+	name := settings.StoreName
+	if name == "" {
+		name = models.DefaultStoreSettings().StoreName
+	}
+	return models.CompanyInfo{
+		Name:    name,
+		Address: settings.StoreAddress,
+		State:   settings.SupplyState(),
+		Country: "India",
+		Phone:   settings.StorePhone,
+		Email:   settings.StoreEmail,
+		TaxID:   settings.GSTNumber,
+	}
+}
+
+// product looks up a product for its metal and weight; documents render without them
+func (s *pdfService) product(ctx context.Context, productID primitive.ObjectID) *models.Product {
+	if s.productRepo == nil {
+		return nil
+	}
+	product, err := s.productRepo.GetByID(ctx, productID)
+	if err != nil {
+		return nil
+	}
+	return product
+}
+
+// invoiceQRPayload is what the QR code on an invoice or receipt encodes, so
+// the document can be checked against the store's records
+func invoiceQRPayload(data *models.InvoiceData) string {
+	lines := []string{}
+	if data.Invoice.InvoiceNumber != "" {
+		lines = append(lines, "Invoice: "+data.Invoice.InvoiceNumber, "Date: "+data.Invoice.InvoiceDate.Format("2006-01-02"))
+	}
+	if data.Company.TaxID != "" {
+		lines = append(lines, "GSTIN: "+data.Company.TaxID)
+	}
+	lines = append(lines,
+		"Order: "+data.Order.OrderNumber,
+		fmt.Sprintf("Amount: %.2f INR", data.Totals.Total),
+		fmt.Sprintf("GST: %.2f INR", data.Totals.TaxAmount),
+	)
+	if data.TaxDetails.HSNCode != "" {
+		lines = append(lines, "HSN: "+data.TaxDetails.HSNCode)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// warrantyCardData is what a warranty card shows
+type warrantyCardData struct {
+	Warranty    models.WarrantyInfo
+	Order       models.Order
+	Company     models.CompanyInfo
+	ProductName string
+	MetalType   string
+	Weight      float64
+}
+
+// certificateData is what a certificate of authenticity shows
+type certificateData struct {
+	Certificate models.Certificate
+	Company     models.CompanyInfo
+}
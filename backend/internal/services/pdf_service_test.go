@@ -0,0 +1,153 @@
+package services
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"thyne-jewels-backend/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestReedSolomonErrorCorrection(t *testing.T) {
+	// "HELLO WORLD" at version 1-M, from the QR code specification examples
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	if got := rsRemainder(data, rsDivisor(10)); !bytes.Equal(got, want) {
+		t.Fatalf("expected error correction %v, got %v", want, got)
+	}
+}
+
+func TestEncodeQR(t *testing.T) {
+	qr, err := encodeQR([]byte("Invoice: INV-2024-0001\nOrder: TJ-5001\nAmount: 10506.00 INR"))
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if (qr.size-17)%4 != 0 || qr.size < 21 {
+		t.Fatalf("unexpected symbol size %d", qr.size)
+	}
+	// Finder patterns have a dark ring around a light ring around a dark core
+	for _, corner := range [][2]int{{0, 0}, {0, qr.size - 7}, {qr.size - 7, 0}} {
+		row, col := corner[0], corner[1]
+		if !qr.modules[row][col] || qr.modules[row+1][col+1] || !qr.modules[row+3][col+3] {
+			t.Fatalf("finder pattern missing at %v", corner)
+		}
+	}
+	// The dark module always sits beside the bottom-left finder
+	if !qr.modules[qr.size-8][8] {
+		t.Fatal("expected the dark module")
+	}
+
+	if _, err := encodeQR(bytes.Repeat([]byte("x"), 400)); !errors.Is(err, ErrQRDataTooLong) {
+		t.Fatalf("expected oversized data to be refused, got %v", err)
+	}
+}
+
+func TestInvoicePDF(t *testing.T) {
+	productID := primitive.NewObjectID()
+	order := models.Order{
+		ID:              primitive.NewObjectID(),
+		OrderNumber:     "TJ-5001",
+		GuestSessionID:  "guest-1",
+		Items:           []models.OrderItem{{ProductID: productID, Name: "Gold Chain (22K)", Price: 10200, Quantity: 1}},
+		ShippingAddress: models.Address{RecipientName: "Asha Rao", Street: "12 MG Road", City: "Bengaluru", State: "Karnataka", Pincode: "560001"},
+		PaymentMethod:   models.PaymentMethodCOD,
+		PaymentStatus:   models.PaymentStatusPending,
+		Subtotal:        10200,
+		Tax:             306,
+		Total:           10506,
+		TaxBreakdown: &models.TaxBreakdown{
+			SupplierState: "Karnataka",
+			PlaceOfSupply: "Karnataka",
+			TaxableValue:  10200,
+			CGST:          153,
+			SGST:          153,
+			Total:         306,
+			Lines: []models.LineTax{
+				{LineIndex: 0, ProductID: productID, Description: "Gold Chain (22K) - goods", HSNCode: "7113", Quantity: 1, TaxableValue: 9000, Rate: 3, CGST: 135, SGST: 135, Total: 270},
+				{LineIndex: 0, ProductID: productID, Description: "Gold Chain (22K) - making charges", HSNCode: "9988", Quantity: 1, TaxableValue: 1200, Rate: 3, CGST: 18, SGST: 18, Total: 36},
+			},
+		},
+		CreatedAt: time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC),
+	}
+	invoice := models.Invoice{
+		ID:             primitive.NewObjectID(),
+		InvoiceNumber:  "INV/24-25/000001",
+		OrderID:        order.ID,
+		GuestSessionID: "guest-1",
+		InvoiceDate:    order.CreatedAt,
+	}
+	orderRepo := &memoryOrderRepository{orders: map[primitive.ObjectID]models.Order{order.ID: order}}
+	invoiceRepo := &memoryInvoiceRepository{invoices: map[primitive.ObjectID]models.Invoice{invoice.ID: invoice}}
+	trackingRepo := &memoryTrackingRepository{trackings: make(map[primitive.ObjectID]models.OrderTracking)}
+	svc := NewPDFService(trackingRepo, invoiceRepo, orderRepo, nil, &S3Service{})
+	guest := models.OrderActor{Type: models.OrderActorCustomer, ID: "guest-1"}
+
+	download, err := svc.GetInvoicePDF(context.Background(), invoice.ID.Hex(), guest)
+	if err != nil {
+		t.Fatalf("invoice PDF: %v", err)
+	}
+	if !bytes.HasPrefix(download.Content, []byte("%PDF-")) || download.Filename != "invoice-INV-24-25-000001.pdf" {
+		t.Fatalf("expected the PDF inline without S3, got %q", download.Filename)
+	}
+	page := pdfPageText(t, download.Content)
+	for _, want := range []string{"TAX INVOICE", "INV/24-25/000001", "TJ-5001", "7113", "9988", "CGST", "SGST", "Rs. 10,506.00", "Ten Thousand Five Hundred Six"} {
+		if !strings.Contains(page, want) {
+			t.Errorf("expected the invoice to show %q", want)
+		}
+	}
+
+	// Other customers are told the invoice does not exist
+	stranger := models.OrderActor{Type: models.OrderActorCustomer, ID: "guest-2"}
+	if _, err := svc.GetInvoicePDF(context.Background(), invoice.ID.Hex(), stranger); !errors.Is(err, ErrDocumentNotFound) {
+		t.Fatalf("expected another customer's invoice to be hidden, got %v", err)
+	}
+	// Receipts wait for the payment
+	if _, err := svc.GetReceiptPDF(context.Background(), order.ID.Hex(), guest); !errors.Is(err, ErrReceiptNotAvailable) {
+		t.Fatalf("expected no receipt for an unpaid order, got %v", err)
+	}
+}
+
+func TestFormatRupees(t *testing.T) {
+	cases := map[float64]string{
+		0:          "Rs. 0.00",
+		999.5:      "Rs. 999.50",
+		1000:       "Rs. 1,000.00",
+		123456.75:  "Rs. 1,23,456.75",
+		12345678.9: "Rs. 1,23,45,678.90",
+	}
+	for amount, want := range cases {
+		if got := formatRupees(amount); got != want {
+			t.Errorf("formatRupees(%v) = %q, want %q", amount, got, want)
+		}
+	}
+	if got := amountInWords(120050.5); got != "Rupees One Lakh Twenty Thousand Fifty and Fifty Paise Only" {
+		t.Errorf("unexpected amount in words %q", got)
+	}
+}
+
+// pdfPageText inflates the content streams of a PDF
+func pdfPageText(t *testing.T, content []byte) string {
+	t.Helper()
+	var text strings.Builder
+	streams := regexp.MustCompile(`(?s)stream\n(.*?)\nendstream`).FindAllSubmatch(content, -1)
+	for _, stream := range streams {
+		reader, err := zlib.NewReader(bytes.NewReader(stream[1]))
+		if err != nil {
+			t.Fatalf("inflate page: %v", err)
+		}
+		page, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("inflate page: %v", err)
+		}
+		text.Write(page)
+	}
+	return text.String()
+}
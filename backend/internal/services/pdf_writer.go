@@ -0,0 +1,245 @@
+package services
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// A4 page size in points
+const (
+	pdfPageWidth  = 595.28
+	pdfPageHeight = 841.89
+)
+
+// pdfWriter builds a PDF 1.4 document with the standard Helvetica fonts, so
+// documents need no font files or external tools. Coordinates are in points
+// from the top-left corner of the page.
+type pdfWriter struct {
+	title string
+	pages []*bytes.Buffer
+	page  *bytes.Buffer
+}
+
+// newPDFWriter creates a document with one empty page
+func newPDFWriter(title string) *pdfWriter {
+	w := &pdfWriter{title: title}
+	w.AddPage()
+	return w
+}
+
+// AddPage starts a new page
+func (w *pdfWriter) AddPage() {
+	w.page = &bytes.Buffer{}
+	w.pages = append(w.pages, w.page)
+}
+
+// Text draws a line of text with its baseline at y
+func (w *pdfWriter) Text(x, y, size float64, bold bool, text string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(w.page, "BT /%s %.2f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, pdfPageHeight-y, pdfEscape(text))
+}
+
+// TextRight draws text ending at x
+func (w *pdfWriter) TextRight(x, y, size float64, bold bool, text string) {
+	w.Text(x-pdfTextWidth(text, size, bold), y, size, bold, text)
+}
+
+// TextCentre draws text centred on x
+func (w *pdfWriter) TextCentre(x, y, size float64, bold bool, text string) {
+	w.Text(x-pdfTextWidth(text, size, bold)/2, y, size, bold, text)
+}
+
+// Paragraph draws text wrapped to width and returns the y below the last line
+func (w *pdfWriter) Paragraph(x, y, width, size float64, bold bool, text string) float64 {
+	for _, line := range pdfWrap(text, width, size, bold) {
+		w.Text(x, y, size, bold, line)
+		y += size * 1.35
+	}
+	return y
+}
+
+// Line draws a straight line
+func (w *pdfWriter) Line(x1, y1, x2, y2, width float64) {
+	fmt.Fprintf(w.page, "%.2f w %.2f %.2f m %.2f %.2f l S\n", width, x1, pdfPageHeight-y1, x2, pdfPageHeight-y2)
+}
+
+// Rect fills a rectangle with a grey level between 0 (black) and 1 (white)
+func (w *pdfWriter) Rect(x, y, width, height, gray float64) {
+	fmt.Fprintf(w.page, "%.3f g %.2f %.2f %.2f %.2f re f 0 g\n", gray, x, pdfPageHeight-y-height, width, height)
+}
+
+// QRCode draws data as a QR code of the given size, quiet zone included
+func (w *pdfWriter) QRCode(x, y, size float64, data string) error {
+	qr, err := encodeQR([]byte(data))
+	if err != nil {
+		return err
+	}
+	module := size / float64(qr.size+8)
+	for row := 0; row < qr.size; row++ {
+		for col := 0; col < qr.size; col++ {
+			if qr.modules[row][col] {
+				fmt.Fprintf(w.page, "%.3f %.3f %.3f %.3f re\n",
+					x+float64(col+4)*module, pdfPageHeight-y-float64(row+5)*module, module, module)
+			}
+		}
+	}
+	w.page.WriteString("f\n")
+	return nil
+}
+
+// Bytes serialises the document
+func (w *pdfWriter) Bytes() ([]byte, error) {
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// Objects 1-5 are fixed; each page then takes a page and a content object
+	kids := make([]string, len(w.pages))
+	for i := range w.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 6+i*2)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(w.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	object(fmt.Sprintf("<< /Title (%s) /Producer (Thyne Jewels) /CreationDate (D:%s) >>",
+		pdfEscape(w.title), time.Now().UTC().Format("20060102150405Z")))
+
+	for i, page := range w.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, 7+i*2))
+
+		var content bytes.Buffer
+		zw := zlib.NewWriter(&content)
+		if _, err := zw.Write(page.Bytes()); err != nil {
+			return nil, fmt.Errorf("failed to compress page: %w", err)
+		}
+		if err := zw.Close(); err != nil {
+			return nil, fmt.Errorf("failed to compress page: %w", err)
+		}
+		object(fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", content.Len(), content.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes(), nil
+}
+
+// Fingerprint hashes the page contents, which unlike the serialised file do
+// not carry a creation date
+func (w *pdfWriter) Fingerprint() string {
+	hash := sha256.New()
+	for _, page := range w.pages {
+		hash.Write(page.Bytes())
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// pdfEscape encodes text as a WinAnsi string literal; characters outside
+// Latin-1 become '?'. The rupee sign is written as "Rs." by callers.
+func pdfEscape(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n' || r == '\r' || r == '\t':
+			b.WriteByte(' ')
+		case r >= 32 && r < 127:
+			b.WriteRune(r)
+		case r >= 160 && r <= 255:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// pdfTextWidth measures text in points using the Helvetica metrics
+func pdfTextWidth(text string, size float64, bold bool) float64 {
+	widths := helveticaWidths
+	if bold {
+		widths = helveticaBoldWidths
+	}
+	total := 0
+	for _, r := range text {
+		if r >= 32 && r < 127 {
+			total += widths[r-32]
+		} else {
+			total += 556
+		}
+	}
+	return float64(total) * size / 1000
+}
+
+// pdfWrap breaks text into lines no wider than width
+func pdfWrap(text string, width, size float64, bold bool) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			candidate := word
+			if line != "" {
+				candidate = line + " " + word
+			}
+			if line != "" && pdfTextWidth(candidate, size, bold) > width {
+				lines = append(lines, line)
+				candidate = word
+			}
+			line = candidate
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// pdfTruncate shortens text to fit width, ending it with "..."
+func pdfTruncate(text string, width, size float64, bold bool) string {
+	if pdfTextWidth(text, size, bold) <= width {
+		return text
+	}
+	runes := []rune(text)
+	for len(runes) > 0 && pdfTextWidth(string(runes)+"...", size, bold) > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "..."
+}
+
+// Glyph widths of ASCII 32-126 in 1/1000 em, from the Adobe font metrics
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+var helveticaBoldWidths = [95]int{
+	278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+	975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+	333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+	611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+}
@@ -0,0 +1,183 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/repository"
+)
+
+// priceTolerance is the largest difference between a client-submitted unit
+// price and the server price that is still accepted as rounding noise
+const priceTolerance = 0.5
+
+// ErrPriceChanged is returned when a client-submitted price no longer matches the server price
+var ErrPriceChanged = errors.New("price has changed")
+
+// PricingService computes authoritative selling prices for products
+type PricingService interface {
+	PriceProduct(ctx context.Context, product *models.Product, customization *models.ProductCustomization) (*models.LinePrice, error)
+}
+
+type pricingService struct {
+	homepageRepo     repository.HomepageRepository
+	metalRateService MetalRateService
+}
+
+// NewPricingService creates a new pricing service. homepageRepo may be nil,
+// in which case deals and flash sales are not applied.
+func NewPricingService(homepageRepo repository.HomepageRepository) PricingService {
+	return &pricingService{homepageRepo: homepageRepo}
+}
+
+// SetMetalRateService sets the live rates metal_rate products are priced from.
+// Without it they sell at their stored price.
+func (s *pricingService) SetMetalRateService(metalRateService MetalRateService) {
+	s.metalRateService = metalRateService
+}
+
+// PriceProduct validates the customization and returns the unit price after
+// customization modifiers and the best active promotion for the product
+func (s *pricingService) PriceProduct(ctx context.Context, product *models.Product, customization *models.ProductCustomization) (*models.LinePrice, error) {
+	if err := product.ValidateCustomization(customization); err != nil {
+		return nil, err
+	}
+
+	customizationPrice := product.CalculateCustomizationPrice(customization)
+	basePrice := product.Price
+
+	// A variant's own price covers its options; other choices are added on top
+	var variant *models.ProductVariant
+	if product.HasVariants() {
+		variant = product.MatchVariant(customization)
+	}
+	variantPriced := variant != nil && variant.Price != nil && !product.IsRatePriced()
+	if variantPriced {
+		basePrice = *variant.Price
+		customizationPrice = product.CalculateCustomizationPrice(variant.Extras(customization))
+	}
+
+	var quote *models.MetalRateQuote
+	if product.IsRatePriced() && s.metalRateService != nil {
+		var metalPicked bool
+		quote, metalPicked = s.quoteMetalRate(ctx, product, variant, customization)
+		if quote != nil {
+			basePrice = quote.Price
+			if metalPicked {
+				// The rate already prices the chosen metal
+				customizationPrice -= product.MetalPriceModifiers[customization.Metal]
+			}
+		}
+	}
+	regular := basePrice + customizationPrice
+
+	original := regular
+	if !product.IsRatePriced() && !variantPriced && product.OriginalPrice != nil && *product.OriginalPrice > product.Price {
+		original = *product.OriginalPrice + customizationPrice
+	}
+
+	price := &models.LinePrice{
+		BasePrice:          basePrice,
+		CustomizationPrice: customizationPrice,
+		OriginalPrice:      roundPrice(original),
+		UnitPrice:          roundPrice(regular),
+		Source:             models.PriceSourceRegular,
+		MetalRate:          quote,
+	}
+
+	if s.homepageRepo != nil {
+		s.applyPromotions(ctx, product, price)
+	}
+
+	if price.IsDiscounted() && price.OriginalPrice > 0 {
+		price.DiscountPercent = int(math.Round((price.OriginalPrice - price.UnitPrice) / price.OriginalPrice * 100))
+	}
+
+	if quote != nil {
+		price.MakingCharge = math.Min(quote.MakingCharge, price.UnitPrice)
+	} else {
+		price.MakingCharge = makingChargeFor(product, price.UnitPrice)
+	}
+
+	return price, nil
+}
+
+// quoteMetalRate prices a metal_rate product from the live rate of its metal,
+// or of the metal the customer picked when that has a rate of its own, and
+// reports which. A variant with a weight of its own is priced at that weight.
+// It returns nil, and the stored price is used, when the rate cannot be loaded.
+func (s *pricingService) quoteMetalRate(ctx context.Context, product *models.Product, variant *models.ProductVariant, customization *models.ProductCustomization) (*models.MetalRateQuote, bool) {
+	weight := *product.WeightPricing
+	if variant != nil && variant.Weight != nil && *variant.Weight > 0 {
+		weight.NetWeight = *variant.Weight
+	}
+
+	metalPicked := false
+	if customization != nil && customization.Metal != "" {
+		if code := models.MetalCodeFor(customization.Metal); code != "" {
+			if _, err := s.metalRateService.GetRate(ctx, code); err == nil {
+				weight.MetalCode = code
+				metalPicked = true
+			}
+		}
+	}
+
+	rate, err := s.metalRateService.GetRate(ctx, weight.MetalCode)
+	if err != nil {
+		fmt.Printf("Warning: failed to load metal rate for product %s: %v\n", product.ID.Hex(), err)
+		return nil, false
+	}
+
+	quote := weight.Quote(rate.RatePerGram)
+	return &quote, metalPicked
+}
+
+// applyPromotions lowers the unit price to the best live deal of the day or flash sale.
+// Lookup failures are logged and the regular price is kept.
+func (s *pricingService) applyPromotions(ctx context.Context, product *models.Product, price *models.LinePrice) {
+	deal, err := s.homepageRepo.GetActiveDealOfDay(ctx)
+	if err != nil {
+		fmt.Printf("Warning: failed to load deal of the day: %v\n", err)
+	} else if deal != nil && deal.ProductID == product.ID && deal.IsLive() {
+		dealPrice := roundPrice(deal.DealPrice + price.CustomizationPrice)
+		if dealPrice < price.UnitPrice {
+			dealID := deal.ID
+			price.UnitPrice = dealPrice
+			price.Source = models.PriceSourceDealOfDay
+			price.DealID = &dealID
+		}
+	}
+
+	sales, err := s.homepageRepo.GetActiveFlashSales(ctx)
+	if err != nil {
+		fmt.Printf("Warning: failed to load flash sales: %v\n", err)
+		return
+	}
+
+	regular := price.BasePrice + price.CustomizationPrice
+	for _, sale := range sales {
+		if !sale.IsLive() || sale.Discount <= 0 || sale.Discount >= 100 {
+			continue
+		}
+		for _, productID := range sale.ProductIDs {
+			if productID != product.ID {
+				continue
+			}
+			salePrice := roundPrice(regular * float64(100-sale.Discount) / 100)
+			if salePrice < price.UnitPrice {
+				price.UnitPrice = salePrice
+				price.Source = models.PriceSourceFlashSale
+				price.DealID = nil
+			}
+			break
+		}
+	}
+}
+
+// roundPrice rounds an amount to paise
+func roundPrice(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
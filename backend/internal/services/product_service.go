@@ -2,6 +2,8 @@ package services
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
 	"thyne-jewels-backend/internal/models"
@@ -19,7 +21,7 @@ type ProductService interface {
 	CreateProduct(ctx context.Context, req *models.CreateProductRequest) (*models.Product, error)
 	UpdateProduct(ctx context.Context, id string, req *models.UpdateProductRequest) (*models.Product, error)
 	DeleteProduct(ctx context.Context, id string) error
-	UpdateProductStock(ctx context.Context, id string, quantity int, reason string) error
+	UpdateProductStock(ctx context.Context, id string, quantity int, reason string, actor models.OrderActor) error
 	GetProductStatistics(ctx context.Context) (*models.ProductStatistics, error)
 	GetRecentProducts(ctx context.Context, limit int) ([]models.Product, error)
 	ExportProducts(ctx context.Context, format string, filters map[string]interface{}) (string, error)
@@ -29,8 +31,8 @@ type ProductService interface {
 type productService struct {
 	productRepo        repository.ProductRepository
 	reviewRepo         repository.ReviewRepository
-	notificationService *NotificationService
-	wishlistRepo       repository.WishlistRepository
+	metalRateService   MetalRateService
+	stockService       StockService
 }
 
 func NewProductService(productRepo repository.ProductRepository, reviewRepo repository.ReviewRepository) ProductService {
@@ -40,12 +42,14 @@ func NewProductService(productRepo repository.ProductRepository, reviewRepo repo
 	}
 }
 
-func (s *productService) SetNotificationService(notificationService *NotificationService) {
-	s.notificationService = notificationService
+// SetMetalRateService sets the live rates metal_rate products are priced from
+func (s *productService) SetMetalRateService(metalRateService MetalRateService) {
+	s.metalRateService = metalRateService
 }
 
-func (s *productService) SetWishlistRepository(wishlistRepo repository.WishlistRepository) {
-	s.wishlistRepo = wishlistRepo
+// SetStockService sets the ledger stock changes made through products are recorded in
+func (s *productService) SetStockService(stockService StockService) {
+	s.stockService = stockService
 }
 
 func (s *productService) GetProducts(filter models.ProductFilter) ([]models.Product, int64, error) {
@@ -92,9 +96,14 @@ func (s *productService) CreateProduct(ctx context.Context, req *models.CreatePr
 		MetalType:      req.MetalType,
 		StoneType:      req.StoneType,
 		Weight:         req.Weight,
+		MakingCharge:   req.MakingCharge,
+		PricingMode:    req.PricingMode,
+		WeightPricing:  req.WeightPricing,
 		Size:           req.Size,
+		Gemstones:      req.Gemstones,
 		StockType:      stockType,
 		StockQuantity:  req.StockQuantity,
+		ReorderLevel:   req.ReorderLevel,
 		Rating:         0.0,
 		ReviewCount:    0,
 		Tags:           req.Tags,
@@ -122,11 +131,22 @@ func (s *productService) CreateProduct(ctx context.Context, req *models.CreatePr
 		UpdatedAt:              time.Now(),
 	}
 
+	if err := s.applyMetalRate(ctx, product); err != nil {
+		return nil, err
+	}
+	if err := applyVariants(product, req.Variants); err != nil {
+		return nil, err
+	}
+
 	err := s.productRepo.Create(ctx, product)
 	if err != nil {
 		return nil, err
 	}
 
+	if s.stockService != nil {
+		s.stockService.RecordOpeningStock(ctx, product, "", staffActor)
+	}
+
 	return product, nil
 }
 
@@ -173,14 +193,35 @@ func (s *productService) UpdateProduct(ctx context.Context, id string, req *mode
 	if req.Weight != nil {
 		existingProduct.Weight = req.Weight
 	}
+	if req.MakingCharge != nil {
+		existingProduct.MakingCharge = req.MakingCharge
+	}
+	if req.PricingMode != nil {
+		existingProduct.PricingMode = *req.PricingMode
+	}
+	if req.WeightPricing != nil {
+		existingProduct.WeightPricing = req.WeightPricing
+	}
 	if req.Size != nil {
 		existingProduct.Size = req.Size
 	}
+	if req.Gemstones != nil {
+		existingProduct.Gemstones = req.Gemstones
+	}
 	if req.StockType != nil {
 		existingProduct.StockType = *req.StockType
 	}
 	if req.StockQuantity != nil {
-		existingProduct.StockQuantity = *req.StockQuantity
+		if existingProduct.HasVariants() {
+			return nil, fmt.Errorf("%w: stock of %s is set per variant", ErrInvalidVariant, existingProduct.Name)
+		}
+		// Stock is only set, and recorded, through the stock service after the update
+		if s.stockService == nil {
+			return nil, errors.New("stock service is not configured")
+		}
+	}
+	if req.ReorderLevel != nil {
+		existingProduct.ReorderLevel = req.ReorderLevel
 	}
 	if req.Tags != nil {
 		existingProduct.Tags = req.Tags
@@ -240,11 +281,22 @@ func (s *productService) UpdateProduct(ctx context.Context, id string, req *mode
 	}
 	existingProduct.UpdatedAt = time.Now()
 
+	if err := s.applyMetalRate(ctx, existingProduct); err != nil {
+		return nil, err
+	}
+
 	err = s.productRepo.Update(ctx, existingProduct)
 	if err != nil {
 		return nil, err
 	}
 
+	if req.StockQuantity != nil && s.stockService != nil {
+		if _, err := s.stockService.SetStock(ctx, existingProduct, nil, *req.StockQuantity, "Product updated", staffActor); err != nil {
+			return nil, err
+		}
+		existingProduct.StockQuantity = *req.StockQuantity
+	}
+
 	return existingProduct, nil
 }
 
@@ -257,7 +309,10 @@ func (s *productService) DeleteProduct(ctx context.Context, id string) error {
 	return s.productRepo.Delete(ctx, objectID)
 }
 
-func (s *productService) UpdateProductStock(ctx context.Context, id string, quantity int, reason string) error {
+// UpdateProductStock sets a product's counted stock. With the ledger the
+// difference is recorded as an adjustment by the actor, and a product brought
+// back into stock alerts its back-in-stock subscribers.
+func (s *productService) UpdateProductStock(ctx context.Context, id string, quantity int, reason string, actor models.OrderActor) error {
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return err
@@ -269,36 +324,15 @@ func (s *productService) UpdateProductStock(ctx context.Context, id string, quan
 		return err
 	}
 
-	// Check if product was out of stock and is now back in stock
-	wasOutOfStock := product.StockQuantity == 0
-	isBackInStock := quantity > 0
-
-	// Update stock quantity
-	product.StockQuantity = quantity
-	product.UpdatedAt = time.Now()
-
-	err = s.productRepo.Update(ctx, product)
-	if err != nil {
-		return err
+	if product.HasVariants() {
+		return fmt.Errorf("%w: stock of %s is set per variant", ErrInvalidVariant, product.Name)
 	}
 
-	// Send back-in-stock notifications if product was out of stock and is now available
-	if wasOutOfStock && isBackInStock && s.notificationService != nil && s.wishlistRepo != nil {
-		go func() {
-			// Get all users who have this product in their wishlist
-			wishlistItems, err := s.wishlistRepo.GetWishlistItemsByProduct(ctx, objectID)
-			if err != nil {
-				return
-			}
-
-			// Send notifications to all users who have this product in their wishlist
-			for _, item := range wishlistItems {
-				if err := s.notificationService.SendBackInStockNotification(ctx, item.UserID, product.Name, product.ID.Hex()); err != nil {
-					// Log error but continue processing other users
-					_ = err
-				}
-			}
-		}()
+	if s.stockService == nil {
+		return errors.New("stock service is not configured")
+	}
+	if _, err := s.stockService.SetStock(ctx, product, nil, quantity, reason, actor); err != nil {
+		return err
 	}
 
 	return nil
@@ -325,6 +359,8 @@ func (s *productService) ExportProducts(ctx context.Context, format string, filt
 func (s *productService) BulkCreateProducts(ctx context.Context, products []models.CreateProductRequest) ([]models.Product, []models.BulkCreateError, error) {
 	var createdProducts []models.Product
 	var failedProducts []models.BulkCreateError
+	// The upload's opening stock is recorded in the ledger under one batch reference
+	batch := "BULK-" + time.Now().Format("20060102-150405")
 
 	for i, productReq := range products {
 		// Validate the product request
@@ -356,9 +392,14 @@ func (s *productService) BulkCreateProducts(ctx context.Context, products []mode
 			MetalType:     productReq.MetalType,
 			StoneType:     productReq.StoneType,
 			Weight:        productReq.Weight,
+			MakingCharge:  productReq.MakingCharge,
+			PricingMode:   productReq.PricingMode,
+			WeightPricing: productReq.WeightPricing,
 			Size:          productReq.Size,
+			Gemstones:     productReq.Gemstones,
 			StockType:     stockType,
 			StockQuantity: productReq.StockQuantity,
+			ReorderLevel:  productReq.ReorderLevel,
 			Tags:          productReq.Tags,
 			Gender:        productReq.Gender,
 			IsAvailable:   productReq.IsAvailable,
@@ -386,6 +427,23 @@ func (s *productService) BulkCreateProducts(ctx context.Context, products []mode
 			UpdatedAt:              time.Now(),
 		}
 
+		if err := s.applyMetalRate(ctx, product); err != nil {
+			failedProducts = append(failedProducts, models.BulkCreateError{
+				Index:   i,
+				Product: productReq,
+				Error:   err.Error(),
+			})
+			continue
+		}
+		if err := applyVariants(product, productReq.Variants); err != nil {
+			failedProducts = append(failedProducts, models.BulkCreateError{
+				Index:   i,
+				Product: productReq,
+				Error:   err.Error(),
+			})
+			continue
+		}
+
 		// Attempt to create the product in the database
 		err := s.productRepo.Create(ctx, product)
 		if err != nil {
@@ -397,8 +455,66 @@ func (s *productService) BulkCreateProducts(ctx context.Context, products []mode
 			continue
 		}
 
+		if s.stockService != nil {
+			s.stockService.RecordOpeningStock(ctx, product, batch, staffActor)
+		}
+
 		createdProducts = append(createdProducts, *product)
 	}
 
 	return createdProducts, failedProducts, nil
 }
+
+// applyVariants sets up the variants a new product is created with. A product
+// sold by variant holds the total of their stock.
+func applyVariants(product *models.Product, reqs []models.CreateVariantRequest) error {
+	if len(reqs) == 0 {
+		return nil
+	}
+
+	variants, err := buildVariants(product, reqs)
+	if err != nil {
+		return err
+	}
+	product.Variants = variants
+	product.StockQuantity = product.VariantStock()
+	return nil
+}
+
+// applyMetalRate checks a product's pricing mode and, for metal_rate products,
+// sets the stored price and making charge from the live rate of its metal so
+// listings, price filters and sorting see the current price
+func (s *productService) applyMetalRate(ctx context.Context, product *models.Product) error {
+	switch product.PricingMode {
+	case "":
+		product.PricingMode = models.PricingModeFixed
+		return nil
+	case models.PricingModeFixed:
+		return nil
+	case models.PricingModeMetalRate:
+	default:
+		return fmt.Errorf("%w: pricing mode must be fixed or metal_rate", models.ErrInvalidWeightPricing)
+	}
+
+	if product.WeightPricing == nil {
+		return fmt.Errorf("%w: weightPricing is required for metal_rate pricing", models.ErrInvalidWeightPricing)
+	}
+	product.WeightPricing.MetalCode = models.NormalizeMetalCode(product.WeightPricing.MetalCode)
+	if err := product.WeightPricing.Validate(); err != nil {
+		return err
+	}
+	if s.metalRateService == nil {
+		return nil
+	}
+
+	rate, err := s.metalRateService.GetRate(ctx, product.WeightPricing.MetalCode)
+	if err != nil {
+		return err
+	}
+	quote := product.WeightPricing.Quote(rate.RatePerGram)
+	product.Price = quote.Price
+	product.MakingCharge = &quote.MakingCharge
+	// A fixed compare-at price would drift from the live price
+	product.OriginalPrice = nil
+	return nil
+}
@@ -0,0 +1,445 @@
+package services
+
+import (
+	"errors"
+)
+
+// ErrQRDataTooLong is returned when a payload does not fit the largest
+// supported QR code
+var ErrQRDataTooLong = errors.New("data too long for a QR code")
+
+// qrVersion describes the codeword layout of a QR code version at error
+// correction level M
+type qrVersion struct {
+	codewords    int   // Data and error correction codewords
+	blocks       int   // Error correction blocks
+	eccPerBlock  int   // Error correction codewords per block
+	alignment    []int // Alignment pattern centres
+	remainderLen int   // Remainder bits after the last codeword
+}
+
+// qrVersions covers versions 1 to 10 at level M, enough for about 210 bytes
+var qrVersions = []qrVersion{
+	{26, 1, 10, nil, 0},
+	{44, 1, 16, []int{6, 18}, 7},
+	{70, 1, 26, []int{6, 22}, 7},
+	{100, 2, 18, []int{6, 26}, 7},
+	{134, 2, 24, []int{6, 30}, 7},
+	{172, 4, 16, []int{6, 34}, 7},
+	{196, 4, 18, []int{6, 22, 38}, 0},
+	{242, 4, 22, []int{6, 24, 42}, 0},
+	{292, 5, 22, []int{6, 26, 46}, 0},
+	{346, 5, 26, []int{6, 28, 50}, 0},
+}
+
+// qrCode is an encoded QR code; modules[y][x] is true for a dark module
+type qrCode struct {
+	size     int
+	modules  [][]bool
+	function [][]bool // Finder, timing, alignment and format modules
+}
+
+// encodeQR encodes data in byte mode at error correction level M, choosing
+// the smallest version that fits and the mask with the lowest penalty
+func encodeQR(data []byte) (*qrCode, error) {
+	version := 0
+	for v := range qrVersions {
+		countBits := 8
+		if v+1 >= 10 {
+			countBits = 16
+		}
+		if 4+countBits+8*len(data) <= qrDataCodewords(v+1)*8 {
+			version = v + 1
+			break
+		}
+	}
+	if version == 0 {
+		return nil, ErrQRDataTooLong
+	}
+
+	codewords := qrAddECC(version, qrDataStream(version, data))
+
+	size := 17 + 4*version
+	qr := &qrCode{size: size, modules: make([][]bool, size), function: make([][]bool, size)}
+	for i := range qr.modules {
+		qr.modules[i] = make([]bool, size)
+		qr.function[i] = make([]bool, size)
+	}
+	qr.drawFunctionPatterns(version)
+	qr.drawCodewords(codewords)
+
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		qr.applyMask(mask)
+		qr.drawFormatBits(mask)
+		if penalty := qr.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			best, bestPenalty = mask, penalty
+		}
+		qr.applyMask(mask) // Masks are their own inverse
+	}
+	qr.applyMask(best)
+	qr.drawFormatBits(best)
+	return qr, nil
+}
+
+// qrDataCodewords returns how many data codewords a version holds
+func qrDataCodewords(version int) int {
+	v := qrVersions[version-1]
+	return v.codewords - v.blocks*v.eccPerBlock
+}
+
+// qrDataStream builds the padded data codewords for a byte mode segment
+func qrDataStream(version int, data []byte) []byte {
+	capacity := qrDataCodewords(version) * 8
+	var bits []bool
+	appendBits := func(value, length int) {
+		for i := length - 1; i >= 0; i-- {
+			bits = append(bits, (value>>i)&1 == 1)
+		}
+	}
+
+	countBits := 8
+	if version >= 10 {
+		countBits = 16
+	}
+	appendBits(0x4, 4) // Byte mode
+	appendBits(len(data), countBits)
+	for _, b := range data {
+		appendBits(int(b), 8)
+	}
+
+	// Terminator, then pad to a whole byte
+	terminator := capacity - len(bits)
+	if terminator > 4 {
+		terminator = 4
+	}
+	appendBits(0, terminator)
+	appendBits(0, (8-len(bits)%8)%8)
+
+	codewords := make([]byte, 0, capacity/8)
+	for i := 0; i < len(bits); i += 8 {
+		var b byte
+		for j := 0; j < 8; j++ {
+			if bits[i+j] {
+				b |= 1 << (7 - j)
+			}
+		}
+		codewords = append(codewords, b)
+	}
+	for pad := byte(0xEC); len(codewords) < capacity/8; pad ^= 0xEC ^ 0x11 {
+		codewords = append(codewords, pad)
+	}
+	return codewords
+}
+
+// qrAddECC splits the data into blocks, adds Reed-Solomon error correction to
+// each and interleaves the result
+func qrAddECC(version int, data []byte) []byte {
+	v := qrVersions[version-1]
+	shortBlocks := v.blocks - v.codewords%v.blocks
+	shortLen := v.codewords / v.blocks
+	divisor := rsDivisor(v.eccPerBlock)
+
+	blocks := make([][]byte, 0, v.blocks)
+	offset := 0
+	for i := 0; i < v.blocks; i++ {
+		dataLen := shortLen - v.eccPerBlock
+		if i >= shortBlocks {
+			dataLen++
+		}
+		block := append([]byte(nil), data[offset:offset+dataLen]...)
+		offset += dataLen
+		ecc := rsRemainder(block, divisor)
+		if i < shortBlocks {
+			block = append(block, 0) // Placeholder so all blocks line up
+		}
+		blocks = append(blocks, append(block, ecc...))
+	}
+
+	result := make([]byte, 0, v.codewords)
+	for i := range blocks[0] {
+		for j, block := range blocks {
+			if i != shortLen-v.eccPerBlock || j >= shortBlocks {
+				result = append(result, block[i])
+			}
+		}
+	}
+	return result
+}
+
+// rsDivisor returns the Reed-Solomon generator polynomial of the given degree
+func rsDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = gfMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+	return result
+}
+
+// rsRemainder returns the error correction codewords for data
+func rsRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, coef := range divisor {
+			result[i] ^= gfMultiply(coef, factor)
+		}
+	}
+	return result
+}
+
+// gfMultiply multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1
+func gfMultiply(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>i)&1) * int(x)
+	}
+	return byte(z)
+}
+
+func (qr *qrCode) setFunction(x, y int, dark bool) {
+	qr.modules[y][x] = dark
+	qr.function[y][x] = true
+}
+
+// drawFunctionPatterns draws the timing, finder and alignment patterns and
+// the version information, and reserves the format information modules
+func (qr *qrCode) drawFunctionPatterns(version int) {
+	for i := 0; i < qr.size; i++ {
+		qr.setFunction(6, i, i%2 == 0)
+		qr.setFunction(i, 6, i%2 == 0)
+	}
+
+	for _, centre := range [][2]int{{3, 3}, {qr.size - 4, 3}, {3, qr.size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := centre[0]+dx, centre[1]+dy
+				if x >= 0 && x < qr.size && y >= 0 && y < qr.size {
+					dist := qrMax(qrAbs(dx), qrAbs(dy))
+					qr.setFunction(x, y, dist != 2 && dist != 4)
+				}
+			}
+		}
+	}
+
+	positions := qrVersions[version-1].alignment
+	last := len(positions) - 1
+	for i, x := range positions {
+		for j, y := range positions {
+			// Skip the corners taken by finder patterns
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					qr.setFunction(x+dx, y+dy, qrMax(qrAbs(dx), qrAbs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	qr.drawFormatBits(0)
+
+	if version >= 7 {
+		rem := version
+		for i := 0; i < 12; i++ {
+			rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+		}
+		bits := version<<12 | rem
+		for i := 0; i < 18; i++ {
+			dark := (bits>>i)&1 == 1
+			a, b := qr.size-11+i%3, i/3
+			qr.setFunction(a, b, dark)
+			qr.setFunction(b, a, dark)
+		}
+	}
+}
+
+// drawFormatBits draws both copies of the format information for level M
+// and the given mask
+func (qr *qrCode) drawFormatBits(mask int) {
+	data := mask // Level M is 00
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return (bits>>i)&1 == 1 }
+
+	for i := 0; i <= 5; i++ {
+		qr.setFunction(8, i, bit(i))
+	}
+	qr.setFunction(8, 7, bit(6))
+	qr.setFunction(8, 8, bit(7))
+	qr.setFunction(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		qr.setFunction(14-i, 8, bit(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		qr.setFunction(qr.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		qr.setFunction(8, qr.size-15+i, bit(i))
+	}
+	qr.setFunction(8, qr.size-8, true) // Always dark
+}
+
+// drawCodewords places the codewords in the zigzag order, skipping function modules
+func (qr *qrCode) drawCodewords(codewords []byte) {
+	i := 0
+	for right := qr.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < qr.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = qr.size - 1 - vert
+				}
+				if !qr.function[y][x] && i < len(codewords)*8 {
+					qr.modules[y][x] = (codewords[i>>3]>>(7-i&7))&1 == 1
+					i++
+				}
+			}
+		}
+	}
+}
+
+// applyMask flips the data modules selected by the mask pattern
+func (qr *qrCode) applyMask(mask int) {
+	for y := 0; y < qr.size; y++ {
+		for x := 0; x < qr.size; x++ {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !qr.function[y][x] {
+				qr.modules[y][x] = !qr.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores the symbol by the rules of ISO/IEC 18004 section 7.8.3
+func (qr *qrCode) penalty() int {
+	penalty := 0
+	dark := 0
+	finderLike := []bool{true, false, true, true, true, false, true}
+
+	for i := 0; i < qr.size; i++ {
+		for _, vertical := range []bool{false, true} {
+			at := func(j int) bool {
+				if vertical {
+					return qr.modules[j][i]
+				}
+				return qr.modules[i][j]
+			}
+
+			// Runs of five or more modules of one colour
+			run := 1
+			for j := 1; j < qr.size; j++ {
+				if at(j) == at(j-1) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					penalty += run - 2
+				}
+				run = 1
+			}
+			if run >= 5 {
+				penalty += run - 2
+			}
+
+			// Finder-like patterns with four light modules on either side
+			for j := 0; j+7 <= qr.size; j++ {
+				match := true
+				for k, want := range finderLike {
+					if at(j+k) != want {
+						match = false
+						break
+					}
+				}
+				if !match {
+					continue
+				}
+				before, after := true, true
+				for k := 1; k <= 4; k++ {
+					if j-k >= 0 && at(j-k) {
+						before = false
+					}
+					if j+6+k < qr.size && at(j+6+k) {
+						after = false
+					}
+				}
+				if before || after {
+					penalty += 40
+				}
+			}
+		}
+	}
+
+	for y := 0; y < qr.size; y++ {
+		for x := 0; x < qr.size; x++ {
+			if qr.modules[y][x] {
+				dark++
+			}
+			// 2x2 blocks of one colour
+			if x+1 < qr.size && y+1 < qr.size {
+				c := qr.modules[y][x]
+				if c == qr.modules[y][x+1] && c == qr.modules[y+1][x] && c == qr.modules[y+1][x+1] {
+					penalty += 3
+				}
+			}
+		}
+	}
+
+	// Balance of dark and light modules
+	total := qr.size * qr.size
+	deviation := qrAbs(dark*20 - total*10)
+	penalty += deviation / total * 10
+	return penalty
+}
+
+func qrAbs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func qrMax(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
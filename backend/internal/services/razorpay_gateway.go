@@ -0,0 +1,476 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"thyne-jewels-backend/internal/config"
+	"thyne-jewels-backend/internal/models"
+)
+
+// ErrInvalidPaymentSignature is returned when a checkout or webhook signature does not verify
+var ErrInvalidPaymentSignature = errors.New("invalid payment signature")
+
+// RazorpayOrderRequest is the body of a Razorpay Orders API create call. Amounts are in paise.
+type RazorpayOrderRequest struct {
+	Amount   int64             `json:"amount"`
+	Currency string            `json:"currency"`
+	Receipt  string            `json:"receipt"`
+	Notes    map[string]string `json:"notes,omitempty"`
+}
+
+// RazorpayOrder is an order entity returned by the Razorpay API
+type RazorpayOrder struct {
+	ID         string            `json:"id"`
+	Entity     string            `json:"entity"`
+	Amount     int64             `json:"amount"`
+	AmountPaid int64             `json:"amount_paid"`
+	AmountDue  int64             `json:"amount_due"`
+	Currency   string            `json:"currency"`
+	Receipt    string            `json:"receipt"`
+	Status     string            `json:"status"` // created, attempted or paid
+	Attempts   int               `json:"attempts"`
+	Notes      map[string]string `json:"notes"`
+	CreatedAt  int64             `json:"created_at"`
+}
+
+// RazorpayPayment is a payment entity returned by the Razorpay API
+type RazorpayPayment struct {
+	ID               string            `json:"id"`
+	Entity           string            `json:"entity"`
+	Amount           int64             `json:"amount"`
+	Currency         string            `json:"currency"`
+	Status           string            `json:"status"` // created, authorized, captured, refunded or failed
+	OrderID          string            `json:"order_id"`
+	Method           string            `json:"method"`
+	Captured         bool              `json:"captured"`
+	AmountRefunded   int64             `json:"amount_refunded"`
+	ErrorCode        string            `json:"error_code,omitempty"`
+	ErrorDescription string            `json:"error_description,omitempty"`
+	Notes            map[string]string `json:"notes"`
+	CreatedAt        int64             `json:"created_at"`
+}
+
+// RazorpayRefund is a refund entity returned by the Razorpay API
+type RazorpayRefund struct {
+	ID        string            `json:"id"`
+	Entity    string            `json:"entity"`
+	Amount    int64             `json:"amount"`
+	Currency  string            `json:"currency"`
+	PaymentID string            `json:"payment_id"`
+	Receipt   string            `json:"receipt"`
+	Status    string            `json:"status"` // pending, processed or failed
+	Notes     map[string]string `json:"notes"`
+	CreatedAt int64             `json:"created_at"`
+}
+
+// RazorpayPaymentLink is a payment link entity returned by the Razorpay API
+type RazorpayPaymentLink struct {
+	ID          string            `json:"id"`
+	Amount      int64             `json:"amount"`
+	Currency    string            `json:"currency"`
+	ReferenceID string            `json:"reference_id"`
+	ShortURL    string            `json:"short_url"`
+	Status      string            `json:"status"` // created, partially_paid, paid, expired or cancelled
+	Notes       map[string]string `json:"notes"`
+}
+
+// RazorpayWebhookEvent is the envelope Razorpay posts to the webhook endpoint
+type RazorpayWebhookEvent struct {
+	Entity    string   `json:"entity"`
+	AccountID string   `json:"account_id"`
+	Event     string   `json:"event"`
+	Contains  []string `json:"contains"`
+	Payload   struct {
+		Payment *struct {
+			Entity RazorpayPayment `json:"entity"`
+		} `json:"payment,omitempty"`
+		Order *struct {
+			Entity RazorpayOrder `json:"entity"`
+		} `json:"order,omitempty"`
+		Refund *struct {
+			Entity RazorpayRefund `json:"entity"`
+		} `json:"refund,omitempty"`
+	} `json:"payload"`
+	CreatedAt int64 `json:"created_at"`
+}
+
+// RazorpayError is the error body returned by the Razorpay API
+type RazorpayError struct {
+	Error struct {
+		Code        string `json:"code"`
+		Description string `json:"description"`
+	} `json:"error"`
+}
+
+// RazorpayGateway implements PaymentGateway on the Razorpay Orders API
+type RazorpayGateway struct {
+	config     config.RazorpayConfig
+	baseURL    string
+	httpClient *http.Client
+}
+
+// NewRazorpayGateway creates a new Razorpay gateway
+func NewRazorpayGateway(cfg config.RazorpayConfig) *RazorpayGateway {
+	baseURL := strings.TrimRight(cfg.BaseURL, "/")
+	if baseURL == "" {
+		baseURL = "https://api.razorpay.com/v1"
+	}
+
+	return &RazorpayGateway{
+		config:  cfg,
+		baseURL: baseURL,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+func (g *RazorpayGateway) Method() models.PaymentMethod {
+	return models.PaymentMethodRazorpay
+}
+
+func (g *RazorpayGateway) Name() string {
+	return "Razorpay"
+}
+
+// IsEnabled returns true if Razorpay API keys are configured
+func (g *RazorpayGateway) IsEnabled() bool {
+	return g.config.KeyID != "" && g.config.KeySecret != ""
+}
+
+// CreatePayment creates a Razorpay order. The receipt is our order number and the
+// notes carry our order ID so webhooks can be matched without a lookup.
+func (g *RazorpayGateway) CreatePayment(ctx context.Context, req *GatewayPaymentRequest) (*GatewayPayment, error) {
+	var rzpOrder RazorpayOrder
+	err := g.do(ctx, http.MethodPost, "/orders", &RazorpayOrderRequest{
+		Amount:   toPaise(req.Amount),
+		Currency: req.Currency,
+		Receipt:  req.Order.OrderNumber,
+		Notes: map[string]string{
+			"order_id":   req.Order.ID.Hex(),
+			"attempt_id": req.Reference,
+		},
+	}, &rzpOrder)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GatewayPayment{
+		ProviderOrderID: rzpOrder.ID,
+		Checkout: map[string]interface{}{
+			"keyId":           g.config.KeyID,
+			"razorpayOrderId": rzpOrder.ID,
+			"amount":          rzpOrder.Amount,
+			"currency":        rzpOrder.Currency,
+			"receipt":         rzpOrder.Receipt,
+		},
+	}, nil
+}
+
+// CreatePaymentLink creates a Razorpay payment link for the order
+func (g *RazorpayGateway) CreatePaymentLink(ctx context.Context, req *GatewayPaymentRequest) (*GatewayPayment, error) {
+	body := map[string]interface{}{
+		"amount":       toPaise(req.Amount),
+		"currency":     req.Currency,
+		"reference_id": req.Reference,
+		"description":  req.Purpose,
+		"customer": map[string]string{
+			"name":    req.CustomerName,
+			"contact": req.CustomerPhone,
+			"email":   req.CustomerEmail,
+		},
+		"notify": map[string]bool{
+			"sms":   req.CustomerPhone != "",
+			"email": req.CustomerEmail != "",
+		},
+		"notes": map[string]string{"order_id": req.Order.ID.Hex()},
+	}
+	if req.ReturnURL != "" {
+		body["callback_url"] = req.ReturnURL
+		body["callback_method"] = "get"
+	}
+	if req.ExpiresAt != nil {
+		body["expire_by"] = req.ExpiresAt.Unix()
+	}
+
+	var link RazorpayPaymentLink
+	if err := g.do(ctx, http.MethodPost, "/payment_links", body, &link); err != nil {
+		return nil, err
+	}
+
+	return &GatewayPayment{ProviderOrderID: link.ID, LinkURL: link.ShortURL}, nil
+}
+
+// VerifyPayment checks the HMAC-SHA256 signature of "razorpay_order_id|razorpay_payment_id"
+// that Razorpay Checkout returns to the client
+func (g *RazorpayGateway) VerifyPayment(ctx context.Context, attempt *models.PaymentAttempt, params map[string]string) (*GatewayPaymentStatus, error) {
+	razorpayOrderID := params["razorpayOrderId"]
+	paymentID := params["razorpayPaymentId"]
+	if razorpayOrderID == "" || paymentID == "" {
+		return nil, errors.New("razorpayOrderId and razorpayPaymentId are required")
+	}
+	if razorpayOrderID != attempt.ProviderOrderID {
+		return nil, errors.New("payment does not belong to this order")
+	}
+	if !verifyHexSignature(g.config.KeySecret, []byte(razorpayOrderID+"|"+paymentID), params["razorpaySignature"]) {
+		return nil, ErrInvalidPaymentSignature
+	}
+
+	return &GatewayPaymentStatus{
+		ProviderOrderID:   razorpayOrderID,
+		ProviderPaymentID: paymentID,
+		Status:            models.PaymentAttemptPaid,
+		Amount:            attempt.Amount,
+	}, nil
+}
+
+// GetPaymentStatus reads the payments made against the attempt's Razorpay order
+func (g *RazorpayGateway) GetPaymentStatus(ctx context.Context, attempt *models.PaymentAttempt) (*GatewayPaymentStatus, error) {
+	var payments struct {
+		Items []RazorpayPayment `json:"items"`
+	}
+	if err := g.do(ctx, http.MethodGet, "/orders/"+attempt.ProviderOrderID+"/payments", nil, &payments); err != nil {
+		return nil, err
+	}
+
+	status := &GatewayPaymentStatus{
+		ProviderOrderID: attempt.ProviderOrderID,
+		Status:          models.PaymentAttemptCreated,
+	}
+	for _, payment := range payments.Items {
+		switch payment.Status {
+		case "captured", "refunded":
+			status.Status = models.PaymentAttemptPaid
+			status.ProviderPaymentID = payment.ID
+			status.Amount = fromPaise(payment.Amount)
+			status.FailureReason = ""
+			return status, nil
+		case "authorized":
+			status.Status = models.PaymentAttemptPending
+			status.ProviderPaymentID = payment.ID
+			status.Amount = fromPaise(payment.Amount)
+		case "failed":
+			if status.Status == models.PaymentAttemptCreated {
+				status.Status = models.PaymentAttemptFailed
+				status.ProviderPaymentID = payment.ID
+				status.FailureReason = payment.ErrorDescription
+			}
+		}
+	}
+
+	return status, nil
+}
+
+// ParseWebhook verifies the X-Razorpay-Signature header and maps payment events
+func (g *RazorpayGateway) ParseWebhook(ctx context.Context, payload []byte, headers http.Header) (*GatewayWebhookEvent, error) {
+	if g.config.WebhookSecret == "" {
+		return nil, errors.New("Razorpay webhook secret is not configured")
+	}
+	if !verifyHexSignature(g.config.WebhookSecret, payload, headers.Get("X-Razorpay-Signature")) {
+		return nil, ErrInvalidPaymentSignature
+	}
+
+	var event RazorpayWebhookEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("failed to parse webhook payload: %w", err)
+	}
+
+	result := &GatewayWebhookEvent{
+		EventID: headers.Get("X-Razorpay-Event-Id"),
+		Type:    event.Event,
+	}
+	if event.Payload.Order != nil {
+		result.OrderID = event.Payload.Order.Entity.Notes["order_id"]
+	}
+	if event.Payload.Refund != nil {
+		return g.parseRefundEvent(&event, result), nil
+	}
+	if event.Payload.Payment == nil {
+		return result, nil
+	}
+
+	payment := event.Payload.Payment.Entity
+	if result.OrderID == "" {
+		result.OrderID = payment.Notes["order_id"]
+	}
+
+	status := &GatewayPaymentStatus{
+		ProviderOrderID:   payment.OrderID,
+		ProviderPaymentID: payment.ID,
+		Amount:            fromPaise(payment.Amount),
+	}
+	switch event.Event {
+	case "payment.captured", "order.paid":
+		status.Status = models.PaymentAttemptPaid
+	case "payment.failed":
+		status.Status = models.PaymentAttemptFailed
+		status.FailureReason = payment.ErrorDescription
+	default:
+		return result, nil
+	}
+
+	result.Payment = status
+	return result, nil
+}
+
+// parseRefundEvent maps refund.created, refund.processed and refund.failed events.
+// The refund receipt carries our refund ID.
+func (g *RazorpayGateway) parseRefundEvent(event *RazorpayWebhookEvent, result *GatewayWebhookEvent) *GatewayWebhookEvent {
+	refund := event.Payload.Refund.Entity
+	if result.OrderID == "" {
+		result.OrderID = refund.Notes["order_id"]
+	}
+
+	status := &GatewayRefund{
+		RefundID:         refund.Receipt,
+		ProviderRefundID: refund.ID,
+		Amount:           fromPaise(refund.Amount),
+	}
+	if event.Payload.Payment != nil {
+		status.ProviderOrderID = event.Payload.Payment.Entity.OrderID
+	}
+	switch event.Event {
+	case "refund.processed":
+		status.Status = models.RefundStatusProcessed
+	case "refund.failed":
+		status.Status = models.RefundStatusFailed
+		status.FailureReason = "Refund failed at Razorpay"
+	case "refund.created":
+		status.Status = models.RefundStatusInitiated
+	default:
+		return result
+	}
+
+	result.Refund = status
+	return result
+}
+
+// Refund refunds the captured payment of the attempt. The refund ID is sent as the receipt.
+func (g *RazorpayGateway) Refund(ctx context.Context, attempt *models.PaymentAttempt, req *GatewayRefundRequest) (*GatewayRefund, error) {
+	if attempt.ProviderPaymentID == "" {
+		return nil, errors.New("payment attempt has no captured payment")
+	}
+
+	var refund RazorpayRefund
+	err := g.do(ctx, http.MethodPost, "/payments/"+attempt.ProviderPaymentID+"/refund", map[string]interface{}{
+		"amount":  toPaise(req.Amount),
+		"receipt": req.RefundID,
+		"notes": map[string]string{
+			"order_id": attempt.OrderID.Hex(),
+			"reason":   req.Reason,
+		},
+	}, &refund)
+	if err != nil {
+		return nil, err
+	}
+
+	status := models.RefundStatusInitiated
+	switch refund.Status {
+	case "processed":
+		status = models.RefundStatusProcessed
+	case "failed":
+		status = models.RefundStatusFailed
+	}
+
+	return &GatewayRefund{
+		RefundID:         req.RefundID,
+		ProviderRefundID: refund.ID,
+		ProviderOrderID:  attempt.ProviderOrderID,
+		Status:           status,
+		Amount:           fromPaise(refund.Amount),
+	}, nil
+}
+
+// CancelPayment cancels the attempt's payment link. Razorpay orders cannot be
+// closed, so a checkout the customer still completes is reported as usual.
+func (g *RazorpayGateway) CancelPayment(ctx context.Context, attempt *models.PaymentAttempt) error {
+	if attempt.LinkURL == "" {
+		return ErrGatewayOperationUnsupported
+	}
+
+	var link RazorpayPaymentLink
+	return g.do(ctx, http.MethodPost, "/payment_links/"+attempt.ProviderOrderID+"/cancel", nil, &link)
+}
+
+// do sends an authenticated request to the Razorpay API and decodes the response into out
+func (g *RazorpayGateway) do(ctx context.Context, method, path string, in interface{}, out interface{}) error {
+	if !g.IsEnabled() {
+		return errors.New("Razorpay is not configured")
+	}
+
+	var reqBody io.Reader
+	if in != nil {
+		jsonData, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		reqBody = bytes.NewBuffer(jsonData)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, method, g.baseURL+path, reqBody)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.SetBasicAuth(g.config.KeyID, g.config.KeySecret)
+
+	resp, err := g.httpClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr RazorpayError
+		if err := json.Unmarshal(body, &apiErr); err == nil && apiErr.Error.Description != "" {
+			return fmt.Errorf("Razorpay API error: %s (code: %s)", apiErr.Error.Description, apiErr.Error.Code)
+		}
+		return fmt.Errorf("Razorpay API error: status %d, body: %s", resp.StatusCode, string(body))
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return nil
+}
+
+// verifyHexSignature compares a hex HMAC-SHA256 signature of message in constant time
+func verifyHexSignature(secret string, message []byte, signature string) bool {
+	if secret == "" || signature == "" {
+		return false
+	}
+
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write(message)
+	expected := hex.EncodeToString(h.Sum(nil))
+
+	return hmac.Equal([]byte(signature), []byte(expected))
+}
+
+// toPaise converts a rupee amount to the integer paise used by Razorpay
+func toPaise(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+// fromPaise converts paise back to rupees
+func fromPaise(amount int64) float64 {
+	return float64(amount) / 100
+}
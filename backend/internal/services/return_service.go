@@ -0,0 +1,585 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"mime/multipart"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxReturnPhotos is how many photos a customer may attach to one return request
+const maxReturnPhotos = 5
+
+var (
+	// ErrReturnNotFound is returned when a return request or its order does not exist or belongs to someone else
+	ErrReturnNotFound = errors.New("return request not found")
+	// ErrReturnNotAllowed is returned when the order or the selected units cannot be returned
+	ErrReturnNotAllowed = errors.New("return not allowed")
+)
+
+// ReturnService runs the RMA workflow for delivered orders: customers request
+// returns of individual units, admins approve or reject them, collect the items
+// and record a quality check, and accepted units are restocked and refunded.
+type ReturnService interface {
+	GetReturnEligibility(orderID string, actor models.OrderActor) (*models.ReturnEligibility, error)
+	CreateReturn(actor models.OrderActor, req *models.CreateReturnRequest) (*models.ReturnRequest, error)
+	AddReturnPhotos(returnID string, actor models.OrderActor, files []*multipart.FileHeader) (*models.ReturnRequest, error)
+	GetCustomerReturn(returnID string, actor models.OrderActor) (*models.ReturnRequest, error)
+	ListCustomerReturns(userID, guestSessionID string, page, limit int) ([]models.ReturnRequest, int64, error)
+	CancelReturn(returnID string, actor models.OrderActor) (*models.ReturnRequest, error)
+
+	// Admin
+	GetReturn(returnID string) (*models.ReturnRequest, error)
+	ListReturns(filter models.ReturnFilter) ([]models.ReturnRequest, int64, error)
+	ApproveReturn(returnID string, actor models.OrderActor, note string) (*models.ReturnRequest, error)
+	RejectReturn(returnID string, actor models.OrderActor, reason string) (*models.ReturnRequest, error)
+	SchedulePickup(returnID string, actor models.OrderActor, req *models.SchedulePickupRequest) (*models.ReturnRequest, error)
+	MarkReturnReceived(returnID string, actor models.OrderActor, note string) (*models.ReturnRequest, error)
+	RecordQualityCheck(returnID string, actor models.OrderActor, req *models.QualityCheckRequest) (*models.ReturnRequest, error)
+}
+
+type returnService struct {
+	returnRepo     repository.ReturnRepository
+	orderRepo      repository.OrderRepository
+	storefrontRepo *repository.StorefrontDataRepository
+	paymentService PaymentService
+	stockService   StockService
+	s3Service      *S3Service
+}
+
+// NewReturnService creates a new return service
+func NewReturnService(returnRepo repository.ReturnRepository, orderRepo repository.OrderRepository) ReturnService {
+	return &returnService{
+		returnRepo: returnRepo,
+		orderRepo:  orderRepo,
+	}
+}
+
+// SetStorefrontRepo reads the return window from the store settings.
+// Without it the default window is used.
+func (s *returnService) SetStorefrontRepo(storefrontRepo *repository.StorefrontDataRepository) {
+	s.storefrontRepo = storefrontRepo
+}
+
+// SetPaymentService enables refunds for units that pass the quality check
+func (s *returnService) SetPaymentService(paymentService PaymentService) {
+	s.paymentService = paymentService
+}
+
+// SetStockService enables restocking of accepted units
+func (s *returnService) SetStockService(stockService StockService) {
+	s.stockService = stockService
+}
+
+// SetS3Service enables photo uploads for return requests
+func (s *returnService) SetS3Service(s3Service *S3Service) {
+	s.s3Service = s3Service
+}
+
+func (s *returnService) GetReturnEligibility(orderID string, actor models.OrderActor) (*models.ReturnEligibility, error) {
+	ctx := context.Background()
+
+	order, err := s.customerOrder(ctx, orderID, actor)
+	if err != nil {
+		return nil, err
+	}
+
+	eligibility, _, err := s.eligibility(ctx, order)
+	return eligibility, err
+}
+
+// CreateReturn opens a return request for units of a delivered order that are
+// within the return window and not already part of another return
+func (s *returnService) CreateReturn(actor models.OrderActor, req *models.CreateReturnRequest) (*models.ReturnRequest, error) {
+	ctx := context.Background()
+
+	order, err := s.customerOrder(ctx, req.OrderID, actor)
+	if err != nil {
+		return nil, err
+	}
+
+	eligibility, existing, err := s.eligibility(ctx, order)
+	if err != nil {
+		return nil, err
+	}
+	if !eligibility.Eligible {
+		return nil, fmt.Errorf("%w: %s", ErrReturnNotAllowed, eligibility.Reason)
+	}
+
+	ret := &models.ReturnRequest{
+		RMANumber:      fmt.Sprintf("%s-RMA%d", order.OrderNumber, len(existing)+1),
+		OrderID:        order.ID,
+		OrderNumber:    order.OrderNumber,
+		UserID:         order.UserID,
+		GuestSessionID: order.GuestSessionID,
+		Comment:        req.Comment,
+		Status:         models.ReturnStatusRequested,
+		StatusHistory: []models.ReturnStatusChange{{
+			To:        models.ReturnStatusRequested,
+			Actor:     actor,
+			Note:      req.Comment,
+			ChangedAt: time.Now(),
+		}},
+	}
+
+	seen := make(map[int]bool)
+	for _, item := range req.Items {
+		if item.LineIndex < 0 || item.LineIndex >= len(eligibility.Items) {
+			return nil, fmt.Errorf("%w: order has no item %d", ErrReturnNotAllowed, item.LineIndex)
+		}
+		if seen[item.LineIndex] {
+			return nil, fmt.Errorf("%w: item %d is listed twice", ErrReturnNotAllowed, item.LineIndex)
+		}
+		seen[item.LineIndex] = true
+		if !item.Reason.IsValid() {
+			return nil, fmt.Errorf("%w: unknown reason %q", ErrReturnNotAllowed, item.Reason)
+		}
+
+		line := order.Items[item.LineIndex]
+		returnable := eligibility.Items[item.LineIndex].ReturnableQuantity
+		if item.Quantity < 1 || item.Quantity > returnable {
+			return nil, fmt.Errorf("%w: only %d of %s can be returned", ErrReturnNotAllowed, returnable, line.Name)
+		}
+
+		ret.Items = append(ret.Items, models.ReturnItem{
+			LineIndex: item.LineIndex,
+			ProductID: line.ProductID,
+			Name:      line.Name,
+			Image:     line.Image,
+			UnitPrice: line.Price,
+			Quantity:  item.Quantity,
+			Reason:    item.Reason,
+			Comment:   item.Comment,
+		})
+	}
+
+	if err := s.returnRepo.Create(ctx, ret); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// AddReturnPhotos uploads photos of the items to S3 while the request is awaiting review
+func (s *returnService) AddReturnPhotos(returnID string, actor models.OrderActor, files []*multipart.FileHeader) (*models.ReturnRequest, error) {
+	if s.s3Service == nil || !s.s3Service.IsEnabled() {
+		return nil, errors.New("photo uploads are not configured")
+	}
+
+	ctx := context.Background()
+	ret, err := s.customerReturn(ctx, returnID, actor)
+	if err != nil {
+		return nil, err
+	}
+
+	if ret.Status != models.ReturnStatusRequested && ret.Status != models.ReturnStatusApproved {
+		return nil, fmt.Errorf("%w: photos cannot be added to a %s return", ErrReturnNotAllowed, ret.Status)
+	}
+	if len(ret.Photos)+len(files) > maxReturnPhotos {
+		return nil, fmt.Errorf("%w: at most %d photos can be attached", ErrReturnNotAllowed, maxReturnPhotos)
+	}
+
+	if name := nonImageUpload(files); name != "" {
+		return nil, fmt.Errorf("%w: %s is not a JPG, PNG or WebP image", ErrReturnNotAllowed, name)
+	}
+
+	for _, file := range files {
+		url, err := s.s3Service.UploadFile(ctx, file, "returns/"+ret.RMANumber)
+		if err != nil {
+			return nil, fmt.Errorf("failed to upload %s: %w", file.Filename, err)
+		}
+		ret.Photos = append(ret.Photos, url)
+	}
+
+	if err := s.returnRepo.Update(ctx, ret); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func (s *returnService) GetCustomerReturn(returnID string, actor models.OrderActor) (*models.ReturnRequest, error) {
+	return s.customerReturn(context.Background(), returnID, actor)
+}
+
+func (s *returnService) ListCustomerReturns(userID, guestSessionID string, page, limit int) ([]models.ReturnRequest, int64, error) {
+	var userObjID primitive.ObjectID
+	if userID != "" {
+		objID, err := primitive.ObjectIDFromHex(userID)
+		if err != nil {
+			return nil, 0, errors.New("invalid user ID")
+		}
+		userObjID = objID
+	} else if guestSessionID == "" {
+		return nil, 0, errors.New("user ID or guest session ID is required")
+	}
+
+	return s.returnRepo.GetByCustomer(context.Background(), userObjID, guestSessionID, page, limit)
+}
+
+// CancelReturn withdraws a return request before the items have been received
+func (s *returnService) CancelReturn(returnID string, actor models.OrderActor) (*models.ReturnRequest, error) {
+	ctx := context.Background()
+
+	ret, err := s.customerReturn(ctx, returnID, actor)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, s.transition(ctx, ret, models.ReturnStatusCancelled, actor, "Withdrawn by customer")
+}
+
+func (s *returnService) GetReturn(returnID string) (*models.ReturnRequest, error) {
+	objID, err := primitive.ObjectIDFromHex(returnID)
+	if err != nil {
+		return nil, errors.New("invalid return ID")
+	}
+
+	return s.returnRepo.GetByID(context.Background(), objID)
+}
+
+func (s *returnService) ListReturns(filter models.ReturnFilter) ([]models.ReturnRequest, int64, error) {
+	return s.returnRepo.List(context.Background(), filter)
+}
+
+func (s *returnService) ApproveReturn(returnID string, actor models.OrderActor, note string) (*models.ReturnRequest, error) {
+	ret, err := s.GetReturn(returnID)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, s.transition(context.Background(), ret, models.ReturnStatusApproved, actor, note)
+}
+
+func (s *returnService) RejectReturn(returnID string, actor models.OrderActor, reason string) (*models.ReturnRequest, error) {
+	if strings.TrimSpace(reason) == "" {
+		return nil, errors.New("a reason is required to reject a return")
+	}
+
+	ret, err := s.GetReturn(returnID)
+	if err != nil {
+		return nil, err
+	}
+
+	ret.RejectReason = reason
+	return ret, s.transition(context.Background(), ret, models.ReturnStatusRejected, actor, reason)
+}
+
+// SchedulePickup books or reschedules the collection of an approved return.
+// The order's shipping address is used unless another is given.
+func (s *returnService) SchedulePickup(returnID string, actor models.OrderActor, req *models.SchedulePickupRequest) (*models.ReturnRequest, error) {
+	ctx := context.Background()
+
+	ret, err := s.GetReturn(returnID)
+	if err != nil {
+		return nil, err
+	}
+
+	address := req.Address
+	if address == nil {
+		order, err := s.orderRepo.GetByID(ctx, ret.OrderID)
+		if err != nil {
+			return nil, err
+		}
+		address = &order.ShippingAddress
+	}
+
+	if err := ret.TransitionTo(models.ReturnStatusPickupScheduled, actor, "Pickup on "+req.ScheduledDate.Format("2006-01-02")); err != nil {
+		return nil, err
+	}
+	ret.Pickup = &models.ReturnPickup{
+		Address:        *address,
+		ScheduledDate:  req.ScheduledDate,
+		Slot:           req.Slot,
+		Carrier:        req.Carrier,
+		TrackingNumber: req.TrackingNumber,
+		ScheduledAt:    time.Now(),
+	}
+
+	if err := s.returnRepo.Update(ctx, ret); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func (s *returnService) MarkReturnReceived(returnID string, actor models.OrderActor, note string) (*models.ReturnRequest, error) {
+	ret, err := s.GetReturn(returnID)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, s.transition(context.Background(), ret, models.ReturnStatusReceived, actor, note)
+}
+
+// RecordQualityCheck records how many units of each line passed inspection.
+// Accepted units are restocked and refunded at their share of what the customer
+// paid; shipping is refunded too once every unit of the order has come back.
+// Refused units are sent back to the customer and the request is closed.
+func (s *returnService) RecordQualityCheck(returnID string, actor models.OrderActor, req *models.QualityCheckRequest) (*models.ReturnRequest, error) {
+	ctx := context.Background()
+
+	ret, err := s.GetReturn(returnID)
+	if err != nil {
+		return nil, err
+	}
+	if ret.Status != models.ReturnStatusReceived {
+		return nil, fmt.Errorf("%w: the items of a %s return have not been received", models.ErrInvalidReturnStatusTransition, ret.Status)
+	}
+	// Kept to hand the return back if its refund cannot be sent
+	received := *ret
+	received.Items = append([]models.ReturnItem(nil), ret.Items...)
+
+	accepted := make(map[int]int)
+	for _, item := range req.Items {
+		accepted[item.LineIndex] = item.AcceptedQuantity
+	}
+
+	order, err := s.orderRepo.GetByID(ctx, ret.OrderID)
+	if err != nil {
+		return nil, err
+	}
+
+	restock := make(map[int]int)
+	acceptedUnits, returnedUnits := 0, 0
+	refundAmount := 0.0
+	for i := range ret.Items {
+		item := &ret.Items[i]
+		quantity, ok := accepted[item.LineIndex]
+		if ok && quantity > item.Quantity {
+			return nil, fmt.Errorf("%w: only %d of %s were returned", ErrReturnNotAllowed, item.Quantity, item.Name)
+		}
+		delete(accepted, item.LineIndex)
+
+		item.AcceptedQuantity = quantity
+		item.RefundAmount = order.ItemRefundAmount(item.LineIndex, quantity)
+		if quantity > 0 {
+			restock[item.LineIndex] = quantity
+		}
+		acceptedUnits += quantity
+		returnedUnits += item.Quantity
+		refundAmount += item.RefundAmount
+	}
+	for lineIndex := range accepted {
+		return nil, fmt.Errorf("%w: item %d is not part of this return", ErrReturnNotAllowed, lineIndex)
+	}
+
+	check := &models.ReturnQualityCheck{
+		Outcome:   models.QualityCheckPartial,
+		Notes:     req.Notes,
+		CheckedBy: actor,
+		CheckedAt: time.Now(),
+	}
+	switch acceptedUnits {
+	case 0:
+		check.Outcome = models.QualityCheckFailed
+	case returnedUnits:
+		check.Outcome = models.QualityCheckPassed
+	}
+	ret.QualityCheck = check
+
+	if acceptedUnits == 0 {
+		ret.RefundAmount = 0
+		return ret, s.transition(ctx, ret, models.ReturnStatusClosed, actor, req.Notes)
+	}
+
+	if s.paymentService == nil {
+		return nil, errors.New("payment service is not configured")
+	}
+
+	// Claim the return before refunding, so a repeated or concurrent quality
+	// check cannot refund and restock it a second time
+	if err := s.transition(ctx, ret, models.ReturnStatusRefunding, actor, req.Notes); err != nil {
+		return nil, err
+	}
+
+	reason := "Return " + ret.RMANumber
+	fullyReturned := true
+	for i, item := range order.Items {
+		if item.ReturnedQuantity+restock[i] < item.Quantity {
+			fullyReturned = false
+		}
+	}
+	if fullyReturned {
+		refundAmount += order.Shipping
+	}
+	refundAmount = math.Min(math.Round(refundAmount*100)/100, order.RefundableAmount())
+
+	if refundAmount > 0 {
+		refund, err := s.paymentService.RefundPayment(order, refundAmount, reason)
+		if err != nil {
+			// Nothing was refunded, so hand the return back for another quality check
+			if releaseErr := s.returnRepo.TransitionStatus(ctx, &received, models.ReturnStatusRefunding); releaseErr != nil {
+				fmt.Printf("Warning: return %s is left refunding: %v\n", ret.RMANumber, releaseErr)
+			}
+			return nil, err
+		}
+		if refund.Status == models.RefundStatusFailed {
+			fmt.Printf("Warning: refund %s for return %s failed and will be retried: %s\n", refund.RefundID, ret.RMANumber, refund.FailureReason)
+		}
+		ret.RefundID = refund.RefundID
+	}
+	ret.RefundAmount = refundAmount
+
+	if s.stockService != nil {
+		if err := s.stockService.RestockReturnedItems(ctx, order, restock, reason); err != nil {
+			fmt.Printf("Warning: failed to restock return %s: %v\n", ret.RMANumber, err)
+		}
+	}
+	for lineIndex, quantity := range restock {
+		order.Items[lineIndex].ReturnedQuantity += quantity
+	}
+	if fullyReturned {
+		if err := order.Refund(actor, reason); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.orderRepo.Update(ctx, order); err != nil {
+		return nil, err
+	}
+
+	return ret, s.transition(ctx, ret, models.ReturnStatusRefunded, actor, req.Notes)
+}
+
+// nonImageUpload returns the name of the first file that is not a JPG, PNG or
+// WebP image, or "" if they all are
+func nonImageUpload(files []*multipart.FileHeader) string {
+	allowedExts := map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".webp": true}
+	for _, file := range files {
+		if !allowedExts[strings.ToLower(filepath.Ext(file.Filename))] {
+			return file.Filename
+		}
+	}
+	return ""
+}
+
+// transition moves the return request to status and saves it, provided no one
+// else has changed its status since it was read
+func (s *returnService) transition(ctx context.Context, ret *models.ReturnRequest, status models.ReturnStatus, actor models.OrderActor, note string) error {
+	from := ret.Status
+	if err := ret.TransitionTo(status, actor, note); err != nil {
+		return err
+	}
+	return s.returnRepo.TransitionStatus(ctx, ret, from)
+}
+
+// customerOrder loads an order placed by the customer actor
+func (s *returnService) customerOrder(ctx context.Context, orderID string, actor models.OrderActor) (*models.Order, error) {
+	objID, err := primitive.ObjectIDFromHex(orderID)
+	if err != nil {
+		return nil, errors.New("invalid order ID")
+	}
+
+	order, err := s.orderRepo.GetByID(ctx, objID)
+	if err != nil {
+		return nil, ErrReturnNotFound
+	}
+
+	owner := order.GuestSessionID
+	if !order.UserID.IsZero() {
+		owner = order.UserID.Hex()
+	}
+	if actor.ID == "" || actor.ID != owner {
+		return nil, ErrReturnNotFound
+	}
+
+	return order, nil
+}
+
+// customerReturn loads a return request made by the customer actor
+func (s *returnService) customerReturn(ctx context.Context, returnID string, actor models.OrderActor) (*models.ReturnRequest, error) {
+	objID, err := primitive.ObjectIDFromHex(returnID)
+	if err != nil {
+		return nil, errors.New("invalid return ID")
+	}
+
+	ret, err := s.returnRepo.GetByID(ctx, objID)
+	if err != nil || !ret.IsOwnedBy(actor) {
+		return nil, ErrReturnNotFound
+	}
+
+	return ret, nil
+}
+
+// eligibility works out the return deadline and how many units of each line
+// are not yet claimed by another return request. It also returns the order's
+// existing return requests.
+func (s *returnService) eligibility(ctx context.Context, order *models.Order) (*models.ReturnEligibility, []models.ReturnRequest, error) {
+	existing, err := s.returnRepo.GetByOrder(ctx, order.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	claimed := make(map[int]int)
+	for _, ret := range existing {
+		if !ret.HoldsUnits() {
+			continue
+		}
+		for _, item := range ret.Items {
+			claimed[item.LineIndex] += item.Quantity
+		}
+	}
+
+	eligibility := &models.ReturnEligibility{OrderID: order.ID}
+	returnable := 0
+	for i, item := range order.Items {
+		quantity := item.Quantity - claimed[i]
+		if quantity < 0 {
+			quantity = 0
+		}
+		returnable += quantity
+		eligibility.Items = append(eligibility.Items, models.ReturnableOrderItem{
+			LineIndex:          i,
+			ProductID:          item.ProductID,
+			Name:               item.Name,
+			Quantity:           item.Quantity,
+			ReturnableQuantity: quantity,
+		})
+	}
+
+	if order.Status != models.OrderStatusDelivered || order.DeliveredAt == nil {
+		eligibility.Reason = "Only delivered orders can be returned"
+		return eligibility, existing, nil
+	}
+
+	windowDays, err := s.returnWindowDays(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	deadline := order.DeliveredAt.AddDate(0, 0, windowDays)
+	eligibility.ReturnDeadline = &deadline
+
+	switch {
+	case time.Now().After(deadline):
+		eligibility.Reason = fmt.Sprintf("The %d day return window closed on %s", windowDays, deadline.Format("2 Jan 2006"))
+	case returnable == 0:
+		eligibility.Reason = "Every item of this order is already being returned"
+	default:
+		eligibility.Eligible = true
+	}
+
+	return eligibility, existing, nil
+}
+
+// returnWindowDays reads the return window from the store settings
+func (s *returnService) returnWindowDays(ctx context.Context) (int, error) {
+	settings := models.DefaultStoreSettings()
+	if s.storefrontRepo != nil {
+		stored, err := s.storefrontRepo.GetStoreSettings(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("failed to load store settings: %w", err)
+		}
+		settings = stored
+	}
+	return settings.ReturnWindow(), nil
+}
@@ -0,0 +1,291 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memoryReturnRepository keeps return requests in memory
+type memoryReturnRepository struct {
+	repository.ReturnRepository
+	returns []models.ReturnRequest
+}
+
+func (r *memoryReturnRepository) Create(ctx context.Context, ret *models.ReturnRequest) error {
+	ret.ID = primitive.NewObjectID()
+	ret.CreatedAt = time.Now()
+	r.returns = append(r.returns, *ret)
+	return nil
+}
+
+func (r *memoryReturnRepository) Update(ctx context.Context, ret *models.ReturnRequest) error {
+	for i := range r.returns {
+		if r.returns[i].ID == ret.ID {
+			r.returns[i] = *ret
+			return nil
+		}
+	}
+	return errors.New("return request not found")
+}
+
+func (r *memoryReturnRepository) TransitionStatus(ctx context.Context, ret *models.ReturnRequest, from models.ReturnStatus) error {
+	for i := range r.returns {
+		if r.returns[i].ID == ret.ID {
+			if r.returns[i].Status != from {
+				return fmt.Errorf("%w: return %s changed since it was read", models.ErrInvalidReturnStatusTransition, ret.RMANumber)
+			}
+			r.returns[i] = *ret
+			return nil
+		}
+	}
+	return errors.New("return request not found")
+}
+
+// staleReturnRepository hands out a return as it was before another request changed it
+type staleReturnRepository struct {
+	*memoryReturnRepository
+	snapshot models.ReturnRequest
+}
+
+func (r *staleReturnRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.ReturnRequest, error) {
+	ret := r.snapshot
+	ret.Items = append([]models.ReturnItem(nil), r.snapshot.Items...)
+	return &ret, nil
+}
+
+func (r *memoryReturnRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.ReturnRequest, error) {
+	for _, ret := range r.returns {
+		if ret.ID == id {
+			return &ret, nil
+		}
+	}
+	return nil, errors.New("return request not found")
+}
+
+func (r *memoryReturnRepository) GetByOrder(ctx context.Context, orderID primitive.ObjectID) ([]models.ReturnRequest, error) {
+	var returns []models.ReturnRequest
+	for _, ret := range r.returns {
+		if ret.OrderID == orderID {
+			returns = append(returns, ret)
+		}
+	}
+	return returns, nil
+}
+
+// memoryStockRepository counts units released back into stock
+type memoryStockRepository struct {
+	repository.StockRepository
+	released map[primitive.ObjectID]int
+}
+
+func (r *memoryStockRepository) Release(ctx context.Context, productID primitive.ObjectID, quantity int) (int, error) {
+	r.released[productID] += quantity
+	return r.released[productID], nil
+}
+
+func (r *memoryStockRepository) RecordMovement(ctx context.Context, movement *models.StockMovement) error {
+	return nil
+}
+
+func TestReturnWorkflowRefundsAcceptedUnits(t *testing.T) {
+	delivered := time.Now().Add(-48 * time.Hour)
+	ring, pendant := primitive.NewObjectID(), primitive.NewObjectID()
+	order := models.Order{
+		ID:             primitive.NewObjectID(),
+		OrderNumber:    "TJ-3001",
+		GuestSessionID: "guest-1",
+		Items: []models.OrderItem{
+			{ProductID: ring, Name: "Ring", Price: 1000, Quantity: 2, StockReserved: true},
+			{ProductID: pendant, Name: "Pendant", Price: 3000, Quantity: 1, StockReserved: true},
+		},
+		PaymentMethod: models.PaymentMethodCOD,
+		PaymentStatus: models.PaymentStatusPaid,
+		Status:        models.OrderStatusDelivered,
+		StockStatus:   models.StockReservationCommitted,
+		Subtotal:      5000,
+		Discount:      500,
+		Tax:           810,
+		Shipping:      100,
+		Total:         5410,
+		DeliveredAt:   &delivered,
+	}
+	orderRepo := &memoryOrderRepository{orders: map[primitive.ObjectID]models.Order{order.ID: order}}
+	stockRepo := &memoryStockRepository{released: make(map[primitive.ObjectID]int)}
+	returnRepo := &memoryReturnRepository{}
+
+	svc := NewReturnService(returnRepo, orderRepo).(*returnService)
+	svc.SetPaymentService(NewPaymentService(orderRepo, &memoryPaymentAttemptRepository{}, NewPaymentGatewayRegistry()))
+	svc.SetStockService(NewStockService(stockRepo))
+
+	customer := models.OrderActor{Type: models.OrderActorCustomer, ID: "guest-1"}
+	admin := models.OrderActor{Type: models.OrderActorAdmin, ID: "admin-1"}
+	orderID := order.ID.Hex()
+
+	request := func(items ...models.CreateReturnItemRequest) *models.CreateReturnRequest {
+		return &models.CreateReturnRequest{OrderID: orderID, Items: items}
+	}
+	oneRing := models.CreateReturnItemRequest{LineIndex: 0, Quantity: 1, Reason: models.ReturnReasonSizeIssue}
+
+	if _, err := svc.CreateReturn(models.OrderActor{Type: models.OrderActorCustomer, ID: "guest-2"}, request(oneRing)); !errors.Is(err, ErrReturnNotFound) {
+		t.Fatalf("expected another customer's order to be hidden, got %v", err)
+	}
+
+	first, err := svc.CreateReturn(customer, request(oneRing))
+	if err != nil {
+		t.Fatalf("create return: %v", err)
+	}
+	if first.RMANumber != "TJ-3001-RMA1" || first.Status != models.ReturnStatusRequested {
+		t.Fatalf("unexpected return request %+v", first)
+	}
+
+	twoRings := models.CreateReturnItemRequest{LineIndex: 0, Quantity: 2, Reason: models.ReturnReasonDamaged}
+	if _, err := svc.CreateReturn(customer, request(twoRings)); !errors.Is(err, ErrReturnNotAllowed) {
+		t.Fatalf("expected units already being returned to be refused, got %v", err)
+	}
+
+	firstID := first.ID.Hex()
+	qc := &models.QualityCheckRequest{Items: []models.QualityCheckItem{{LineIndex: 0, AcceptedQuantity: 1}}}
+	if _, err := svc.RecordQualityCheck(firstID, admin, qc); !errors.Is(err, models.ErrInvalidReturnStatusTransition) {
+		t.Fatalf("expected quality check before receipt to be refused, got %v", err)
+	}
+
+	if _, err := svc.ApproveReturn(firstID, admin, ""); err != nil {
+		t.Fatalf("approve: %v", err)
+	}
+	pickup, err := svc.SchedulePickup(firstID, admin, &models.SchedulePickupRequest{ScheduledDate: time.Now().Add(24 * time.Hour), Slot: "10:00-14:00"})
+	if err != nil || pickup.Pickup == nil {
+		t.Fatalf("schedule pickup: %+v, %v", pickup, err)
+	}
+	received, err := svc.MarkReturnReceived(firstID, admin, "")
+	if err != nil {
+		t.Fatalf("receive: %v", err)
+	}
+	refunded, err := svc.RecordQualityCheck(firstID, admin, qc)
+	if err != nil {
+		t.Fatalf("quality check: %v", err)
+	}
+
+	// A second quality check that read the return before the first finished
+	svc.returnRepo = &staleReturnRepository{memoryReturnRepository: returnRepo, snapshot: *received}
+	if _, err := svc.RecordQualityCheck(firstID, admin, qc); !errors.Is(err, models.ErrInvalidReturnStatusTransition) {
+		t.Fatalf("expected a concurrent quality check to be refused, got %v", err)
+	}
+	svc.returnRepo = returnRepo
+	if refunds := orderRepo.orders[order.ID].Refunds; len(refunds) != 1 || stockRepo.released[ring] != 1 {
+		t.Fatalf("expected the return to be refunded and restocked once, got %d refunds and %d restocked", len(refunds), stockRepo.released[ring])
+	}
+
+	// One ring: 1000 less 10% of the discount plus 20% of the tax
+	if refunded.Status != models.ReturnStatusRefunded || refunded.RefundAmount != 1062 || refunded.QualityCheck.Outcome != models.QualityCheckPassed {
+		t.Fatalf("unexpected refunded return %+v", refunded)
+	}
+	stored := orderRepo.orders[order.ID]
+	if stored.Status != models.OrderStatusDelivered || stored.Items[0].ReturnedQuantity != 1 || stored.RefundableAmount() != 4348 {
+		t.Fatalf("expected a partial refund on a still delivered order, got %+v", stored)
+	}
+	if stockRepo.released[ring] != 1 {
+		t.Fatalf("expected one ring restocked, got %d", stockRepo.released[ring])
+	}
+
+	second, err := svc.CreateReturn(customer, request(
+		models.CreateReturnItemRequest{LineIndex: 0, Quantity: 1, Reason: models.ReturnReasonChangedMind},
+		models.CreateReturnItemRequest{LineIndex: 1, Quantity: 1, Reason: models.ReturnReasonDefective},
+	))
+	if err != nil {
+		t.Fatalf("create second return: %v", err)
+	}
+	secondID := second.ID.Hex()
+	if _, err := svc.ApproveReturn(secondID, admin, ""); err != nil {
+		t.Fatalf("approve second: %v", err)
+	}
+	if _, err := svc.MarkReturnReceived(secondID, admin, ""); err != nil {
+		t.Fatalf("receive second: %v", err)
+	}
+	refunded, err = svc.RecordQualityCheck(secondID, admin, &models.QualityCheckRequest{Items: []models.QualityCheckItem{
+		{LineIndex: 0, AcceptedQuantity: 1},
+		{LineIndex: 1, AcceptedQuantity: 1},
+	}})
+	if err != nil {
+		t.Fatalf("second quality check: %v", err)
+	}
+
+	// The rest of the order comes back, so shipping is refunded too
+	if refunded.RefundAmount != 4348 {
+		t.Fatalf("expected the remaining 4348 to be refunded, got %.2f", refunded.RefundAmount)
+	}
+	stored = orderRepo.orders[order.ID]
+	if stored.Status != models.OrderStatusReturned || stored.PaymentStatus != models.PaymentStatusRefunded {
+		t.Fatalf("expected a fully returned and refunded order, got %s/%s", stored.Status, stored.PaymentStatus)
+	}
+	if stockRepo.released[ring] != 2 || stockRepo.released[pendant] != 1 {
+		t.Fatalf("unexpected restock %+v", stockRepo.released)
+	}
+}
+
+func TestReturnWindowAndFailedQualityCheck(t *testing.T) {
+	delivered := time.Now().AddDate(0, 0, -(models.DefaultReturnWindowDays + 1))
+	order := models.Order{
+		ID:            primitive.NewObjectID(),
+		OrderNumber:   "TJ-3002",
+		UserID:        primitive.NewObjectID(),
+		Items:         []models.OrderItem{{ProductID: primitive.NewObjectID(), Name: "Earrings", Price: 2000, Quantity: 1}},
+		PaymentMethod: models.PaymentMethodCOD,
+		PaymentStatus: models.PaymentStatusPaid,
+		Status:        models.OrderStatusDelivered,
+		Subtotal:      2000,
+		Total:         2000,
+		DeliveredAt:   &delivered,
+	}
+	orderRepo := &memoryOrderRepository{orders: map[primitive.ObjectID]models.Order{order.ID: order}}
+	svc := NewReturnService(&memoryReturnRepository{}, orderRepo)
+	customer := models.OrderActor{Type: models.OrderActorCustomer, ID: order.UserID.Hex()}
+	admin := models.OrderActor{Type: models.OrderActorAdmin, ID: "admin-1"}
+	req := &models.CreateReturnRequest{
+		OrderID: order.ID.Hex(),
+		Items:   []models.CreateReturnItemRequest{{LineIndex: 0, Quantity: 1, Reason: models.ReturnReasonDamaged}},
+	}
+
+	eligibility, err := svc.GetReturnEligibility(order.ID.Hex(), customer)
+	if err != nil || eligibility.Eligible || eligibility.ReturnDeadline == nil {
+		t.Fatalf("expected the return window to have closed, got %+v, %v", eligibility, err)
+	}
+	if _, err := svc.CreateReturn(customer, req); !errors.Is(err, ErrReturnNotAllowed) {
+		t.Fatalf("expected a late return to be refused, got %v", err)
+	}
+
+	recent := time.Now().Add(-time.Hour)
+	order.DeliveredAt = &recent
+	orderRepo.orders[order.ID] = order
+
+	ret, err := svc.CreateReturn(customer, req)
+	if err != nil {
+		t.Fatalf("create return: %v", err)
+	}
+	for _, step := range []func(string, models.OrderActor, string) (*models.ReturnRequest, error){svc.ApproveReturn, svc.MarkReturnReceived} {
+		if _, err := step(ret.ID.Hex(), admin, ""); err != nil {
+			t.Fatalf("advance return: %v", err)
+		}
+	}
+
+	closed, err := svc.RecordQualityCheck(ret.ID.Hex(), admin, &models.QualityCheckRequest{
+		Items: []models.QualityCheckItem{{LineIndex: 0, AcceptedQuantity: 0}},
+		Notes: "Scratches not present at dispatch",
+	})
+	if err != nil {
+		t.Fatalf("quality check: %v", err)
+	}
+	if closed.Status != models.ReturnStatusClosed || closed.QualityCheck.Outcome != models.QualityCheckFailed || closed.RefundAmount != 0 {
+		t.Fatalf("expected a closed return with nothing refunded, got %+v", closed)
+	}
+	if stored := orderRepo.orders[order.ID]; len(stored.Refunds) != 0 || stored.Status != models.OrderStatusDelivered {
+		t.Fatalf("expected the order to be untouched, got %+v", stored)
+	}
+}
@@ -230,19 +230,26 @@ func (s *S3Service) DeleteByURL(ctx context.Context, url string) error {
 		return fmt.Errorf("S3 is not enabled")
 	}
 
-	// Extract key from URL
+	key, err := s.KeyFromURL(url)
+	if err != nil {
+		return err
+	}
+
+	return s.DeleteFile(ctx, key)
+}
+
+// KeyFromURL returns the object key of a file URL returned by an upload
+func (s *S3Service) KeyFromURL(url string) (string, error) {
 	key := strings.TrimPrefix(url, s.baseURL+"/")
 	if key == url {
 		// URL didn't match baseURL, try to extract from S3 URL pattern
 		parts := strings.SplitN(url, ".amazonaws.com/", 2)
-		if len(parts) == 2 {
-			key = parts[1]
-		} else {
-			return fmt.Errorf("could not extract key from URL: %s", url)
+		if len(parts) != 2 {
+			return "", fmt.Errorf("could not extract key from URL: %s", url)
 		}
+		key = parts[1]
 	}
-
-	return s.DeleteFile(ctx, key)
+	return key, nil
 }
 
 // GeneratePresignedURL generates a presigned URL for temporary access
@@ -0,0 +1,402 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// ErrShipmentNotFound is returned when an order has no shipment
+	ErrShipmentNotFound = errors.New("shipment not found")
+	// ErrShipmentExists is returned when booking a second active shipment for an order
+	ErrShipmentExists = errors.New("order already has an active shipment")
+	// ErrShipmentNotAllowed is returned when the order or shipment is in the wrong state
+	ErrShipmentNotAllowed = errors.New("shipment action not allowed")
+)
+
+// shipmentPollBatch is the number of active shipments polled per run
+const shipmentPollBatch = 100
+
+// ShipmentService books shipments with carriers, records their tracking events
+// and moves orders to shipped, out for delivery and delivered as the carrier
+// reports those milestones.
+type ShipmentService interface {
+	ListCarriers() []models.CarrierInfo
+	CreateShipment(orderID string, actor models.OrderActor, req *models.CreateShipmentRequest) (*models.OrderTracking, error)
+	GetShipment(orderID string) (*models.OrderTracking, error)
+	GetLabel(orderID string) (string, error)
+	CancelShipment(orderID string, actor models.OrderActor) (*models.OrderTracking, error)
+	RefreshTracking(orderID string) (*models.OrderTracking, error)
+	AddTrackingEvent(orderID string, actor models.OrderActor, req *models.AddTrackingEventRequest) (*models.OrderTracking, error)
+	HandleWebhook(carrier string, payload []byte, headers http.Header) error
+	PollActiveShipments() error
+}
+
+type shipmentService struct {
+	trackingRepo repository.PDFRepository
+	orderRepo    repository.OrderRepository
+	orderService OrderService
+	carriers     *CarrierRegistry
+}
+
+// NewShipmentService creates a new shipment service. Order status changes go
+// through orderService so shipping and delivery notifications are sent.
+func NewShipmentService(trackingRepo repository.PDFRepository, orderRepo repository.OrderRepository, orderService OrderService, carriers *CarrierRegistry) ShipmentService {
+	return &shipmentService{
+		trackingRepo: trackingRepo,
+		orderRepo:    orderRepo,
+		orderService: orderService,
+		carriers:     carriers,
+	}
+}
+
+// ListCarriers describes the registered carriers
+func (s *shipmentService) ListCarriers() []models.CarrierInfo {
+	return s.carriers.List()
+}
+
+// CreateShipment books a shipment for a confirmed order. A cancelled shipment
+// can be replaced by a new one.
+func (s *shipmentService) CreateShipment(orderID string, actor models.OrderActor, req *models.CreateShipmentRequest) (*models.OrderTracking, error) {
+	ctx := context.Background()
+
+	order, err := s.getOrder(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if order.Status != models.OrderStatusConfirmed && order.Status != models.OrderStatusProcessing {
+		return nil, fmt.Errorf("%w: %s orders cannot be shipped", ErrShipmentNotAllowed, order.Status)
+	}
+
+	existing, err := s.trackingRepo.GetOrderTracking(ctx, order.ID)
+	if err != nil && !errors.Is(err, repository.ErrOrderTrackingNotFound) {
+		return nil, err
+	}
+	if existing != nil && existing.IsActive() {
+		return nil, ErrShipmentExists
+	}
+
+	carrier, err := s.carriers.Get(req.Carrier)
+	if err != nil {
+		return nil, err
+	}
+	booked, err := carrier.CreateShipment(ctx, &CarrierShipmentRequest{
+		Order:          order,
+		Service:        req.Service,
+		Weight:         req.Weight,
+		TrackingNumber: req.TrackingNumber,
+		CourierName:    req.CourierName,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to book shipment with %s: %w", carrier.Name(), err)
+	}
+
+	now := time.Now()
+	tracking := &models.OrderTracking{
+		OrderID:           order.ID,
+		TrackingID:        booked.TrackingID,
+		Carrier:           carrier.Code(),
+		CourierName:       booked.CourierName,
+		ShipmentID:        booked.ShipmentID,
+		LabelURL:          booked.LabelURL,
+		Service:           req.Service,
+		EstimatedDelivery: booked.EstimatedDelivery,
+	}
+	tracking.AddEvents([]models.TrackingEvent{{
+		Status:      models.TrackingStatusCreated,
+		Description: "Shipment booked with " + carrier.Name(),
+		Timestamp:   now,
+	}})
+
+	if existing != nil {
+		// Replace the cancelled shipment so the order keeps a single tracking record
+		tracking.ID = existing.ID
+		tracking.CreatedAt = existing.CreatedAt
+		err = s.trackingRepo.UpdateOrderTracking(ctx, tracking)
+	} else {
+		err = s.trackingRepo.CreateOrderTracking(ctx, tracking)
+	}
+	if err != nil {
+		if cancelErr := carrier.Cancel(ctx, tracking); cancelErr != nil {
+			fmt.Printf("Warning: failed to cancel unsaved %s shipment %s: %v\n", carrier.Code(), tracking.TrackingID, cancelErr)
+		}
+		return nil, err
+	}
+
+	order.TrackingNumber = &tracking.TrackingID
+	order.UpdatedAt = now
+	if err := s.orderRepo.Update(ctx, order); err != nil {
+		fmt.Printf("Warning: failed to save tracking number on order %s: %v\n", order.OrderNumber, err)
+	}
+
+	return tracking, nil
+}
+
+// GetShipment returns the order's shipment and its tracking events
+func (s *shipmentService) GetShipment(orderID string) (*models.OrderTracking, error) {
+	ctx := context.Background()
+	order, err := s.getOrder(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	return s.getTracking(ctx, order.ID)
+}
+
+// GetLabel returns the shipping label URL, fetching it from the carrier when it was not returned at booking
+func (s *shipmentService) GetLabel(orderID string) (string, error) {
+	ctx := context.Background()
+	tracking, err := s.GetShipment(orderID)
+	if err != nil {
+		return "", err
+	}
+	if tracking.LabelURL != "" {
+		return tracking.LabelURL, nil
+	}
+
+	carrier, err := s.carriers.Get(tracking.Carrier)
+	if err != nil {
+		return "", err
+	}
+	label, err := carrier.GetLabel(ctx, tracking)
+	if err != nil {
+		return "", err
+	}
+
+	tracking.LabelURL = label
+	if err := s.trackingRepo.UpdateOrderTracking(ctx, tracking); err != nil {
+		fmt.Printf("Warning: failed to save label for shipment %s: %v\n", tracking.TrackingID, err)
+	}
+	return label, nil
+}
+
+// CancelShipment cancels a shipment the carrier has not picked up yet
+func (s *shipmentService) CancelShipment(orderID string, actor models.OrderActor) (*models.OrderTracking, error) {
+	ctx := context.Background()
+	tracking, err := s.GetShipment(orderID)
+	if err != nil {
+		return nil, err
+	}
+	if tracking.Status != models.TrackingStatusCreated {
+		return nil, fmt.Errorf("%w: a %s shipment cannot be cancelled", ErrShipmentNotAllowed, tracking.Status)
+	}
+
+	carrier, err := s.carriers.Get(tracking.Carrier)
+	if err != nil {
+		return nil, err
+	}
+	if err := carrier.Cancel(ctx, tracking); err != nil {
+		return nil, fmt.Errorf("failed to cancel shipment with %s: %w", carrier.Name(), err)
+	}
+
+	now := time.Now()
+	tracking.AddEvents([]models.TrackingEvent{{
+		Status:      models.TrackingStatusCancelled,
+		Description: "Shipment cancelled by " + string(actor.Type),
+		Timestamp:   now,
+	}})
+	tracking.Status = models.TrackingStatusCancelled
+	tracking.CancelledAt = &now
+	if err := s.trackingRepo.UpdateOrderTracking(ctx, tracking); err != nil {
+		return nil, err
+	}
+	return tracking, nil
+}
+
+// RefreshTracking asks the carrier for the latest events of the order's shipment
+func (s *shipmentService) RefreshTracking(orderID string) (*models.OrderTracking, error) {
+	ctx := context.Background()
+	tracking, err := s.GetShipment(orderID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.poll(ctx, tracking); err != nil {
+		return nil, err
+	}
+	return tracking, nil
+}
+
+// AddTrackingEvent records a tracking update entered by an admin, e.g. for manual shipments
+func (s *shipmentService) AddTrackingEvent(orderID string, actor models.OrderActor, req *models.AddTrackingEventRequest) (*models.OrderTracking, error) {
+	ctx := context.Background()
+	tracking, err := s.GetShipment(orderID)
+	if err != nil {
+		return nil, err
+	}
+	if tracking.Status == models.TrackingStatusCancelled {
+		return nil, fmt.Errorf("%w: the shipment was cancelled", ErrShipmentNotAllowed)
+	}
+
+	event := models.TrackingEvent{
+		Status:      req.Status,
+		Description: req.Description,
+		Location:    req.Location,
+		SignedBy:    req.SignedBy,
+		Timestamp:   time.Now(),
+		Notes:       "Entered by " + string(actor.Type) + " " + actor.ID,
+	}
+	if req.Timestamp != nil {
+		event.Timestamp = *req.Timestamp
+	}
+
+	if err := s.ingest(ctx, tracking, []models.TrackingEvent{event}); err != nil {
+		return nil, err
+	}
+	return tracking, nil
+}
+
+// HandleWebhook ingests the tracking events a carrier pushes. Events already
+// recorded are skipped, so repeated deliveries are harmless.
+func (s *shipmentService) HandleWebhook(carrierCode string, payload []byte, headers http.Header) error {
+	carrier, err := s.carriers.Get(carrierCode)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	event, err := carrier.ParseWebhook(ctx, payload, headers)
+	if err != nil {
+		return err
+	}
+
+	tracking, err := s.trackingRepo.GetOrderTrackingByTrackingID(ctx, carrier.Code(), event.TrackingID)
+	if err != nil {
+		if errors.Is(err, repository.ErrOrderTrackingNotFound) {
+			return fmt.Errorf("%w: %s", ErrShipmentNotFound, event.TrackingID)
+		}
+		return err
+	}
+	return s.ingest(ctx, tracking, event.Events)
+}
+
+// PollActiveShipments refreshes shipments whose carrier can be polled, least
+// recently polled first
+func (s *shipmentService) PollActiveShipments() error {
+	ctx := context.Background()
+	trackings, err := s.trackingRepo.ListActiveOrderTracking(ctx, shipmentPollBatch)
+	if err != nil {
+		return err
+	}
+
+	for i := range trackings {
+		if err := s.poll(ctx, &trackings[i]); err != nil {
+			fmt.Printf("Warning: failed to poll shipment %s: %v\n", trackings[i].TrackingID, err)
+		}
+	}
+	return nil
+}
+
+// poll fetches the carrier's events for a shipment and ingests them
+func (s *shipmentService) poll(ctx context.Context, tracking *models.OrderTracking) error {
+	if !tracking.IsActive() {
+		return nil
+	}
+	carrier, err := s.carriers.Get(tracking.Carrier)
+	if err != nil {
+		return err
+	}
+	events, err := carrier.Track(ctx, tracking)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	tracking.LastPolledAt = &now
+	return s.ingest(ctx, tracking, events)
+}
+
+// ingest records new tracking events, saves the shipment and advances the order
+// to the furthest milestone reached
+func (s *shipmentService) ingest(ctx context.Context, tracking *models.OrderTracking, events []models.TrackingEvent) error {
+	added := tracking.AddEvents(events)
+	if err := s.trackingRepo.UpdateOrderTracking(ctx, tracking); err != nil {
+		return err
+	}
+
+	var target models.OrderStatus
+	var milestone models.TrackingEvent
+	for _, event := range added {
+		if status, ok := models.TrackingMilestone(event.Status); ok && orderProgress(status) > orderProgress(target) {
+			target, milestone = status, event
+		}
+	}
+	if target == "" {
+		return nil
+	}
+	return s.advanceOrder(ctx, tracking, target, milestone)
+}
+
+// advanceOrder moves the order forward to target, passing through shipped when
+// the carrier reports a later milestone first. Orders that are already further
+// along, or were never confirmed, are left alone.
+func (s *shipmentService) advanceOrder(ctx context.Context, tracking *models.OrderTracking, target models.OrderStatus, milestone models.TrackingEvent) error {
+	order, err := s.orderRepo.GetByID(ctx, tracking.OrderID)
+	if err != nil {
+		return err
+	}
+	current := orderProgress(order.Status)
+	if current < 0 || current >= orderProgress(target) {
+		return nil
+	}
+
+	steps := []models.OrderStatus{target}
+	if target != models.OrderStatusShipped && current < orderProgress(models.OrderStatusShipped) {
+		steps = []models.OrderStatus{models.OrderStatusShipped, target}
+	}
+
+	actor := models.OrderActor{Type: models.OrderActorSystem, ID: tracking.Carrier}
+	note := milestone.Description
+	if note == "" {
+		note = "Carrier reported " + milestone.Status
+	}
+	for _, status := range steps {
+		if err := s.orderService.UpdateOrderStatus(order.ID.Hex(), status, &tracking.TrackingID, actor, note); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// orderProgress ranks the statuses a shipment moves an order through. Orders
+// that cannot be shipped rank -1.
+func orderProgress(status models.OrderStatus) int {
+	switch status {
+	case "":
+		return 0
+	case models.OrderStatusConfirmed, models.OrderStatusProcessing:
+		return 1
+	case models.OrderStatusShipped:
+		return 2
+	case models.OrderStatusOutForDelivery:
+		return 3
+	case models.OrderStatusDelivered:
+		return 4
+	}
+	return -1
+}
+
+func (s *shipmentService) getOrder(ctx context.Context, orderID string) (*models.Order, error) {
+	objID, err := primitive.ObjectIDFromHex(orderID)
+	if err != nil {
+		return nil, errors.New("invalid order ID")
+	}
+	return s.orderRepo.GetByID(ctx, objID)
+}
+
+func (s *shipmentService) getTracking(ctx context.Context, orderID primitive.ObjectID) (*models.OrderTracking, error) {
+	tracking, err := s.trackingRepo.GetOrderTracking(ctx, orderID)
+	if err != nil {
+		if errors.Is(err, repository.ErrOrderTrackingNotFound) {
+			return nil, ErrShipmentNotFound
+		}
+		return nil, err
+	}
+	return tracking, nil
+}
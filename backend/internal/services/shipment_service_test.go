@@ -0,0 +1,232 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"thyne-jewels-backend/internal/config"
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memoryTrackingRepository keeps order tracking in memory
+type memoryTrackingRepository struct {
+	repository.PDFRepository
+	trackings map[primitive.ObjectID]models.OrderTracking // By order ID
+}
+
+func (r *memoryTrackingRepository) GetOrderTracking(ctx context.Context, orderID primitive.ObjectID) (*models.OrderTracking, error) {
+	tracking, ok := r.trackings[orderID]
+	if !ok {
+		return nil, repository.ErrOrderTrackingNotFound
+	}
+	return &tracking, nil
+}
+
+func (r *memoryTrackingRepository) GetOrderTrackingByTrackingID(ctx context.Context, carrier string, trackingID string) (*models.OrderTracking, error) {
+	for _, tracking := range r.trackings {
+		if tracking.Carrier == carrier && tracking.TrackingID == trackingID {
+			return &tracking, nil
+		}
+	}
+	return nil, repository.ErrOrderTrackingNotFound
+}
+
+func (r *memoryTrackingRepository) CreateOrderTracking(ctx context.Context, tracking *models.OrderTracking) error {
+	tracking.ID = primitive.NewObjectID()
+	r.trackings[tracking.OrderID] = *tracking
+	return nil
+}
+
+func (r *memoryTrackingRepository) UpdateOrderTracking(ctx context.Context, tracking *models.OrderTracking) error {
+	r.trackings[tracking.OrderID] = *tracking
+	return nil
+}
+
+func (r *memoryTrackingRepository) ListActiveOrderTracking(ctx context.Context, limit int) ([]models.OrderTracking, error) {
+	var trackings []models.OrderTracking
+	for _, tracking := range r.trackings {
+		if tracking.IsActive() {
+			trackings = append(trackings, tracking)
+		}
+	}
+	return trackings, nil
+}
+
+// fakeCourier serves the courier API the HTTP carrier talks to
+type fakeCourier struct {
+	scans     []httpCarrierEvent
+	cancelled bool
+}
+
+func (f *fakeCourier) handler(t *testing.T) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/shipments", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var req httpCarrierShipmentRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Deliver.Pincode != "560001" {
+			t.Errorf("unexpected shipment request %+v, %v", req, err)
+		}
+		json.NewEncoder(w).Encode(httpCarrierShipment{ShipmentID: "SHP-1", AWB: "AWB900", Courier: "Blue Courier", LabelURL: "https://labels.example/AWB900.pdf"})
+	})
+	mux.HandleFunc("/shipments/SHP-1/tracking", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"events": f.scans})
+	})
+	mux.HandleFunc("/shipments/SHP-1/cancel", func(w http.ResponseWriter, r *http.Request) {
+		f.cancelled = true
+		w.WriteHeader(http.StatusOK)
+	})
+	return mux
+}
+
+func TestShipmentTrackingAdvancesOrder(t *testing.T) {
+	courier := &fakeCourier{}
+	server := httptest.NewServer(courier.handler(t))
+	defer server.Close()
+
+	order := models.Order{
+		ID:              primitive.NewObjectID(),
+		OrderNumber:     "TJ-4001",
+		Items:           []models.OrderItem{{ProductID: primitive.NewObjectID(), Name: "Bangle", Price: 8000, Quantity: 1}},
+		ShippingAddress: models.Address{City: "Bengaluru", State: "Karnataka", Pincode: "560001"},
+		PaymentMethod:   models.PaymentMethodRazorpay,
+		PaymentStatus:   models.PaymentStatusPaid,
+		Status:          models.OrderStatusConfirmed,
+		Total:           8240,
+	}
+	orderRepo := &memoryOrderRepository{orders: map[primitive.ObjectID]models.Order{order.ID: order}}
+	trackingRepo := &memoryTrackingRepository{trackings: make(map[primitive.ObjectID]models.OrderTracking)}
+	carrier := NewHTTPCarrier(config.CarrierConfig{Code: "courier", Name: "Courier", APIURL: server.URL, APIKey: "test-key", WebhookSecret: "hook-secret"})
+	svc := NewShipmentService(trackingRepo, orderRepo, NewOrderService(orderRepo, nil, nil), NewCarrierRegistry(NewManualCarrier(), carrier))
+	admin := models.OrderActor{Type: models.OrderActorAdmin, ID: "admin-1"}
+	orderID := order.ID.Hex()
+
+	tracking, err := svc.CreateShipment(orderID, admin, &models.CreateShipmentRequest{Carrier: "courier", Weight: 40})
+	if err != nil {
+		t.Fatalf("create shipment: %v", err)
+	}
+	if tracking.TrackingID != "AWB900" || tracking.Status != models.TrackingStatusCreated || tracking.LabelURL == "" {
+		t.Fatalf("unexpected shipment %+v", tracking)
+	}
+	if stored := orderRepo.orders[order.ID]; stored.TrackingNumber == nil || *stored.TrackingNumber != "AWB900" || stored.Status != models.OrderStatusConfirmed {
+		t.Fatalf("expected the AWB on a still confirmed order, got %+v", stored)
+	}
+	if _, err := svc.CreateShipment(orderID, admin, &models.CreateShipmentRequest{Carrier: "courier"}); !errors.Is(err, ErrShipmentExists) {
+		t.Fatalf("expected a second shipment to be refused, got %v", err)
+	}
+
+	// Polling picks up the pickup scan
+	pickedUp := time.Now().Add(time.Minute).UTC().Truncate(time.Second)
+	courier.scans = []httpCarrierEvent{{Status: "Picked Up", Location: "Mumbai Hub", Timestamp: pickedUp}}
+	if err := svc.PollActiveShipments(); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	if stored := orderRepo.orders[order.ID]; stored.Status != models.OrderStatusShipped || stored.ShippedAt == nil {
+		t.Fatalf("expected the pickup to ship the order, got %s", stored.Status)
+	}
+	if _, err := svc.CancelShipment(orderID, admin); !errors.Is(err, ErrShipmentNotAllowed) {
+		t.Fatalf("expected a picked up shipment not to be cancellable, got %v", err)
+	}
+
+	// A signed webhook reports delivery; the repeated pickup scan is ignored
+	payload, _ := json.Marshal(map[string]interface{}{
+		"awb": "AWB900",
+		"events": []httpCarrierEvent{
+			{Status: "picked_up", Location: "Mumbai Hub", Timestamp: pickedUp},
+			{Status: "Out-For-Delivery", Location: "Bengaluru", Timestamp: pickedUp.Add(time.Hour)},
+			{Status: "delivered", Location: "Bengaluru", Timestamp: pickedUp.Add(90 * time.Minute), SignedBy: "Customer"},
+		},
+	})
+	headers := http.Header{}
+	headers.Set("X-Carrier-Signature", "bad")
+	if err := svc.HandleWebhook("courier", payload, headers); !errors.Is(err, ErrInvalidCarrierSignature) {
+		t.Fatalf("expected an unsigned webhook to be rejected, got %v", err)
+	}
+	mac := hmac.New(sha256.New, []byte("hook-secret"))
+	mac.Write(payload)
+	headers.Set("X-Carrier-Signature", hex.EncodeToString(mac.Sum(nil)))
+	if err := svc.HandleWebhook("courier", payload, headers); err != nil {
+		t.Fatalf("webhook: %v", err)
+	}
+
+	stored := orderRepo.orders[order.ID]
+	if stored.Status != models.OrderStatusDelivered || stored.DeliveredAt == nil {
+		t.Fatalf("expected the order to be delivered, got %s", stored.Status)
+	}
+	last := stored.StatusHistory[len(stored.StatusHistory)-1]
+	if last.Actor.Type != models.OrderActorSystem || last.Actor.ID != "courier" {
+		t.Fatalf("expected the carrier to be recorded as the actor, got %+v", last)
+	}
+
+	tracking, err = svc.GetShipment(orderID)
+	if err != nil {
+		t.Fatalf("get shipment: %v", err)
+	}
+	if len(tracking.Events) != 4 || tracking.Status != models.TrackingStatusDelivered || tracking.ActualDelivery == nil || tracking.IsActive() {
+		t.Fatalf("unexpected tracking %+v", tracking)
+	}
+}
+
+func TestManualShipmentTrackedByHand(t *testing.T) {
+	order := models.Order{
+		ID:            primitive.NewObjectID(),
+		OrderNumber:   "TJ-4002",
+		PaymentMethod: models.PaymentMethodCOD,
+		Status:        models.OrderStatusProcessing,
+	}
+	orderRepo := &memoryOrderRepository{orders: map[primitive.ObjectID]models.Order{order.ID: order}}
+	trackingRepo := &memoryTrackingRepository{trackings: make(map[primitive.ObjectID]models.OrderTracking)}
+	svc := NewShipmentService(trackingRepo, orderRepo, NewOrderService(orderRepo, nil, nil), NewCarrierRegistry(NewManualCarrier()))
+	admin := models.OrderActor{Type: models.OrderActorAdmin, ID: "admin-1"}
+	orderID := order.ID.Hex()
+
+	if _, err := svc.CreateShipment(orderID, admin, &models.CreateShipmentRequest{Carrier: "manual"}); err == nil {
+		t.Fatal("expected a manual shipment without an AWB number to be refused")
+	}
+	first, err := svc.CreateShipment(orderID, admin, &models.CreateShipmentRequest{Carrier: "manual", TrackingNumber: "DTDC123", CourierName: "DTDC"})
+	if err != nil {
+		t.Fatalf("create shipment: %v", err)
+	}
+	if _, err := svc.GetLabel(orderID); !errors.Is(err, ErrCarrierOperationUnsupported) {
+		t.Fatalf("expected no label for a manual shipment, got %v", err)
+	}
+
+	// A cancelled shipment can be replaced
+	if _, err := svc.CancelShipment(orderID, admin); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	second, err := svc.CreateShipment(orderID, admin, &models.CreateShipmentRequest{Carrier: "manual", TrackingNumber: "DTDC456"})
+	if err != nil || second.ID != first.ID || second.TrackingID != "DTDC456" {
+		t.Fatalf("expected the cancelled shipment to be replaced, got %+v, %v", second, err)
+	}
+
+	// Out for delivery before any pickup scan still passes through shipped
+	if _, err := svc.AddTrackingEvent(orderID, admin, &models.AddTrackingEventRequest{Status: models.TrackingStatusOutForDelivery, Location: "Pune"}); err != nil {
+		t.Fatalf("add event: %v", err)
+	}
+	stored := orderRepo.orders[order.ID]
+	if stored.Status != models.OrderStatusOutForDelivery || stored.ShippedAt == nil {
+		t.Fatalf("expected the order to be out for delivery, got %s", stored.Status)
+	}
+
+	// Non-milestone updates leave the order alone
+	if _, err := svc.AddTrackingEvent(orderID, admin, &models.AddTrackingEventRequest{Status: "exception", Description: "Customer not available"}); err != nil {
+		t.Fatalf("add exception: %v", err)
+	}
+	if stored := orderRepo.orders[order.ID]; stored.Status != models.OrderStatusOutForDelivery {
+		t.Fatalf("expected an exception not to move the order, got %s", stored.Status)
+	}
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/repository"
+)
+
+var (
+	// ErrNotServiceable is returned when the store does not deliver to a pincode
+	ErrNotServiceable = errors.New("delivery is not available to this pincode")
+	// ErrCODNotAvailable is returned when cash on delivery cannot be used for an order
+	ErrCODNotAvailable = errors.New("cash on delivery is not available for this order")
+)
+
+// ShippingService quotes shipping charges and checks whether pincodes are served
+type ShippingService interface {
+	Quote(ctx context.Context, pincode string, parcel models.Parcel) (*models.ShippingQuote, error)
+	CheckServiceability(ctx context.Context, pincode string) (*models.Serviceability, error)
+}
+
+type shippingService struct {
+	storefrontRepo *repository.StorefrontDataRepository
+}
+
+// NewShippingService creates a new shipping service
+func NewShippingService() ShippingService {
+	return &shippingService{}
+}
+
+// SetStorefrontRepo enables the store's shipping zones, rates and COD settings
+func (s *shippingService) SetStorefrontRepo(storefrontRepo *repository.StorefrontDataRepository) {
+	s.storefrontRepo = storefrontRepo
+}
+
+// Quote returns the shipping charge and COD terms for a parcel
+func (s *shippingService) Quote(ctx context.Context, pincode string, parcel models.Parcel) (*models.ShippingQuote, error) {
+	settings, err := s.settings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return quoteShipping(settings, pincode, parcel), nil
+}
+
+// CheckServiceability tells whether the store delivers to a pincode
+func (s *shippingService) CheckServiceability(ctx context.Context, pincode string) (*models.Serviceability, error) {
+	if !validPincode(pincode) {
+		return nil, errors.New("pincode must be 6 digits")
+	}
+
+	settings, err := s.settings(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.Serviceability{Pincode: pincode}
+	if zone, ok := settings.ShippingZoneFor(pincode); ok {
+		result.Serviceable = true
+		result.Zone = zone.Name
+		result.EstimatedDays = zone.EstimatedDays
+		result.CODAvailable = settings.EnableCOD && zone.CODAvailable
+	}
+	return result, nil
+}
+
+func (s *shippingService) settings(ctx context.Context) (*models.StoreSettings, error) {
+	if s.storefrontRepo == nil {
+		return models.DefaultStoreSettings(), nil
+	}
+	settings, err := s.storefrontRepo.GetStoreSettings(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load store settings: %w", err)
+	}
+	return settings, nil
+}
+
+// quoteShipping prices a parcel to a pincode. The zone rate covers the first
+// weight slab and each further slab adds the zone's slab rate; it is waived
+// above the free shipping threshold. Parcels worth more than the insurance
+// threshold always pay the insurance surcharge. COD is offered when the zone
+// allows it and the order total with the COD charge is within the COD limit.
+func quoteShipping(settings *models.StoreSettings, pincode string, parcel models.Parcel) *models.ShippingQuote {
+	quote := &models.ShippingQuote{
+		Pincode: strings.TrimSpace(pincode),
+		Weight:  parcel.Weight,
+	}
+
+	zone, ok := settings.ShippingZoneFor(quote.Pincode)
+	if !ok {
+		quote.Message = "We do not deliver to this pincode yet"
+		return quote
+	}
+	quote.Serviceable = true
+	quote.Zone = zone.Name
+	quote.EstimatedDays = zone.EstimatedDays
+
+	quote.Slabs = int(math.Ceil(parcel.Weight / settings.ShippingSlab()))
+	if quote.Slabs < 1 {
+		quote.Slabs = 1
+	}
+
+	if settings.EnableFreeShipping && parcel.Value >= settings.FreeShippingThreshold {
+		quote.FreeShipping = true
+	} else {
+		quote.ZoneCharge = roundPrice(zone.BaseRate + zone.AdditionalSlabRate*float64(quote.Slabs-1))
+	}
+	if settings.InsuranceRate > 0 && parcel.Value > settings.InsuranceThreshold {
+		quote.InsuranceCharge = roundPrice(parcel.Value * settings.InsuranceRate / 100)
+	}
+	quote.Shipping = roundPrice(quote.ZoneCharge + quote.InsuranceCharge)
+
+	switch {
+	case !settings.EnableCOD:
+		quote.Message = "Cash on delivery is not offered"
+	case !zone.CODAvailable:
+		quote.Message = "Cash on delivery is not available to this pincode"
+	case settings.CODMaxAmount > 0 && parcel.Value+parcel.Tax+quote.Shipping+settings.CODCharge > settings.CODMaxAmount:
+		quote.Message = fmt.Sprintf("Cash on delivery is available for orders up to %.2f", settings.CODMaxAmount)
+	default:
+		quote.CODAvailable = true
+		quote.CODCharge = settings.CODCharge
+	}
+
+	return quote
+}
+
+// parcelWeight returns the weight in grams of quantity units of a product.
+// Products without a weight add nothing.
+func parcelWeight(product *models.Product, quantity int) float64 {
+	if product.Weight == nil || *product.Weight <= 0 {
+		return 0
+	}
+	return *product.Weight * float64(quantity)
+}
+
+// validPincode checks that a pincode is six digits
+func validPincode(pincode string) bool {
+	if len(pincode) != 6 {
+		return false
+	}
+	for _, r := range pincode {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
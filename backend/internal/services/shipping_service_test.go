@@ -0,0 +1,59 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"thyne-jewels-backend/internal/models"
+)
+
+func TestShippingQuoteByZoneWeightAndValue(t *testing.T) {
+	settings := models.DefaultStoreSettings()
+
+	local := quoteShipping(settings, "400001", models.Parcel{Weight: 1200, Value: 800, Tax: 24})
+	// Three 500g slabs: 49 for the first and 20 for each of the others
+	if !local.Serviceable || local.Zone != "Local" || local.Slabs != 3 || local.Shipping != 89 {
+		t.Fatalf("unexpected local quote %+v", local)
+	}
+	if !local.CODAvailable || local.CODCharge != settings.CODCharge {
+		t.Fatalf("expected COD for a small local order, got %+v", local)
+	}
+
+	remote := quoteShipping(settings, "744101", models.Parcel{Weight: 50, Value: 800})
+	if remote.Zone != "Remote" || remote.Shipping != 199 || remote.CODAvailable {
+		t.Fatalf("expected the longer remote prefix to win without COD, got %+v", remote)
+	}
+
+	insured := quoteShipping(settings, "560001", models.Parcel{Weight: 40, Value: 60000, Tax: 1800})
+	if !insured.FreeShipping || insured.ZoneCharge != 0 || insured.InsuranceCharge != 300 || insured.Shipping != 300 {
+		t.Fatalf("expected free shipping with a 0.5%% insurance surcharge, got %+v", insured)
+	}
+	if insured.CODAvailable || insured.Message == "" {
+		t.Fatalf("expected COD to be refused above the COD limit, got %+v", insured)
+	}
+
+	if blocked := quoteShipping(settings, "999999", models.Parcel{Value: 800}); blocked.Serviceable || blocked.Shipping != 0 {
+		t.Fatalf("expected an unknown pincode to be unserviceable, got %+v", blocked)
+	}
+
+	settings.ShippingZones = nil
+	if legacy := quoteShipping(settings, "999999", models.Parcel{Value: 800}); !legacy.Serviceable || legacy.Shipping != settings.ShippingCost {
+		t.Fatalf("expected stores without zones to ship everywhere at the standard cost, got %+v", legacy)
+	}
+}
+
+func TestShippingServiceability(t *testing.T) {
+	svc := NewShippingService()
+
+	if _, err := svc.CheckServiceability(context.Background(), "4000"); err == nil {
+		t.Fatal("expected a short pincode to be rejected")
+	}
+
+	result, err := svc.CheckServiceability(context.Background(), "110001")
+	if err != nil {
+		t.Fatalf("check serviceability: %v", err)
+	}
+	if !result.Serviceable || result.Zone != "Metro" || result.EstimatedDays != 3 || !result.CODAvailable {
+		t.Fatalf("unexpected serviceability %+v", result)
+	}
+}
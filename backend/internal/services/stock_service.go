@@ -0,0 +1,1152 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// stockReservationTTL is how long an unpaid order holds its stock before it is released
+const stockReservationTTL = 30 * time.Minute
+
+var (
+	// ErrInvalidStockAdjustment is returned when a manual stock change cannot be applied
+	ErrInvalidStockAdjustment = errors.New("invalid stock adjustment")
+	// ErrInvalidStockTransfer is returned when stock cannot be moved between locations as asked
+	ErrInvalidStockTransfer = errors.New("invalid stock transfer")
+)
+
+// staffActor records stock entered through the admin product and variant
+// forms, which do not identify the admin
+var staffActor = models.OrderActor{Type: models.OrderActorAdmin}
+
+// StockService reserves, commits and restocks product inventory for orders.
+// Methods update the order's stock fields in place; callers persist the order.
+// Every change is written to the stock movement ledger, including the manual
+// adjustments, imports and write-offs made by staff.
+//
+// Once stock locations are set up, stock is held per location: orders are
+// allocated to a location serving the delivery pincode, and stock entered
+// without a location is held at the default location.
+type StockService interface {
+	ReserveOrderStock(ctx context.Context, order *models.Order, products map[primitive.ObjectID]*models.Product) error
+	CommitOrderStock(ctx context.Context, order *models.Order) error
+	ReleaseOrderStock(ctx context.Context, order *models.Order, reason string) error
+	RestockReturnedOrder(ctx context.Context, order *models.Order, reason string) error
+	RestockReturnedItems(ctx context.Context, order *models.Order, quantities map[int]int, reason string) error
+
+	// Manual changes
+	AdjustStock(ctx context.Context, product *models.Product, req *models.StockAdjustmentRequest, actor models.OrderActor) (*models.StockMovement, error)
+	SetStock(ctx context.Context, product *models.Product, variantID *primitive.ObjectID, quantity int, reason string, actor models.OrderActor) (*models.StockMovement, error)
+	RecordOpeningStock(ctx context.Context, product *models.Product, reference string, actor models.OrderActor)
+	ImportStockCSV(ctx context.Context, file io.Reader, reference string, actor models.OrderActor) ([]models.StockMovement, error)
+	GetLedger(ctx context.Context, filter models.StockLedgerFilter) ([]models.StockMovement, int64, error)
+
+	// Low stock
+	GetLowStockReport(ctx context.Context) ([]models.LowStockProduct, error)
+	RaiseLowStockAlerts(ctx context.Context) (int, error)
+
+	// Locations
+	AssignUnlocatedStock(ctx context.Context, location *models.StockLocation) (int64, error)
+	DispatchTransfer(ctx context.Context, transfer *models.StockTransfer, actor models.OrderActor) error
+	ReceiveTransfer(ctx context.Context, transfer *models.StockTransfer, actor models.OrderActor)
+	ReturnTransfer(ctx context.Context, transfer *models.StockTransfer, actor models.OrderActor)
+}
+
+type stockService struct {
+	stockRepo             repository.StockRepository
+	adminNotificationRepo repository.AdminNotificationRepository
+	locationRepo          repository.StockLocationRepository
+	backInStockService    BackInStockService
+	productRepo           repository.ProductRepository
+	variantRepo           repository.VariantRepository
+}
+
+// NewStockService creates a new stock service
+func NewStockService(stockRepo repository.StockRepository) StockService {
+	return &stockService{stockRepo: stockRepo}
+}
+
+// SetAdminNotificationRepository sets where low-stock alerts are raised.
+// Without it RaiseLowStockAlerts does nothing.
+func (s *stockService) SetAdminNotificationRepository(adminNotificationRepo repository.AdminNotificationRepository) {
+	s.adminNotificationRepo = adminNotificationRepo
+}
+
+// SetStockLocationRepository sets the locations stock is held at. Without it,
+// or before the first location is added, stock is held as one total.
+func (s *stockService) SetStockLocationRepository(locationRepo repository.StockLocationRepository) {
+	s.locationRepo = locationRepo
+}
+
+// SetProductRepository sets where stock imports look products up by ID, and
+// where a lapsed reservation finds the stock of the order's locations. Without
+// it ImportStockCSV fails.
+func (s *stockService) SetProductRepository(productRepo repository.ProductRepository) {
+	s.productRepo = productRepo
+}
+
+// SetVariantRepository sets where stock imports look variants up by SKU or barcode
+func (s *stockService) SetVariantRepository(variantRepo repository.VariantRepository) {
+	s.variantRepo = variantRepo
+}
+
+// SetBackInStockService sets who is alerted when a manual change brings a
+// product or variant back into stock
+func (s *stockService) SetBackInStockService(backInStockService BackInStockService) {
+	s.backInStockService = backInStockService
+}
+
+// ReserveOrderStock atomically takes stock for every stocked line of the order.
+// With stock locations, the order is allocated to the first location holding
+// every line, trying those that serve the delivery pincode before the others
+// by priority; a line no such location holds is taken whole from the first
+// location that holds it. If any line cannot be reserved, lines already
+// reserved are released again.
+func (s *stockService) ReserveOrderStock(ctx context.Context, order *models.Order, products map[primitive.ObjectID]*models.Product) error {
+	allocation, err := s.allocate(ctx, order, products)
+	if err != nil {
+		return err
+	}
+
+	reserved := 0
+	for i := range order.Items {
+		item := &order.Items[i]
+		product, ok := products[item.ProductID]
+		if !ok {
+			return fmt.Errorf("product %s not found", item.ProductID.Hex())
+		}
+		if product.StockType == models.StockTypeMadeToOrder {
+			continue
+		}
+
+		var balance int
+		if allocation != nil {
+			balance, err = s.reserveAllocated(ctx, item, product, allocation)
+		} else {
+			balance, err = s.reserve(ctx, item, item.Quantity)
+		}
+		if err != nil {
+			s.rollbackReservation(ctx, order)
+			return fmt.Errorf("%s is out of stock", product.Name)
+		}
+
+		item.StockReserved = true
+		reserved++
+		s.recordMovement(ctx, order, item, models.StockMovementReserve, -item.Quantity, &balance, "Reserved at checkout")
+	}
+
+	if reserved > 0 {
+		until := time.Now().Add(stockReservationTTL)
+		order.StockStatus = models.StockReservationReserved
+		order.StockReservedUntil = &until
+	}
+	order.FulfillmentLocationID = fulfillmentLocation(order)
+
+	return nil
+}
+
+// stockAllocation ranks the locations an order's lines can be taken from
+type stockAllocation struct {
+	locations []models.StockLocation // Active, those serving the delivery pincode first
+	defaultID primitive.ObjectID
+	preferred *primitive.ObjectID // Holds every stocked line of the order, when one does
+}
+
+// allocate ranks the active locations for the order. It returns nil before
+// stock locations are set up.
+func (s *stockService) allocate(ctx context.Context, order *models.Order, products map[primitive.ObjectID]*models.Product) (*stockAllocation, error) {
+	defaultLocation, err := s.defaultLocation(ctx)
+	if err != nil || defaultLocation == nil {
+		return nil, err
+	}
+	locations, err := s.locationRepo.GetAll(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	pincode := order.ShippingAddress.Pincode
+	sort.SliceStable(locations, func(i, j int) bool {
+		return locations[i].ServesPincode(pincode) && !locations[j].ServesPincode(pincode)
+	})
+
+	allocation := &stockAllocation{locations: locations, defaultID: defaultLocation.ID}
+	for i := range locations {
+		if allocation.holdsOrder(order, products, locations[i].ID) {
+			allocation.preferred = &locations[i].ID
+			break
+		}
+	}
+	return allocation, nil
+}
+
+// held returns the units of a line the product snapshot shows at the
+// location. Stock not yet held per location, such as that of a variant added
+// since, is at the default location.
+func (a *stockAllocation) held(product *models.Product, variantID *primitive.ObjectID, locationID primitive.ObjectID) int {
+	if located(product, variantID) {
+		return product.LocationQuantity(locationID, variantID)
+	}
+	if locationID != a.defaultID {
+		return 0
+	}
+	if variantID != nil {
+		if variant := product.FindVariant(*variantID); variant != nil {
+			return variant.StockQuantity
+		}
+		return 0
+	}
+	return product.StockQuantity
+}
+
+func (a *stockAllocation) holdsOrder(order *models.Order, products map[primitive.ObjectID]*models.Product, locationID primitive.ObjectID) bool {
+	for _, item := range order.Items {
+		product, ok := products[item.ProductID]
+		if !ok || product.StockType == models.StockTypeMadeToOrder {
+			continue
+		}
+		if a.held(product, item.VariantID, locationID) < item.Quantity {
+			return false
+		}
+	}
+	return true
+}
+
+// candidates lists the locations a line is tried at, in order
+func (a *stockAllocation) candidates(product *models.Product, item *models.OrderItem) []primitive.ObjectID {
+	var ids []primitive.ObjectID
+	if a.preferred != nil {
+		ids = append(ids, *a.preferred)
+	}
+	for _, location := range a.locations {
+		if a.preferred != nil && location.ID == *a.preferred {
+			continue
+		}
+		if a.held(product, item.VariantID, location.ID) >= item.Quantity {
+			ids = append(ids, location.ID)
+		}
+	}
+	return ids
+}
+
+// reserveAllocated takes a line's units from the first candidate location
+// that still holds them, and records the location on the line
+func (s *stockService) reserveAllocated(ctx context.Context, item *models.OrderItem, product *models.Product, allocation *stockAllocation) (int, error) {
+	if !located(product, item.VariantID) {
+		if err := s.locate(ctx, product.ID, allocation.defaultID); err != nil {
+			return 0, err
+		}
+	}
+
+	for _, locationID := range allocation.candidates(product, item) {
+		balance, err := s.stockRepo.ReserveAt(ctx, item.ProductID, item.VariantID, locationID, item.Quantity)
+		if err == nil {
+			id := locationID
+			item.LocationID = &id
+			return balance, nil
+		}
+	}
+	return 0, fmt.Errorf("insufficient stock")
+}
+
+// located reports whether the stock of the line is held per location
+func located(product *models.Product, variantID *primitive.ObjectID) bool {
+	for _, entry := range product.LocationStock {
+		if variantID == nil || (entry.VariantID != nil && *entry.VariantID == *variantID) {
+			return true
+		}
+	}
+	return false
+}
+
+// fulfillmentLocation returns the location every reserved line was taken
+// from, or nil when they were split or none was
+func fulfillmentLocation(order *models.Order) *primitive.ObjectID {
+	var location *primitive.ObjectID
+	for _, item := range order.Items {
+		if !item.StockReserved || item.LocationID == nil {
+			continue
+		}
+		if location != nil && *location != *item.LocationID {
+			return nil
+		}
+		location = item.LocationID
+	}
+	return location
+}
+
+// CommitOrderStock turns the order's reservation into a sale. If the reservation
+// already lapsed, the stock is taken again before committing, from the
+// order's fulfilment location while it still holds every line and otherwise
+// allocated as at checkout.
+func (s *stockService) CommitOrderStock(ctx context.Context, order *models.Order) error {
+	switch order.StockStatus {
+	case models.StockReservationReserved:
+		// stock was already taken at checkout
+	case models.StockReservationReleased:
+		allocation, products, err := s.reallocate(ctx, order)
+		if err != nil {
+			return err
+		}
+
+		var taken []*models.OrderItem
+		for i := range order.Items {
+			item := &order.Items[i]
+			if !item.StockReserved {
+				continue
+			}
+			var balance int
+			if allocation != nil {
+				balance, err = s.reserveAllocated(ctx, item, products[item.ProductID], allocation)
+			} else {
+				balance, err = s.reserve(ctx, item, item.Quantity)
+			}
+			if err != nil {
+				for _, t := range taken {
+					if balance, relErr := s.release(ctx, t, t.Quantity); relErr == nil {
+						s.recordMovement(ctx, order, t, models.StockMovementRelease, t.Quantity, &balance, "Late payment could not be fulfilled")
+					}
+				}
+				return fmt.Errorf("failed to re-reserve %s for order %s: %w", item.Name, order.OrderNumber, err)
+			}
+			taken = append(taken, item)
+			s.recordMovement(ctx, order, item, models.StockMovementReserve, -item.Quantity, &balance, "Re-reserved after late payment")
+		}
+		order.FulfillmentLocationID = fulfillmentLocation(order)
+	default:
+		return nil
+	}
+
+	for i := range order.Items {
+		item := &order.Items[i]
+		if item.StockReserved {
+			s.recordMovement(ctx, order, item, models.StockMovementSale, 0, nil, "Order confirmed")
+		}
+	}
+
+	order.StockStatus = models.StockReservationCommitted
+	order.StockReservedUntil = nil
+	return nil
+}
+
+// reallocate ranks the locations a lapsed reservation is taken again from,
+// trying the order's fulfilment location first while it holds every line. It
+// returns nil before stock locations are set up or without the product
+// repository, when lines are taken again where they were released.
+func (s *stockService) reallocate(ctx context.Context, order *models.Order) (*stockAllocation, map[primitive.ObjectID]*models.Product, error) {
+	if s.productRepo == nil {
+		return nil, nil, nil
+	}
+
+	products := make(map[primitive.ObjectID]*models.Product)
+	for _, item := range order.Items {
+		if !item.StockReserved || products[item.ProductID] != nil {
+			continue
+		}
+		product, err := s.productRepo.GetByID(ctx, item.ProductID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("product %s not found", item.ProductID.Hex())
+		}
+		products[item.ProductID] = product
+	}
+
+	allocation, err := s.allocate(ctx, order, products)
+	if err != nil || allocation == nil {
+		return nil, nil, err
+	}
+	if order.FulfillmentLocationID != nil && allocation.holdsOrder(order, products, *order.FulfillmentLocationID) {
+		for i := range allocation.locations {
+			if allocation.locations[i].ID == *order.FulfillmentLocationID {
+				allocation.preferred = &allocation.locations[i].ID
+			}
+		}
+	}
+	return allocation, products, nil
+}
+
+// ReleaseOrderStock returns the order's stock when it is cancelled. Unpaid
+// reservations are released; committed sales are restocked as cancellations.
+func (s *stockService) ReleaseOrderStock(ctx context.Context, order *models.Order, reason string) error {
+	switch order.StockStatus {
+	case models.StockReservationReserved:
+		if err := s.restock(ctx, order, models.StockMovementRelease, reason); err != nil {
+			return err
+		}
+		order.StockStatus = models.StockReservationReleased
+	case models.StockReservationCommitted:
+		if err := s.restock(ctx, order, models.StockMovementCancel, reason); err != nil {
+			return err
+		}
+		order.StockStatus = models.StockReservationRestocked
+	}
+
+	order.StockReservedUntil = nil
+	return nil
+}
+
+// RestockReturnedOrder puts the units of a returned order back into stock
+func (s *stockService) RestockReturnedOrder(ctx context.Context, order *models.Order, reason string) error {
+	if order.StockStatus != models.StockReservationCommitted {
+		return nil
+	}
+
+	if err := s.restock(ctx, order, models.StockMovementReturn, reason); err != nil {
+		return err
+	}
+
+	order.StockStatus = models.StockReservationRestocked
+	return nil
+}
+
+// RestockReturnedItems puts units accepted back through a return request into
+// stock. quantities maps order line indexes to the units returned; the lines'
+// ReturnedQuantity must not include them yet.
+func (s *stockService) RestockReturnedItems(ctx context.Context, order *models.Order, quantities map[int]int, reason string) error {
+	if order.StockStatus != models.StockReservationCommitted {
+		return nil
+	}
+
+	for index, quantity := range quantities {
+		if index < 0 || index >= len(order.Items) || quantity <= 0 {
+			continue
+		}
+		item := order.Items[index]
+		if !item.StockReserved {
+			continue
+		}
+
+		balance, err := s.release(ctx, &item, quantity)
+		if err != nil {
+			return fmt.Errorf("failed to restock %s for order %s: %w", item.Name, order.OrderNumber, err)
+		}
+		item.Quantity = quantity
+		s.recordMovement(ctx, order, &item, models.StockMovementReturn, quantity, &balance, reason)
+	}
+
+	return nil
+}
+
+// restock releases every reserved line of the order with the given movement
+// type. Units already restocked through return requests are skipped.
+func (s *stockService) restock(ctx context.Context, order *models.Order, movementType models.StockMovementType, reason string) error {
+	for i := range order.Items {
+		item := &order.Items[i]
+		quantity := item.Quantity - item.ReturnedQuantity
+		if !item.StockReserved || quantity <= 0 {
+			continue
+		}
+
+		balance, err := s.release(ctx, item, quantity)
+		if err != nil {
+			return fmt.Errorf("failed to restock %s for order %s: %w", item.Name, order.OrderNumber, err)
+		}
+		s.recordMovement(ctx, order, item, movementType, quantity, &balance, reason)
+	}
+
+	return nil
+}
+
+// AdjustStock applies a manual adjustment, import or write-off to the product,
+// or to one of its variants, and records it in the ledger
+func (s *stockService) AdjustStock(ctx context.Context, product *models.Product, req *models.StockAdjustmentRequest, actor models.OrderActor) (*models.StockMovement, error) {
+	change := req.Quantity
+	switch req.Type {
+	case models.StockMovementImport, models.StockMovementDamage:
+		if req.Quantity <= 0 {
+			return nil, fmt.Errorf("%w: %s quantity must be positive", ErrInvalidStockAdjustment, req.Type)
+		}
+		if req.Type == models.StockMovementDamage {
+			change = -req.Quantity
+		}
+	case models.StockMovementAdjust:
+		if req.Quantity == 0 {
+			return nil, fmt.Errorf("%w: adjustment quantity must not be zero", ErrInvalidStockAdjustment)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown type %q", ErrInvalidStockAdjustment, req.Type)
+	}
+
+	if product.StockType == models.StockTypeMadeToOrder {
+		return nil, fmt.Errorf("%w: %s is made to order and holds no stock", ErrInvalidStockAdjustment, product.Name)
+	}
+	line, err := stockLine(product, req.VariantID, ErrInvalidStockAdjustment)
+	if err != nil {
+		return nil, err
+	}
+	if line.LocationID, err = s.manualLocation(ctx, product, req.LocationID); err != nil {
+		return nil, err
+	}
+
+	before := product.StockQuantity
+	if line.VariantID != nil {
+		before = product.FindVariant(*line.VariantID).StockQuantity
+	}
+
+	var balance int
+	if change < 0 {
+		balance, err = s.reserve(ctx, line, -change)
+		if err != nil {
+			where := "in stock"
+			if line.LocationID != nil {
+				where = "at the location"
+			}
+			return nil, fmt.Errorf("%w: fewer than %d units of %s %s", ErrInvalidStockAdjustment, -change, product.Name, where)
+		}
+	} else {
+		balance, err = s.release(ctx, line, change)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	movement := &models.StockMovement{
+		ProductID:    product.ID,
+		VariantID:    line.VariantID,
+		SKU:          line.SKU,
+		LocationID:   line.LocationID,
+		Type:         req.Type,
+		Quantity:     abs(change),
+		Change:       change,
+		BalanceAfter: &balance,
+		Reference:    req.Reference,
+		Reason:       req.Reason,
+		Actor:        actor,
+	}
+	s.writeMovement(ctx, movement)
+	s.announceRestock(product, line.VariantID, before, change)
+	return movement, nil
+}
+
+// SetStock sets the counted stock of a product, or of one of its variants, and
+// records the difference as an adjustment. It returns nil when the count
+// matches the stock. Once stock is held per location, units at other
+// locations are kept and the default location holds the rest.
+func (s *stockService) SetStock(ctx context.Context, product *models.Product, variantID *primitive.ObjectID, quantity int, reason string, actor models.OrderActor) (*models.StockMovement, error) {
+	if quantity < 0 {
+		return nil, fmt.Errorf("%w: stock cannot be negative", ErrInvalidStockAdjustment)
+	}
+
+	var sku string
+	total := product.StockQuantity
+	if product.HasVariants() {
+		if variantID == nil {
+			return nil, fmt.Errorf("%w: stock of %s is set per variant", ErrInvalidStockAdjustment, product.Name)
+		}
+		if variant := product.FindVariant(*variantID); variant != nil {
+			sku, total = variant.SKU, variant.StockQuantity
+		}
+	} else {
+		variantID = nil
+	}
+
+	locationID, err := s.manualLocation(ctx, product, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var previous int
+	balance := quantity
+	switch {
+	case locationID != nil:
+		elsewhere := 0
+		if located(product, variantID) {
+			elsewhere = total - product.LocationQuantity(*locationID, variantID)
+		}
+		if quantity < elsewhere {
+			return nil, fmt.Errorf("%w: %d units of %s are held at other locations; change stock per location", ErrInvalidStockAdjustment, elsewhere, product.Name)
+		}
+		balance = quantity - elsewhere
+		previous, err = s.stockRepo.SetStockAt(ctx, product.ID, variantID, *locationID, balance)
+	case variantID != nil:
+		previous, err = s.stockRepo.SetVariantStock(ctx, product.ID, *variantID, quantity)
+	default:
+		previous, err = s.stockRepo.SetStock(ctx, product.ID, quantity)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	change := balance - previous
+	if change == 0 {
+		return nil, nil
+	}
+
+	movement := &models.StockMovement{
+		ProductID:    product.ID,
+		VariantID:    variantID,
+		SKU:          sku,
+		LocationID:   locationID,
+		Type:         models.StockMovementAdjust,
+		Quantity:     abs(change),
+		Change:       change,
+		BalanceAfter: &balance,
+		Reason:       reason,
+		Actor:        actor,
+	}
+	s.writeMovement(ctx, movement)
+	s.announceRestock(product, variantID, total, change)
+	return movement, nil
+}
+
+// announceRestock alerts back-in-stock subscribers when a manual change of
+// the given stock line, holding before units, brings the variant or the
+// product as a whole back into stock
+func (s *stockService) announceRestock(product *models.Product, variantID *primitive.ObjectID, before, change int) {
+	if s.backInStockService == nil || change <= 0 {
+		return
+	}
+	if variantID != nil && before <= 0 && before+change > 0 {
+		s.backInStockService.NotifyRestock(product, variantID)
+	}
+	if product.StockQuantity <= 0 && product.StockQuantity+change > 0 {
+		s.backInStockService.NotifyRestock(product, nil)
+	}
+}
+
+// RecordOpeningStock records the stock a new product was created with as an
+// import, per variant when it has variants. The stock itself is already saved;
+// once stock is held per location it is placed at the default location.
+func (s *stockService) RecordOpeningStock(ctx context.Context, product *models.Product, reference string, actor models.OrderActor) {
+	if product.StockType == models.StockTypeMadeToOrder {
+		return
+	}
+
+	locationID, err := s.manualLocation(ctx, product, "")
+	if err != nil {
+		fmt.Printf("Warning: failed to place opening stock of product %s at a location: %v\n", product.ID.Hex(), err)
+	}
+
+	opening := func(variantID *primitive.ObjectID, sku string, quantity int) {
+		if quantity <= 0 {
+			return
+		}
+		s.writeMovement(ctx, &models.StockMovement{
+			ProductID:    product.ID,
+			VariantID:    variantID,
+			SKU:          sku,
+			LocationID:   locationID,
+			Type:         models.StockMovementImport,
+			Quantity:     quantity,
+			Change:       quantity,
+			BalanceAfter: &quantity,
+			Reference:    reference,
+			Reason:       "Opening stock",
+			Actor:        actor,
+		})
+	}
+
+	if !product.HasVariants() {
+		opening(nil, "", product.StockQuantity)
+		return
+	}
+	for i := range product.Variants {
+		variant := product.Variants[i]
+		opening(&variant.ID, variant.SKU, variant.StockQuantity)
+	}
+}
+
+// ImportStockCSV records the units received in a CSV as imports. The header
+// row names a sku column, holding a variant's SKU or barcode, or a productId
+// column with an optional variantId column, and a quantity column; locationId,
+// reference and reason columns are optional, rows without a reference taking
+// the one given. Nothing is imported unless every row is valid.
+func (s *stockService) ImportStockCSV(ctx context.Context, file io.Reader, reference string, actor models.OrderActor) ([]models.StockMovement, error) {
+	if s.productRepo == nil {
+		return nil, errors.New("stock import is not configured")
+	}
+
+	reader := csv.NewReader(file)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to parse CSV: %v", ErrInvalidStockAdjustment, err)
+	}
+	if len(records) < 2 {
+		return nil, fmt.Errorf("%w: CSV must have a header row and at least one row of stock", ErrInvalidStockAdjustment)
+	}
+
+	columns := map[string]int{}
+	for i, header := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(header))] = i
+	}
+	_, hasSKU := columns["sku"]
+	_, hasProduct := columns["productid"]
+	if _, ok := columns["quantity"]; !ok || (!hasSKU && !hasProduct) {
+		return nil, fmt.Errorf("%w: CSV header must have a sku or productId column and a quantity column", ErrInvalidStockAdjustment)
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	type importRow struct {
+		productID primitive.ObjectID
+		req       models.StockAdjustmentRequest
+	}
+	var rows []importRow
+	var problems []string
+	for i, record := range records[1:] {
+		row := i + 2
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+
+		quantity, err := strconv.Atoi(field(record, "quantity"))
+		if err != nil || quantity <= 0 {
+			problems = append(problems, fmt.Sprintf("row %d: quantity %q is not a positive whole number", row, field(record, "quantity")))
+			continue
+		}
+		product, variantID, err := s.importLine(ctx, field(record, "sku"), field(record, "productid"), field(record, "variantid"))
+		if err == nil && product.StockType == models.StockTypeMadeToOrder {
+			err = fmt.Errorf("%s is made to order and holds no stock", product.Name)
+		}
+		if err == nil {
+			_, err = stockLine(product, variantID, ErrInvalidStockAdjustment)
+		}
+		locationID := field(record, "locationid")
+		if err == nil && locationID != "" {
+			err = s.checkLocation(ctx, locationID)
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("row %d: %s", row, strings.TrimPrefix(err.Error(), ErrInvalidStockAdjustment.Error()+": ")))
+			continue
+		}
+
+		req := models.StockAdjustmentRequest{
+			VariantID:  variantID,
+			LocationID: locationID,
+			Type:       models.StockMovementImport,
+			Quantity:   quantity,
+			Reference:  field(record, "reference"),
+			Reason:     field(record, "reason"),
+		}
+		if req.Reference == "" {
+			req.Reference = reference
+		}
+		rows = append(rows, importRow{productID: product.ID, req: req})
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidStockAdjustment, strings.Join(problems, "; "))
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("%w: CSV has no stock", ErrInvalidStockAdjustment)
+	}
+
+	// Each row reads the product afresh, so rows for the same product see the
+	// stock the previous ones added
+	movements := make([]models.StockMovement, 0, len(rows))
+	for i := range rows {
+		product, err := s.productRepo.GetByID(ctx, rows[i].productID)
+		if err == nil {
+			var movement *models.StockMovement
+			if movement, err = s.AdjustStock(ctx, product, &rows[i].req, actor); err == nil {
+				movements = append(movements, *movement)
+				continue
+			}
+		}
+		return movements, fmt.Errorf("stock import stopped after %d of %d rows: %w", len(movements), len(rows), err)
+	}
+	return movements, nil
+}
+
+// importLine finds the product, and the variant ID, a stock import row is for
+func (s *stockService) importLine(ctx context.Context, sku, productID, variantID string) (*models.Product, string, error) {
+	if sku != "" {
+		if s.variantRepo == nil {
+			return nil, "", errors.New("SKU lookup is not available; use productId")
+		}
+		product, err := s.variantRepo.GetByCode(ctx, sku)
+		if err != nil {
+			return nil, "", fmt.Errorf("SKU or barcode %s not found", sku)
+		}
+		variant := product.FindVariantByCode(sku)
+		if variant == nil {
+			return nil, "", fmt.Errorf("SKU or barcode %s not found", sku)
+		}
+		return product, variant.ID.Hex(), nil
+	}
+
+	id, err := primitive.ObjectIDFromHex(productID)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid product ID %q", productID)
+	}
+	product, err := s.productRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, "", fmt.Errorf("product %s not found", productID)
+	}
+	return product, variantID, nil
+}
+
+// checkLocation reports whether stock can be imported at the location
+func (s *stockService) checkLocation(ctx context.Context, locationID string) error {
+	id, err := primitive.ObjectIDFromHex(locationID)
+	if err != nil {
+		return fmt.Errorf("invalid location ID %q", locationID)
+	}
+	if s.locationRepo == nil {
+		return errors.New("stock locations are not set up")
+	}
+	if _, err := s.locationRepo.GetByID(ctx, id); err != nil {
+		return fmt.Errorf("location %s not found", locationID)
+	}
+	return nil
+}
+
+// GetLedger lists stock movements, newest first
+func (s *stockService) GetLedger(ctx context.Context, filter models.StockLedgerFilter) ([]models.StockMovement, int64, error) {
+	return s.stockRepo.GetMovements(ctx, filter)
+}
+
+// GetLowStockReport lists stocked, available products at or below their
+// reorder level, lowest stock first
+func (s *stockService) GetLowStockReport(ctx context.Context) ([]models.LowStockProduct, error) {
+	products, err := s.stockRepo.GetLowStock(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := make([]models.LowStockProduct, 0, len(products))
+	for i := range products {
+		product := &products[i]
+		report = append(report, models.LowStockProduct{
+			ProductID:    product.ID,
+			Name:         product.Name,
+			Category:     product.Category,
+			CurrentStock: product.StockQuantity,
+			MinimumStock: product.ReorderThreshold(),
+			Price:        product.Price,
+			AlertedAt:    product.LowStockAlertedAt,
+		})
+	}
+	return report, nil
+}
+
+// RaiseLowStockAlerts raises an admin notification for every product that has
+// fallen to its reorder level since the last run, and returns how many were
+// raised. A product is alerted once per drop: its alert is cleared when it is
+// restocked above the level.
+func (s *stockService) RaiseLowStockAlerts(ctx context.Context) (int, error) {
+	if s.adminNotificationRepo == nil {
+		return 0, nil
+	}
+
+	if _, err := s.stockRepo.ClearLowStockAlerts(ctx); err != nil {
+		return 0, err
+	}
+
+	products, err := s.stockRepo.GetLowStock(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	raised := 0
+	now := time.Now()
+	for i := range products {
+		product := &products[i]
+		if product.LowStockAlertedAt != nil {
+			continue
+		}
+
+		if err := s.adminNotificationRepo.Create(ctx, lowStockNotification(product)); err != nil {
+			return raised, err
+		}
+		if err := s.stockRepo.MarkLowStockAlerted(ctx, product.ID, now); err != nil {
+			fmt.Printf("Warning: failed to mark low stock alert for product %s: %v\n", product.ID.Hex(), err)
+		}
+		raised++
+	}
+
+	return raised, nil
+}
+
+// lowStockNotification builds the admin notification for a product at its reorder level
+func lowStockNotification(product *models.Product) *models.AdminNotification {
+	title, priority := "Low stock: "+product.Name, models.PriorityMedium
+	if product.StockQuantity <= 0 {
+		title, priority = "Out of stock: "+product.Name, models.PriorityHigh
+	}
+
+	return &models.AdminNotification{
+		Title:     title,
+		Message:   fmt.Sprintf("%s has %d in stock, at or below its reorder level of %d.", product.Name, product.StockQuantity, product.ReorderThreshold()),
+		Type:      models.NotificationTypeWarning,
+		Priority:  priority,
+		ActionURL: "/admin/products/" + product.ID.Hex(),
+		Metadata: map[string]interface{}{
+			"productId":     product.ID.Hex(),
+			"stockQuantity": product.StockQuantity,
+			"reorderLevel":  product.ReorderThreshold(),
+		},
+	}
+}
+
+// stockLine identifies the stock a manual change or transfer applies to: the
+// product, or the given variant of a product sold by variant. Problems are
+// reported wrapped in invalid.
+func stockLine(product *models.Product, variantID string, invalid error) (*models.OrderItem, error) {
+	line := &models.OrderItem{ProductID: product.ID, Name: product.Name}
+	if !product.HasVariants() {
+		if variantID != "" {
+			return nil, fmt.Errorf("%w: %s has no variants", invalid, product.Name)
+		}
+		return line, nil
+	}
+
+	if variantID == "" {
+		return nil, fmt.Errorf("%w: stock of %s is held per variant", invalid, product.Name)
+	}
+	id, err := primitive.ObjectIDFromHex(variantID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid variant ID", invalid)
+	}
+	variant := product.FindVariant(id)
+	if variant == nil {
+		return nil, fmt.Errorf("%w: variant %s not found", invalid, variantID)
+	}
+	line.VariantID = &variant.ID
+	line.SKU = variant.SKU
+	return line, nil
+}
+
+// AssignUnlocatedStock places all stock not yet held at a location at the
+// location, when it becomes the default
+func (s *stockService) AssignUnlocatedStock(ctx context.Context, location *models.StockLocation) (int64, error) {
+	return s.stockRepo.AssignUnlocatedStock(ctx, nil, location.ID)
+}
+
+// DispatchTransfer takes a transfer's units out of its source location. If a
+// line is not held there, the lines already taken are put back.
+func (s *stockService) DispatchTransfer(ctx context.Context, transfer *models.StockTransfer, actor models.OrderActor) error {
+	defaultLocation, err := s.defaultLocation(ctx)
+	if err != nil {
+		return err
+	}
+	if defaultLocation == nil {
+		return fmt.Errorf("%w: stock locations are not set up", ErrInvalidStockTransfer)
+	}
+
+	for i := range transfer.Items {
+		item := &transfer.Items[i]
+		if err := s.locate(ctx, item.ProductID, defaultLocation.ID); err != nil {
+			s.putTransferItems(ctx, transfer, transfer.Items[:i], transfer.FromLocationID, "Transfer could not be sent", actor)
+			return err
+		}
+		balance, err := s.stockRepo.ReserveAt(ctx, item.ProductID, item.VariantID, transfer.FromLocationID, item.Quantity)
+		if err != nil {
+			s.putTransferItems(ctx, transfer, transfer.Items[:i], transfer.FromLocationID, "Transfer could not be sent", actor)
+			return fmt.Errorf("%w: fewer than %d units of %s at the source location", ErrInvalidStockTransfer, item.Quantity, item.Name)
+		}
+		s.writeTransferMovement(ctx, transfer, item, transfer.FromLocationID, models.StockMovementTransferOut, -item.Quantity, balance, "Sent to another location", actor)
+	}
+	return nil
+}
+
+// ReceiveTransfer puts a transfer's units into its destination location
+func (s *stockService) ReceiveTransfer(ctx context.Context, transfer *models.StockTransfer, actor models.OrderActor) {
+	s.putTransferItems(ctx, transfer, transfer.Items, transfer.ToLocationID, "Received from another location", actor)
+}
+
+// ReturnTransfer puts the units of a cancelled transfer back into its source location
+func (s *stockService) ReturnTransfer(ctx context.Context, transfer *models.StockTransfer, actor models.OrderActor) {
+	s.putTransferItems(ctx, transfer, transfer.Items, transfer.FromLocationID, "Transfer cancelled", actor)
+}
+
+// putTransferItems puts transfer lines into a location's stock. The transfer
+// is already closed, so a line that cannot be put back is logged for staff to
+// correct rather than returned.
+func (s *stockService) putTransferItems(ctx context.Context, transfer *models.StockTransfer, items []models.StockTransferItem, locationID primitive.ObjectID, reason string, actor models.OrderActor) {
+	for i := range items {
+		item := &items[i]
+		balance, err := s.stockRepo.ReleaseAt(ctx, item.ProductID, item.VariantID, locationID, item.Quantity)
+		if err != nil {
+			fmt.Printf("Warning: failed to put %d units of product %s from transfer %s into stock: %v\n", item.Quantity, item.ProductID.Hex(), transfer.TransferNumber, err)
+			continue
+		}
+		s.writeTransferMovement(ctx, transfer, item, locationID, models.StockMovementTransferIn, item.Quantity, balance, reason, actor)
+	}
+}
+
+func (s *stockService) writeTransferMovement(ctx context.Context, transfer *models.StockTransfer, item *models.StockTransferItem, locationID primitive.ObjectID, movementType models.StockMovementType, change, balance int, reason string, actor models.OrderActor) {
+	s.writeMovement(ctx, &models.StockMovement{
+		ProductID:    item.ProductID,
+		VariantID:    item.VariantID,
+		SKU:          item.SKU,
+		LocationID:   &locationID,
+		Type:         movementType,
+		Quantity:     item.Quantity,
+		Change:       change,
+		BalanceAfter: &balance,
+		Reference:    transfer.TransferNumber,
+		Reason:       reason,
+		Actor:        actor,
+	})
+}
+
+// defaultLocation returns the location stock entered without one is held at,
+// or nil before stock locations are set up
+func (s *stockService) defaultLocation(ctx context.Context) (*models.StockLocation, error) {
+	if s.locationRepo == nil {
+		return nil, nil
+	}
+	location, err := s.locationRepo.GetDefault(ctx)
+	if errors.Is(err, repository.ErrStockLocationNotFound) {
+		return nil, nil
+	}
+	return location, err
+}
+
+// locate places the product's stock that is not yet held at a location at
+// the default location, so it can be changed per location
+func (s *stockService) locate(ctx context.Context, productID, defaultID primitive.ObjectID) error {
+	if _, err := s.stockRepo.AssignUnlocatedStock(ctx, &productID, defaultID); err != nil {
+		return fmt.Errorf("failed to place stock at a location: %w", err)
+	}
+	return nil
+}
+
+// manualLocation returns the location a manual change to the product applies
+// to: the given one, or the default location. It returns nil before stock
+// locations are set up.
+func (s *stockService) manualLocation(ctx context.Context, product *models.Product, locationID string) (*primitive.ObjectID, error) {
+	defaultLocation, err := s.defaultLocation(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if defaultLocation == nil {
+		if locationID != "" {
+			return nil, fmt.Errorf("%w: stock locations are not set up", ErrInvalidStockAdjustment)
+		}
+		return nil, nil
+	}
+
+	id := defaultLocation.ID
+	if locationID != "" {
+		if id, err = primitive.ObjectIDFromHex(locationID); err != nil {
+			return nil, fmt.Errorf("%w: invalid location ID", ErrInvalidStockAdjustment)
+		}
+		if _, err := s.locationRepo.GetByID(ctx, id); err != nil {
+			if errors.Is(err, repository.ErrStockLocationNotFound) {
+				return nil, fmt.Errorf("%w: location %s not found", ErrInvalidStockAdjustment, locationID)
+			}
+			return nil, err
+		}
+	}
+
+	if err := s.locate(ctx, product.ID, defaultLocation.ID); err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+// lineLocation gives an order line reserved before stock was held per
+// location the default location, so it is released where its stock now is
+func (s *stockService) lineLocation(ctx context.Context, item *models.OrderItem) error {
+	if item.LocationID != nil {
+		return nil
+	}
+	defaultLocation, err := s.defaultLocation(ctx)
+	if err != nil || defaultLocation == nil {
+		return err
+	}
+	if err := s.locate(ctx, item.ProductID, defaultLocation.ID); err != nil {
+		return err
+	}
+	item.LocationID = &defaultLocation.ID
+	return nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// rollbackReservation releases lines reserved during a checkout that could not complete
+func (s *stockService) rollbackReservation(ctx context.Context, order *models.Order) {
+	for i := range order.Items {
+		item := &order.Items[i]
+		if !item.StockReserved {
+			continue
+		}
+
+		balance, err := s.release(ctx, item, item.Quantity)
+		if err != nil {
+			fmt.Printf("Warning: failed to roll back stock for product %s: %v\n", item.ProductID.Hex(), err)
+			continue
+		}
+		item.StockReserved = false
+		s.recordMovement(ctx, order, item, models.StockMovementRelease, item.Quantity, &balance, "Checkout failed")
+	}
+}
+
+// reserve takes units of the line from stock, from its variant when it has
+// one and from its location once stock is held per location
+func (s *stockService) reserve(ctx context.Context, item *models.OrderItem, quantity int) (int, error) {
+	if err := s.lineLocation(ctx, item); err != nil {
+		return 0, err
+	}
+	if item.LocationID != nil {
+		return s.stockRepo.ReserveAt(ctx, item.ProductID, item.VariantID, *item.LocationID, quantity)
+	}
+	if item.VariantID != nil {
+		return s.stockRepo.ReserveVariant(ctx, item.ProductID, *item.VariantID, quantity)
+	}
+	return s.stockRepo.Reserve(ctx, item.ProductID, quantity)
+}
+
+// release puts units of the line back into stock, into its variant when it
+// has one and into its location once stock is held per location
+func (s *stockService) release(ctx context.Context, item *models.OrderItem, quantity int) (int, error) {
+	if err := s.lineLocation(ctx, item); err != nil {
+		return 0, err
+	}
+	if item.LocationID != nil {
+		return s.stockRepo.ReleaseAt(ctx, item.ProductID, item.VariantID, *item.LocationID, quantity)
+	}
+	if item.VariantID != nil {
+		return s.stockRepo.ReleaseVariant(ctx, item.ProductID, *item.VariantID, quantity)
+	}
+	return s.stockRepo.Release(ctx, item.ProductID, quantity)
+}
+
+// recordMovement writes the ledger entry for a change to an order line's stock
+func (s *stockService) recordMovement(ctx context.Context, order *models.Order, item *models.OrderItem, movementType models.StockMovementType, change int, balance *int, reason string) {
+	orderID := order.ID
+	s.writeMovement(ctx, &models.StockMovement{
+		ProductID:    item.ProductID,
+		VariantID:    item.VariantID,
+		SKU:          item.SKU,
+		LocationID:   item.LocationID,
+		Type:         movementType,
+		Quantity:     item.Quantity,
+		Change:       change,
+		BalanceAfter: balance,
+		OrderID:      &orderID,
+		OrderNumber:  order.OrderNumber,
+		Reason:       reason,
+		Actor:        models.OrderActor{Type: models.OrderActorSystem},
+	})
+}
+
+// writeMovement writes a ledger entry. The stock update has already been
+// applied, so a ledger failure is logged rather than returned.
+func (s *stockService) writeMovement(ctx context.Context, movement *models.StockMovement) {
+	if err := s.stockRepo.RecordMovement(ctx, movement); err != nil {
+		fmt.Printf("Warning: failed to record stock movement for product %s: %v\n", movement.ProductID.Hex(), err)
+	}
+}
@@ -0,0 +1,381 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memoryLedgerRepository keeps product stock and its ledger in memory
+type memoryLedgerRepository struct {
+	repository.StockRepository
+	products  *memoryProductRepository
+	movements []models.StockMovement
+}
+
+func (r *memoryLedgerRepository) change(productID primitive.ObjectID, change int) (int, error) {
+	product, ok := r.products.products[productID]
+	if !ok {
+		return 0, errors.New("product not found")
+	}
+	if product.StockQuantity+change < 0 {
+		return 0, errors.New("insufficient stock")
+	}
+	product.StockQuantity += change
+	r.products.products[productID] = product
+	return product.StockQuantity, nil
+}
+
+func (r *memoryLedgerRepository) Reserve(ctx context.Context, productID primitive.ObjectID, quantity int) (int, error) {
+	return r.change(productID, -quantity)
+}
+
+func (r *memoryLedgerRepository) Release(ctx context.Context, productID primitive.ObjectID, quantity int) (int, error) {
+	return r.change(productID, quantity)
+}
+
+func (r *memoryLedgerRepository) SetStock(ctx context.Context, productID primitive.ObjectID, quantity int) (int, error) {
+	product := r.products.products[productID]
+	previous := product.StockQuantity
+	product.StockQuantity = quantity
+	r.products.products[productID] = product
+	return previous, nil
+}
+
+// changeAt changes the stock of a line at a location, keeping the product and
+// variant totals the sum of their location entries. The product's slices are
+// copied so snapshots taken earlier keep their quantities.
+func (r *memoryLedgerRepository) changeAt(productID primitive.ObjectID, variantID *primitive.ObjectID, locationID primitive.ObjectID, change func(held int) (int, error)) (int, int, error) {
+	product, ok := r.products.products[productID]
+	if !ok {
+		return 0, 0, errors.New("product not found")
+	}
+	product.LocationStock = append([]models.LocationStock(nil), product.LocationStock...)
+	product.Variants = append([]models.ProductVariant(nil), product.Variants...)
+
+	entry := -1
+	for i, stock := range product.LocationStock {
+		if stock.LocationID == locationID && ((stock.VariantID == nil && variantID == nil) || (stock.VariantID != nil && variantID != nil && *stock.VariantID == *variantID)) {
+			entry = i
+		}
+	}
+	if entry < 0 {
+		product.LocationStock = append(product.LocationStock, models.LocationStock{LocationID: locationID, VariantID: variantID})
+		entry = len(product.LocationStock) - 1
+	}
+
+	previous := product.LocationStock[entry].Quantity
+	quantity, err := change(previous)
+	if err != nil {
+		return 0, 0, err
+	}
+	product.LocationStock[entry].Quantity = quantity
+	product.StockQuantity += quantity - previous
+	if variantID != nil {
+		product.FindVariant(*variantID).StockQuantity += quantity - previous
+	}
+	r.products.products[productID] = product
+	return previous, quantity, nil
+}
+
+func (r *memoryLedgerRepository) ReserveAt(ctx context.Context, productID primitive.ObjectID, variantID *primitive.ObjectID, locationID primitive.ObjectID, quantity int) (int, error) {
+	_, balance, err := r.changeAt(productID, variantID, locationID, func(held int) (int, error) {
+		if held < quantity {
+			return 0, errors.New("insufficient stock")
+		}
+		return held - quantity, nil
+	})
+	return balance, err
+}
+
+func (r *memoryLedgerRepository) ReleaseAt(ctx context.Context, productID primitive.ObjectID, variantID *primitive.ObjectID, locationID primitive.ObjectID, quantity int) (int, error) {
+	_, balance, err := r.changeAt(productID, variantID, locationID, func(held int) (int, error) {
+		return held + quantity, nil
+	})
+	return balance, err
+}
+
+func (r *memoryLedgerRepository) SetStockAt(ctx context.Context, productID primitive.ObjectID, variantID *primitive.ObjectID, locationID primitive.ObjectID, quantity int) (int, error) {
+	previous, _, err := r.changeAt(productID, variantID, locationID, func(int) (int, error) {
+		return quantity, nil
+	})
+	return previous, err
+}
+
+func (r *memoryLedgerRepository) AssignUnlocatedStock(ctx context.Context, productID *primitive.ObjectID, locationID primitive.ObjectID) (int64, error) {
+	var assigned int64
+	for id, product := range r.products.products {
+		if (productID != nil && id != *productID) || len(product.LocationStock) > 0 || product.StockType == models.StockTypeMadeToOrder {
+			continue
+		}
+		if product.HasVariants() {
+			for _, variant := range product.Variants {
+				variantID := variant.ID
+				product.LocationStock = append(product.LocationStock, models.LocationStock{LocationID: locationID, VariantID: &variantID, Quantity: variant.StockQuantity})
+			}
+		} else {
+			product.LocationStock = []models.LocationStock{{LocationID: locationID, Quantity: product.StockQuantity}}
+		}
+		r.products.products[id] = product
+		assigned++
+	}
+	return assigned, nil
+}
+
+func (r *memoryLedgerRepository) RecordMovement(ctx context.Context, movement *models.StockMovement) error {
+	movement.CreatedAt = time.Now()
+	r.movements = append(r.movements, *movement)
+	return nil
+}
+
+func (r *memoryLedgerRepository) GetLowStock(ctx context.Context) ([]models.Product, error) {
+	var products []models.Product
+	for _, product := range r.products.products {
+		if product.IsLowStock() {
+			products = append(products, product)
+		}
+	}
+	sort.Slice(products, func(i, j int) bool { return products[i].StockQuantity < products[j].StockQuantity })
+	return products, nil
+}
+
+func (r *memoryLedgerRepository) MarkLowStockAlerted(ctx context.Context, productID primitive.ObjectID, at time.Time) error {
+	product := r.products.products[productID]
+	product.LowStockAlertedAt = &at
+	r.products.products[productID] = product
+	return nil
+}
+
+func (r *memoryLedgerRepository) ClearLowStockAlerts(ctx context.Context) (int64, error) {
+	var cleared int64
+	for id, product := range r.products.products {
+		if product.LowStockAlertedAt != nil && product.StockQuantity > product.ReorderThreshold() {
+			product.LowStockAlertedAt = nil
+			r.products.products[id] = product
+			cleared++
+		}
+	}
+	return cleared, nil
+}
+
+// memoryAdminNotificationRepository collects the notifications raised for admins
+type memoryAdminNotificationRepository struct {
+	repository.AdminNotificationRepository
+	notifications []models.AdminNotification
+}
+
+func (r *memoryAdminNotificationRepository) Create(ctx context.Context, notification *models.AdminNotification) error {
+	r.notifications = append(r.notifications, *notification)
+	return nil
+}
+
+func TestManualStockChangesAreLedgered(t *testing.T) {
+	ctx := context.Background()
+	chain := models.Product{ID: primitive.NewObjectID(), Name: "Rope Chain", StockType: models.StockTypeStocked, StockQuantity: 5, IsAvailable: true}
+	custom := models.Product{ID: primitive.NewObjectID(), Name: "Custom Band", StockType: models.StockTypeMadeToOrder, IsAvailable: true}
+	ring := models.Product{ID: primitive.NewObjectID(), Name: "Ring", StockType: models.StockTypeStocked, StockQuantity: 3, IsAvailable: true,
+		Variants: []models.ProductVariant{{ID: primitive.NewObjectID(), SKU: "RING-6", Size: "6", StockQuantity: 3, IsActive: true}}}
+	productRepo := &memoryProductRepository{products: map[primitive.ObjectID]models.Product{chain.ID: chain, custom.ID: custom, ring.ID: ring}}
+	ledger := &memoryLedgerRepository{products: productRepo}
+	stock := NewStockService(ledger)
+	admin := models.OrderActor{Type: models.OrderActorAdmin, ID: "admin-1"}
+
+	received, err := stock.AdjustStock(ctx, &chain, &models.StockAdjustmentRequest{Type: models.StockMovementImport, Quantity: 10, Reference: "PO-17"}, admin)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if received.Change != 10 || *received.BalanceAfter != 15 || received.Reference != "PO-17" || received.Actor != admin {
+		t.Fatalf("unexpected import entry %+v", received)
+	}
+
+	if _, err := stock.AdjustStock(ctx, &chain, &models.StockAdjustmentRequest{Type: models.StockMovementDamage, Quantity: 20}, admin); !errors.Is(err, ErrInvalidStockAdjustment) {
+		t.Fatalf("expected writing off more than is held to be refused, got %v", err)
+	}
+	damaged, err := stock.AdjustStock(ctx, &chain, &models.StockAdjustmentRequest{Type: models.StockMovementDamage, Quantity: 2, Reason: "Broken clasp"}, admin)
+	if err != nil || damaged.Change != -2 || damaged.Quantity != 2 || *damaged.BalanceAfter != 13 {
+		t.Fatalf("unexpected damage entry %+v (%v)", damaged, err)
+	}
+
+	refused := []struct {
+		name    string
+		product *models.Product
+		req     models.StockAdjustmentRequest
+	}{
+		{"zero adjustment", &chain, models.StockAdjustmentRequest{Type: models.StockMovementAdjust}},
+		{"negative import", &chain, models.StockAdjustmentRequest{Type: models.StockMovementImport, Quantity: -1}},
+		{"order movement", &chain, models.StockAdjustmentRequest{Type: models.StockMovementSale, Quantity: 1}},
+		{"made to order", &custom, models.StockAdjustmentRequest{Type: models.StockMovementImport, Quantity: 1}},
+		{"variant missing", &ring, models.StockAdjustmentRequest{Type: models.StockMovementImport, Quantity: 1}},
+		{"variant on plain product", &chain, models.StockAdjustmentRequest{Type: models.StockMovementImport, Quantity: 1, VariantID: ring.Variants[0].ID.Hex()}},
+	}
+	for _, tc := range refused {
+		if _, err := stock.AdjustStock(ctx, tc.product, &tc.req, admin); !errors.Is(err, ErrInvalidStockAdjustment) {
+			t.Errorf("%s: expected ErrInvalidStockAdjustment, got %v", tc.name, err)
+		}
+	}
+
+	// A stock count through the product endpoint is recorded as the difference
+	products := NewProductService(productRepo, nil)
+	products.(*productService).SetStockService(stock)
+	if err := products.UpdateProductStock(ctx, chain.ID.Hex(), 12, "Cycle count", admin); err != nil {
+		t.Fatalf("update stock: %v", err)
+	}
+	if err := products.UpdateProductStock(ctx, chain.ID.Hex(), 12, "Recount", admin); err != nil {
+		t.Fatalf("update stock: %v", err)
+	}
+	if productRepo.products[chain.ID].StockQuantity != 12 {
+		t.Fatalf("expected 12 units, got %d", productRepo.products[chain.ID].StockQuantity)
+	}
+
+	if len(ledger.movements) != 3 {
+		t.Fatalf("expected an unchanged count not to be recorded, got %d entries", len(ledger.movements))
+	}
+	count := ledger.movements[2]
+	if count.Type != models.StockMovementAdjust || count.Change != -1 || count.Reason != "Cycle count" || count.Actor.ID != "admin-1" {
+		t.Fatalf("unexpected count entry %+v", count)
+	}
+}
+
+// Update saves the product but, like the Mongo repositories, not its stock
+func (r *memoryProductRepository) Update(ctx context.Context, product *models.Product) error {
+	stored, ok := r.products[product.ID]
+	if !ok {
+		return errors.New("product not found")
+	}
+	saved := *product
+	saved.StockQuantity = stored.StockQuantity
+	saved.Variants = stored.Variants
+	saved.LocationStock = stored.LocationStock
+	r.products[product.ID] = saved
+	return nil
+}
+
+// checkoutDuringReadRepository reserves stock right after a product is read,
+// as a checkout running alongside an admin edit would
+type checkoutDuringReadRepository struct {
+	*memoryProductRepository
+	checkout func()
+}
+
+func (r *checkoutDuringReadRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.Product, error) {
+	product, err := r.memoryProductRepository.GetByID(ctx, id)
+	if err == nil && r.checkout != nil {
+		r.checkout()
+	}
+	return product, err
+}
+
+func TestProductEditsKeepStockReservedMeanwhile(t *testing.T) {
+	ctx := context.Background()
+	chain := models.Product{ID: primitive.NewObjectID(), Name: "Rope Chain", StockType: models.StockTypeStocked, StockQuantity: 5, IsAvailable: true}
+	productRepo := &memoryProductRepository{products: map[primitive.ObjectID]models.Product{chain.ID: chain}}
+	ledger := &memoryLedgerRepository{products: productRepo}
+	stock := NewStockService(ledger)
+
+	reading := &checkoutDuringReadRepository{memoryProductRepository: productRepo}
+	reading.checkout = func() {
+		if _, err := ledger.Reserve(ctx, chain.ID, 1); err != nil {
+			t.Fatalf("reserve: %v", err)
+		}
+	}
+	products := NewProductService(reading, nil).(*productService)
+	products.SetStockService(stock)
+
+	name := "Rope Chain 18in"
+	if _, err := products.UpdateProduct(ctx, chain.ID.Hex(), &models.UpdateProductRequest{Name: &name}); err != nil {
+		t.Fatalf("update product: %v", err)
+	}
+	if saved := productRepo.products[chain.ID]; saved.Name != name || saved.StockQuantity != 4 {
+		t.Fatalf("expected the rename to keep the reserved unit out of stock, got %q with %d", saved.Name, saved.StockQuantity)
+	}
+
+	quantity := 8
+	if _, err := products.UpdateProduct(ctx, chain.ID.Hex(), &models.UpdateProductRequest{StockQuantity: &quantity}); err != nil {
+		t.Fatalf("update product stock: %v", err)
+	}
+	if saved := productRepo.products[chain.ID]; saved.StockQuantity != 8 {
+		t.Fatalf("expected 8 units, got %d", saved.StockQuantity)
+	}
+	// Counted from the 3 left after the second checkout, not the 4 that were read
+	if len(ledger.movements) != 1 || ledger.movements[0].Change != 5 {
+		t.Fatalf("expected one adjustment of +5, got %+v", ledger.movements)
+	}
+
+	products.stockService = nil
+	if _, err := products.UpdateProduct(ctx, chain.ID.Hex(), &models.UpdateProductRequest{StockQuantity: &quantity}); err == nil {
+		t.Fatal("expected stock changes to need the stock service")
+	}
+}
+
+func TestLowStockAlertsAreRaisedOncePerDrop(t *testing.T) {
+	ctx := context.Background()
+	level := 3
+	chain := models.Product{ID: primitive.NewObjectID(), Name: "Rope Chain", StockType: models.StockTypeStocked, StockQuantity: 4, IsAvailable: true}
+	pendant := models.Product{ID: primitive.NewObjectID(), Name: "Pendant", StockType: models.StockTypeStocked, StockQuantity: 4, ReorderLevel: &level, IsAvailable: true}
+	custom := models.Product{ID: primitive.NewObjectID(), Name: "Custom Band", StockType: models.StockTypeMadeToOrder, IsAvailable: true}
+	retired := models.Product{ID: primitive.NewObjectID(), Name: "Old Bangle", StockType: models.StockTypeStocked, IsAvailable: false}
+	productRepo := &memoryProductRepository{products: map[primitive.ObjectID]models.Product{
+		chain.ID: chain, pendant.ID: pendant, custom.ID: custom, retired.ID: retired,
+	}}
+	ledger := &memoryLedgerRepository{products: productRepo}
+	inbox := &memoryAdminNotificationRepository{}
+	stock := NewStockService(ledger)
+	stock.(*stockService).SetAdminNotificationRepository(inbox)
+
+	report, err := stock.GetLowStockReport(ctx)
+	if err != nil || len(report) != 1 || report[0].ProductID != chain.ID || report[0].MinimumStock != models.DefaultReorderLevel {
+		t.Fatalf("expected only the chain to be under its reorder level, got %+v (%v)", report, err)
+	}
+
+	run := func(expected int) {
+		t.Helper()
+		raised, err := stock.RaiseLowStockAlerts(ctx)
+		if err != nil || raised != expected {
+			t.Fatalf("expected %d alerts, got %d (%v)", expected, raised, err)
+		}
+	}
+	run(1)
+	run(0)
+	if alert := inbox.notifications[0]; alert.Title != "Low stock: Rope Chain" || alert.Priority != models.PriorityMedium || alert.Type != models.NotificationTypeWarning {
+		t.Fatalf("unexpected alert %+v", alert)
+	}
+	if report, _ := stock.GetLowStockReport(ctx); report[0].AlertedAt == nil {
+		t.Fatalf("expected the report to show when the alert was raised")
+	}
+
+	// The pendant crosses its own level; the chain is restocked and sells out again
+	admin := models.OrderActor{Type: models.OrderActorAdmin, ID: "admin-1"}
+	p := productRepo.products[pendant.ID]
+	if _, err := stock.AdjustStock(ctx, &p, &models.StockAdjustmentRequest{Type: models.StockMovementDamage, Quantity: 1}, admin); err != nil {
+		t.Fatalf("damage: %v", err)
+	}
+	c := productRepo.products[chain.ID]
+	if _, err := stock.AdjustStock(ctx, &c, &models.StockAdjustmentRequest{Type: models.StockMovementImport, Quantity: 20}, admin); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	run(1)
+	if _, err := stock.SetStock(ctx, &c, nil, 0, "Sold at the counter", admin); err != nil {
+		t.Fatalf("set stock: %v", err)
+	}
+	run(1)
+
+	var titles []string
+	for _, alert := range inbox.notifications {
+		titles = append(titles, alert.Title)
+	}
+	if got := strings.Join(titles, ", "); got != "Low stock: Rope Chain, Low stock: Pendant, Out of stock: Rope Chain" {
+		t.Fatalf("unexpected alerts: %s", got)
+	}
+	if last := inbox.notifications[2]; last.Priority != models.PriorityHigh || last.ActionURL != fmt.Sprintf("/admin/products/%s", chain.ID.Hex()) {
+		t.Fatalf("unexpected out of stock alert %+v", last)
+	}
+}
@@ -0,0 +1,399 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// ErrInvalidVariant is returned for variants whose options, codes or stock cannot be saved
+	ErrInvalidVariant = errors.New("invalid variant")
+	// ErrVariantUnavailable is returned when the variant asked for cannot be sold
+	ErrVariantUnavailable = errors.New("variant not available")
+)
+
+// VariantService manages the option combinations of products that are sold
+// by SKU, each with its own stock, price and weight
+type VariantService interface {
+	GenerateVariants(productID string, req *models.GenerateVariantsRequest) (*models.Product, error)
+	CreateVariant(productID string, req *models.CreateVariantRequest) (*models.ProductVariant, error)
+	UpdateVariant(productID, variantID string, req *models.UpdateVariantRequest, actor models.OrderActor) (*models.ProductVariant, error)
+	DeleteVariant(productID, variantID string) error
+	LookupCode(code string) (*models.VariantLookup, error)
+}
+
+type variantService struct {
+	variantRepo  repository.VariantRepository
+	productRepo  repository.ProductRepository
+	stockService StockService
+}
+
+// NewVariantService creates a new variant service
+func NewVariantService(variantRepo repository.VariantRepository, productRepo repository.ProductRepository) VariantService {
+	return &variantService{
+		variantRepo: variantRepo,
+		productRepo: productRepo,
+	}
+}
+
+// SetStockService sets the ledger variant stock changes are recorded in
+func (s *variantService) SetStockService(stockService StockService) {
+	s.stockService = stockService
+}
+
+// GenerateVariants adds a variant for every combination of the product's
+// metals, sizes and stone colors that it has no variant for yet. SKUs are
+// built from the prefix and the options.
+func (s *variantService) GenerateVariants(productID string, req *models.GenerateVariantsRequest) (*models.Product, error) {
+	ctx := context.Background()
+	product, err := s.product(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	combinations := product.VariantCombinations()
+	if len(combinations) == 0 {
+		return nil, fmt.Errorf("%w: %s has no metals, sizes or stone colors to combine", ErrInvalidVariant, product.Name)
+	}
+	if len(combinations) > models.MaxProductVariants {
+		return nil, fmt.Errorf("%w: %d combinations exceed the limit of %d", ErrInvalidVariant, len(combinations), models.MaxProductVariants)
+	}
+
+	prefix := strings.TrimSpace(req.SKUPrefix)
+	if prefix == "" {
+		prefix = defaultSKUPrefix(product)
+	}
+
+	existing := make(map[string]bool)
+	for _, variant := range product.Variants {
+		existing[variant.OptionsKey()] = true
+	}
+
+	var reqs []models.CreateVariantRequest
+	for _, combination := range combinations {
+		if existing[combination.OptionsKey()] {
+			continue
+		}
+		reqs = append(reqs, models.CreateVariantRequest{
+			SKU:           models.VariantSKU(prefix, &combination),
+			Metal:         combination.Metal,
+			Size:          combination.Size,
+			StoneColors:   combination.StoneColors,
+			StockQuantity: req.StockQuantity,
+		})
+	}
+	if len(reqs) == 0 {
+		return product, nil
+	}
+
+	variants, err := buildVariants(product, reqs)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.variantRepo.AddVariants(ctx, product.ID, variants); err != nil {
+		return nil, variantSaveError(err)
+	}
+	s.recordOpeningStock(ctx, product, variants)
+	return s.productRepo.GetByID(ctx, product.ID)
+}
+
+func (s *variantService) CreateVariant(productID string, req *models.CreateVariantRequest) (*models.ProductVariant, error) {
+	ctx := context.Background()
+	product, err := s.product(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	variants, err := buildVariants(product, []models.CreateVariantRequest{*req})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.variantRepo.AddVariants(ctx, product.ID, variants); err != nil {
+		return nil, variantSaveError(err)
+	}
+	s.recordOpeningStock(ctx, product, variants)
+	return &variants[0], nil
+}
+
+// UpdateVariant changes a variant's codes, price, weight, stock or status.
+// Its options are fixed; a different combination is a new variant. A stock
+// change is recorded in the ledger as an adjustment by the actor.
+func (s *variantService) UpdateVariant(productID, variantID string, req *models.UpdateVariantRequest, actor models.OrderActor) (*models.ProductVariant, error) {
+	ctx := context.Background()
+	product, variant, err := s.variant(ctx, productID, variantID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.SKU != nil {
+		variant.SKU = normalizeSKU(*req.SKU)
+	}
+	if req.Barcode != nil {
+		variant.Barcode = strings.TrimSpace(*req.Barcode)
+	}
+	if req.Price != nil {
+		variant.Price = positiveOrNil(*req.Price)
+	}
+	if req.Weight != nil {
+		variant.Weight = positiveOrNil(*req.Weight)
+	}
+	if req.IsActive != nil {
+		variant.IsActive = *req.IsActive
+	}
+	if err := validateVariantCodes(product, variant); err != nil {
+		return nil, err
+	}
+
+	if err := s.variantRepo.UpdateVariant(ctx, product.ID, variant); err != nil {
+		return nil, variantSaveError(err)
+	}
+	if req.StockQuantity != nil {
+		if s.stockService != nil {
+			if _, err := s.stockService.SetStock(ctx, product, &variant.ID, *req.StockQuantity, "Variant stock updated", actor); err != nil {
+				return nil, variantSaveError(err)
+			}
+		} else if err := s.variantRepo.SetVariantStock(ctx, product.ID, variant.ID, *req.StockQuantity); err != nil {
+			return nil, variantSaveError(err)
+		}
+		variant.StockQuantity = *req.StockQuantity
+	}
+	return variant, nil
+}
+
+// recordOpeningStock records the stock new variants were added with
+func (s *variantService) recordOpeningStock(ctx context.Context, product *models.Product, variants []models.ProductVariant) {
+	if s.stockService == nil {
+		return
+	}
+	added := *product
+	added.Variants = variants
+	s.stockService.RecordOpeningStock(ctx, &added, "", staffActor)
+}
+
+// DeleteVariant removes a variant. Orders keep their copy of its SKU.
+func (s *variantService) DeleteVariant(productID, variantID string) error {
+	ctx := context.Background()
+	product, variant, err := s.variant(ctx, productID, variantID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.variantRepo.DeleteVariant(ctx, product.ID, variant.ID); err != nil {
+		return variantSaveError(err)
+	}
+	return nil
+}
+
+// LookupCode finds a variant by SKU or by the barcode scanned at the counter
+func (s *variantService) LookupCode(code string) (*models.VariantLookup, error) {
+	ctx := context.Background()
+	product, err := s.variantRepo.GetByCode(ctx, code)
+	if err != nil {
+		if errors.Is(err, repository.ErrVariantNotFound) {
+			return nil, fmt.Errorf("SKU or barcode %s %w", code, ErrInventoryNotFound)
+		}
+		return nil, err
+	}
+
+	variant := product.FindVariantByCode(code)
+	if variant == nil {
+		return nil, fmt.Errorf("SKU or barcode %s %w", code, ErrInventoryNotFound)
+	}
+	return &models.VariantLookup{Product: product, Variant: variant}, nil
+}
+
+func (s *variantService) product(ctx context.Context, productID string) (*models.Product, error) {
+	objID, err := primitive.ObjectIDFromHex(productID)
+	if err != nil {
+		return nil, errors.New("invalid product ID")
+	}
+	product, err := s.productRepo.GetByID(ctx, objID)
+	if err != nil {
+		return nil, fmt.Errorf("product %w", ErrInventoryNotFound)
+	}
+	return product, nil
+}
+
+func (s *variantService) variant(ctx context.Context, productID, variantID string) (*models.Product, *models.ProductVariant, error) {
+	product, err := s.product(ctx, productID)
+	if err != nil {
+		return nil, nil, err
+	}
+	objID, err := primitive.ObjectIDFromHex(variantID)
+	if err != nil {
+		return nil, nil, errors.New("invalid variant ID")
+	}
+	variant := product.FindVariant(objID)
+	if variant == nil {
+		return nil, nil, fmt.Errorf("variant %w", ErrInventoryNotFound)
+	}
+	return product, variant, nil
+}
+
+// buildVariants checks new variants against the product's options and its
+// existing variants, and returns them ready to be stored
+func buildVariants(product *models.Product, reqs []models.CreateVariantRequest) ([]models.ProductVariant, error) {
+	if len(product.Variants)+len(reqs) > models.MaxProductVariants {
+		return nil, fmt.Errorf("%w: a product can have at most %d variants", ErrInvalidVariant, models.MaxProductVariants)
+	}
+
+	// Check each new variant against the ones before it as well as the stored ones
+	check := &models.Product{
+		Name:            product.Name,
+		AvailableMetals: product.AvailableMetals,
+		AvailableSizes:  product.AvailableSizes,
+		Stones:          product.Stones,
+		Variants:        append([]models.ProductVariant(nil), product.Variants...),
+	}
+
+	now := time.Now()
+	variants := make([]models.ProductVariant, 0, len(reqs))
+	for _, req := range reqs {
+		variant := models.ProductVariant{
+			ID:            primitive.NewObjectID(),
+			SKU:           normalizeSKU(req.SKU),
+			Barcode:       strings.TrimSpace(req.Barcode),
+			Metal:         strings.TrimSpace(req.Metal),
+			Size:          strings.TrimSpace(req.Size),
+			StoneColors:   req.StoneColors,
+			StockQuantity: req.StockQuantity,
+			IsActive:      req.IsActive == nil || *req.IsActive,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+		if req.Price != nil {
+			variant.Price = positiveOrNil(*req.Price)
+		}
+		if req.Weight != nil {
+			variant.Weight = positiveOrNil(*req.Weight)
+		}
+		if len(variant.StoneColors) == 0 {
+			variant.StoneColors = nil
+		}
+
+		if variant.StockQuantity < 0 {
+			return nil, fmt.Errorf("%w: stock of %s cannot be negative", ErrInvalidVariant, variant.SKU)
+		}
+		if variant.OptionsKey() == "" {
+			return nil, fmt.Errorf("%w: %s must pick a metal, size or stone color", ErrInvalidVariant, variant.SKU)
+		}
+		options := &models.ProductCustomization{Metal: variant.Metal, RingSize: variant.Size, StoneColors: variant.StoneColors}
+		if err := check.ValidateCustomization(options); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidVariant, variant.SKU, err)
+		}
+		for _, other := range check.Variants {
+			if other.OptionsKey() == variant.OptionsKey() {
+				return nil, fmt.Errorf("%w: %s has the same options as %s", ErrInvalidVariant, variant.SKU, other.SKU)
+			}
+		}
+		if err := validateVariantCodes(check, &variant); err != nil {
+			return nil, err
+		}
+
+		check.Variants = append(check.Variants, variant)
+		variants = append(variants, variant)
+	}
+
+	return variants, nil
+}
+
+// validateVariantCodes checks that a variant's SKU and barcode are not used by
+// another variant of the product. SKUs of other products are refused by the
+// repository.
+func validateVariantCodes(product *models.Product, variant *models.ProductVariant) error {
+	if variant.SKU == "" {
+		return fmt.Errorf("%w: SKU is required", ErrInvalidVariant)
+	}
+	for _, other := range product.Variants {
+		if other.ID == variant.ID {
+			continue
+		}
+		if other.SKU == variant.SKU {
+			return fmt.Errorf("%w: SKU %s is used twice", ErrInvalidVariant, variant.SKU)
+		}
+		if variant.Barcode != "" && other.Barcode == variant.Barcode {
+			return fmt.Errorf("%w: barcode %s is used twice", ErrInvalidVariant, variant.Barcode)
+		}
+	}
+	return nil
+}
+
+// resolveVariant finds the variant a cart or order line buys, by ID or else
+// by the options picked, and returns the customization with the variant's
+// options filled in. Products without variants return the customization as is.
+func resolveVariant(product *models.Product, variantID *primitive.ObjectID, customization *models.ProductCustomization) (*models.ProductVariant, *models.ProductCustomization, error) {
+	if !product.HasVariants() {
+		if variantID != nil {
+			return nil, nil, fmt.Errorf("%w: %s has no variants", ErrVariantUnavailable, product.Name)
+		}
+		return nil, customization, nil
+	}
+
+	var variant *models.ProductVariant
+	if variantID != nil {
+		variant = product.FindVariant(*variantID)
+	} else {
+		variant = product.MatchVariant(customization)
+	}
+	if variant == nil {
+		return nil, nil, fmt.Errorf("%w: choose one of the available options of %s", ErrVariantUnavailable, product.Name)
+	}
+	if !variant.IsActive {
+		return nil, nil, fmt.Errorf("%w: %s (%s) is no longer sold", ErrVariantUnavailable, product.Name, variant.Label())
+	}
+
+	return variant, variant.Apply(customization), nil
+}
+
+// checkVariantStock returns an error if a variant cannot supply the requested units
+func checkVariantStock(product *models.Product, variant *models.ProductVariant, quantity int) error {
+	if !variant.IsActive {
+		return fmt.Errorf("%s (%s) is no longer sold", product.Name, variant.Label())
+	}
+	if product.StockType == models.StockTypeMadeToOrder {
+		return nil
+	}
+	if variant.StockQuantity <= 0 {
+		return fmt.Errorf("%s (%s) is out of stock", product.Name, variant.Label())
+	}
+	if quantity > variant.StockQuantity {
+		return fmt.Errorf("only %d of %s (%s) left in stock", variant.StockQuantity, product.Name, variant.Label())
+	}
+	return nil
+}
+
+// variantSaveError turns repository errors into the service's errors
+func variantSaveError(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrDuplicateSKU):
+		return fmt.Errorf("%w: %v", ErrInvalidVariant, err)
+	case errors.Is(err, repository.ErrVariantNotFound):
+		return fmt.Errorf("variant %w", ErrInventoryNotFound)
+	}
+	return err
+}
+
+// defaultSKUPrefix derives a short product code from the product ID
+func defaultSKUPrefix(product *models.Product) string {
+	hex := product.ID.Hex()
+	return "TJ-" + strings.ToUpper(hex[len(hex)-6:])
+}
+
+func normalizeSKU(sku string) string {
+	return strings.ToUpper(strings.TrimSpace(sku))
+}
+
+func positiveOrNil(value float64) *float64 {
+	if value <= 0 {
+		return nil
+	}
+	return &value
+}
@@ -0,0 +1,305 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memoryVariantRepository stores variants inside the products of a memoryProductRepository
+type memoryVariantRepository struct {
+	repository.VariantRepository
+	products *memoryProductRepository
+}
+
+func (r *memoryVariantRepository) save(productID primitive.ObjectID, update func(*models.Product) error) error {
+	product, ok := r.products.products[productID]
+	if !ok {
+		return repository.ErrVariantNotFound
+	}
+	product.Variants = append([]models.ProductVariant(nil), product.Variants...)
+	if err := update(&product); err != nil {
+		return err
+	}
+	for id, other := range r.products.products {
+		for _, variant := range product.Variants {
+			if id != productID && other.FindVariantByCode(variant.SKU) != nil {
+				return repository.ErrDuplicateSKU
+			}
+		}
+	}
+	product.StockQuantity = product.VariantStock()
+	r.products.products[productID] = product
+	return nil
+}
+
+func (r *memoryVariantRepository) AddVariants(ctx context.Context, productID primitive.ObjectID, variants []models.ProductVariant) error {
+	return r.save(productID, func(product *models.Product) error {
+		product.Variants = append(product.Variants, variants...)
+		return nil
+	})
+}
+
+func (r *memoryVariantRepository) UpdateVariant(ctx context.Context, productID primitive.ObjectID, variant *models.ProductVariant) error {
+	return r.save(productID, func(product *models.Product) error {
+		stored := product.FindVariant(variant.ID)
+		if stored == nil {
+			return repository.ErrVariantNotFound
+		}
+		stock := stored.StockQuantity
+		*stored = *variant
+		stored.StockQuantity = stock
+		return nil
+	})
+}
+
+func (r *memoryVariantRepository) SetVariantStock(ctx context.Context, productID, variantID primitive.ObjectID, quantity int) error {
+	return r.save(productID, func(product *models.Product) error {
+		stored := product.FindVariant(variantID)
+		if stored == nil {
+			return repository.ErrVariantNotFound
+		}
+		stored.StockQuantity = quantity
+		return nil
+	})
+}
+
+func (r *memoryVariantRepository) GetByCode(ctx context.Context, code string) (*models.Product, error) {
+	for _, product := range r.products.products {
+		if product.FindVariantByCode(code) != nil {
+			return &product, nil
+		}
+	}
+	return nil, repository.ErrVariantNotFound
+}
+
+// memoryVariantStockRepository takes variant stock from a memoryProductRepository
+type memoryVariantStockRepository struct {
+	repository.StockRepository
+	products  *memoryProductRepository
+	movements []models.StockMovement
+}
+
+func (r *memoryVariantStockRepository) ReserveVariant(ctx context.Context, productID, variantID primitive.ObjectID, quantity int) (int, error) {
+	product := r.products.products[productID]
+	variant := product.FindVariant(variantID)
+	if variant == nil || variant.StockQuantity < quantity {
+		return 0, errors.New("insufficient stock")
+	}
+	variant.StockQuantity -= quantity
+	product.StockQuantity -= quantity
+	r.products.products[productID] = product
+	return variant.StockQuantity, nil
+}
+
+func (r *memoryVariantStockRepository) RecordMovement(ctx context.Context, movement *models.StockMovement) error {
+	r.movements = append(r.movements, *movement)
+	return nil
+}
+
+// memoryCartRepository keeps carts in memory, keyed by guest session ID or user ID
+type memoryCartRepository struct {
+	repository.CartRepository
+	carts map[string]models.Cart
+}
+
+func (r *memoryCartRepository) key(cart *models.Cart) string {
+	if !cart.UserID.IsZero() {
+		return cart.UserID.Hex()
+	}
+	return cart.GuestSessionID
+}
+
+func (r *memoryCartRepository) GetByGuestSessionID(ctx context.Context, sessionID string) (*models.Cart, error) {
+	cart, ok := r.carts[sessionID]
+	if !ok {
+		return nil, repository.ErrCartNotFound
+	}
+	return &cart, nil
+}
+
+func (r *memoryCartRepository) GetByUserID(ctx context.Context, userID primitive.ObjectID) (*models.Cart, error) {
+	cart, ok := r.carts[userID.Hex()]
+	if !ok {
+		return nil, repository.ErrCartNotFound
+	}
+	return &cart, nil
+}
+
+func (r *memoryCartRepository) Create(ctx context.Context, cart *models.Cart) error {
+	r.carts[r.key(cart)] = *cart
+	return nil
+}
+
+func (r *memoryCartRepository) Update(ctx context.Context, cart *models.Cart) error {
+	r.carts[r.key(cart)] = *cart
+	return nil
+}
+
+func (r *memoryCartRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	for key, cart := range r.carts {
+		if cart.ID == id {
+			delete(r.carts, key)
+		}
+	}
+	return nil
+}
+
+func TestVariantSKUAndCombinations(t *testing.T) {
+	product := models.Product{
+		AvailableMetals: []string{"14K Gold", "18K Gold"},
+		AvailableSizes:  []string{"6", "7"},
+		Stones: []models.StoneConfig{
+			{Name: "Center Stone", AvailableColors: []string{"Red", "Blue"}},
+			{Name: "Accent", AvailableColors: []string{"Clear"}},
+		},
+	}
+	combinations := product.VariantCombinations()
+	if len(combinations) != 8 {
+		t.Fatalf("expected 8 combinations, got %d", len(combinations))
+	}
+	if sku := models.VariantSKU("tj ring", &combinations[len(combinations)-1]); sku != "TJRING-G18K-7-BL" {
+		t.Errorf("unexpected SKU %q", sku)
+	}
+	if sku := models.VariantSKU("TJ-9", &models.ProductVariant{Metal: "Rose Gold", Size: "7.5"}); sku != "TJ-9-RG-75" {
+		t.Errorf("unexpected SKU %q", sku)
+	}
+}
+
+func TestVariantsSplitStockAndPrice(t *testing.T) {
+	ctx := context.Background()
+	ring := models.Product{
+		ID:                  primitive.NewObjectID(),
+		Name:                "Solitaire Ring",
+		Price:               20000,
+		Images:              []string{"ring.jpg"},
+		StockType:           models.StockTypeStocked,
+		IsAvailable:         true,
+		AvailableMetals:     []string{"14K Gold", "18K Gold"},
+		AvailableSizes:      []string{"6", "7"},
+		MetalPriceModifiers: map[string]float64{"18K Gold": 6000},
+		EngravingEnabled:    true,
+		EngravingPrice:      500,
+		MaxEngravingChars:   10,
+	}
+	productRepo := &memoryProductRepository{products: map[primitive.ObjectID]models.Product{ring.ID: ring}}
+	variantRepo := &memoryVariantRepository{products: productRepo}
+	variants := NewVariantService(variantRepo, productRepo)
+
+	generated, err := variants.GenerateVariants(ring.ID.Hex(), &models.GenerateVariantsRequest{SKUPrefix: "RING", StockQuantity: 2})
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if len(generated.Variants) != 4 || generated.StockQuantity != 8 {
+		t.Fatalf("expected 4 variants holding 8 units, got %d holding %d", len(generated.Variants), generated.StockQuantity)
+	}
+	if again, _ := variants.GenerateVariants(ring.ID.Hex(), &models.GenerateVariantsRequest{SKUPrefix: "RING"}); len(again.Variants) != 4 {
+		t.Fatalf("expected existing combinations to be kept, got %d variants", len(again.Variants))
+	}
+	if _, err := variants.CreateVariant(ring.ID.Hex(), &models.CreateVariantRequest{SKU: "RING-X", Metal: "18K Gold", Size: "7"}); !errors.Is(err, ErrInvalidVariant) {
+		t.Fatalf("expected a repeated combination to be refused, got %v", err)
+	}
+	if _, err := variants.CreateVariant(ring.ID.Hex(), &models.CreateVariantRequest{SKU: "RING-P", Metal: "Platinum"}); !errors.Is(err, ErrInvalidVariant) {
+		t.Fatalf("expected a metal the product is not offered in to be refused, got %v", err)
+	}
+
+	// SKUs are unique across products
+	other := models.Product{ID: primitive.NewObjectID(), Name: "Band", AvailableSizes: []string{"6"}}
+	productRepo.products[other.ID] = other
+	if _, err := variants.CreateVariant(other.ID.Hex(), &models.CreateVariantRequest{SKU: "ring-g18k-7", Size: "6"}); !errors.Is(err, ErrInvalidVariant) {
+		t.Fatalf("expected a SKU used by another product to be refused, got %v", err)
+	}
+
+	lookup, err := variants.LookupCode("ring-g18k-7")
+	if err != nil || lookup.Product.ID != ring.ID {
+		t.Fatalf("lookup: %v", err)
+	}
+	admin := models.OrderActor{Type: models.OrderActorAdmin, ID: "admin-1"}
+	sold, priced := lookup.Variant, lookup.Product.MatchVariant(&models.ProductCustomization{Metal: "18K Gold", RingSize: "6"})
+	zero, price := 0, 25000.0
+	if _, err := variants.UpdateVariant(ring.ID.Hex(), sold.ID.Hex(), &models.UpdateVariantRequest{StockQuantity: &zero}, admin); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	barcode := "8901234567890"
+	if _, err := variants.UpdateVariant(ring.ID.Hex(), priced.ID.Hex(), &models.UpdateVariantRequest{Price: &price, Barcode: &barcode}, admin); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if stored := productRepo.products[ring.ID]; stored.StockQuantity != 6 {
+		t.Fatalf("expected the product to hold its variants' 6 units, got %d", stored.StockQuantity)
+	}
+	if found, err := variants.LookupCode(barcode); err != nil || found.Variant.ID != priced.ID {
+		t.Fatalf("expected the barcode to find its variant, got %v", err)
+	}
+
+	// Stock of a product sold by variant is set per variant
+	products := NewProductService(productRepo, nil)
+	if err := products.UpdateProductStock(ctx, ring.ID.Hex(), 10, "recount", admin); !errors.Is(err, ErrInvalidVariant) {
+		t.Fatalf("expected product-level stock to be refused, got %v", err)
+	}
+
+	// The variant price covers its metal; engraving is added on top
+	pricing := NewPricingService(nil)
+	product := productRepo.products[ring.ID]
+	line, err := pricing.PriceProduct(ctx, &product, &models.ProductCustomization{Metal: "18K Gold", RingSize: "6", Engraving: "AR"})
+	if err != nil || line.UnitPrice != 25500 || line.CustomizationPrice != 500 {
+		t.Fatalf("unexpected variant price %+v (%v)", line, err)
+	}
+	if line, _ := pricing.PriceProduct(ctx, &product, &models.ProductCustomization{Metal: "14K Gold", RingSize: "6"}); line.UnitPrice != 20000 {
+		t.Fatalf("expected a variant without a price to use the product's, got %.2f", line.UnitPrice)
+	}
+
+	// The cart holds variants, and a sold-out size cannot be added although the product has stock
+	cartRepo := &memoryCartRepository{carts: map[string]models.Cart{}}
+	carts := NewCartService(cartRepo, productRepo, nil)
+	if _, err := carts.AddToCart("", "guest-1", ring.ID.Hex(), "", 1, nil); !errors.Is(err, ErrVariantUnavailable) {
+		t.Fatalf("expected a variant to be required, got %v", err)
+	}
+	if _, err := carts.AddToCart("", "guest-1", ring.ID.Hex(), "", 1, &models.ProductCustomization{Metal: "18K Gold", RingSize: "7"}); err == nil || !strings.Contains(err.Error(), "out of stock") {
+		t.Fatalf("expected the sold-out variant to be refused, got %v", err)
+	}
+	cart, err := carts.AddToCart("", "guest-1", ring.ID.Hex(), priced.ID.Hex(), 1, &models.ProductCustomization{Engraving: "AR"})
+	if err != nil {
+		t.Fatalf("add to cart: %v", err)
+	}
+	item := cart.Items[0]
+	if item.VariantID == nil || *item.VariantID != priced.ID || item.Customization.Metal != "18K Gold" || item.Customization.RingSize != "6" {
+		t.Fatalf("expected the line to hold the variant and its options, got %+v", item)
+	}
+	if summary := cart.Summary.Lines[0]; summary.SKU != "RING-G18K-6" || summary.UnitPrice != 25500 {
+		t.Fatalf("unexpected cart line %+v", summary)
+	}
+	if _, err := carts.AddToCart("", "guest-1", ring.ID.Hex(), priced.ID.Hex(), 2, nil); err == nil {
+		t.Fatalf("expected more units than the variant holds to be refused")
+	}
+
+	// Checkout ties the line to its SKU and takes the variant's stock
+	orders := NewOrderService(nil, productRepo, nil).(*orderService)
+	order := &models.Order{ID: primitive.NewObjectID(), OrderNumber: "TJ-4001", Items: []models.OrderItem{
+		{ProductID: ring.ID, VariantID: &priced.ID, Quantity: 1, Price: 25500, Customization: &models.ProductCustomization{Engraving: "AR"}},
+	}}
+	loaded, err := orders.priceOrderItems(ctx, order.Items)
+	if err != nil {
+		t.Fatalf("price order: %v", err)
+	}
+	if order.Items[0].SKU != "RING-G18K-6" || order.Items[0].Price != 25500 {
+		t.Fatalf("unexpected order line %+v", order.Items[0])
+	}
+
+	stockRepo := &memoryVariantStockRepository{products: productRepo}
+	if err := NewStockService(stockRepo).ReserveOrderStock(ctx, order, loaded); err != nil {
+		t.Fatalf("reserve: %v", err)
+	}
+	stored := productRepo.products[ring.ID]
+	if stored.FindVariant(priced.ID).StockQuantity != 1 || stored.StockQuantity != 5 {
+		t.Fatalf("expected the variant and product to each lose a unit, got %d and %d", stored.FindVariant(priced.ID).StockQuantity, stored.StockQuantity)
+	}
+	if movement := stockRepo.movements[0]; movement.SKU != "RING-G18K-6" || *movement.BalanceAfter != 1 {
+		t.Fatalf("unexpected stock movement %+v", movement)
+	}
+}
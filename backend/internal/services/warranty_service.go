@@ -0,0 +1,405 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"strings"
+	"time"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxClaimPhotos is how many photos a customer may attach to one warranty claim
+const maxClaimPhotos = 5
+
+var (
+	// ErrWarrantyNotFound is returned when a warranty or claim does not exist or belongs to someone else
+	ErrWarrantyNotFound = errors.New("warranty not found")
+	// ErrClaimNotAllowed is returned when the warranty does not cover a claim
+	ErrClaimNotAllowed = errors.New("warranty claim not allowed")
+)
+
+// WarrantyService issues warranties on the lines of delivered orders from the
+// store's per-category warranty policies and runs the claims made under them:
+// customers claim against a coverage type, and admins approve or reject the
+// claim and record how it was resolved. Approving a claim uses up one claim of
+// its coverage.
+type WarrantyService interface {
+	IssueWarranties(ctx context.Context, order *models.Order) ([]models.WarrantyInfo, error)
+	ListCustomerWarranties(userID, guestSessionID string, page, limit int) ([]models.WarrantyInfo, int64, error)
+	GetCustomerWarranty(warrantyID string, actor models.OrderActor) (*models.WarrantyInfo, error)
+	GetWarrantyClaims(warrantyID string, actor models.OrderActor) ([]models.WarrantyClaim, error)
+	CreateClaim(warrantyID string, actor models.OrderActor, req *models.CreateWarrantyClaimRequest) (*models.WarrantyClaim, error)
+	AddClaimPhotos(warrantyID, claimID string, actor models.OrderActor, files []*multipart.FileHeader) (*models.WarrantyClaim, error)
+
+	// Admin
+	ListClaims(filter models.WarrantyClaimFilter) ([]models.WarrantyClaim, int64, error)
+	GetClaim(claimID string) (*models.WarrantyClaim, error)
+	ApproveClaim(claimID string, actor models.OrderActor, note string) (*models.WarrantyClaim, error)
+	RejectClaim(claimID string, actor models.OrderActor, reason string) (*models.WarrantyClaim, error)
+	CompleteClaim(claimID string, actor models.OrderActor, req *models.CompleteWarrantyClaimRequest) (*models.WarrantyClaim, error)
+}
+
+type warrantyService struct {
+	warrantyRepo   repository.WarrantyRepository
+	storefrontRepo *repository.StorefrontDataRepository
+	s3Service      *S3Service
+}
+
+// NewWarrantyService creates a new warranty service
+func NewWarrantyService(warrantyRepo repository.WarrantyRepository) WarrantyService {
+	return &warrantyService{warrantyRepo: warrantyRepo}
+}
+
+// SetStorefrontRepo reads the warranty policies from the store settings.
+// Without it the default policies are used.
+func (s *warrantyService) SetStorefrontRepo(storefrontRepo *repository.StorefrontDataRepository) {
+	s.storefrontRepo = storefrontRepo
+}
+
+// SetS3Service enables photo uploads for warranty claims
+func (s *warrantyService) SetS3Service(s3Service *S3Service) {
+	s.s3Service = s3Service
+}
+
+// IssueWarranties issues a warranty on each line of a delivered order whose
+// category has a warranty policy. Lines that already have a warranty are
+// skipped, so a delivery recorded twice issues nothing new.
+func (s *warrantyService) IssueWarranties(ctx context.Context, order *models.Order) ([]models.WarrantyInfo, error) {
+	if order.Status != models.OrderStatusDelivered || order.DeliveredAt == nil {
+		return nil, fmt.Errorf("order %s has not been delivered", order.OrderNumber)
+	}
+
+	existing, err := s.warrantyRepo.GetByOrder(ctx, order.ID)
+	if err != nil {
+		return nil, err
+	}
+	issued := make(map[int]bool)
+	for _, warranty := range existing {
+		issued[warranty.LineIndex] = true
+	}
+
+	settings, err := s.settings(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var warranties []models.WarrantyInfo
+	for i, item := range order.Items {
+		if issued[i] {
+			continue
+		}
+		policy := settings.WarrantyPolicyFor(item.Category)
+		if policy.Months <= 0 {
+			continue
+		}
+
+		coverage := make([]models.CoverageDetail, len(policy.Coverage))
+		copy(coverage, policy.Coverage)
+		for j := range coverage {
+			coverage[j].UsedClaims = 0
+		}
+
+		start := *order.DeliveredAt
+		warranty := models.WarrantyInfo{
+			OrderID:         order.ID,
+			OrderNumber:     order.OrderNumber,
+			LineIndex:       i,
+			ProductID:       item.ProductID,
+			ProductName:     item.Name,
+			Category:        item.Category,
+			Quantity:        item.Quantity,
+			UserID:          order.UserID,
+			GuestSessionID:  order.GuestSessionID,
+			WarrantyNumber:  fmt.Sprintf("WTY-%s-%d", order.OrderNumber, i+1),
+			WarrantyType:    policy.WarrantyType,
+			PurchaseDate:    order.CreatedAt,
+			WarrantyStart:   start,
+			WarrantyEnd:     start.AddDate(0, policy.Months, 0),
+			CoverageDetails: coverage,
+			Terms:           policy.Terms,
+			Exclusions:      policy.Exclusions,
+			IsActive:        true,
+		}
+		if err := s.warrantyRepo.Create(ctx, &warranty); err != nil {
+			return warranties, err
+		}
+		warranties = append(warranties, warranty)
+	}
+
+	return warranties, nil
+}
+
+func (s *warrantyService) ListCustomerWarranties(userID, guestSessionID string, page, limit int) ([]models.WarrantyInfo, int64, error) {
+	var userObjID primitive.ObjectID
+	if userID != "" {
+		objID, err := primitive.ObjectIDFromHex(userID)
+		if err != nil {
+			return nil, 0, errors.New("invalid user ID")
+		}
+		userObjID = objID
+	} else if guestSessionID == "" {
+		return nil, 0, errors.New("user ID or guest session ID is required")
+	}
+
+	return s.warrantyRepo.GetByCustomer(context.Background(), userObjID, guestSessionID, page, limit)
+}
+
+func (s *warrantyService) GetCustomerWarranty(warrantyID string, actor models.OrderActor) (*models.WarrantyInfo, error) {
+	return s.customerWarranty(context.Background(), warrantyID, actor)
+}
+
+func (s *warrantyService) GetWarrantyClaims(warrantyID string, actor models.OrderActor) ([]models.WarrantyClaim, error) {
+	ctx := context.Background()
+
+	warranty, err := s.customerWarranty(ctx, warrantyID, actor)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.warrantyRepo.GetClaimsByWarranty(ctx, warranty.ID)
+}
+
+// CreateClaim opens a claim under an active warranty. The claim type must be
+// one of the warranty's coverage types with claims left once the claims
+// already awaiting review are counted.
+func (s *warrantyService) CreateClaim(warrantyID string, actor models.OrderActor, req *models.CreateWarrantyClaimRequest) (*models.WarrantyClaim, error) {
+	ctx := context.Background()
+
+	warranty, err := s.customerWarranty(ctx, warrantyID, actor)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if !warranty.IsActive {
+		return nil, fmt.Errorf("%w: warranty %s is void", ErrClaimNotAllowed, warranty.WarrantyNumber)
+	}
+	if !warranty.IsValidAt(now) {
+		return nil, fmt.Errorf("%w: warranty %s expired on %s", ErrClaimNotAllowed, warranty.WarrantyNumber, warranty.WarrantyEnd.Format("2 Jan 2006"))
+	}
+	coverage := warranty.Coverage(req.ClaimType)
+	if coverage == nil {
+		return nil, fmt.Errorf("%w: warranty %s does not cover %s", ErrClaimNotAllowed, warranty.WarrantyNumber, req.ClaimType)
+	}
+
+	existing, err := s.warrantyRepo.GetClaimsByWarranty(ctx, warranty.ID)
+	if err != nil {
+		return nil, err
+	}
+	pending := 0
+	for _, claim := range existing {
+		if claim.Status == models.WarrantyClaimSubmitted && strings.EqualFold(claim.ClaimType, coverage.Type) {
+			pending++
+		}
+	}
+	if coverage.MaxClaims > 0 && coverage.UsedClaims+pending >= coverage.MaxClaims {
+		return nil, fmt.Errorf("%w: no %s claims left under warranty %s", ErrClaimNotAllowed, coverage.Type, warranty.WarrantyNumber)
+	}
+
+	claim := &models.WarrantyClaim{
+		WarrantyID:     warranty.ID,
+		WarrantyNumber: warranty.WarrantyNumber,
+		OrderID:        warranty.OrderID,
+		ProductName:    warranty.ProductName,
+		UserID:         warranty.UserID,
+		GuestSessionID: warranty.GuestSessionID,
+		ClaimNumber:    fmt.Sprintf("%s-C%d", warranty.WarrantyNumber, len(existing)+1),
+		ClaimType:      coverage.Type,
+		Description:    strings.TrimSpace(req.Description),
+		Status:         models.WarrantyClaimSubmitted,
+		Photos:         []string{},
+		UserNotes:      req.UserNotes,
+	}
+	if err := s.warrantyRepo.CreateClaim(ctx, claim); err != nil {
+		return nil, err
+	}
+
+	return claim, nil
+}
+
+// AddClaimPhotos uploads photos of the piece to S3 while the claim is awaiting review
+func (s *warrantyService) AddClaimPhotos(warrantyID, claimID string, actor models.OrderActor, files []*multipart.FileHeader) (*models.WarrantyClaim, error) {
+	if s.s3Service == nil || !s.s3Service.IsEnabled() {
+		return nil, errors.New("photo uploads are not configured")
+	}
+
+	ctx := context.Background()
+	warranty, err := s.customerWarranty(ctx, warrantyID, actor)
+	if err != nil {
+		return nil, err
+	}
+	claim, err := s.claim(ctx, claimID)
+	if err != nil || claim.WarrantyID != warranty.ID {
+		return nil, ErrWarrantyNotFound
+	}
+
+	if claim.Status != models.WarrantyClaimSubmitted {
+		return nil, fmt.Errorf("%w: photos cannot be added to a %s claim", ErrClaimNotAllowed, claim.Status)
+	}
+	if len(claim.Photos)+len(files) > maxClaimPhotos {
+		return nil, fmt.Errorf("%w: at most %d photos can be attached", ErrClaimNotAllowed, maxClaimPhotos)
+	}
+	if name := nonImageUpload(files); name != "" {
+		return nil, fmt.Errorf("%w: %s is not a JPG, PNG or WebP image", ErrClaimNotAllowed, name)
+	}
+
+	for _, file := range files {
+		url, err := s.s3Service.UploadFile(ctx, file, "warranty-claims/"+claim.ClaimNumber)
+		if err != nil {
+			return nil, fmt.Errorf("failed to upload %s: %w", file.Filename, err)
+		}
+		claim.Photos = append(claim.Photos, url)
+	}
+
+	if err := s.warrantyRepo.UpdateClaim(ctx, claim); err != nil {
+		return nil, err
+	}
+
+	return claim, nil
+}
+
+func (s *warrantyService) ListClaims(filter models.WarrantyClaimFilter) ([]models.WarrantyClaim, int64, error) {
+	return s.warrantyRepo.ListClaims(context.Background(), filter)
+}
+
+func (s *warrantyService) GetClaim(claimID string) (*models.WarrantyClaim, error) {
+	return s.claim(context.Background(), claimID)
+}
+
+// ApproveClaim accepts a claim and uses up one claim of its coverage
+func (s *warrantyService) ApproveClaim(claimID string, actor models.OrderActor, note string) (*models.WarrantyClaim, error) {
+	ctx := context.Background()
+
+	claim, err := s.claim(ctx, claimID)
+	if err != nil {
+		return nil, err
+	}
+	warranty, err := s.warrantyRepo.GetByID(ctx, claim.WarrantyID)
+	if err != nil {
+		return nil, ErrWarrantyNotFound
+	}
+
+	coverage := warranty.Coverage(claim.ClaimType)
+	if coverage == nil {
+		return nil, fmt.Errorf("%w: warranty %s does not cover %s", ErrClaimNotAllowed, warranty.WarrantyNumber, claim.ClaimType)
+	}
+	if !coverage.HasClaimsLeft() {
+		return nil, fmt.Errorf("%w: all %d %s claims under warranty %s are used", ErrClaimNotAllowed, coverage.MaxClaims, coverage.Type, warranty.WarrantyNumber)
+	}
+
+	if err := claim.TransitionTo(models.WarrantyClaimApproved, actor); err != nil {
+		return nil, err
+	}
+	if note != "" {
+		claim.AdminNotes = note
+	}
+
+	coverage.UsedClaims++
+	if err := s.warrantyRepo.Update(ctx, warranty); err != nil {
+		return nil, err
+	}
+	if err := s.warrantyRepo.UpdateClaim(ctx, claim); err != nil {
+		return nil, err
+	}
+
+	return claim, nil
+}
+
+func (s *warrantyService) RejectClaim(claimID string, actor models.OrderActor, reason string) (*models.WarrantyClaim, error) {
+	if strings.TrimSpace(reason) == "" {
+		return nil, errors.New("a reason is required to reject a claim")
+	}
+
+	ctx := context.Background()
+	claim, err := s.claim(ctx, claimID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := claim.TransitionTo(models.WarrantyClaimRejected, actor); err != nil {
+		return nil, err
+	}
+	claim.AdminNotes = reason
+
+	if err := s.warrantyRepo.UpdateClaim(ctx, claim); err != nil {
+		return nil, err
+	}
+
+	return claim, nil
+}
+
+// CompleteClaim records how an approved claim was resolved and what it cost the store
+func (s *warrantyService) CompleteClaim(claimID string, actor models.OrderActor, req *models.CompleteWarrantyClaimRequest) (*models.WarrantyClaim, error) {
+	ctx := context.Background()
+
+	claim, err := s.claim(ctx, claimID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := claim.TransitionTo(models.WarrantyClaimCompleted, actor); err != nil {
+		return nil, err
+	}
+	claim.ResolutionType = req.ResolutionType
+	claim.RepairCost = roundPrice(req.RepairCost)
+	if req.Notes != "" {
+		if claim.AdminNotes != "" {
+			claim.AdminNotes += "\n"
+		}
+		claim.AdminNotes += req.Notes
+	}
+
+	if err := s.warrantyRepo.UpdateClaim(ctx, claim); err != nil {
+		return nil, err
+	}
+
+	return claim, nil
+}
+
+// customerWarranty loads a warranty issued to the customer actor
+func (s *warrantyService) customerWarranty(ctx context.Context, warrantyID string, actor models.OrderActor) (*models.WarrantyInfo, error) {
+	objID, err := primitive.ObjectIDFromHex(warrantyID)
+	if err != nil {
+		return nil, errors.New("invalid warranty ID")
+	}
+
+	warranty, err := s.warrantyRepo.GetByID(ctx, objID)
+	if err != nil || !warranty.IsOwnedBy(actor) {
+		return nil, ErrWarrantyNotFound
+	}
+
+	return warranty, nil
+}
+
+// claim loads a warranty claim
+func (s *warrantyService) claim(ctx context.Context, claimID string) (*models.WarrantyClaim, error) {
+	objID, err := primitive.ObjectIDFromHex(claimID)
+	if err != nil {
+		return nil, errors.New("invalid claim ID")
+	}
+
+	claim, err := s.warrantyRepo.GetClaimByID(ctx, objID)
+	if err != nil {
+		return nil, ErrWarrantyNotFound
+	}
+
+	return claim, nil
+}
+
+// settings loads the store settings the warranty policies are read from
+func (s *warrantyService) settings(ctx context.Context) (*models.StoreSettings, error) {
+	if s.storefrontRepo == nil {
+		return models.DefaultStoreSettings(), nil
+	}
+	settings, err := s.storefrontRepo.GetStoreSettings(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load store settings: %w", err)
+	}
+	return settings, nil
+}
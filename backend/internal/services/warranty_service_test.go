@@ -0,0 +1,241 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"thyne-jewels-backend/internal/models"
+	"thyne-jewels-backend/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memoryWarrantyRepository keeps warranties and claims in memory
+type memoryWarrantyRepository struct {
+	repository.WarrantyRepository
+	warranties []models.WarrantyInfo
+	claims     []models.WarrantyClaim
+}
+
+func (r *memoryWarrantyRepository) Create(ctx context.Context, warranty *models.WarrantyInfo) error {
+	warranty.ID = primitive.NewObjectID()
+	warranty.CreatedAt = time.Now()
+	r.warranties = append(r.warranties, *warranty)
+	return nil
+}
+
+func (r *memoryWarrantyRepository) Update(ctx context.Context, warranty *models.WarrantyInfo) error {
+	for i := range r.warranties {
+		if r.warranties[i].ID == warranty.ID {
+			r.warranties[i] = *warranty
+			return nil
+		}
+	}
+	return errors.New("warranty not found")
+}
+
+func (r *memoryWarrantyRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.WarrantyInfo, error) {
+	for _, warranty := range r.warranties {
+		if warranty.ID == id {
+			warranty.CoverageDetails = append([]models.CoverageDetail(nil), warranty.CoverageDetails...)
+			return &warranty, nil
+		}
+	}
+	return nil, errors.New("warranty not found")
+}
+
+func (r *memoryWarrantyRepository) GetByOrder(ctx context.Context, orderID primitive.ObjectID) ([]models.WarrantyInfo, error) {
+	var warranties []models.WarrantyInfo
+	for _, warranty := range r.warranties {
+		if warranty.OrderID == orderID {
+			warranties = append(warranties, warranty)
+		}
+	}
+	return warranties, nil
+}
+
+func (r *memoryWarrantyRepository) CreateClaim(ctx context.Context, claim *models.WarrantyClaim) error {
+	claim.ID = primitive.NewObjectID()
+	claim.SubmittedAt = time.Now()
+	r.claims = append(r.claims, *claim)
+	return nil
+}
+
+func (r *memoryWarrantyRepository) UpdateClaim(ctx context.Context, claim *models.WarrantyClaim) error {
+	for i := range r.claims {
+		if r.claims[i].ID == claim.ID {
+			r.claims[i] = *claim
+			return nil
+		}
+	}
+	return errors.New("warranty claim not found")
+}
+
+func (r *memoryWarrantyRepository) GetClaimByID(ctx context.Context, id primitive.ObjectID) (*models.WarrantyClaim, error) {
+	for _, claim := range r.claims {
+		if claim.ID == id {
+			return &claim, nil
+		}
+	}
+	return nil, errors.New("warranty claim not found")
+}
+
+func (r *memoryWarrantyRepository) GetClaimsByWarranty(ctx context.Context, warrantyID primitive.ObjectID) ([]models.WarrantyClaim, error) {
+	var claims []models.WarrantyClaim
+	for _, claim := range r.claims {
+		if claim.WarrantyID == warrantyID {
+			claims = append(claims, claim)
+		}
+	}
+	return claims, nil
+}
+
+func TestWarrantiesIssuedOnDelivery(t *testing.T) {
+	order := models.Order{
+		ID:             primitive.NewObjectID(),
+		OrderNumber:    "TJ-4001",
+		GuestSessionID: "guest-1",
+		Items: []models.OrderItem{
+			{ProductID: primitive.NewObjectID(), Name: "Solitaire Ring", Category: "rings", Price: 45000, Quantity: 1},
+			{ProductID: primitive.NewObjectID(), Name: "Gold Coin (10g)", Category: "Coins", Price: 62000, Quantity: 2},
+			{ProductID: primitive.NewObjectID(), Name: "Pearl Pendant", Category: "Pendants", Price: 8000, Quantity: 1},
+		},
+		PaymentMethod: models.PaymentMethodCOD,
+		Status:        models.OrderStatusShipped,
+		CreatedAt:     time.Now().Add(-72 * time.Hour),
+	}
+	orderRepo := &memoryOrderRepository{orders: map[primitive.ObjectID]models.Order{order.ID: order}}
+	warrantyRepo := &memoryWarrantyRepository{}
+	warrantySvc := NewWarrantyService(warrantyRepo)
+
+	orderSvc := NewOrderService(orderRepo, nil, nil).(*orderService)
+	orderSvc.SetWarrantyService(warrantySvc)
+	admin := models.OrderActor{Type: models.OrderActorAdmin, ID: "admin-1"}
+	if err := orderSvc.UpdateOrderStatus(order.ID.Hex(), models.OrderStatusDelivered, nil, admin, ""); err != nil {
+		t.Fatalf("deliver: %v", err)
+	}
+
+	// Coins carry no warranty; pendants fall back to the default policy
+	if len(warrantyRepo.warranties) != 2 {
+		t.Fatalf("expected warranties on the ring and pendant, got %+v", warrantyRepo.warranties)
+	}
+	ring, pendant := warrantyRepo.warranties[0], warrantyRepo.warranties[1]
+	if ring.WarrantyNumber != "WTY-TJ-4001-1" || ring.LineIndex != 0 || ring.ProductName != "Solitaire Ring" {
+		t.Errorf("unexpected ring warranty %+v", ring)
+	}
+	if pendant.WarrantyNumber != "WTY-TJ-4001-3" || pendant.GuestSessionID != "guest-1" || !pendant.IsActive {
+		t.Errorf("unexpected pendant warranty %+v", pendant)
+	}
+	delivered := orderRepo.orders[order.ID].DeliveredAt
+	if delivered == nil || !ring.WarrantyStart.Equal(*delivered) || !ring.WarrantyEnd.Equal(delivered.AddDate(0, 12, 0)) {
+		t.Errorf("expected a 12 month warranty from delivery, got %s to %s", ring.WarrantyStart, ring.WarrantyEnd)
+	}
+	if ring.Coverage("resizing") == nil || pendant.Coverage("resizing") != nil {
+		t.Errorf("expected only rings to cover resizing, got %+v and %+v", ring.CoverageDetails, pendant.CoverageDetails)
+	}
+
+	// Issuing again for the same delivery adds nothing
+	delivery := orderRepo.orders[order.ID]
+	again, err := warrantySvc.IssueWarranties(context.Background(), &delivery)
+	if err != nil || len(again) != 0 || len(warrantyRepo.warranties) != 2 {
+		t.Fatalf("expected no new warranties, got %d (%v)", len(again), err)
+	}
+}
+
+func TestWarrantyClaimWorkflow(t *testing.T) {
+	delivered := time.Now().Add(-30 * 24 * time.Hour)
+	warrantyRepo := &memoryWarrantyRepository{}
+	svc := NewWarrantyService(warrantyRepo)
+	order := &models.Order{
+		ID:             primitive.NewObjectID(),
+		OrderNumber:    "TJ-4002",
+		GuestSessionID: "guest-1",
+		Items: []models.OrderItem{
+			{ProductID: primitive.NewObjectID(), Name: "Kundan Bangle", Category: "Bangles", Price: 30000, Quantity: 1},
+		},
+		Status:      models.OrderStatusDelivered,
+		DeliveredAt: &delivered,
+	}
+	issued, err := svc.IssueWarranties(context.Background(), order)
+	if err != nil || len(issued) != 1 {
+		t.Fatalf("issue: %v", err)
+	}
+	warrantyID := issued[0].ID.Hex()
+
+	customer := models.OrderActor{Type: models.OrderActorCustomer, ID: "guest-1"}
+	admin := models.OrderActor{Type: models.OrderActorAdmin, ID: "admin-1"}
+	resize := &models.CreateWarrantyClaimRequest{ClaimType: "Resizing", Description: "Too tight"}
+
+	if _, err := svc.CreateClaim(warrantyID, models.OrderActor{Type: models.OrderActorCustomer, ID: "guest-2"}, resize); !errors.Is(err, ErrWarrantyNotFound) {
+		t.Fatalf("expected another customer's warranty to be hidden, got %v", err)
+	}
+	if _, err := svc.CreateClaim(warrantyID, customer, &models.CreateWarrantyClaimRequest{ClaimType: "replacement", Description: "Lost a stone"}); !errors.Is(err, ErrClaimNotAllowed) {
+		t.Fatalf("expected an uncovered claim type to be refused, got %v", err)
+	}
+
+	claim, err := svc.CreateClaim(warrantyID, customer, resize)
+	if err != nil {
+		t.Fatalf("create claim: %v", err)
+	}
+	if claim.ClaimNumber != "WTY-TJ-4002-1-C1" || claim.ClaimType != "resizing" || claim.Status != models.WarrantyClaimSubmitted {
+		t.Fatalf("unexpected claim %+v", claim)
+	}
+
+	// The one resize is spoken for while the first claim awaits review
+	if _, err := svc.CreateClaim(warrantyID, customer, resize); !errors.Is(err, ErrClaimNotAllowed) {
+		t.Fatalf("expected a second resize claim to be refused, got %v", err)
+	}
+	if _, err := svc.CompleteClaim(claim.ID.Hex(), admin, &models.CompleteWarrantyClaimRequest{ResolutionType: models.ClaimResolutionRepair}); !errors.Is(err, models.ErrInvalidClaimStatusTransition) {
+		t.Fatalf("expected a claim to need approval before completion, got %v", err)
+	}
+
+	if _, err := svc.ApproveClaim(claim.ID.Hex(), admin, "Resize to 2.6"); err != nil {
+		t.Fatalf("approve: %v", err)
+	}
+	warranty, _ := warrantyRepo.GetByID(context.Background(), issued[0].ID)
+	if resizing := warranty.Coverage("resizing"); resizing.UsedClaims != 1 || resizing.HasClaimsLeft() {
+		t.Fatalf("expected the resize to be used up, got %+v", resizing)
+	}
+	if repair := warranty.Coverage("repair"); repair.UsedClaims != 0 {
+		t.Fatalf("expected other coverage to be untouched, got %+v", repair)
+	}
+
+	completed, err := svc.CompleteClaim(claim.ID.Hex(), admin, &models.CompleteWarrantyClaimRequest{ResolutionType: models.ClaimResolutionRepair, RepairCost: 749.995, Notes: "Resized in-house"})
+	if err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	if completed.Status != models.WarrantyClaimCompleted || completed.RepairCost != 750 || completed.ResolutionType != "repair" || completed.CompletedAt == nil {
+		t.Fatalf("unexpected completed claim %+v", completed)
+	}
+	if completed.ProcessedBy == nil || completed.ProcessedBy.ID != "admin-1" || completed.AdminNotes != "Resize to 2.6\nResized in-house" {
+		t.Fatalf("expected the approval to be recorded, got %+v", completed)
+	}
+
+	if _, err := svc.CreateClaim(warrantyID, customer, resize); !errors.Is(err, ErrClaimNotAllowed) {
+		t.Fatalf("expected no resizes to be left, got %v", err)
+	}
+
+	// Rejected claims do not use up coverage
+	repair, err := svc.CreateClaim(warrantyID, customer, &models.CreateWarrantyClaimRequest{ClaimType: "repair", Description: "Clasp broke"})
+	if err != nil {
+		t.Fatalf("create repair claim: %v", err)
+	}
+	if _, err := svc.RejectClaim(repair.ID.Hex(), admin, ""); err == nil {
+		t.Fatal("expected a reason to be required")
+	}
+	if _, err := svc.RejectClaim(repair.ID.Hex(), admin, "Damage from a fall"); err != nil {
+		t.Fatalf("reject: %v", err)
+	}
+	warranty, _ = warrantyRepo.GetByID(context.Background(), issued[0].ID)
+	if warranty.Coverage("repair").UsedClaims != 0 {
+		t.Fatalf("expected a rejected claim not to count, got %+v", warranty.Coverage("repair"))
+	}
+
+	// Claims cannot be made once the warranty has run out
+	warrantyRepo.warranties[0].WarrantyEnd = time.Now().Add(-time.Hour)
+	if _, err := svc.CreateClaim(warrantyID, customer, &models.CreateWarrantyClaimRequest{ClaimType: "cleaning", Description: "Polish"}); !errors.Is(err, ErrClaimNotAllowed) {
+		t.Fatalf("expected an expired warranty to refuse claims, got %v", err)
+	}
+}